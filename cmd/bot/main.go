@@ -9,10 +9,12 @@ import (
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/servereye/servereyebot/internal/app"
 	"github.com/servereye/servereyebot/internal/config"
 	"github.com/servereye/servereyebot/internal/logger"
+	"github.com/servereye/servereyebot/internal/migrate"
 )
 
 var (
@@ -24,7 +26,10 @@ var (
 func main() {
 	var (
 		showVersion = flag.Bool("version", false, "Show version information")
-		_           = flag.String("config", "", "Path to configuration file (optional)")
+		configPath  = flag.String("config", "", "Path to configuration file (optional), re-read on SIGHUP")
+		migrateCmd  = flag.String("migrate", "", "Run a database migration command and exit: up, down, status or force")
+		steps       = flag.Int("migrate-steps", 1, "Number of migrations reverted by -migrate down")
+		forceTo     = flag.Int("migrate-version", -1, "Version recorded as applied by -migrate force")
 	)
 	flag.Parse()
 
@@ -34,7 +39,7 @@ func main() {
 	}
 
 	// Load configuration
-	cfg, err := config.Load()
+	cfg, err := config.LoadFile(*configPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
 		os.Exit(1)
@@ -62,6 +67,13 @@ func main() {
 		os.Exit(1)
 	}
 
+	if *migrateCmd != "" {
+		if err := runMigrations(cfg, log, *migrateCmd, *steps, *forceTo); err != nil {
+			log.Fatal("Migration failed", "error", err)
+		}
+		os.Exit(0)
+	}
+
 	log.Info("Starting ServerEyeBot",
 		"version", version,
 		"commit", commit,
@@ -76,6 +88,12 @@ func main() {
 		}
 	}
 
+	if cfg.Database.AutoMigrate {
+		if err := runMigrations(cfg, log, "up", 0, 0); err != nil {
+			log.Fatal("Failed to migrate database", "error", err)
+		}
+	}
+
 	// Create bot
 	bot, err := app.New(cfg, log)
 	if err != nil {
@@ -93,19 +111,102 @@ func main() {
 
 	// Wait for interrupt signal
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 
 	log.Info("ServerEyeBot is running. Press Ctrl+C to stop.")
 
-	// Wait for signal
-	sig := <-sigChan
-	log.Info("Received signal", "signal", sig.String())
+	// Wait for a stop signal or a restart to apply rotated secrets, reloading the
+	// configuration on SIGHUP
+	restart := false
+wait:
+	for {
+		select {
+		case sig := <-sigChan:
+			log.Info("Received signal", "signal", sig.String())
+			if sig != syscall.SIGHUP {
+				break wait
+			}
+			// Failures are logged by ReloadConfig, the previous configuration stays active
+			_, _ = bot.ReloadConfig()
+		case <-bot.RestartRequested():
+			log.Info("Restart requested to apply rotated secrets")
+			restart = true
+			break wait
+		}
+	}
 
 	// Graceful shutdown
 	log.Info("Shutting down ServerEyeBot...")
 	bot.Stop()
 
 	log.Info("ServerEyeBot stopped successfully")
+	if restart {
+		// A non-zero status makes supervisors restarting on failure start the bot again
+		os.Exit(1)
+	}
+}
+
+// runMigrations runs a -migrate command against the configured database
+func runMigrations(cfg *config.Config, log logger.Logger, command string, steps, version int) error {
+	migrator, db, err := migrate.Open(cfg.Database.Driver, cfg.Database.URL)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	switch command {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			log.Info("Applied migration", "version", m.Version, "name", m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		log.Info("Database schema is up to date", "version", migrator.Latest(), "applied", len(applied))
+
+	case "down":
+		if steps < 1 {
+			return fmt.Errorf("-migrate-steps must be at least 1")
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		for _, m := range reverted {
+			log.Info("Reverted migration", "version", m.Version, "name", m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(reverted) == 0 {
+			log.Info("No applied migrations to revert")
+		}
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%03d  %-32s %s\n", s.Version, s.Name, applied)
+		}
+
+	case "force":
+		if version < 0 {
+			return fmt.Errorf("-migrate force requires -migrate-version")
+		}
+		if err := migrator.Force(ctx, version); err != nil {
+			return err
+		}
+		log.Info("Recorded migration version", "version", version)
+
+	default:
+		return fmt.Errorf("unknown migrate command '%s', expected up, down, status or force", command)
+	}
+	return nil
 }
 
 // autoConnectToNetwork attempts to connect this container to the servereye-network network
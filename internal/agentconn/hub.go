@@ -0,0 +1,272 @@
+// Package agentconn keeps persistent WebSocket connections of agents. Commands to an
+// agent with an open connection are pushed over it and answered on the same socket;
+// commands to other agents go through the fallback transport. With several replicas an
+// agent is connected to one of them, so the others reach it through the fallback.
+package agentconn
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/tracing"
+	"github.com/servereye/servereyebot/pkg/errors"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// Agent sends command messages to the agent of a server
+type Agent interface {
+	SendCommand(ctx context.Context, serverKey string, msg *protocol.Message) (*protocol.Message, error)
+}
+
+// Logger interface for agent connections
+type Logger interface {
+	Debug(msg string, fields ...interface{})
+	Info(msg string, fields ...interface{})
+	Warn(msg string, fields ...interface{})
+	Error(msg string, fields ...interface{})
+}
+
+// Hub routes agent commands over the connections of agents
+type Hub struct {
+	fallback     Agent
+	pingInterval time.Duration
+	maxMessage   int64
+	tracer       *tracing.Tracer // nil unless commands are traced
+	logger       Logger
+
+	mu       sync.Mutex
+	sessions map[string]*session // by server key
+	closed   bool
+
+	pushed    atomic.Int64
+	fallbacks atomic.Int64
+}
+
+// session is the connection of one agent and its commands waiting for a response
+type session struct {
+	conn *Conn
+	done chan struct{}
+
+	mu      sync.Mutex
+	pending map[string]chan *protocol.Message // by command message ID
+}
+
+// NewHub creates a hub sending commands of agents without a connection through fallback.
+// Connections are pinged every pingInterval and dropped when a ping goes unanswered for
+// another interval.
+func NewHub(fallback Agent, pingInterval time.Duration, maxMessage int64, logger Logger) *Hub {
+	return &Hub{
+		fallback:     fallback,
+		pingInterval: pingInterval,
+		maxMessage:   maxMessage,
+		logger:       logger,
+		sessions:     make(map[string]*session),
+	}
+}
+
+// UseTracer records a span of every command pushed over a connection with tracer
+func (h *Hub) UseTracer(tracer *tracing.Tracer) {
+	h.tracer = tracer
+}
+
+// MaxMessage returns the size limit of messages on agent connections
+func (h *Hub) MaxMessage() int64 {
+	return h.maxMessage
+}
+
+// Serve handles the connection of an authenticated agent until it is closed. A new
+// connection of the same agent replaces the previous one.
+func (h *Hub) Serve(ctx context.Context, serverKey string, conn *Conn) {
+	s := &session{conn: conn, done: make(chan struct{}), pending: make(map[string]chan *protocol.Message)}
+	conn.SetReadTimeout(2 * h.pingInterval)
+
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		_ = conn.Close()
+		return
+	}
+	previous := h.sessions[serverKey]
+	h.sessions[serverKey] = s
+	h.mu.Unlock()
+
+	if previous != nil {
+		h.logger.Info("Agent reconnected, closing previous connection", "server_key", serverKey)
+		_ = previous.conn.Close()
+	}
+	h.logger.Info("Agent connected", "server_key", serverKey)
+
+	go h.keepAlive(s)
+	err := h.receive(s)
+
+	h.mu.Lock()
+	if h.sessions[serverKey] == s {
+		delete(h.sessions, serverKey)
+	}
+	h.mu.Unlock()
+	close(s.done)
+	_ = conn.Close()
+
+	if err != nil && err != io.EOF && ctx.Err() == nil {
+		h.logger.Warn("Agent connection failed", "error", err, "server_key", serverKey)
+		return
+	}
+	h.logger.Info("Agent disconnected", "server_key", serverKey)
+}
+
+// Connected reports whether the agent of a server key has an open connection
+func (h *Hub) Connected(serverKey string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, ok := h.sessions[serverKey]
+	return ok
+}
+
+// SendCommand pushes a command over the agent's connection and waits for its response,
+// or sends it through the fallback transport when the agent is not connected. Commands
+// lost with a connection are not resent, since they may not be idempotent.
+func (h *Hub) SendCommand(ctx context.Context, serverKey string, msg *protocol.Message) (resp *protocol.Message, err error) {
+	h.mu.Lock()
+	s := h.sessions[serverKey]
+	h.mu.Unlock()
+	if s == nil {
+		h.fallbacks.Add(1)
+		return h.fallback.SendCommand(ctx, serverKey, msg)
+	}
+
+	ctx, span := h.tracer.StartChild(ctx, "agent "+string(msg.Type), tracing.KindClient)
+	if span != nil {
+		span.SetAttribute("agent.message_id", msg.ID)
+		span.SetAttribute("agent.message_type", string(msg.Type))
+		span.SetAttribute("agent.transport", "websocket")
+		defer func() {
+			if err != nil {
+				span.SetFailed()
+				span.SetAttribute("error", err.Error())
+			} else {
+				span.SetAttribute("agent.response_type", string(resp.Type))
+			}
+			span.End()
+		}()
+
+		traced := *msg
+		traced.Traceparent = span.Traceparent()
+		msg = &traced
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, errors.NewInternalError("failed to marshal command", err)
+	}
+
+	replies := make(chan *protocol.Message, 1)
+	s.mu.Lock()
+	s.pending[msg.ID] = replies
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.pending, msg.ID)
+		s.mu.Unlock()
+	}()
+
+	if err := s.conn.WriteMessage(data); err != nil {
+		// The command did not leave, so the fallback cannot run it twice
+		h.logger.Warn("Failed to push agent command, using fallback", "error", err, "server_key", serverKey, "type", msg.Type)
+		_ = s.conn.Close()
+		h.fallbacks.Add(1)
+		return h.fallback.SendCommand(ctx, serverKey, msg)
+	}
+	h.pushed.Add(1)
+	h.logger.Debug("Pushed agent command", "server_key", serverKey, "type", msg.Type, "message_id", msg.ID)
+
+	select {
+	case resp := <-replies:
+		return resp, nil
+	case <-s.done:
+		return nil, errors.NewExternalError("agent", fmt.Sprintf("connection closed before the '%s' response", msg.Type), nil)
+	case <-ctx.Done():
+		h.logger.Warn("Agent command timed out", "server_key", serverKey, "type", msg.Type, "message_id", msg.ID)
+		return nil, errors.NewTimeoutError(fmt.Sprintf("agent command '%s'", msg.Type), ctx.Err())
+	}
+}
+
+// Close closes all agent connections and refuses new ones
+func (h *Hub) Close() error {
+	h.mu.Lock()
+	h.closed = true
+	sessions := make([]*session, 0, len(h.sessions))
+	for _, s := range h.sessions {
+		sessions = append(sessions, s)
+	}
+	h.mu.Unlock()
+
+	for _, s := range sessions {
+		_ = s.conn.Close()
+	}
+	return nil
+}
+
+// WritePrometheus writes agent connection metrics in Prometheus text format
+func (h *Hub) WritePrometheus(w io.Writer) error {
+	h.mu.Lock()
+	connected := len(h.sessions)
+	h.mu.Unlock()
+
+	_, err := fmt.Fprintf(w, `# HELP servereyebot_agent_connections Agents with an open WebSocket connection.
+# TYPE servereyebot_agent_connections gauge
+servereyebot_agent_connections %d
+# HELP servereyebot_agent_commands_total Agent commands by transport.
+# TYPE servereyebot_agent_commands_total counter
+servereyebot_agent_commands_total{transport="websocket"} %d
+servereyebot_agent_commands_total{transport="fallback"} %d
+`, connected, h.pushed.Load(), h.fallbacks.Load())
+	return err
+}
+
+// receive delivers responses read from a connection to the commands waiting for them
+func (h *Hub) receive(s *session) error {
+	for {
+		data, err := s.conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+
+		var msg protocol.Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			h.logger.Warn("Malformed message from agent", "error", err)
+			continue
+		}
+
+		s.mu.Lock()
+		replies, ok := s.pending[msg.ReplyTo]
+		s.mu.Unlock()
+		if !ok {
+			h.logger.Debug("Dropped agent message without a waiting command", "type", msg.Type, "reply_to", msg.ReplyTo)
+			continue
+		}
+		replies <- &msg
+	}
+}
+
+// keepAlive pings a connection until it is closed
+func (h *Hub) keepAlive(s *session) {
+	ticker := time.NewTicker(h.pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if err := s.conn.Ping(); err != nil {
+				_ = s.conn.Close()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package agentconn
+
+import (
+	stderrors "errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// writeTimeout bounds writing a frame to a stalled peer
+const writeTimeout = 10 * time.Second
+
+// upgrader completes agent handshakes. Agents authenticate with their server key rather
+// than cookies, so requests from any origin are accepted, and handshake errors are left
+// to the caller to answer.
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+	Error:       func(w http.ResponseWriter, r *http.Request, status int, reason error) {},
+}
+
+// Conn is the server side of a WebSocket connection. Messages may be written by
+// several goroutines; only one goroutine may read.
+type Conn struct {
+	conn        *websocket.Conn
+	readTimeout time.Duration // every frame must arrive within it, 0 for no limit
+
+	writeMu sync.Mutex
+}
+
+// Upgrade completes the WebSocket handshake of a request and takes over its connection.
+// Messages longer than maxMessage bytes are rejected. Handshake errors are returned
+// without answering the request, so that the caller can answer it.
+func Upgrade(w http.ResponseWriter, r *http.Request, maxMessage int64) (*Conn, error) {
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return nil, err
+	}
+	ws.SetReadLimit(maxMessage)
+
+	c := &Conn{conn: ws}
+	ws.SetPongHandler(func(string) error {
+		return c.extendReadDeadline()
+	})
+	return c, nil
+}
+
+// SetReadTimeout bounds the wait for every frame, including pongs to pings
+func (c *Conn) SetReadTimeout(timeout time.Duration) {
+	c.readTimeout = timeout
+}
+
+// ReadMessage returns the next text or binary message, answering pings on the way.
+// io.EOF is returned when the peer closes the connection.
+func (c *Conn) ReadMessage() ([]byte, error) {
+	if err := c.extendReadDeadline(); err != nil {
+		return nil, err
+	}
+
+	_, message, err := c.conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if stderrors.As(err, &closeErr) {
+		return nil, io.EOF
+	}
+	return message, err
+}
+
+// WriteMessage sends a text message
+func (c *Conn) WriteMessage(data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if err := c.conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return err
+	}
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// Ping sends a ping the peer has to answer within the read timeout
+func (c *Conn) Ping() error {
+	return c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout))
+}
+
+// Close sends a close frame and closes the connection
+func (c *Conn) Close() error {
+	_ = c.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(writeTimeout))
+	return c.conn.Close()
+}
+
+// extendReadDeadline gives the peer another read timeout to send its next frame
+func (c *Conn) extendReadDeadline() error {
+	if c.readTimeout <= 0 {
+		return nil
+	}
+	return c.conn.SetReadDeadline(time.Now().Add(c.readTimeout))
+}
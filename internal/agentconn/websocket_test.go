@@ -0,0 +1,211 @@
+package agentconn_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/servereye/servereyebot/internal/agentconn"
+)
+
+// serve starts a server upgrading every request and handing the connection to handle.
+// Handshake errors are answered with 400 and the error text.
+func serve(t *testing.T, maxMessage int64, handle func(conn *agentconn.Conn)) string {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := agentconn.Upgrade(w, r, maxMessage)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		handle(conn)
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+// dial connects a client to a server started by serve
+func dial(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+
+	client, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestUpgradeRejectsPlainRequests(t *testing.T) {
+	url := serve(t, 1024, func(conn *agentconn.Conn) {
+		t.Error("plain request was upgraded")
+	})
+
+	resp, err := http.Get("http" + strings.TrimPrefix(url, "ws"))
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d answered by the caller", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestConnEcho(t *testing.T) {
+	url := serve(t, 1024, func(conn *agentconn.Conn) {
+		defer conn.Close()
+		for {
+			message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(message); err != nil {
+				return
+			}
+		}
+	})
+	client := dial(t, url)
+
+	messages := []string{"{}", strings.Repeat("x", 125), strings.Repeat("y", 126), strings.Repeat("z", 1000)}
+	for _, message := range messages {
+		if err := client.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+			t.Fatalf("WriteMessage: %v", err)
+		}
+		kind, echoed, err := client.ReadMessage()
+		if err != nil {
+			t.Fatalf("ReadMessage: %v", err)
+		}
+		if kind != websocket.TextMessage || string(echoed) != message {
+			t.Errorf("echo of %d bytes = type %d, %d bytes", len(message), kind, len(echoed))
+		}
+	}
+}
+
+func TestConnReadsFragmentedMessages(t *testing.T) {
+	received := make(chan string, 1)
+	url := serve(t, 1024, func(conn *agentconn.Conn) {
+		defer conn.Close()
+		message, err := conn.ReadMessage()
+		if err != nil {
+			t.Errorf("ReadMessage: %v", err)
+		}
+		received <- string(message)
+	})
+
+	// A small write buffer makes the client send the message in several frames
+	dialer := websocket.Dialer{WriteBufferSize: 16}
+	client, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer client.Close()
+
+	message := strings.Repeat("fragment ", 20)
+	w, err := client.NextWriter(websocket.TextMessage)
+	if err != nil {
+		t.Fatalf("NextWriter: %v", err)
+	}
+	for _, part := range strings.SplitAfter(message, " ") {
+		if _, err := io.WriteString(w, part); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close writer: %v", err)
+	}
+
+	if got := <-received; got != message {
+		t.Errorf("received %q, want %q", got, message)
+	}
+}
+
+func TestConnRejectsLongMessages(t *testing.T) {
+	readErr := make(chan error, 1)
+	url := serve(t, 64, func(conn *agentconn.Conn) {
+		defer conn.Close()
+		_, err := conn.ReadMessage()
+		readErr <- err
+	})
+	client := dial(t, url)
+
+	if err := client.WriteMessage(websocket.TextMessage, []byte(strings.Repeat("x", 65))); err != nil {
+		t.Fatalf("WriteMessage: %v", err)
+	}
+
+	if err := <-readErr; err == nil || err == io.EOF {
+		t.Errorf("ReadMessage of a message over the limit = %v, want an error", err)
+	}
+	if _, _, err := client.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Errorf("client read = %v, want a close with code %d", err, websocket.CloseMessageTooBig)
+	}
+}
+
+func TestConnCloseHandshake(t *testing.T) {
+	readErr := make(chan error, 1)
+	url := serve(t, 1024, func(conn *agentconn.Conn) {
+		_, err := conn.ReadMessage()
+		readErr <- err
+	})
+	client := dial(t, url)
+
+	closing := websocket.FormatCloseMessage(websocket.CloseGoingAway, "restart")
+	if err := client.WriteControl(websocket.CloseMessage, closing, time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("WriteControl: %v", err)
+	}
+
+	if err := <-readErr; err != io.EOF {
+		t.Errorf("ReadMessage after the peer closed = %v, want io.EOF", err)
+	}
+	// The server echoes the close frame
+	if _, _, err := client.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("client read = %v, want the close frame echoed", err)
+	}
+}
+
+func TestConnPingAndReadTimeout(t *testing.T) {
+	readErr := make(chan error, 1)
+	url := serve(t, 1024, func(conn *agentconn.Conn) {
+		defer conn.Close()
+		conn.SetReadTimeout(100 * time.Millisecond)
+		if err := conn.Ping(); err != nil {
+			t.Errorf("Ping: %v", err)
+		}
+		_, err := conn.ReadMessage()
+		readErr <- err
+	})
+	client := dial(t, url)
+
+	pinged := make(chan struct{}, 1)
+	client.SetPingHandler(func(data string) error {
+		pinged <- struct{}{}
+		return nil // no pong, so the server times out
+	})
+	go func() {
+		for {
+			if _, _, err := client.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-pinged:
+	case <-time.After(time.Second):
+		t.Fatal("client was not pinged")
+	}
+
+	select {
+	case err := <-readErr:
+		if err == nil || err == io.EOF {
+			t.Errorf("ReadMessage of a silent peer = %v, want a timeout", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("ReadMessage did not time out")
+	}
+}
@@ -0,0 +1,53 @@
+package alerts
+
+import "time"
+
+// Alertmanager alert statuses
+const (
+	AlertmanagerFiring   = "firing"
+	AlertmanagerResolved = "resolved"
+)
+
+// AlertmanagerWebhook represents the payload Prometheus Alertmanager posts to webhook
+// receivers (version 4 of the format)
+type AlertmanagerWebhook struct {
+	Version           string              `json:"version"`
+	GroupKey          string              `json:"groupKey"`
+	TruncatedAlerts   int                 `json:"truncatedAlerts"`
+	Status            string              `json:"status"`
+	Receiver          string              `json:"receiver"`
+	GroupLabels       map[string]string   `json:"groupLabels"`
+	CommonLabels      map[string]string   `json:"commonLabels"`
+	CommonAnnotations map[string]string   `json:"commonAnnotations"`
+	ExternalURL       string              `json:"externalURL"`
+	Alerts            []AlertmanagerAlert `json:"alerts"`
+}
+
+// AlertmanagerAlert represents a single alert of an Alertmanager webhook
+type AlertmanagerAlert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+// Name returns the name of the alert rule
+func (a AlertmanagerAlert) Name() string {
+	if name := a.Labels["alertname"]; name != "" {
+		return name
+	}
+	return "alert"
+}
+
+// Summary returns the human readable description of the alert, if the rule has one
+func (a AlertmanagerAlert) Summary() string {
+	for _, key := range []string{"summary", "description", "message"} {
+		if text := a.Annotations[key]; text != "" {
+			return text
+		}
+	}
+	return ""
+}
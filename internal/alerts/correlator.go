@@ -0,0 +1,155 @@
+package alerts
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Alert represents a threshold violation on a server
+type Alert struct {
+	ServerID   string
+	ServerName string
+	Metric     string
+	Value      float64
+	Threshold  float64
+	Recipients []int64 // Telegram IDs notified about the server
+	FiredAt    time.Time
+}
+
+// Group is a batch of alerts ready for delivery. Alerts of several servers sharing
+// a tag form one group with the tag set, any other alert is delivered alone.
+type Group struct {
+	Tag    string // empty for a single uncorrelated alert
+	Alerts []Alert
+}
+
+// Correlated reports whether the group holds alerts of more than one server
+func (g Group) Correlated() bool {
+	return g.Tag != "" && len(g.Servers()) > 1
+}
+
+// Servers returns the distinct servers of the group in order of their first alert
+func (g Group) Servers() []string {
+	var servers []string
+	seen := make(map[string]bool)
+	for _, alert := range g.Alerts {
+		if !seen[alert.ServerID] {
+			seen[alert.ServerID] = true
+			servers = append(servers, alert.ServerID)
+		}
+	}
+	return servers
+}
+
+// held is an alert waiting in the groups of its tags
+type held struct {
+	alert     Alert
+	groups    int // groups still holding the alert
+	delivered bool
+}
+
+// window collects alerts of one tag until its deadline
+type window struct {
+	tag      string
+	deadline time.Time
+	alerts   []*held
+}
+
+// Correlator holds alerts of tagged servers for the correlation window of their tags,
+// so that servers failing together are reported as one possible common cause
+type Correlator struct {
+	mu      sync.Mutex
+	windows map[string]*window
+}
+
+// NewCorrelator creates an empty correlator
+func NewCorrelator() *Correlator {
+	return &Correlator{
+		windows: make(map[string]*window),
+	}
+}
+
+// Add holds an alert in the open window of each of its tags, opening windows of the
+// given length where none is open. An alert without tags is due immediately.
+func (c *Correlator) Add(alert Alert, tagWindows map[string]time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	h := &held{alert: alert}
+
+	if len(tagWindows) == 0 {
+		// Untagged alerts are never correlated and get a window of their own
+		key := fmt.Sprintf("\x00%s\x00%s\x00%d", alert.ServerID, alert.Metric, alert.FiredAt.UnixNano())
+		h.groups = 1
+		c.windows[key] = &window{deadline: alert.FiredAt, alerts: []*held{h}}
+		return
+	}
+
+	for tag, length := range tagWindows {
+		w, ok := c.windows[tag]
+		if !ok {
+			w = &window{tag: tag, deadline: alert.FiredAt.Add(length)}
+			c.windows[tag] = w
+		}
+		w.alerts = append(w.alerts, h)
+		h.groups++
+	}
+}
+
+// Due closes the windows whose deadline has passed and returns their alerts grouped for delivery.
+// Alerts of several servers in a closed window are grouped under its tag; an alert that was not
+// correlated in any of its windows is returned alone once its last window closes.
+func (c *Correlator) Due(now time.Time) []Group {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var closed []*window
+	for key, w := range c.windows {
+		if !w.deadline.After(now) {
+			closed = append(closed, w)
+			delete(c.windows, key)
+		}
+	}
+	sort.Slice(closed, func(i, j int) bool {
+		if !closed[i].deadline.Equal(closed[j].deadline) {
+			return closed[i].deadline.Before(closed[j].deadline)
+		}
+		return closed[i].tag < closed[j].tag
+	})
+
+	var groups []Group
+	for _, w := range closed {
+		if w.tag == "" {
+			continue
+		}
+
+		group := Group{Tag: w.tag}
+		for _, h := range w.alerts {
+			if !h.delivered {
+				group.Alerts = append(group.Alerts, h.alert)
+			}
+		}
+		if !group.Correlated() {
+			continue
+		}
+
+		for _, h := range w.alerts {
+			h.delivered = true
+		}
+		groups = append(groups, group)
+	}
+
+	for _, w := range closed {
+		for _, h := range w.alerts {
+			h.groups--
+			if h.groups == 0 && !h.delivered {
+				h.delivered = true
+				groups = append(groups, Group{Alerts: []Alert{h.alert}})
+			}
+		}
+	}
+
+	return groups
+}
@@ -0,0 +1,205 @@
+package alerts
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Passive check states, the exit codes of Nagios plugins. Host checks report UP, DOWN
+// and UNREACHABLE as 0, 1 and 2, a host that is not UP is critical.
+const (
+	CheckOK       CheckState = 0
+	CheckWarning  CheckState = 1
+	CheckCritical CheckState = 2
+	CheckUnknown  CheckState = 3
+)
+
+// HostCheckService is the service name of host check results
+const HostCheckService = "HOST"
+
+// CheckState represents the state of a passive check
+type CheckState int
+
+// ParseCheckState parses a state given as a plugin exit code or a Nagios or Zabbix state name
+func ParseCheckState(value string) (CheckState, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if code, err := strconv.Atoi(value); err == nil {
+		if code < int(CheckOK) || code > int(CheckUnknown) {
+			return 0, fmt.Errorf("check state %d out of range", code)
+		}
+		return CheckState(code), nil
+	}
+
+	switch value {
+	case "OK", "UP", "RESOLVED":
+		return CheckOK, nil
+	case "WARNING", "WARN", "INFORMATION", "AVERAGE":
+		return CheckWarning, nil
+	case "CRITICAL", "CRIT", "DOWN", "UNREACHABLE", "PROBLEM", "HIGH", "DISASTER":
+		return CheckCritical, nil
+	case "UNKNOWN":
+		return CheckUnknown, nil
+	default:
+		return 0, fmt.Errorf("unknown check state '%s'", value)
+	}
+}
+
+// String returns the Nagios name of the state
+func (s CheckState) String() string {
+	switch s {
+	case CheckOK:
+		return "OK"
+	case CheckWarning:
+		return "WARNING"
+	case CheckCritical:
+		return "CRITICAL"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// Icon returns the emoji shown next to checks in the state
+func (s CheckState) Icon() string {
+	switch s {
+	case CheckOK:
+		return "🟢"
+	case CheckWarning:
+		return "🟡"
+	case CheckCritical:
+		return "🔴"
+	default:
+		return "⚪"
+	}
+}
+
+// UnmarshalJSON accepts a state as a number or a name
+func (s *CheckState) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		value = string(data)
+	}
+
+	state, err := ParseCheckState(value)
+	if err != nil {
+		return err
+	}
+	*s = state
+	return nil
+}
+
+// PassiveCheckResult represents a check result submitted by Nagios, Icinga or Zabbix
+type PassiveCheckResult struct {
+	Host      string     `json:"host"`
+	Service   string     `json:"service"` // empty or HOST for host checks
+	State     CheckState `json:"state"`
+	Output    string     `json:"output"`
+	Timestamp int64      `json:"timestamp,omitempty"` // Unix time of the check, the time of receipt when zero
+}
+
+// Normalize trims the fields of the result and names host checks HOST. A host that is
+// not UP is critical whatever code it was reported with.
+func (r *PassiveCheckResult) Normalize() {
+	r.Host = strings.TrimSpace(r.Host)
+	r.Service = strings.TrimSpace(r.Service)
+	r.Output = strings.TrimSpace(r.Output)
+	if r.Service == "" || strings.EqualFold(r.Service, HostCheckService) {
+		r.Service = HostCheckService
+		if r.State != CheckOK {
+			r.State = CheckCritical
+		}
+	}
+}
+
+// CheckedAt returns the time of the check, bounded by now
+func (r PassiveCheckResult) CheckedAt(now time.Time) time.Time {
+	if r.Timestamp <= 0 {
+		return now
+	}
+	if at := time.Unix(r.Timestamp, 0); at.Before(now) {
+		return at
+	}
+	return now
+}
+
+// ParsePassiveChecks parses check results in the formats Nagios sends them to
+// external programs, one per line:
+//
+//	[1700000000] PROCESS_SERVICE_CHECK_RESULT;host;service;2;output
+//	[1700000000] PROCESS_HOST_CHECK_RESULT;host;1;output
+//	host<TAB>service<TAB>2<TAB>output   (send_nsca)
+//	host<TAB>1<TAB>output               (send_nsca host check)
+//
+// Blank lines and lines starting with # are skipped.
+func ParsePassiveChecks(text string) ([]PassiveCheckResult, error) {
+	var results []PassiveCheckResult
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		result, err := parsePassiveCheck(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// parsePassiveCheck parses a single check result line
+func parsePassiveCheck(line string) (PassiveCheckResult, error) {
+	var result PassiveCheckResult
+
+	if strings.HasPrefix(line, "[") {
+		end := strings.Index(line, "]")
+		if end < 0 {
+			return result, fmt.Errorf("unterminated timestamp")
+		}
+		timestamp, err := strconv.ParseInt(line[1:end], 10, 64)
+		if err != nil {
+			return result, fmt.Errorf("invalid timestamp '%s'", line[1:end])
+		}
+		result.Timestamp = timestamp
+		line = strings.TrimSpace(line[end+1:])
+	}
+
+	var fields []string
+	switch {
+	case strings.HasPrefix(line, "PROCESS_SERVICE_CHECK_RESULT;"):
+		fields = strings.SplitN(strings.TrimPrefix(line, "PROCESS_SERVICE_CHECK_RESULT;"), ";", 4)
+		if len(fields) != 4 {
+			return result, fmt.Errorf("expected host;service;state;output")
+		}
+	case strings.HasPrefix(line, "PROCESS_HOST_CHECK_RESULT;"):
+		fields = strings.SplitN(strings.TrimPrefix(line, "PROCESS_HOST_CHECK_RESULT;"), ";", 3)
+		if len(fields) != 3 {
+			return result, fmt.Errorf("expected host;state;output")
+		}
+		fields = append([]string{fields[0], HostCheckService}, fields[1:]...)
+	default:
+		fields = strings.SplitN(line, "\t", 4)
+		switch len(fields) {
+		case 3:
+			fields = append([]string{fields[0], HostCheckService}, fields[1:]...)
+		case 4:
+		default:
+			return result, fmt.Errorf("unrecognized check result format")
+		}
+	}
+
+	state, err := ParseCheckState(fields[2])
+	if err != nil {
+		return result, err
+	}
+
+	result.Host = fields[0]
+	result.Service = fields[1]
+	result.State = state
+	result.Output = fields[3]
+	result.Normalize()
+	return result, nil
+}
@@ -8,17 +8,32 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/servereye/servereyebot/internal/tracing"
 	"github.com/servereye/servereyebot/pkg/domain"
 	"github.com/servereye/servereyebot/pkg/errors"
+	"github.com/servereye/servereyebot/pkg/protocol"
 )
 
 // Client represents ServerEye API client
 type Client struct {
-	baseURL    string
-	httpClient *http.Client
-	logger     Logger
+	endpoints     []string     // primary base URL first, then fallbacks
+	active        atomic.Int32 // index of the endpoint requests are sent to
+	onSwitch      func(EndpointSwitch)
+	httpClient    *http.Client
+	commandClient *http.Client // agent commands, bounded by request context only
+	retry         RetryPolicy
+	tracer        *tracing.Tracer // nil unless agent commands are traced
+	logger        Logger
+}
+
+// RetryPolicy represents retry behaviour of API requests
+type RetryPolicy struct {
+	Attempts int
+	Delay    time.Duration
+	MaxDelay time.Duration
 }
 
 // Logger interface for API client
@@ -30,13 +45,68 @@ type Logger interface {
 }
 
 // NewClient creates a new API client
-func NewClient(baseURL string, logger Logger) *Client {
+func NewClient(baseURL string, timeout time.Duration, retry RetryPolicy, logger Logger) *Client {
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	if retry.Attempts < 1 {
+		retry.Attempts = 1
+	}
+
 	return &Client{
-		baseURL: baseURL,
+		endpoints: []string{baseURL},
 		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout: timeout,
 		},
-		logger: logger,
+		commandClient: &http.Client{},
+		retry:         retry,
+		logger:        logger,
+	}
+}
+
+// UseTracer records a span of every agent command with tracer
+func (c *Client) UseTracer(tracer *tracing.Tracer) {
+	c.tracer = tracer
+}
+
+// do executes a request, retrying transport errors and 5xx responses
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	delay := c.retry.Delay
+
+	for attempt := 1; ; attempt++ {
+		resp, err := c.httpClient.Do(req)
+		retryable := err != nil || resp.StatusCode >= http.StatusInternalServerError
+		if !retryable || attempt >= c.retry.Attempts {
+			return resp, err
+		}
+
+		if resp != nil {
+			_ = resp.Body.Close()
+		}
+
+		if req.Body != nil {
+			if req.GetBody == nil {
+				return nil, fmt.Errorf("request body cannot be replayed for retry")
+			}
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return nil, bodyErr
+			}
+			req.Body = body
+		}
+
+		c.logger.Warn("Retrying API request", "url", req.URL.String(), "attempt", attempt, "delay", delay.String())
+
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+
+		delay *= 2
+		if c.retry.MaxDelay > 0 && delay > c.retry.MaxDelay {
+			delay = c.retry.MaxDelay
+		}
 	}
 }
 
@@ -81,17 +151,17 @@ type GetServerSourcesResponse struct {
 func (c *Client) GetServerSources(ctx context.Context, serverKey string) (*GetServerSourcesResponse, error) {
 	c.logger.Debug("Getting server sources", "server_key", serverKey)
 
-	url := fmt.Sprintf("%s/api/servers/by-key/%s/sources", c.baseURL, serverKey)
+	url := fmt.Sprintf("%s/api/servers/by-key/%s/sources", c.BaseURL(), serverKey)
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, errors.NewInternalError("failed to create request", err)
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		c.logger.Error("Failed to get server sources", "error", err, "server_key", serverKey)
-		return nil, errors.NewExternalError("ServerEye API", "get server sources", err)
+		return nil, errors.NewAPIUnavailableError("get server sources", err)
 	}
 	defer func() {
 		_ = resp.Body.Close()
@@ -99,12 +169,12 @@ func (c *Client) GetServerSources(ctx context.Context, serverKey string) (*GetSe
 
 	if resp.StatusCode == http.StatusNotFound {
 		c.logger.Warn("Server not found", "server_key", serverKey, "status", resp.StatusCode)
-		return nil, errors.NewNotFoundError(fmt.Sprintf("server with key '%s'", serverKey))
+		return nil, errors.NewServerNotFoundError(serverKey)
 	}
 
 	if resp.StatusCode != http.StatusOK {
 		c.logger.Error("Unexpected status code", "status", resp.StatusCode, "server_key", serverKey)
-		return nil, errors.NewExternalError("ServerEye API", fmt.Sprintf("unexpected status code: %d", resp.StatusCode), nil)
+		return nil, errors.NewAPIUnavailableError(fmt.Sprintf("unexpected status code: %d", resp.StatusCode), nil)
 	}
 
 	var response GetServerSourcesResponse
@@ -124,7 +194,7 @@ func (c *Client) GetServerSources(ctx context.Context, serverKey string) (*GetSe
 func (c *Client) AddServerSourceByRequest(ctx context.Context, serverKey string) (*AddServerSourceResponse, error) {
 	c.logger.Debug("Adding server source by key", "server_key", serverKey, "source", "TGBot")
 
-	url := fmt.Sprintf("%s/api/servers/by-key/%s/sources", c.baseURL, serverKey)
+	url := fmt.Sprintf("%s/api/servers/by-key/%s/sources", c.BaseURL(), serverKey)
 
 	reqBody := AddServerSourceRequest{
 		Source: "TGBot",
@@ -142,10 +212,10 @@ func (c *Client) AddServerSourceByRequest(ctx context.Context, serverKey string)
 
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		c.logger.Error("Failed to add server source", "error", err, "server_key", serverKey)
-		return nil, errors.NewExternalError("ServerEye API", "add server source", err)
+		return nil, errors.NewAPIUnavailableError("add server source", err)
 	}
 	defer func() {
 		_ = resp.Body.Close()
@@ -153,12 +223,12 @@ func (c *Client) AddServerSourceByRequest(ctx context.Context, serverKey string)
 
 	if resp.StatusCode == http.StatusNotFound {
 		c.logger.Warn("Server not found", "server_key", serverKey, "status", resp.StatusCode)
-		return nil, errors.NewNotFoundError(fmt.Sprintf("server with key '%s'", serverKey))
+		return nil, errors.NewServerNotFoundError(serverKey)
 	}
 
 	if resp.StatusCode != http.StatusOK {
 		c.logger.Error("Unexpected status code", "status", resp.StatusCode, "server_key", serverKey)
-		return nil, errors.NewExternalError("ServerEye API", fmt.Sprintf("unexpected status code: %d", resp.StatusCode), nil)
+		return nil, errors.NewAPIUnavailableError(fmt.Sprintf("unexpected status code: %d", resp.StatusCode), nil)
 	}
 
 	var response AddServerSourceResponse
@@ -177,16 +247,16 @@ func (c *Client) AddServerSourceByRequest(ctx context.Context, serverKey string)
 // ValidateServerID validates server ID format
 func ValidateServerID(serverID string) error {
 	if serverID == "" {
-		return errors.NewValidationError("server ID cannot be empty", nil)
+		return errors.NewInvalidKeyError("server ID cannot be empty", nil)
 	}
 
 	// Basic validation - server ID should start with "srv_" and have reasonable length
 	if len(serverID) < 4 {
-		return errors.NewValidationError("server ID too short", map[string]interface{}{"min_length": 4})
+		return errors.NewInvalidKeyError("server ID too short", map[string]interface{}{"min_length": 4})
 	}
 
 	if len(serverID) > 100 {
-		return errors.NewValidationError("server ID too long", map[string]interface{}{"max_length": 100})
+		return errors.NewInvalidKeyError("server ID too long", map[string]interface{}{"max_length": 100})
 	}
 
 	return nil
@@ -196,17 +266,17 @@ func ValidateServerID(serverID string) error {
 func (c *Client) GetServerMetrics(ctx context.Context, serverKey string) (*domain.MetricsResponse, error) {
 	c.logger.Debug("Getting server metrics", "server_key", serverKey)
 
-	url := fmt.Sprintf("%s/api/servers/by-key/%s/metrics", c.baseURL, serverKey)
+	url := fmt.Sprintf("%s/api/servers/by-key/%s/metrics", c.BaseURL(), serverKey)
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, errors.NewInternalError("failed to create request", err)
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		c.logger.Error("Failed to get server metrics", "error", err, "server_key", serverKey)
-		return nil, errors.NewExternalError("ServerEye API", "get server metrics", err)
+		return nil, errors.NewAPIUnavailableError("get server metrics", err)
 	}
 	defer func() {
 		_ = resp.Body.Close()
@@ -214,12 +284,12 @@ func (c *Client) GetServerMetrics(ctx context.Context, serverKey string) (*domai
 
 	if resp.StatusCode == http.StatusNotFound {
 		c.logger.Warn("Server not found", "server_key", serverKey, "status", resp.StatusCode)
-		return nil, errors.NewNotFoundError(fmt.Sprintf("server with key '%s'", serverKey))
+		return nil, errors.NewServerNotFoundError(serverKey)
 	}
 
 	if resp.StatusCode != http.StatusOK {
 		c.logger.Error("Unexpected status code", "status", resp.StatusCode, "server_key", serverKey)
-		return nil, errors.NewExternalError("ServerEye API", fmt.Sprintf("unexpected status code: %d", resp.StatusCode), nil)
+		return nil, errors.NewAPIUnavailableError(fmt.Sprintf("unexpected status code: %d", resp.StatusCode), nil)
 	}
 
 	var response domain.MetricsResponse
@@ -232,11 +302,39 @@ func (c *Client) GetServerMetrics(ctx context.Context, serverKey string) (*domai
 	return &response, nil
 }
 
+// Health checks that the ServerEye API is reachable and healthy at the address in use.
+// It is not retried, so that health checks report an outage as soon as it happens.
+func (c *Client) Health(ctx context.Context) error {
+	return c.probe(ctx, c.BaseURL())
+}
+
+// probe checks the health endpoint of the API at a base URL
+func (c *Client) probe(ctx context.Context, baseURL string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", baseURL+"/health", nil)
+	if err != nil {
+		return errors.NewInternalError("failed to create request", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return errors.NewAPIUnavailableError("health check", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.NewAPIUnavailableError(fmt.Sprintf("unexpected health status code: %d", resp.StatusCode), nil)
+	}
+
+	return nil
+}
+
 // AddTelegramIdentifier adds Telegram ID to server source identifiers
 func (c *Client) AddTelegramIdentifier(ctx context.Context, serverKey, telegramID, username, firstName string) (*AddIdentifierResponse, error) {
 	c.logger.Debug("Adding Telegram identifier", "server_key", serverKey, "telegram_id", telegramID)
 
-	url := fmt.Sprintf("%s/api/servers/by-key/%s/sources/identifiers", c.baseURL, serverKey)
+	url := fmt.Sprintf("%s/api/servers/by-key/%s/sources/identifiers", c.BaseURL(), serverKey)
 
 	reqBody := AddIdentifierRequest{
 		SourceType:     "TGBot",
@@ -261,10 +359,10 @@ func (c *Client) AddTelegramIdentifier(ctx context.Context, serverKey, telegramI
 
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		c.logger.Error("Failed to add Telegram identifier", "error", err, "server_key", serverKey, "telegram_id", telegramID)
-		return nil, errors.NewExternalError("ServerEye API", "add telegram identifier", err)
+		return nil, errors.NewAPIUnavailableError("add telegram identifier", err)
 	}
 	defer func() {
 		_ = resp.Body.Close()
@@ -275,7 +373,7 @@ func (c *Client) AddTelegramIdentifier(ctx context.Context, serverKey, telegramI
 		// Success case
 	case http.StatusNotFound:
 		c.logger.Warn("Server not found", "server_key", serverKey, "status", resp.StatusCode)
-		return nil, errors.NewNotFoundError(fmt.Sprintf("server with key '%s'", serverKey))
+		return nil, errors.NewServerNotFoundError(serverKey)
 	case http.StatusBadRequest:
 		// Could be "already exists" or "invalid data"
 		body, _ := io.ReadAll(resp.Body)
@@ -299,7 +397,7 @@ func (c *Client) AddTelegramIdentifier(ctx context.Context, serverKey, telegramI
 		})
 	default:
 		c.logger.Error("Unexpected status code", "status", resp.StatusCode, "server_key", serverKey, "telegram_id", telegramID)
-		return nil, errors.NewExternalError("ServerEye API", fmt.Sprintf("unexpected status code: %d", resp.StatusCode), nil)
+		return nil, errors.NewAPIUnavailableError(fmt.Sprintf("unexpected status code: %d", resp.StatusCode), nil)
 	}
 
 	var response AddIdentifierResponse
@@ -320,17 +418,17 @@ func (c *Client) AddTelegramIdentifier(ctx context.Context, serverKey, telegramI
 func (c *Client) RemoveServerSource(ctx context.Context, serverKey, source string) error {
 	c.logger.Debug("Removing server source", "server_key", serverKey, "source", source)
 
-	url := fmt.Sprintf("%s/api/servers/by-key/%s/sources/%s", c.baseURL, serverKey, source)
+	url := fmt.Sprintf("%s/api/servers/by-key/%s/sources/%s", c.BaseURL(), serverKey, source)
 
 	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
 	if err != nil {
 		return errors.NewInternalError("failed to create request", err)
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		c.logger.Error("Failed to remove server source", "error", err, "server_key", serverKey, "source", source)
-		return errors.NewExternalError("ServerEye API", "remove server source", err)
+		return errors.NewAPIUnavailableError("remove server source", err)
 	}
 	defer func() {
 		_ = resp.Body.Close()
@@ -343,7 +441,7 @@ func (c *Client) RemoveServerSource(ctx context.Context, serverKey, source strin
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
 		c.logger.Error("Unexpected status code", "status", resp.StatusCode, "server_key", serverKey, "source", source)
-		return errors.NewExternalError("ServerEye API", fmt.Sprintf("unexpected status code: %d", resp.StatusCode), nil)
+		return errors.NewAPIUnavailableError(fmt.Sprintf("unexpected status code: %d", resp.StatusCode), nil)
 	}
 
 	c.logger.Info("Server source removed successfully", "server_key", serverKey, "source", source)
@@ -354,7 +452,7 @@ func (c *Client) RemoveServerSource(ctx context.Context, serverKey, source strin
 func (c *Client) RemoveServerIdentifiers(ctx context.Context, serverKey string, identifiers []string) error {
 	c.logger.Debug("Removing server identifiers", "server_key", serverKey, "identifiers", identifiers)
 
-	url := fmt.Sprintf("%s/api/servers/by-key/%s/sources/identifiers", c.baseURL, serverKey)
+	url := fmt.Sprintf("%s/api/servers/by-key/%s/sources/identifiers", c.BaseURL(), serverKey)
 
 	reqBody := map[string][]string{
 		"identifiers": identifiers,
@@ -372,10 +470,10 @@ func (c *Client) RemoveServerIdentifiers(ctx context.Context, serverKey string,
 
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		c.logger.Error("Failed to remove server identifiers", "error", err, "server_key", serverKey)
-		return errors.NewExternalError("ServerEye API", "remove server identifiers", err)
+		return errors.NewAPIUnavailableError("remove server identifiers", err)
 	}
 	defer func() {
 		_ = resp.Body.Close()
@@ -383,12 +481,12 @@ func (c *Client) RemoveServerIdentifiers(ctx context.Context, serverKey string,
 
 	if resp.StatusCode == http.StatusNotFound {
 		c.logger.Warn("Server not found", "server_key", serverKey, "status", resp.StatusCode)
-		return errors.NewNotFoundError(fmt.Sprintf("server with key '%s'", serverKey))
+		return errors.NewServerNotFoundError(serverKey)
 	}
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
 		c.logger.Error("Unexpected status code", "status", resp.StatusCode, "server_key", serverKey)
-		return errors.NewExternalError("ServerEye API", fmt.Sprintf("unexpected status code: %d", resp.StatusCode), nil)
+		return errors.NewAPIUnavailableError(fmt.Sprintf("unexpected status code: %d", resp.StatusCode), nil)
 	}
 
 	c.logger.Info("Server identifiers removed successfully", "server_key", serverKey, "identifiers", identifiers)
@@ -399,17 +497,17 @@ func (c *Client) RemoveServerIdentifiers(ctx context.Context, serverKey string,
 func (c *Client) GetServerStatus(ctx context.Context, serverKey string) (*domain.ServerStatusResponse, error) {
 	c.logger.Debug("Getting server status", "server_key", serverKey)
 
-	url := fmt.Sprintf("%s/api/servers/by-key/%s/status", c.baseURL, serverKey)
+	url := fmt.Sprintf("%s/api/servers/by-key/%s/status", c.BaseURL(), serverKey)
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, errors.NewInternalError("failed to create request", err)
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		c.logger.Error("Failed to get server status", "error", err, "server_key", serverKey)
-		return nil, errors.NewExternalError("ServerEye API", "get server status", err)
+		return nil, errors.NewAPIUnavailableError("get server status", err)
 	}
 	defer func() {
 		_ = resp.Body.Close()
@@ -417,12 +515,12 @@ func (c *Client) GetServerStatus(ctx context.Context, serverKey string) (*domain
 
 	if resp.StatusCode == http.StatusNotFound {
 		c.logger.Warn("Server not found", "server_key", serverKey, "status", resp.StatusCode)
-		return nil, errors.NewNotFoundError(fmt.Sprintf("server with key '%s'", serverKey))
+		return nil, errors.NewServerNotFoundError(serverKey)
 	}
 
 	if resp.StatusCode != http.StatusOK {
 		c.logger.Error("Unexpected status code", "status", resp.StatusCode, "server_key", serverKey)
-		return nil, errors.NewExternalError("ServerEye API", fmt.Sprintf("unexpected status code: %d", resp.StatusCode), nil)
+		return nil, errors.NewAPIUnavailableError(fmt.Sprintf("unexpected status code: %d", resp.StatusCode), nil)
 	}
 
 	var response domain.ServerStatusResponse
@@ -442,17 +540,17 @@ func (c *Client) GetServerStatus(ctx context.Context, serverKey string) (*domain
 func (c *Client) GetServerStaticInfo(ctx context.Context, serverKey string) (*domain.StaticInfoResponse, error) {
 	c.logger.Debug("Getting server static info", "server_key", serverKey)
 
-	url := fmt.Sprintf("%s/api/servers/by-key/%s/static-info", c.baseURL, serverKey)
+	url := fmt.Sprintf("%s/api/servers/by-key/%s/static-info", c.BaseURL(), serverKey)
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, errors.NewInternalError("failed to create request", err)
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		c.logger.Error("Failed to get server static info", "error", err, "server_key", serverKey)
-		return nil, errors.NewExternalError("ServerEye API", "get server static info", err)
+		return nil, errors.NewAPIUnavailableError("get server static info", err)
 	}
 	defer func() {
 		_ = resp.Body.Close()
@@ -460,12 +558,12 @@ func (c *Client) GetServerStaticInfo(ctx context.Context, serverKey string) (*do
 
 	if resp.StatusCode == http.StatusNotFound {
 		c.logger.Warn("Server not found", "server_key", serverKey, "status", resp.StatusCode)
-		return nil, errors.NewNotFoundError(fmt.Sprintf("server with key '%s'", serverKey))
+		return nil, errors.NewServerNotFoundError(serverKey)
 	}
 
 	if resp.StatusCode != http.StatusOK {
 		c.logger.Error("Unexpected status code", "status", resp.StatusCode, "server_key", serverKey)
-		return nil, errors.NewExternalError("ServerEye API", fmt.Sprintf("unexpected status code: %d", resp.StatusCode), nil)
+		return nil, errors.NewAPIUnavailableError(fmt.Sprintf("unexpected status code: %d", resp.StatusCode), nil)
 	}
 
 	var response domain.StaticInfoResponse
@@ -484,7 +582,7 @@ func (c *Client) GetServerStaticInfo(ctx context.Context, serverKey string) (*do
 func (c *Client) RemoveServerSourceIdentifiers(ctx context.Context, serverKey, source string, identifiers []string) error {
 	c.logger.Debug("Removing server source identifiers", "server_key", serverKey, "source", source, "identifiers", identifiers)
 
-	url := fmt.Sprintf("%s/api/servers/by-key/%s/sources/%s/identifiers", c.baseURL, serverKey, source)
+	url := fmt.Sprintf("%s/api/servers/by-key/%s/sources/%s/identifiers", c.BaseURL(), serverKey, source)
 
 	reqBody := map[string][]string{
 		"identifiers": identifiers,
@@ -502,10 +600,10 @@ func (c *Client) RemoveServerSourceIdentifiers(ctx context.Context, serverKey, s
 
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		c.logger.Error("Failed to remove server source identifiers", "error", err, "server_key", serverKey, "source", source)
-		return errors.NewExternalError("ServerEye API", "remove server source identifiers", err)
+		return errors.NewAPIUnavailableError("remove server source identifiers", err)
 	}
 	defer func() {
 		_ = resp.Body.Close()
@@ -518,9 +616,87 @@ func (c *Client) RemoveServerSourceIdentifiers(ctx context.Context, serverKey, s
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
 		c.logger.Error("Unexpected status code", "status", resp.StatusCode, "server_key", serverKey, "source", source)
-		return errors.NewExternalError("ServerEye API", fmt.Sprintf("unexpected status code: %d", resp.StatusCode), nil)
+		return errors.NewAPIUnavailableError(fmt.Sprintf("unexpected status code: %d", resp.StatusCode), nil)
 	}
 
 	c.logger.Info("Server source identifiers removed successfully", "server_key", serverKey, "source", source, "identifiers", identifiers)
 	return nil
 }
+
+// SendCommand sends a command message to the agent of a server and waits for its response.
+// Commands are not retried since they may not be idempotent.
+func (c *Client) SendCommand(ctx context.Context, serverKey string, msg *protocol.Message) (resp *protocol.Message, err error) {
+	c.logger.Debug("Sending agent command", "server_key", serverKey, "type", msg.Type, "message_id", msg.ID)
+
+	ctx, span := c.tracer.StartChild(ctx, "agent "+string(msg.Type), tracing.KindClient)
+	if span != nil {
+		span.SetAttribute("agent.message_id", msg.ID)
+		span.SetAttribute("agent.message_type", string(msg.Type))
+		defer func() {
+			if err != nil {
+				span.SetFailed()
+				span.SetAttribute("error", err.Error())
+			} else {
+				span.SetAttribute("agent.response_type", string(resp.Type))
+			}
+			span.End()
+		}()
+
+		traced := *msg
+		traced.Traceparent = span.Traceparent()
+		msg = &traced
+	}
+
+	url := fmt.Sprintf("%s/api/servers/by-key/%s/commands", c.BaseURL(), serverKey)
+
+	jsonBody, err := json.Marshal(msg)
+	if err != nil {
+		return nil, errors.NewInternalError("failed to marshal command", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return nil, errors.NewInternalError("failed to create request", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if msg.Traceparent != "" {
+		req.Header.Set("traceparent", msg.Traceparent)
+	}
+
+	httpResp, err := c.commandClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			c.logger.Warn("Agent command timed out", "server_key", serverKey, "type", msg.Type, "message_id", msg.ID)
+			return nil, errors.NewTimeoutError(fmt.Sprintf("agent command '%s'", msg.Type), ctx.Err())
+		}
+		c.logger.Error("Failed to send agent command", "error", err, "server_key", serverKey, "type", msg.Type)
+		return nil, errors.NewAPIUnavailableError("send agent command", err)
+	}
+	defer func() {
+		_ = httpResp.Body.Close()
+	}()
+
+	switch httpResp.StatusCode {
+	case http.StatusOK:
+		// Success case
+	case http.StatusNotFound:
+		c.logger.Warn("Server not found", "server_key", serverKey, "status", httpResp.StatusCode)
+		return nil, errors.NewServerNotFoundError(serverKey)
+	case http.StatusGatewayTimeout, http.StatusRequestTimeout:
+		c.logger.Warn("Agent did not respond", "server_key", serverKey, "type", msg.Type, "status", httpResp.StatusCode)
+		return nil, errors.NewTimeoutError(fmt.Sprintf("agent command '%s'", msg.Type), nil)
+	default:
+		c.logger.Error("Unexpected status code", "status", httpResp.StatusCode, "server_key", serverKey, "type", msg.Type)
+		return nil, errors.NewAPIUnavailableError(fmt.Sprintf("unexpected status code: %d", httpResp.StatusCode), nil)
+	}
+
+	var response protocol.Message
+	if err := json.NewDecoder(httpResp.Body).Decode(&response); err != nil {
+		return nil, errors.NewInternalError("failed to decode response", err)
+	}
+
+	c.logger.Info("Agent command completed", "server_key", serverKey, "type", msg.Type, "response_type", response.Type)
+
+	return &response, nil
+}
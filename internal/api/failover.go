@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"strings"
+)
+
+// EndpointSwitch is a change of the API address requests are sent to
+type EndpointSwitch struct {
+	From     string
+	To       string
+	Failback bool  // back to the primary address after it recovered
+	Err      error // health check error of the address left, nil on failback
+}
+
+// UseFallbacks sets addresses of the API to fail over to, in order of preference, when
+// the primary one is unhealthy. onSwitch is called on every failover and failback and
+// may be nil.
+func (c *Client) UseFallbacks(urls []string, onSwitch func(EndpointSwitch)) {
+	endpoints := c.endpoints[:1]
+	for _, url := range urls {
+		if url = strings.TrimRight(strings.TrimSpace(url), "/"); url != "" && url != endpoints[0] {
+			endpoints = append(endpoints, url)
+		}
+	}
+
+	c.endpoints = endpoints
+	c.onSwitch = onSwitch
+}
+
+// BaseURL returns the address of the API requests are sent to
+func (c *Client) BaseURL() string {
+	return c.endpoints[c.active.Load()]
+}
+
+// OnFallback reports whether requests are sent to a fallback address
+func (c *Client) OnFallback() bool {
+	return c.active.Load() != 0
+}
+
+// CheckEndpoints checks the health of the API address in use. When it is unhealthy,
+// requests fail over to the first healthy fallback; while on a fallback, they fail back
+// to the primary address as soon as it is healthy again. An error is returned only when
+// no address is healthy.
+func (c *Client) CheckEndpoints(ctx context.Context) error {
+	active := int(c.active.Load())
+
+	if active != 0 {
+		if err := c.probe(ctx, c.endpoints[0]); err == nil {
+			c.switchTo(active, 0, nil)
+			return nil
+		}
+	}
+
+	err := c.probe(ctx, c.endpoints[active])
+	if err == nil {
+		return nil
+	}
+
+	// The primary address was probed above when a fallback is in use
+	for i := range c.endpoints {
+		if i == active || (i == 0 && active != 0) {
+			continue
+		}
+		if c.probe(ctx, c.endpoints[i]) == nil {
+			c.switchTo(active, i, err)
+			return nil
+		}
+	}
+
+	return err
+}
+
+// switchTo sends requests to another endpoint, unless a concurrent check already did
+func (c *Client) switchTo(from, to int, err error) {
+	if !c.active.CompareAndSwap(int32(from), int32(to)) {
+		return
+	}
+
+	change := EndpointSwitch{From: c.endpoints[from], To: c.endpoints[to], Failback: to == 0, Err: err}
+	if change.Failback {
+		c.logger.Info("ServerEye API failed back to the primary address", "from", change.From, "to", change.To)
+	} else {
+		c.logger.Warn("ServerEye API failed over to a fallback address", "from", change.From, "to", change.To, "error", err)
+	}
+
+	if c.onSwitch != nil {
+		c.onSwitch(change)
+	}
+}
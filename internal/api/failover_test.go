@@ -0,0 +1,116 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/api"
+)
+
+// nopLogger discards log output
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, fields ...interface{}) {}
+func (nopLogger) Info(msg string, fields ...interface{})  {}
+func (nopLogger) Warn(msg string, fields ...interface{})  {}
+func (nopLogger) Error(msg string, fields ...interface{}) {}
+
+// apiServer is a fake ServerEye API whose health can be switched
+type apiServer struct {
+	*httptest.Server
+	healthy atomic.Bool
+}
+
+// newAPIServer starts a healthy fake API
+func newAPIServer(t *testing.T) *apiServer {
+	t.Helper()
+
+	s := &apiServer{}
+	s.healthy.Store(true)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestCheckEndpointsFailoverAndFailback(t *testing.T) {
+	primary, first, second := newAPIServer(t), newAPIServer(t), newAPIServer(t)
+
+	var switches []api.EndpointSwitch
+	client := api.NewClient(primary.URL, time.Second, api.RetryPolicy{}, nopLogger{})
+	client.UseFallbacks([]string{first.URL, second.URL + "/"}, func(change api.EndpointSwitch) {
+		switches = append(switches, change)
+	})
+	ctx := context.Background()
+
+	steps := []struct {
+		name     string
+		primary  bool
+		first    bool
+		second   bool
+		wantURL  string
+		wantErr  bool
+		switches int
+	}{
+		{name: "all healthy", primary: true, first: true, second: true, wantURL: primary.URL},
+		{name: "primary down", primary: false, first: true, second: true, wantURL: first.URL, switches: 1},
+		{name: "fallback in use stays", primary: false, first: true, second: true, wantURL: first.URL, switches: 1},
+		{name: "fallback down", primary: false, first: false, second: true, wantURL: second.URL, switches: 2},
+		{name: "all down", primary: false, first: false, second: false, wantURL: second.URL, wantErr: true, switches: 2},
+		{name: "primary recovered", primary: true, first: false, second: false, wantURL: primary.URL, switches: 3},
+	}
+
+	for _, step := range steps {
+		primary.healthy.Store(step.primary)
+		first.healthy.Store(step.first)
+		second.healthy.Store(step.second)
+
+		err := client.CheckEndpoints(ctx)
+		if (err != nil) != step.wantErr {
+			t.Fatalf("%s: CheckEndpoints error = %v, want error %v", step.name, err, step.wantErr)
+		}
+		if got := client.BaseURL(); got != step.wantURL {
+			t.Fatalf("%s: BaseURL = %s, want %s", step.name, got, step.wantURL)
+		}
+		if len(switches) != step.switches {
+			t.Fatalf("%s: %d switches, want %d", step.name, len(switches), step.switches)
+		}
+	}
+
+	if last := switches[len(switches)-1]; !last.Failback || last.From != second.URL || last.Err != nil {
+		t.Errorf("last switch = %+v, want a failback from %s", last, second.URL)
+	}
+	if failover := switches[0]; failover.Failback || failover.From != primary.URL || failover.To != first.URL || failover.Err == nil {
+		t.Errorf("first switch = %+v, want a failover from %s to %s with the check error", failover, primary.URL, first.URL)
+	}
+	if client.OnFallback() {
+		t.Error("OnFallback after the failback")
+	}
+}
+
+func TestCheckEndpointsWithoutFallbacks(t *testing.T) {
+	primary := newAPIServer(t)
+	client := api.NewClient(primary.URL, time.Second, api.RetryPolicy{}, nopLogger{})
+	client.UseFallbacks([]string{"", primary.URL}, nil)
+
+	if err := client.CheckEndpoints(context.Background()); err != nil {
+		t.Fatalf("CheckEndpoints: %v", err)
+	}
+
+	primary.healthy.Store(false)
+	if err := client.CheckEndpoints(context.Background()); err == nil {
+		t.Fatal("CheckEndpoints of an unhealthy API without fallbacks returned no error")
+	}
+	if client.BaseURL() != primary.URL {
+		t.Errorf("BaseURL = %s, want the primary %s", client.BaseURL(), primary.URL)
+	}
+}
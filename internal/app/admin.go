@@ -0,0 +1,114 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// broadcastUsage is shown when /broadcast has no announcement
+const broadcastUsage = `📣 *Рассылка*
+
+/broadcast <текст> - Отправить объявление всем активным пользователям
+/broadcast stop - Остановить идущую рассылку`
+
+// handleBroadcastCommand sends an announcement to all active users
+func (b *Bot) handleBroadcastCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	if len(args) == 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, broadcastUsage)
+	}
+
+	if len(args) == 1 && strings.ToLower(args[0]) == "stop" {
+		if !b.adminService.StopBroadcast() {
+			return b.telegramSvc.SendMessage(ctx, chatID, "ℹ️ Сейчас рассылка не идет.")
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, "⛔ Останавливаю рассылку…")
+	}
+
+	text := strings.Join(args, " ")
+	if err := services.ValidateBroadcast(text); err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Объявление слишком длинное для одного сообщения.")
+	}
+
+	if err := b.telegramSvc.SendMessage(ctx, chatID, "⏳ Рассылка начата, результат придет сюда. Остановить: /broadcast stop"); err != nil {
+		b.logger.Error("Failed to report broadcast progress", "error", err)
+	}
+
+	// A broadcast outlives the update processing timeout, so finish in the background
+	go func() {
+		broadcastCtx := context.WithoutCancel(ctx)
+		result, err := b.adminService.Broadcast(broadcastCtx, text, b.telegramSvc.SendMessage)
+		var message string
+		switch {
+		case errors.IsErrorCode(err, errors.ErrCodeValidation):
+			message = "⏳ Уже идет другая рассылка. Дождитесь ее окончания или остановите: /broadcast stop"
+		case err != nil:
+			b.logger.Error("Failed to broadcast", "error", err, "telegram_id", telegramID)
+			message = "❌ Не удалось выполнить рассылку. Попробуйте позже."
+		default:
+			message = services.FormatBroadcastResult(result)
+		}
+		if err := b.telegramSvc.SendMessage(broadcastCtx, chatID, message); err != nil {
+			b.logger.Error("Failed to report broadcast result", "error", err)
+		}
+	}()
+	return nil
+}
+
+// handleUsersCommand shows registration and activity stats with a page of users
+func (b *Bot) handleUsersCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	page := 1
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 || len(args) > 1 {
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Использование: /users [страница]")
+		}
+		page = n
+	}
+
+	now := time.Now()
+	stats, err := b.adminService.Stats(ctx, now)
+	if err != nil {
+		b.logger.Error("Failed to get user stats", "error", err)
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось получить статистику пользователей. Попробуйте позже.")
+	}
+
+	users, err := b.adminService.Users(ctx, page)
+	if err != nil {
+		b.logger.Error("Failed to list users", "error", err, "page", page)
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось получить список пользователей. Попробуйте позже.")
+	}
+	if len(users) == 0 && page > 1 {
+		return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Страницы %d нет.", page))
+	}
+
+	return b.telegramSvc.SendMessage(ctx, chatID, services.FormatUserStats(stats, users, page, now))
+}
+
+// handleFleetStatsCommand shows online servers and the agent versions and operating
+// systems they run
+func (b *Bot) handleFleetStatsCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	if len(args) > 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Использование: /fleetstats")
+	}
+
+	stats, err := b.fleetStats.Stats(ctx, time.Now())
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, dependencyMessage(b.dependencyService, "❌ Не удалось получить статистику серверов. Попробуйте позже.", nil, services.DependencyDatabase))
+	}
+
+	return b.telegramSvc.SendMessage(ctx, chatID, services.FormatFleetStats(stats))
+}
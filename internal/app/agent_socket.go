@@ -0,0 +1,23 @@
+package app
+
+import (
+	"net/http"
+
+	"github.com/servereye/servereyebot/internal/agentconn"
+	"github.com/servereye/servereyebot/internal/httpserver"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// handleAgentSocket takes over the connection of an authenticated agent. Commands to the
+// agent are pushed over it and the agent answers each with a message whose reply_to
+// holds the command ID; the API command endpoint stays the fallback.
+func (b *Bot) handleAgentSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := agentconn.Upgrade(w, r, b.agentHub.MaxMessage())
+	if err != nil {
+		httpserver.WriteError(w, r, http.StatusBadRequest, errors.ErrCodeInvalidInput, err.Error())
+		return
+	}
+
+	serverKey, _ := httpserver.AgentKey(r.Context())
+	b.agentHub.Serve(r.Context(), serverKey, conn)
+}
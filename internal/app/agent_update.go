@@ -0,0 +1,81 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// updateUsage is shown when /update arguments cannot be parsed
+const updateUsage = `🤖 *Обновление агента*
+
+/update <server_id> - Версия и канал агента
+/update <server_id> stable - Обновить до последней стабильной версии
+/update <server_id> beta - Обновить до последней бета-версии
+/update <server_id> 1.4.2 - Установить конкретную версию
+
+Если новая версия не подключится к боту за %s, агент сам вернется на прежнюю. Обновлять агент может только владелец сервера.`
+
+// handleUpdateCommand shows the release of an agent and updates it
+func (b *Bot) handleUpdateCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	usage := fmt.Sprintf(updateUsage, b.agentUpdates.RollbackAfter())
+	if len(args) == 0 || len(args) > 2 {
+		return b.telegramSvc.SendMessage(ctx, chatID, usage)
+	}
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+
+	server := mapping.ServerByIDOrName(servers, args[0])
+	if server == nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Сервер `%s` не найден в вашем списке.", args[0]))
+	}
+
+	if len(args) == 1 {
+		version, err := b.agentUpdates.Version(ctx, mapping.UserID(user), telegramID, server)
+		if err != nil {
+			return b.telegramSvc.SendMessage(ctx, chatID, agentErrorMessage(err, server, "❌ Не удалось узнать версию агента. Попробуйте позже."))
+		}
+		var pending *services.AgentUpdate
+		if update, ok := b.agentUpdates.Pending(server.ID); ok {
+			pending = &update
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, services.FormatAgentVersion(server, version, pending))
+	}
+
+	channel, version, ok := services.ParseAgentUpdateTarget(args[1])
+	if !ok {
+		return b.telegramSvc.SendMessage(ctx, chatID, usage)
+	}
+
+	update, err := b.agentUpdates.Start(ctx, mapping.UserID(user), telegramID, server, channel, version, time.Now())
+	if err != nil {
+		if errors.IsErrorCode(err, errors.ErrCodeValidation) {
+			return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("⏳ Агент %s уже обновляется, дождитесь результата.", server.Name))
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, agentErrorMessage(err, server, "❌ Агент не принял обновление. Проверьте, что версия существует, и попробуйте позже."))
+	}
+
+	return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("⏳ Агент %s(%s) обновляется: %s → %s (канал %s).\n\nЕсли новая версия не подключится за %s, агент вернется на %s. Результат придет сюда.",
+		server.Name, server.ID, update.FromVersion, update.TargetVersion, update.Channel, update.Deadline.Sub(update.StartedAt), update.FromVersion))
+}
+
+// runAgentUpdateCheck is a scheduler job following agent updates until they end
+func (b *Bot) runAgentUpdateCheck(ctx context.Context, now time.Time) error {
+	for _, outcome := range b.agentUpdates.Verify(ctx, now) {
+		if err := b.telegramSvc.SendMessage(ctx, outcome.Update.TelegramID, services.FormatAgentUpdateOutcome(outcome)); err != nil {
+			b.logger.Error("Failed to report agent update", "error", err, "server_id", outcome.Update.ServerID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/alerts"
+	"github.com/servereye/servereyebot/internal/httpserver"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// maxAlertmanagerRequestSize limits the body of an Alertmanager webhook
+const maxAlertmanagerRequestSize = 1 << 20
+
+// alertmanagerResponse represents the reply to an Alertmanager webhook
+type alertmanagerResponse struct {
+	Status    string `json:"status"`
+	Matched   int    `json:"matched"`
+	Unmatched int    `json:"unmatched"`
+}
+
+// handleAlertmanagerRequest receives Alertmanager webhooks and forwards their alerts to
+// the users of the servers named in the alert labels, so that an existing Prometheus
+// stack can use the bot as a notification channel
+func (b *Bot) handleAlertmanagerRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpserver.MethodNotAllowed(w, r)
+		return
+	}
+
+	var webhook alerts.AlertmanagerWebhook
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAlertmanagerRequestSize)).Decode(&webhook); err != nil {
+		httpserver.WriteError(w, r, http.StatusBadRequest, errors.ErrCodeInvalidInput, "invalid request body")
+		return
+	}
+
+	result, err := b.alertService.FromAlertmanager(r.Context(), &webhook, b.config.API.AlertmanagerServerLabel)
+	if err != nil {
+		// Alertmanager retries webhooks answered with a server error
+		httpserver.RequestLogger(b.logger, r).Error("Failed to map Alertmanager alerts", "error", err, "receiver", webhook.Receiver)
+		httpserver.WriteError(w, r, http.StatusServiceUnavailable, errors.ErrCodeUnavailable, "failed to map alerts to servers")
+		return
+	}
+
+	writeAgentResponse(w, http.StatusOK, alertmanagerResponse{Status: "ok", Matched: result.Matched, Unmatched: result.Unmatched})
+
+	// Alertmanager does not wait for the delivery
+	deliverCtx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), time.Minute)
+	go func() {
+		defer cancel()
+		b.deliverAlerts(deliverCtx, result.Notifications)
+	}()
+}
@@ -0,0 +1,229 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/notify"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// tagUsage is shown when /tag arguments cannot be parsed
+const tagUsage = `🏷️ *Теги серверов*
+
+/tag - Теги ваших серверов
+/tag add <server_id> <tag> - Добавить тег серверу
+/tag remove <server_id> <tag> - Убрать тег
+/tag window <tag> <5m|default> - Окно корреляции алертов
+/tag about <tag> <описание> - Описание общей инфраструктуры
+
+Алерты серверов с общим тегом, пришедшие в пределах окна, объединяются в одно сообщение о возможной общей причине.`
+
+// tagOwnerMessage is shown to users who may not manage the tags of a server
+const tagOwnerMessage = "⛔ Управлять тегами сервера может только его владелец."
+
+// tagSetupOwnerMessage is shown to users who may not set up a tag
+func tagSetupOwnerMessage(tag string) string {
+	return fmt.Sprintf("⛔ Настраивать тег %s может владелец сервера с этим тегом.", tag)
+}
+
+// handleTagCommand manages tags grouping servers that share infrastructure
+func (b *Bot) handleTagCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	_, servers, err := contextServers(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+
+	if len(args) == 0 || strings.ToLower(args[0]) == "list" {
+		return b.telegramSvc.SendMessage(ctx, chatID, b.alertService.FormatTags(servers))
+	}
+	if len(args) < 3 {
+		return b.telegramSvc.SendMessage(ctx, chatID, tagUsage)
+	}
+
+	switch action := strings.ToLower(args[0]); action {
+	case "add", "remove":
+		server := mapping.ServerByIDOrName(servers, args[1])
+		if server == nil {
+			return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Сервер `%s` не найден в вашем списке.", args[1]))
+		}
+
+		tag := strings.ToLower(args[2])
+		if action == "remove" {
+			removed, err := b.alertService.UntagServer(ctx, server, tag)
+			if err != nil {
+				if errors.IsErrorCode(err, errors.ErrCodeForbidden) {
+					return b.telegramSvc.SendMessage(ctx, chatID, tagOwnerMessage)
+				}
+				return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось убрать тег. Попробуйте позже.")
+			}
+			if !removed {
+				return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ У сервера %s нет тега %s.", server.Name, tag))
+			}
+			return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("✅ Тег %s убран с сервера %s.", tag, server.Name))
+		}
+
+		if err := b.alertService.TagServer(ctx, server, tag); err != nil {
+			if errors.IsErrorCode(err, errors.ErrCodeForbidden) {
+				return b.telegramSvc.SendMessage(ctx, chatID, tagOwnerMessage)
+			}
+			if errors.IsErrorCode(err, errors.ErrCodeValidation) {
+				return b.telegramSvc.SendMessage(ctx, chatID, "❌ Тег - строчные латинские буквы, цифры, точка, дефис и _ (до 64 символов).")
+			}
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось добавить тег. Попробуйте позже.")
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("✅ Сервер %s помечен тегом %s.", server.Name, tag))
+
+	case "window", "about":
+		tag := strings.ToLower(args[1])
+		if action == "about" {
+			if err := b.alertService.SetTagDescription(ctx, servers, tag, strings.Join(args[2:], " ")); err != nil {
+				if errors.IsErrorCode(err, errors.ErrCodeForbidden) {
+					return b.telegramSvc.SendMessage(ctx, chatID, tagSetupOwnerMessage(tag))
+				}
+				return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось сохранить описание. Попробуйте позже.")
+			}
+			return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("✅ Описание тега %s сохранено.", tag))
+		}
+
+		var window time.Duration
+		if strings.ToLower(args[2]) != "default" {
+			if window, err = time.ParseDuration(args[2]); err != nil || window <= 0 {
+				return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите окно, например 5m или 30s.")
+			}
+		}
+		if err := b.alertService.SetTagWindow(ctx, servers, tag, window); err != nil {
+			if errors.IsErrorCode(err, errors.ErrCodeForbidden) {
+				return b.telegramSvc.SendMessage(ctx, chatID, tagSetupOwnerMessage(tag))
+			}
+			if errors.IsErrorCode(err, errors.ErrCodeValidation) {
+				return b.telegramSvc.SendMessage(ctx, chatID, "❌ Окно корреляции не может быть больше часа.")
+			}
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось сохранить окно. Попробуйте позже.")
+		}
+		if window == 0 {
+			return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("✅ Для тега %s используется окно по умолчанию.", tag))
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("✅ Окно корреляции тега %s: %s.", tag, window))
+	}
+
+	return b.telegramSvc.SendMessage(ctx, chatID, tagUsage)
+}
+
+// runAlertCheck is a scheduler job checking server metrics against alert thresholds
+func (b *Bot) runAlertCheck(ctx context.Context, now time.Time) error {
+	// Thresholds may be configured by a reload after the start
+	if !b.alertService.Enabled() {
+		return nil
+	}
+
+	notifications, err := b.alertService.Check(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	b.deliverAlerts(ctx, notifications)
+	return nil
+}
+
+// deliverAlerts sends alerts to their users in Telegram and in their notification
+// channels, and to the group chats their servers are attached to. Alerts of servers in
+// a deployment window are held for a summary sent after the window.
+func (b *Bot) deliverAlerts(ctx context.Context, notifications []services.AlertNotification) {
+	b.sendAlerts(ctx, b.deploymentWindows.Hold(notifications, time.Now()))
+}
+
+// sendAlerts sends alerts without checking deployment windows. Each alert goes to the
+// chat its user routed its category to, or to the private chat of the user when the
+// routed chat cannot be reached. Alerts in a private chat arrive silently during the
+// quiet hours of the user. Telegram messages go through the outbox, so that they are
+// retried until Telegram confirms them.
+func (b *Bot) sendAlerts(ctx context.Context, notifications []services.AlertNotification) {
+	sent := make(map[string]bool)
+	settings := make(map[int64]*models.UserSettings)
+	now := time.Now()
+	var messages []*models.OutboxMessage
+	for _, notification := range notifications {
+		userSettings, ok := settings[notification.TelegramID]
+		if !ok {
+			userSettings = b.telegramUserSettings(ctx, notification.TelegramID)
+			settings[notification.TelegramID] = userSettings
+		}
+		quiet := services.InQuietHours(userSettings, now)
+
+		chatID := b.alertRoutes.Route(notification)
+		key := fmt.Sprintf("%d\x00%s", chatID, notification.Text)
+		if !sent[key] {
+			sent[key] = true
+			messages = append(messages, services.NewOutboxMessage(chatID, notification.TelegramID, notification.Text, notification.Keyboard, quiet))
+		}
+		if !userSettings.NotifyAlerts {
+			continue
+		}
+		if err := b.notifyService.Publish(ctx, notification.TelegramID, notification.ServerIDs, notify.Message{Title: "Алерт " + b.branding.Name(), Text: notification.Text}); err != nil {
+			b.logger.Error("Failed to publish alert to notification channels", "error", err, "telegram_id", notification.TelegramID)
+		}
+	}
+	messages = append(messages, b.chatAlertMessages(ctx, notifications, sent)...)
+
+	if err := b.reportService.RecordAlerts(ctx, notifications, now); err != nil {
+		b.logger.Error("Failed to record alerts for reports", "error", err, "alerts", len(notifications))
+	}
+
+	// Alerts are sent right away when the outbox cannot store them, rather than lost
+	if err := b.outbox.Enqueue(ctx, messages, now); err != nil {
+		b.logger.Error("Failed to store alerts in the outbox, sending them directly", "error", err, "alerts", len(messages))
+		for _, message := range messages {
+			if err := b.sendOutboxMessage(ctx, message); err != nil {
+				b.logger.Error("Failed to send alert", "error", err, "chat_id", message.ChatID)
+			}
+		}
+		return
+	}
+	b.deliverOutbox(ctx)
+}
+
+// runOutboxDelivery is a scheduler job retrying alerts that could not be delivered yet
+func (b *Bot) runOutboxDelivery(ctx context.Context, now time.Time) error {
+	_, err := b.outbox.Deliver(ctx, now, b.sendOutboxMessage)
+	return err
+}
+
+// deliverOutbox sends the alerts waiting in the outbox
+func (b *Bot) deliverOutbox(ctx context.Context) {
+	if _, err := b.outbox.Deliver(ctx, time.Now(), b.sendOutboxMessage); err != nil {
+		b.logger.Error("Failed to deliver alerts from the outbox", "error", err)
+	}
+}
+
+// sendOutboxMessage sends an alert to its chat, or to the private chat of its user when
+// the chat cannot be reached
+func (b *Bot) sendOutboxMessage(ctx context.Context, message *models.OutboxMessage) error {
+	keyboard := services.OutboxKeyboard(message)
+	err := b.sendAlert(ctx, message.ChatID, message.Text, keyboard, message.Quiet && message.ChatID == message.TelegramID)
+	if err != nil && message.TelegramID != 0 && message.ChatID != message.TelegramID {
+		b.logger.Warn("Failed to send alert to routed chat", "error", err, "telegram_id", message.TelegramID, "chat_id", message.ChatID)
+		err = b.sendAlert(ctx, message.TelegramID, message.Text, keyboard, message.Quiet)
+	}
+	return err
+}
+
+// sendAlert sends an alert with its buttons to a chat, without a notification sound when silent
+func (b *Bot) sendAlert(ctx context.Context, chatID int64, text string, keyboard [][]map[string]string, silent bool) error {
+	switch {
+	case silent:
+		return b.telegramSvc.SendSilentMessage(ctx, chatID, text, keyboard)
+	case len(keyboard) > 0:
+		return b.telegramSvc.SendMessageWithKeyboard(ctx, chatID, text, keyboard)
+	default:
+		return b.telegramSvc.SendMessage(ctx, chatID, text)
+	}
+}
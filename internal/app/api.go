@@ -0,0 +1,150 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/httpserver"
+	"github.com/servereye/servereyebot/internal/ingest"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// apiStats represents the reply of /api/stats
+type apiStats struct {
+	SLO          []apiSLOStatus        `json:"slo"`
+	Ingest       *ingest.Stats         `json:"ingest,omitempty"`
+	Dependencies []apiDependencyStatus `json:"dependencies"`
+}
+
+// apiDependencyStatus represents the health of a dependency in /api/stats
+type apiDependencyStatus struct {
+	Name      string    `json:"name"`
+	Up        bool      `json:"up"`
+	Since     time.Time `json:"since"`
+	CheckedAt time.Time `json:"checked_at,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// apiSLOStatus represents the error budget of a command class in /api/stats
+type apiSLOStatus struct {
+	Class           string  `json:"class"`
+	Target          float64 `json:"target"`
+	Total           int64   `json:"total"`
+	Failed          int64   `json:"failed"`
+	SuccessRate     float64 `json:"success_rate"`
+	BudgetRemaining float64 `json:"budget_remaining"`
+	BurnRate        float64 `json:"burn_rate"`
+}
+
+// registerAPIHandlers registers the /api endpoints, each behind its authentication
+func (b *Bot) registerAPIHandlers() {
+	if b.config.API.AuthSecret == "" {
+		b.logger.Warn("API_AUTH_SECRET is not set, agent API endpoints reject all requests")
+	}
+
+	// Agents started with a pairing code link their server here, the code authenticates them
+	b.httpServer.Handle("/api/pair", b.limitByIP(http.HandlerFunc(b.handlePairRequest)))
+
+	// Agents check for a rotated key here on every heartbeat
+	b.httpServer.Handle("/api/rotate-key", b.limitByIP(b.apiAuth.Agent(b.knownServerKey, b.limitByAgent(http.HandlerFunc(b.handleRotateKeyRequest)))))
+
+	// Agents fetch the restart policies they enforce and report containers they stopped restarting
+	b.httpServer.Handle("/api/restart-policies", b.limitByIP(b.apiAuth.Agent(b.knownServerKey, b.limitByAgent(http.HandlerFunc(b.handleRestartPoliciesRequest)))))
+
+	// Agents fetch the log files they tail and report lines matching the patterns
+	b.httpServer.Handle("/api/log-watches", b.limitByIP(b.apiAuth.Agent(b.knownServerKey, b.limitByAgent(http.HandlerFunc(b.handleLogWatchesRequest)))))
+
+	// Agents keep a WebSocket connection here to receive commands without delay
+	if b.agentHub != nil {
+		b.httpServer.Handle("/api/ws", b.limitByIP(b.apiAuth.Agent(b.knownServerKey, b.limitByAgent(http.HandlerFunc(b.handleAgentSocket)))))
+	}
+
+	// Agents exchange their bearer token for a client certificate here
+	b.httpServer.Handle("/api/certificate", b.limitByIP(b.apiAuth.AgentEnrollment(b.knownServerKey, b.limitByAgent(http.HandlerFunc(b.handleCertificateRequest)))))
+
+	// Prometheus Alertmanager posts alerts here, authenticated with its own token
+	b.httpServer.Handle("/api/v1/alertmanager", b.limitByIP(b.apiAuth.Token("alertmanager", b.config.API.AlertmanagerToken, http.HandlerFunc(b.handleAlertmanagerRequest))))
+
+	// Nagios, Icinga and Zabbix post passive check results here, authenticated with their own token
+	b.httpServer.Handle("/api/v1/passive-checks", b.limitByIP(b.apiAuth.Token("passive checks", b.config.API.PassiveChecksToken, http.HandlerFunc(b.handlePassiveChecksRequest))))
+
+	// ServerEye-Web exchanges /link codes and reads the data of linked accounts here,
+	// authenticated with its own token
+	b.httpServer.Handle("/api/v1/link", b.limitByIP(b.apiAuth.Token("web", b.config.API.WebToken, http.HandlerFunc(b.handleLinkRequest))))
+	b.httpServer.Handle("/api/v1/account/servers", b.limitByIP(b.apiAuth.Token("web", b.config.API.WebToken, http.HandlerFunc(b.handleAccountServersRequest))))
+
+	b.httpServer.Handle("/api/stats", b.limitByIP(b.apiAuth.Admin(http.HandlerFunc(b.handleStatsRequest))))
+	b.httpServer.Handle("/api/stats/servers", b.limitByIP(b.apiAuth.Admin(http.HandlerFunc(b.handleServerStatsRequest))))
+}
+
+// limitByIP rate limits requests per client IP, before authentication to slow down guessing
+func (b *Bot) limitByIP(next http.Handler) http.Handler {
+	return httpserver.RateLimit(b.rateLimiter, rateLimitScopeHTTP, b.rateLimitRule(b.config.RateLimit.HTTPLimit), httpserver.ClientIP, next)
+}
+
+// limitByAgent rate limits requests per authenticated server key
+func (b *Bot) limitByAgent(next http.Handler) http.Handler {
+	return httpserver.RateLimit(b.rateLimiter, rateLimitScopeAgent, b.rateLimitRule(b.config.RateLimit.AgentLimit), httpserver.AgentKeyOf, next)
+}
+
+// handleStatsRequest reports error budgets and metrics ingestion of the bot
+func (b *Bot) handleStatsRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpserver.MethodNotAllowed(w, r)
+		return
+	}
+
+	var stats apiStats
+	for _, status := range b.sloTracker.Statuses() {
+		stats.SLO = append(stats.SLO, apiSLOStatus{
+			Class:           string(status.Class),
+			Target:          status.Target,
+			Total:           status.Total,
+			Failed:          status.Failed,
+			SuccessRate:     status.SuccessRate,
+			BudgetRemaining: status.BudgetRemaining,
+			BurnRate:        status.BurnRate,
+		})
+	}
+	if b.metricsWriter != nil {
+		ingestStats := b.metricsWriter.Stats()
+		stats.Ingest = &ingestStats
+	}
+
+	for _, status := range b.dependencyService.Statuses() {
+		dependency := apiDependencyStatus{
+			Name:      status.Name,
+			Up:        status.Up,
+			Since:     status.Since,
+			CheckedAt: status.CheckedAt,
+		}
+		if status.Err != nil {
+			dependency.Error = status.Err.Error()
+		}
+		stats.Dependencies = append(stats.Dependencies, dependency)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(stats)
+}
+
+// handleServerStatsRequest reports online servers and the agent versions and operating
+// systems they run
+func (b *Bot) handleServerStatsRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpserver.MethodNotAllowed(w, r)
+		return
+	}
+
+	stats, err := b.fleetStats.Stats(r.Context(), time.Now())
+	if err != nil {
+		httpserver.WriteError(w, r, http.StatusInternalServerError, errors.ErrCodeInternal, "failed to collect server stats")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(stats)
+}
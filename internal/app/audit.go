@@ -0,0 +1,93 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	stderrors "errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// Audit log listing limits
+const (
+	defaultAuditLimit = 10
+	maxAuditLimit     = 50
+)
+
+// handleAuditCommand shows the latest actions executed against servers
+func (b *Bot) handleAuditCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	user, err := contextUser(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+
+	allServers := false
+	if len(args) > 0 && strings.ToLower(args[0]) == "all" {
+		if !user.IsAdmin {
+			return b.telegramSvc.SendMessage(ctx, chatID, "Эта команда требует прав администратора")
+		}
+		allServers = true
+		args = args[1:]
+	}
+
+	limit := defaultAuditLimit
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите количество записей. Пример: /audit 20")
+		}
+		limit = n
+	}
+	if limit > maxAuditLimit {
+		limit = maxAuditLimit
+	}
+
+	var entries []models.CommandHistory
+	if allServers {
+		entries, err = b.auditService.ListAll(ctx, limit)
+	} else {
+		entries, err = b.auditService.ListForUser(ctx, mapping.UserID(user), limit)
+	}
+	if err != nil {
+		b.logger.Error("Failed to list command history", "error", err, "user_id", user.ID)
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось получить историю команд. Попробуйте позже.")
+	}
+
+	return b.telegramSvc.SendMessage(ctx, chatID, b.auditService.FormatHistory(entries, allServers))
+}
+
+// handleReplayCommand re-sends a recorded agent command in debug mode and shows the response diff
+func (b *Bot) handleReplayCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	if len(args) < 1 {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите ID записи из /audit. Пример: /replay 42")
+	}
+
+	historyID, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || historyID < 1 {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Неверный ID записи. Пример: /replay 42")
+	}
+
+	result, err := b.replayService.Replay(ctx, historyID)
+	if err != nil {
+		if stderrors.Is(err, sql.ErrNoRows) {
+			return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Запись #%d не найдена.", historyID))
+		}
+		if errors.IsErrorCode(err, errors.ErrCodeValidation) {
+			return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Запись #%d не содержит команды агента и не может быть повторена.", historyID))
+		}
+		b.logger.Error("Failed to replay command", "error", err, "history_id", historyID)
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось повторить команду. Попробуйте позже.")
+	}
+
+	return b.telegramSvc.SendMessage(ctx, chatID, b.replayService.FormatReplay(result))
+}
@@ -0,0 +1,56 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/pkg/domain"
+)
+
+// backupsUsage is shown when /backups arguments cannot be parsed
+const backupsUsage = `💾 *Резервные копии*
+
+/backups [server_id] - Репозитории restic и borg: последняя копия, размер и результат запуска
+
+Репозитории настраиваются в конфигурации агента. Если последняя успешная копия устарела или запуск завершился ошибкой, придет предупреждение.`
+
+// handleBackupsCommand shows the backup repositories of a server
+func (b *Bot) handleBackupsCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+	if len(servers) == 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, "📭 У вас нет добавленных серверов.\n\nИспользуйте /add <server_id> для добавления сервера.")
+	}
+
+	server, args := resolveServerArg(servers, args)
+	if server == nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите сервер.\n\n"+backupsUsage)
+	}
+	if len(args) > 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, backupsUsage)
+	}
+
+	backups, err := b.backupService.Get(ctx, mapping.UserID(user), telegramID, server)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, agentErrorMessage(err, server, "❌ Не удалось получить состояние резервных копий. Попробуйте позже."))
+	}
+
+	return b.telegramSvc.SendMessage(ctx, chatID, b.backupService.FormatBackups(server, backups, time.Now()))
+}
+
+// runBackupCheck is a scheduler job warning about stale or failing backups
+func (b *Bot) runBackupCheck(ctx context.Context, now time.Time) error {
+	notifications, err := b.backupService.Check(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	b.deliverAlerts(ctx, notifications)
+	return nil
+}
@@ -2,20 +2,39 @@ package app
 
 import (
 	"context"
+	stderrors "errors"
 	"fmt"
+	"io"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/servereye/servereyebot/internal/agentconn"
 	"github.com/servereye/servereyebot/internal/api"
+	"github.com/servereye/servereyebot/internal/branding"
+	"github.com/servereye/servereyebot/internal/callbacks"
+	"github.com/servereye/servereyebot/internal/cluster"
 	"github.com/servereye/servereyebot/internal/config"
+	"github.com/servereye/servereyebot/internal/features"
 	"github.com/servereye/servereyebot/internal/httpserver"
+	"github.com/servereye/servereyebot/internal/ingest"
 	"github.com/servereye/servereyebot/internal/logger"
+	"github.com/servereye/servereyebot/internal/mapping"
 	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/notify"
+	"github.com/servereye/servereyebot/internal/ratelimit"
+	"github.com/servereye/servereyebot/internal/render"
 	"github.com/servereye/servereyebot/internal/repository"
+	"github.com/servereye/servereyebot/internal/scheduler"
+	"github.com/servereye/servereyebot/internal/secrets"
 	"github.com/servereye/servereyebot/internal/service"
 	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/internal/shutdown"
+	"github.com/servereye/servereyebot/internal/slo"
 	"github.com/servereye/servereyebot/internal/storage"
 	"github.com/servereye/servereyebot/internal/telegram"
+	"github.com/servereye/servereyebot/internal/tracing"
+	"github.com/servereye/servereyebot/pkg/docker"
 	"github.com/servereye/servereyebot/pkg/domain"
 	"github.com/servereye/servereyebot/pkg/errors"
 )
@@ -24,22 +43,91 @@ import (
 type contextKey string
 
 const (
-	userIDKey contextKey = "user_id"
-	chatIDKey contextKey = "chat_id"
+	userIDKey  contextKey = "user_id"
+	chatIDKey  contextKey = "chat_id"
+	userKey    contextKey = "user"    // *domain.User running a command
+	accountKey contextKey = "account" // *account of the user running a command or pressing a button
 )
 
 // Bot represents the updated bot with PostgreSQL integration
 type Bot struct {
-	config         *config.Config
-	logger         logger.Logger
-	telegramSvc    domain.TelegramService
-	serverService  *service.ServerService
-	userService    domain.UserService
-	metricsService *services.MetricsServiceImpl
-	updateHandler  UpdateHandler
-	commandRouter  CommandRouter
-	postgres       *storage.PostgreSQL
-	httpServer     *httpserver.HttpServer
+	config            *config.Config
+	logger            logger.Logger
+	telegramSvc       domain.TelegramService
+	serverService     *service.ServerService
+	userService       domain.UserService
+	metricsService    *services.MetricsServiceImpl
+	updateHandler     UpdateHandler
+	commandRouter     CommandRouter
+	commands          []*domain.Command // built-in commands, see builtinCommands
+	reportService     *services.ReportService
+	auditService      *services.AuditService
+	containerService  *services.ContainerService
+	replayService     *services.ReplayService
+	execService       *services.ExecService
+	sshKeyService     *services.SSHKeyService
+	customCommands    *services.CustomCommandService
+	fileService       *services.FileService
+	pairingService    *services.PairingService
+	inventoryService  *services.InventoryService
+	linkService       *services.AccountLinkService
+	keyService        *services.KeyService
+	historyService    *services.HistoryService
+	alertService      *services.AlertService
+	dependencyService *services.DependencyService
+	sloTracker        *slo.Tracker
+	sloAlerted        map[slo.Class]bool
+	scheduler         *scheduler.Scheduler
+	metricsWriter     *ingest.Writer
+	database          storage.Database
+	repo              repository.Repository
+	httpServer        *httpserver.HttpServer
+	apiAuth           *httpserver.Authenticator
+	certIssuer        *httpserver.CertIssuer
+	rateLimiter       *ratelimit.Limiter
+	metricsCache      services.MetricsCache
+	clusterStore      *cluster.RedisStore         // nil unless replicas are coordinated
+	tracer            *tracing.Tracer             // nil unless API spans are exported
+	agentHub          *agentconn.Hub              // nil unless agents may keep a WebSocket connection
+	agentBreaker      *docker.CircuitBreakerAgent // nil unless commands to offline servers fail fast
+	elector           *cluster.Elector
+	branding          *branding.Branding
+	notifyService     *services.NotifyService
+	chatService       *services.ChatService
+	restartPolicies   *services.RestartPolicyService
+	logWatches        *services.LogWatchService
+	passiveChecks     *services.PassiveCheckService
+	processService    *services.ProcessService
+	processWatches    *services.ProcessWatchService
+	deploymentWindows *services.DeploymentWindowService
+	smartService      *services.SMARTService
+	backupService     *services.BackupService
+	kubeService       *services.KubeService
+	vmService         *services.VMService
+	socketService     *services.SocketService
+	firewallService   *services.FirewallService
+	speedtestService  *services.SpeedtestService
+	powerService      *services.PowerService
+	alertRoutes       *services.AlertRouteService
+	uptimeService     *services.UptimeService
+	guestService      *services.GuestService
+	updatesService    *services.UpdatesService
+	agentUpdates      *services.AgentUpdateService
+	exportService     *services.ExportService
+	adminService      *services.AdminService
+	fleetStats        *services.FleetStatsService
+	settingsService   *services.SettingsService
+	features          *features.Flags
+	featureStore      features.Store
+	secretRotation    *services.SecretRotationService
+	outbox            *services.OutboxService
+	live              *liveDashboards
+	degraded          *degradedHandler // nil unless the bot started without its database
+	shutdown          *shutdown.Registry
+
+	// configMu guards the reloadable settings of config
+	configMu sync.RWMutex
+	restart  chan struct{}
 }
 
 // UpdateHandler handles telegram updates
@@ -50,244 +138,500 @@ type UpdateHandler interface {
 // CommandRouter routes commands to handlers
 type CommandRouter interface {
 	RegisterCommand(cmd *domain.Command) error
-	RouteCommand(ctx context.Context, commandName string, args []string, user *domain.User) error
+	UnregisterCommand(name string)
+	HasCommand(name string) bool
+	RouteCommand(ctx context.Context, commandName string, args []string, user *domain.User, chatID int64) error
 }
 
-// New creates a new bot instance with PostgreSQL
+// New creates a new bot instance backed by the configured database
 func New(cfg *config.Config, log logger.Logger) (*Bot, error) {
-	// Create PostgreSQL connection
-	postgres, err := storage.NewPostgreSQL(cfg.Database.URL)
-	if err != nil {
-		return nil, errors.NewInternalError("failed to create postgres connection", err)
+	// Create database connection, retrying while the database starts. With a degraded
+	// start the bot also starts when it stays unreachable and connects once it recovers.
+	var database storage.Database
+	var repo repository.Repository
+	databaseErr := connectWithRetry(cfg.Retries.Startup, log, services.DependencyDatabase, func() error {
+		db, err := storage.Open(cfg.Database.Driver, cfg.Database.URL)
+		if err != nil {
+			return err
+		}
+		r, err := repository.New(cfg.Database.Driver, cfg.Database.URL)
+		if err != nil {
+			db.Close()
+			return err
+		}
+		database, repo = db, r
+		return nil
+	})
+	if databaseErr != nil {
+		if !cfg.Startup.Degraded {
+			return nil, errors.NewInternalError("failed to create database connection", databaseErr)
+		}
+		log.Error("Database unavailable, starting in degraded mode", "error", databaseErr)
+
+		var err error
+		if database, err = storage.OpenUnchecked(cfg.Database.Driver, cfg.Database.URL); err != nil {
+			return nil, errors.NewInternalError("failed to create database connection", err)
+		}
+		if repo, err = repository.NewUnchecked(cfg.Database.Driver, cfg.Database.URL); err != nil {
+			return nil, errors.NewInternalError("failed to create repository", err)
+		}
 	}
 
 	// Create telegram service
-	telegramSvc, err := telegram.NewTelegramService(cfg.Telegram.Token, &logrusAdapter{logger: log})
+	var telegramSvc *telegram.TelegramService
+	err := connectWithRetry(cfg.Retries.Startup, log, "telegram", func() (err error) {
+		telegramSvc, err = telegram.NewTelegramService(cfg.Telegram.Token, cfg.Timeouts.UpdateProcessing, cfg.Timeouts.UpdatesPoll, telegram.PollingPolicy{
+			RetryDelay:    cfg.Telegram.PollRetryDelay,
+			MaxRetryDelay: cfg.Telegram.PollRetryMaxDelay,
+			AlertAfter:    cfg.Telegram.PollAlertAfter,
+			Workers:       cfg.Telegram.UpdateWorkers,
+			QueueSize:     cfg.Telegram.UpdateQueueSize,
+		}, telegram.SendPolicy{
+			Rate:          cfg.Telegram.RateLimitPerSec,
+			Burst:         cfg.Telegram.RateLimitBurst,
+			ChatInterval:  cfg.Telegram.ChatSendInterval,
+			GroupInterval: cfg.Telegram.GroupSendInterval,
+			Retries:       cfg.Telegram.SendRetries,
+		}, &logrusAdapter{logger: log})
+		return err
+	})
 	if err != nil {
 		return nil, errors.NewInternalError("failed to create telegram service", err)
 	}
 
 	// Create repositories
-	userRepo := storage.NewUserRepositoryAdapter(postgres)
-	serverRepo := storage.NewServerRepositoryAdapter(postgres)
-	userServerRepo := storage.NewUserServerRepositoryAdapter(postgres)
-
-	// Create services
-	postgresRepo, err := repository.NewPostgresRepository(cfg.Database.URL)
-	if err != nil {
-		return nil, errors.NewInternalError("failed to create postgres repository", err)
+	userRepo := storage.NewUserRepositoryAdapter(database)
+	serverRepo := storage.NewServerRepositoryAdapter(database)
+	userServerRepo := storage.NewUserServerRepositoryAdapter(database)
+
+	// Export spans of API requests, commands and agent commands when a collector is configured
+	var tracer *tracing.Tracer
+	if cfg.Tracing.Endpoint != "" {
+		tracer = tracing.NewTracer(cfg.Tracing.Endpoint, cfg.Tracing.ServiceName, cfg.Tracing.ExportInterval, cfg.Tracing.ExportTimeout, &logrusAdapter{logger: log})
 	}
 
 	// Create API client
-	apiClient := api.NewClient(cfg.API.BaseURL, &logrusAdapter{logger: log})
-
-	realUserService := services.NewUserService(postgresRepo, apiClient)
+	apiClient := api.NewClient(cfg.API.BaseURL, cfg.Timeouts.APIRequest, api.RetryPolicy{
+		Attempts: cfg.Retries.API.Attempts,
+		Delay:    cfg.Retries.API.Delay,
+		MaxDelay: cfg.Retries.API.MaxDelay,
+	}, &logrusAdapter{logger: log})
+	apiClient.UseTracer(tracer)
+
+	realUserService := services.NewUserService(repo, apiClient, services.NewUserCache(cfg.UserCache.Size, cfg.UserCache.TTL))
+	realUserService.UseLatestAgentVersion(cfg.API.AgentLatestVersion)
 	serverService := service.NewServerService(serverRepo, userRepo, userServerRepo)
 	userService := services.NewUserServiceAdapter(realUserService)
 
-	// Create metrics service
-	metricsService := services.NewMetricsService(apiClient, &logrusAdapter{logger: log})
-
-	// Create command router
-	commandRouter := NewDefaultCommandRouterNew(log, telegramSvc, userService, serverService, metricsService)
+	// Create metrics service, optionally recording history through the batching writer
+	var metricsWriter *ingest.Writer
+	var metricsHistory services.MetricsRecorder
+	if cfg.MetricsHistory.Enabled {
+		metricsWriter = ingest.NewWriter(repo, ingest.Config{
+			BatchSize:     cfg.MetricsHistory.BatchSize,
+			FlushInterval: cfg.MetricsHistory.FlushInterval,
+			MaxBuffer:     cfg.MetricsHistory.MaxBuffer,
+		}, &logrusAdapter{logger: log})
+		metricsHistory = metricsWriter
+	}
+	metricsCache := newMetricsCache(cfg, log)
+	metricsService := services.NewMetricsService(apiClient, cfg.Timeouts.MetricsFetch, metricsCache, cfg.MetricsCache.TTL, cfg.MetricsCache.TypeTTLs, metricsHistory, &logrusAdapter{logger: log})
+	metricsService.KeepLastKnown(cfg.MetricsCache.LastKnownTTL)
+
+	// Create report scheduler
+	reportScheduler := scheduler.New(cfg.Scheduler.CheckInterval, &logrusAdapter{logger: log})
+
+	// Create SLO tracker and audit service feeding it
+	sloTracker := slo.NewTracker(cfg.SLO.Window, map[slo.Class]float64{
+		slo.ClassMetrics:    cfg.SLO.MetricsTarget,
+		slo.ClassContainers: cfg.SLO.ContainersTarget,
+		slo.ClassAdmin:      cfg.SLO.AdminTarget,
+	})
+	auditService := services.NewAuditService(repo, sloTracker, &logrusAdapter{logger: log})
+
+	// Agent commands are pushed over persistent agent connections, or sent through the API
+	var agent docker.Agent = apiClient
+	var agentHub *agentconn.Hub
+	if cfg.API.AgentWebSocket {
+		agentHub = agentconn.NewHub(apiClient, cfg.API.AgentPingInterval, cfg.API.AgentMaxMessage, &logrusAdapter{logger: log})
+		agentHub.UseTracer(tracer)
+		agent = agentHub
+	}
 
-	// Create update handler
-	updateHandler := NewDefaultUpdateHandlerNew(log, telegramSvc, userService, commandRouter, serverService, metricsService)
+	// Agent commands optionally travel encrypted end-to-end with the secret given at pairing
+	if cfg.API.EncryptCommands {
+		agent = docker.NewEncryptedAgent(agent, repo)
+	}
 
-	// Create HTTP server for health checks
-	httpServer := httpserver.New(cfg.App.Port, log)
+	// Fail fast on servers whose agent keeps timing out until a probe reaches it again
+	var agentBreaker *docker.CircuitBreakerAgent
+	if cfg.API.AgentBreakerThreshold > 0 {
+		agentBreaker = docker.NewCircuitBreakerAgent(agent, agentProbe(apiClient, agentHub), cfg.API.AgentBreakerThreshold, cfg.API.AgentBreakerCooldown)
+		agent = agentBreaker
+	}
 
-	bot := &Bot{
-		config:         cfg,
-		logger:         log,
-		telegramSvc:    telegramSvc,
-		serverService:  serverService,
-		userService:    userService,
-		metricsService: metricsService,
-		updateHandler:  updateHandler,
-		commandRouter:  commandRouter,
-		postgres:       postgres,
-		httpServer:     httpServer,
+	// Create container service managing Docker through server agents
+	dockerClient := docker.NewClient(agent, auditService, cfg.Timeouts.AgentCommand, cfg.Timeouts.ImagePull)
+	metricsService.UseAgent(dockerClient)
+	containerService := services.NewContainerService(dockerClient, &logrusAdapter{logger: log})
+	processService := services.NewProcessService(dockerClient, &logrusAdapter{logger: log})
+	reportService := services.NewReportService(repo, repo, repo, realUserService, metricsService, containerService, processService, services.RetryPolicy{
+		Attempts: cfg.Retries.Reports.Attempts,
+		Delay:    cfg.Retries.Reports.Delay,
+		MaxDelay: cfg.Retries.Reports.MaxDelay,
+	}, &logrusAdapter{logger: log})
+	execService := services.NewExecService(dockerClient, auditService, cfg.Exec.AllowedCommands, &logrusAdapter{logger: log})
+	sshKeyService := services.NewSSHKeyService(dockerClient, auditService, cfg.SSHKeys.AllowedTypes, cfg.SSHKeys.MinRSABits, &logrusAdapter{logger: log})
+	pairingService := services.NewPairingService(repo, repo, realUserService, auditService, cfg.Pairing.CodeTTL, cfg.Pairing.MaxAttempts, &logrusAdapter{logger: log})
+	inventoryService := services.NewInventoryService(realUserService, auditService, &logrusAdapter{logger: log})
+	linkService := services.NewAccountLinkService(repo, auditService, cfg.Pairing.LinkCodeTTL, &logrusAdapter{logger: log})
+	historyService := services.NewHistoryService(repo, &logrusAdapter{logger: log})
+	alertService := services.NewAlertService(repo, repo, metricsService, cfg.Monitoring.AlertThresholds, cfg.Monitoring.CorrelationWindow, &logrusAdapter{logger: log})
+	metricsService.SetSeverity(alertService, cfg.Monitoring.WarningRatio)
+	keyService := services.NewKeyService(repo, auditService, cfg.Keys.RotationGrace, &logrusAdapter{logger: log})
+	fileService := services.NewFileService(dockerClient, cfg.Files.MaxReadBytes, cfg.Files.MaxEntries, &logrusAdapter{logger: log})
+	customCommandService := services.NewCustomCommandService(repo, dockerClient, auditService, cfg.Exec.ScriptDirs, &logrusAdapter{logger: log})
+	replayService := services.NewReplayService(auditService, agent, cfg.Timeouts.AgentCommand, &logrusAdapter{logger: log})
+
+	// Publish alerts and reports to channels besides Telegram
+	notifyService := services.NewNotifyService(repo, notify.NewDispatcher(notify.Config{
+		Timeout: cfg.Notify.Timeout,
+		SMTP: notify.SMTPConfig{
+			Host:     cfg.Notify.SMTPHost,
+			Port:     cfg.Notify.SMTPPort,
+			Username: cfg.Notify.SMTPUsername,
+			Password: cfg.Notify.SMTPPassword,
+			From:     cfg.Notify.SMTPFrom,
+		},
+	}, &logrusAdapter{logger: log}), &logrusAdapter{logger: log})
+
+	// Track health of dependencies to tell users which one is down
+	dependencyService := services.NewDependencyService(cfg.Timeouts.APIRequest, &logrusAdapter{logger: log})
+	dependencyService.Register(services.DependencyDatabase, repo.Ping)
+	dependencyService.Register(services.DependencyMetrics, apiClient.CheckEndpoints)
+	apiClient.UseFallbacks(cfg.API.FallbackURLs, func(change api.EndpointSwitch) {
+		if change.Failback {
+			dependencyService.Note(services.DependencyMetrics, "вернулся на основной адрес "+change.To)
+			return
+		}
+		dependencyService.Note(services.DependencyMetrics, "переключен на резервный адрес "+change.To)
+	})
+	if databaseErr != nil {
+		dependencyService.MarkDown(services.DependencyDatabase, databaseErr)
 	}
 
-	// Register commands
-	if err := bot.registerCommands(); err != nil {
-		return nil, errors.NewInternalError("failed to register commands", err)
+	// Render deployment-specific welcome and help texts
+	brand, err := branding.New(branding.Config{
+		Name:           cfg.Branding.DisplayName,
+		Intro:          cfg.Branding.WelcomeText,
+		SupportContact: cfg.Branding.SupportContact,
+		Locale:         cfg.Branding.DefaultLocale,
+		TemplatesDir:   cfg.Branding.TemplatesDir,
+	})
+	if err != nil {
+		return nil, errors.NewInternalError("failed to load branding", err)
 	}
 
-	return bot, nil
-}
+	// Create rate limiter shared by commands and API endpoints
+	var rateLimiter *ratelimit.Limiter
+	err = connectWithRetry(cfg.Retries.Startup, log, services.DependencyRedis, func() (err error) {
+		rateLimiter, err = newRateLimiter(cfg)
+		return err
+	})
+	if err != nil {
+		return nil, errors.NewInternalError("failed to create rate limiter", err)
+	}
 
-// registerCommands registers all bot commands
-func (b *Bot) registerCommands() error {
-	commands := []*domain.Command{
-		{
-			Name:        "start",
-			Description: "Start bot and show welcome message",
-			Handler:     b.handleStartCommand,
-			Permissions: []string{},
-		},
-		{
-			Name:        "help",
-			Description: "Show available commands",
-			Handler:     b.handleHelpCommand,
-			Permissions: []string{},
-		},
-		{
-			Name:        "servers",
-			Description: "List your servers",
-			Handler:     b.handleServersCommand,
-			Permissions: []string{},
-		},
-		{
-			Name:        "rename",
-			Description: "Rename a server",
-			Handler:     b.handleRenameCommand,
-			Permissions: []string{},
-		},
-		{
-			Name:        "add",
-			Description: "Add server to monitor",
-			Handler:     b.handleAddServerCommand,
-			Permissions: []string{},
-		},
-		{
-			Name:        "cpu",
-			Description: "Show CPU metrics",
-			Handler:     b.handleCPUCommand,
-			Permissions: []string{},
-		},
-		{
-			Name:        "memory",
-			Description: "Show memory metrics",
-			Handler:     b.handleMemoryCommand,
-			Permissions: []string{},
-		},
-		{
-			Name:        "disk",
-			Description: "Show disk metrics",
-			Handler:     b.handleDiskCommand,
-			Permissions: []string{},
-		},
-		{
-			Name:        "temp",
-			Description: "Show temperature metrics",
-			Handler:     b.handleTempCommand,
-			Permissions: []string{},
-		},
-		{
-			Name:        "network",
-			Description: "Show network metrics",
-			Handler:     b.handleNetworkCommand,
-			Permissions: []string{},
-		},
-		{
-			Name:        "system",
-			Description: "Show system information",
-			Handler:     b.handleSystemCommand,
-			Permissions: []string{},
-		},
-		{
-			Name:        "all",
-			Description: "Show all metrics summary",
-			Handler:     b.handleAllCommand,
-			Permissions: []string{},
-		},
+	if rateLimiter != nil && cfg.RateLimit.Backend == "redis" {
+		dependencyService.Register(services.DependencyRedis, rateLimiter.Ping)
 	}
 
-	for _, cmd := range commands {
-		if err := b.commandRouter.RegisterCommand(cmd); err != nil {
-			return errors.NewInternalError("failed to register command", err)
+	// Create feature flags, flipped at runtime in the store for all replicas
+	var featureStore features.Store
+	err = connectWithRetry(cfg.Retries.Startup, log, services.DependencyRedis, func() (err error) {
+		featureStore, err = newFeatureStore(cfg)
+		return err
+	})
+	if err != nil {
+		return nil, errors.NewInternalError("failed to create feature flag store", err)
+	}
+	if redisStore, ok := featureStore.(*features.RedisStore); ok {
+		dependencyService.Register(services.DependencyRedis, redisStore.Ping)
+	}
+	featureFlags := features.New(featureStore, features.Defaults(cfg.Features.Rollout, cfg.Features.Users))
+
+	// Coordinate replicas: one leader polls Telegram and runs scheduled jobs
+	var clusterStore *cluster.RedisStore
+	var elector *cluster.Elector
+	if cfg.Cluster.Enabled {
+		err = connectWithRetry(cfg.Retries.Startup, log, services.DependencyRedis, func() (err error) {
+			clusterStore, err = newClusterStore(cfg)
+			return err
+		})
+		if err != nil {
+			return nil, errors.NewInternalError("failed to connect to the cluster store", err)
 		}
+		elector = cluster.NewElector(clusterStore, cfg.Cluster.InstanceID, cfg.Cluster.LeaseTTL, &logrusAdapter{logger: log})
+		dependencyService.Register(services.DependencyRedis, clusterStore.Ping)
 	}
 
-	return nil
-}
+	// Create command router
+	commandRouter := NewDefaultCommandRouterNew(log, telegramSvc, userService, serverService, metricsService, rateLimiter, ratelimit.Rule{Limit: cfg.RateLimit.CommandLimit, Window: cfg.RateLimit.Window})
+	commandRouter.tracer = tracer
+	commandRouter.audit = auditService
 
-// getCommandList returns the list of bot commands
-func (b *Bot) getCommandList() []domain.BotCommand {
-	return []domain.BotCommand{
-		{Command: "start", Description: "Start bot and show welcome message"},
-		{Command: "help", Description: "Show available commands"},
-		{Command: "servers", Description: "List your servers"},
-		{Command: "rename", Description: "Rename a server"},
-		{Command: "add", Description: "Add server to monitor"},
-		{Command: "cpu", Description: "Show CPU metrics"},
-		{Command: "memory", Description: "Show memory metrics"},
-		{Command: "disk", Description: "Show disk metrics"},
-		{Command: "temp", Description: "Show temperature metrics"},
-		{Command: "network", Description: "Show network metrics"},
-		{Command: "system", Description: "Show system information"},
-		{Command: "all", Description: "Show all metrics summary"},
-	}
-}
+	// Create group chat service
+	chatService := services.NewChatService(repo, &logrusAdapter{logger: log})
 
-// Command handlers
+	// Create restart policy service
+	restartPolicies := services.NewRestartPolicyService(repo, repo, dockerClient, &logrusAdapter{logger: log})
+	logWatches := services.NewLogWatchService(repo, repo, dockerClient, &logrusAdapter{logger: log})
 
-func (b *Bot) handleStartCommand(ctx context.Context, cmd *domain.Command, args []string) error {
-	chatID := ctx.Value(chatIDKey).(int64)
+	// Create passive check service
+	passiveChecks := services.NewPassiveCheckService(repo, repo, &logrusAdapter{logger: log})
 
-	message := `👋 *Добро пожаловать в ServerEyeBot!*
+	// Create deployment window service
+	deploymentWindows := services.NewDeploymentWindowService(repo, &logrusAdapter{logger: log})
 
-Я помогу вам мониторить ваши серверы.
+	// Create alert route service
+	alertRoutes := services.NewAlertRouteService(repo, &logrusAdapter{logger: log})
 
-*Доступные команды:*
-/start - Показать это сообщение
-/help - Помощь и список всех команд
-/servers - Список ваших серверов
-/add <server_id> - Добавить сервер
+	// Create uptime check service
+	uptimeService := services.NewUptimeService(repo, repo, dockerClient, cfg.Monitoring.UptimePrivate, &logrusAdapter{logger: log})
 
-*Команды метрик:*
-/cpu [server_id] - Загрузка процессора
-/memory [server_id] - Использование памяти
-/disk [server_id] - Дисковое пространство
-/temp [server_id] - Температура системы
-/network [server_id] - Сетевая активность
-/system [server_id] - Системная информация
-/all [server_id] - Все метрики (кратко)
+	// Create package updates service
+	updatesService := services.NewUpdatesService(dockerClient, &logrusAdapter{logger: log})
 
-Начните с команды /servers чтобы увидеть ваши серверы!`
+	// Create agent update service
+	agentUpdates := services.NewAgentUpdateService(dockerClient, cfg.Timeouts.AgentUpdate, &logrusAdapter{logger: log})
 
-	return b.telegramSvc.SendMessage(ctx, chatID, message)
-}
+	// Create user data export service
+	exportService := services.NewExportService(repo, &logrusAdapter{logger: log})
 
-func (b *Bot) handleHelpCommand(ctx context.Context, cmd *domain.Command, args []string) error {
-	chatID := ctx.Value(chatIDKey).(int64)
+	// Create admin service
+	adminService := services.NewAdminService(repo, &logrusAdapter{logger: log})
+	fleetStats := services.NewFleetStatsService(repo, apiClient, cfg.Timeouts.APIRequest, &logrusAdapter{logger: log})
+
+	// Create guest access service
+	guestService := services.NewGuestService(repo, repo, &logrusAdapter{logger: log})
+
+	// Create user settings service
+	settingsService := services.NewSettingsService(repo, &logrusAdapter{logger: log})
 
-	message := `📖 *Помощь ServerEyeBot*
+	// Create alert outbox, retrying alerts until Telegram confirms them
+	outboxService := services.NewOutboxService(repo, services.RetryPolicy{
+		Attempts: cfg.Retries.Alerts.Attempts,
+		Delay:    cfg.Retries.Alerts.Delay,
+		MaxDelay: cfg.Retries.Alerts.MaxDelay,
+	}, &logrusAdapter{logger: log})
 
-*Основные команды:*
-• /start - Приветствие
-• /help - Эта справка
-• /servers - Показать ваши серверы
-• /add <server_id> - Добавить сервер (например: /add srv_12313)
+	// Create SMART service
+	processWatches := services.NewProcessWatchService(repo, repo, metricsService, execService, &logrusAdapter{logger: log})
+	secretRotation := services.NewSecretRotationService(secrets.NewResolver(cfg.Secrets.Options()), cfg.SecretReferences(), cfg.Secrets.RefreshInterval, &logrusAdapter{logger: log})
+	smartService := services.NewSMARTService(dockerClient, repo, cfg.Monitoring.SMARTInterval, cfg.Monitoring.SMARTTemperature, &logrusAdapter{logger: log})
+	backupService := services.NewBackupService(dockerClient, repo, cfg.Monitoring.BackupInterval, cfg.Monitoring.BackupMaxAge, &logrusAdapter{logger: log})
+	vmService := services.NewVMService(dockerClient, &logrusAdapter{logger: log})
+	kubeService := services.NewKubeService(dockerClient, &logrusAdapter{logger: log})
+	socketService := services.NewSocketService(dockerClient, &logrusAdapter{logger: log})
+	firewallService := services.NewFirewallService(repo, dockerClient, &logrusAdapter{logger: log})
+	powerService := services.NewPowerService(dockerClient, &logrusAdapter{logger: log})
+	speedtestService := services.NewSpeedtestService(dockerClient, cfg.Speedtest.Endpoint, cfg.Speedtest.Cooldown, cfg.Speedtest.Timeout, &logrusAdapter{logger: log})
 
-*Команды метрик:*
-• /cpu [server_id] - Загрузка процессора
-• /memory [server_id] - Использование памяти
-• /disk [server_id] - Дисковое пространство
-• /temp [server_id] - Температура системы
-• /network [server_id] - Сетевая активность
-• /system [server_id] - Системная информация
-• /all [server_id] - Все метрики (кратко)
+	// Create update handler
+	updateHandler := NewDefaultUpdateHandlerNew(log, telegramSvc, userService, commandRouter, serverService, metricsService, auditService, containerService, dependencyService, chatService, restartPolicies, processService, processWatches, updatesService, firewallService, powerService, vmService, settingsService, reportService, telegramSvc.GetBot().Self.UserName)
+	updateHandler.tracer = tracer
+	updateHandler.inventory = inventoryService
+
+	// Inline buttons are signed so that clients cannot forge them when a secret is set
+	callbacks.SetSecret(cfg.Telegram.CallbackSecret)
+
+	// Live dashboards are started by /live and stopped by the button of their message
+	live := newLiveDashboards()
+	updateHandler.live = live
+
+	// Queue updates until the database recovers when the bot started without it
+	var handler UpdateHandler = updateHandler
+	var degraded *degradedHandler
+	if databaseErr != nil {
+		degraded = newDegradedHandler(updateHandler, dependencyService, telegramSvc, log, cfg.Startup.QueueSize)
+		handler = degraded
+	}
 
-*Как добавить сервер:*
-1. Используйте команду /add srv_12313
-2. Бот добавит сервер в ваш список
-3. Проверьте через /servers
-4. Используйте команды метрик для просмотра данных
+	// Create HTTP server for health checks
+	httpServer := httpserver.New(cfg.App.Port, httpserver.Timeouts{
+		Read:  cfg.Timeouts.HTTPRead,
+		Write: cfg.Timeouts.HTTPWrite,
+		Idle:  cfg.Timeouts.HTTPIdle,
+	}, log)
+	metricsSources := []httpserver.PrometheusSource{sloTracker, telegramSvc, commandRouter.metrics}
+	if metricsWriter != nil {
+		metricsSources = append(metricsSources, metricsWriter)
+	}
+	if rateLimiter != nil {
+		metricsSources = append(metricsSources, rateLimiter)
+	}
+	if agentHub != nil {
+		metricsSources = append(metricsSources, agentHub)
+	}
+	httpServer.Handle("/metrics", httpserver.PrometheusHandler(metricsSources...))
+	httpServer.UseTracer(tracer)
 
-*Управление серверами:*
-Один пользователь может иметь много серверов, и один сервер может быть доступен многим пользователям.
+	// Serve HTTPS and verify agent client certificates when configured
+	if cfg.TLS.CertFile != "" {
+		tlsConfig, err := httpserver.NewTLSConfig(cfg.TLS.CertFile, cfg.TLS.KeyFile, cfg.TLS.ClientCAFile)
+		if err != nil {
+			return nil, errors.NewInternalError("failed to load TLS configuration", err)
+		}
+		httpServer.UseTLS(tlsConfig)
+	}
 
-*Выбор сервера для метрик:*
-• Если у вас один сервер - метрики показываются автоматически
-• Если несколько серверов - используйте /cpu server_id для конкретного сервера
-• При вызове без параметра - увидите список доступных серверов
+	var certIssuer *httpserver.CertIssuer
+	if cfg.TLS.ClientCAKeyFile != "" {
+		certIssuer, err = httpserver.LoadCertIssuer(cfg.TLS.ClientCAFile, cfg.TLS.ClientCAKeyFile, cfg.TLS.ClientCertValidity)
+		if err != nil {
+			return nil, errors.NewInternalError("failed to load client CA", err)
+		}
+	}
 
-Нужна помощь? Свяжитесь с администратором.`
+	bot := &Bot{
+		config:            cfg,
+		logger:            log,
+		telegramSvc:       telegramSvc,
+		serverService:     serverService,
+		userService:       userService,
+		metricsService:    metricsService,
+		updateHandler:     handler,
+		commandRouter:     commandRouter,
+		reportService:     reportService,
+		auditService:      auditService,
+		containerService:  containerService,
+		replayService:     replayService,
+		execService:       execService,
+		sshKeyService:     sshKeyService,
+		customCommands:    customCommandService,
+		fileService:       fileService,
+		pairingService:    pairingService,
+		inventoryService:  inventoryService,
+		linkService:       linkService,
+		keyService:        keyService,
+		historyService:    historyService,
+		alertService:      alertService,
+		dependencyService: dependencyService,
+		sloTracker:        sloTracker,
+		sloAlerted:        make(map[slo.Class]bool),
+		scheduler:         reportScheduler,
+		metricsWriter:     metricsWriter,
+		database:          database,
+		repo:              repo,
+		httpServer:        httpServer,
+		apiAuth:           httpserver.NewAuthenticator(cfg.API.AuthSecret, cfg.API.AdminToken, cfg.TLS.RequireClientCert, log),
+		certIssuer:        certIssuer,
+		rateLimiter:       rateLimiter,
+		metricsCache:      metricsCache,
+		clusterStore:      clusterStore,
+		elector:           elector,
+		tracer:            tracer,
+		agentHub:          agentHub,
+		branding:          brand,
+		notifyService:     notifyService,
+		chatService:       chatService,
+		restartPolicies:   restartPolicies,
+		logWatches:        logWatches,
+		passiveChecks:     passiveChecks,
+		processService:    processService,
+		processWatches:    processWatches,
+		deploymentWindows: deploymentWindows,
+		smartService:      smartService,
+		backupService:     backupService,
+		kubeService:       kubeService,
+		vmService:         vmService,
+		socketService:     socketService,
+		firewallService:   firewallService,
+		speedtestService:  speedtestService,
+		powerService:      powerService,
+		alertRoutes:       alertRoutes,
+		uptimeService:     uptimeService,
+		guestService:      guestService,
+		updatesService:    updatesService,
+		agentUpdates:      agentUpdates,
+		exportService:     exportService,
+		adminService:      adminService,
+		fleetStats:        fleetStats,
+		features:          featureFlags,
+		featureStore:      featureStore,
+		secretRotation:    secretRotation,
+		outbox:            outboxService,
+		degraded:          degraded,
+		agentBreaker:      agentBreaker,
+		restart:           make(chan struct{}, 1),
+		settingsService:   settingsService,
+		live:              live,
+		shutdown:          shutdown.NewRegistry(&logrusAdapter{logger: log}),
+	}
 
-	return b.telegramSvc.SendMessage(ctx, chatID, message)
+	// Alert admins when Telegram polling stays down
+	telegramSvc.OnPollingOutage(bot.handlePollingEvent)
+	if clusterStore != nil {
+		telegramSvc.DeduplicateUpdates(bot.claimUpdate)
+	}
+
+	// Register authenticated API endpoints
+	bot.registerAPIHandlers()
+
+	// Register commands
+	if err := bot.registerCommands(); err != nil {
+		return nil, errors.NewInternalError("failed to register commands", err)
+	}
+
+	// Register scheduled jobs
+	bot.scheduler.Register("reports", bot.runScheduledReports)
+	bot.scheduler.Register("pairing", bot.runPairingCleanup)
+	bot.scheduler.Register("account-links", bot.runAccountLinkCleanup)
+	bot.scheduler.Register("keys", bot.runKeyCleanup)
+	bot.scheduler.Register("dependencies", bot.runDependencyCheck)
+	bot.scheduler.Register("windows", bot.runDeploymentWindowSummaries)
+	bot.scheduler.Register("guests", bot.runGuestExpiry)
+	bot.scheduler.Register("agent-updates", bot.runAgentUpdateCheck)
+	bot.scheduler.Register("process-watches", bot.runProcessWatchCheck)
+	bot.scheduler.Register("outbox", bot.runOutboxDelivery)
+	if agentBreaker != nil {
+		bot.scheduler.Register("agent-probes", bot.runAgentProbes)
+	}
+	if cfg.Monitoring.Enabled {
+		bot.scheduler.Register("alerts", bot.runAlertCheck)
+		bot.scheduler.Register("uptime", bot.runUptimeChecks)
+	}
+	if cfg.Monitoring.Enabled && cfg.Monitoring.SMARTInterval > 0 {
+		bot.scheduler.Register("smart", bot.runSMARTCheck)
+	}
+	if cfg.Monitoring.Enabled && cfg.Monitoring.BackupInterval > 0 {
+		bot.scheduler.Register("backups", bot.runBackupCheck)
+	}
+	bot.scheduler.Register("slo", bot.runSLOCheck)
+	if secretRotation.Enabled() {
+		bot.scheduler.Register("secrets", bot.runSecretCheck)
+	}
+
+	// Register shutdown hooks
+	bot.registerShutdownHooks()
+
+	return bot, nil
+}
+
+// Command handlers
+
+func (b *Bot) handleStartCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	return b.telegramSvc.SendMessage(ctx, chatID, b.welcomeText(ctx, telegramID))
+}
+
+func (b *Bot) handleHelpCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	return b.telegramSvc.SendMessage(ctx, chatID, b.helpText(ctx, telegramID))
 }
 
 func (b *Bot) handleServersCommand(ctx context.Context, cmd *domain.Command, args []string) error {
@@ -298,34 +642,33 @@ func (b *Bot) handleServersCommand(ctx context.Context, cmd *domain.Command, arg
 
 	// Get user servers using UserServiceAdapter
 	if adapter, ok := b.userService.(*services.UserServiceAdapter); ok {
-		// Get user from database to get correct user_id
-		user, err := adapter.GetUser(ctx, telegramID)
+		user, err := contextUser(ctx)
 		if err != nil {
-			b.logger.Error("Failed to get user", "error", err, "telegram_id", telegramID)
 			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
 		}
 
-		servers, err := adapter.GetUserServers(ctx, int64(user.ID))
+		servers, agents, err := adapter.GetUserServersWithInfo(ctx, mapping.UserID(user))
 		if err != nil {
 			b.logger.Error("Failed to get user servers", "error", err, "user_id", user.ID)
 			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Произошла ошибка при получении списка серверов. Попробуйте позже.")
 		}
 
-		// Format and send servers list with remove button
-		message := adapter.FormatServersListPlain(servers)
+		// Format and send servers list with remove button, marking servers in maintenance
+		now := time.Now()
+		maintenance := make(map[string]time.Time)
+		for _, server := range servers {
+			if end, ok := b.deploymentWindows.InMaintenance(server.ID, now); ok {
+				maintenance[server.ID] = end
+			}
+		}
+		message := adapter.FormatServersListPlain(servers, maintenance, agents)
 
 		if len(servers) > 0 {
 			// Create inline keyboard with remove and rename buttons
 			keyboard := [][]map[string]string{
 				{
-					{
-						"text":          "Изменить имя сервера",
-						"callback_data": "show_rename_servers",
-					},
-					{
-						"text":          "Удалить сервер",
-						"callback_data": "show_remove_servers",
-					},
+					showRenameServersCallback.Button("Изменить имя сервера"),
+					showRemoveServersCallback.Button("Удалить сервер"),
 				},
 			}
 			return b.telegramSvc.SendMessageWithKeyboard(ctx, chatID, message, keyboard)
@@ -351,31 +694,32 @@ func (b *Bot) handleAddServerCommand(ctx context.Context, cmd *domain.Command, a
 
 	// Add server to user using UserServiceAdapter
 	if adapter, ok := b.userService.(*services.UserServiceAdapter); ok {
-		// Get user from database to get correct user_id
-		user, err := adapter.GetUser(ctx, telegramID)
+		user, err := contextUser(ctx)
 		if err != nil {
-			b.logger.Error("Failed to get user", "error", err, "telegram_id", telegramID)
 			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
 		}
 
-		if err := adapter.AddServerToUser(ctx, int64(user.ID), serverID, "TGBot"); err != nil {
+		started := time.Now()
+		err = adapter.AddServerToUser(ctx, mapping.UserID(user), serverID, "TGBot")
+		b.auditService.RecordResult(ctx, mapping.UserID(user), telegramID, serverID, services.AuditCommandAddServer, "source=TGBot", "", started, err)
+		if err != nil {
 			b.logger.Error("Failed to add server to user", "error", err, "server_id", serverID, "user_id", user.ID)
 
 			// Check error type and provide specific message
-			errorMsg := err.Error()
-			if strings.Contains(errorMsg, "not found") {
+			switch {
+			case stderrors.Is(err, errors.ErrServerNotFound):
 				return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Сервер `%s` не найден.", serverID))
-			} else if strings.Contains(errorMsg, "API error") {
+			case stderrors.Is(err, errors.ErrAPIUnavailable):
 				return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Ошибка при проверке сервера `%s`. Попробуйте позже.", serverID))
-			} else if strings.Contains(errorMsg, "Invalid server key") {
+			case stderrors.Is(err, errors.ErrInvalidKey):
 				return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Неверный формат ключа сервера `%s`.", serverID))
-			} else {
+			default:
 				return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Не удалось добавить сервер `%s`. Попробуйте позже.", serverID))
 			}
 		}
 
 		// Add Telegram ID to server identifiers
-		if err := adapter.AddTelegramIdentifierToServer(ctx, int64(user.ID), serverID, fmt.Sprintf("%d", telegramID), user.Username, user.FirstName); err != nil {
+		if err := adapter.AddTelegramIdentifierToServer(ctx, mapping.UserID(user), serverID, fmt.Sprintf("%d", telegramID), user.Username, user.FirstName); err != nil {
 			b.logger.Warn("Failed to add Telegram identifier to server", "error", err, "server_id", serverID, "telegram_id", telegramID)
 			// Don't fail the operation, just log the warning
 		}
@@ -400,36 +744,28 @@ func (b *Bot) handleRenameCommand(ctx context.Context, cmd *domain.Command, args
 
 	b.logger.Info("Renaming server", "server_id", serverID, "new_name", newName, "telegram_id", telegramID)
 
-	// Get user servers using UserServiceAdapter
+	// Rename the server using UserServiceAdapter
 	if adapter, ok := b.userService.(*services.UserServiceAdapter); ok {
-		user, err := adapter.GetUser(ctx, telegramID)
+		user, servers, err := contextServers(ctx)
 		if err != nil {
-			b.logger.Error("Failed to get user", "error", err, "telegram_id", telegramID)
 			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
 		}
 
-		servers, err := adapter.GetUserServers(ctx, int64(user.ID))
-		if err != nil {
-			b.logger.Error("Failed to get user servers", "error", err, "user_id", user.ID)
-			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Произошла ошибка при получении списка серверов. Попробуйте позже.")
-		}
-
 		// Find the server to rename
-		var serverToRename *models.ServerWithDetails
-		for _, server := range servers {
-			if server.ID == serverID {
-				serverToRename = &server
-				break
-			}
-		}
+		serverToRename := mapping.ServerByID(servers, serverID)
 
 		if serverToRename == nil {
 			return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Сервер `%s` не найден в вашем списке.", serverID))
 		}
 
 		// Update server name in database
-		err = adapter.UpdateServerName(ctx, int64(user.ID), serverID, newName)
+		started := time.Now()
+		err = adapter.UpdateServerName(ctx, mapping.UserID(user), serverID, newName)
+		b.auditService.RecordResult(ctx, mapping.UserID(user), telegramID, serverID, services.AuditCommandRenameServer, "name="+newName, "", started, err)
 		if err != nil {
+			if errors.IsErrorCode(err, errors.ErrCodeForbidden) {
+				return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("⛔ Переименовать сервер %s может только его администратор: имя видят все, с кем он общий.", serverToRename.Name))
+			}
 			b.logger.Error("Failed to update server name", "error", err, "server_id", serverID, "new_name", newName)
 			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось переименовать сервер. Попробуйте позже.")
 		}
@@ -449,51 +785,194 @@ func (b *Bot) Start(ctx context.Context) error {
 		return err
 	}
 
+	// Export spans of API requests
+	if b.tracer != nil {
+		go b.tracer.Run(ctx)
+	}
+
+	// Start batched ingestion of metrics history
+	if b.metricsWriter != nil {
+		b.metricsWriter.Start(ctx)
+	}
+
+	// Register custom commands defined by server owners
+	if err := b.loadCustomCommands(ctx); err != nil {
+		b.logger.Error("Failed to load custom commands", "error", err)
+	}
+
+	// Check dependencies before the first scheduler tick
+	go b.dependencyService.Check(ctx)
+
+	// Load server tags correlating alerts
+	if err := b.alertService.Load(ctx); err != nil {
+		b.logger.Error("Failed to load server tags", "error", err)
+	}
+
+	// Load deployment windows holding alerts
+	if err := b.deploymentWindows.Load(ctx); err != nil {
+		b.logger.Error("Failed to load deployment windows", "error", err)
+	}
+
+	// Load chats alerts are routed to
+	if err := b.alertRoutes.Load(ctx); err != nil {
+		b.logger.Error("Failed to load alert routes", "error", err)
+	}
+
+	// Load uptime checks of endpoints
+	if err := b.uptimeService.Load(ctx); err != nil {
+		b.logger.Error("Failed to load uptime checks", "error", err)
+	}
+
 	// Set bot commands
-	if err := b.telegramSvc.SetCommands(ctx, b.getCommandList()); err != nil {
+	if err := b.telegramSvc.SetCommands(ctx, menuCommands(b.commands)); err != nil {
 		b.logger.Error("Failed to set bot commands", "error", err)
 	}
 
-	// Start receiving updates
-	return b.telegramSvc.StartReceivingUpdates(ctx, b.updateHandler)
+	// Poll updates and run periodic reports, on the leader only when running replicas
+	if b.elector != nil {
+		b.elector.Run(ctx, b.lead)
+		return nil
+	}
+	b.lead(ctx)
+	return nil
 }
 
-// Stop stops the bot
-func (b *Bot) Stop() {
-	b.telegramSvc.StopReceivingUpdates()
+// registerShutdownHooks registers the shutdown sequence of bot components
+func (b *Bot) registerShutdownHooks() {
+	b.RegisterOnShutdown("telegram-updates", shutdown.PriorityIngress, 0, func(ctx context.Context) error {
+		b.telegramSvc.StopReceivingUpdates()
+		return nil
+	})
 
-	// Stop HTTP server
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	if b.elector != nil {
+		b.RegisterOnShutdown("cluster-leadership", shutdown.PriorityIngress, 0, b.elector.Stop)
+	}
+
+	b.RegisterOnShutdown("http-server", shutdown.PriorityIngress, b.config.Timeouts.Shutdown/2, b.httpServer.Stop)
+
+	if b.agentHub != nil {
+		// The HTTP server does not track connections taken over by agents
+		b.RegisterOnShutdown("agent-connections", shutdown.PriorityIngress, 0, func(ctx context.Context) error {
+			return b.agentHub.Close()
+		})
+	}
 
-	if err := b.httpServer.Stop(ctx); err != nil {
-		b.logger.Error("Failed to stop HTTP server", "error", err)
+	b.RegisterOnShutdown("scheduler", shutdown.PriorityWorkers, 0, func(ctx context.Context) error {
+		b.scheduler.Stop()
+		return nil
+	})
+
+	if b.tracer != nil {
+		b.RegisterOnShutdown("tracing", shutdown.PriorityWorkers, 0, b.tracer.Flush)
+	}
+
+	b.RegisterOnShutdown("live-dashboards", shutdown.PriorityWorkers, 0, b.live.Stop)
+
+	if b.metricsWriter != nil {
+		b.RegisterOnShutdown("metrics-ingest", shutdown.PriorityWorkers, 0, b.metricsWriter.Stop)
 	}
 
-	if err := b.postgres.Close(); err != nil {
-		b.logger.Error("Failed to close database connection", "error", err)
+	if b.rateLimiter != nil {
+		b.RegisterOnShutdown("rate-limiter", shutdown.PriorityStorage, 0, func(ctx context.Context) error {
+			return b.rateLimiter.Close()
+		})
+	}
+
+	if closer, ok := b.metricsCache.(io.Closer); ok {
+		b.RegisterOnShutdown("metrics-cache", shutdown.PriorityStorage, 0, func(ctx context.Context) error {
+			return closer.Close()
+		})
+	}
+
+	if closer, ok := b.featureStore.(io.Closer); ok {
+		b.RegisterOnShutdown("feature-flags", shutdown.PriorityStorage, 0, func(ctx context.Context) error {
+			return closer.Close()
+		})
+	}
+
+	if b.clusterStore != nil {
+		b.RegisterOnShutdown("cluster-store", shutdown.PriorityStorage, 0, func(ctx context.Context) error {
+			return b.clusterStore.Close()
+		})
+	}
+
+	b.RegisterOnShutdown("repository", shutdown.PriorityStorage, 0, func(ctx context.Context) error {
+		return b.repo.Close()
+	})
+
+	b.RegisterOnShutdown("database", shutdown.PriorityStorage, 0, func(ctx context.Context) error {
+		return b.database.Close()
+	})
+}
+
+// RegisterOnShutdown registers a component hook executed when the bot stops
+func (b *Bot) RegisterOnShutdown(name string, priority int, timeout time.Duration, fn shutdown.HookFunc) {
+	b.shutdown.RegisterOnShutdown(name, priority, timeout, fn)
+}
+
+// Stop stops the bot
+func (b *Bot) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), b.config.Timeouts.Shutdown)
+	defer cancel()
+
+	if err := b.shutdown.Shutdown(ctx); err != nil {
+		b.logger.Error("Bot stopped with errors", "error", err)
 	}
 }
 
 // DefaultUpdateHandler implements UpdateHandler
 type DefaultUpdateHandler struct {
-	logger         logger.Logger
-	telegramSvc    domain.TelegramService
-	userService    domain.UserService
-	commandRouter  CommandRouter
-	serverService  *service.ServerService
-	metricsService *services.MetricsServiceImpl
+	logger           logger.Logger
+	telegramSvc      domain.TelegramService
+	userService      domain.UserService
+	commandRouter    CommandRouter
+	serverService    *service.ServerService
+	metricsService   *services.MetricsServiceImpl
+	auditService     *services.AuditService
+	containerService *services.ContainerService
+	dependencies     *services.DependencyService
+	chatService      *services.ChatService
+	restartPolicies  *services.RestartPolicyService
+	processService   *services.ProcessService
+	processWatches   *services.ProcessWatchService
+	updatesService   *services.UpdatesService
+	firewallService  *services.FirewallService
+	powerService     *services.PowerService
+	vmService        *services.VMService
+	settingsService  *services.SettingsService
+	reportService    *services.ReportService
+	inventory        *services.InventoryService
+	live             *liveDashboards // dashboards refreshed by /live, stopped by their button
+	callbacks        *callbacks.Registry
+	tracer           *tracing.Tracer // nil unless callbacks are traced
+	botUsername      string
 }
 
-func NewDefaultUpdateHandlerNew(log logger.Logger, telegramSvc domain.TelegramService, userService domain.UserService, commandRouter CommandRouter, serverService *service.ServerService, metricsService *services.MetricsServiceImpl) *DefaultUpdateHandler {
-	return &DefaultUpdateHandler{
-		logger:         log,
-		telegramSvc:    telegramSvc,
-		userService:    userService,
-		commandRouter:  commandRouter,
-		serverService:  serverService,
-		metricsService: metricsService,
+func NewDefaultUpdateHandlerNew(log logger.Logger, telegramSvc domain.TelegramService, userService domain.UserService, commandRouter CommandRouter, serverService *service.ServerService, metricsService *services.MetricsServiceImpl, auditService *services.AuditService, containerService *services.ContainerService, dependencies *services.DependencyService, chatService *services.ChatService, restartPolicies *services.RestartPolicyService, processService *services.ProcessService, processWatches *services.ProcessWatchService, updatesService *services.UpdatesService, firewallService *services.FirewallService, powerService *services.PowerService, vmService *services.VMService, settingsService *services.SettingsService, reportService *services.ReportService, botUsername string) *DefaultUpdateHandler {
+	h := &DefaultUpdateHandler{
+		logger:           log,
+		telegramSvc:      telegramSvc,
+		userService:      userService,
+		commandRouter:    commandRouter,
+		serverService:    serverService,
+		metricsService:   metricsService,
+		auditService:     auditService,
+		containerService: containerService,
+		dependencies:     dependencies,
+		chatService:      chatService,
+		restartPolicies:  restartPolicies,
+		processService:   processService,
+		processWatches:   processWatches,
+		updatesService:   updatesService,
+		firewallService:  firewallService,
+		powerService:     powerService,
+		vmService:        vmService,
+		settingsService:  settingsService,
+		reportService:    reportService,
+		botUsername:      botUsername,
 	}
+	h.registerCallbacks()
+	return h
 }
 
 func (h *DefaultUpdateHandler) HandleUpdate(ctx context.Context, update *telegram.Update) error {
@@ -505,33 +984,44 @@ func (h *DefaultUpdateHandler) HandleUpdate(ctx context.Context, update *telegra
 		return h.handleCallback(ctx, update.CallbackQuery)
 	}
 
+	if update.InlineQuery != nil {
+		return h.handleInlineQuery(withAccount(ctx, h.userService, h.logger, update.InlineQuery.From.ID), update.InlineQuery)
+	}
+
 	return nil
 }
 
 func (h *DefaultUpdateHandler) handleMessage(ctx context.Context, message *telegram.Message) error {
-	// Register user if needed
-	user := &domain.User{
-		ID:         int(message.From.ID), // Convert to int for domain.User
-		TelegramID: message.From.ID,
-		Username:   message.From.Username,
-		FirstName:  message.From.FirstName,
-		LastName:   message.From.LastName,
-		IsAdmin:    h.userService.IsAdmin(message.From.ID),
-		CreatedAt:  time.Now(),
-		LastSeen:   time.Now(),
-	}
-
-	if err := h.userService.RegisterUser(ctx, user); err != nil {
-		h.logger.WithFields(map[string]interface{}{"error": err, "user_id": user.ID}).Warn("Failed to register user")
-	}
+	user := mapping.UserFromTelegram(message.From, h.userService.IsAdmin(message.From.ID), time.Now())
 
-	// Handle command
+	// Handle command, registering the user in the command middleware
 	if strings.HasPrefix(message.Text, "/") {
 		parts := strings.Fields(message.Text)
 		commandName := strings.TrimPrefix(parts[0], "/")
 		args := parts[1:]
 
-		return h.commandRouter.RouteCommand(ctx, commandName, args, user)
+		// In groups commands may be addressed as /cpu@bot, possibly to another bot
+		commandName, ok := groupCommandName(commandName, h.botUsername)
+		if !ok {
+			return nil
+		}
+
+		return h.commandRouter.RouteCommand(ctx, commandName, args, user, message.Chat.ID)
+	}
+
+	// Register user if needed
+	if err := h.userService.RegisterUser(ctx, user); err != nil {
+		h.logger.WithFields(map[string]interface{}{"error": err, "telegram_id": user.TelegramID}).Warn("Failed to register user")
+	}
+
+	// Group conversations are not meant for the bot
+	if message.Chat.IsGroup() {
+		return nil
+	}
+
+	// Files sent to the bot are server inventories to import
+	if message.Document != nil {
+		return h.handleInventoryDocument(withAccount(ctx, h.userService, h.logger, message.From.ID), message)
 	}
 
 	// Handle regular message
@@ -545,7 +1035,15 @@ func (h *DefaultUpdateHandler) handleCallback(ctx context.Context, callback *tel
 	}
 
 	// Handle callback data
-	return h.handleCallbackData(ctx, callback)
+	name, _, _ := strings.Cut(callback.Data, ":")
+	ctx, span := h.tracer.StartChild(ctx, "callback "+name, tracing.KindInternal)
+	span.SetAttribute("telegram.user_id", callback.From.ID)
+	err := h.handleCallbackData(ctx, callback)
+	if err != nil {
+		span.SetFailed()
+	}
+	span.End()
+	return err
 }
 
 func (h *DefaultUpdateHandler) handleRegularMessage(ctx context.Context, message *telegram.Message, user *domain.User) error {
@@ -568,113 +1066,76 @@ func (h *DefaultUpdateHandler) handleCallbackData(ctx context.Context, callback
 	// Debug log to see what callback data we receive
 	h.logger.Info("Received callback", "data", callback.Data, "from", callback.From.ID)
 
-	// Handle button callbacks
-	switch callback.Data {
-	case "show_remove_servers":
-		// Handle show remove servers callback - need to get bot instance differently
-		return h.handleShowRemoveServersCallback(ctx, callback)
-	case "show_rename_servers":
-		// Handle show rename servers callback
-		return h.handleShowRenameServersCallback(ctx, callback)
-	default:
-		// Handle server removal callbacks
-		if len(callback.Data) > 14 && callback.Data[:14] == "remove_server:" {
-			h.logger.Info("Processing remove server callback")
-			return h.handleRemoveServerCallback(ctx, callback)
-		}
-
-		// Handle server rename callbacks
-		if len(callback.Data) > 14 && callback.Data[:14] == "rename_server:" {
-			h.logger.Info("Processing rename server callback")
-			return h.handleRenameServerCallback(ctx, callback)
-		}
-
-		// Handle metrics callbacks
-		if len(callback.Data) > 7 && callback.Data[:7] == "metric:" {
-			h.logger.Info("Processing metric callback")
-			return h.handleMetricCallback(ctx, callback)
-		}
-
+	handler, data, err := h.callbacks.Resolve(callback.Data)
+	switch {
+	case stderrors.Is(err, callbacks.ErrUnknownAction):
 		h.logger.Warn("Unknown callback data", "data", callback.Data)
 		return h.telegramSvc.SendMessage(ctx, callback.Message.Chat.ID, "Unknown callback")
+	case stderrors.Is(err, callbacks.ErrOutdated), stderrors.Is(err, callbacks.ErrSignature):
+		// Buttons of messages sent before an upgrade or a change of the signing secret
+		h.logger.Warn("Rejected callback data", "error", err, "data", callback.Data, "from", callback.From.ID)
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "⌛ Кнопка устарела. Повторите команду.")
+	case err != nil:
+		h.logger.Warn("Invalid callback data", "error", err, "data", callback.Data, "from", callback.From.ID)
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неверный формат данных")
 	}
+
+	// Agent commands of the button can be cancelled with /cancel in its chat
+	ctx = docker.WithRequest(ctx, callback.Message.Chat.ID, callback.From.ID)
+	ctx = withAccount(ctx, h.userService, h.logger, callback.From.ID)
+	return handler(ctx, callback, data)
 }
 
 // handleShowRemoveServersCallback handles show remove servers callback
-func (h *DefaultUpdateHandler) handleShowRemoveServersCallback(ctx context.Context, callback *telegram.CallbackQuery) error {
-	// Get user servers using UserServiceAdapter
-	if adapter, ok := h.userService.(*services.UserServiceAdapter); ok {
-		// Get user from database to get correct user_id
-		user, err := adapter.GetUser(ctx, callback.From.ID)
-		if err != nil {
-			h.logger.Error("Failed to get user", "error", err, "telegram_id", callback.From.ID)
-			return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Внутренняя ошибка")
-		}
-
-		servers, err := adapter.GetUserServers(ctx, int64(user.ID))
-		if err != nil {
-			h.logger.Error("Failed to get user servers", "error", err, "user_id", user.ID)
-			return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Ошибка получения серверов")
-		}
-
-		if len(servers) == 0 {
-			return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "У вас нет серверов для удаления")
-		}
+func (h *DefaultUpdateHandler) handleShowRemoveServersCallback(ctx context.Context, callback *telegram.CallbackQuery, data callbacks.Data) error {
+	_, servers, err := contextServers(ctx)
+	if err != nil {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, dependencyMessage(h.dependencies, "❌ Внутренняя ошибка", nil, services.DependencyDatabase))
+	}
 
-		// Create inline keyboard with server removal buttons
-		keyboard := createRemoveServerKeyboard(servers)
+	if len(servers) == 0 {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "У вас нет серверов для удаления")
+	}
 
-		message := "Выберите сервер для удаления:\n\n"
-		for _, server := range servers {
-			message += fmt.Sprintf("• %s(%s)\n", server.Name, server.ID)
-		}
-		message += "\nНажмите на сервер который хотите удалить"
+	// Create inline keyboard with server removal buttons
+	keyboard := createRemoveServerKeyboard(servers)
 
-		// Answer callback and send new message
-		if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "Показываю серверы для удаления"); err != nil {
-			h.logger.Error("Failed to answer callback", "error", err)
-		}
+	message := "Выберите сервер для удаления:\n\n"
+	for _, server := range servers {
+		message += fmt.Sprintf("• %s(%s)\n", server.Name, server.ID)
+	}
+	message += "\nНажмите на сервер который хотите удалить"
 
-		return h.telegramSvc.SendMessageWithKeyboard(ctx, callback.Message.Chat.ID, message, keyboard)
+	// Answer callback and send new message
+	if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "Показываю серверы для удаления"); err != nil {
+		h.logger.Error("Failed to answer callback", "error", err)
 	}
 
-	return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Внутренняя ошибка сервиса")
+	return h.telegramSvc.SendMessageWithKeyboard(ctx, callback.Message.Chat.ID, message, keyboard)
 }
 
 // handleRemoveServerCallback handles remove server callback
-func (h *DefaultUpdateHandler) handleRemoveServerCallback(ctx context.Context, callback *telegram.CallbackQuery) error {
-	serverID := callback.Data[14:] // Remove "remove_server:" prefix
+func (h *DefaultUpdateHandler) handleRemoveServerCallback(ctx context.Context, callback *telegram.CallbackQuery, data callbacks.Data) error {
+	serverID := data.Param(0)
 
-	// Get user from database to get correct user_id
+	// Remove the server using UserServiceAdapter
 	if adapter, ok := h.userService.(*services.UserServiceAdapter); ok {
-		user, err := adapter.GetUser(ctx, callback.From.ID)
+		user, servers, err := contextServers(ctx)
 		if err != nil {
-			h.logger.Error("Failed to get user", "error", err, "telegram_id", callback.From.ID)
 			return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Внутренняя ошибка")
 		}
 
-		servers, err := adapter.GetUserServers(ctx, int64(user.ID))
-		if err != nil {
-			h.logger.Error("Failed to get user servers", "error", err, "user_id", user.ID)
-			return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Ошибка получения серверов")
-		}
-
-		// Find server name for better messaging
-		var serverName string
-		for _, server := range servers {
-			if server.ID == serverID {
-				serverName = server.Name
-				break
-			}
-		}
-
-		// If not found, use serverID as fallback
-		if serverName == "" {
-			serverName = serverID
+		// Find server name for better messaging, falling back to its ID
+		serverName := serverID
+		if server := mapping.ServerByID(servers, serverID); server != nil && server.Name != "" {
+			serverName = server.Name
 		}
 
 		// Remove server from user
-		if err := adapter.RemoveServerFromUser(ctx, int64(user.ID), serverID); err != nil {
+		started := time.Now()
+		err = adapter.RemoveServerFromUser(ctx, mapping.UserID(user), serverID)
+		h.auditService.RecordResult(ctx, mapping.UserID(user), callback.From.ID, serverID, services.AuditCommandRemoveServer, "", "", started, err)
+		if err != nil {
 			h.logger.Error("Failed to remove server", "error", err, "server_id", serverID, "user_id", user.ID)
 			return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Не удалось удалить сервер")
 		}
@@ -694,187 +1155,199 @@ func (h *DefaultUpdateHandler) handleRemoveServerCallback(ctx context.Context, c
 }
 
 // handleShowRenameServersCallback handles show rename servers callback
-func (h *DefaultUpdateHandler) handleShowRenameServersCallback(ctx context.Context, callback *telegram.CallbackQuery) error {
-	// Get user servers using UserServiceAdapter
-	if adapter, ok := h.userService.(*services.UserServiceAdapter); ok {
-		// Get user from database to get correct user_id
-		user, err := adapter.GetUser(ctx, callback.From.ID)
-		if err != nil {
-			h.logger.Error("Failed to get user", "error", err, "telegram_id", callback.From.ID)
-			return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Внутренняя ошибка")
-		}
-
-		servers, err := adapter.GetUserServers(ctx, int64(user.ID))
-		if err != nil {
-			h.logger.Error("Failed to get user servers", "error", err, "user_id", user.ID)
-			return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Ошибка получения серверов")
-		}
-
-		if len(servers) == 0 {
-			return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "У вас нет серверов для переименования")
-		}
+func (h *DefaultUpdateHandler) handleShowRenameServersCallback(ctx context.Context, callback *telegram.CallbackQuery, data callbacks.Data) error {
+	_, servers, err := contextServers(ctx)
+	if err != nil {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Внутренняя ошибка")
+	}
 
-		// Create inline keyboard with server rename buttons
-		keyboard := createRenameServerKeyboard(servers)
+	if len(servers) == 0 {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "У вас нет серверов для переименования")
+	}
 
-		message := "Выберите сервер для переименования:\n\n"
-		for _, server := range servers {
-			message += fmt.Sprintf("• %s(%s)\n", server.Name, server.ID)
-		}
-		message += "\nНажмите на сервер который хотите переименовать"
+	// Create inline keyboard with server rename buttons
+	keyboard := createRenameServerKeyboard(servers)
 
-		// Answer callback and send new message
-		if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "Показываю серверы для переименования"); err != nil {
-			h.logger.Error("Failed to answer callback", "error", err)
-		}
+	message := "Выберите сервер для переименования:\n\n"
+	for _, server := range servers {
+		message += fmt.Sprintf("• %s(%s)\n", server.Name, server.ID)
+	}
+	message += "\nНажмите на сервер который хотите переименовать"
 
-		return h.telegramSvc.SendMessageWithKeyboard(ctx, callback.Message.Chat.ID, message, keyboard)
+	// Answer callback and send new message
+	if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "Показываю серверы для переименования"); err != nil {
+		h.logger.Error("Failed to answer callback", "error", err)
 	}
 
-	return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Внутренняя ошибка сервиса")
+	return h.telegramSvc.SendMessageWithKeyboard(ctx, callback.Message.Chat.ID, message, keyboard)
 }
 
 // handleRenameServerCallback handles server rename callback
-func (h *DefaultUpdateHandler) handleRenameServerCallback(ctx context.Context, callback *telegram.CallbackQuery) error {
-	serverID := callback.Data[14:] // Remove "rename_server:" prefix
-
-	// Get user from database to get correct user_id
-	if adapter, ok := h.userService.(*services.UserServiceAdapter); ok {
-		user, err := adapter.GetUser(ctx, callback.From.ID)
-		if err != nil {
-			h.logger.Error("Failed to get user", "error", err, "telegram_id", callback.From.ID)
-			return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Внутренняя ошибка")
-		}
-
-		servers, err := adapter.GetUserServers(ctx, int64(user.ID))
-		if err != nil {
-			h.logger.Error("Failed to get user servers", "error", err, "user_id", user.ID)
-			return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Ошибка получения серверов")
-		}
+func (h *DefaultUpdateHandler) handleRenameServerCallback(ctx context.Context, callback *telegram.CallbackQuery, data callbacks.Data) error {
+	serverID := data.Param(0)
 
-		// Find the server to rename
-		var serverToRename *models.ServerWithDetails
-		for _, server := range servers {
-			if server.ID == serverID {
-				serverToRename = &server
-				break
-			}
-		}
+	_, servers, err := contextServers(ctx)
+	if err != nil {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Внутренняя ошибка")
+	}
 
-		if serverToRename == nil {
-			return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Сервер не найден")
-		}
+	// Find the server to rename
+	serverToRename := mapping.ServerByID(servers, serverID)
 
-		// Send instructions for renaming
-		message := "📝 *Переименование сервера*\n\n"
-		message += fmt.Sprintf("Текущий сервер: %s(%s)\n\n", serverToRename.Name, serverToRename.ID)
-		message += "🔄 *Отправьте новое имя для этого сервера в следующем сообщении*\n\n"
-		message += "💡 *Пример:* `Мой рабочий сервер`\n\n"
-		message += "❌ *Отмена:* отправьте `/cancel`"
+	if serverToRename == nil {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Сервер не найден")
+	}
+	if !services.Can(serverToRename, services.PermRename) {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "⛔ Переименовать сервер может только его администратор")
+	}
 
-		if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "Ожидаю новое имя сервера"); err != nil {
-			h.logger.Error("Failed to answer callback", "error", err)
-		}
+	// Send instructions for renaming
+	message := "📝 *Переименование сервера*\n\n"
+	message += fmt.Sprintf("Текущий сервер: %s(%s)\n\n", serverToRename.Name, serverToRename.ID)
+	message += "🔄 *Отправьте новое имя для этого сервера в следующем сообщении*\n\n"
+	message += "💡 *Пример:* `Мой рабочий сервер`\n\n"
+	message += "❌ *Отмена:* отправьте `/cancel`"
 
-		return h.telegramSvc.SendMessage(ctx, callback.Message.Chat.ID, message)
+	if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "Ожидаю новое имя сервера"); err != nil {
+		h.logger.Error("Failed to answer callback", "error", err)
 	}
 
-	return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Внутренняя ошибка сервиса")
+	return h.telegramSvc.SendMessage(ctx, callback.Message.Chat.ID, message)
 }
 
 // handleMetricCallback handles metric selection callbacks
-func (h *DefaultUpdateHandler) handleMetricCallback(ctx context.Context, callback *telegram.CallbackQuery) error {
+func (h *DefaultUpdateHandler) handleMetricCallback(ctx context.Context, callback *telegram.CallbackQuery, data callbacks.Data) error {
 	h.logger.Info("handleMetricCallback called", "callback_data", callback.Data)
 
-	// Parse callback data: metric:metric_type:server_id
-	parts := strings.Split(callback.Data, ":")
-	h.logger.Info("Callback parts", "parts", parts, "len", len(parts))
+	// Parse callback data: metric:metric_type:server_id[:json|:refresh][:compact|:verbose]
+	params := data.Params
+	h.logger.Info("Callback parts", "params", params)
 
-	if len(parts) != 3 {
-		h.logger.Error("Invalid callback data format", "parts", parts)
+	if len(params) < 2 || len(params) > 4 {
+		h.logger.Error("Invalid callback data format", "params", params)
 		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неверный формат данных")
 	}
 
-	metricType := parts[1]
-	serverID := parts[2]
+	metricType := params[0]
+	serverID := params[1]
+	var asJSON, refresh bool
+	mode := ""
+	for _, option := range params[2:] {
+		switch option {
+		case "json":
+			asJSON = true
+		case "refresh":
+			refresh = true
+		case metricsCompact, metricsVerbose:
+			mode = option
+		default:
+			h.logger.Error("Invalid callback data format", "params", params)
+			return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неверный формат данных")
+		}
+	}
 
 	h.logger.Info("Parsed callback", "metric_type", metricType, "server_id", serverID)
 
-	// Get user servers
-	if adapter, ok := h.userService.(*services.UserServiceAdapter); ok {
-		user, err := adapter.GetUser(ctx, callback.From.ID)
-		if err != nil {
-			h.logger.Error("Failed to get user", "error", err, "telegram_id", callback.From.ID)
-			return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Внутренняя ошибка")
-		}
+	user, err := contextUser(ctx)
+	if err != nil {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Внутренняя ошибка")
+	}
 
-		servers, err := adapter.GetUserServers(ctx, int64(user.ID))
-		if err != nil {
-			h.logger.Error("Failed to get user servers", "error", err, "user_id", user.ID)
-			return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Ошибка получения серверов")
+	servers, err := chatServers(ctx, h.chatService, callback.From.ID, callback.Message.Chat.ID)
+	if err != nil {
+		h.logger.Error("Failed to get user servers", "error", err, "user_id", user.ID)
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Ошибка получения серверов")
+	}
+
+	// Find the requested server
+	selectedServer := mapping.ServerByID(servers, serverID)
+	if selectedServer == nil {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Сервер не найден")
+	}
+	h.logger.Info("Found server", "server_id", selectedServer.ID, "server_name", selectedServer.Name, "server_key", selectedServer.ServerKey)
+
+	settings, err := h.settingsService.Get(ctx, mapping.UserID(user))
+	if err != nil {
+		h.logger.Warn("Failed to get user settings", "error", err, "user_id", user.ID)
+	}
+	compact := compactOutput(mode, settings)
+
+	// Get metrics for the selected server
+	serverKey := selectedServer.ServerKey
+	h.logger.Info("Using server key", "server_key", serverKey, "server_id", selectedServer.ID)
+	started := time.Now()
+	metrics, fetchedAt, err := h.metricsService.GetCachedMetrics(serverKey, metricType, refresh)
+	if err != nil {
+		h.auditService.RecordResult(ctx, mapping.UserID(user), callback.From.ID, selectedServer.ID, services.AuditCommandMetrics, metricsAuditDetails(metricType, asJSON), "", started, err)
+		h.logger.Error("Failed to get server metrics", "error", err, "server_key", serverKey)
+
+		errorMsg := dependencyMessage(h.dependencies, "❌ Не удалось получить метрики", nil, services.DependencyMetrics)
+		if stderrors.Is(err, errors.ErrServerNotFound) {
+			return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, fmt.Sprintf("❌ Сервер `%s` не найден", serverKey))
+		} else if stderrors.Is(err, errors.ErrAPIUnavailable) {
+			errorMsg = dependencyMessage(h.dependencies, fmt.Sprintf("❌ Не удалось получить метрики для сервера `%s`", serverKey), nil, services.DependencyMetrics)
 		}
 
-		// Find the requested server
-		var selectedServer *models.ServerWithDetails
-		for _, server := range servers {
-			if server.ID == serverID {
-				selectedServer = &server
-				h.logger.Info("Found server", "server_id", server.ID, "server_name", server.Name, "server_key", server.ServerKey)
-				break
-			}
+		// Answer with the last known metrics of an unreachable server, replacing them
+		// when retried
+		lastKnown, fetchedAt := lastKnownMetrics(h.metricsService, h.logger, serverKey)
+		formatted, ok := "", false
+		if lastKnown != nil && !asJSON {
+			formatted, ok = formatMetricOutput(h.metricsService, selectedServer, metricType, &lastKnown.Metrics, compact)
+		}
+		if !ok {
+			return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, errorMsg)
 		}
 
-		if selectedServer == nil {
-			return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Сервер не найден")
+		if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "⚠️ Сервер недоступен, показаны последние известные данные"); err != nil {
+			h.logger.Error("Failed to answer callback", "error", err)
 		}
+		text := withLastKnownAge(formatted, fetchedAt, reportLocation(ctx, h.reportService, mapping.UserID(user)))
+		keyboard := retryMetricsKeyboard(metricType, selectedServer.ID, mode)
+		if refresh {
+			return h.telegramSvc.EditMarkdown(ctx, callback.Message.Chat.ID, callback.Message.MessageID, text, keyboard)
+		}
+		return h.telegramSvc.SendMarkdown(ctx, callback.Message.Chat.ID, text, keyboard)
+	}
 
-		// Get metrics for the selected server
-		serverKey := selectedServer.ServerKey
-		h.logger.Info("Using server key", "server_key", serverKey, "server_id", selectedServer.ID)
-		metrics, err := h.metricsService.GetServerMetrics(serverKey)
+	if asJSON {
+		data, err := h.metricsService.MarshalMetrics(selectedServer, metricType, &metrics.Metrics, fetchedAt)
 		if err != nil {
-			h.logger.Error("Failed to get server metrics", "error", err, "server_key", serverKey)
-
-			errorMsg := "❌ Не удалось получить метрики"
-			if strings.Contains(err.Error(), "not found") {
-				errorMsg = fmt.Sprintf("❌ Сервер `%s` не найден", serverKey)
-			} else if strings.Contains(err.Error(), "API error") {
-				errorMsg = fmt.Sprintf("❌ Не удалось получить метрики для сервера `%s`", serverKey)
-			}
-
-			return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, errorMsg)
+			h.logger.Error("Failed to encode metrics", "error", err, "server_id", selectedServer.ID, "type", metricType)
+			return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неизвестный тип метрики")
 		}
+		h.auditService.RecordResult(ctx, mapping.UserID(user), callback.From.ID, selectedServer.ID, services.AuditCommandMetrics, metricsAuditDetails(metricType, true), string(data), started, nil)
 
-		// Format metrics based on type
-		var formattedMetrics string
-		switch metricType {
-		case "cpu":
-			formattedMetrics = h.metricsService.FormatCPU(&metrics.Metrics)
-		case "memory":
-			formattedMetrics = h.metricsService.FormatMemory(&metrics.Metrics)
-		case "disk":
-			formattedMetrics = h.metricsService.FormatDisk(&metrics.Metrics)
-		case "temperature":
-			formattedMetrics = h.metricsService.FormatTemperature(&metrics.Metrics)
-		case "network":
-			formattedMetrics = h.metricsService.FormatNetwork(&metrics.Metrics)
-		case "system":
-			formattedMetrics = h.metricsService.FormatSystem(&metrics.Metrics)
-		case "all":
-			formattedMetrics = h.metricsService.FormatAll(&metrics.Metrics)
-		default:
-			return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неизвестный тип метрики")
+		if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, fmt.Sprintf("JSON %s для %s", metricType, selectedServer.Name)); err != nil {
+			h.logger.Error("Failed to answer callback", "error", err)
 		}
+		return sendMetricsJSON(ctx, h.telegramSvc, callback.Message.Chat.ID, selectedServer, metricType, data, time.Now())
+	}
+
+	// Format metrics based on type
+	formattedMetrics, ok := formatMetricOutput(h.metricsService, selectedServer, metricType, &metrics.Metrics, compact)
+	if !ok {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неизвестный тип метрики")
+	}
+	h.auditService.RecordResult(ctx, mapping.UserID(user), callback.From.ID, selectedServer.ID, services.AuditCommandMetrics, "type="+metricType, render.Plain(formattedMetrics), started, nil)
+
+	text := withMetricsAge(formattedMetrics, fetchedAt)
+	keyboard := refreshMetricsKeyboard(metricType, selectedServer.ID, mode)
 
-		// Answer callback and send metrics
-		if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, fmt.Sprintf("Метрики %s для %s", metricType, selectedServer.Name)); err != nil {
+	// Refreshed metrics replace the message the button belongs to
+	if refresh {
+		if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "🔄 Метрики обновлены"); err != nil {
 			h.logger.Error("Failed to answer callback", "error", err)
 		}
+		return h.telegramSvc.EditMarkdown(ctx, callback.Message.Chat.ID, callback.Message.MessageID, text, keyboard)
+	}
 
-		return h.telegramSvc.SendMessage(ctx, callback.Message.Chat.ID, formattedMetrics)
+	// Answer callback and send metrics
+	if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, fmt.Sprintf("Метрики %s для %s", metricType, selectedServer.Name)); err != nil {
+		h.logger.Error("Failed to answer callback", "error", err)
 	}
 
-	return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Внутренняя ошибка сервиса")
+	return h.telegramSvc.SendMarkdown(ctx, callback.Message.Chat.ID, text, keyboard)
 }
 
 // createRemoveServerKeyboard creates inline keyboard for server removal
@@ -883,10 +1356,7 @@ func createRemoveServerKeyboard(servers []models.ServerWithDetails) interface{}
 
 	for _, server := range servers {
 		button := []map[string]string{
-			{
-				"text":          fmt.Sprintf("Удалить %s(%s)", server.Name, server.ID),
-				"callback_data": fmt.Sprintf("remove_server:%s", server.ID),
-			},
+			removeServerCallback.Button(fmt.Sprintf("Удалить %s(%s)", server.Name, server.ID), server.ID),
 		}
 		buttons = append(buttons, button)
 	}
@@ -899,11 +1369,11 @@ func createRenameServerKeyboard(servers []models.ServerWithDetails) interface{}
 	var buttons [][]map[string]string
 
 	for _, server := range servers {
+		if !services.Can(&server, services.PermRename) {
+			continue
+		}
 		button := []map[string]string{
-			{
-				"text":          fmt.Sprintf("Переименовать %s(%s)", server.Name, server.ID),
-				"callback_data": fmt.Sprintf("rename_server:%s", server.ID),
-			},
+			renameServerCallback.Button(fmt.Sprintf("Переименовать %s(%s)", server.Name, server.ID), server.ID),
 		}
 		buttons = append(buttons, button)
 	}
@@ -918,47 +1388,80 @@ type DefaultCommandRouter struct {
 	userService    domain.UserService
 	serverService  *service.ServerService
 	metricsService *services.MetricsServiceImpl
+	limiter        *ratelimit.Limiter // nil when commands are not rate limited
+	limit          ratelimit.Rule
+	tracer         *tracing.Tracer        // nil unless commands are traced
+	audit          *services.AuditService // nil unless commands are audited
+	metrics        *commandMetrics
+	mu             sync.RWMutex // custom commands are registered while updates are routed
 	commands       map[string]*domain.Command
 }
 
-func NewDefaultCommandRouterNew(log logger.Logger, telegramSvc domain.TelegramService, userService domain.UserService, serverService *service.ServerService, metricsService *services.MetricsServiceImpl) *DefaultCommandRouter {
+func NewDefaultCommandRouterNew(log logger.Logger, telegramSvc domain.TelegramService, userService domain.UserService, serverService *service.ServerService, metricsService *services.MetricsServiceImpl, limiter *ratelimit.Limiter, limit ratelimit.Rule) *DefaultCommandRouter {
 	return &DefaultCommandRouter{
 		logger:         log,
 		telegramSvc:    telegramSvc,
 		userService:    userService,
 		serverService:  serverService,
 		metricsService: metricsService,
+		limiter:        limiter,
+		limit:          limit,
+		metrics:        newCommandMetrics(),
 		commands:       make(map[string]*domain.Command),
 	}
 }
 
 func (r *DefaultCommandRouter) RegisterCommand(cmd *domain.Command) error {
+	r.mu.Lock()
 	r.commands[cmd.Name] = cmd
+	r.mu.Unlock()
+
 	r.logger.WithField("name", cmd.Name).Debug("Command registered")
 	return nil
 }
 
-func (r *DefaultCommandRouter) RouteCommand(ctx context.Context, commandName string, args []string, user *domain.User) error {
+// UnregisterCommand removes a command from the router
+func (r *DefaultCommandRouter) UnregisterCommand(name string) {
+	r.mu.Lock()
+	delete(r.commands, name)
+	r.mu.Unlock()
+
+	r.logger.WithField("name", name).Debug("Command unregistered")
+}
+
+// HasCommand reports whether a command is registered
+func (r *DefaultCommandRouter) HasCommand(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, exists := r.commands[name]
+	return exists
+}
+
+// RouteCommand runs a command of a user sent to a chat, which is the user's private chat
+// or a group chat the bot is a member of. The command runs through the default middleware
+// and then its own.
+func (r *DefaultCommandRouter) RouteCommand(ctx context.Context, commandName string, args []string, user *domain.User, chatID int64) error {
+	r.mu.RLock()
 	cmd, exists := r.commands[commandName]
+	r.mu.RUnlock()
 	if !exists {
-		return r.telegramSvc.SendMessage(ctx, user.TelegramID, fmt.Sprintf("❌ Неизвестная команда: /%s\n\nИспользуйте /help для списка команд.", commandName))
-	}
-
-	// Check permissions
-	if len(cmd.Permissions) > 0 {
-		for _, perm := range cmd.Permissions {
-			if perm == "admin" && !user.IsAdmin {
-				return r.telegramSvc.SendMessage(ctx, user.TelegramID, "Эта команда требует прав администратора")
-			}
+		cmd = &domain.Command{
+			Name: unknownCommandName,
+			Handler: func(ctx context.Context, cmd *domain.Command, args []string) error {
+				return r.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Неизвестная команда: /%s\n\nИспользуйте /help для списка команд.", commandName))
+			},
 		}
 	}
 
 	// Add user info to context
 	ctx = context.WithValue(ctx, userIDKey, user.TelegramID)
-	ctx = context.WithValue(ctx, chatIDKey, user.TelegramID)
+	ctx = context.WithValue(ctx, chatIDKey, chatID)
+	ctx = context.WithValue(ctx, userKey, user)
+	ctx = withAccount(ctx, r.userService, r.logger, user.TelegramID)
 
-	// Execute command
-	return cmd.Handler(ctx, cmd, args)
+	middleware := append(r.defaultMiddleware(), cmd.Middleware...)
+	return chainCommand(cmd.Handler, middleware...)(ctx, cmd, args)
 }
 
 // Helper types and implementations
@@ -1081,8 +1584,10 @@ func (b *Bot) handleAllCommand(ctx context.Context, cmd *domain.Command, args []
 	})
 }
 
-// selectServer handles server selection for metrics commands
-func (b *Bot) selectServer(ctx context.Context, chatID int64, metricType string, servers []models.ServerWithDetails, args []string) (*models.ServerWithDetails, error) {
+// selectServer handles server selection for metrics commands. Without arguments the
+// default server of the user is used when it is among servers. Selection buttons keep
+// the requested output format.
+func (b *Bot) selectServer(ctx context.Context, chatID int64, metricType string, asJSON bool, mode string, servers []models.ServerWithDetails, args []string, defaultServerID string) (*models.ServerWithDetails, error) {
 	// If only one server, use it
 	if len(servers) == 1 {
 		return &servers[0], nil
@@ -1091,94 +1596,133 @@ func (b *Bot) selectServer(ctx context.Context, chatID int64, metricType string,
 	// If server ID provided in arguments, try to find it
 	if len(args) > 0 {
 		serverID := args[0]
-		for _, server := range servers {
-			if server.ID == serverID || server.Name == serverID {
-				return &server, nil
-			}
+		if server := mapping.ServerByIDOrName(servers, serverID); server != nil {
+			return server, nil
 		}
 		return nil, b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Сервер `%s` не найден в вашем списке.", serverID))
 	}
 
+	if defaultServerID != "" {
+		if server := mapping.ServerByID(servers, defaultServerID); server != nil {
+			return server, nil
+		}
+	}
+
 	// Multiple servers and no specific server requested - show selection buttons
 	var keyboard [][]map[string]string
 
 	for _, server := range servers {
-		callbackData := fmt.Sprintf("metric:%s:%s", metricType, server.ID)
-		button := []map[string]string{
-			{
-				"text":          fmt.Sprintf("🖥️ %s(%s)", server.Name, server.ID),
-				"callback_data": callbackData,
-			},
+		params := metricButtonParams(metricType, server.ID, mode)
+		if asJSON {
+			params = metricButtonParams(metricType, server.ID, "json")
 		}
-		keyboard = append(keyboard, button)
-		b.logger.Info("Created button", "server", server.Name, "callback_data", callbackData)
+		button := metricCallback.Button(fmt.Sprintf("🖥️ %s(%s)", server.Name, server.ID), params...)
+		keyboard = append(keyboard, []map[string]string{button})
+		b.logger.Info("Created button", "server", server.Name, "callback_data", button["callback_data"])
 	}
 
 	message := fmt.Sprintf("📊 *Выберите сервер для метрики %s:*", metricType)
+	if metricType == "all" {
+		message += "\n\nСводка по всем серверам: /fleet"
+	}
+	message += "\n\nСервер по умолчанию: /default"
 	b.logger.Info("Sending keyboard message", "servers_count", len(servers), "metric_type", metricType)
 
 	return nil, b.telegramSvc.SendMessageWithKeyboard(ctx, chatID, message, keyboard)
 }
 
-// handleMetricsCommand is a generic handler for metrics commands
+// handleMetricsCommand is a generic handler for metrics commands. With the --json flag
+// the metrics are sent as JSON instead of formatted text, -c and -v choose between one
+// line per metric and the detailed breakdown regardless of the compact setting.
 func (b *Bot) handleMetricsCommand(ctx context.Context, telegramID, chatID int64, metricType string, args []string, formatter func(*domain.ServerMetrics) string) error {
-	b.logger.Info("Getting metrics", "type", metricType, "telegram_id", telegramID, "chat_id", chatID)
+	args, asJSON := jsonFlag(args)
+	args, mode := outputModeFlag(args)
+	b.logger.Info("Getting metrics", "type", metricType, "telegram_id", telegramID, "chat_id", chatID, "json", asJSON, "mode", mode)
 
-	// Get user servers
-	if adapter, ok := b.userService.(*services.UserServiceAdapter); ok {
-		user, err := adapter.GetUser(ctx, telegramID)
-		if err != nil {
-			b.logger.Error("Failed to get user", "error", err, "telegram_id", telegramID)
-			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
-		}
+	user, err := contextUser(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, dependencyMessage(b.dependencyService, "❌ Внутренняя ошибка. Попробуйте позже.", nil, services.DependencyDatabase))
+	}
 
-		servers, err := adapter.GetUserServers(ctx, int64(user.ID))
-		if err != nil {
-			b.logger.Error("Failed to get user servers", "error", err, "user_id", user.ID)
-			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Произошла ошибка при получении списка серверов. Попробуйте позже.")
-		}
+	servers, err := chatServers(ctx, b.chatService, telegramID, chatID)
+	if err != nil {
+		b.logger.Error("Failed to get user servers", "error", err, "user_id", user.ID)
+		return b.telegramSvc.SendMessage(ctx, chatID, dependencyMessage(b.dependencyService, "❌ Произошла ошибка при получении списка серверов. Попробуйте позже.", nil, services.DependencyDatabase))
+	}
 
-		if len(servers) == 0 {
-			return b.telegramSvc.SendMessage(ctx, chatID, "❌ У вас нет добавленных серверов. Используйте /add <server_id> для добавления сервера.")
+	if len(servers) == 0 {
+		if isGroupChat(chatID, telegramID) {
+			return b.telegramSvc.SendMessage(ctx, chatID, services.FormatChatServers(nil))
 		}
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ У вас нет добавленных серверов. Используйте /add <server_id> для добавления сервера.")
+	}
 
-		// Handle server selection
-		server, err := b.selectServer(ctx, chatID, metricType, servers, args)
-		if err != nil {
-			return err
-		}
-		if server == nil {
-			return nil // Server selection message sent
+	// Handle server selection
+	settings := b.userSettings(ctx, mapping.UserID(user))
+	server, err := b.selectServer(ctx, chatID, metricType, asJSON, mode, servers, args, settings.DefaultServerID)
+	if err != nil {
+		return err
+	}
+	if server == nil {
+		return nil // Server selection message sent
+	}
+
+	// Use server key for API calls
+	serverKey := server.ServerKey
+
+	b.logger.Info("Using server for metrics",
+		"server_id", server.ID,
+		"server_name", server.Name,
+		"server_key", serverKey)
+
+	// Metrics in one line for users preferring compact output
+	compact := compactOutput(mode, settings)
+	format := func(metrics *domain.ServerMetrics) string {
+		if compact {
+			if formatted, ok := formatMetricOutput(b.metricsService, server, metricType, metrics, true); ok {
+				return formatted
+			}
 		}
+		return formatter(metrics)
+	}
 
-		// Use server key for API calls
-		serverKey := server.ServerKey
+	// Get metrics
+	started := time.Now()
+	metrics, fetchedAt, err := b.metricsService.GetCachedMetrics(serverKey, metricType, false)
+	if err != nil {
+		b.auditService.RecordResult(ctx, mapping.UserID(user), telegramID, server.ID, services.AuditCommandMetrics, metricsAuditDetails(metricType, asJSON), "", started, err)
+		b.logger.Error("Failed to get server metrics", "error", err, "server_key", serverKey)
 
-		b.logger.Info("Using server for metrics",
-			"server_id", server.ID,
-			"server_name", server.Name,
-			"server_key", serverKey)
+		// Check error type and provide specific message
+		loc := b.userLocation(ctx, mapping.UserID(user))
+		if stderrors.Is(err, errors.ErrServerNotFound) {
+			return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Сервер `%s` не найден.", server.ID))
+		}
 
-		// Get metrics
-		metrics, err := b.metricsService.GetServerMetrics(serverKey)
-		if err != nil {
-			b.logger.Error("Failed to get server metrics", "error", err, "server_key", serverKey)
+		// Answer with the last known metrics of an unreachable server
+		if lastKnown, fetchedAt := lastKnownMetrics(b.metricsService, b.logger, serverKey); lastKnown != nil && !asJSON {
+			return b.telegramSvc.SendMarkdown(ctx, chatID, withLastKnownAge(format(&lastKnown.Metrics), fetchedAt, loc), retryMetricsKeyboard(metricType, server.ID, mode))
+		}
 
-			// Check error type and provide specific message
-			errorMsg := err.Error()
-			if strings.Contains(errorMsg, "not found") {
-				return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Сервер `%s` не найден.", serverKey))
-			} else if strings.Contains(errorMsg, "API error") {
-				return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Не удалось получить метрики для сервера `%s`. Попробуйте позже.", serverKey))
-			} else {
-				return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось получить метрики. Попробуйте позже.")
-			}
+		if stderrors.Is(err, errors.ErrAPIUnavailable) {
+			return b.telegramSvc.SendMessage(ctx, chatID, dependencyMessage(b.dependencyService, fmt.Sprintf("❌ Не удалось получить метрики для сервера `%s`. Попробуйте позже.", server.ID), loc, services.DependencyMetrics))
+		} else {
+			return b.telegramSvc.SendMessage(ctx, chatID, dependencyMessage(b.dependencyService, "❌ Не удалось получить метрики. Попробуйте позже.", loc, services.DependencyMetrics))
 		}
+	}
 
-		// Format and send metrics
-		formattedMetrics := formatter(&metrics.Metrics)
-		return b.telegramSvc.SendMessage(ctx, chatID, formattedMetrics)
+	if asJSON {
+		data, err := b.metricsService.MarshalMetrics(server, metricType, &metrics.Metrics, fetchedAt)
+		if err != nil {
+			b.logger.Error("Failed to encode metrics", "error", err, "server_id", server.ID, "type", metricType)
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось подготовить JSON. Попробуйте позже.")
+		}
+		b.auditService.RecordResult(ctx, mapping.UserID(user), telegramID, server.ID, services.AuditCommandMetrics, metricsAuditDetails(metricType, true), string(data), started, nil)
+		return sendMetricsJSON(ctx, b.telegramSvc, chatID, server, metricType, data, time.Now())
 	}
 
-	return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка сервиса. Попробуйте позже.")
+	// Format and send metrics
+	formattedMetrics := format(&metrics.Metrics)
+	b.auditService.RecordResult(ctx, mapping.UserID(user), telegramID, server.ID, services.AuditCommandMetrics, "type="+metricType, render.Plain(formattedMetrics), started, nil)
+	return b.telegramSvc.SendMarkdown(ctx, chatID, withMetricsAge(formattedMetrics, fetchedAt), refreshMetricsKeyboard(metricType, server.ID, mode))
 }
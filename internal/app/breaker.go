@@ -0,0 +1,36 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/agentconn"
+	"github.com/servereye/servereyebot/internal/api"
+	"github.com/servereye/servereyebot/pkg/docker"
+)
+
+// agentProbe returns a probe telling whether the agent of a server is reachable: over its
+// connection when it keeps one, through the status reported by the API otherwise
+func agentProbe(apiClient *api.Client, hub *agentconn.Hub) docker.Prober {
+	return func(ctx context.Context, serverKey string) error {
+		if hub != nil && hub.Connected(serverKey) {
+			return nil
+		}
+		status, err := apiClient.GetServerStatus(ctx, serverKey)
+		if err != nil {
+			return err
+		}
+		if !status.Online {
+			return fmt.Errorf("agent is offline, last seen %s", status.LastSeen)
+		}
+		return nil
+	}
+}
+
+// runAgentProbes is a scheduler job probing servers that appear offline, so that commands
+// to them resume as soon as their agent is back
+func (b *Bot) runAgentProbes(ctx context.Context, now time.Time) error {
+	b.agentBreaker.Probe(ctx)
+	return nil
+}
@@ -0,0 +1,53 @@
+package app
+
+import (
+	"github.com/servereye/servereyebot/internal/callbacks"
+	"github.com/servereye/servereyebot/internal/services"
+)
+
+// Actions of inline keyboard buttons. Raise the version of an action when the meaning
+// of its parameters changes, so that buttons of older messages are rejected.
+var (
+	showRemoveServersCallback = callbacks.NewAction("show_remove_servers", 0)
+	showRenameServersCallback = callbacks.NewAction("show_rename_servers", 0)
+	removeServerCallback      = callbacks.NewAction("remove_server", 0) // server_id
+	renameServerCallback      = callbacks.NewAction("rename_server", 0) // server_id
+	metricCallback            = callbacks.NewAction("metric", 0)        // type, server_id[, json|refresh]
+	logsCallback              = callbacks.NewAction("logs", 0)          // server_id, container, lines
+	containerStatsCallback    = callbacks.NewAction("cstats", 0)        // new|edit, server_id
+	topProcessesCallback      = callbacks.NewAction("ptop", 0)          // cpu|mem, limit, server_id
+	imagesCallback            = callbacks.NewAction("img", 0)           // action, server_id[, image_id]
+	composeCallback           = callbacks.NewAction("cmp", 0)           // action, server_id[, project]
+	updatesCallback           = callbacks.NewAction("upd", 0)           // action, server_id
+	firewallCallback          = callbacks.NewAction("fw", 0)            // action, server_id[, address|block_id]
+	vmsCallback               = callbacks.NewAction("vm", 0)            // action, server_id[, vm_id]
+	powerCallback             = callbacks.NewAction("pwr", 0)           // ok|no, server_id, token
+	defaultServerCallback     = callbacks.NewAction("dflt", 0)          // set, server_id or off
+	settingsCallback          = callbacks.NewAction("stg", 0)           // section[, value]
+	liveCallback              = callbacks.NewAction("live", 0)          // stop
+	cancelCallback            = callbacks.NewAction("cnl", 0)           // operation_id
+)
+
+// registerCallbacks routes the actions of inline keyboard buttons to their handlers
+func (h *DefaultUpdateHandler) registerCallbacks() {
+	h.callbacks = callbacks.NewRegistry()
+	h.callbacks.Handle(showRemoveServersCallback, h.handleShowRemoveServersCallback)
+	h.callbacks.Handle(showRenameServersCallback, h.handleShowRenameServersCallback)
+	h.callbacks.Handle(removeServerCallback, h.handleRemoveServerCallback)
+	h.callbacks.Handle(renameServerCallback, h.handleRenameServerCallback)
+	h.callbacks.Handle(metricCallback, h.handleMetricCallback)
+	h.callbacks.Handle(logsCallback, h.handleLogsCallback)
+	h.callbacks.Handle(containerStatsCallback, h.handleContainerStatsCallback)
+	h.callbacks.Handle(topProcessesCallback, h.handleTopProcessesCallback)
+	h.callbacks.Handle(imagesCallback, h.handleImagesCallback)
+	h.callbacks.Handle(composeCallback, h.handleComposeCallback)
+	h.callbacks.Handle(updatesCallback, h.handleUpdatesCallback)
+	h.callbacks.Handle(firewallCallback, h.handleFirewallCallback)
+	h.callbacks.Handle(vmsCallback, h.handleVMsCallback)
+	h.callbacks.Handle(powerCallback, h.handlePowerCallback)
+	h.callbacks.Handle(defaultServerCallback, h.handleDefaultServerCallback)
+	h.callbacks.Handle(services.ProcessWatchCallback, h.handleProcessWatchCallback)
+	h.callbacks.Handle(settingsCallback, h.handleSettingsCallback)
+	h.callbacks.Handle(liveCallback, h.handleLiveCallback)
+	h.callbacks.Handle(cancelCallback, h.handleCancelCallback)
+}
@@ -0,0 +1,63 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/httpserver"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// maxCertificateRequestSize limits the body of an agent certificate request
+const maxCertificateRequestSize = 16384
+
+// certificateRequest represents the body of an agent certificate request
+type certificateRequest struct {
+	CSR string `json:"csr"` // PEM encoded certificate request of the agent's key
+}
+
+// certificateResponse represents the reply to an agent certificate request
+type certificateResponse struct {
+	Status        string    `json:"status"`
+	Certificate   string    `json:"certificate,omitempty"`    // PEM encoded client certificate
+	CACertificate string    `json:"ca_certificate,omitempty"` // PEM encoded client CA
+	ExpiresAt     time.Time `json:"expires_at,omitempty"`
+}
+
+// handleCertificateRequest issues a client certificate bound to the server key of an
+// authenticated agent. Agents renew their certificate here before it expires, and
+// request a new one after switching to a rotated key.
+func (b *Bot) handleCertificateRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpserver.MethodNotAllowed(w, r)
+		return
+	}
+
+	if b.certIssuer == nil {
+		httpserver.WriteError(w, r, http.StatusServiceUnavailable, errors.ErrCodeUnavailable, "client certificates are not configured")
+		return
+	}
+
+	var req certificateRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCertificateRequestSize)).Decode(&req); err != nil || req.CSR == "" {
+		httpserver.WriteError(w, r, http.StatusBadRequest, errors.ErrCodeInvalidInput, "invalid request body")
+		return
+	}
+
+	serverKey, _ := httpserver.AgentKey(r.Context())
+	cert, expiresAt, err := b.certIssuer.Issue([]byte(req.CSR), serverKey, time.Now())
+	if err != nil {
+		httpserver.RequestLogger(b.logger, r).Warn("Failed to issue client certificate", "error", err, "remote_addr", r.RemoteAddr)
+		httpserver.WriteError(w, r, http.StatusBadRequest, errors.ErrCodeInvalidInput, err.Error())
+		return
+	}
+
+	b.logger.Info("Issued client certificate", "expires_at", expiresAt)
+	writeAgentResponse(w, http.StatusOK, certificateResponse{
+		Status:        "issued",
+		Certificate:   string(cert),
+		CACertificate: string(b.certIssuer.CACertificatePEM()),
+		ExpiresAt:     expiresAt,
+	})
+}
@@ -0,0 +1,44 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/servereye/servereyebot/internal/cluster"
+	"github.com/servereye/servereyebot/internal/config"
+)
+
+// newClusterStore connects to the Redis store coordinating replicas. Unlike caches it has
+// no fallback: uncoordinated replicas would handle every update and job more than once.
+func newClusterStore(cfg *config.Config) (*cluster.RedisStore, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Redis.DialTimeout)
+	defer cancel()
+
+	return cluster.NewRedisStore(ctx, cluster.RedisOptions{
+		Addr:         fmt.Sprintf("%s:%d", cfg.Redis.Host, cfg.Redis.Port),
+		Password:     cfg.Redis.Password,
+		Database:     cfg.Redis.Database,
+		PoolSize:     cfg.Redis.PoolSize,
+		DialTimeout:  cfg.Redis.DialTimeout,
+		ReadTimeout:  cfg.Redis.ReadTimeout,
+		WriteTimeout: cfg.Redis.WriteTimeout,
+		Prefix:       "servereyebot:cluster:",
+	})
+}
+
+// claimUpdate claims a Telegram update for this replica in the cluster store
+func (b *Bot) claimUpdate(ctx context.Context, updateID int) (bool, error) {
+	return b.clusterStore.Claim(ctx, fmt.Sprintf("update:%d", updateID), b.config.Cluster.UpdateTTL)
+}
+
+// lead starts the work done by a single replica: polling Telegram and running scheduled
+// jobs. Both stop when ctx is done.
+func (b *Bot) lead(ctx context.Context) {
+	if b.config.Scheduler.Enabled {
+		b.scheduler.Start(ctx)
+	}
+
+	if err := b.telegramSvc.StartReceivingUpdates(ctx, b.updateHandler); err != nil {
+		b.logger.Error("Failed to start receiving updates", "error", err)
+	}
+}
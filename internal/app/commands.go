@@ -0,0 +1,565 @@
+package app
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// builtinCommands returns the commands of the bot. The list is the single source of the
+// command router, the Telegram command menu and /help, so they cannot drift apart.
+func (b *Bot) builtinCommands() []*domain.Command {
+	return []*domain.Command{
+		{
+			Name:        "start",
+			Description: "Start bot and show welcome message",
+			Handler:     b.handleStartCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "help",
+			Description: "Show available commands",
+			Handler:     b.handleHelpCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "servers",
+			Description: "List your servers",
+			Handler:     b.handleServersCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "pair",
+			Description: "Get a one-time code to link a new server",
+			Handler:     b.handlePairCommand,
+			Permissions: []string{permissionPrivate},
+		},
+		{
+			Name:        "link",
+			Description: "Link your ServerEye-Web account",
+			Handler:     b.handleLinkCommand,
+			Permissions: []string{permissionPrivate},
+		},
+		{
+			Name:        "rotatekey",
+			Description: "Rotate the agent key of a server",
+			Handler:     b.handleRotateKeyCommand,
+			Permissions: []string{permissionPrivate},
+		},
+		{
+			Name:        "update",
+			Description: "Update the agent of a server",
+			Handler:     b.handleUpdateCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "tag",
+			Description: "Tag servers sharing infrastructure",
+			Handler:     b.handleTagCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "notify",
+			Description: "Send alerts and reports to Slack, Discord, email or webhooks",
+			Handler:     b.handleNotifyCommand,
+			Permissions: []string{permissionPrivate},
+		},
+		{
+			Name:        "bind",
+			Description: "Attach servers to a group chat",
+			Handler:     b.handleBindCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "unbind",
+			Description: "Detach a server from a group chat",
+			Handler:     b.handleUnbindCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "rename",
+			Description: "Rename a server",
+			Handler:     b.handleRenameCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "syncnames",
+			Description: "Name servers after their agent hostnames",
+			Handler:     b.handleSyncNamesCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "add",
+			Description: "Add server to monitor",
+			Handler:     b.handleAddServerCommand,
+			Permissions: []string{permissionPrivate},
+		},
+		{
+			Name:        "cpu",
+			Description: "Show CPU metrics",
+			Handler:     b.handleCPUCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "memory",
+			Description: "Show memory metrics",
+			Handler:     b.handleMemoryCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "disk",
+			Description: "Show disk metrics",
+			Handler:     b.handleDiskCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "temp",
+			Description: "Show temperature metrics",
+			Handler:     b.handleTempCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "network",
+			Description: "Show network metrics",
+			Handler:     b.handleNetworkCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "system",
+			Description: "Show system information",
+			Handler:     b.handleSystemCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "all",
+			Description: "Show all metrics summary",
+			Handler:     b.handleAllCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "live",
+			Description: "Show metrics refreshed in place for a few minutes",
+			Handler:     b.handleLiveCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "fleet",
+			Description: "Show a summary of all servers",
+			Handler:     b.handleFleetCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "settings",
+			Description: "Change your language, alerts and output preferences",
+			Handler:     b.handleSettingsCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "default",
+			Description: "Set the server metric commands use by default",
+			Handler:     b.handleDefaultCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "top",
+			Description: "Show top processes or metric peaks",
+			Handler:     b.handleTopCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "window",
+			Description: "Hold alerts during planned deployment windows",
+			Handler:     b.handleWindowCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "maintenance",
+			Description: "Declare a maintenance window for a server",
+			Handler:     b.handleMaintenanceCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "watch",
+			Description: "Alert when a process stops running",
+			Handler:     b.handleWatchCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "checks",
+			Description: "Show Nagios and Zabbix check results",
+			Handler:     b.handleChecksCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "report",
+			Description: "Configure scheduled server reports",
+			Handler:     b.handleReportCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "audit",
+			Description: "Show latest actions on your servers",
+			Handler:     b.handleAuditCommand,
+			Permissions: []string{permissionPrivate},
+		},
+		{
+			Name:        "logs",
+			Description: "Show container logs",
+			Handler:     b.handleLogsCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "containerstats",
+			Description: "Show container resource usage",
+			Handler:     b.handleContainerStatsCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "images",
+			Description: "Manage Docker images",
+			Handler:     b.handleImagesCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "compose",
+			Description: "Manage Docker Compose projects",
+			Handler:     b.handleComposeCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "pods",
+			Description: "Show Kubernetes nodes and pods",
+			Handler:     b.handlePodsCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "vms",
+			Description: "Manage Proxmox and libvirt virtual machines",
+			Handler:     b.handleVMsCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "restartpolicy",
+			Description: "Stop restarting flapping containers",
+			Handler:     b.handleRestartPolicyCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "logwatch",
+			Description: "Alert on log lines matching a pattern",
+			Handler:     b.handleLogWatchCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "ls",
+			Description: "List a directory on a server",
+			Handler:     b.handleLsCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "cat",
+			Description: "Show a file on a server",
+			Handler:     b.handleCatCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "du",
+			Description: "Show the largest directories on a server",
+			Handler:     b.handleDuCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "command",
+			Description: "Manage custom commands running server scripts",
+			Handler:     b.handleCustomCommandsCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "cancel",
+			Description: "Cancel the commands still waiting for a server agent",
+			Handler:     b.handleCancelCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "pending",
+			Description: "Show commands waiting for a server agent",
+			Handler:     b.handlePendingCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "smart",
+			Description: "Show the SMART health of server drives",
+			Handler:     b.handleSMARTCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "gpu",
+			Description: "Show GPU utilization, memory, temperature and power",
+			Handler:     b.handleGPUCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "backups",
+			Description: "Show the restic and borg backups of a server",
+			Handler:     b.handleBackupsCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "ports",
+			Description: "Show listening ports and their processes",
+			Handler:     b.handlePortsCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "connections",
+			Description: "Show established connections per remote IP",
+			Handler:     b.handleConnectionsCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "firewall",
+			Description: "Show firewall rules and block addresses",
+			Handler:     b.handleFirewallCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "speedtest",
+			Description: "Test the bandwidth of a server",
+			Handler:     b.handleSpeedtestCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "reboot",
+			Description: "Reboot a server",
+			Handler:     b.handleRebootCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "shutdown",
+			Description: "Shut down a server",
+			Handler:     b.handleShutdownCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "updates",
+			Description: "Show pending package and security updates",
+			Handler:     b.handleUpdatesCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "route",
+			Description: "Route alerts of a category to a chat",
+			Handler:     b.handleRouteCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "check",
+			Description: "Manage uptime checks of websites and ports",
+			Handler:     b.handleCheckCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "guest",
+			Description: "Give temporary read access to a server",
+			Handler:     b.handleGuestCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "export",
+			Description: "Download your data as JSON or CSV",
+			Handler:     b.handleExportCommand,
+			Permissions: []string{permissionPrivate},
+		},
+		{
+			Name:        "forgetme",
+			Description: "Delete your data and servers",
+			Handler:     b.handleForgetMeCommand,
+			Permissions: []string{permissionPrivate},
+		},
+		{
+			Name:        "replay",
+			Description: "Replay a recorded agent command in debug mode",
+			Handler:     b.handleReplayCommand,
+			Permissions: []string{"admin"},
+		},
+		{
+			Name:        "exec",
+			Description: "Run an allow-listed shell command on a server",
+			Handler:     b.handleExecCommand,
+			Permissions: []string{"admin"},
+		},
+		{
+			Name:        "sshkey",
+			Description: "Push an SSH public key to a server",
+			Handler:     b.handleSSHKeyCommand,
+			Permissions: []string{},
+		},
+		{
+			Name:        "dashboard",
+			Description: "Show bot SLO, error budgets and dependency health",
+			Handler:     b.handleDashboardCommand,
+			Permissions: []string{"admin"},
+		},
+		{
+			Name:        "broadcast",
+			Description: "Send an announcement to all users",
+			Handler:     b.handleBroadcastCommand,
+			Permissions: []string{"admin"},
+		},
+		{
+			Name:        "users",
+			Description: "Show user registration and activity stats",
+			Handler:     b.handleUsersCommand,
+			Permissions: []string{"admin"},
+		},
+		{
+			Name:        "fleetstats",
+			Description: "Show online servers, agent versions and OS distribution",
+			Handler:     b.handleFleetStatsCommand,
+			Permissions: []string{"admin"},
+		},
+		{
+			Name:        "admin",
+			Description: "Bot administration: reload the configuration",
+			Handler:     b.handleAdminCommand,
+			Permissions: []string{"admin"},
+		},
+		{
+			Name:        "flags",
+			Description: "List and flip feature flags",
+			Handler:     b.handleFlagsCommand,
+			Permissions: []string{"admin"},
+		},
+	}
+}
+
+// registerCommands registers the built-in commands with the command router
+func (b *Bot) registerCommands() error {
+	b.commands = b.builtinCommands()
+	for _, cmd := range b.commands {
+		if err := b.commandRouter.RegisterCommand(cmd); err != nil {
+			return errors.NewInternalError("failed to register command", err)
+		}
+	}
+
+	return nil
+}
+
+// requiresAdmin reports whether only admins may run a command
+func requiresAdmin(cmd *domain.Command) bool {
+	for _, perm := range cmd.Permissions {
+		if perm == "admin" {
+			return true
+		}
+	}
+	return false
+}
+
+// menuCommands returns the Telegram command menu. The menu is the same for every user,
+// so admin commands are left out of it.
+func menuCommands(commands []*domain.Command) []domain.BotCommand {
+	menu := make([]domain.BotCommand, 0, len(commands))
+	for _, cmd := range commands {
+		if requiresAdmin(cmd) {
+			continue
+		}
+		menu = append(menu, domain.BotCommand{Command: cmd.Name, Description: cmd.Description})
+	}
+	return menu
+}
+
+// visibleCommands returns the commands of a user by name, all but the admin commands
+// unless the user is an admin
+func visibleCommands(commands []*domain.Command, isAdmin bool) map[string]*domain.Command {
+	visible := make(map[string]*domain.Command, len(commands))
+	for _, cmd := range commands {
+		if isAdmin || !requiresAdmin(cmd) {
+			visible[cmd.Name] = cmd
+		}
+	}
+	return visible
+}
+
+// commandLineName returns the command a line of a help or welcome text describes, such
+// as "cpu" for "• /cpu [server_id] - CPU load"
+func commandLineName(line string) (string, bool) {
+	line = strings.TrimPrefix(strings.TrimSpace(line), "• ")
+	if !strings.HasPrefix(line, "/") {
+		return "", false
+	}
+	name := strings.TrimPrefix(line, "/")
+	if i := strings.IndexFunc(name, func(r rune) bool { return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_') }); i >= 0 {
+		name = name[:i]
+	}
+	return name, name != ""
+}
+
+// filterCommandLines removes the lines of a text describing commands a user cannot run,
+// along with sections left without commands. It returns the names of the commands kept.
+func filterCommandLines(text string, visible map[string]*domain.Command) (string, map[string]bool) {
+	described := make(map[string]bool)
+	blocks := strings.Split(text, "\n\n")
+	kept := blocks[:0]
+	for _, block := range blocks {
+		var lines []string
+		commandLines, removed := 0, 0
+		for _, line := range strings.Split(block, "\n") {
+			if name, ok := commandLineName(line); ok {
+				commandLines++
+				if visible[name] == nil {
+					removed++
+					continue
+				}
+				described[name] = true
+			}
+			lines = append(lines, line)
+		}
+		if commandLines > 0 && removed == commandLines {
+			continue
+		}
+		kept = append(kept, strings.Join(lines, "\n"))
+	}
+	return strings.Join(kept, "\n\n"), described
+}
+
+// helpText returns /help for a user from the branded help in their language. Commands
+// the user cannot run are left out and commands the help does not describe yet are
+// listed with their menu description.
+func (b *Bot) helpText(ctx context.Context, telegramID int64) string {
+	language := b.telegramUserSettings(ctx, telegramID).Language
+	visible := visibleCommands(b.commands, b.userService.IsAdmin(telegramID))
+	help, described := filterCommandLines(b.branding.HelpIn(language), visible)
+
+	var missing []string
+	for name := range visible {
+		if !described[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == 0 {
+		return help
+	}
+	sort.Strings(missing)
+
+	var sb strings.Builder
+	sb.WriteString(b.branding.OtherCommandsIn(language))
+	for _, name := range missing {
+		sb.WriteString("\n• /" + name + " - " + visible[name].Description)
+	}
+
+	// The other commands go before the closing support line
+	if i := strings.LastIndex(help, "\n\n"); i >= 0 {
+		return help[:i] + "\n\n" + sb.String() + help[i:]
+	}
+	return help + "\n\n" + sb.String()
+}
+
+// welcomeText returns the reply to /start for a user, without the commands they cannot run
+func (b *Bot) welcomeText(ctx context.Context, telegramID int64) string {
+	language := b.telegramUserSettings(ctx, telegramID).Language
+	welcome, _ := filterCommandLines(b.branding.WelcomeIn(language), visibleCommands(b.commands, b.userService.IsAdmin(telegramID)))
+	return welcome
+}
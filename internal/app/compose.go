@@ -0,0 +1,253 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/servereye/servereyebot/internal/callbacks"
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/internal/telegram"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// composeUsage is shown when /compose arguments cannot be parsed
+const composeUsage = `📦 *Compose-проекты*
+
+/compose [server_id] - Проекты и состояние их сервисов
+/compose [server_id] up <project> - Поднять проект
+/compose [server_id] restart <project> - Перезапустить проект
+/compose [server_id] down <project> - Остановить проект`
+
+// composeNameTooLongMessage is shown for projects whose down cannot fit in a button
+const composeNameTooLongMessage = "❌ Слишком длинное имя проекта для подтверждения."
+
+// handleComposeCommand lists compose projects and runs up/down/restart on them
+func (b *Bot) handleComposeCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+
+	if len(servers) == 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ У вас нет добавленных серверов. Используйте /add <server_id> для добавления сервера.")
+	}
+
+	server, args := resolveServerArg(servers, args)
+	if server == nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите сервер.\n\n"+composeUsage)
+	}
+
+	if len(args) == 0 {
+		text, keyboard := fetchComposeMessage(ctx, b.containerService, mapping.UserID(user), telegramID, server)
+		if keyboard == nil {
+			return b.telegramSvc.SendMessage(ctx, chatID, text)
+		}
+		return b.telegramSvc.SendMessageWithKeyboard(ctx, chatID, text, keyboard)
+	}
+
+	action, ok := parseComposeAction(args[0])
+	if !ok || len(args) < 2 {
+		return b.telegramSvc.SendMessage(ctx, chatID, composeUsage)
+	}
+	project := args[1]
+
+	if action == protocol.ComposeDown {
+		keyboard, err := createComposeDownConfirmKeyboard(server.ID, project)
+		if err != nil {
+			return b.telegramSvc.SendMessage(ctx, chatID, composeNameTooLongMessage)
+		}
+		return b.telegramSvc.SendMessageWithKeyboard(ctx, chatID,
+			fmt.Sprintf("⏹ Остановить проект %s на %s(%s)?", project, server.Name, server.ID), keyboard)
+	}
+
+	// Compose operations outlive the update processing timeout, so report the result separately
+	actionCtx, operationID := trackOperation(ctx, telegramID, composeOperationLabel(server, project, action))
+	if err := b.telegramSvc.SendMessageWithKeyboard(ctx, chatID, composeProgressMessage(server, project, action), createCancelKeyboard(operationID)); err != nil {
+		return err
+	}
+
+	go func() {
+		text := composeActionMessage(actionCtx, b.containerService, mapping.UserID(user), telegramID, server, project, action)
+		if text == "" {
+			return
+		}
+		if err := b.telegramSvc.SendMessage(actionCtx, chatID, text); err != nil {
+			b.logger.Error("Failed to send compose result", "error", err, "project", project)
+		}
+	}()
+	return nil
+}
+
+// handleComposeCallback handles compose project buttons
+func (h *DefaultUpdateHandler) handleComposeCallback(ctx context.Context, callback *telegram.CallbackQuery, data callbacks.Data) error {
+	// Parse callback data: cmp:action:server_id[:project]
+	params := data.Params
+	if len(params) < 2 {
+		h.logger.Error("Invalid callback data format", "params", params)
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неверный формат данных")
+	}
+
+	action, serverID := params[0], params[1]
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Внутренняя ошибка")
+	}
+
+	server := mapping.ServerByID(servers, serverID)
+	if server == nil {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Сервер не найден")
+	}
+
+	chatID := callback.Message.Chat.ID
+	messageID := callback.Message.MessageID
+
+	if action == "list" {
+		if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "Обновляю проекты"); err != nil {
+			h.logger.Error("Failed to answer callback", "error", err)
+		}
+		text, keyboard := fetchComposeMessage(ctx, h.containerService, mapping.UserID(user), callback.From.ID, server)
+		return h.telegramSvc.EditMessage(ctx, chatID, messageID, text, keyboard)
+	}
+
+	if len(params) != 3 || params[2] == "" {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неверный формат данных")
+	}
+	project := params[2]
+
+	if action == "confirm" {
+		keyboard, err := createComposeDownConfirmKeyboard(server.ID, project)
+		if err != nil {
+			return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, composeNameTooLongMessage)
+		}
+		if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, ""); err != nil {
+			h.logger.Error("Failed to answer callback", "error", err)
+		}
+		return h.telegramSvc.EditMessage(ctx, chatID, messageID,
+			fmt.Sprintf("⏹ Остановить проект %s на %s(%s)?", project, server.Name, server.ID), keyboard)
+	}
+
+	composeAction, ok := parseComposeAction(action)
+	if !ok {
+		h.logger.Warn("Unknown compose action", "action", action)
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неизвестное действие")
+	}
+
+	if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, fmt.Sprintf("docker compose %s", composeAction)); err != nil {
+		h.logger.Error("Failed to answer callback", "error", err)
+	}
+	// Compose operations outlive the update processing timeout, so finish in the background
+	actionCtx, operationID := trackOperation(ctx, callback.From.ID, composeOperationLabel(server, project, composeAction))
+	if err := h.telegramSvc.EditMessage(ctx, chatID, messageID, composeProgressMessage(server, project, composeAction), createCancelKeyboard(operationID)); err != nil {
+		h.logger.Error("Failed to report compose progress", "error", err)
+	}
+
+	go func() {
+		text := composeActionMessage(actionCtx, h.containerService, mapping.UserID(user), callback.From.ID, server, project, composeAction)
+		if text == "" {
+			return
+		}
+		if err := h.telegramSvc.EditMessage(actionCtx, chatID, messageID, text, createComposeBackKeyboard(server.ID)); err != nil {
+			h.logger.Error("Failed to send compose result", "error", err, "project", project)
+		}
+	}()
+	return nil
+}
+
+// parseComposeAction parses a compose action name
+func parseComposeAction(name string) (protocol.ComposeAction, bool) {
+	switch action := protocol.ComposeAction(strings.ToLower(name)); action {
+	case protocol.ComposeUp, protocol.ComposeDown, protocol.ComposeRestart:
+		return action, true
+	default:
+		return "", false
+	}
+}
+
+// fetchComposeMessage retrieves compose projects and builds the message with its keyboard.
+// The keyboard is nil when projects could not be retrieved.
+func fetchComposeMessage(ctx context.Context, containerService *services.ContainerService, userID, telegramID int64, server *models.ServerWithDetails) (string, interface{}) {
+	projects, err := containerService.ListComposeProjects(ctx, userID, telegramID, server)
+	if err != nil {
+		return agentErrorMessage(err, server, "❌ Не удалось получить compose-проекты. Попробуйте позже."), nil
+	}
+
+	return containerService.FormatComposeProjects(server, projects), createComposeKeyboard(server.ID, projects)
+}
+
+// composeActionMessage runs a compose action and returns the result message, which is
+// empty when the user cancelled the action
+func composeActionMessage(ctx context.Context, containerService *services.ContainerService, userID, telegramID int64, server *models.ServerWithDetails, project string, action protocol.ComposeAction) string {
+	result, err := containerService.RunComposeAction(ctx, userID, telegramID, server, project, action)
+	if err != nil {
+		if isCancelled(err) {
+			return ""
+		}
+		if agentReported(err, "not found") {
+			return fmt.Sprintf("❌ Проект %s не найден на сервере %s.", project, server.Name)
+		}
+		return agentErrorMessage(err, server, fmt.Sprintf("❌ Не удалось выполнить docker compose %s для %s. Попробуйте позже.", action, project))
+	}
+
+	return containerService.FormatComposeResult(server, result)
+}
+
+// composeProgressMessage returns the message shown while a compose action runs
+func composeProgressMessage(server *models.ServerWithDetails, project string, action protocol.ComposeAction) string {
+	return fmt.Sprintf("⏳ docker compose %s для %s на %s…", action, project, server.Name)
+}
+
+// composeOperationLabel describes a compose action in its cancellation message
+func composeOperationLabel(server *models.ServerWithDetails, project string, action protocol.ComposeAction) string {
+	return fmt.Sprintf("docker compose %s для %s на %s", action, project, server.Name)
+}
+
+// createComposeKeyboard creates inline keyboard with up, restart and down buttons per project
+func createComposeKeyboard(serverID string, projects []protocol.ComposeProject) interface{} {
+	var buttons [][]map[string]string
+
+	for _, project := range projects {
+		buttons = append(buttons, []map[string]string{
+			composeCallback.Button(fmt.Sprintf("▶️ %s", project.Name), "up", serverID, project.Name),
+			composeCallback.Button("🔄 Restart", "restart", serverID, project.Name),
+			composeCallback.Button("⏹ Down", "confirm", serverID, project.Name),
+		})
+	}
+
+	buttons = append(buttons, []map[string]string{
+		composeCallback.Button("🔄 Обновить", "list", serverID),
+	})
+
+	return buttons
+}
+
+// createComposeDownConfirmKeyboard creates inline keyboard confirming docker compose down.
+// callbacks.ErrTooLong is returned for project names too long for the confirm button.
+func createComposeDownConfirmKeyboard(serverID, project string) (interface{}, error) {
+	down, err := composeCallback.Data("down", serverID, project)
+	if err != nil {
+		return nil, err
+	}
+	return [][]map[string]string{
+		{
+			{"text": "✅ Остановить", "callback_data": down},
+			composeCallback.Button("❌ Отмена", "list", serverID),
+		},
+	}, nil
+}
+
+// createComposeBackKeyboard creates inline keyboard returning to the project list
+func createComposeBackKeyboard(serverID string) interface{} {
+	return [][]map[string]string{
+		{
+			composeCallback.Button("📦 К проектам", "list", serverID),
+		},
+	}
+}
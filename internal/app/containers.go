@@ -0,0 +1,115 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/servereye/servereyebot/internal/callbacks"
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/internal/telegram"
+	"github.com/servereye/servereyebot/pkg/domain"
+)
+
+// handleContainerStatsCommand shows CPU, memory, network and block IO per container
+func (b *Bot) handleContainerStatsCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+
+	if len(servers) == 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ У вас нет добавленных серверов. Используйте /add <server_id> для добавления сервера.")
+	}
+
+	server, _ := resolveServerArg(servers, args)
+	if server == nil {
+		if len(args) > 0 {
+			return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Сервер `%s` не найден в вашем списке.", args[0]))
+		}
+		return b.telegramSvc.SendMessageWithKeyboard(ctx, chatID, "📈 *Выберите сервер:*", createContainerStatsServerKeyboard(servers))
+	}
+
+	text, keyboard := fetchContainerStatsMessage(ctx, b.containerService, b.restartPolicies, mapping.UserID(user), telegramID, server)
+	if keyboard == nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, text)
+	}
+	return b.telegramSvc.SendMessageWithKeyboard(ctx, chatID, text, keyboard)
+}
+
+// handleContainerStatsCallback handles container stats buttons
+func (h *DefaultUpdateHandler) handleContainerStatsCallback(ctx context.Context, callback *telegram.CallbackQuery, data callbacks.Data) error {
+	// Parse callback data: cstats:mode:server_id, mode is "new" or "edit"
+	params := data.Params
+	if len(params) != 2 {
+		h.logger.Error("Invalid callback data format", "params", params)
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неверный формат данных")
+	}
+
+	mode, serverID := params[0], params[1]
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Внутренняя ошибка")
+	}
+
+	server := mapping.ServerByID(servers, serverID)
+	if server == nil {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Сервер не найден")
+	}
+
+	if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "Получаю статистику контейнеров"); err != nil {
+		h.logger.Error("Failed to answer callback", "error", err)
+	}
+
+	text, keyboard := fetchContainerStatsMessage(ctx, h.containerService, h.restartPolicies, mapping.UserID(user), callback.From.ID, server)
+	if mode == "edit" {
+		return h.telegramSvc.EditMessage(ctx, callback.Message.Chat.ID, callback.Message.MessageID, text, keyboard)
+	}
+	if keyboard == nil {
+		return h.telegramSvc.SendMessage(ctx, callback.Message.Chat.ID, text)
+	}
+	return h.telegramSvc.SendMessageWithKeyboard(ctx, callback.Message.Chat.ID, text, keyboard)
+}
+
+// fetchContainerStatsMessage retrieves container stats and builds the message with its keyboard.
+// The keyboard is nil when stats could not be retrieved.
+func fetchContainerStatsMessage(ctx context.Context, containerService *services.ContainerService, restartPolicies *services.RestartPolicyService, userID, telegramID int64, server *models.ServerWithDetails) (string, interface{}) {
+	stats, err := containerService.GetStats(ctx, userID, telegramID, server)
+	if err != nil {
+		return agentErrorMessage(err, server, "❌ Не удалось получить статистику контейнеров. Попробуйте позже."), nil
+	}
+
+	keyboard := [][]map[string]string{
+		{
+			containerStatsCallback.Button("🔄 Обновить", "edit", server.ID),
+			composeCallback.Button("📦 Compose", "list", server.ID),
+		},
+	}
+
+	// Policies only annotate the containers, so the stats are shown without them on failure
+	policies, err := restartPolicies.List(ctx, server.ID)
+	if err != nil {
+		policies = nil
+	}
+
+	return containerService.FormatStats(server, stats, policies), keyboard
+}
+
+// createContainerStatsServerKeyboard creates inline keyboard for selecting a server for container stats
+func createContainerStatsServerKeyboard(servers []models.ServerWithDetails) interface{} {
+	var buttons [][]map[string]string
+
+	for _, server := range servers {
+		button := []map[string]string{
+			containerStatsCallback.Button(fmt.Sprintf("🖥️ %s(%s)", server.Name, server.ID), "new", server.ID),
+		}
+		buttons = append(buttons, button)
+	}
+
+	return buttons
+}
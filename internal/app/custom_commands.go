@@ -0,0 +1,219 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// customCommandsUsage is shown when /command arguments cannot be parsed
+const customCommandsUsage = `🧩 *Пользовательские команды*
+
+/command - Команды на ваших серверах
+/command add <server_id> <name> <script> [role] - Команда /name запускает скрипт
+/command remove <server_id> <name> - Удалить команду
+
+Роль (viewer, admin, owner) - минимальная роль на сервере для запуска, по умолчанию owner.`
+
+// customCommandsOwnerMessage is shown to users who may not manage the commands of a server
+const customCommandsOwnerMessage = "⛔ Управлять командами сервера может только его владелец."
+
+// loadCustomCommands loads custom commands and registers them in the command router
+func (b *Bot) loadCustomCommands(ctx context.Context) error {
+	if err := b.customCommands.Load(ctx); err != nil {
+		return err
+	}
+
+	for _, name := range b.customCommands.Names() {
+		if b.commandRouter.HasCommand(name) {
+			b.logger.Warn("Custom command shadows a built-in command, skipping", "name", name)
+			continue
+		}
+		if err := b.registerCustomCommand(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// registerCustomCommand registers a custom command name in the command router
+func (b *Bot) registerCustomCommand(name string) error {
+	return b.commandRouter.RegisterCommand(&domain.Command{
+		Name:        name,
+		Description: "Custom command",
+		Handler:     b.handleCustomCommand,
+		Permissions: []string{},
+	})
+}
+
+// handleCustomCommandsCommand lists, defines and removes custom commands
+func (b *Bot) handleCustomCommandsCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+
+	if len(args) == 0 || strings.ToLower(args[0]) == "list" {
+		return b.telegramSvc.SendMessage(ctx, chatID, b.customCommands.FormatList(b.customCommands.ForServers(servers)))
+	}
+
+	action := strings.ToLower(args[0])
+	if (action != "add" && action != "remove") || len(args) < 3 {
+		return b.telegramSvc.SendMessage(ctx, chatID, customCommandsUsage)
+	}
+
+	server := mapping.ServerByIDOrName(servers, args[1])
+	if server == nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Сервер `%s` не найден в вашем списке.", args[1]))
+	}
+
+	name := strings.ToLower(strings.TrimPrefix(args[2], "/"))
+
+	if action == "remove" {
+		removed, err := b.customCommands.Remove(ctx, mapping.UserID(user), telegramID, server, name)
+		if err != nil {
+			if errors.IsErrorCode(err, errors.ErrCodeForbidden) {
+				return b.telegramSvc.SendMessage(ctx, chatID, customCommandsOwnerMessage)
+			}
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось удалить команду. Попробуйте позже.")
+		}
+		if !removed {
+			return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Команда /%s не найдена на сервере %s.", name, server.Name))
+		}
+		if !b.customCommands.Defined(name) {
+			b.commandRouter.UnregisterCommand(name)
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("✅ Команда /%s удалена с сервера %s.", name, server.Name))
+	}
+
+	if len(args) < 4 {
+		return b.telegramSvc.SendMessage(ctx, chatID, customCommandsUsage)
+	}
+	script := args[3]
+	role := services.RoleOwner
+	if len(args) > 4 {
+		role = strings.ToLower(args[4])
+	}
+
+	// Built-in commands cannot be redefined
+	if b.commandRouter.HasCommand(name) && !b.customCommands.Defined(name) {
+		return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Имя /%s занято встроенной командой.", name))
+	}
+
+	command, err := b.customCommands.Define(ctx, mapping.UserID(user), telegramID, server, name, script, role)
+	if err != nil {
+		switch {
+		case isRoleError(err):
+			return b.telegramSvc.SendMessage(ctx, chatID, customCommandsOwnerMessage)
+		case errors.IsErrorCode(err, errors.ErrCodeForbidden):
+			return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Скрипт должен находиться в разрешенных каталогах: %s", strings.Join(b.customCommands.ScriptDirs(), ", ")))
+		case errors.IsErrorCode(err, errors.ErrCodeValidation):
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Имя - латиница, цифры и _ (2-32 символа), роль - viewer, admin или owner.\n\n"+customCommandsUsage)
+		default:
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось сохранить команду. Попробуйте позже.")
+		}
+	}
+
+	if err := b.registerCustomCommand(command.Name); err != nil {
+		b.logger.Error("Failed to register custom command", "error", err, "name", command.Name)
+	}
+
+	return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("✅ Команда /%s на %s запускает %s (роль: %s).",
+		command.Name, server.Name, command.Script, command.RequiredRole))
+}
+
+// handleCustomCommand runs the script of a custom command on one of the user's servers
+func (b *Bot) handleCustomCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+
+	targets := b.customCommands.Resolve(cmd.Name, servers)
+	if len(targets) == 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Команда /%s не настроена на ваших серверах.", cmd.Name))
+	}
+
+	target, args, ok := pickCustomCommandTarget(targets, args)
+	if !ok {
+		var ids []string
+		for _, t := range targets {
+			ids = append(ids, t.Server.ID)
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Команда /%s есть на нескольких серверах. Укажите сервер: /%s <server_id>\n\nСерверы: %s",
+			cmd.Name, cmd.Name, strings.Join(ids, ", ")))
+	}
+
+	if err := b.customCommands.Authorize(target); err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("⛔ Для /%s нужна роль %s на сервере %s.", cmd.Name, target.Command.RequiredRole, target.Server.Name))
+	}
+
+	// Scripts outlive the update processing timeout, so report the result separately
+	runCtx, operationID := trackOperation(ctx, telegramID, fmt.Sprintf("/%s на %s", cmd.Name, target.Server.Name))
+	if err := b.telegramSvc.SendMessageWithKeyboard(ctx, chatID, fmt.Sprintf("⏳ /%s на %s…", cmd.Name, target.Server.Name), createCancelKeyboard(operationID)); err != nil {
+		return err
+	}
+
+	go func() {
+		result, err := b.customCommands.Run(runCtx, mapping.UserID(user), telegramID, target, args)
+		if isCancelled(err) {
+			return
+		}
+		if err != nil {
+			text := agentErrorMessage(err, target.Server, fmt.Sprintf("❌ Не удалось выполнить /%s. Попробуйте позже.", cmd.Name))
+			if errors.IsErrorCode(err, errors.ErrCodeValidation) {
+				text = "❌ Аргументы не должны содержать спецсимволы оболочки."
+			}
+			if err := b.telegramSvc.SendMessage(runCtx, chatID, text); err != nil {
+				b.logger.Error("Failed to send custom command result", "error", err, "name", cmd.Name)
+			}
+			return
+		}
+
+		for _, chunk := range b.customCommands.FormatResult(target, result) {
+			if err := b.telegramSvc.SendMessage(runCtx, chatID, chunk); err != nil {
+				b.logger.Error("Failed to send custom command result", "error", err, "name", cmd.Name)
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// pickCustomCommandTarget picks the server to run a custom command on. With a single server
+// it is used directly, otherwise the first argument must be the ID or the unique name of one
+// of the servers and is consumed.
+func pickCustomCommandTarget(targets []services.CustomCommandTarget, args []string) (services.CustomCommandTarget, []string, bool) {
+	if len(args) > 0 {
+		servers := make([]models.ServerWithDetails, len(targets))
+		for i, t := range targets {
+			servers[i] = *t.Server
+		}
+		if server := mapping.ServerByIDOrName(servers, args[0]); server != nil {
+			for _, t := range targets {
+				if t.Server.ID == server.ID {
+					return t, args[1:], true
+				}
+			}
+		}
+	}
+
+	if len(targets) == 1 {
+		return targets[0], args, true
+	}
+
+	return services.CustomCommandTarget{}, args, false
+}
@@ -0,0 +1,46 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/services"
+)
+
+// runDependencyCheck is a scheduler job refreshing the cached health of dependencies.
+// Updates queued since a degraded start are handled once the database recovers.
+func (b *Bot) runDependencyCheck(ctx context.Context, now time.Time) error {
+	b.dependencyService.Check(ctx)
+	if b.degraded != nil {
+		b.degraded.Replay(ctx)
+	}
+	return nil
+}
+
+// dependencyMessage returns the outage message of the first unavailable dependency,
+// or fallback while all of them are available. Times are shown in loc, the local
+// time zone when nil.
+func dependencyMessage(dependencies *services.DependencyService, fallback string, loc *time.Location, names ...string) string {
+	if message, down := dependencies.Unavailable(loc, names...); down {
+		return message
+	}
+	return fallback
+}
+
+// userLocation returns the time zone of a user's reports, nil when unknown
+func (b *Bot) userLocation(ctx context.Context, userID int64) *time.Location {
+	return reportLocation(ctx, b.reportService, userID)
+}
+
+// reportLocation returns the time zone of a user's reports, nil when unknown
+func reportLocation(ctx context.Context, reports *services.ReportService, userID int64) *time.Location {
+	timezone, err := reports.GetTimezone(ctx, userID)
+	if err != nil {
+		return nil
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil
+	}
+	return loc
+}
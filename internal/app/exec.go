@@ -0,0 +1,61 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// handleExecCommand runs an allow-listed shell command on a server
+func (b *Bot) handleExecCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	if len(args) < 2 {
+		return b.telegramSvc.SendMessage(ctx, chatID, b.execUsage())
+	}
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+
+	// The server is always named explicitly so a command never lands on the wrong host
+	server := mapping.ServerByIDOrName(servers, args[0])
+	if server == nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Сервер `%s` не найден в вашем списке.", args[0]))
+	}
+
+	command := strings.Join(args[1:], " ")
+	result, err := b.execService.Exec(ctx, mapping.UserID(user), telegramID, server, command)
+	if err != nil {
+		if isRoleError(err) {
+			return b.telegramSvc.SendMessage(ctx, chatID, "⛔ Выполнять команды может только администратор сервера.")
+		}
+		if errors.IsErrorCode(err, errors.ErrCodeForbidden) {
+			return b.telegramSvc.SendMessage(ctx, chatID, "⛔ Команда не разрешена.\n\n"+b.execUsage())
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, agentErrorMessage(err, server, "❌ Не удалось выполнить команду. Попробуйте позже."))
+	}
+
+	for _, chunk := range b.execService.FormatResult(server, command, result) {
+		if err := b.telegramSvc.SendMessage(ctx, chatID, chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// execUsage describes /exec with the allowed command patterns
+func (b *Bot) execUsage() string {
+	var sb strings.Builder
+	sb.WriteString("💻 /exec <server_id> <команда>\n\nРазрешенные команды (* - любой аргумент):\n")
+	for _, pattern := range b.execService.AllowList() {
+		sb.WriteString(fmt.Sprintf("• %s\n", pattern))
+	}
+	return sb.String()
+}
@@ -0,0 +1,81 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/pkg/domain"
+)
+
+// maxCodeMessage bounds JSON sent as a code block, longer payloads are attached as a file.
+// Telegram limits messages to 4096 characters.
+const maxCodeMessage = 4000
+
+// jsonFlag reports whether metric command arguments request JSON output and returns
+// them without the flag. Phones often autocorrect -- into a dash, so —json works too.
+func jsonFlag(args []string) ([]string, bool) {
+	rest := make([]string, 0, len(args))
+	found := false
+	for _, arg := range args {
+		if arg == "--json" || arg == "—json" {
+			found = true
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return rest, found
+}
+
+// Output modes of metric commands chosen by flags, overriding the compact setting
+const (
+	metricsCompact = "compact"
+	metricsVerbose = "verbose"
+)
+
+// outputModeFlag returns the output mode requested by metric command arguments, -c for
+// one line per metric and -v for the detailed breakdown, and the arguments without it
+func outputModeFlag(args []string) ([]string, string) {
+	rest := make([]string, 0, len(args))
+	mode := ""
+	for _, arg := range args {
+		switch arg {
+		case "-c", "--compact", "—compact":
+			mode = metricsCompact
+		case "-v", "--verbose", "—verbose":
+			mode = metricsVerbose
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return rest, mode
+}
+
+// compactOutput reports whether metrics are shown in one line, as the output mode asks
+// or else as the user prefers
+func compactOutput(mode string, settings *models.UserSettings) bool {
+	if mode != "" {
+		return mode == metricsCompact
+	}
+	return settings != nil && settings.CompactMetrics
+}
+
+// metricsAuditDetails returns the audit details of a metrics request
+func metricsAuditDetails(metricType string, asJSON bool) string {
+	if asJSON {
+		return "type=" + metricType + " format=json"
+	}
+	return "type=" + metricType
+}
+
+// sendMetricsJSON sends encoded metrics as a code block to copy, or as a file when they
+// do not fit in a message
+func sendMetricsJSON(ctx context.Context, telegramSvc domain.TelegramService, chatID int64, server *models.ServerWithDetails, metricType string, data []byte, now time.Time) error {
+	if len(data) <= maxCodeMessage {
+		return telegramSvc.SendCode(ctx, chatID, string(data), "json")
+	}
+
+	fileName := fmt.Sprintf("%s-%s-%s.json", server.ID, metricType, now.UTC().Format("20060102-150405"))
+	return telegramSvc.SendDocument(ctx, chatID, fileName, data, fmt.Sprintf("📎 Метрики %s %s(%s) в JSON", metricType, server.Name, server.ID))
+}
@@ -0,0 +1,159 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/servereye/servereyebot/internal/config"
+	"github.com/servereye/servereyebot/internal/features"
+	"github.com/servereye/servereyebot/pkg/domain"
+)
+
+// flagsUsage is shown when /flags arguments cannot be parsed
+const flagsUsage = `🚩 *Флаги функций*
+
+/flags - Показать флаги и их раскатку
+/flags <флаг> on|off - Включить или выключить для всех
+/flags <флаг> <процент> - Включить для доли пользователей
+/flags <флаг> add <telegram_id> - Включить для пользователя
+/flags <флаг> remove <telegram_id> - Убрать пользователя
+/flags <флаг> reset - Вернуть значение из конфигурации
+
+Пользователь попадает в долю стабильно: при увеличении процента включенные остаются включенными.`
+
+// newFeatureStore creates the store of flags flipped at runtime for the configured backend.
+// Like rate limits it has no fallback: replicas would evaluate flags differently.
+func newFeatureStore(cfg *config.Config) (features.Store, error) {
+	if cfg.Features.Backend != "redis" {
+		return features.NewMemoryStore(), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Redis.DialTimeout)
+	defer cancel()
+
+	return features.NewRedisStore(ctx, features.RedisOptions{
+		Addr:         fmt.Sprintf("%s:%d", cfg.Redis.Host, cfg.Redis.Port),
+		Password:     cfg.Redis.Password,
+		Database:     cfg.Redis.Database,
+		PoolSize:     cfg.Redis.PoolSize,
+		DialTimeout:  cfg.Redis.DialTimeout,
+		ReadTimeout:  cfg.Redis.ReadTimeout,
+		WriteTimeout: cfg.Redis.WriteTimeout,
+		Prefix:       "servereyebot:features:",
+	})
+}
+
+// featureEnabled reports whether an experimental feature is enabled for the user of a
+// command or callback
+func (b *Bot) featureEnabled(ctx context.Context, flag string) bool {
+	telegramID, _ := ctx.Value(userIDKey).(int64)
+	return b.features.Enabled(ctx, flag, telegramID)
+}
+
+// handleFlagsCommand lists feature flags or flips one for all replicas
+func (b *Bot) handleFlagsCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	if len(args) == 0 {
+		states, err := b.features.List(ctx)
+		if err != nil {
+			b.logger.Error("Failed to load feature flags", "error", err)
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, formatFeatureFlags(states, err != nil))
+	}
+
+	name := strings.ToLower(args[0])
+	if len(args) < 2 || !features.ValidName(name) {
+		return b.telegramSvc.SendMessage(ctx, chatID, flagsUsage)
+	}
+
+	if len(args) == 2 && strings.ToLower(args[1]) == "reset" {
+		removed, err := b.features.Reset(ctx, name)
+		if err != nil {
+			b.logger.Error("Failed to reset feature flag", "error", err, "flag", name)
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось сбросить флаг. Попробуйте позже.")
+		}
+		if !removed {
+			return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("ℹ️ Флаг `%s` не менялся, действует значение из конфигурации.", name))
+		}
+		b.logger.Info("Feature flag reset", "flag", name, "telegram_id", telegramID)
+		return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("✅ Флаг `%s` сброшен к значению из конфигурации.", name))
+	}
+
+	current, _, err := b.features.Get(ctx, name)
+	if err != nil {
+		b.logger.Error("Failed to load feature flags", "error", err)
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось загрузить флаги. Попробуйте позже.")
+	}
+	flag := current.Flag
+	flag.Name = name
+
+	switch action := strings.ToLower(args[1]); {
+	case len(args) == 2 && action == "on":
+		flag.Rollout = 100
+	case len(args) == 2 && action == "off":
+		flag.Rollout, flag.Users = 0, nil
+	case len(args) == 2:
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(action, "%"), 64)
+		if err != nil || percent < 0 || percent > 100 {
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Процент должен быть от 0 до 100.")
+		}
+		flag.Rollout = percent
+	case len(args) == 3 && (action == "add" || action == "remove"):
+		userID, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil || userID <= 0 {
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите числовой Telegram ID пользователя.")
+		}
+		users := make([]int64, 0, len(flag.Users)+1)
+		for _, id := range flag.Users {
+			if id != userID {
+				users = append(users, id)
+			}
+		}
+		if action == "add" {
+			users = append(users, userID)
+		}
+		flag.Users = users
+	default:
+		return b.telegramSvc.SendMessage(ctx, chatID, flagsUsage)
+	}
+
+	if err := b.features.Set(ctx, flag); err != nil {
+		b.logger.Error("Failed to set feature flag", "error", err, "flag", name)
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось изменить флаг. Попробуйте позже.")
+	}
+
+	b.logger.Info("Feature flag changed", "flag", name, "rollout", flag.Rollout, "users", len(flag.Users), "telegram_id", telegramID)
+	return b.telegramSvc.SendMessage(ctx, chatID, "✅ "+formatFeatureFlag(features.State{Flag: flag, Override: true}))
+}
+
+// formatFeatureFlags formats the flag list of /flags
+func formatFeatureFlags(states []features.State, stale bool) string {
+	var sb strings.Builder
+	sb.WriteString("🚩 Флаги функций\n\n")
+	if len(states) == 0 {
+		sb.WriteString("Флагов нет. Задайте их в FEATURE_FLAGS или командой /flags <флаг> on.")
+	}
+	for _, state := range states {
+		sb.WriteString("• " + formatFeatureFlag(state) + "\n")
+	}
+	if stale {
+		sb.WriteString("\n⚠️ Хранилище флагов недоступно, показаны последние загруженные значения.")
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// formatFeatureFlag formats the rollout of a flag
+func formatFeatureFlag(state features.State) string {
+	line := fmt.Sprintf("`%s`: %s%%", state.Name, strconv.FormatFloat(state.Rollout, 'f', -1, 64))
+	if len(state.Users) > 0 {
+		line += fmt.Sprintf(" + %d польз.", len(state.Users))
+	}
+	if state.Override {
+		line += " (изменен командой)"
+	}
+	return line
+}
@@ -0,0 +1,164 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// filesUsage is shown when /ls, /cat or /du arguments cannot be parsed
+const filesUsage = `📁 *Файлы на сервере (только чтение)*
+
+/ls [server_id] <path> - Содержимое каталога
+/cat [server_id] <path> - Начало файла
+/cat [server_id] <path> tail - Конец файла
+/du [server_id] [path] - Самые большие каталоги, по умолчанию в /
+
+Доступны только пути, разрешенные в настройках агента.`
+
+// handleLsCommand lists a directory on a server
+func (b *Bot) handleLsCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	user, server, args, ok := b.resolveFileArgs(ctx, chatID, telegramID, args)
+	if !ok {
+		return nil
+	}
+	if len(args) != 1 {
+		return b.telegramSvc.SendMessage(ctx, chatID, filesUsage)
+	}
+
+	listing, err := b.fileService.ListDir(ctx, mapping.UserID(user), telegramID, server, args[0])
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, fileErrorMessage(err, server, args[0]))
+	}
+
+	return b.telegramSvc.SendMessage(ctx, chatID, b.fileService.FormatListing(server, listing))
+}
+
+// handleCatCommand shows the beginning or the end of a file on a server
+func (b *Bot) handleCatCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	user, server, args, ok := b.resolveFileArgs(ctx, chatID, telegramID, args)
+	if !ok {
+		return nil
+	}
+
+	tail := false
+	if len(args) == 2 && strings.ToLower(args[1]) == "tail" {
+		tail = true
+		args = args[:1]
+	}
+	if len(args) != 1 {
+		return b.telegramSvc.SendMessage(ctx, chatID, filesUsage)
+	}
+
+	content, err := b.fileService.ReadFile(ctx, mapping.UserID(user), telegramID, server, args[0], tail)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, fileErrorMessage(err, server, args[0]))
+	}
+
+	for _, chunk := range b.fileService.FormatContent(server, content, tail) {
+		if err := b.telegramSvc.SendMessage(ctx, chatID, chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleDuCommand shows the largest directories under a path on a server
+func (b *Bot) handleDuCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	user, server, args, ok := b.resolveFileArgs(ctx, chatID, telegramID, args)
+	if !ok {
+		return nil
+	}
+	if len(args) > 1 {
+		return b.telegramSvc.SendMessage(ctx, chatID, filesUsage)
+	}
+
+	dir := "/"
+	if len(args) == 1 {
+		dir = args[0]
+	}
+
+	// Measuring large disks outlives the update processing timeout, so report the result separately
+	duCtx, operationID := trackOperation(ctx, telegramID, fmt.Sprintf("размер каталогов %s на %s", dir, server.Name))
+	progress := fmt.Sprintf("⏳ Считаю размер каталогов %s на %s, на больших дисках это может занять несколько минут…", dir, server.Name)
+	if err := b.telegramSvc.SendMessageWithKeyboard(ctx, chatID, progress, createCancelKeyboard(operationID)); err != nil {
+		return err
+	}
+
+	go func() {
+		usage, err := b.fileService.DiskUsage(duCtx, mapping.UserID(user), telegramID, server, dir)
+		var text string
+		switch {
+		case err != nil && isCancelled(err):
+			return
+		case err != nil:
+			text = fileErrorMessage(err, server, dir)
+		default:
+			text = b.fileService.FormatDiskUsage(server, usage)
+		}
+		if err := b.telegramSvc.SendMessage(duCtx, chatID, text); err != nil {
+			b.logger.Error("Failed to send disk usage", "error", err, "server_id", server.ID)
+		}
+	}()
+	return nil
+}
+
+// resolveFileArgs resolves the user and the server of a file command. When ok is false
+// the user has already been told what went wrong.
+func (b *Bot) resolveFileArgs(ctx context.Context, chatID, telegramID int64, args []string) (*domain.User, *models.ServerWithDetails, []string, bool) {
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		b.sendFileMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+		return nil, nil, nil, false
+	}
+
+	if len(servers) == 0 {
+		b.sendFileMessage(ctx, chatID, "❌ У вас нет добавленных серверов. Используйте /add <server_id> для добавления сервера.")
+		return nil, nil, nil, false
+	}
+
+	server, args := resolveServerArg(servers, args)
+	if server == nil {
+		b.sendFileMessage(ctx, chatID, "❌ Укажите сервер.\n\n"+filesUsage)
+		return nil, nil, nil, false
+	}
+
+	return user, server, args, true
+}
+
+// sendFileMessage sends a reply of a file command, logging delivery failures
+func (b *Bot) sendFileMessage(ctx context.Context, chatID int64, text string) {
+	if err := b.telegramSvc.SendMessage(ctx, chatID, text); err != nil {
+		b.logger.Error("Failed to send message", "error", err, "chat_id", chatID)
+	}
+}
+
+// fileErrorMessage returns the message shown when a file command fails
+func fileErrorMessage(err error, server *models.ServerWithDetails, path string) string {
+	if errors.IsErrorCode(err, errors.ErrCodeValidation) {
+		return "❌ Путь должен быть абсолютным, например /etc/nginx/nginx.conf"
+	}
+
+	switch {
+	case agentReported(err, "not allowed"):
+		return fmt.Sprintf("⛔ Путь %s не разрешен агентом на %s.", path, server.Name)
+	case agentReported(err, "not found") || agentReported(err, "no such file"):
+		return fmt.Sprintf("❌ Путь %s не найден на %s.", path, server.Name)
+	}
+
+	return agentErrorMessage(err, server, "❌ Не удалось прочитать файлы на сервере. Попробуйте позже.")
+}
@@ -0,0 +1,239 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/callbacks"
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/internal/telegram"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// firewallUsage is shown when /firewall arguments cannot be parsed
+const firewallUsage = `🧱 *Файрвол*
+
+/firewall [server_id] - Состояние и правила ufw, nftables или iptables
+/firewall [server_id] block <ip|сеть> - Заблокировать входящий трафик с адреса, после подтверждения
+/firewall [server_id] unblock <ip|id> - Снять блокировку
+
+Блокировать адреса может владелец сервера. Заблокированные из бота адреса видны в /firewall и снимаются кнопкой.`
+
+// handleFirewallCommand shows the firewall of a server and blocks or unblocks addresses
+func (b *Bot) handleFirewallCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+	if len(servers) == 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, "📭 У вас нет добавленных серверов.\n\nИспользуйте /add <server_id> для добавления сервера.")
+	}
+
+	server, args := resolveServerArg(servers, args)
+	if server == nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите сервер.\n\n"+firewallUsage)
+	}
+
+	if len(args) == 0 {
+		text, keyboard := fetchFirewallMessage(ctx, b.firewallService, mapping.UserID(user), telegramID, server)
+		if keyboard == nil {
+			return b.telegramSvc.SendMessage(ctx, chatID, text)
+		}
+		return b.telegramSvc.SendMessageWithKeyboard(ctx, chatID, text, keyboard)
+	}
+	if len(args) != 2 {
+		return b.telegramSvc.SendMessage(ctx, chatID, firewallUsage)
+	}
+	if !services.Can(server, services.PermFirewall) {
+		return b.telegramSvc.SendMessage(ctx, chatID, "⛔ Блокировать адреса может только владелец сервера.")
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "block":
+		address, err := services.ParseBlockAddress(args[1])
+		if err != nil {
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите IP-адрес или сеть, например 203.0.113.7 или 203.0.113.0/24. Локальные адреса блокировать нельзя.")
+		}
+		keyboard, err := createFirewallBlockConfirmKeyboard(server.ID, address)
+		if err != nil {
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Слишком длинный адрес для подтверждения.")
+		}
+		return b.telegramSvc.SendMessageWithKeyboard(ctx, chatID,
+			fmt.Sprintf("⛔ Заблокировать весь входящий трафик с %s на %s(%s)?", address, server.Name, server.ID), keyboard)
+
+	case "unblock":
+		blocks, err := b.firewallService.List(ctx, server.ID)
+		if err != nil {
+			b.logger.Error("Failed to list firewall blocks", "error", err, "server_id", server.ID)
+			return b.telegramSvc.SendMessage(ctx, chatID, dependencyMessage(b.dependencyService, "❌ Не удалось получить блокировки. Попробуйте позже.", nil, services.DependencyDatabase))
+		}
+		block := findFirewallBlock(blocks, args[1])
+		if block == nil {
+			return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Блокировка %s не найдена. Список: /firewall %s", args[1], server.ID))
+		}
+
+		if _, err := b.firewallService.Unblock(ctx, mapping.UserID(user), telegramID, server, block.ID); err != nil {
+			return b.telegramSvc.SendMessage(ctx, chatID, agentErrorMessage(err, server, "❌ Не удалось снять блокировку. Попробуйте позже."))
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("✅ Адрес %s на %s разблокирован.", block.Address, server.Name))
+
+	default:
+		return b.telegramSvc.SendMessage(ctx, chatID, firewallUsage)
+	}
+}
+
+// handleFirewallCallback refreshes the firewall of a server and blocks or unblocks addresses
+func (h *DefaultUpdateHandler) handleFirewallCallback(ctx context.Context, callback *telegram.CallbackQuery, data callbacks.Data) error {
+	// Parse callback data: fw:action:server_id[:address|block_id]
+	params := data.Params
+	if len(params) < 2 {
+		h.logger.Error("Invalid callback data format", "params", params)
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неверный формат данных")
+	}
+
+	action, serverID := params[0], params[1]
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Внутренняя ошибка")
+	}
+
+	server := mapping.ServerByID(servers, serverID)
+	if server == nil {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Сервер не найден")
+	}
+
+	chatID := callback.Message.Chat.ID
+	messageID := callback.Message.MessageID
+
+	if action == "show" {
+		if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, ""); err != nil {
+			h.logger.Error("Failed to answer callback", "error", err)
+		}
+		text, keyboard := fetchFirewallMessage(ctx, h.firewallService, mapping.UserID(user), callback.From.ID, server)
+		return h.telegramSvc.EditMessage(ctx, chatID, messageID, text, keyboard)
+	}
+
+	if len(params) != 3 || params[2] == "" {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неверный формат данных")
+	}
+	if !services.Can(server, services.PermFirewall) {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "⛔ Блокировать адреса может только владелец")
+	}
+
+	var text string
+	switch action {
+	case "block":
+		if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "Блокирую "+params[2]); err != nil {
+			h.logger.Error("Failed to answer callback", "error", err)
+		}
+		block, err := h.firewallService.Block(ctx, mapping.UserID(user), callback.From.ID, server, params[2])
+		if err != nil {
+			text = agentErrorMessage(err, server, fmt.Sprintf("❌ Не удалось заблокировать %s. Проверьте, что агент запущен от root.", params[2]))
+		} else {
+			text = fmt.Sprintf("✅ Адрес %s заблокирован на %s(%s).\n\nСнять блокировку: /firewall %s unblock %s", block.Address, server.Name, server.ID, server.ID, block.Address)
+		}
+
+	case "unblock":
+		id, err := strconv.ParseInt(params[2], 10, 64)
+		if err != nil {
+			return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неверный формат данных")
+		}
+		if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "Снимаю блокировку"); err != nil {
+			h.logger.Error("Failed to answer callback", "error", err)
+		}
+		block, err := h.firewallService.Unblock(ctx, mapping.UserID(user), callback.From.ID, server, id)
+		switch {
+		case errors.IsErrorCode(err, errors.ErrCodeNotFound):
+			text = "❌ Блокировка уже снята."
+		case err != nil:
+			text = agentErrorMessage(err, server, "❌ Не удалось снять блокировку. Попробуйте позже.")
+		default:
+			text = fmt.Sprintf("✅ Адрес %s на %s разблокирован.", block.Address, server.Name)
+		}
+
+	default:
+		h.logger.Warn("Unknown firewall action", "action", action)
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неизвестное действие")
+	}
+
+	return h.telegramSvc.EditMessage(ctx, chatID, messageID, text, createFirewallBackKeyboard(server.ID))
+}
+
+// fetchFirewallMessage retrieves the firewall of a server and builds the message with its
+// keyboard. The keyboard is nil when the firewall could not be retrieved.
+func fetchFirewallMessage(ctx context.Context, firewallService *services.FirewallService, userID, telegramID int64, server *models.ServerWithDetails) (string, interface{}) {
+	status, err := firewallService.Status(ctx, userID, telegramID, server)
+	if err != nil {
+		return agentErrorMessage(err, server, "❌ Не удалось получить состояние файрвола. Проверьте, что агент запущен от root."), nil
+	}
+
+	blocks, err := firewallService.List(ctx, server.ID)
+	if err != nil {
+		return "❌ Не удалось получить заблокированные адреса. Попробуйте позже.", nil
+	}
+
+	canUnblock := services.Can(server, services.PermFirewall)
+	return services.FormatFirewall(server, status, blocks, time.Now()), createFirewallKeyboard(server.ID, blocks, canUnblock)
+}
+
+// findFirewallBlock finds a block by ID, with or without #, or by address
+func findFirewallBlock(blocks []models.FirewallBlock, value string) *models.FirewallBlock {
+	address, _ := services.ParseBlockAddress(value)
+	for i := range blocks {
+		if strconv.FormatInt(blocks[i].ID, 10) == strings.TrimPrefix(value, "#") || blocks[i].Address == address {
+			return &blocks[i]
+		}
+	}
+	return nil
+}
+
+// createFirewallKeyboard creates inline keyboard refreshing the firewall and, for owners,
+// unblocking the addresses blocked from the bot
+func createFirewallKeyboard(serverID string, blocks []models.FirewallBlock, canUnblock bool) interface{} {
+	var keyboard [][]map[string]string
+	if canUnblock {
+		for _, block := range blocks {
+			keyboard = append(keyboard, []map[string]string{
+				firewallCallback.Button("🔓 Разблокировать "+block.Address, "unblock", serverID, strconv.FormatInt(block.ID, 10)),
+			})
+		}
+	}
+
+	return append(keyboard, []map[string]string{
+		firewallCallback.Button("🔄 Обновить", "show", serverID),
+	})
+}
+
+// createFirewallBlockConfirmKeyboard creates inline keyboard confirming an address block.
+// callbacks.ErrTooLong is returned for addresses too long for the confirm button.
+func createFirewallBlockConfirmKeyboard(serverID, address string) (interface{}, error) {
+	block, err := firewallCallback.Data("block", serverID, address)
+	if err != nil {
+		return nil, err
+	}
+	return [][]map[string]string{
+		{
+			{"text": "⛔ Заблокировать", "callback_data": block},
+			firewallCallback.Button("❌ Отмена", "show", serverID),
+		},
+	}, nil
+}
+
+// createFirewallBackKeyboard creates inline keyboard returning to the firewall status
+func createFirewallBackKeyboard(serverID string) interface{} {
+	return [][]map[string]string{
+		{
+			firewallCallback.Button("🧱 К файрволу", "show", serverID),
+		},
+	}
+}
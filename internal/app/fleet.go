@@ -0,0 +1,184 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/render"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/pkg/domain"
+)
+
+// fleetConcurrency bounds the servers whose metrics are fetched at once for /fleet
+const fleetConcurrency = 8
+
+// fleetNameWidth truncates server names so that the table fits a phone screen
+const fleetNameWidth = 14
+
+// fleetRow is the state of one server in the fleet overview
+type fleetRow struct {
+	server   models.ServerWithDetails
+	metrics  *domain.ServerMetrics
+	timedOut bool
+}
+
+// health ranks a server for sorting, higher is worse. Servers without metrics come first.
+func (r fleetRow) health() float64 {
+	if r.metrics == nil {
+		return 1000
+	}
+	return max(r.metrics.CPU, r.metrics.Memory, r.metrics.Disk)
+}
+
+// handleFleetCommand shows a table of all servers of the user, or of the group chat,
+// sorted by their worst resource usage
+func (b *Bot) handleFleetCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	user, err := contextUser(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, dependencyMessage(b.dependencyService, "❌ Внутренняя ошибка. Попробуйте позже.", nil, services.DependencyDatabase))
+	}
+
+	servers, err := chatServers(ctx, b.chatService, telegramID, chatID)
+	if err != nil {
+		b.logger.Error("Failed to get user servers", "error", err, "user_id", user.ID)
+		return b.telegramSvc.SendMessage(ctx, chatID, dependencyMessage(b.dependencyService, "❌ Произошла ошибка при получении списка серверов. Попробуйте позже.", nil, services.DependencyDatabase))
+	}
+	if len(servers) == 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ У вас нет добавленных серверов. Используйте /add <server_id> для добавления сервера.")
+	}
+
+	started := time.Now()
+	rows := b.fetchFleet(ctx, servers, b.currentConfig().Timeouts.MetricsFetch)
+	message := formatFleet(rows)
+
+	b.auditService.RecordResult(ctx, mapping.UserID(user), telegramID, "", services.AuditCommandMetrics, fmt.Sprintf("type=fleet servers=%d", len(servers)), render.Plain(message), started, nil)
+	return b.telegramSvc.SendMarkdown(ctx, chatID, message, nil)
+}
+
+// fetchFleet gets the metrics of servers in parallel. A server not answering within
+// timeout is shown as such instead of holding back the others.
+func (b *Bot) fetchFleet(ctx context.Context, servers []models.ServerWithDetails, timeout time.Duration) []fleetRow {
+	rows := make([]fleetRow, len(servers))
+	slots := make(chan struct{}, fleetConcurrency)
+	var wg sync.WaitGroup
+
+	for i := range servers {
+		rows[i].server = servers[i]
+
+		wg.Add(1)
+		go func(row *fleetRow) {
+			defer wg.Done()
+
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+				return
+			}
+
+			type result struct {
+				metrics *domain.LegacyMetricsResponse
+				err     error
+			}
+			done := make(chan result, 1)
+			go func() {
+				metrics, _, err := b.metricsService.GetCachedMetrics(row.server.ServerKey, "all", false)
+				done <- result{metrics: metrics, err: err}
+			}()
+
+			timer := time.NewTimer(timeout)
+			defer timer.Stop()
+
+			select {
+			case res := <-done:
+				if res.err != nil {
+					b.logger.Warn("Failed to get fleet server metrics", "error", res.err, "server_id", row.server.ID)
+					return
+				}
+				row.metrics = &res.metrics.Metrics
+			case <-timer.C:
+				row.timedOut = true
+			case <-ctx.Done():
+			}
+		}(&rows[i])
+	}
+	wg.Wait()
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].health() > rows[j].health()
+	})
+	return rows
+}
+
+// formatFleet renders the fleet overview as a monospaced table
+func formatFleet(rows []fleetRow) string {
+	var table strings.Builder
+	fmt.Fprintf(&table, "%-2s %-*s %4s %4s %4s %7s\n", "", fleetNameWidth, "Сервер", "CPU", "RAM", "Диск", "Аптайм")
+
+	failed := 0
+	for _, row := range rows {
+		name := truncateRunes(row.server.Name, fleetNameWidth)
+		switch {
+		case row.metrics == nil:
+			failed++
+			status := "ошибка"
+			if row.timedOut {
+				status = "нет ответа"
+			}
+			fmt.Fprintf(&table, "%s %-*s %s\n", "⚫", fleetNameWidth, name, status)
+		default:
+			m := row.metrics
+			fmt.Fprintf(&table, "%s %-*s %3.0f%% %3.0f%% %3.0f%% %7s\n",
+				fleetStatus(row.health()), fleetNameWidth, name, m.CPU, m.Memory, m.Disk, fleetUptime(m.SystemDetails.UptimeSeconds))
+		}
+	}
+
+	message := string(render.Bold(fmt.Sprintf("🌐 Серверы: %d", len(rows)))) + "\n\n" + string(render.Pre(strings.TrimRight(table.String(), "\n")))
+	if failed > 0 {
+		message += "\n" + string(render.Italic(fmt.Sprintf("⚠️ Без метрик: %d. Подробнее: /all <server_id>", failed)))
+	}
+	return message
+}
+
+// fleetStatus returns the status mark of a server by its worst resource usage
+func fleetStatus(health float64) string {
+	switch {
+	case health >= 90:
+		return "🔴"
+	case health >= 75:
+		return "🟡"
+	default:
+		return "🟢"
+	}
+}
+
+// fleetUptime formats an uptime compactly, e.g. 12d or 5h
+func fleetUptime(seconds int) string {
+	uptime := time.Duration(seconds) * time.Second
+	switch {
+	case uptime >= 24*time.Hour:
+		return fmt.Sprintf("%dd", int(uptime.Hours()/24))
+	case uptime >= time.Hour:
+		return fmt.Sprintf("%dh", int(uptime.Hours()))
+	default:
+		return fmt.Sprintf("%dm", int(uptime.Minutes()))
+	}
+}
+
+// truncateRunes shortens text to at most n runes, marking the cut
+func truncateRunes(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return string(runes[:n-1]) + "…"
+}
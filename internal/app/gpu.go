@@ -0,0 +1,44 @@
+package app
+
+import (
+	"context"
+
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/pkg/domain"
+)
+
+// gpuUsage is shown when /gpu arguments cannot be parsed
+const gpuUsage = `🎮 *GPU*
+
+/gpu [server_id] - загрузка, память, температура и потребление GPU NVIDIA
+
+На сервере нужны драйвер NVIDIA и nvidia-smi.`
+
+// handleGPUCommand shows the GPU readings of a server
+func (b *Bot) handleGPUCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+	if len(servers) == 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, "📭 У вас нет добавленных серверов.\n\nИспользуйте /add <server_id> для добавления сервера.")
+	}
+
+	server, args := resolveServerArg(servers, args)
+	if server == nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите сервер.\n\n"+gpuUsage)
+	}
+	if len(args) > 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, gpuUsage)
+	}
+
+	gpu, err := b.metricsService.GetGPU(ctx, mapping.UserID(user), telegramID, server)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, agentErrorMessage(err, server, "❌ Не удалось получить метрики GPU."))
+	}
+
+	return b.telegramSvc.SendMarkdown(ctx, chatID, b.metricsService.FormatGPU(server, gpu), nil)
+}
@@ -0,0 +1,171 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// permissionPrivate restricts a command to the private chat with the bot, for commands
+// whose replies carry secrets such as pairing codes or agent keys
+const permissionPrivate = "private"
+
+// bindUsage is shown when /bind arguments cannot be parsed
+const bindUsage = `👥 *Серверы группового чата*
+
+/bind - Серверы этого чата
+/bind <server_id> - Привязать сервер к чату
+/unbind <server_id> - Отвязать сервер
+
+Участники чата видят метрики привязанных серверов, а алерты этих серверов приходят в чат. Привязывать серверы могут их администраторы.`
+
+// isGroupChat reports whether a command was sent to a group chat. The ID of a private
+// chat equals the Telegram ID of the user.
+func isGroupChat(chatID, telegramID int64) bool {
+	return chatID != telegramID
+}
+
+// chatServers returns the servers a command sent to a chat works with: the servers
+// attached to a group chat, or the user's own servers in the private chat
+func chatServers(ctx context.Context, chats *services.ChatService, telegramID, chatID int64) ([]models.ServerWithDetails, error) {
+	if isGroupChat(chatID, telegramID) {
+		return chats.Servers(ctx, chatID)
+	}
+	_, servers, err := contextServers(ctx)
+	return servers, err
+}
+
+// handleBindCommand lists or attaches servers of a group chat
+func (b *Bot) handleBindCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	if !isGroupChat(chatID, telegramID) {
+		return b.telegramSvc.SendMessage(ctx, chatID, "👥 /bind работает в групповых чатах: добавьте бота в группу и отправьте там /bind <server_id>.")
+	}
+
+	if len(args) == 0 {
+		servers, err := b.chatService.Servers(ctx, chatID)
+		if err != nil {
+			b.logger.Error("Failed to list chat servers", "error", err, "chat_id", chatID)
+			return b.telegramSvc.SendMessage(ctx, chatID, dependencyMessage(b.dependencyService, "❌ Не удалось получить серверы чата. Попробуйте позже.", nil, services.DependencyDatabase))
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, services.FormatChatServers(servers))
+	}
+	if len(args) != 1 {
+		return b.telegramSvc.SendMessage(ctx, chatID, bindUsage)
+	}
+
+	userID, server, ok := b.resolveBindServer(ctx, chatID, telegramID, args[0])
+	if !ok {
+		return nil
+	}
+
+	if err := b.chatService.Bind(ctx, chatID, userID, server); err != nil {
+		if errors.IsErrorCode(err, errors.ErrCodeForbidden) {
+			return b.telegramSvc.SendMessage(ctx, chatID, "⛔ Привязывать серверы к чату могут только их администраторы.")
+		}
+		if errors.IsErrorCode(err, errors.ErrCodeValidation) {
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ К одному чату можно привязать не больше 20 серверов.")
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось привязать сервер. Попробуйте позже.")
+	}
+
+	return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("✅ Сервер %s (%s) привязан к чату: участники видят его метрики, алерты будут приходить сюда.", server.Name, server.ID))
+}
+
+// handleUnbindCommand detaches a server from a group chat
+func (b *Bot) handleUnbindCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	if !isGroupChat(chatID, telegramID) || len(args) != 1 {
+		return b.telegramSvc.SendMessage(ctx, chatID, bindUsage)
+	}
+
+	_, server, ok := b.resolveBindServer(ctx, chatID, telegramID, args[0])
+	if !ok {
+		return nil
+	}
+
+	removed, err := b.chatService.Unbind(ctx, chatID, server)
+	if err != nil {
+		if errors.IsErrorCode(err, errors.ErrCodeForbidden) {
+			return b.telegramSvc.SendMessage(ctx, chatID, "⛔ Отвязывать серверы от чата могут только их администраторы.")
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось отвязать сервер. Попробуйте позже.")
+	}
+	if !removed {
+		return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Сервер %s не привязан к этому чату.", server.ID))
+	}
+
+	return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("✅ Сервер %s (%s) отвязан от чата.", server.Name, server.ID))
+}
+
+// resolveBindServer finds a server among the user's own servers for /bind and /unbind,
+// replying to the chat when it cannot be found
+func (b *Bot) resolveBindServer(ctx context.Context, chatID, telegramID int64, idOrName string) (int64, *models.ServerWithDetails, bool) {
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		_ = b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+		return 0, nil, false
+	}
+
+	server := mapping.ServerByIDOrName(servers, idOrName)
+	if server == nil {
+		_ = b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Сервер `%s` не найден среди ваших серверов.", idOrName))
+		return 0, nil, false
+	}
+	return mapping.UserID(user), server, true
+}
+
+// chatAlertMessages returns the messages posting alerts to the group chats their servers
+// are attached to. Users sharing a server get the same alert, so each text is posted to a
+// chat only once; sent holds the chat and text of the alerts already queued.
+func (b *Bot) chatAlertMessages(ctx context.Context, notifications []services.AlertNotification, sent map[string]bool) []*models.OutboxMessage {
+	if len(notifications) == 0 {
+		return nil
+	}
+
+	chats, err := b.chatService.ChatsByServer(ctx)
+	if err != nil {
+		b.logger.Error("Failed to list chat servers", "error", err)
+		return nil
+	}
+	if len(chats) == 0 {
+		return nil
+	}
+
+	var messages []*models.OutboxMessage
+
+	for _, notification := range notifications {
+		for _, serverID := range notification.ServerIDs {
+			for _, chatID := range chats[serverID] {
+				key := fmt.Sprintf("%d\x00%s", chatID, notification.Text)
+				if sent[key] {
+					continue
+				}
+				sent[key] = true
+
+				messages = append(messages, services.NewOutboxMessage(chatID, 0, notification.Text, nil, false))
+			}
+		}
+	}
+	return messages
+}
+
+// groupCommandName strips the bot mention from a command sent to a group as /cpu@bot,
+// reporting false when the command is addressed to another bot
+func groupCommandName(command, botUsername string) (string, bool) {
+	name, target, found := strings.Cut(command, "@")
+	if !found {
+		return command, true
+	}
+	return name, strings.EqualFold(target, botUsername)
+}
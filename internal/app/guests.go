@@ -0,0 +1,132 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// guestUsage is shown when /guest arguments cannot be parsed
+const guestUsage = `👥 *Гостевой доступ*
+
+/guest <server_id> - Гости сервера
+/guest <server_id> <@username|telegram_id> <срок> - Дать доступ на чтение, например /guest srv_1 @contractor 48h
+/guest <server_id> <@username|telegram_id> revoke - Забрать доступ досрочно
+
+Срок от 1h до 30d (h - часы, d - дни, w - недели). Гость видит сервер как viewer, по истечении срока доступ снимается автоматически, об этом придет уведомление вам и гостю. Гость должен хотя бы раз написать боту /start. Давать доступ может только владелец сервера.`
+
+// handleGuestCommand grants and revokes time-boxed viewer access to a server
+func (b *Bot) handleGuestCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	if len(args) == 0 || len(args) > 3 || len(args) == 2 {
+		return b.telegramSvc.SendMessage(ctx, chatID, guestUsage)
+	}
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+
+	server := mapping.ServerByIDOrName(servers, args[0])
+	if server == nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Сервер `%s` не найден в вашем списке.", args[0]))
+	}
+	if !services.Can(server, services.PermGuests) {
+		return b.telegramSvc.SendMessage(ctx, chatID, "⛔ Управлять гостевым доступом может только владелец сервера.")
+	}
+
+	now := time.Now()
+	if len(args) == 1 {
+		guests, err := b.guestService.List(ctx, server.ID)
+		if err != nil {
+			b.logger.Error("Failed to list server guests", "error", err, "server_id", server.ID)
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось получить список гостей. Попробуйте позже.")
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, services.FormatGuests(server, guests, now))
+	}
+
+	guest, err := b.guestService.FindUser(ctx, args[1])
+	if err != nil {
+		if errors.IsErrorCode(err, errors.ErrCodeNotFound) {
+			return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Пользователь %s не найден. Попросите его написать боту /start и повторите команду.", args[1]))
+		}
+		b.logger.Error("Failed to find guest", "error", err, "guest", args[1])
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+	guestName := userDisplayName(guest.Username, guest.FirstName, guest.TelegramID)
+
+	if strings.ToLower(args[2]) == "revoke" {
+		revoked, err := b.guestService.Revoke(ctx, server, guest)
+		if err != nil {
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось забрать доступ. Попробуйте позже.")
+		}
+		if !revoked {
+			return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ %s не гость сервера %s.", guestName, server.Name))
+		}
+
+		b.notifyGuest(ctx, guest.TelegramID, fmt.Sprintf("🔒 Владелец забрал ваш гостевой доступ к серверу %s.", server.Name))
+		return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("✅ Гостевой доступ %s к серверу %s снят.", guestName, server.Name))
+	}
+
+	duration, err := services.ParseHistoryPeriod(args[2])
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите срок доступа, например 12h, 2d или 1w.")
+	}
+
+	grant, err := b.guestService.Grant(ctx, telegramID, server, guest, duration, now)
+	if err != nil {
+		if errors.IsErrorCode(err, errors.ErrCodeValidation) {
+			return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Не удалось дать доступ %s: срок от 1h до 30d, не больше 20 гостей, у пользователя не должно быть своего доступа к серверу.", guestName))
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось дать доступ. Попробуйте позже.")
+	}
+
+	expires := grant.ExpiresAt.UTC().Format("02.01.2006 15:04")
+	b.notifyGuest(ctx, guest.TelegramID, fmt.Sprintf("🔑 %s дал вам доступ на чтение к серверу %s (`%s`) до %s UTC.\n\nОн появится в /servers, метрики доступны командами /cpu, /memory, /disk и другими.",
+		userDisplayName(user.Username, user.FirstName, telegramID), server.Name, server.ID, expires))
+	return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("✅ %s получил доступ на чтение к серверу %s до %s UTC. Забрать досрочно: /guest %s %s revoke",
+		guestName, server.Name, expires, server.ID, args[1]))
+}
+
+// notifyGuest sends a message about guest access, logging failures since the guest may
+// have blocked the bot
+func (b *Bot) notifyGuest(ctx context.Context, telegramID int64, text string) {
+	if err := b.telegramSvc.SendMessage(ctx, telegramID, text); err != nil {
+		b.logger.Warn("Failed to notify about guest access", "error", err, "telegram_id", telegramID)
+	}
+}
+
+// userDisplayName returns how a user is named in messages to other users
+func userDisplayName(username, firstName string, telegramID int64) string {
+	switch {
+	case username != "":
+		return "@" + username
+	case firstName != "":
+		return firstName
+	default:
+		return fmt.Sprintf("%d", telegramID)
+	}
+}
+
+// runGuestExpiry is a scheduler job revoking guest access that expired
+func (b *Bot) runGuestExpiry(ctx context.Context, now time.Time) error {
+	expired, err := b.guestService.Expire(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	for _, guest := range expired {
+		b.notifyGuest(ctx, guest.TelegramID, fmt.Sprintf("⌛ Срок вашего гостевого доступа к серверу %s истек, сервер убран из вашего списка.", guest.ServerName))
+		b.notifyGuest(ctx, guest.GrantedBy, fmt.Sprintf("⌛ Гостевой доступ %s к серверу %s истек и снят. Продлить: /guest %s %s 24h",
+			services.GuestName(guest), guest.ServerName, guest.ServerID, services.GuestName(guest)))
+	}
+	return nil
+}
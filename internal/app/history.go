@@ -0,0 +1,77 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/pkg/domain"
+)
+
+// handleTopCommand shows the top processes of a server, or when a metric peaked within
+// a period and its busiest hours
+func (b *Bot) handleTopCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+	if len(servers) == 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, "📭 У вас нет добавленных серверов.\n\nИспользуйте /add <server_id> для добавления сервера.")
+	}
+
+	server, args := resolveServerArg(servers, args)
+	if server == nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите сервер. Пример: /top srv_12313 cpu 7d")
+	}
+
+	// /top [cpu|mem] [N] shows processes, /top <metric> <period> shows metric peaks
+	if sortBy, limit, ok := parseProcessTopArgs(args); ok {
+		return b.sendTopProcesses(ctx, chatID, mapping.UserID(user), telegramID, server, sortBy, limit)
+	}
+
+	if b.metricsWriter == nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ История метрик не сохраняется на этом боте.")
+	}
+
+	metricArg, periodArg := "cpu", "24h"
+	if len(args) > 0 {
+		metricArg = args[0]
+	}
+	if len(args) > 1 {
+		periodArg = args[1]
+	}
+
+	metric, ok := services.FindHistoryMetric(metricArg)
+	if !ok {
+		var aliases []string
+		for _, m := range services.HistoryMetrics() {
+			aliases = append(aliases, m.Alias)
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Неизвестная метрика `%s`. Доступные: %s", metricArg, strings.Join(aliases, ", ")))
+	}
+
+	period, err := services.ParseHistoryPeriod(periodArg)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Период задается в часах, днях или неделях (не больше 90 дней), например: 6h, 7d, 2w.")
+	}
+
+	top, err := b.historyService.Top(ctx, server.ServerKey, metric, period, time.Now())
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, dependencyMessage(b.dependencyService, "❌ Не удалось получить историю метрик. Попробуйте позже.", nil, services.DependencyDatabase))
+	}
+
+	loc := time.UTC
+	if timezone, err := b.reportService.GetTimezone(ctx, mapping.UserID(user)); err == nil {
+		if l, err := time.LoadLocation(timezone); err == nil {
+			loc = l
+		}
+	}
+
+	return b.telegramSvc.SendMessage(ctx, chatID, b.historyService.FormatTop(server, top, strings.ToLower(periodArg), loc))
+}
@@ -0,0 +1,297 @@
+package app
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/callbacks"
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/internal/telegram"
+	"github.com/servereye/servereyebot/pkg/docker"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// maxImageButtons limits the pull buttons shown under the image list
+const maxImageButtons = 10
+
+// imagesUsage is shown when /images arguments cannot be parsed
+const imagesUsage = `🗂 *Образы Docker*
+
+/images [server_id] - Список образов с размером и возрастом
+/images [server_id] pull <image> - Обновить образ
+/images [server_id] prune - Удалить неиспользуемые образы`
+
+// handleImagesCommand lists, pulls and prunes Docker images
+func (b *Bot) handleImagesCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+
+	if len(servers) == 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ У вас нет добавленных серверов. Используйте /add <server_id> для добавления сервера.")
+	}
+
+	server, args := resolveServerArg(servers, args)
+	if server == nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите сервер.\n\n"+imagesUsage)
+	}
+
+	if len(args) == 0 {
+		text, keyboard := fetchImagesMessage(ctx, b.containerService, mapping.UserID(user), telegramID, server)
+		if keyboard == nil {
+			return b.telegramSvc.SendMessage(ctx, chatID, text)
+		}
+		return b.telegramSvc.SendMessageWithKeyboard(ctx, chatID, text, keyboard)
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "pull":
+		if len(args) < 2 {
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите образ. Пример: /images pull nginx:latest")
+		}
+		image := args[1]
+
+		// Pulls outlive the update processing timeout, so report the result separately
+		pullCtx, operationID := trackOperation(ctx, telegramID, fmt.Sprintf("загрузка образа %s на %s", image, server.Name))
+		if err := b.telegramSvc.SendMessageWithKeyboard(ctx, chatID, fmt.Sprintf("⏳ Загружаю образ %s на %s…", image, server.Name), createCancelKeyboard(operationID)); err != nil {
+			return err
+		}
+
+		go func() {
+			text := pullImageMessage(pullCtx, b.containerService, mapping.UserID(user), telegramID, server, image)
+			if text == "" {
+				return
+			}
+			if err := b.telegramSvc.SendMessage(pullCtx, chatID, text); err != nil {
+				b.logger.Error("Failed to send image pull result", "error", err, "image", image)
+			}
+		}()
+		return nil
+
+	case "prune":
+		return b.telegramSvc.SendMessageWithKeyboard(ctx, chatID,
+			fmt.Sprintf("🧹 Удалить неиспользуемые образы на %s(%s)?", server.Name, server.ID),
+			createPruneConfirmKeyboard(server.ID))
+
+	default:
+		return b.telegramSvc.SendMessage(ctx, chatID, imagesUsage)
+	}
+}
+
+// handleImagesCallback handles image list, pull and prune buttons
+func (h *DefaultUpdateHandler) handleImagesCallback(ctx context.Context, callback *telegram.CallbackQuery, data callbacks.Data) error {
+	// Parse callback data: img:action:server_id[:image_id]
+	params := data.Params
+	if len(params) < 2 || len(params) > 3 {
+		h.logger.Error("Invalid callback data format", "params", params)
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неверный формат данных")
+	}
+
+	action, serverID := params[0], params[1]
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Внутренняя ошибка")
+	}
+
+	server := mapping.ServerByID(servers, serverID)
+	if server == nil {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Сервер не найден")
+	}
+
+	chatID := callback.Message.Chat.ID
+	messageID := callback.Message.MessageID
+
+	switch action {
+	case "list":
+		if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "Обновляю список образов"); err != nil {
+			h.logger.Error("Failed to answer callback", "error", err)
+		}
+		text, keyboard := fetchImagesMessage(ctx, h.containerService, mapping.UserID(user), callback.From.ID, server)
+		return h.telegramSvc.EditMessage(ctx, chatID, messageID, text, keyboard)
+
+	case "pull":
+		if len(params) != 3 {
+			return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неверный формат данных")
+		}
+
+		// Callback data is limited to 64 bytes, so buttons carry the short image ID
+		images, err := h.containerService.ListImages(ctx, mapping.UserID(user), callback.From.ID, server)
+		if err != nil {
+			return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Не удалось получить список образов")
+		}
+		var image string
+		for _, img := range images {
+			if services.ShortImageID(img.ID) == params[2] && !services.IsDanglingImage(img) {
+				image = services.ImageReference(img)
+				break
+			}
+		}
+		if image == "" {
+			return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Образ не найден")
+		}
+
+		if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "Загружаю образ"); err != nil {
+			h.logger.Error("Failed to answer callback", "error", err)
+		}
+		// Pulls outlive the update processing timeout, so finish in the background
+		pullCtx, operationID := trackOperation(ctx, callback.From.ID, fmt.Sprintf("загрузка образа %s на %s", image, server.Name))
+		if err := h.telegramSvc.EditMessage(ctx, chatID, messageID, fmt.Sprintf("⏳ Загружаю образ %s на %s…", image, server.Name), createCancelKeyboard(operationID)); err != nil {
+			h.logger.Error("Failed to report image pull progress", "error", err)
+		}
+
+		go func() {
+			text := pullImageMessage(pullCtx, h.containerService, mapping.UserID(user), callback.From.ID, server, image)
+			if text == "" {
+				return
+			}
+			if err := h.telegramSvc.EditMessage(pullCtx, chatID, messageID, text, createImagesBackKeyboard(server.ID)); err != nil {
+				h.logger.Error("Failed to send image pull result", "error", err, "image", image)
+			}
+		}()
+		return nil
+
+	case "prune":
+		if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, ""); err != nil {
+			h.logger.Error("Failed to answer callback", "error", err)
+		}
+		return h.telegramSvc.EditMessage(ctx, chatID, messageID,
+			fmt.Sprintf("🧹 Удалить неиспользуемые образы на %s(%s)?", server.Name, server.ID),
+			createPruneConfirmKeyboard(server.ID))
+
+	case "pruneok":
+		if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "Удаляю образы"); err != nil {
+			h.logger.Error("Failed to answer callback", "error", err)
+		}
+
+		var text string
+		pruned, err := h.containerService.PruneImages(ctx, mapping.UserID(user), callback.From.ID, server)
+		if err != nil {
+			text = agentErrorMessage(err, server, "❌ Не удалось удалить образы. Попробуйте позже.")
+		} else {
+			text = h.containerService.FormatPrune(server, pruned)
+		}
+		return h.telegramSvc.EditMessage(ctx, chatID, messageID, text, createImagesBackKeyboard(server.ID))
+
+	default:
+		h.logger.Warn("Unknown images action", "action", action)
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неизвестное действие")
+	}
+}
+
+// fetchImagesMessage retrieves images and builds the message with its keyboard.
+// The keyboard is nil when images could not be retrieved.
+func fetchImagesMessage(ctx context.Context, containerService *services.ContainerService, userID, telegramID int64, server *models.ServerWithDetails) (string, interface{}) {
+	images, err := containerService.ListImages(ctx, userID, telegramID, server)
+	if err != nil {
+		return agentErrorMessage(err, server, "❌ Не удалось получить список образов. Попробуйте позже."), nil
+	}
+
+	return containerService.FormatImages(server, images), createImagesKeyboard(server.ID, images)
+}
+
+// pullImageMessage pulls an image and returns the result message
+func pullImageMessage(ctx context.Context, containerService *services.ContainerService, userID, telegramID int64, server *models.ServerWithDetails, image string) string {
+	pulled, err := containerService.PullImage(ctx, userID, telegramID, server, image)
+	if err != nil {
+		if isCancelled(err) {
+			return ""
+		}
+		if agentReported(err, "not found") {
+			return fmt.Sprintf("❌ Образ %s не найден в реестре.", image)
+		}
+		return agentErrorMessage(err, server, fmt.Sprintf("❌ Не удалось загрузить образ %s. Попробуйте позже.", image))
+	}
+
+	return containerService.FormatPull(server, pulled)
+}
+
+// agentErrorMessage returns a user message for a failed agent command
+func agentErrorMessage(err error, server *models.ServerWithDetails, fallback string) string {
+	if role, ok := services.RequiredRole(err); ok && role == services.RoleOwner {
+		return fmt.Sprintf("⛔ Недостаточно прав на сервере %s: команда доступна владельцу сервера.", server.Name)
+	}
+	if errors.IsErrorCode(err, errors.ErrCodeForbidden) {
+		return fmt.Sprintf("⛔ Недостаточно прав на сервере %s: команда доступна администраторам сервера.", server.Name)
+	}
+	if since, offline := docker.OfflineSince(err); offline {
+		when := since.Format("15:04")
+		if since.Format("2006-01-02") != time.Now().Format("2006-01-02") {
+			when = since.Format("02.01 15:04")
+		}
+		return fmt.Sprintf("📴 Сервер %s, похоже, недоступен с %s. Команды будут отправляться снова, как только агент выйдет на связь.", server.Name, when)
+	}
+	if errors.IsErrorCode(err, errors.ErrCodeTimeout) {
+		return fmt.Sprintf("❌ Сервер %s не ответил вовремя. Попробуйте позже.", server.Name)
+	}
+	return fallback
+}
+
+// isRoleError reports whether err is the refusal of a role check of the services,
+// as opposed to other forbidden errors like commands missing from an allow-list
+func isRoleError(err error) bool {
+	_, ok := services.RequiredRole(err)
+	return ok
+}
+
+// agentReported reports whether err is a failure the agent replied with whose message
+// contains text. Agents describe failures in words only, unlike the ServerEye API, so
+// that errors of the bot itself are never mistaken for them.
+func agentReported(err error, text string) bool {
+	var appErr *errors.AppError
+	return stderrors.As(err, &appErr) && appErr.Details["service"] == "agent" && strings.Contains(appErr.Message, text)
+}
+
+// createImagesKeyboard creates inline keyboard with pull buttons, prune and refresh
+func createImagesKeyboard(serverID string, images []protocol.ImageInfo) interface{} {
+	var buttons [][]map[string]string
+
+	for _, img := range images {
+		if len(buttons) >= maxImageButtons {
+			break
+		}
+		if services.IsDanglingImage(img) {
+			continue
+		}
+		buttons = append(buttons, []map[string]string{
+			imagesCallback.Button(fmt.Sprintf("⬇️ Pull %s", services.ImageReference(img)), "pull", serverID, services.ShortImageID(img.ID)),
+		})
+	}
+
+	buttons = append(buttons, []map[string]string{
+		imagesCallback.Button("🧹 Prune", "prune", serverID),
+		imagesCallback.Button("🔄 Обновить", "list", serverID),
+	})
+
+	return buttons
+}
+
+// createPruneConfirmKeyboard creates inline keyboard confirming an image prune
+func createPruneConfirmKeyboard(serverID string) interface{} {
+	return [][]map[string]string{
+		{
+			imagesCallback.Button("✅ Удалить", "pruneok", serverID),
+			imagesCallback.Button("❌ Отмена", "list", serverID),
+		},
+	}
+}
+
+// createImagesBackKeyboard creates inline keyboard returning to the image list
+func createImagesBackKeyboard(serverID string) interface{} {
+	return [][]map[string]string{
+		{
+			imagesCallback.Button("🗂 К списку образов", "list", serverID),
+		},
+	}
+}
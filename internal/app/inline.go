@@ -0,0 +1,230 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/logger"
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/render"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/internal/telegram"
+	"github.com/servereye/servereyebot/pkg/domain"
+)
+
+const (
+	// inlineCacheTime is how long Telegram reuses an inline answer for the same query,
+	// so that typing does not fetch metrics on every keystroke
+	inlineCacheTime = 15 * time.Second
+
+	// maxInlineServers bounds the cards of a query without a server
+	maxInlineServers = 5
+)
+
+// inlineMetricAliases maps words of an inline query to metric types
+var inlineMetricAliases = map[string]string{
+	"cpu":         "cpu",
+	"memory":      "memory",
+	"mem":         "memory",
+	"ram":         "memory",
+	"disk":        "disk",
+	"temp":        "temperature",
+	"temperature": "temperature",
+	"network":     "network",
+	"net":         "network",
+	"system":      "system",
+	"sys":         "system",
+	"all":         "all",
+}
+
+// metricTitles names metric types in inline result titles
+var metricTitles = map[string]string{
+	"cpu":         "CPU",
+	"memory":      "Память",
+	"disk":        "Диски",
+	"temperature": "Температура",
+	"network":     "Сеть",
+	"system":      "Система",
+	"all":         "Сводка",
+}
+
+// formatMetric formats metrics of the given type, reporting whether the type is known
+func formatMetric(svc *services.MetricsServiceImpl, metricType string, metrics *domain.ServerMetrics) (string, bool) {
+	switch metricType {
+	case "cpu":
+		return svc.FormatCPU(metrics), true
+	case "memory":
+		return svc.FormatMemory(metrics), true
+	case "disk":
+		return svc.FormatDisk(metrics), true
+	case "temperature":
+		return svc.FormatTemperature(metrics), true
+	case "network":
+		return svc.FormatNetwork(metrics), true
+	case "system":
+		return svc.FormatSystem(metrics), true
+	case "all":
+		return svc.FormatAll(metrics), true
+	}
+	return "", false
+}
+
+// formatMetricOutput formats metrics of the given type in one line after the server name
+// when compact, in the detailed breakdown otherwise
+func formatMetricOutput(svc *services.MetricsServiceImpl, server *models.ServerWithDetails, metricType string, metrics *domain.ServerMetrics, compact bool) (string, bool) {
+	if !compact {
+		return formatMetric(svc, metricType, metrics)
+	}
+	formatted, ok := svc.FormatCompact(metricType, metrics)
+	if !ok {
+		return "", false
+	}
+	return string(render.Bold(server.Name)) + "\n" + formatted, true
+}
+
+// withMetricsAge appends how long ago the metrics were fetched to formatted metrics
+func withMetricsAge(formatted string, fetchedAt time.Time) string {
+	return formatted + "\n\n" + services.FormatMetricsAge(fetchedAt, time.Now())
+}
+
+// withLastKnownAge appends when kept metrics were fetched to metrics formatted while
+// their server is unreachable
+func withLastKnownAge(formatted string, fetchedAt time.Time, loc *time.Location) string {
+	return formatted + "\n\n" + services.FormatLastKnownAge(fetchedAt, time.Now(), loc)
+}
+
+// lastKnownMetrics returns the metrics kept from before a server became unreachable,
+// nil when none are kept
+func lastKnownMetrics(svc *services.MetricsServiceImpl, log logger.Logger, serverKey string) (*domain.LegacyMetricsResponse, time.Time) {
+	metrics, fetchedAt, err := svc.LastKnownMetrics(serverKey)
+	if err != nil {
+		log.Warn("Failed to read last known metrics", "error", err, "server_key", serverKey)
+		return nil, time.Time{}
+	}
+	return metrics, fetchedAt
+}
+
+// retryMetricsKeyboard creates the button that tries to fetch metrics of an unreachable
+// server again, replacing the last known ones
+func retryMetricsKeyboard(metricType, serverID, mode string) interface{} {
+	return [][]map[string]string{{
+		metricCallback.Button("🔁 Повторить", metricButtonParams(metricType, serverID, "refresh", mode)...),
+	}}
+}
+
+// refreshMetricsKeyboard creates the button that refetches metrics bypassing the cache,
+// keeping the output mode the metrics were requested in
+func refreshMetricsKeyboard(metricType, serverID, mode string) interface{} {
+	return [][]map[string]string{{
+		metricCallback.Button("🔄 Обновить", metricButtonParams(metricType, serverID, "refresh", mode)...),
+	}}
+}
+
+// metricButtonParams returns the callback parameters of a metric button, leaving out
+// empty options
+func metricButtonParams(metricType, serverID string, options ...string) []string {
+	params := []string{metricType, serverID}
+	for _, option := range options {
+		if option != "" {
+			params = append(params, option)
+		}
+	}
+	return params
+}
+
+// parseInlineQuery splits an inline query like "cpu web-01" into a metric type and a
+// server ID or name. Words may come in any order; the metric defaults to a summary.
+func parseInlineQuery(query string) (metricType, server string) {
+	var rest []string
+	for _, word := range strings.Fields(query) {
+		if alias, ok := inlineMetricAliases[strings.ToLower(word)]; ok && metricType == "" {
+			metricType = alias
+			continue
+		}
+		rest = append(rest, word)
+	}
+	if metricType == "" {
+		metricType = "all"
+	}
+	return metricType, strings.Join(rest, " ")
+}
+
+// handleInlineQuery answers @bot <metric> [server] typed in any chat with compact metric
+// cards of the user's servers. Users unknown to the bot get a button opening it instead.
+func (h *DefaultUpdateHandler) handleInlineQuery(ctx context.Context, query *telegram.InlineQuery) error {
+	metricType, serverArg := parseInlineQuery(query.Query)
+
+	if _, err := contextUser(ctx); err != nil {
+		return h.answerInlineSwitch(ctx, query.ID, "Откройте бота, чтобы добавить сервер")
+	}
+	_, servers, err := contextServers(ctx)
+	if err != nil {
+		return h.answerInlineSwitch(ctx, query.ID, "Не удалось получить серверы")
+	}
+	if len(servers) == 0 {
+		return h.answerInlineSwitch(ctx, query.ID, "Добавьте сервер в боте")
+	}
+
+	if serverArg != "" {
+		server := mapping.ServerByIDOrName(servers, serverArg)
+		if server == nil {
+			return h.answerInlineSwitch(ctx, query.ID, fmt.Sprintf("Сервер %s не найден", serverArg))
+		}
+		servers = []models.ServerWithDetails{*server}
+	}
+	if len(servers) > maxInlineServers {
+		servers = servers[:maxInlineServers]
+	}
+
+	// Telegram waits only a few seconds for the answer, so servers are fetched in parallel
+	results := make([]domain.InlineResult, len(servers))
+	var wg sync.WaitGroup
+	for i := range servers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = h.inlineResult(metricType, servers[i])
+		}(i)
+	}
+	wg.Wait()
+
+	return h.telegramSvc.AnswerInlineQuery(ctx, query.ID, domain.InlineAnswer{
+		Results:   results,
+		CacheTime: inlineCacheTime,
+	})
+}
+
+// inlineResult builds the metric card of a server. Cards are not audited: Telegram
+// requests them while the user types, and nothing is sent until a card is chosen.
+func (h *DefaultUpdateHandler) inlineResult(metricType string, server models.ServerWithDetails) domain.InlineResult {
+	result := domain.InlineResult{
+		ID:    metricType + ":" + server.ID,
+		Title: fmt.Sprintf("%s — %s", server.Name, metricTitles[metricType]),
+	}
+
+	metrics, fetchedAt, err := h.metricsService.GetCachedMetrics(server.ServerKey, metricType, false)
+	if err != nil {
+		h.logger.Error("Failed to get server metrics", "error", err, "server_id", server.ID)
+		result.Description = "Метрики недоступны"
+		result.Text = dependencyMessage(h.dependencies, fmt.Sprintf("❌ Не удалось получить метрики сервера %s", server.Name), nil, services.DependencyMetrics)
+		return result
+	}
+
+	formatted, _ := formatMetric(h.metricsService, metricType, &metrics.Metrics)
+	result.Description = h.metricsService.FormatInlineSummary(&metrics.Metrics)
+	result.Text = render.Escape(fmt.Sprintf("🖥️ %s (%s)", server.Name, server.ID)) + "\n\n" + withMetricsAge(formatted, fetchedAt)
+	result.Markdown = true
+	return result
+}
+
+// answerInlineSwitch answers an inline query without results, offering to open the bot
+func (h *DefaultUpdateHandler) answerInlineSwitch(ctx context.Context, queryID, text string) error {
+	return h.telegramSvc.AnswerInlineQuery(ctx, queryID, domain.InlineAnswer{
+		CacheTime:  inlineCacheTime,
+		SwitchText: text,
+	})
+}
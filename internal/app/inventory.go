@@ -0,0 +1,113 @@
+package app
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/internal/telegram"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// inventoryUsage explains the files the bot imports servers from
+const inventoryUsage = `📎 Отправьте файл .csv или .yaml со списком серверов, чтобы добавить их разом.
+
+CSV, по строке на сервер (имя необязательно):
+key,name
+srv_1a2b3c4d,Web 1
+
+YAML:
+servers:
+  - key: srv_1a2b3c4d
+    name: Web 1
+
+Выгрузить текущий список в этом формате: /export servers [csv|yaml]`
+
+// handleInventoryDocument imports the servers of a CSV or YAML file sent to the bot
+func (h *DefaultUpdateHandler) handleInventoryDocument(ctx context.Context, message *telegram.Message) error {
+	chatID := message.Chat.ID
+	document := message.Document
+
+	format := services.InventoryFormat(document.FileName)
+	if format == "" {
+		return h.telegramSvc.SendMessage(ctx, chatID, inventoryUsage)
+	}
+	if document.FileSize > services.MaxInventorySize {
+		return h.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Файл слишком большой. Максимальный размер: %d КБ.", services.MaxInventorySize>>10))
+	}
+
+	user, err := contextUser(ctx)
+	if err != nil {
+		return h.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+
+	data, err := h.telegramSvc.DownloadFile(ctx, document.FileID, services.MaxInventorySize)
+	if err != nil {
+		h.logger.Warn("Failed to download inventory", "error", err, "telegram_id", message.From.ID, "file", document.FileName)
+		return h.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось загрузить файл. Попробуйте еще раз.")
+	}
+
+	entries, invalid, err := services.ParseInventory(data, format)
+	if err != nil {
+		return h.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Не удалось прочитать файл: %s\n\n%s", parseErrorMessage(err), inventoryUsage))
+	}
+
+	_ = h.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("⏳ Импортирую серверы: %d...", len(entries)))
+	report, err := h.inventory.Import(ctx, mapping.UserID(user), message.From.ID, message.From.Username, message.From.FirstName, entries)
+	if err != nil {
+		h.logger.Error("Failed to import inventory", "error", err, "telegram_id", message.From.ID)
+		return h.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось импортировать серверы. Попробуйте позже.")
+	}
+
+	return h.telegramSvc.SendMessage(ctx, chatID, services.FormatImportReport(report, invalid))
+}
+
+// parseErrorMessage returns the message of an inventory parse error without its code
+func parseErrorMessage(err error) string {
+	var appErr *errors.AppError
+	if stderrors.As(err, &appErr) {
+		return appErr.Message
+	}
+	return err.Error()
+}
+
+// handleExportServersCommand sends the servers of the user as an inventory file, which
+// can be edited and sent back to import
+func (b *Bot) handleExportServersCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	format := services.InventoryCSV
+	if len(args) > 0 {
+		format = strings.ToLower(args[0])
+	}
+	if format == "yml" {
+		format = services.InventoryYAML
+	}
+	if len(args) > 1 || (format != services.InventoryCSV && format != services.InventoryYAML) {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Использование: /export servers [csv|yaml]")
+	}
+
+	user, err := contextUser(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+
+	data, count, err := b.inventoryService.Export(ctx, mapping.UserID(user), format)
+	if err != nil {
+		b.logger.Error("Failed to export servers", "error", err, "telegram_id", telegramID, "format", format)
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось выгрузить серверы. Попробуйте позже.")
+	}
+	if count == 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, "📭 У вас нет серверов. Отправьте боту файл .csv или .yaml, чтобы импортировать их.")
+	}
+
+	fileName := fmt.Sprintf("servereye-servers-%s.%s", time.Now().UTC().Format("20060102"), format)
+	return b.telegramSvc.SendDocument(ctx, chatID, fileName, data,
+		fmt.Sprintf("📎 Ваши серверы: %d. Отредактируйте файл и отправьте его боту, чтобы импортировать изменения.", count))
+}
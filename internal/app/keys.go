@@ -0,0 +1,113 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/httpserver"
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// rotateKeyResponse represents the reply to an agent key heartbeat
+type rotateKeyResponse struct {
+	Status     string `json:"status"`
+	ServerKey  string `json:"server_key,omitempty"` // key to switch to when status is "rotate"
+	Token      string `json:"token,omitempty"`      // bearer token of the new key
+	KeyVersion int    `json:"key_version,omitempty"`
+}
+
+// handleRotateKeyCommand issues a new agent key for one of the user's servers
+func (b *Bot) handleRotateKeyCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+
+	if len(args) == 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите сервер. Пример: /rotatekey srv_12313")
+	}
+	server := mapping.ServerByIDOrName(servers, args[0])
+	if server == nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Сервер `%s` не найден в вашем списке.", args[0]))
+	}
+
+	if err := b.keyService.Rotate(ctx, mapping.UserID(user), telegramID, server); err != nil {
+		if errors.IsErrorCode(err, errors.ErrCodeForbidden) {
+			return b.telegramSvc.SendMessage(ctx, chatID, "⛔ Заменить ключ сервера может только его владелец.")
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось выпустить новый ключ. Попробуйте позже.")
+	}
+
+	message := fmt.Sprintf(`🔑 Новый ключ для %s(%s) выпущен.
+
+Агент получит его при следующем heartbeat. После перехода агента старый ключ будет действовать еще %s, затем перестанет приниматься.`,
+		server.Name, server.ID, b.keyService.Grace())
+
+	return b.telegramSvc.SendMessage(ctx, chatID, message)
+}
+
+// handleRotateKeyRequest answers an authenticated agent heartbeat with the key it has to use
+func (b *Bot) handleRotateKeyRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpserver.MethodNotAllowed(w, r)
+		return
+	}
+
+	serverKey, _ := httpserver.AgentKey(r.Context())
+	heartbeat, err := b.keyService.Heartbeat(r.Context(), serverKey, time.Now())
+	if err != nil {
+		status := http.StatusBadGateway
+		if appErr, ok := err.(*errors.AppError); ok && appErr.HTTPStatus != 0 {
+			status = appErr.HTTPStatus
+		}
+		if status == http.StatusNotFound {
+			httpserver.WriteError(w, r, http.StatusUnauthorized, errors.ErrCodeUnauthorized, "unknown or revoked server key")
+			return
+		}
+		httpserver.WriteError(w, r, status, httpserver.ErrorCodeOf(err, errors.ErrCodeExternal), err.Error())
+		return
+	}
+
+	resp := rotateKeyResponse{
+		Status:     heartbeat.Status,
+		ServerKey:  heartbeat.Key,
+		KeyVersion: heartbeat.Version,
+	}
+	if heartbeat.Key != "" {
+		resp.Token = b.apiAuth.AgentToken(heartbeat.Key)
+	}
+	writeAgentResponse(w, http.StatusOK, resp)
+
+	if heartbeat.Status != services.KeyStatusRotated || heartbeat.Server.RotatedBy == 0 {
+		return
+	}
+
+	// The agent does not wait for the Telegram notification
+	notifyCtx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 30*time.Second)
+	go func() {
+		defer cancel()
+		message := fmt.Sprintf("✅ Агент сервера `%s` перешел на новый ключ (версия %d). Старый ключ перестанет действовать через %s.",
+			heartbeat.Server.ServerID, heartbeat.Version, b.keyService.Grace())
+		if err := b.telegramSvc.SendMessage(notifyCtx, heartbeat.Server.RotatedBy, message); err != nil {
+			b.logger.Error("Failed to notify about rotated key", "error", err, "telegram_id", heartbeat.Server.RotatedBy)
+		}
+	}()
+}
+
+// knownServerKey reports whether an agent key belongs to a server, for agent authentication
+func (b *Bot) knownServerKey(ctx context.Context, serverKey string) bool {
+	return b.keyService.Known(ctx, serverKey, time.Now())
+}
+
+// runKeyCleanup invalidates replaced server keys after their grace window
+func (b *Bot) runKeyCleanup(ctx context.Context, now time.Time) error {
+	return b.keyService.Cleanup(ctx, now)
+}
@@ -0,0 +1,224 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/httpserver"
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// maxLinkRequestSize limits the body of a web account link request
+const maxLinkRequestSize = 4096
+
+// accountTokenHeader carries the token of a linked account on requests of ServerEye-Web,
+// whose own token is sent in the Authorization header
+const accountTokenHeader = "X-Account-Token"
+
+// linkUsage is shown when /link arguments cannot be parsed
+const linkUsage = `🌐 *ServerEye-Web*
+
+/link - Получить код для привязки веб-аккаунта
+/link status - Показать привязанный веб-аккаунт
+/link revoke - Отвязать веб-аккаунт
+
+После привязки веб-интерфейс и бот используют одного пользователя и один список серверов.`
+
+// linkRequest represents the body of a web account link request
+type linkRequest struct {
+	Code      string `json:"code"`
+	WebUserID string `json:"web_user_id"`
+}
+
+// linkResponse represents the reply to a web account link request
+type linkResponse struct {
+	Status     string `json:"status"`
+	UserID     int64  `json:"user_id,omitempty"`
+	TelegramID int64  `json:"telegram_id,omitempty"`
+	Token      string `json:"token,omitempty"` // sent in the X-Account-Token header of linked account requests
+}
+
+// accountServer represents a server of a linked account. Agent keys are not exposed.
+type accountServer struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Role        string    `json:"role"`
+	AddedAt     time.Time `json:"added_at"`
+}
+
+// accountServersResponse represents the identity and server list of a linked account
+type accountServersResponse struct {
+	UserID     int64           `json:"user_id"`
+	TelegramID int64           `json:"telegram_id"`
+	WebUserID  string          `json:"web_user_id"`
+	Username   string          `json:"username,omitempty"`
+	Servers    []accountServer `json:"servers"`
+}
+
+// handleLinkCommand links a ServerEye-Web account to the user or manages the linked one
+func (b *Bot) handleLinkCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	user, err := contextUser(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+
+	if len(args) > 1 {
+		return b.telegramSvc.SendMessage(ctx, chatID, linkUsage)
+	}
+
+	if len(args) == 1 {
+		switch args[0] {
+		case "status":
+			account, err := b.linkService.Get(ctx, mapping.UserID(user))
+			if err != nil {
+				return b.telegramSvc.SendMessage(ctx, chatID, dependencyMessage(b.dependencyService, "❌ Не удалось получить привязанный аккаунт. Попробуйте позже.", nil, services.DependencyDatabase))
+			}
+			if account == nil {
+				return b.telegramSvc.SendMessage(ctx, chatID, "🌐 Веб-аккаунт не привязан.\n\nИспользуйте /link для получения кода.")
+			}
+			message := fmt.Sprintf("🌐 Привязан веб-аккаунт `%s` с %s UTC.", account.WebUserID, account.CreatedAt.UTC().Format("2006-01-02 15:04"))
+			if account.LastUsedAt != nil {
+				message += fmt.Sprintf("\nПоследнее обращение: %s UTC.", account.LastUsedAt.UTC().Format("2006-01-02 15:04"))
+			}
+			return b.telegramSvc.SendMessage(ctx, chatID, message)
+
+		case "revoke":
+			removed, err := b.linkService.Unlink(ctx, mapping.UserID(user), telegramID)
+			if err != nil {
+				return b.telegramSvc.SendMessage(ctx, chatID, dependencyMessage(b.dependencyService, "❌ Не удалось отвязать веб-аккаунт. Попробуйте позже.", nil, services.DependencyDatabase))
+			}
+			if !removed {
+				return b.telegramSvc.SendMessage(ctx, chatID, "🌐 Веб-аккаунт не привязан.")
+			}
+			return b.telegramSvc.SendMessage(ctx, chatID, "✅ Веб-аккаунт отвязан, его токен больше не действует.")
+
+		default:
+			return b.telegramSvc.SendMessage(ctx, chatID, linkUsage)
+		}
+	}
+
+	link, err := b.linkService.CreateCode(ctx, mapping.UserID(user), telegramID)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось создать код привязки. Попробуйте позже.")
+	}
+
+	message := fmt.Sprintf(`🌐 *Код для ServerEye-Web: %s*
+
+Введите код в настройках аккаунта веб-интерфейса. После привязки веб-интерфейс покажет ваши серверы из бота.
+
+Код одноразовый и действует %d мин. Ранее привязанный веб-аккаунт будет заменен.`,
+		link.Code, int(b.linkService.TTL().Minutes()))
+
+	return b.telegramSvc.SendMessage(ctx, chatID, message)
+}
+
+// handleLinkRequest exchanges a /link code entered in ServerEye-Web for a token identifying
+// the bot user. The web app authenticates with its own token.
+func (b *Bot) handleLinkRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpserver.MethodNotAllowed(w, r)
+		return
+	}
+
+	var req linkRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxLinkRequestSize)).Decode(&req); err != nil {
+		httpserver.WriteError(w, r, http.StatusBadRequest, errors.ErrCodeInvalidInput, "invalid request body")
+		return
+	}
+
+	account, token, err := b.linkService.Link(r.Context(), req.Code, req.WebUserID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if appErr, ok := err.(*errors.AppError); ok && appErr.HTTPStatus != 0 {
+			status = appErr.HTTPStatus
+		}
+		if status == http.StatusNotFound {
+			httpserver.RequestLogger(b.logger, r).Warn("Account link with unknown or expired code", "web_user_id", req.WebUserID)
+			httpserver.WriteError(w, r, status, errors.ErrCodeNotFound, "invalid or expired link code")
+			return
+		}
+		httpserver.WriteError(w, r, status, httpserver.ErrorCodeOf(err, errors.ErrCodeInternal), err.Error())
+		return
+	}
+
+	writeAgentResponse(w, http.StatusOK, linkResponse{Status: "linked", UserID: account.UserID, TelegramID: account.TelegramID, Token: token})
+
+	// The web app does not wait for the Telegram notification
+	notifyCtx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 30*time.Second)
+	go func() {
+		defer cancel()
+		message := fmt.Sprintf("✅ Веб-аккаунт `%s` привязан. Используйте /link revoke, чтобы отвязать его.", account.WebUserID)
+		if err := b.telegramSvc.SendMessage(notifyCtx, account.TelegramID, message); err != nil {
+			b.logger.Error("Failed to notify about linked account", "error", err, "telegram_id", account.TelegramID)
+		}
+	}()
+}
+
+// handleAccountServersRequest returns the identity and server list of the linked account
+// whose token ServerEye-Web sends in the X-Account-Token header
+func (b *Bot) handleAccountServersRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpserver.MethodNotAllowed(w, r)
+		return
+	}
+
+	account, err := b.linkService.Authenticate(r.Context(), strings.TrimSpace(r.Header.Get(accountTokenHeader)))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if appErr, ok := err.(*errors.AppError); ok && appErr.HTTPStatus != 0 {
+			status = appErr.HTTPStatus
+		}
+		httpserver.WriteError(w, r, status, httpserver.ErrorCodeOf(err, errors.ErrCodeInternal), err.Error())
+		return
+	}
+
+	adapter, ok := b.userService.(*services.UserServiceAdapter)
+	if !ok {
+		httpserver.WriteError(w, r, http.StatusInternalServerError, errors.ErrCodeInternal, "user service unavailable")
+		return
+	}
+
+	resp := accountServersResponse{
+		UserID:     account.UserID,
+		TelegramID: account.TelegramID,
+		WebUserID:  account.WebUserID,
+		Servers:    []accountServer{},
+	}
+	if user, err := adapter.GetUser(r.Context(), account.TelegramID); err == nil {
+		resp.Username = user.Username
+	}
+
+	servers, err := adapter.GetUserServers(r.Context(), account.UserID)
+	if err != nil {
+		httpserver.RequestLogger(b.logger, r).Error("Failed to get linked account servers", "error", err, "user_id", account.UserID)
+		httpserver.WriteError(w, r, http.StatusInternalServerError, errors.ErrCodeInternal, "failed to get servers")
+		return
+	}
+	for _, server := range servers {
+		resp.Servers = append(resp.Servers, accountServer{
+			ID:          server.ID,
+			Name:        server.Name,
+			Description: server.Description,
+			Role:        server.Role,
+			AddedAt:     server.AddedAt,
+		})
+	}
+
+	writeAgentResponse(w, http.StatusOK, resp)
+}
+
+// runAccountLinkCleanup removes expired account link codes
+func (b *Bot) runAccountLinkCleanup(ctx context.Context, now time.Time) error {
+	return b.linkService.Cleanup(ctx, now)
+}
@@ -0,0 +1,318 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/callbacks"
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/render"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/internal/telegram"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+const (
+	// liveMaxFailures is the number of refreshes in a row that may fail before a live
+	// dashboard gives up on an unreachable server
+	liveMaxFailures = 3
+
+	// liveEditTimeout bounds the final edit of a dashboard, made after its context ended
+	liveEditTimeout = 10 * time.Second
+)
+
+// liveUsage is shown when /live arguments cannot be parsed
+const liveUsage = `📡 *Live-метрики*
+
+/live [server_id] [cpu|memory|disk|temperature|network|all] - сообщение с метриками, которое обновляется само
+
+Кнопка «Остановить» завершает обновление раньше срока. В чате может быть одна live-панель: новая заменяет предыдущую.`
+
+// liveKey identifies a live dashboard by its message
+type liveKey struct {
+	chatID    int64
+	messageID int
+}
+
+// liveSession is a live dashboard being refreshed
+type liveSession struct {
+	telegramID int64 // user who started the dashboard
+	cancel     context.CancelFunc
+}
+
+// liveDashboards tracks the live dashboards being refreshed, at most one per chat so that
+// edits stay within the limits Telegram puts on a chat
+type liveDashboards struct {
+	mu       sync.Mutex
+	sessions map[liveKey]*liveSession
+	wg       sync.WaitGroup
+	stopped  bool
+}
+
+// newLiveDashboards creates an empty set of live dashboards
+func newLiveDashboards() *liveDashboards {
+	return &liveDashboards{sessions: make(map[liveKey]*liveSession)}
+}
+
+// start runs refresh for the dashboard of a message until it returns, replacing the
+// dashboard the chat already has. It reports false without running refresh when max
+// dashboards are already refreshed or the bot is stopping.
+func (d *liveDashboards) start(key liveKey, telegramID int64, max int, refresh func(ctx context.Context)) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.stopped {
+		return false
+	}
+	for other, session := range d.sessions {
+		if other.chatID == key.chatID {
+			session.cancel()
+			delete(d.sessions, other)
+		}
+	}
+	if len(d.sessions) >= max {
+		return false
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	session := &liveSession{telegramID: telegramID, cancel: cancel}
+	d.sessions[key] = session
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		defer d.remove(key, session)
+		refresh(ctx)
+	}()
+	return true
+}
+
+// remove forgets a dashboard that stopped refreshing, unless it was already replaced
+func (d *liveDashboards) remove(key liveKey, session *liveSession) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	session.cancel()
+	if d.sessions[key] == session {
+		delete(d.sessions, key)
+	}
+}
+
+// stop stops the dashboard of a message on behalf of a user. Only the user who started
+// the dashboard may stop it.
+func (d *liveDashboards) stop(key liveKey, telegramID int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	session, ok := d.sessions[key]
+	if !ok {
+		return errors.NewNotFoundError("live dashboard")
+	}
+	if session.telegramID != telegramID {
+		return errors.NewForbiddenError("live dashboard was started by another user")
+	}
+
+	session.cancel()
+	delete(d.sessions, key)
+	return nil
+}
+
+// Stop stops all dashboards and waits for their final edits until ctx is done
+func (d *liveDashboards) Stop(ctx context.Context) error {
+	d.mu.Lock()
+	d.stopped = true
+	for key, session := range d.sessions {
+		session.cancel()
+		delete(d.sessions, key)
+	}
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// createLiveKeyboard creates inline keyboard stopping a live dashboard
+func createLiveKeyboard() interface{} {
+	return [][]map[string]string{{
+		liveCallback.Button("⏹ Остановить", "stop"),
+	}}
+}
+
+// liveFooter describes how a live dashboard is refreshed, in MarkdownV2
+func liveFooter(interval time.Duration, until, fetchedAt time.Time, warning string) string {
+	var sb strings.Builder
+	if warning != "" {
+		sb.WriteString(string(render.Text(warning)))
+		sb.WriteString("\n")
+	}
+	sb.WriteString(string(render.Italic(fmt.Sprintf("🔴 Live: обновлено в %s UTC, каждые %s до %s UTC",
+		fetchedAt.UTC().Format("15:04:05"), interval, until.UTC().Format("15:04:05")))))
+	return sb.String()
+}
+
+// handleLiveCommand posts metrics of a server and keeps editing the message with fresh
+// metrics for a few minutes, giving a dashboard refreshed in place
+func (b *Bot) handleLiveCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	user, err := contextUser(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, dependencyMessage(b.dependencyService, "❌ Внутренняя ошибка. Попробуйте позже.", nil, services.DependencyDatabase))
+	}
+
+	servers, err := chatServers(ctx, b.chatService, telegramID, chatID)
+	if err != nil {
+		b.logger.Error("Failed to get user servers", "error", err, "user_id", user.ID)
+		return b.telegramSvc.SendMessage(ctx, chatID, dependencyMessage(b.dependencyService, "❌ Произошла ошибка при получении списка серверов. Попробуйте позже.", nil, services.DependencyDatabase))
+	}
+	if len(servers) == 0 {
+		if isGroupChat(chatID, telegramID) {
+			return b.telegramSvc.SendMessage(ctx, chatID, services.FormatChatServers(nil))
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, "📭 У вас нет добавленных серверов.\n\nИспользуйте /add <server_id> для добавления сервера.")
+	}
+
+	server, args := resolveServerArg(servers, args)
+	if server == nil {
+		if defaultID := b.userSettings(ctx, mapping.UserID(user)).DefaultServerID; defaultID != "" {
+			server = mapping.ServerByID(servers, defaultID)
+		}
+	}
+	if server == nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите сервер.\n\n"+liveUsage)
+	}
+
+	metricType := "all"
+	if len(args) > 0 {
+		alias, ok := inlineMetricAliases[strings.ToLower(args[0])]
+		if !ok || len(args) > 1 {
+			return b.telegramSvc.SendMessage(ctx, chatID, liveUsage)
+		}
+		metricType = alias
+	}
+
+	started := time.Now()
+	metrics, fetchedAt, err := b.metricsService.GetCachedMetrics(server.ServerKey, metricType, true)
+	b.auditService.RecordResult(ctx, mapping.UserID(user), telegramID, server.ID, services.AuditCommandMetrics, "type="+metricType+" live", "", started, err)
+	if err != nil {
+		b.logger.Error("Failed to get server metrics", "error", err, "server_key", server.ServerKey)
+		return b.telegramSvc.SendMessage(ctx, chatID, dependencyMessage(b.dependencyService, fmt.Sprintf("❌ Не удалось получить метрики для сервера `%s`. Попробуйте позже.", server.ID), b.userLocation(ctx, mapping.UserID(user)), services.DependencyMetrics))
+	}
+
+	formatted, _ := formatMetric(b.metricsService, metricType, &metrics.Metrics)
+	interval, duration := b.config.Live.Interval, b.config.Live.Duration
+	until := time.Now().Add(duration)
+
+	messageID, err := b.telegramSvc.SendMarkdownMessage(ctx, chatID, formatted+"\n\n"+liveFooter(interval, until, fetchedAt, ""), createLiveKeyboard())
+	if err != nil {
+		return err
+	}
+
+	key := liveKey{chatID: chatID, messageID: messageID}
+	live := b.live.start(key, telegramID, b.config.Live.MaxSessions, func(ctx context.Context) {
+		b.refreshLive(ctx, key, server, metricType, formatted, interval, until)
+	})
+	if !live {
+		return b.telegramSvc.EditMarkdown(ctx, chatID, messageID, withMetricsAge(formatted, fetchedAt)+"\n\n"+string(render.Text("⚠️ Сейчас открыто слишком много live-панелей, метрики не будут обновляться. Попробуйте позже.")), refreshMetricsKeyboard(metricType, server.ID, ""))
+	}
+	return nil
+}
+
+// refreshLive edits a live dashboard with fresh metrics every interval until ctx is
+// cancelled, until is reached or the server stops answering, then leaves the last
+// metrics with a refresh button
+func (b *Bot) refreshLive(ctx context.Context, key liveKey, server *models.ServerWithDetails, metricType, formatted string, interval time.Duration, until time.Time) {
+	deadline, cancel := context.WithDeadline(ctx, until)
+	defer cancel()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	fetchedAt := time.Now()
+	failures := 0
+	for {
+		select {
+		case <-deadline.Done():
+			reason := "⏹ Live-режим завершен."
+			if ctx.Err() != nil {
+				reason = "⏹ Live-режим остановлен."
+			}
+			b.finishLive(key, server, metricType, formatted, fetchedAt, reason)
+			return
+		case <-ticker.C:
+		}
+
+		metrics, at, err := b.metricsService.GetCachedMetrics(server.ServerKey, metricType, true)
+		warning := ""
+		if err != nil {
+			failures++
+			b.logger.Warn("Failed to refresh live dashboard", "error", err, "server_key", server.ServerKey, "failures", failures)
+			if failures >= liveMaxFailures {
+				b.finishLive(key, server, metricType, formatted, fetchedAt, "⚠️ Сервер не отвечает, live-режим остановлен.")
+				return
+			}
+			warning = "⚠️ Не удалось обновить метрики, показаны последние полученные."
+		} else {
+			failures = 0
+			fetchedAt = at
+			formatted, _ = formatMetric(b.metricsService, metricType, &metrics.Metrics)
+		}
+
+		text := formatted + "\n\n" + liveFooter(interval, until, fetchedAt, warning)
+		if err := b.telegramSvc.EditMarkdown(deadline, key.chatID, key.messageID, text, createLiveKeyboard()); err != nil {
+			if deadline.Err() != nil {
+				continue // the dashboard ended while the edit was waiting its turn
+			}
+			// The message is most likely deleted; there is nothing left to refresh
+			b.logger.Warn("Failed to edit live dashboard, stopping it", "error", err, "chat_id", key.chatID, "message_id", key.messageID)
+			return
+		}
+	}
+}
+
+// finishLive replaces the stop button of a dashboard that stopped refreshing with the
+// button refreshing metrics on demand
+func (b *Bot) finishLive(key liveKey, server *models.ServerWithDetails, metricType, formatted string, fetchedAt time.Time, reason string) {
+	ctx, cancel := context.WithTimeout(context.Background(), liveEditTimeout)
+	defer cancel()
+
+	text := withMetricsAge(formatted, fetchedAt) + "\n" + string(render.Italic(reason))
+	if err := b.telegramSvc.EditMarkdown(ctx, key.chatID, key.messageID, text, refreshMetricsKeyboard(metricType, server.ID, "")); err != nil {
+		b.logger.Warn("Failed to finish live dashboard", "error", err, "chat_id", key.chatID, "message_id", key.messageID)
+	}
+}
+
+// handleLiveCallback stops the live dashboard the button belongs to
+func (h *DefaultUpdateHandler) handleLiveCallback(ctx context.Context, callback *telegram.CallbackQuery, data callbacks.Data) error {
+	// Parse callback data: live:stop
+	if data.Param(0) != "stop" {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неверный формат данных")
+	}
+
+	key := liveKey{chatID: callback.Message.Chat.ID, messageID: callback.Message.MessageID}
+	err := h.live.stop(key, callback.From.ID)
+	switch {
+	case errors.IsErrorCode(err, errors.ErrCodeNotFound):
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "Live-режим уже завершен")
+	case errors.IsErrorCode(err, errors.ErrCodeForbidden):
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "⛔ Остановить может только тот, кто запустил live-режим")
+	}
+
+	return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "⏹ Live-режим остановлен")
+}
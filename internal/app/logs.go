@@ -0,0 +1,158 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/servereye/servereyebot/internal/callbacks"
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/internal/telegram"
+	"github.com/servereye/servereyebot/pkg/domain"
+)
+
+// Container logs line limits
+const (
+	defaultLogLines = 50
+	maxLogLines     = 1000
+)
+
+// logsUsage is shown when /logs arguments cannot be parsed
+const logsUsage = `📄 *Логи контейнера*
+
+/logs <container> [lines] - Последние строки логов
+/logs <server_id> <container> [lines] - Если у вас несколько серверов`
+
+// handleLogsCommand shows the last lines of docker logs of a container
+func (b *Bot) handleLogsCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+
+	if len(servers) == 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ У вас нет добавленных серверов. Используйте /add <server_id> для добавления сервера.")
+	}
+
+	server, args := resolveServerArg(servers, args)
+	if server == nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите сервер.\n\n"+logsUsage)
+	}
+
+	if len(args) < 1 {
+		return b.telegramSvc.SendMessage(ctx, chatID, logsUsage)
+	}
+
+	container := args[0]
+	lines := defaultLogLines
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			return b.telegramSvc.SendMessage(ctx, chatID, logsUsage)
+		}
+		lines = n
+	}
+	if lines > maxLogLines {
+		lines = maxLogLines
+	}
+
+	text, keyboard := fetchLogsMessage(ctx, b.containerService, mapping.UserID(user), telegramID, server, container, lines)
+	if keyboard == nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, text)
+	}
+	return b.telegramSvc.SendMessageWithKeyboard(ctx, chatID, text, keyboard)
+}
+
+// handleLogsCallback handles refresh and more buttons of container logs
+func (h *DefaultUpdateHandler) handleLogsCallback(ctx context.Context, callback *telegram.CallbackQuery, data callbacks.Data) error {
+	// Parse callback data: logs:server_id:container:lines
+	params := data.Params
+	if len(params) != 3 {
+		h.logger.Error("Invalid callback data format", "params", params)
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неверный формат данных")
+	}
+
+	serverID, container := params[0], params[1]
+	lines, err := strconv.Atoi(params[2])
+	if err != nil || lines < 1 {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неверный формат данных")
+	}
+	if lines > maxLogLines {
+		lines = maxLogLines
+	}
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Внутренняя ошибка")
+	}
+
+	server := mapping.ServerByID(servers, serverID)
+	if server == nil {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Сервер не найден")
+	}
+
+	if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "Обновляю логи"); err != nil {
+		h.logger.Error("Failed to answer callback", "error", err)
+	}
+
+	text, keyboard := fetchLogsMessage(ctx, h.containerService, mapping.UserID(user), callback.From.ID, server, container, lines)
+	return h.telegramSvc.EditMessage(ctx, callback.Message.Chat.ID, callback.Message.MessageID, text, keyboard)
+}
+
+// fetchLogsMessage retrieves container logs and builds the message with its keyboard.
+// The keyboard is nil when logs could not be retrieved.
+func fetchLogsMessage(ctx context.Context, containerService *services.ContainerService, userID, telegramID int64, server *models.ServerWithDetails, container string, lines int) (string, interface{}) {
+	logs, err := containerService.GetLogs(ctx, userID, telegramID, server, container, lines)
+	if err != nil {
+		if agentReported(err, "not found") {
+			return fmt.Sprintf("❌ Контейнер `%s` не найден на сервере %s.", container, server.Name), nil
+		}
+		return agentErrorMessage(err, server, "❌ Не удалось получить логи контейнера. Попробуйте позже."), nil
+	}
+
+	return containerService.FormatLogs(server, logs, lines), createLogsKeyboard(server.ID, container, lines)
+}
+
+// createLogsKeyboard creates inline keyboard with refresh and more buttons for container logs
+func createLogsKeyboard(serverID, container string, lines int) interface{} {
+	more := lines * 2
+	if more > maxLogLines {
+		more = maxLogLines
+	}
+
+	row := []map[string]string{
+		logsCallback.Button("🔄 Обновить", serverID, container, strconv.Itoa(lines)),
+	}
+	if more > lines {
+		row = append(row, logsCallback.Button("➕ Больше", serverID, container, strconv.Itoa(more)))
+	}
+
+	return [][]map[string]string{
+		row,
+		{
+			containerStatsCallback.Button("📈 Stats", "new", serverID),
+		},
+	}
+}
+
+// resolveServerArg picks the server for a command. With a single server it is used directly,
+// otherwise the first argument must be the ID or the unique name of one of the servers and
+// is consumed.
+func resolveServerArg(servers []models.ServerWithDetails, args []string) (*models.ServerWithDetails, []string) {
+	if len(args) > 0 {
+		if server := mapping.ServerByIDOrName(servers, args[0]); server != nil {
+			return server, args[1:]
+		}
+	}
+
+	if len(servers) == 1 {
+		return &servers[0], args
+	}
+
+	return nil, args
+}
@@ -0,0 +1,160 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/httpserver"
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// maxLogMatchRequestSize limits the body of an agent log match report
+const maxLogMatchRequestSize = 64 * 1024
+
+// logWatchUsage is shown when /logwatch arguments cannot be parsed
+const logWatchUsage = `📜 *Отслеживание логов*
+
+/logwatch [server_id] - Отслеживаемые логи сервера
+/logwatch [server_id] add <файл> <шаблон> - Алерт о новых строках файла по шаблону, например /logwatch add /var/log/syslog OOM
+/logwatch [server_id] remove <id> - Перестать отслеживать
+
+Шаблон - регулярное выражение. Агент читает новые строки файла и сообщает совпадения. Одинаковые строки не повторяются в течение часа, а частые совпадения собираются в сводку. Отслеживать логи может владелец сервера.`
+
+// logWatchesResponse represents the reply to an agent fetching its log watches
+type logWatchesResponse struct {
+	Status  string              `json:"status"`
+	Watches []protocol.LogWatch `json:"watches,omitempty"`
+}
+
+// handleLogWatchCommand lists, adds and removes the log files watched on a server
+func (b *Bot) handleLogWatchCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+
+	if len(servers) == 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ У вас нет добавленных серверов. Используйте /add <server_id> для добавления сервера.")
+	}
+
+	server, args := resolveServerArg(servers, args)
+	if server == nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите сервер.\n\n"+logWatchUsage)
+	}
+
+	if len(args) == 0 {
+		watches, err := b.logWatches.List(ctx, server.ID)
+		if err != nil {
+			b.logger.Error("Failed to list log watches", "error", err, "server_id", server.ID)
+			return b.telegramSvc.SendMessage(ctx, chatID, dependencyMessage(b.dependencyService, "❌ Не удалось получить отслеживаемые логи. Попробуйте позже.", nil, services.DependencyDatabase))
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, services.FormatLogWatches(server, watches))
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "add":
+		if len(args) < 3 {
+			return b.telegramSvc.SendMessage(ctx, chatID, logWatchUsage)
+		}
+
+		watch, synced, err := b.logWatches.Add(ctx, mapping.UserID(user), telegramID, server, args[1], strings.Join(args[2:], " "))
+		if err != nil {
+			switch {
+			case errors.IsErrorCode(err, errors.ErrCodeForbidden):
+				return b.telegramSvc.SendMessage(ctx, chatID, "⛔ Отслеживать логи сервера может только его владелец.")
+			case errors.IsErrorCode(err, errors.ErrCodeValidation):
+				return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите абсолютный путь к файлу и корректное регулярное выражение (до 255 символов). На сервере может быть не больше 20 отслеживаемых логов.")
+			}
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось сохранить отслеживание. Попробуйте позже.")
+		}
+
+		message := fmt.Sprintf("✅ #%d: новые строки %s на %s(%s) по шаблону %s придут алертом.", watch.ID, watch.Path, server.Name, server.ID, watch.Pattern)
+		if !synced {
+			message += "\n\n⚠️ Агент сейчас недоступен и получит изменения при следующем подключении."
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, message)
+
+	case "remove":
+		if len(args) != 2 {
+			return b.telegramSvc.SendMessage(ctx, chatID, logWatchUsage)
+		}
+		id, err := strconv.ParseInt(strings.TrimPrefix(args[1], "#"), 10, 64)
+		if err != nil {
+			return b.telegramSvc.SendMessage(ctx, chatID, logWatchUsage)
+		}
+
+		removed, synced, err := b.logWatches.Remove(ctx, mapping.UserID(user), telegramID, server, id)
+		if err != nil {
+			if errors.IsErrorCode(err, errors.ErrCodeForbidden) {
+				return b.telegramSvc.SendMessage(ctx, chatID, "⛔ Удалять отслеживание логов может только владелец сервера.")
+			}
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось удалить отслеживание. Попробуйте позже.")
+		}
+		if !removed {
+			return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Отслеживание #%d не найдено.", id))
+		}
+
+		message := fmt.Sprintf("✅ Отслеживание #%d удалено.", id)
+		if !synced {
+			message += "\n\n⚠️ Агент сейчас недоступен и получит изменения при следующем подключении."
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, message)
+
+	default:
+		return b.telegramSvc.SendMessage(ctx, chatID, logWatchUsage)
+	}
+}
+
+// handleLogWatchesRequest serves the log watches of an authenticated agent on GET, which
+// agents do on start, and takes reports of matching lines on POST
+func (b *Bot) handleLogWatchesRequest(w http.ResponseWriter, r *http.Request) {
+	serverKey, _ := httpserver.AgentKey(r.Context())
+
+	switch r.Method {
+	case http.MethodGet:
+		watches, err := b.logWatches.ForAgent(r.Context(), serverKey)
+		if err != nil {
+			httpserver.RequestLogger(b.logger, r).Error("Failed to list log watches for agent", "error", err)
+			httpserver.WriteError(w, r, http.StatusBadGateway, errors.ErrCodeExternal, "failed to list log watches")
+			return
+		}
+		writeAgentResponse(w, http.StatusOK, logWatchesResponse{Status: "ok", Watches: watches})
+
+	case http.MethodPost:
+		var report protocol.LogMatchReport
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxLogMatchRequestSize)).Decode(&report); err != nil {
+			httpserver.WriteError(w, r, http.StatusBadRequest, errors.ErrCodeInvalidInput, "invalid request body")
+			return
+		}
+
+		notifications, err := b.logWatches.Matched(r.Context(), serverKey, report, time.Now())
+		if err != nil {
+			httpserver.RequestLogger(b.logger, r).Error("Failed to process log matches", "error", err)
+			httpserver.WriteError(w, r, http.StatusBadGateway, errors.ErrCodeExternal, "failed to process log matches")
+			return
+		}
+		writeAgentResponse(w, http.StatusOK, logWatchesResponse{Status: "ok"})
+
+		// The agent does not wait for the alerts
+		alertCtx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 30*time.Second)
+		go func() {
+			defer cancel()
+			b.deliverAlerts(alertCtx, notifications)
+		}()
+
+	default:
+		httpserver.MethodNotAllowed(w, r)
+	}
+}
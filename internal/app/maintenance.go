@@ -0,0 +1,99 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// maintenanceUsage is shown when /maintenance arguments cannot be parsed
+const maintenanceUsage = `🛠️ *Обслуживание серверов*
+
+/maintenance - Серверы на обслуживании
+/maintenance [server_id] <длительность> - Начать обслуживание, например /maintenance srv_12313 2h
+/maintenance end [server_id] - Завершить обслуживание досрочно
+
+Во время обслуживания алерты сервера не приходят сразу, а собираются в сводку, которая придет после его окончания. В /servers сервер отмечен значком 🛠.`
+
+// maintenanceOwnerMessage is shown to users who may not put a server into maintenance
+const maintenanceOwnerMessage = "⛔ Объявлять обслуживание сервера может только его владелец."
+
+// handleMaintenanceCommand manages one-off maintenance windows holding alerts of servers
+func (b *Bot) handleMaintenanceCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	_, servers, err := contextServers(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+	if len(servers) == 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, "📭 У вас нет добавленных серверов.\n\nИспользуйте /add <server_id> для добавления сервера.")
+	}
+
+	now := time.Now()
+	if len(args) == 0 || strings.ToLower(args[0]) == "list" {
+		var lines []string
+		for _, server := range servers {
+			if end, ok := b.deploymentWindows.InMaintenance(server.ID, now); ok {
+				lines = append(lines, fmt.Sprintf("🛠 %s(%s) — еще %s", server.Name, server.ID, end.Sub(now).Round(time.Minute)))
+			}
+		}
+		if len(lines) == 0 {
+			return b.telegramSvc.SendMessage(ctx, chatID, "🛠️ Серверов на обслуживании нет.\n\nНачать обслуживание: /maintenance <server_id> 2h")
+		}
+		sort.Strings(lines)
+		return b.telegramSvc.SendMessage(ctx, chatID, "🛠️ На обслуживании:\n\n"+strings.Join(lines, "\n"))
+	}
+
+	ending := strings.ToLower(args[0]) == "end"
+	if ending {
+		args = args[1:]
+	}
+
+	server, rest := resolveServerArg(servers, args)
+	if server == nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите сервер. Пример: /maintenance srv_12313 2h")
+	}
+
+	if ending {
+		ended, err := b.deploymentWindows.EndMaintenance(ctx, server, now)
+		if err != nil {
+			if errors.IsErrorCode(err, errors.ErrCodeForbidden) {
+				return b.telegramSvc.SendMessage(ctx, chatID, maintenanceOwnerMessage)
+			}
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось завершить обслуживание. Попробуйте позже.")
+		}
+		if !ended {
+			return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("ℹ️ Сервер %s не на обслуживании.", server.Name))
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("✅ Обслуживание сервера %s завершено. Алерты за время обслуживания придут сводкой.", server.Name))
+	}
+
+	if len(rest) != 1 {
+		return b.telegramSvc.SendMessage(ctx, chatID, maintenanceUsage)
+	}
+	duration, err := time.ParseDuration(rest[0])
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите длительность, например 30m или 2h.")
+	}
+
+	window, err := b.deploymentWindows.StartMaintenance(ctx, server, telegramID, duration, now)
+	if err != nil {
+		if errors.IsErrorCode(err, errors.ErrCodeForbidden) {
+			return b.telegramSvc.SendMessage(ctx, chatID, maintenanceOwnerMessage)
+		}
+		if errors.IsErrorCode(err, errors.ErrCodeValidation) {
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Обслуживание может длиться от минуты до 7 дней.")
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось начать обслуживание. Попробуйте позже.")
+	}
+
+	return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("🛠 Сервер %s на обслуживании до %s UTC.\n\nАлерты сервера придут сводкой после окончания. Завершить досрочно: /maintenance end %s",
+		server.Name, window.EndsAt.UTC().Format("02.01.2006 15:04"), server.ID))
+}
@@ -0,0 +1,39 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/servereye/servereyebot/internal/config"
+	"github.com/servereye/servereyebot/internal/logger"
+	"github.com/servereye/servereyebot/internal/metricscache"
+	"github.com/servereye/servereyebot/internal/services"
+)
+
+// newMetricsCache creates the metrics cache of the configured backend. The cache only
+// saves fetches, so when Redis is unreachable the bot falls back to process memory
+// instead of failing to start.
+func newMetricsCache(cfg *config.Config, log logger.Logger) services.MetricsCache {
+	if cfg.MetricsCache.Backend != "redis" {
+		return metricscache.NewMemoryStore()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Redis.DialTimeout)
+	defer cancel()
+
+	store, err := metricscache.NewRedisStore(ctx, metricscache.RedisOptions{
+		Addr:         fmt.Sprintf("%s:%d", cfg.Redis.Host, cfg.Redis.Port),
+		Password:     cfg.Redis.Password,
+		Database:     cfg.Redis.Database,
+		PoolSize:     cfg.Redis.PoolSize,
+		DialTimeout:  cfg.Redis.DialTimeout,
+		ReadTimeout:  cfg.Redis.ReadTimeout,
+		WriteTimeout: cfg.Redis.WriteTimeout,
+		Prefix:       "servereyebot:metrics:",
+	})
+	if err != nil {
+		log.WithError(err).Warn("Redis metrics cache unavailable, caching metrics in memory")
+		return metricscache.NewMemoryStore()
+	}
+	return store
+}
@@ -0,0 +1,351 @@
+package app
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/logger"
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/tracing"
+	"github.com/servereye/servereyebot/pkg/docker"
+	"github.com/servereye/servereyebot/pkg/domain"
+)
+
+// unknownCommandName labels commands the router has no handler for in metrics and logs
+const unknownCommandName = "unknown"
+
+// Results of a command in metrics
+const (
+	commandResultOK    = "ok"
+	commandResultError = "error"
+	commandResultPanic = "panic"
+)
+
+// errCommandPanicked is returned for a command whose handler panicked
+type errCommandPanicked struct {
+	value interface{}
+}
+
+func (e errCommandPanicked) Error() string {
+	return fmt.Sprintf("command panicked: %v", e.value)
+}
+
+// chainCommand wraps a handler in middleware, the first middleware running outermost
+func chainCommand(handler domain.CommandHandler, middleware ...domain.CommandMiddleware) domain.CommandHandler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		mw, next := middleware[i], handler
+		handler = func(ctx context.Context, cmd *domain.Command, args []string) error {
+			return mw(ctx, cmd, args, next)
+		}
+	}
+	return handler
+}
+
+// commandUser returns the user running a command, set by the router
+func commandUser(ctx context.Context) *domain.User {
+	user, _ := ctx.Value(userKey).(*domain.User)
+	return user
+}
+
+// serverLister lists the servers of stored users, implemented by services.UserServiceAdapter
+type serverLister interface {
+	GetUserServers(ctx context.Context, userID int64) ([]models.ServerWithDetails, error)
+}
+
+var (
+	// errNoAccount is returned by the account accessors outside of commands and button presses
+	errNoAccount = stderrors.New("no account in context")
+
+	// errNoServerList is returned for servers when the user service cannot list them
+	errNoServerList = stderrors.New("user service does not list servers")
+)
+
+// account is the stored account of the user running a command or pressing a button, and
+// their servers. Both are looked up on first use and kept for the rest of the update.
+type account struct {
+	users      domain.UserService
+	logger     logger.Logger
+	telegramID int64
+
+	userOnce sync.Once
+	user     *domain.User
+	userErr  error
+
+	serversOnce sync.Once
+	servers     []models.ServerWithDetails
+	serversErr  error
+}
+
+// withAccount returns a context whose account is the one of telegramID in users
+func withAccount(ctx context.Context, users domain.UserService, log logger.Logger, telegramID int64) context.Context {
+	return context.WithValue(ctx, accountKey, &account{users: users, logger: log, telegramID: telegramID})
+}
+
+// contextUser returns the stored account of the user running a command or pressing a
+// button. Failed lookups are logged.
+func contextUser(ctx context.Context) (*domain.User, error) {
+	a, ok := ctx.Value(accountKey).(*account)
+	if !ok {
+		return nil, errNoAccount
+	}
+
+	a.userOnce.Do(func() {
+		a.user, a.userErr = a.users.GetUser(ctx, a.telegramID)
+		if a.userErr != nil {
+			a.logger.WithFields(map[string]interface{}{"error": a.userErr, "telegram_id": a.telegramID}).Warn("Failed to get user")
+		}
+	})
+	return a.user, a.userErr
+}
+
+// contextServers returns the stored account of the user running a command or pressing a
+// button with their servers. Failed lookups are logged.
+func contextServers(ctx context.Context) (*domain.User, []models.ServerWithDetails, error) {
+	user, err := contextUser(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	a := ctx.Value(accountKey).(*account)
+	a.serversOnce.Do(func() {
+		lister, ok := a.users.(serverLister)
+		if !ok {
+			a.serversErr = errNoServerList
+			return
+		}
+		a.servers, a.serversErr = lister.GetUserServers(ctx, mapping.UserID(user))
+		if a.serversErr != nil {
+			a.logger.WithFields(map[string]interface{}{"error": a.serversErr, "user_id": user.ID}).Warn("Failed to get user servers")
+		}
+	})
+	if a.serversErr != nil {
+		return nil, nil, a.serversErr
+	}
+	return user, a.servers, nil
+}
+
+// defaultMiddleware returns the middleware every command runs through, before the
+// middleware of the command itself. Rate limiting comes before the audit log and user
+// registration, so that a flood of commands writes nothing to the database.
+func (r *DefaultCommandRouter) defaultMiddleware() []domain.CommandMiddleware {
+	return []domain.CommandMiddleware{
+		r.recoverMiddleware,
+		r.metricsMiddleware,
+		r.rateLimitMiddleware,
+		r.auditMiddleware,
+		r.traceMiddleware,
+		r.registerMiddleware,
+		r.permissionMiddleware,
+		r.requestMiddleware,
+	}
+}
+
+// recoverMiddleware turns a panicking handler into an error reply, so that one bad
+// command cannot take the update worker down
+func (r *DefaultCommandRouter) recoverMiddleware(ctx context.Context, cmd *domain.Command, args []string, next domain.CommandHandler) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			r.logger.WithFields(map[string]interface{}{
+				"command": cmd.Name,
+				"panic":   fmt.Sprint(p),
+				"stack":   string(debug.Stack()),
+			}).Error("Panic while running command")
+			_ = r.telegramSvc.SendMessage(ctx, ctx.Value(chatIDKey).(int64), "❌ Внутренняя ошибка. Попробуйте позже.")
+			err = errCommandPanicked{value: p}
+		}
+	}()
+
+	return next(ctx, cmd, args)
+}
+
+// metricsMiddleware counts commands with their result and duration
+func (r *DefaultCommandRouter) metricsMiddleware(ctx context.Context, cmd *domain.Command, args []string, next domain.CommandHandler) error {
+	started := time.Now()
+	err := next(ctx, cmd, args)
+
+	result := commandResultOK
+	if _, ok := err.(errCommandPanicked); ok {
+		result = commandResultPanic
+	} else if err != nil {
+		result = commandResultError
+	}
+	r.metrics.observe(cmd.Name, result, time.Since(started))
+	return err
+}
+
+// auditMiddleware records who ran a command where, and how it ended, in the audit log.
+// Arguments are left out of the record since they may hold server keys.
+func (r *DefaultCommandRouter) auditMiddleware(ctx context.Context, cmd *domain.Command, args []string, next domain.CommandHandler) error {
+	started := time.Now()
+	err := next(ctx, cmd, args)
+
+	if r.audit != nil {
+		var userID int64
+		if user, lookupErr := contextUser(ctx); lookupErr == nil {
+			userID = mapping.UserID(user)
+		}
+		payload := fmt.Sprintf("chat=%d args=%d", ctx.Value(chatIDKey).(int64), len(args))
+		r.audit.RecordResult(ctx, userID, ctx.Value(userIDKey).(int64), "", "/"+cmd.Name, payload, "", started, err)
+	}
+
+	entry := r.logger.WithFields(map[string]interface{}{
+		"command":     cmd.Name,
+		"args":        len(args),
+		"telegram_id": ctx.Value(userIDKey),
+		"chat_id":     ctx.Value(chatIDKey),
+		"duration_ms": time.Since(started).Milliseconds(),
+	})
+	if err != nil {
+		entry.WithField("error", err).Warn("Command failed")
+		return err
+	}
+	entry.Info("Command executed")
+	return nil
+}
+
+// traceMiddleware runs a command in a span of the update trace
+func (r *DefaultCommandRouter) traceMiddleware(ctx context.Context, cmd *domain.Command, args []string, next domain.CommandHandler) error {
+	ctx, span := r.tracer.StartChild(ctx, "command /"+cmd.Name, tracing.KindInternal)
+	span.SetAttribute("telegram.user_id", ctx.Value(userIDKey))
+	span.SetAttribute("telegram.chat_id", ctx.Value(chatIDKey))
+	err := next(ctx, cmd, args)
+	if err != nil {
+		span.SetFailed()
+	}
+	span.End()
+	return err
+}
+
+// registerMiddleware registers the user, or refreshes their profile, before the command runs
+func (r *DefaultCommandRouter) registerMiddleware(ctx context.Context, cmd *domain.Command, args []string, next domain.CommandHandler) error {
+	user := commandUser(ctx)
+	if err := r.userService.RegisterUser(ctx, user); err != nil {
+		r.logger.WithFields(map[string]interface{}{"error": err, "telegram_id": user.TelegramID}).Warn("Failed to register user")
+	}
+
+	return next(ctx, cmd, args)
+}
+
+// rateLimitMiddleware throttles users sending commands faster than the limit, warning
+// once per window
+func (r *DefaultCommandRouter) rateLimitMiddleware(ctx context.Context, cmd *domain.Command, args []string, next domain.CommandHandler) error {
+	if r.limiter == nil {
+		return next(ctx, cmd, args)
+	}
+
+	user := commandUser(ctx)
+	decision := r.limiter.Allow(ctx, rateLimitScopeCommands, strconv.FormatInt(user.TelegramID, 10), r.limit)
+	if decision.Allowed {
+		return next(ctx, cmd, args)
+	}
+
+	r.logger.WithField("telegram_id", user.TelegramID).WithField("command", cmd.Name).Debug("Command rate limited")
+	if decision.FirstRejected(r.limit) {
+		return r.telegramSvc.SendMessage(ctx, ctx.Value(chatIDKey).(int64), fmt.Sprintf("⏳ Слишком много команд. Пожалуйста, подождите %s и попробуйте снова.", formatRetryAfter(decision.RetryAfter)))
+	}
+	return nil
+}
+
+// permissionMiddleware rejects commands the user may not run in the chat
+func (r *DefaultCommandRouter) permissionMiddleware(ctx context.Context, cmd *domain.Command, args []string, next domain.CommandHandler) error {
+	user := commandUser(ctx)
+	chatID := ctx.Value(chatIDKey).(int64)
+	for _, perm := range cmd.Permissions {
+		if perm == "admin" && !user.IsAdmin {
+			return r.telegramSvc.SendMessage(ctx, chatID, "Эта команда требует прав администратора")
+		}
+		if perm == permissionPrivate && isGroupChat(chatID, user.TelegramID) {
+			return r.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("🔒 Команда /%s работает только в личном чате с ботом.", cmd.Name))
+		}
+	}
+
+	return next(ctx, cmd, args)
+}
+
+// requestMiddleware attributes the agent commands of a command to its chat, so that
+// /cancel sent there stops waiting for them
+func (r *DefaultCommandRouter) requestMiddleware(ctx context.Context, cmd *domain.Command, args []string, next domain.CommandHandler) error {
+	ctx = docker.WithRequest(ctx, ctx.Value(chatIDKey).(int64), ctx.Value(userIDKey).(int64))
+	return next(ctx, cmd, args)
+}
+
+// commandStats are the counters of a command
+type commandStats struct {
+	results  map[string]int64 // by result
+	duration time.Duration
+	count    int64
+}
+
+// commandMetrics counts routed commands by name and result
+type commandMetrics struct {
+	mu       sync.Mutex
+	commands map[string]*commandStats
+}
+
+// newCommandMetrics creates empty command metrics
+func newCommandMetrics() *commandMetrics {
+	return &commandMetrics{commands: make(map[string]*commandStats)}
+}
+
+// observe counts a command run
+func (m *commandMetrics) observe(command, result string, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats, ok := m.commands[command]
+	if !ok {
+		stats = &commandStats{results: make(map[string]int64)}
+		m.commands[command] = stats
+	}
+	stats.results[result]++
+	stats.duration += duration
+	stats.count++
+}
+
+// WritePrometheus writes command counters and durations in Prometheus text exposition format
+func (m *commandMetrics) WritePrometheus(w io.Writer) error {
+	m.mu.Lock()
+	commands := make([]string, 0, len(m.commands))
+	snapshot := make(map[string]commandStats, len(m.commands))
+	for command, stats := range m.commands {
+		commands = append(commands, command)
+		results := make(map[string]int64, len(stats.results))
+		for result, n := range stats.results {
+			results[result] = n
+		}
+		snapshot[command] = commandStats{results: results, duration: stats.duration, count: stats.count}
+	}
+	m.mu.Unlock()
+	sort.Strings(commands)
+
+	if _, err := fmt.Fprint(w, "# HELP servereyebot_commands_total Commands routed, by result.\n# TYPE servereyebot_commands_total counter\n"); err != nil {
+		return err
+	}
+	for _, command := range commands {
+		for _, result := range []string{commandResultOK, commandResultError, commandResultPanic} {
+			if _, err := fmt.Fprintf(w, "servereyebot_commands_total{command=%q,result=%q} %d\n", command, result, snapshot[command].results[result]); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := fmt.Fprint(w, "# HELP servereyebot_command_duration_seconds Time spent running commands.\n# TYPE servereyebot_command_duration_seconds summary\n"); err != nil {
+		return err
+	}
+	for _, command := range commands {
+		stats := snapshot[command]
+		if _, err := fmt.Fprintf(w, "servereyebot_command_duration_seconds_sum{command=%q} %g\nservereyebot_command_duration_seconds_count{command=%q} %d\n", command, stats.duration.Seconds(), command, stats.count); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,239 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/logger"
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/ratelimit"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/internal/testutil"
+	"github.com/servereye/servereyebot/pkg/domain"
+)
+
+// newTestRouter creates a command router on fakes, rate limiting commands to limit per minute
+func newTestRouter(t *testing.T, limit int) (*DefaultCommandRouter, *testutil.Telegram, *testutil.Users, *testutil.RateLimitStore) {
+	t.Helper()
+
+	log, err := logger.New(logger.LoggerConfig{Level: "panic"})
+	if err != nil {
+		t.Fatalf("logger.New: %v", err)
+	}
+	telegram := testutil.NewTelegram()
+	users := testutil.NewUsers()
+	store := testutil.NewRateLimitStore(time.Now())
+
+	router := NewDefaultCommandRouterNew(log, telegram, users, nil, nil, ratelimit.New(store), ratelimit.Rule{Limit: limit, Window: time.Minute})
+	return router, telegram, users, store
+}
+
+// registerEcho registers a command replying with its name
+func registerEcho(t *testing.T, router *DefaultCommandRouter, cmd *domain.Command) {
+	t.Helper()
+
+	cmd.Handler = func(ctx context.Context, cmd *domain.Command, args []string) error {
+		return router.telegramSvc.SendMessage(ctx, ctx.Value(chatIDKey).(int64), "ok "+cmd.Name)
+	}
+	if err := router.RegisterCommand(cmd); err != nil {
+		t.Fatalf("RegisterCommand: %v", err)
+	}
+}
+
+func TestRouteCommandRateLimit(t *testing.T) {
+	router, telegram, _, store := newTestRouter(t, 2)
+	registerEcho(t, router, &domain.Command{Name: "status"})
+	user := &domain.User{TelegramID: 1001}
+	ctx := context.Background()
+
+	for i := 0; i < 4; i++ {
+		if err := router.RouteCommand(ctx, "status", nil, user, user.TelegramID); err != nil {
+			t.Fatalf("RouteCommand %d: %v", i+1, err)
+		}
+	}
+
+	sent := telegram.SentTo(user.TelegramID)
+	if len(sent) != 3 {
+		t.Fatalf("sent %q, want two replies and one warning", sent)
+	}
+	if !strings.HasPrefix(sent[2], "⏳") {
+		t.Errorf("third message = %q, want the rate limit warning", sent[2])
+	}
+
+	store.Advance(time.Minute)
+	if err := router.RouteCommand(ctx, "status", nil, user, user.TelegramID); err != nil {
+		t.Fatalf("RouteCommand in the next window: %v", err)
+	}
+	if sent := telegram.SentTo(user.TelegramID); sent[len(sent)-1] != "ok status" {
+		t.Errorf("last message = %q, want the command reply in the next window", sent[len(sent)-1])
+	}
+}
+
+func TestRouteCommandReplies(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		user    domain.User
+		chatID  int64
+		want    string // prefix of the only reply
+	}{
+		{name: "registered command", command: "status", user: domain.User{TelegramID: 1001}, chatID: 1001, want: "ok status"},
+		{name: "unknown command", command: "nope", user: domain.User{TelegramID: 1001}, chatID: 1001, want: "❌ Неизвестная команда: /nope"},
+		{name: "admin command of a user", command: "broadcast", user: domain.User{TelegramID: 1001}, chatID: 1001, want: "Эта команда требует прав администратора"},
+		{name: "admin command of an admin", command: "broadcast", user: domain.User{TelegramID: 1001, IsAdmin: true}, chatID: 1001, want: "ok broadcast"},
+		{name: "private command in a group", command: "rotatekey", user: domain.User{TelegramID: 1001}, chatID: -100200, want: "🔒 Команда /rotatekey"},
+		{name: "private command in private", command: "rotatekey", user: domain.User{TelegramID: 1001}, chatID: 1001, want: "ok rotatekey"},
+		{name: "panicking command", command: "crash", user: domain.User{TelegramID: 1001}, chatID: 1001, want: "❌ Внутренняя ошибка"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, telegram, users, _ := newTestRouter(t, 0)
+			registerEcho(t, router, &domain.Command{Name: "status"})
+			registerEcho(t, router, &domain.Command{Name: "broadcast", Permissions: []string{"admin"}})
+			registerEcho(t, router, &domain.Command{Name: "rotatekey", Permissions: []string{permissionPrivate}})
+			if err := router.RegisterCommand(&domain.Command{
+				Name:    "crash",
+				Handler: func(ctx context.Context, cmd *domain.Command, args []string) error { panic("boom") },
+			}); err != nil {
+				t.Fatalf("RegisterCommand: %v", err)
+			}
+
+			user := tt.user
+			err := router.RouteCommand(context.Background(), tt.command, nil, &user, tt.chatID)
+			if tt.command == "crash" {
+				if err == nil {
+					t.Error("RouteCommand of a panicking command returned no error")
+				}
+			} else if err != nil {
+				t.Fatalf("RouteCommand: %v", err)
+			}
+
+			sent := telegram.SentTo(tt.chatID)
+			if len(sent) != 1 || !strings.HasPrefix(sent[0], tt.want) {
+				t.Errorf("sent %q, want one reply starting with %q", sent, tt.want)
+			}
+			if !users.IsAuthorized(tt.user.TelegramID) {
+				t.Error("user was not registered before the command ran")
+			}
+		})
+	}
+}
+
+func TestRouteCommandRunsWhenRegistrationFails(t *testing.T) {
+	router, telegram, users, _ := newTestRouter(t, 0)
+	registerEcho(t, router, &domain.Command{Name: "status"})
+	users.Fail("RegisterUser", errors.New("connection refused"))
+
+	if err := router.RouteCommand(context.Background(), "status", nil, &domain.User{TelegramID: 1001}, 1001); err != nil {
+		t.Fatalf("RouteCommand: %v", err)
+	}
+	if sent := telegram.SentTo(1001); len(sent) != 1 || sent[0] != "ok status" {
+		t.Errorf("sent %q, want the command reply", sent)
+	}
+}
+
+// nopLogger discards log output
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, fields ...interface{}) {}
+func (nopLogger) Info(msg string, fields ...interface{})  {}
+func (nopLogger) Warn(msg string, fields ...interface{})  {}
+func (nopLogger) Error(msg string, fields ...interface{}) {}
+
+// auditStore keeps audit records in memory
+type auditStore struct {
+	entries []models.CommandHistory
+}
+
+func (s *auditStore) CreateCommandHistory(ctx context.Context, entry *models.CommandHistory) error {
+	s.entries = append(s.entries, *entry)
+	return nil
+}
+
+func (s *auditStore) GetCommandHistory(ctx context.Context, id int64) (*models.CommandHistory, error) {
+	return nil, errors.New("not found")
+}
+
+func (s *auditStore) ListCommandHistoryForUser(ctx context.Context, userID int64, limit int) ([]models.CommandHistory, error) {
+	return s.entries, nil
+}
+
+func (s *auditStore) ListCommandHistory(ctx context.Context, limit int) ([]models.CommandHistory, error) {
+	return s.entries, nil
+}
+
+func TestRouteCommandAudit(t *testing.T) {
+	router, _, _, _ := newTestRouter(t, 0)
+	store := &auditStore{}
+	router.audit = services.NewAuditService(store, nil, nopLogger{})
+	registerEcho(t, router, &domain.Command{Name: "add"})
+	if err := router.RegisterCommand(&domain.Command{
+		Name: "fail",
+		Handler: func(ctx context.Context, cmd *domain.Command, args []string) error {
+			return errors.New("agent offline")
+		},
+	}); err != nil {
+		t.Fatalf("RegisterCommand: %v", err)
+	}
+
+	user := &domain.User{TelegramID: 1001}
+	if err := router.RouteCommand(context.Background(), "add", []string{"key_secret"}, user, -100200); err != nil {
+		t.Fatalf("RouteCommand: %v", err)
+	}
+	if err := router.RouteCommand(context.Background(), "fail", nil, user, 1001); err == nil {
+		t.Fatal("RouteCommand of a failing command returned no error")
+	}
+
+	if len(store.entries) != 2 {
+		t.Fatalf("recorded %d commands, want 2", len(store.entries))
+	}
+	added, failed := store.entries[0], store.entries[1]
+	if added.Command != "/add" || added.TelegramID != 1001 || !added.Success || added.Payload != "chat=-100200 args=1" {
+		t.Errorf("recorded %+v, want a successful /add of 1001 in chat -100200", added)
+	}
+	if strings.Contains(added.Payload, "key_secret") {
+		t.Errorf("payload %q holds the arguments", added.Payload)
+	}
+	if failed.Command != "/fail" || failed.Success || failed.Error != "agent offline" {
+		t.Errorf("recorded %+v, want a failed /fail", failed)
+	}
+}
+
+func TestCommandAccount(t *testing.T) {
+	router, _, users, _ := newTestRouter(t, 0)
+
+	var user *domain.User
+	var lookupErr, serversErr error
+	if err := router.RegisterCommand(&domain.Command{
+		Name: "whoami",
+		Handler: func(ctx context.Context, cmd *domain.Command, args []string) error {
+			user, lookupErr = contextUser(ctx)
+			_, _ = contextUser(ctx)
+			_, _, serversErr = contextServers(ctx)
+			return nil
+		},
+	}); err != nil {
+		t.Fatalf("RegisterCommand: %v", err)
+	}
+
+	if err := router.RouteCommand(context.Background(), "whoami", nil, &domain.User{TelegramID: 1001, Username: "alice"}, 1001); err != nil {
+		t.Fatalf("RouteCommand: %v", err)
+	}
+	if lookupErr != nil || user == nil || user.Username != "alice" {
+		t.Errorf("contextUser = %+v, %v, want the registered user", user, lookupErr)
+	}
+	if calls := users.Calls("GetUser"); calls != 1 {
+		t.Errorf("GetUser called %d times, want the account looked up once", calls)
+	}
+	if !errors.Is(serversErr, errNoServerList) {
+		t.Errorf("contextServers error = %v, want errNoServerList from a user service without servers", serversErr)
+	}
+
+	if _, err := contextUser(context.Background()); !errors.Is(err, errNoAccount) {
+		t.Errorf("contextUser outside of a command = %v, want errNoAccount", err)
+	}
+}
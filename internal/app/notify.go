@@ -0,0 +1,114 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/notify"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// notifyUsage is shown when /notify arguments cannot be parsed
+const notifyUsage = `🔔 *Каналы уведомлений*
+
+/notify - Ваши каналы
+/notify add <slack|discord|email|webhook> <url|email> [server_id] - Добавить канал
+/notify remove <id> - Удалить канал
+/notify test - Отправить тестовое сообщение во все каналы
+
+Алерты и отчеты приходят в Telegram и во все ваши каналы. Канал с server_id получает только алерты этого сервера и отчеты.`
+
+// handleNotifyCommand manages channels receiving alerts and reports besides Telegram
+func (b *Bot) handleNotifyCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	user, err := contextUser(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+	userID := mapping.UserID(user)
+
+	if len(args) == 0 || strings.ToLower(args[0]) == "list" {
+		channels, err := b.notifyService.ListChannels(ctx, telegramID)
+		if err != nil {
+			b.logger.Error("Failed to list notification channels", "error", err, "user_id", userID)
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось получить каналы уведомлений. Попробуйте позже.")
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, services.FormatChannels(channels))
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "add":
+		if len(args) < 3 || len(args) > 4 {
+			return b.telegramSvc.SendMessage(ctx, chatID, notifyUsage)
+		}
+
+		serverID := ""
+		if len(args) == 4 {
+			_, servers, err := contextServers(ctx)
+			if err != nil {
+				return b.telegramSvc.SendMessage(ctx, chatID, "❌ Произошла ошибка при получении списка серверов. Попробуйте позже.")
+			}
+			server := mapping.ServerByIDOrName(servers, args[3])
+			if server == nil {
+				return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Сервер `%s` не найден среди ваших серверов.", args[3]))
+			}
+			serverID = server.ID
+		}
+
+		channel, err := b.notifyService.AddChannel(ctx, userID, telegramID, args[1], args[2], serverID)
+		if err != nil {
+			if errors.IsErrorCode(err, errors.ErrCodeValidation) {
+				return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Неверный канал. Slack и Discord принимают https-адрес их вебхука, webhook - любой https-адрес, email - адрес почты. Каналов может быть не больше 10.\n\nДоступные типы: %s", strings.Join(b.notifyService.Kinds(), ", ")))
+			}
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось добавить канал. Попробуйте позже.")
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("✅ Канал #%d добавлен. Проверьте его командой /notify test.", channel.ID))
+
+	case "remove":
+		if len(args) != 2 {
+			return b.telegramSvc.SendMessage(ctx, chatID, notifyUsage)
+		}
+		id, err := strconv.ParseInt(strings.TrimPrefix(args[1], "#"), 10, 64)
+		if err != nil {
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите номер канала из списка /notify.")
+		}
+
+		removed, err := b.notifyService.RemoveChannel(ctx, userID, id)
+		if err != nil {
+			b.logger.Error("Failed to remove notification channel", "error", err, "user_id", userID)
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось удалить канал. Попробуйте позже.")
+		}
+		if !removed {
+			return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Канал #%d не найден.", id))
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("✅ Канал #%d удален.", id))
+
+	case "test":
+		channels, err := b.notifyService.ListChannels(ctx, telegramID)
+		if err != nil {
+			b.logger.Error("Failed to list notification channels", "error", err, "user_id", userID)
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось получить каналы уведомлений. Попробуйте позже.")
+		}
+		if len(channels) == 0 {
+			return b.telegramSvc.SendMessage(ctx, chatID, services.FormatChannels(channels))
+		}
+
+		msg := notify.Message{
+			Title: "Тест " + b.branding.Name(),
+			Text:  "✅ Канал уведомлений работает: сюда будут приходить алерты и отчеты.",
+		}
+		if err := b.notifyService.Publish(ctx, telegramID, nil, msg); err != nil {
+			return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("⚠️ Не все каналы получили сообщение:\n%s", err.Error()))
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, "✅ Тестовое сообщение отправлено во все каналы.")
+	}
+
+	return b.telegramSvc.SendMessage(ctx, chatID, notifyUsage)
+}
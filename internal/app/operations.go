@@ -0,0 +1,137 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/servereye/servereyebot/internal/callbacks"
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/telegram"
+	"github.com/servereye/servereyebot/pkg/docker"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// maxPartialOutput bounds the output of a cancelled command shown to the user
+const maxPartialOutput = 3000
+
+// trackOperation detaches a long-running operation from the update processing timeout
+// and makes it cancellable with the button of createCancelKeyboard
+func trackOperation(ctx context.Context, telegramID int64, label string) (context.Context, string) {
+	return docker.Track(context.WithoutCancel(ctx), telegramID, label)
+}
+
+// isCancelled reports whether an operation failed because the user cancelled it. Its
+// message is already replaced with the cancellation result and must not be overwritten.
+func isCancelled(err error) bool {
+	return errors.IsErrorCode(err, errors.ErrCodeCancelled)
+}
+
+// createCancelKeyboard creates inline keyboard cancelling a running operation
+func createCancelKeyboard(operationID string) interface{} {
+	if operationID == "" {
+		return nil
+	}
+	return [][]map[string]string{
+		{
+			cancelCallback.Button("⛔ Отменить", operationID),
+		},
+	}
+}
+
+// handleCancelCallback cancels a running operation and replaces its progress message
+// with the output the agent produced before stopping
+func (h *DefaultUpdateHandler) handleCancelCallback(ctx context.Context, callback *telegram.CallbackQuery, data callbacks.Data) error {
+	// Parse callback data: cnl:operation_id
+	operationID := data.Param(0)
+	if operationID == "" {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неверный формат данных")
+	}
+
+	user, err := contextUser(ctx)
+	if err != nil {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Внутренняя ошибка")
+	}
+
+	op, cancelled, err := h.containerService.CancelOperation(ctx, mapping.UserID(user), callback.From.ID, operationID)
+	switch {
+	case errors.IsErrorCode(err, errors.ErrCodeNotFound):
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "Операция уже завершилась")
+	case errors.IsErrorCode(err, errors.ErrCodeForbidden):
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "⛔ Отменить может только тот, кто запустил операцию")
+	}
+
+	if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "Операция отменена"); err != nil {
+		h.logger.Error("Failed to answer callback", "error", err)
+	}
+	return h.telegramSvc.EditMessage(ctx, callback.Message.Chat.ID, callback.Message.MessageID, cancelledMessage(op, cancelled, err, time.Now()), nil)
+}
+
+// handleCancelCommand stops waiting for the agent commands of the user's requests in the
+// chat and asks the agents to drop them
+func (b *Bot) handleCancelCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	user, err := contextUser(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+
+	cancelled := b.containerService.CancelRequests(ctx, mapping.UserID(user), telegramID, chatID)
+	return b.telegramSvc.SendMessage(ctx, chatID, formatCancelledRequests(cancelled, time.Now()))
+}
+
+// formatCancelledRequests reports the agent commands cancelled with /cancel
+func formatCancelledRequests(cancelled []docker.Operation, now time.Time) string {
+	if len(cancelled) == 0 {
+		return "Нет команд, ожидающих ответа агента."
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("⛔ Отменено команд: %d\n", len(cancelled)))
+	for _, op := range cancelled {
+		label := op.Label
+		if label == "" {
+			label = string(op.Type)
+		}
+		sb.WriteString(fmt.Sprintf("\n• %s (через %s)", label, now.Sub(op.Started).Round(time.Second)))
+	}
+	sb.WriteString("\n\nАгентам отправлен запрос остановить их.")
+	return sb.String()
+}
+
+// cancelledMessage reports a cancelled operation with the partial output of its command.
+// err is set when the agent did not confirm the cancellation.
+func cancelledMessage(op docker.Operation, cancelled *protocol.CommandCancelledResponse, err error, now time.Time) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("⛔ Отменено: %s (через %s)\n", op.Label, now.Sub(op.Started).Round(time.Second)))
+
+	switch {
+	case err != nil:
+		sb.WriteString("\n⚠️ Агент не подтвердил отмену: команда может продолжать выполняться на сервере.")
+	case !cancelled.Stopped:
+		sb.WriteString("\nКоманда уже завершилась на сервере, но ее результат не был получен.")
+	default:
+		sb.WriteString("\nАгент остановил команду.")
+	}
+
+	if cancelled != nil && strings.TrimSpace(cancelled.Output) != "" {
+		output := cancelled.Output
+		if len(output) > maxPartialOutput {
+			cut := len(output) - maxPartialOutput
+			for cut < len(output) && !utf8.RuneStart(output[cut]) {
+				cut++
+			}
+			output = "…" + output[cut:]
+		}
+		sb.WriteString("\n\nВывод до отмены:\n")
+		sb.WriteString(output)
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,125 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/httpserver"
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// maxPairRequestSize limits the body of an agent pairing request
+const maxPairRequestSize = 4096
+
+// pairRequest represents the body of an agent pairing request. The key of the server is
+// issued by the bot, a key sent by older agents is ignored.
+type pairRequest struct {
+	Code string `json:"code"`
+}
+
+// pairResponse represents the reply to an agent pairing request
+type pairResponse struct {
+	Status    string `json:"status"`
+	ServerKey string `json:"server_key,omitempty"`
+	Token     string `json:"token,omitempty"`      // bearer token for authenticated agent endpoints
+	Secret    string `json:"e2e_secret,omitempty"` // end-to-end secret command payloads are encrypted with
+}
+
+// handlePairCommand generates a one-time code to start a new agent with
+func (b *Bot) handlePairCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	user, err := contextUser(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+
+	pairing, err := b.pairingService.CreateCode(ctx, mapping.UserID(user), telegramID)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось создать код привязки. Попробуйте позже.")
+	}
+
+	message := fmt.Sprintf(`🔗 *Код привязки: %s*
+
+Запустите агент на новом сервере с этим кодом:
+servereye-agent --pair %s
+
+Сервер появится в /servers автоматически. Код одноразовый и действует %d мин.`,
+		pairing.Code, pairing.Code, int(b.pairingService.TTL().Minutes()))
+
+	return b.telegramSvc.SendMessage(ctx, chatID, message)
+}
+
+// handlePairRequest creates a server for an agent started with a pairing code and links it to
+// the code owner. The one-time code authenticates the request and the reply carries the key
+// issued to the server, the agent's bearer token and the end-to-end secret.
+func (b *Bot) handlePairRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpserver.MethodNotAllowed(w, r)
+		return
+	}
+
+	var req pairRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPairRequestSize)).Decode(&req); err != nil {
+		httpserver.WriteError(w, r, http.StatusBadRequest, errors.ErrCodeInvalidInput, "invalid request body")
+		return
+	}
+
+	remoteAddr, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remoteAddr = r.RemoteAddr
+	}
+
+	paired, err := b.pairingService.Pair(r.Context(), req.Code, remoteAddr)
+	if err != nil {
+		status := http.StatusBadGateway
+		var appErr *errors.AppError
+		if stderrors.As(err, &appErr) && appErr.HTTPStatus != 0 {
+			status = appErr.HTTPStatus
+		}
+		if status == http.StatusNotFound {
+			httpserver.RequestLogger(b.logger, r).Warn("Pairing with unknown or expired code", "remote_addr", remoteAddr)
+			httpserver.WriteError(w, r, status, errors.ErrCodeNotFound, "invalid or expired pairing code")
+			return
+		}
+		httpserver.WriteError(w, r, status, httpserver.ErrorCodeOf(err, errors.ErrCodeExternal), err.Error())
+		return
+	}
+
+	writeAgentResponse(w, http.StatusOK, pairResponse{
+		Status:    "paired",
+		ServerKey: paired.ServerKey,
+		Token:     b.apiAuth.AgentToken(paired.ServerKey),
+		Secret:    paired.Secret,
+	})
+
+	// The agent does not wait for the Telegram notification
+	notifyCtx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 30*time.Second)
+	go func() {
+		defer cancel()
+		message := fmt.Sprintf("✅ Сервер `%s` привязан по коду %s и добавлен в ваш список.\n\nИспользуйте /servers для просмотра всех ваших серверов.", paired.ServerKey, paired.Pairing.Code)
+		if err := b.telegramSvc.SendMessage(notifyCtx, paired.Pairing.TelegramID, message); err != nil {
+			b.logger.Error("Failed to notify about paired server", "error", err, "telegram_id", paired.Pairing.TelegramID)
+		}
+	}()
+}
+
+// writeAgentResponse writes a JSON reply to an agent request
+func writeAgentResponse(w http.ResponseWriter, status int, resp interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// runPairingCleanup removes expired pairing codes
+func (b *Bot) runPairingCleanup(ctx context.Context, now time.Time) error {
+	return b.pairingService.Cleanup(ctx, now)
+}
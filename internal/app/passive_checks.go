@@ -0,0 +1,127 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/alerts"
+	"github.com/servereye/servereyebot/internal/httpserver"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// maxPassiveChecksRequestSize limits the body of a batch of passive check results
+const maxPassiveChecksRequestSize = 1 << 20
+
+// passiveChecksRequest represents check results posted as JSON, e.g. by a Zabbix webhook
+// media type. A bare array of results or a single result is accepted as well.
+type passiveChecksRequest struct {
+	Checks []alerts.PassiveCheckResult `json:"checks"`
+}
+
+// passiveChecksResponse represents the reply to a batch of passive check results
+type passiveChecksResponse struct {
+	Status   string `json:"status"`
+	Accepted int    `json:"accepted"`
+	Skipped  int    `json:"skipped"`
+}
+
+// handleChecksCommand shows the last results of the external checks of a server
+func (b *Bot) handleChecksCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	_, servers, err := contextServers(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+
+	if len(servers) == 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ У вас нет добавленных серверов. Используйте /add <server_id> для добавления сервера.")
+	}
+
+	server, _ := resolveServerArg(servers, args)
+	if server == nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите сервер: /checks <server_id>")
+	}
+
+	checks, err := b.passiveChecks.List(ctx, server.ID)
+	if err != nil {
+		b.logger.Error("Failed to list passive checks", "error", err, "server_id", server.ID)
+		return b.telegramSvc.SendMessage(ctx, chatID, dependencyMessage(b.dependencyService, "❌ Не удалось получить результаты проверок. Попробуйте позже.", nil, services.DependencyDatabase))
+	}
+
+	now := time.Now()
+	text := services.FormatPassiveChecks(server, checks, now)
+	if uptimeChecks := b.uptimeService.List(0, server.ID); len(uptimeChecks) > 0 {
+		text += "\n\n" + services.FormatUptimeChecks(uptimeChecks, now)
+	}
+	return b.telegramSvc.SendMessage(ctx, chatID, text)
+}
+
+// handlePassiveChecksRequest receives passive check results of Nagios, Icinga and Zabbix.
+// JSON bodies hold results with host, service, state and output; text bodies hold Nagios
+// external commands or send_nsca lines, so that an OCSP command can forward them as is.
+func (b *Bot) handlePassiveChecksRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpserver.MethodNotAllowed(w, r)
+		return
+	}
+
+	results, err := decodePassiveChecks(r.Header.Get("Content-Type"), http.MaxBytesReader(w, r.Body, maxPassiveChecksRequestSize))
+	if err != nil {
+		httpserver.WriteError(w, r, http.StatusBadRequest, errors.ErrCodeInvalidInput, "invalid request body: "+err.Error())
+		return
+	}
+
+	ingest, err := b.passiveChecks.Ingest(r.Context(), results, time.Now())
+	if err != nil {
+		httpserver.RequestLogger(b.logger, r).Error("Failed to ingest passive checks", "error", err, "count", len(results))
+		httpserver.WriteError(w, r, http.StatusServiceUnavailable, errors.ErrCodeUnavailable, "failed to store check results")
+		return
+	}
+
+	writeAgentResponse(w, http.StatusOK, passiveChecksResponse{Status: "ok", Accepted: ingest.Accepted, Skipped: ingest.Skipped})
+
+	// The monitoring system does not wait for the delivery
+	deliverCtx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), time.Minute)
+	go func() {
+		defer cancel()
+		b.deliverAlerts(deliverCtx, ingest.Notifications)
+	}()
+}
+
+// decodePassiveChecks reads check results in the format given by the content type
+func decodePassiveChecks(contentType string, body io.Reader) ([]alerts.PassiveCheckResult, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType != "application/json" {
+		return alerts.ParsePassiveChecks(string(data))
+	}
+
+	var batch []alerts.PassiveCheckResult
+	if err := json.Unmarshal(data, &batch); err == nil {
+		return batch, nil
+	}
+
+	var request passiveChecksRequest
+	if err := json.Unmarshal(data, &request); err != nil {
+		return nil, err
+	}
+	if request.Checks != nil {
+		return request.Checks, nil
+	}
+
+	var single alerts.PassiveCheckResult
+	if err := json.Unmarshal(data, &single); err != nil {
+		return nil, err
+	}
+	return []alerts.PassiveCheckResult{single}, nil
+}
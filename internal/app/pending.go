@@ -0,0 +1,66 @@
+package app
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// defaultStaleCommandAge is the age of the pending commands /pending purge stops waiting for
+const defaultStaleCommandAge = 5 * time.Minute
+
+// pendingUsage is shown when /pending arguments cannot be parsed
+const pendingUsage = `⏳ *Очередь команд агента*
+
+/pending [server_id] - Команды, на которые агент еще не ответил
+/pending [server_id] purge [5m] - Перестать ждать команды старше 5 минут (для владельцев)
+
+Если агент кажется занятым, здесь видно, какие команды он еще выполняет.`
+
+// handlePendingCommand shows the commands waiting for the agent of a server and purges stale ones
+func (b *Bot) handlePendingCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+	if len(servers) == 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, "📭 У вас нет добавленных серверов.\n\nИспользуйте /add <server_id> для добавления сервера.")
+	}
+
+	server, args := resolveServerArg(servers, args)
+	if server == nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите сервер.\n\n"+pendingUsage)
+	}
+
+	if len(args) == 0 {
+		pending := b.containerService.PendingCommands(server)
+		return b.telegramSvc.SendMessage(ctx, chatID, services.FormatPendingCommands(server, pending, time.Now()))
+	}
+	if strings.ToLower(args[0]) != "purge" || len(args) > 2 {
+		return b.telegramSvc.SendMessage(ctx, chatID, pendingUsage)
+	}
+
+	olderThan := defaultStaleCommandAge
+	if len(args) == 2 {
+		if olderThan, err = time.ParseDuration(args[1]); err != nil || olderThan < 0 {
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите возраст команд, например 5m или 30s.")
+		}
+	}
+
+	purged, err := b.containerService.PurgeCommands(ctx, mapping.UserID(user), telegramID, server, olderThan)
+	if err != nil {
+		if errors.IsErrorCode(err, errors.ErrCodeForbidden) {
+			return b.telegramSvc.SendMessage(ctx, chatID, "⛔ Очищать очередь команд сервера может только его владелец.")
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось очистить очередь команд. Попробуйте позже.")
+	}
+	return b.telegramSvc.SendMessage(ctx, chatID, services.FormatPurgedCommands(server, purged, olderThan, time.Now()))
+}
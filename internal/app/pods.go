@@ -0,0 +1,55 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// podsUsage is shown when /pods arguments cannot be parsed
+const podsUsage = `☸️ *Kubernetes*
+
+/pods [server_id] - Узлы кластера и поды всех пространств имен
+/pods [server_id] <namespace> - Поды одного пространства имен
+
+Работает, если агент запущен в кластере с сервисным аккаунтом или на узле с настроенным kubectl. Поды с проблемами показаны первыми.`
+
+// handlePodsCommand shows the Kubernetes nodes and pods seen from a server
+func (b *Bot) handlePodsCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+	if len(servers) == 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, "📭 У вас нет добавленных серверов.\n\nИспользуйте /add <server_id> для добавления сервера.")
+	}
+
+	server, args := resolveServerArg(servers, args)
+	if server == nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите сервер.\n\n"+podsUsage)
+	}
+	if len(args) > 1 {
+		return b.telegramSvc.SendMessage(ctx, chatID, podsUsage)
+	}
+
+	namespace := ""
+	if len(args) == 1 && args[0] != "all" {
+		namespace = args[0]
+	}
+
+	pods, err := b.kubeService.Pods(ctx, mapping.UserID(user), telegramID, server, namespace)
+	if err != nil {
+		if errors.IsErrorCode(err, errors.ErrCodeValidation) {
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Некорректное пространство имен.\n\n"+podsUsage)
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, agentErrorMessage(err, server, "❌ Не удалось получить поды. Попробуйте позже."))
+	}
+
+	return b.telegramSvc.SendMessage(ctx, chatID, b.kubeService.FormatPods(server, pods, namespace, time.Now()))
+}
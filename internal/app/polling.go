@@ -0,0 +1,35 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/telegram"
+)
+
+// handlePollingEvent alerts admins about a prolonged Telegram polling outage and its end.
+// The outage alert only arrives when sending still works, e.g. when another instance
+// polls with the same token; otherwise admins learn about it from the recovery message.
+func (b *Bot) handlePollingEvent(ctx context.Context, event telegram.PollingEvent) {
+	var message string
+	if event.Recovered {
+		message = fmt.Sprintf("✅ Получение обновлений Telegram восстановлено\n\nПерерыв: %s\nНеудачных попыток: %d",
+			event.Gap.Round(time.Second), event.Failures)
+	} else {
+		message = fmt.Sprintf("🚨 Бот не получает обновления Telegram уже %s\n\nНеудачных попыток: %d\nПоследняя ошибка: %v",
+			event.Gap.Round(time.Second), event.Failures, event.Err)
+	}
+
+	admins, err := b.repo.ListAdminTelegramIDs(ctx)
+	if err != nil {
+		b.logger.Error("Failed to list admins for polling alert", "error", err)
+		return
+	}
+
+	for _, adminID := range admins {
+		if err := b.telegramSvc.SendMessage(ctx, adminID, message); err != nil {
+			b.logger.Error("Failed to send polling alert", "error", err, "telegram_id", adminID)
+		}
+	}
+}
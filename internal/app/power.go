@@ -0,0 +1,189 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/callbacks"
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/internal/telegram"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// powerProbeInterval is how often a rebooting or shutting down server is probed
+const powerProbeInterval = 5 * time.Second
+
+// handleRebootCommand asks to confirm a reboot of a server
+func (b *Bot) handleRebootCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	return b.requestPowerAction(ctx, args, services.PowerReboot)
+}
+
+// handleShutdownCommand asks to confirm a shutdown of a server
+func (b *Bot) handleShutdownCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	return b.requestPowerAction(ctx, args, services.PowerShutdown)
+}
+
+// requestPowerAction resolves the server of /reboot and /shutdown and sends the confirmation
+func (b *Bot) requestPowerAction(ctx context.Context, args []string, action string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+	usage := fmt.Sprintf("/%s [server_id] - %s сервер после подтверждения (для владельцев)", action, powerActionVerb(action))
+
+	_, servers, err := contextServers(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+	if len(servers) == 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, "📭 У вас нет добавленных серверов.\n\nИспользуйте /add <server_id> для добавления сервера.")
+	}
+
+	server, args := resolveServerArg(servers, args)
+	if server == nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите сервер.\n\n"+usage)
+	}
+	if len(args) > 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, usage)
+	}
+
+	token, err := b.powerService.Request(telegramID, server, action, time.Now())
+	if err != nil {
+		if errors.IsErrorCode(err, errors.ErrCodeForbidden) {
+			return b.telegramSvc.SendMessage(ctx, chatID, "⛔ Перезагружать и выключать сервер может только его владелец.")
+		}
+		b.logger.Error("Failed to request power action", "error", err, "server_id", server.ID)
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+	keyboard, err := createPowerConfirmKeyboard(server.ID, token, action)
+	if err != nil {
+		b.powerService.Cancel(token, telegramID)
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Слишком длинный ID сервера для подтверждения.")
+	}
+
+	text := fmt.Sprintf("⚠️ %s %s(%s)?\n\nПодтвердите в течение %d секунд.", powerActionVerb(action), server.Name, server.ID, int(services.PowerConfirmWindow.Seconds()))
+	if action == services.PowerShutdown {
+		text += " Включить сервер обратно из бота будет нельзя."
+	}
+	return b.telegramSvc.SendMessageWithKeyboard(ctx, chatID, text, keyboard)
+}
+
+// handlePowerCallback confirms or cancels a reboot or shutdown and follows the server afterwards
+func (h *DefaultUpdateHandler) handlePowerCallback(ctx context.Context, callback *telegram.CallbackQuery, data callbacks.Data) error {
+	// Parse callback data: pwr:action:server_id:token
+	params := data.Params
+	if len(params) != 3 {
+		h.logger.Error("Invalid callback data format", "params", params)
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неверный формат данных")
+	}
+
+	action, serverID, token := params[0], params[1], params[2]
+	chatID := callback.Message.Chat.ID
+	messageID := callback.Message.MessageID
+
+	if action == "no" {
+		if !h.powerService.Cancel(token, callback.From.ID) {
+			return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Подтверждение недействительно")
+		}
+		if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "Отменено"); err != nil {
+			h.logger.Error("Failed to answer callback", "error", err)
+		}
+		return h.telegramSvc.EditMessage(ctx, chatID, messageID, "❌ Отменено.", nil)
+	}
+	if action != "ok" {
+		h.logger.Warn("Unknown power action", "action", action)
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неизвестное действие")
+	}
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Внутренняя ошибка")
+	}
+
+	server := mapping.ServerByID(servers, serverID)
+	if server == nil {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Сервер не найден")
+	}
+
+	power, err := h.powerService.Confirm(ctx, mapping.UserID(user), callback.From.ID, server, token, time.Now())
+	if err != nil {
+		var text string
+		switch {
+		case errors.IsErrorCode(err, errors.ErrCodeForbidden):
+			return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "⛔ Подтвердить может только тот, кто запросил действие")
+		case errors.IsErrorCode(err, errors.ErrCodeNotFound):
+			text = "⌛ Время на подтверждение истекло. Повторите команду."
+		case errors.IsErrorCode(err, errors.ErrCodeValidation):
+			text = fmt.Sprintf("⏳ Сервер %s уже перезагружается или выключается.", server.Name)
+		default:
+			text = agentErrorMessage(err, server, "❌ Не удалось отправить команду агенту. Попробуйте позже.")
+		}
+		if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, ""); err != nil {
+			h.logger.Error("Failed to answer callback", "error", err)
+		}
+		return h.telegramSvc.EditMessage(ctx, chatID, messageID, text, nil)
+	}
+
+	if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "Команда отправлена"); err != nil {
+		h.logger.Error("Failed to answer callback", "error", err)
+	}
+
+	// The server is followed well past the update processing timeout
+	go h.followPowerAction(context.WithoutCancel(ctx), chatID, power)
+
+	text := fmt.Sprintf("✅ %s(%s) перезагружается. Сообщу, когда сервер уйдет из сети и вернется.", server.Name, server.ID)
+	if power.Action == services.PowerShutdown {
+		text = fmt.Sprintf("✅ %s(%s) выключается. Сообщу, когда сервер уйдет из сети.", server.Name, server.ID)
+	}
+	return h.telegramSvc.EditMessage(ctx, chatID, messageID, text, nil)
+}
+
+// followPowerAction probes a rebooting or shutting down server and reports when it goes
+// offline and comes back
+func (h *DefaultUpdateHandler) followPowerAction(ctx context.Context, chatID int64, power *services.PowerAction) {
+	defer h.powerService.Finish(power.ServerID)
+
+	ticker := time.NewTicker(powerProbeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			text, done := h.powerService.Observe(power, h.powerService.Reachable(ctx, power), now)
+			if text != "" {
+				if err := h.telegramSvc.SendMessage(ctx, chatID, text); err != nil {
+					h.logger.Error("Failed to send power action state", "error", err, "server_id", power.ServerID)
+				}
+			}
+			if done {
+				return
+			}
+		}
+	}
+}
+
+// powerActionVerb returns the Russian verb of a power action
+func powerActionVerb(action string) string {
+	if action == services.PowerShutdown {
+		return "Выключить"
+	}
+	return "Перезагрузить"
+}
+
+// createPowerConfirmKeyboard creates inline keyboard confirming a reboot or shutdown.
+// callbacks.ErrTooLong is returned for server IDs too long for the confirm button.
+func createPowerConfirmKeyboard(serverID, token, action string) (interface{}, error) {
+	confirm, err := powerCallback.Data("ok", serverID, token)
+	if err != nil {
+		return nil, err
+	}
+	return [][]map[string]string{
+		{
+			{"text": "✅ " + powerActionVerb(action), "callback_data": confirm},
+			powerCallback.Button("❌ Отмена", "no", serverID, token),
+		},
+	}, nil
+}
@@ -0,0 +1,102 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/pkg/domain"
+)
+
+// forgetMeWarning is shown before a user erases their data
+const forgetMeWarning = `🗑 *Удаление данных*
+
+Будут удалены:
+- ваш профиль (имя и username)
+- все привязанные серверы и доступы к ним
+- маршруты алертов, uptime-проверки и каналы уведомлений
+- расписание отчетов и часовой пояс
+
+Журнал команд на серверах сохраняется для их владельцев. Скачать свои данные перед удалением: /export
+
+Отменить удаление нельзя. Чтобы продолжить, отправьте:
+/forgetme confirm`
+
+// handleExportCommand sends the data the bot stores about the user as a JSON or CSV file
+func (b *Bot) handleExportCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	if len(args) > 0 && strings.ToLower(args[0]) == "servers" {
+		return b.handleExportServersCommand(ctx, cmd, args[1:])
+	}
+
+	format := services.ExportJSON
+	if len(args) > 0 {
+		format = strings.ToLower(args[0])
+	}
+	if len(args) > 1 || (format != services.ExportJSON && format != services.ExportCSV) {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Использование: /export [json|csv] или /export servers [csv|yaml]")
+	}
+
+	user, err := contextUser(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+
+	now := time.Now()
+	export, err := b.exportService.Export(ctx, mapping.UserID(user), telegramID, now)
+	if err != nil {
+		b.logger.Error("Failed to export user data", "error", err, "telegram_id", telegramID)
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось выгрузить данные. Попробуйте позже.")
+	}
+
+	data, err := services.EncodeExport(export, format)
+	if err != nil {
+		b.logger.Error("Failed to encode user data", "error", err, "telegram_id", telegramID, "format", format)
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось выгрузить данные. Попробуйте позже.")
+	}
+
+	fileName := fmt.Sprintf("servereye-%d-%s.%s", telegramID, now.UTC().Format("20060102-150405"), format)
+	return b.telegramSvc.SendDocument(ctx, chatID, fileName, data,
+		fmt.Sprintf("📎 Ваши данные: профиль, %d серверов, %d команд из журнала", len(export.Servers), len(export.CommandHistory)))
+}
+
+// handleForgetMeCommand erases the user's profile, servers, alerts and settings once
+// confirmed
+func (b *Bot) handleForgetMeCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	if len(args) != 1 || strings.ToLower(args[0]) != "confirm" {
+		return b.telegramSvc.SendMessage(ctx, chatID, forgetMeWarning)
+	}
+
+	user, err := contextUser(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+
+	adapter, ok := b.userService.(*services.UserServiceAdapter)
+	if !ok {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка сервиса. Попробуйте позже.")
+	}
+	if err := adapter.ForgetUser(ctx, mapping.UserID(user)); err != nil {
+		b.logger.Error("Failed to forget user", "error", err, "telegram_id", telegramID)
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось удалить данные. Попробуйте позже.")
+	}
+
+	// Alert routes and uptime checks are served from memory, drop the user's ones there too
+	if err := b.alertRoutes.Load(ctx); err != nil {
+		b.logger.Error("Failed to reload alert routes", "error", err)
+	}
+	if err := b.uptimeService.Load(ctx); err != nil {
+		b.logger.Error("Failed to reload uptime checks", "error", err)
+	}
+
+	b.logger.Info("User forgotten", "telegram_id", telegramID)
+	return b.telegramSvc.SendMessage(ctx, chatID, "✅ Ваши данные удалены. Если вы снова напишете боту, будет создан новый пустой профиль.")
+}
@@ -0,0 +1,117 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/callbacks"
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/internal/telegram"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// parseProcessTopArgs parses the arguments of /top showing processes: [cpu|mem] [N].
+// It reports false for arguments of the metric peaks form, /top <metric> <period>.
+func parseProcessTopArgs(args []string) (protocol.ProcessSort, int, bool) {
+	sortBy, limit := protocol.ProcessSortCPU, services.DefaultTopProcesses
+	if len(args) > 2 {
+		return "", 0, false
+	}
+
+	if len(args) > 0 {
+		sort, ok := services.ParseProcessSort(args[0])
+		if !ok {
+			return "", 0, false
+		}
+		sortBy = sort
+	}
+
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			return "", 0, false
+		}
+		limit = n
+	}
+
+	return sortBy, limit, true
+}
+
+// sendTopProcesses shows the top processes of a server with buttons switching the sort column
+func (b *Bot) sendTopProcesses(ctx context.Context, chatID, userID, telegramID int64, server *models.ServerWithDetails, sortBy protocol.ProcessSort, limit int) error {
+	if limit < 1 || limit > services.MaxTopProcesses {
+		return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Количество процессов должно быть от 1 до %d.", services.MaxTopProcesses))
+	}
+
+	text, keyboard := fetchTopProcessesMessage(ctx, b.processService, userID, telegramID, server, sortBy, limit)
+	if keyboard == nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, text)
+	}
+	return b.telegramSvc.SendMessageWithKeyboard(ctx, chatID, text, keyboard)
+}
+
+// handleTopProcessesCallback switches the sort column of top processes and refreshes them in place
+func (h *DefaultUpdateHandler) handleTopProcessesCallback(ctx context.Context, callback *telegram.CallbackQuery, data callbacks.Data) error {
+	// Parse callback data: ptop:sort:limit:server_id
+	params := data.Params
+	if len(params) != 3 {
+		h.logger.Error("Invalid callback data format", "params", params)
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неверный формат данных")
+	}
+
+	sortBy, ok := services.ParseProcessSort(params[0])
+	limit, err := strconv.Atoi(params[1])
+	if !ok || err != nil || limit < 1 || limit > services.MaxTopProcesses {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неверный формат данных")
+	}
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Внутренняя ошибка")
+	}
+
+	server := mapping.ServerByID(servers, params[2])
+	if server == nil {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Сервер не найден")
+	}
+
+	if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "Получаю процессы"); err != nil {
+		h.logger.Error("Failed to answer callback", "error", err)
+	}
+
+	text, keyboard := fetchTopProcessesMessage(ctx, h.processService, mapping.UserID(user), callback.From.ID, server, sortBy, limit)
+	return h.telegramSvc.EditMessage(ctx, callback.Message.Chat.ID, callback.Message.MessageID, text, keyboard)
+}
+
+// fetchTopProcessesMessage retrieves top processes and builds the message with its keyboard.
+// The keyboard is nil when processes could not be retrieved.
+func fetchTopProcessesMessage(ctx context.Context, processService *services.ProcessService, userID, telegramID int64, server *models.ServerWithDetails, sortBy protocol.ProcessSort, limit int) (string, interface{}) {
+	top, err := processService.Top(ctx, userID, telegramID, server, sortBy, limit)
+	if err != nil {
+		return agentErrorMessage(err, server, "❌ Не удалось получить список процессов. Попробуйте позже."), nil
+	}
+
+	return processService.FormatTop(server, sortBy, top, time.Now()), createTopProcessesKeyboard(server.ID, sortBy, limit)
+}
+
+// createTopProcessesKeyboard creates inline keyboard switching the sort column and refreshing processes
+func createTopProcessesKeyboard(serverID string, sortBy protocol.ProcessSort, limit int) interface{} {
+	cpuText, memText := "CPU", "Память"
+	if sortBy == protocol.ProcessSortMemory {
+		memText = "✅ " + memText
+	} else {
+		cpuText = "✅ " + cpuText
+	}
+
+	return [][]map[string]string{
+		{
+			topProcessesCallback.Button(cpuText, "cpu", strconv.Itoa(limit), serverID),
+			topProcessesCallback.Button(memText, "mem", strconv.Itoa(limit), serverID),
+			topProcessesCallback.Button("🔄 Обновить", string(sortBy), strconv.Itoa(limit), serverID),
+		},
+	}
+}
@@ -0,0 +1,58 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/config"
+	"github.com/servereye/servereyebot/internal/ratelimit"
+)
+
+// Rate limit scopes, also used as metric labels
+const (
+	rateLimitScopeCommands = "commands"
+	rateLimitScopeHTTP     = "http"
+	rateLimitScopeAgent    = "agent"
+)
+
+// newRateLimiter creates the rate limiter of the configured backend, nil when rate limiting is disabled
+func newRateLimiter(cfg *config.Config) (*ratelimit.Limiter, error) {
+	if !cfg.RateLimit.Enabled {
+		return nil, nil
+	}
+
+	switch cfg.RateLimit.Backend {
+	case "redis":
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Redis.DialTimeout)
+		defer cancel()
+
+		store, err := ratelimit.NewRedisStore(ctx, ratelimit.RedisOptions{
+			Addr:         fmt.Sprintf("%s:%d", cfg.Redis.Host, cfg.Redis.Port),
+			Password:     cfg.Redis.Password,
+			Database:     cfg.Redis.Database,
+			PoolSize:     cfg.Redis.PoolSize,
+			DialTimeout:  cfg.Redis.DialTimeout,
+			ReadTimeout:  cfg.Redis.ReadTimeout,
+			WriteTimeout: cfg.Redis.WriteTimeout,
+			Prefix:       "servereyebot:ratelimit:",
+		})
+		if err != nil {
+			return nil, err
+		}
+		return ratelimit.New(store), nil
+	default:
+		return ratelimit.New(ratelimit.NewMemoryStore()), nil
+	}
+}
+
+// rateLimitRule returns the rule limiting events to limit per configured window
+func (b *Bot) rateLimitRule(limit int) ratelimit.Rule {
+	return ratelimit.Rule{Limit: limit, Window: b.config.RateLimit.Window}
+}
+
+// formatRetryAfter formats the wait of a rate limited user in whole seconds
+func formatRetryAfter(d time.Duration) string {
+	return fmt.Sprintf("%d сек.", int(math.Max(1, math.Ceil(d.Seconds()))))
+}
@@ -0,0 +1,138 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/servereye/servereyebot/internal/config"
+	"github.com/servereye/servereyebot/internal/features"
+	"github.com/servereye/servereyebot/pkg/domain"
+)
+
+// adminUsage is shown when /admin arguments cannot be parsed
+const adminUsage = `🛠 *Администрирование*
+
+/admin reload - Перечитать файл конфигурации без перезапуска
+
+Без перезапуска применяются уровень логов, таймауты получения метрик и обновления агента, пороги и окно корреляции алертов, порог температуры дисков, возраст резервных копий, флаг алертов SLO и флаги функций. Для остальных настроек нужен перезапуск. То же делает сигнал SIGHUP.`
+
+// levelSetter is implemented by loggers whose level can change at runtime
+type levelSetter interface {
+	SetLevel(level string) error
+}
+
+// handleAdminCommand runs bot maintenance actions for admins
+func (b *Bot) handleAdminCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	if len(args) != 1 || args[0] != "reload" {
+		return b.telegramSvc.SendMessage(ctx, chatID, adminUsage)
+	}
+
+	if b.config.File == "" {
+		return b.telegramSvc.SendMessage(ctx, chatID, "ℹ️ Бот запущен без файла конфигурации (-config), перечитывать нечего.")
+	}
+
+	restart, err := b.ReloadConfig()
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Новая конфигурация отклонена, работает прежняя.\n\n%v", err))
+	}
+
+	message := "✅ Конфигурация перечитана и применена."
+	if len(restart) > 0 {
+		message += "\n\n⚠️ Изменения в разделах " + strings.Join(restart, ", ") + " вступят в силу после перезапуска."
+	}
+	return b.telegramSvc.SendMessage(ctx, chatID, message)
+}
+
+// ReloadConfig re-reads the configuration and applies the settings that can change at
+// runtime. A configuration that fails validation is rejected, and when applying it fails
+// the previous settings are restored, so the bot keeps running with a valid configuration.
+// It returns the sections whose changes take effect only after a restart.
+func (b *Bot) ReloadConfig() ([]string, error) {
+	b.configMu.Lock()
+	defer b.configMu.Unlock()
+
+	next, err := config.LoadFile(b.config.File)
+	if err != nil {
+		b.logger.Error("Failed to reload configuration", "error", err, "file", b.config.File)
+		return nil, err
+	}
+	if err := next.Validate(); err != nil {
+		b.logger.Error("Reloaded configuration is invalid", "error", err, "file", b.config.File)
+		return nil, err
+	}
+
+	previous := *b.config
+	if err := b.applyConfig(next); err != nil {
+		b.logger.Error("Failed to apply reloaded configuration, rolling back", "error", err)
+		if rollbackErr := b.applyConfig(&previous); rollbackErr != nil {
+			b.logger.Error("Failed to roll back configuration", "error", rollbackErr)
+		}
+		return nil, err
+	}
+
+	copyReloadable(b.config, next)
+	restart := changedSections(b.config, next)
+	b.logger.Info("Configuration reloaded", "file", b.config.File, "restart_required", strings.Join(restart, ","))
+	return restart, nil
+}
+
+// currentConfig returns a copy of the configuration, safe to read while reloads happen
+func (b *Bot) currentConfig() config.Config {
+	b.configMu.RLock()
+	defer b.configMu.RUnlock()
+
+	return *b.config
+}
+
+// applyConfig hands the reloadable settings of a configuration to the services using them
+func (b *Bot) applyConfig(cfg *config.Config) error {
+	if logger, ok := b.logger.(levelSetter); ok {
+		if err := logger.SetLevel(cfg.Logger.Level); err != nil {
+			return fmt.Errorf("failed to set log level: %w", err)
+		}
+	}
+
+	b.metricsService.SetFetchTimeout(cfg.Timeouts.MetricsFetch)
+	b.agentUpdates.SetRollbackAfter(cfg.Timeouts.AgentUpdate)
+	b.alertService.SetDefaults(cfg.Monitoring.AlertThresholds, cfg.Monitoring.CorrelationWindow)
+	b.metricsService.SetSeverity(b.alertService, cfg.Monitoring.WarningRatio)
+	b.smartService.SetTemperature(cfg.Monitoring.SMARTTemperature)
+	b.backupService.SetMaxAge(cfg.Monitoring.BackupMaxAge)
+	b.features.SetDefaults(features.Defaults(cfg.Features.Rollout, cfg.Features.Users))
+	return nil
+}
+
+// copyReloadable copies the settings applied by applyConfig
+func copyReloadable(dst, src *config.Config) {
+	dst.Logger.Level = src.Logger.Level
+	dst.Timeouts.MetricsFetch = src.Timeouts.MetricsFetch
+	dst.Timeouts.AgentUpdate = src.Timeouts.AgentUpdate
+	dst.Monitoring.AlertThresholds = src.Monitoring.AlertThresholds
+	dst.Monitoring.WarningRatio = src.Monitoring.WarningRatio
+	dst.Monitoring.CorrelationWindow = src.Monitoring.CorrelationWindow
+	dst.Monitoring.SMARTTemperature = src.Monitoring.SMARTTemperature
+	dst.Monitoring.BackupMaxAge = src.Monitoring.BackupMaxAge
+	dst.SLO.AlertsEnabled = src.SLO.AlertsEnabled
+	dst.Features.Rollout = src.Features.Rollout
+	dst.Features.Users = src.Features.Users
+}
+
+// changedSections returns the yaml names of the configuration sections that differ
+func changedSections(current, next *config.Config) []string {
+	var changed []string
+	a, b := reflect.ValueOf(current).Elem(), reflect.ValueOf(next).Elem()
+	for i := 0; i < a.NumField(); i++ {
+		name, _, _ := strings.Cut(a.Type().Field(i).Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
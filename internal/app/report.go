@@ -0,0 +1,237 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	stderrors "errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/notify"
+	"github.com/servereye/servereyebot/internal/scheduler"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/pkg/domain"
+)
+
+// reportUsage is shown when /report arguments cannot be parsed
+const reportUsage = `📋 *Отчеты по серверам*
+
+/report - Текущее расписание
+/report daily 09:00 - Ежедневный отчет
+/report weekly mon 09:00 - Еженедельный отчет
+/report now - Отправить отчет сейчас
+/report sections cpu,disk,containers - Разделы отчета
+/report order <server_id> ... - Порядок серверов в отчете
+/report tz Europe/Moscow - Установить часовой пояс
+/report off - Отключить отчеты
+
+Разделы: uptime, cpu, memory, disk, processes, alerts, containers. "default" возвращает разделы и порядок по умолчанию.`
+
+// handleReportCommand manages scheduled summary reports
+func (b *Bot) handleReportCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	user, err := contextUser(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+	userID := mapping.UserID(user)
+
+	if len(args) == 0 {
+		return b.sendReportStatus(ctx, chatID, userID)
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "off":
+		if err := b.reportService.DisableSchedule(ctx, userID); err != nil {
+			b.logger.Error("Failed to disable report schedule", "error", err, "user_id", userID)
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось отключить отчеты. Попробуйте позже.")
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, "✅ Отчеты отключены.")
+
+	case "now":
+		tmpl := services.ReportTemplate{}
+		period := services.ReportPeriod("")
+		if rs, err := b.reportService.GetSchedule(ctx, userID); err == nil {
+			tmpl = services.TemplateFromModel(rs)
+			period = services.ReportPeriod(rs.Frequency)
+		}
+
+		report, err := b.reportService.BuildReport(ctx, userID, telegramID, "Сводка по серверам", tmpl, period)
+		if err != nil {
+			b.logger.Error("Failed to build report", "error", err, "user_id", userID)
+			return b.telegramSvc.SendMessage(ctx, chatID, dependencyMessage(b.dependencyService, "❌ Не удалось сформировать отчет. Попробуйте позже.", b.userLocation(ctx, userID), services.DependencyDatabase, services.DependencyMetrics))
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, report)
+
+	case "tz":
+		if len(args) < 2 {
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите часовой пояс. Пример: /report tz Europe/Moscow")
+		}
+		if err := b.reportService.SetTimezone(ctx, userID, args[1]); err != nil {
+			b.logger.Warn("Failed to set timezone", "error", err, "user_id", userID, "timezone", args[1])
+			return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Неизвестный часовой пояс `%s`.", args[1]))
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("✅ Часовой пояс установлен: %s", args[1]))
+
+	case "sections", "order":
+		return b.handleReportTemplate(ctx, chatID, userID, strings.ToLower(args[0]), args[1:])
+	}
+
+	schedule, err := scheduler.Parse(args)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, reportUsage)
+	}
+
+	if err := b.reportService.SetSchedule(ctx, userID, schedule); err != nil {
+		b.logger.Error("Failed to save report schedule", "error", err, "user_id", userID)
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось сохранить расписание. Попробуйте позже.")
+	}
+
+	return b.sendReportStatus(ctx, chatID, userID)
+}
+
+// handleReportTemplate changes the sections or the server order of a user's scheduled report
+func (b *Bot) handleReportTemplate(ctx context.Context, chatID, userID int64, action string, args []string) error {
+	if len(args) == 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, reportUsage)
+	}
+
+	rs, err := b.reportService.GetSchedule(ctx, userID)
+	if err != nil {
+		if stderrors.Is(err, sql.ErrNoRows) {
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Сначала настройте расписание: /report daily 09:00")
+		}
+		b.logger.Error("Failed to get report schedule", "error", err, "user_id", userID)
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось получить расписание. Попробуйте позже.")
+	}
+
+	tmpl := services.TemplateFromModel(rs)
+	reset := len(args) == 1 && strings.ToLower(args[0]) == "default"
+
+	switch action {
+	case "sections":
+		tmpl.Sections = nil
+		if !reset {
+			sections, err := services.ParseReportSections(args)
+			if err != nil {
+				return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Неизвестный раздел. Доступные разделы: %s",
+					strings.Join(services.ReportSections(), ", ")))
+			}
+			tmpl.Sections = sections
+		}
+
+	case "order":
+		tmpl.ServerOrder = nil
+		if !reset {
+			_, servers, err := contextServers(ctx)
+			if err != nil {
+				return b.telegramSvc.SendMessage(ctx, chatID, "❌ Произошла ошибка при получении списка серверов. Попробуйте позже.")
+			}
+
+			for _, arg := range strings.FieldsFunc(strings.Join(args, " "), func(r rune) bool { return r == ' ' || r == ',' }) {
+				server := mapping.ServerByIDOrName(servers, arg)
+				if server == nil {
+					return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Сервер `%s` не найден в вашем списке.", arg))
+				}
+				tmpl.ServerOrder = append(tmpl.ServerOrder, server.ID)
+			}
+		}
+	}
+
+	if err := b.reportService.SetTemplate(ctx, userID, tmpl); err != nil {
+		b.logger.Error("Failed to save report template", "error", err, "user_id", userID)
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось сохранить шаблон отчета. Попробуйте позже.")
+	}
+
+	return b.sendReportStatus(ctx, chatID, userID)
+}
+
+// sendReportStatus sends the current report schedule of a user
+func (b *Bot) sendReportStatus(ctx context.Context, chatID, userID int64) error {
+	timezone, err := b.reportService.GetTimezone(ctx, userID)
+	if err != nil {
+		timezone = "UTC"
+	}
+
+	rs, err := b.reportService.GetSchedule(ctx, userID)
+	if err != nil {
+		if stderrors.Is(err, sql.ErrNoRows) {
+			return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("Отчеты не настроены (часовой пояс: %s).\n\n%s", timezone, reportUsage))
+		}
+		b.logger.Error("Failed to get report schedule", "error", err, "user_id", userID)
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось получить расписание. Попробуйте позже.")
+	}
+
+	loc, err := time.LoadLocation(rs.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	schedule := services.ScheduleFromModel(rs)
+	next := schedule.Next(time.Now(), loc)
+
+	message := fmt.Sprintf("📋 Расписание отчетов: %s (%s)\nСледующий отчет: %s",
+		schedule.String(), rs.Timezone, next.Format("02.01.2006 15:04"))
+
+	tmpl := services.TemplateFromModel(rs)
+	if len(tmpl.Sections) > 0 {
+		message += "\nРазделы: " + strings.Join(tmpl.Sections, ", ")
+	}
+	if len(tmpl.ServerOrder) > 0 {
+		message += "\nПорядок серверов: " + strings.Join(tmpl.ServerOrder, ", ")
+	}
+	return b.telegramSvc.SendMessage(ctx, chatID, message)
+}
+
+// runScheduledReports is a scheduler job delivering due reports. Reports that cannot be
+// built or sent are retried with backoff instead of on every run.
+func (b *Bot) runScheduledReports(ctx context.Context, now time.Time) error {
+	b.reportService.Cleanup(ctx, now)
+
+	due, err := b.reportService.DueSchedules(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	for _, rs := range due {
+		title := "Ежедневная сводка по серверам"
+		if rs.Frequency == string(scheduler.FrequencyWeekly) {
+			title = "Еженедельная сводка по серверам"
+		}
+
+		report, err := b.reportService.BuildReport(ctx, rs.UserID, rs.TelegramID, title, services.TemplateFromModel(&rs), services.ReportPeriod(rs.Frequency))
+		if err != nil {
+			b.failScheduledReport(ctx, &rs, now, fmt.Errorf("build report: %w", err))
+			continue
+		}
+
+		if err := b.telegramSvc.SendMessage(ctx, rs.TelegramID, report); err != nil {
+			b.failScheduledReport(ctx, &rs, now, fmt.Errorf("send report: %w", err))
+			continue
+		}
+		if b.userSettings(ctx, rs.UserID).NotifyReports {
+			if err := b.notifyService.Publish(ctx, rs.TelegramID, nil, notify.Message{Title: title, Text: report}); err != nil {
+				b.logger.Error("Failed to publish report to notification channels", "error", err, "telegram_id", rs.TelegramID)
+			}
+		}
+
+		if err := b.reportService.MarkSent(ctx, rs.ID, now); err != nil {
+			b.logger.Error("Failed to mark report as sent", "error", err, "schedule_id", rs.ID)
+		}
+	}
+
+	return nil
+}
+
+// failScheduledReport records a scheduled report that could not be delivered, so that
+// it is retried later rather than rebuilt on every run
+func (b *Bot) failScheduledReport(ctx context.Context, rs *models.ReportSchedule, now time.Time, reportErr error) {
+	if err := b.reportService.MarkFailed(ctx, rs, now, reportErr); err != nil {
+		b.logger.Error("Failed to record failed report", "error", err, "schedule_id", rs.ID)
+	}
+}
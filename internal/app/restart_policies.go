@@ -0,0 +1,169 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/httpserver"
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// maxRestartPolicyRequestSize limits the body of an agent restart policy report
+const maxRestartPolicyRequestSize = 4096
+
+// restartPolicyUsage is shown when /restartpolicy arguments cannot be parsed
+const restartPolicyUsage = `🔁 *Политики перезапуска*
+
+/restartpolicy [server_id] - Политики контейнеров сервера
+/restartpolicy [server_id] set <container> <N> - Не перезапускать контейнер, упавший больше N раз за час
+/restartpolicy [server_id] off <container> - Удалить политику
+
+Политики применяет агент по событиям Docker. Задавать их может владелец сервера.`
+
+// restartPoliciesResponse represents the reply to an agent fetching its restart policies
+type restartPoliciesResponse struct {
+	Status   string                   `json:"status"`
+	Policies []protocol.RestartPolicy `json:"policies,omitempty"`
+}
+
+// handleRestartPolicyCommand lists, sets and removes restart policies of containers
+func (b *Bot) handleRestartPolicyCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+
+	if len(servers) == 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ У вас нет добавленных серверов. Используйте /add <server_id> для добавления сервера.")
+	}
+
+	server, args := resolveServerArg(servers, args)
+	if server == nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите сервер.\n\n"+restartPolicyUsage)
+	}
+
+	if len(args) == 0 {
+		policies, err := b.restartPolicies.List(ctx, server.ID)
+		if err != nil {
+			b.logger.Error("Failed to list restart policies", "error", err, "server_id", server.ID)
+			return b.telegramSvc.SendMessage(ctx, chatID, dependencyMessage(b.dependencyService, "❌ Не удалось получить политики. Попробуйте позже.", nil, services.DependencyDatabase))
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, services.FormatRestartPolicies(server, policies))
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "set":
+		if len(args) != 3 {
+			return b.telegramSvc.SendMessage(ctx, chatID, restartPolicyUsage)
+		}
+		maxRestarts, err := strconv.Atoi(args[2])
+		if err != nil {
+			return b.telegramSvc.SendMessage(ctx, chatID, restartPolicyUsage)
+		}
+
+		synced, err := b.restartPolicies.Set(ctx, mapping.UserID(user), telegramID, server, args[1], maxRestarts)
+		if err != nil {
+			if errors.IsErrorCode(err, errors.ErrCodeForbidden) {
+				return b.telegramSvc.SendMessage(ctx, chatID, "⛔ Задавать политики может только владелец сервера.")
+			}
+			if errors.IsErrorCode(err, errors.ErrCodeValidation) {
+				return b.telegramSvc.SendMessage(ctx, chatID, "❌ Имя контейнера не должно содержать пробелов, а лимит должен быть от 1 до 100 рестартов в час.")
+			}
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось сохранить политику. Попробуйте позже.")
+		}
+
+		message := fmt.Sprintf("✅ Контейнер %s на %s(%s) перестанет автоматически перезапускаться, если упадет больше %d раз за час. Об этом придет алерт.", args[1], server.Name, server.ID, maxRestarts)
+		if !synced {
+			message += "\n\n⚠️ Агент сейчас недоступен и получит политику при следующем подключении."
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, message)
+
+	case "off":
+		if len(args) != 2 {
+			return b.telegramSvc.SendMessage(ctx, chatID, restartPolicyUsage)
+		}
+
+		removed, synced, err := b.restartPolicies.Remove(ctx, mapping.UserID(user), telegramID, server, args[1])
+		if err != nil {
+			if errors.IsErrorCode(err, errors.ErrCodeForbidden) {
+				return b.telegramSvc.SendMessage(ctx, chatID, "⛔ Удалять политики может только владелец сервера.")
+			}
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось удалить политику. Попробуйте позже.")
+		}
+		if !removed {
+			return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ У контейнера %s нет политики перезапуска.", args[1]))
+		}
+
+		message := fmt.Sprintf("✅ Политика перезапуска контейнера %s удалена.", args[1])
+		if !synced {
+			message += "\n\n⚠️ Агент сейчас недоступен и получит изменения при следующем подключении."
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, message)
+
+	default:
+		return b.telegramSvc.SendMessage(ctx, chatID, restartPolicyUsage)
+	}
+}
+
+// handleRestartPoliciesRequest serves the restart policies of an authenticated agent on
+// GET, which agents do on start, and takes reports of containers no longer restarted on POST
+func (b *Bot) handleRestartPoliciesRequest(w http.ResponseWriter, r *http.Request) {
+	serverKey, _ := httpserver.AgentKey(r.Context())
+
+	switch r.Method {
+	case http.MethodGet:
+		policies, err := b.restartPolicies.ForAgent(r.Context(), serverKey)
+		if err != nil {
+			httpserver.RequestLogger(b.logger, r).Error("Failed to list restart policies for agent", "error", err)
+			httpserver.WriteError(w, r, http.StatusBadGateway, errors.ErrCodeExternal, "failed to list restart policies")
+			return
+		}
+		writeAgentResponse(w, http.StatusOK, restartPoliciesResponse{Status: "ok", Policies: policies})
+
+	case http.MethodPost:
+		var report protocol.RestartPolicyTripped
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRestartPolicyRequestSize)).Decode(&report); err != nil || report.Container == "" {
+			httpserver.WriteError(w, r, http.StatusBadRequest, errors.ErrCodeInvalidInput, "invalid request body")
+			return
+		}
+
+		policy, err := b.restartPolicies.Tripped(r.Context(), serverKey, report, time.Now())
+		if err != nil {
+			status := http.StatusBadGateway
+			if appErr, ok := err.(*errors.AppError); ok && appErr.HTTPStatus != 0 {
+				status = appErr.HTTPStatus
+			}
+			httpserver.WriteError(w, r, status, httpserver.ErrorCodeOf(err, errors.ErrCodeExternal), err.Error())
+			return
+		}
+		writeAgentResponse(w, http.StatusOK, restartPoliciesResponse{Status: "ok"})
+
+		// The agent does not wait for the alert
+		alertCtx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 30*time.Second)
+		go func() {
+			defer cancel()
+			b.deliverAlerts(alertCtx, []services.AlertNotification{{
+				TelegramID: policy.CreatedBy,
+				ServerIDs:  []string{policy.ServerID},
+				Category:   services.AlertCategoryContainers,
+				Text: fmt.Sprintf("🔁 Контейнер %s на сервере %s упал %d раз за %s и больше не перезапускается автоматически (политика: не больше %d в час, последний код выхода %d).\n\nЛоги: /logs %s %s",
+					report.Container, policy.ServerID, report.Restarts, time.Duration(report.WindowSeconds)*time.Second, policy.MaxRestarts, report.ExitCode, policy.ServerID, report.Container),
+			}})
+		}()
+
+	default:
+		httpserver.MethodNotAllowed(w, r)
+	}
+}
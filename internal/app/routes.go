@@ -0,0 +1,91 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// routeUsage is shown when /route arguments cannot be parsed
+const routeUsage = `🔀 *Маршруты алертов*
+
+/route - Куда приходят ваши алерты
+/route <категория> [server_id] - Присылать алерты категории в этот чат
+/route remove <категория> [server_id] - Удалить маршрут
+
+Отправьте команду в чат, куда должны приходить алерты: например, /route disk в группе инфраструктуры, а /route checks в личном чате с ботом. Маршрут сервера важнее маршрута всех серверов, маршрут категории важнее маршрута all.
+
+Категории:
+`
+
+// handleRouteCommand routes the user's alerts of a category to the chat the command is sent to
+func (b *Bot) handleRouteCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	usage := routeUsage + services.FormatAlertCategories()
+	if len(args) == 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, services.FormatAlertRoutes(b.alertRoutes.List(telegramID), telegramID))
+	}
+
+	remove := strings.ToLower(args[0]) == "remove"
+	if remove {
+		args = args[1:]
+	}
+	if len(args) == 0 || len(args) > 2 {
+		return b.telegramSvc.SendMessage(ctx, chatID, usage)
+	}
+
+	category, ok := services.ParseAlertCategory(args[0])
+	if !ok {
+		return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Неизвестная категория %s.\n\nКатегории:\n%s", args[0], services.FormatAlertCategories()))
+	}
+
+	var serverID string
+	if len(args) == 2 {
+		_, servers, err := contextServers(ctx)
+		if err != nil {
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+		}
+
+		server := mapping.ServerByIDOrName(servers, args[1])
+		if server == nil {
+			return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Сервер `%s` не найден среди ваших серверов.", args[1]))
+		}
+		serverID = server.ID
+	}
+
+	servers := "всех ваших серверов"
+	if serverID != "" {
+		servers = "сервера " + serverID
+	}
+
+	if remove {
+		removed, err := b.alertRoutes.Remove(ctx, telegramID, serverID, category)
+		if err != nil {
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось удалить маршрут. Попробуйте позже.")
+		}
+		if !removed {
+			return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Маршрута категории %s для %s нет.", category, servers))
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("✅ Маршрут удален: алерты категории %s для %s снова приходят по общим правилам.", category, servers))
+	}
+
+	if _, err := b.alertRoutes.Set(ctx, telegramID, serverID, category, chatID); err != nil {
+		if errors.IsErrorCode(err, errors.ErrCodeValidation) {
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Слишком много маршрутов. Удалите ненужные: /route remove <категория> [server_id]")
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось сохранить маршрут. Попробуйте позже.")
+	}
+
+	target := "в этот чат"
+	if !isGroupChat(chatID, telegramID) {
+		target = "в личный чат"
+	}
+	return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("✅ Алерты категории %s для %s будут приходить %s.", category, servers, target))
+}
@@ -0,0 +1,56 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// runSecretCheck is a scheduler job alerting admins about rotated secrets and, when
+// configured, stopping the bot so that its supervisor restarts it with them
+func (b *Bot) runSecretCheck(ctx context.Context, now time.Time) error {
+	rotated := b.secretRotation.Check(ctx, now)
+	if len(rotated) == 0 {
+		return nil
+	}
+
+	restart := b.currentConfig().Secrets.RestartOnRotation
+	b.logger.Warn("Secrets rotated", "references", strings.Join(rotated, ","), "restart", restart)
+
+	message := fmt.Sprintf("🔑 Изменились секреты: %s\n\n", strings.Join(rotated, ", "))
+	if restart {
+		message += "Бот перезапускается, чтобы применить их."
+	} else {
+		message += "Новые значения вступят в силу после перезапуска бота."
+	}
+
+	admins, err := b.repo.ListAdminTelegramIDs(ctx)
+	if err != nil {
+		b.logger.Error("Failed to list admins for secret rotation alert", "error", err)
+	}
+	for _, adminID := range admins {
+		if err := b.telegramSvc.SendMessage(ctx, adminID, message); err != nil {
+			b.logger.Error("Failed to send secret rotation alert", "error", err, "telegram_id", adminID)
+		}
+	}
+
+	if restart {
+		b.requestRestart()
+	}
+	return nil
+}
+
+// requestRestart asks the process running the bot to stop it gracefully
+func (b *Bot) requestRestart() {
+	select {
+	case b.restart <- struct{}{}:
+	default:
+	}
+}
+
+// RestartRequested is signalled when the bot needs a restart to apply rotated secrets.
+// The supervisor of the process is expected to start it again.
+func (b *Bot) RestartRequested() <-chan struct{} {
+	return b.restart
+}
@@ -0,0 +1,72 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/pkg/domain"
+)
+
+// handleSyncNamesCommand names the servers of the user after the hostnames their agents
+// report. Servers the user named keep their names unless "all" is given.
+func (b *Bot) handleSyncNamesCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	overwrite := len(args) == 1 && strings.ToLower(args[0]) == "all"
+	if len(args) > 0 && !overwrite {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Использование: /syncnames [all]")
+	}
+
+	user, err := contextUser(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+
+	adapter, ok := b.userService.(*services.UserServiceAdapter)
+	if !ok {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка сервиса. Попробуйте позже.")
+	}
+
+	started := time.Now()
+	report, err := adapter.SyncServerNames(ctx, mapping.UserID(user), overwrite)
+	if err != nil {
+		b.logger.Error("Failed to sync server names", "error", err, "telegram_id", telegramID)
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось обновить имена серверов. Попробуйте позже.")
+	}
+	for _, renamed := range report.Renamed {
+		b.auditService.RecordResult(ctx, mapping.UserID(user), telegramID, renamed.ServerID, services.AuditCommandRenameServer, "name="+renamed.NewName+" source=agent", "", started, nil)
+	}
+
+	return b.telegramSvc.SendMessage(ctx, chatID, formatSyncNamesReport(report, overwrite))
+}
+
+// formatSyncNamesReport formats the names refreshed by /syncnames
+func formatSyncNamesReport(report *services.SyncNamesReport, overwrite bool) string {
+	if len(report.Renamed)+len(report.Failed)+report.Unchanged+report.Custom+report.Shared == 0 {
+		return "У вас пока нет добавленных серверов.\n\nИспользуйте команду /add <server_id> чтобы добавить сервер."
+	}
+
+	var sb strings.Builder
+	sb.WriteString("🏷 Имена серверов\n\n")
+	for _, renamed := range report.Renamed {
+		sb.WriteString(fmt.Sprintf("✅ %s → %s\n", renamed.OldName, renamed.NewName))
+	}
+	for _, failed := range report.Failed {
+		sb.WriteString(fmt.Sprintf("❌ %s: не удалось получить имя хоста от агента\n", failed.OldName))
+	}
+	if report.Unchanged > 0 {
+		sb.WriteString(fmt.Sprintf("➖ Уже актуальны: %d\n", report.Unchanged))
+	}
+	if report.Shared > 0 {
+		sb.WriteString(fmt.Sprintf("🔒 Серверов, где вы не администратор: %d. Их имена меняет владелец\n", report.Shared))
+	}
+	if report.Custom > 0 && !overwrite {
+		sb.WriteString(fmt.Sprintf("\n✏️ Серверов с заданными вами именами: %d. Чтобы заменить и их, отправьте /syncnames all", report.Custom))
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
@@ -0,0 +1,428 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	stderrors "errors"
+	"fmt"
+	"strings"
+
+	"github.com/servereye/servereyebot/internal/branding"
+	"github.com/servereye/servereyebot/internal/callbacks"
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/internal/telegram"
+	"github.com/servereye/servereyebot/pkg/domain"
+)
+
+// handleDefaultCommand sets the server metric commands use when no server is given.
+// Without arguments it shows the current default with buttons to change it.
+func (b *Bot) handleDefaultCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	user, err := contextUser(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, dependencyMessage(b.dependencyService, "❌ Внутренняя ошибка. Попробуйте позже.", nil, services.DependencyDatabase))
+	}
+	userID := mapping.UserID(user)
+
+	_, servers, err := contextServers(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, dependencyMessage(b.dependencyService, "❌ Произошла ошибка при получении списка серверов. Попробуйте позже.", nil, services.DependencyDatabase))
+	}
+
+	if len(servers) == 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ У вас нет добавленных серверов. Используйте /add <server_id> для добавления сервера.")
+	}
+
+	if len(args) == 0 {
+		defaultServerID, err := b.settingsService.DefaultServer(ctx, userID)
+		if err != nil {
+			return b.telegramSvc.SendMessage(ctx, chatID, dependencyMessage(b.dependencyService, "❌ Не удалось получить настройки. Попробуйте позже.", nil, services.DependencyDatabase))
+		}
+		text, keyboard := defaultServerMessage(servers, defaultServerID)
+		return b.telegramSvc.SendMessageWithKeyboard(ctx, chatID, text, keyboard)
+	}
+
+	if strings.EqualFold(args[0], "off") {
+		if err := b.settingsService.ClearDefaultServer(ctx, userID); err != nil {
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось сбросить сервер по умолчанию. Попробуйте позже.")
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, "✅ Сервер по умолчанию сброшен. Команды метрик снова будут предлагать выбор сервера.")
+	}
+
+	server := mapping.ServerByIDOrName(servers, args[0])
+	if server == nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Сервер `%s` не найден в вашем списке.", args[0]))
+	}
+	if err := b.settingsService.SetDefaultServer(ctx, userID, server); err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось сохранить сервер по умолчанию. Попробуйте позже.")
+	}
+	return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("⭐ Сервер по умолчанию: %s(%s)\n\nКоманды метрик без аргумента будут показывать его. Сбросить: /default off", server.Name, server.ID))
+}
+
+// handleDefaultServerCallback handles choosing or clearing the default server from the settings keyboard
+func (h *DefaultUpdateHandler) handleDefaultServerCallback(ctx context.Context, callback *telegram.CallbackQuery, data callbacks.Data) error {
+	// Parse callback data: dflt:set:server_id or dflt:off
+	params := data.Params
+	if len(params) == 0 || (params[0] == "set" && len(params) != 2) {
+		h.logger.Error("Invalid callback data format", "params", params)
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неверный формат данных")
+	}
+
+	user, err := contextUser(ctx)
+	if err != nil {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Внутренняя ошибка")
+	}
+	userID := mapping.UserID(user)
+
+	_, servers, err := contextServers(ctx)
+	if err != nil {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Ошибка получения серверов")
+	}
+
+	var defaultServerID, answer string
+	switch params[0] {
+	case "set":
+		server := mapping.ServerByID(servers, params[1])
+		if server == nil {
+			return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Сервер не найден")
+		}
+		if err := h.settingsService.SetDefaultServer(ctx, userID, server); err != nil {
+			return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Не удалось сохранить настройку")
+		}
+		defaultServerID, answer = server.ID, "⭐ "+server.Name
+	case "off":
+		if err := h.settingsService.ClearDefaultServer(ctx, userID); err != nil {
+			return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Не удалось сбросить настройку")
+		}
+		answer = "Сервер по умолчанию сброшен"
+	default:
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неизвестное действие")
+	}
+
+	if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, answer); err != nil {
+		h.logger.Error("Failed to answer callback", "error", err)
+	}
+	text, keyboard := defaultServerMessage(servers, defaultServerID)
+	return h.telegramSvc.EditMessage(ctx, callback.Message.Chat.ID, callback.Message.MessageID, text, keyboard)
+}
+
+// defaultServerMessage describes the default server of a user with buttons to change it
+func defaultServerMessage(servers []models.ServerWithDetails, defaultServerID string) (string, interface{}) {
+	var sb strings.Builder
+	sb.WriteString("⚙️ Сервер по умолчанию\n\n")
+	sb.WriteString(fmt.Sprintf("Сейчас: %s\n", defaultServerLabel(servers, defaultServerID)))
+	sb.WriteString("\nКоманды метрик без аргумента, например /cpu, показывают сервер по умолчанию вместо выбора сервера.")
+
+	var keyboard [][]map[string]string
+	for _, server := range servers {
+		text := fmt.Sprintf("🖥️ %s(%s)", server.Name, server.ID)
+		if server.ID == defaultServerID {
+			text = fmt.Sprintf("⭐ %s(%s)", server.Name, server.ID)
+		}
+		keyboard = append(keyboard, []map[string]string{
+			defaultServerCallback.Button(text, "set", server.ID),
+		})
+	}
+	if defaultServerID != "" {
+		keyboard = append(keyboard, []map[string]string{
+			defaultServerCallback.Button("🚫 Сбросить", "off"),
+		})
+	}
+	keyboard = append(keyboard, settingsBackRow())
+	return sb.String(), keyboard
+}
+
+// settingsTimezones are offered by the settings menu, other zones are set with /report tz
+var settingsTimezones = []string{
+	"UTC",
+	"Europe/London",
+	"Europe/Berlin",
+	"Europe/Moscow",
+	"Asia/Yekaterinburg",
+	"Asia/Novosibirsk",
+	"Asia/Vladivostok",
+	"America/New_York",
+}
+
+// settingsQuietHours are the quiet hours offered by the settings menu, as from and to hours
+var settingsQuietHours = [][2]int{{22, 7}, {23, 8}, {0, 9}}
+
+// languageNames are the names of supported languages shown in the settings menu
+var languageNames = map[string]string{
+	branding.LocaleRussian: "🇷🇺 Русский",
+	branding.LocaleEnglish: "🇬🇧 English",
+}
+
+// userSettings returns the settings of a user, the defaults when they cannot be read
+func (b *Bot) userSettings(ctx context.Context, userID int64) *models.UserSettings {
+	settings, err := b.settingsService.Get(ctx, userID)
+	if err != nil {
+		b.logger.Warn("Failed to get user settings", "error", err, "user_id", userID)
+		return defaultUserSettings()
+	}
+	return settings
+}
+
+// telegramUserSettings returns the settings of a user by Telegram ID, the defaults for
+// unregistered users or when they cannot be read
+func (b *Bot) telegramUserSettings(ctx context.Context, telegramID int64) *models.UserSettings {
+	settings, err := b.settingsService.GetByTelegramID(ctx, telegramID)
+	if err != nil {
+		if !stderrors.Is(err, sql.ErrNoRows) {
+			b.logger.Warn("Failed to get user settings", "error", err, "telegram_id", telegramID)
+		}
+		return defaultUserSettings()
+	}
+	return settings
+}
+
+// defaultUserSettings are the settings of users who changed nothing
+func defaultUserSettings() *models.UserSettings {
+	return &models.UserSettings{NotifyAlerts: true, NotifyReports: true, Timezone: "UTC"}
+}
+
+// handleSettingsCommand shows the settings menu of the user
+func (b *Bot) handleSettingsCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	if isGroupChat(chatID, telegramID) {
+		return b.telegramSvc.SendMessage(ctx, chatID, "⚙️ Настройки доступны в личном чате с ботом.")
+	}
+
+	user, err := contextUser(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, dependencyMessage(b.dependencyService, "❌ Внутренняя ошибка. Попробуйте позже.", nil, services.DependencyDatabase))
+	}
+	userID := mapping.UserID(user)
+
+	settings, err := b.settingsService.Get(ctx, userID)
+	if err != nil {
+		b.logger.Error("Failed to get user settings", "error", err, "user_id", userID)
+		return b.telegramSvc.SendMessage(ctx, chatID, dependencyMessage(b.dependencyService, "❌ Не удалось получить настройки. Попробуйте позже.", nil, services.DependencyDatabase))
+	}
+
+	_, servers, err := contextServers(ctx)
+	if err != nil {
+	}
+
+	text, keyboard := settingsMenu(settings, servers)
+	return b.telegramSvc.SendMessageWithKeyboard(ctx, chatID, text, keyboard)
+}
+
+// handleSettingsCallback handles the buttons of the settings menu. Callback data is
+// stg:<section> to open a section or toggle a switch, and stg:<section>:<value> to
+// choose a value.
+func (h *DefaultUpdateHandler) handleSettingsCallback(ctx context.Context, callback *telegram.CallbackQuery, data callbacks.Data) error {
+	params := data.Params
+	if len(params) == 0 {
+		h.logger.Error("Invalid callback data format", "params", params)
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неверный формат данных")
+	}
+	section, value, chosen := params[0], "", len(params) == 2
+	if chosen {
+		value = params[1]
+	}
+
+	user, err := contextUser(ctx)
+	if err != nil {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Внутренняя ошибка")
+	}
+	userID := mapping.UserID(user)
+
+	settings, err := h.settingsService.Get(ctx, userID)
+	if err != nil {
+		h.logger.Error("Failed to get user settings", "error", err, "user_id", userID)
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Не удалось получить настройки")
+	}
+
+	_, servers, err := contextServers(ctx)
+	if err != nil {
+	}
+
+	// Sections with a list of values show it until a value is chosen
+	if !chosen {
+		var text string
+		var keyboard interface{}
+		switch section {
+		case "lang":
+			text, keyboard = languageMenu(settings)
+		case "tz":
+			text, keyboard = timezoneMenu(settings)
+		case "quiet":
+			text, keyboard = quietHoursMenu(settings)
+		case "srv":
+			text, keyboard = defaultServerMessage(servers, settings.DefaultServerID)
+		}
+		if keyboard != nil {
+			if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, ""); err != nil {
+				h.logger.Error("Failed to answer callback", "error", err)
+			}
+			return h.telegramSvc.EditMessage(ctx, callback.Message.Chat.ID, callback.Message.MessageID, text, keyboard)
+		}
+	}
+
+	answer := "✅ Сохранено"
+	switch section {
+	case "main":
+		answer = ""
+	case "lang":
+		if value == "default" {
+			value = ""
+		}
+		err = h.settingsService.SetLanguage(ctx, userID, value)
+	case "tz":
+		if err = h.reportService.SetTimezone(ctx, userID, value); err != nil {
+			h.logger.Warn("Failed to set timezone", "error", err, "user_id", userID, "timezone", value)
+		}
+	case "quiet":
+		var from, to int
+		if value == "off" {
+			err = h.settingsService.ClearQuietHours(ctx, userID)
+		} else if _, scanErr := fmt.Sscanf(value, "%d-%d", &from, &to); scanErr != nil {
+			err = scanErr
+		} else {
+			err = h.settingsService.SetQuietHours(ctx, userID, from, to)
+		}
+	case "compact":
+		err = h.settingsService.SetCompactMetrics(ctx, userID, !settings.CompactMetrics)
+	case "alerts":
+		err = h.settingsService.SetNotifyAlerts(ctx, userID, !settings.NotifyAlerts)
+	case "reports":
+		err = h.settingsService.SetNotifyReports(ctx, userID, !settings.NotifyReports)
+	default:
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неизвестная настройка")
+	}
+	if err != nil {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Не удалось сохранить настройку")
+	}
+
+	if settings, err = h.settingsService.Get(ctx, userID); err != nil {
+		h.logger.Error("Failed to get user settings", "error", err, "user_id", userID)
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Не удалось получить настройки")
+	}
+	if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, answer); err != nil {
+		h.logger.Error("Failed to answer callback", "error", err)
+	}
+	text, keyboard := settingsMenu(settings, servers)
+	return h.telegramSvc.EditMessage(ctx, callback.Message.Chat.ID, callback.Message.MessageID, text, keyboard)
+}
+
+// settingsMenu describes the settings of a user with buttons to change them
+func settingsMenu(settings *models.UserSettings, servers []models.ServerWithDetails) (string, interface{}) {
+	var sb strings.Builder
+	sb.WriteString("⚙️ Настройки\n\n")
+	sb.WriteString(fmt.Sprintf("🌐 Язык: %s\n", languageLabel(settings.Language)))
+	sb.WriteString(fmt.Sprintf("🕒 Часовой пояс: %s\n", settings.Timezone))
+	sb.WriteString(fmt.Sprintf("⭐ Сервер по умолчанию: %s\n", defaultServerLabel(servers, settings.DefaultServerID)))
+	sb.WriteString(fmt.Sprintf("📊 Вывод метрик: %s\n", choose(settings.CompactMetrics, "одной строкой", "подробный")))
+	sb.WriteString(fmt.Sprintf("🌙 Тихие часы: %s\n", quietHoursLabel(settings)))
+	sb.WriteString(fmt.Sprintf("📣 Алерты в каналы уведомлений: %s\n", choose(settings.NotifyAlerts, "да", "нет")))
+	sb.WriteString(fmt.Sprintf("📋 Отчеты в каналы уведомлений: %s\n", choose(settings.NotifyReports, "да", "нет")))
+	sb.WriteString("\nРазовый выбор для команды: /cpu -c одной строкой, /cpu -v подробно.\nВ тихие часы алерты приходят без звука. Каналы уведомлений подключаются командой /notify.")
+
+	keyboard := [][]map[string]string{
+		{settingsCallback.Button("🌐 Язык", "lang"), settingsCallback.Button("🕒 Часовой пояс", "tz")},
+		{settingsCallback.Button("⭐ Сервер по умолчанию", "srv")},
+		{settingsCallback.Button(choose(settings.CompactMetrics, "📊 Подробный вывод метрик", "📊 Метрики одной строкой"), "compact")},
+		{settingsCallback.Button("🌙 Тихие часы", "quiet")},
+		{settingsCallback.Button(choose(settings.NotifyAlerts, "📣 Не слать алерты в каналы", "📣 Слать алерты в каналы"), "alerts")},
+		{settingsCallback.Button(choose(settings.NotifyReports, "📋 Не слать отчеты в каналы", "📋 Слать отчеты в каналы"), "reports")},
+	}
+	return sb.String(), keyboard
+}
+
+// languageMenu offers the supported languages
+func languageMenu(settings *models.UserSettings) (string, interface{}) {
+	keyboard := [][]map[string]string{
+		{settingsCallback.Button(markChosen(settings.Language == "", "По умолчанию"), "lang", "default")},
+	}
+	for _, locale := range []string{branding.LocaleRussian, branding.LocaleEnglish} {
+		keyboard = append(keyboard, []map[string]string{
+			settingsCallback.Button(markChosen(settings.Language == locale, languageNames[locale]), "lang", locale),
+		})
+	}
+	keyboard = append(keyboard, settingsBackRow())
+	return "🌐 Язык приветствия и справки (/start, /help)", keyboard
+}
+
+// timezoneMenu offers common timezones
+func timezoneMenu(settings *models.UserSettings) (string, interface{}) {
+	var keyboard [][]map[string]string
+	for i := 0; i < len(settingsTimezones); i += 2 {
+		var row []map[string]string
+		for _, zone := range settingsTimezones[i:min(i+2, len(settingsTimezones))] {
+			row = append(row, settingsCallback.Button(markChosen(settings.Timezone == zone, zone), "tz", zone))
+		}
+		keyboard = append(keyboard, row)
+	}
+	keyboard = append(keyboard, settingsBackRow())
+	return fmt.Sprintf("🕒 Часовой пояс отчетов и тихих часов: %s\n\nДругой пояс: /report tz <зона>, например /report tz Asia/Almaty", settings.Timezone), keyboard
+}
+
+// quietHoursMenu offers quiet hours presets
+func quietHoursMenu(settings *models.UserSettings) (string, interface{}) {
+	var keyboard [][]map[string]string
+	for _, hours := range settingsQuietHours {
+		chosen := settings.QuietFrom != nil && settings.QuietTo != nil && *settings.QuietFrom == hours[0] && *settings.QuietTo == hours[1]
+		keyboard = append(keyboard, []map[string]string{
+			settingsCallback.Button(markChosen(chosen, fmt.Sprintf("%02d:00–%02d:00", hours[0], hours[1])), "quiet", fmt.Sprintf("%d-%d", hours[0], hours[1])),
+		})
+	}
+	keyboard = append(keyboard,
+		[]map[string]string{settingsCallback.Button(markChosen(settings.QuietFrom == nil, "🔔 Выключить"), "quiet", "off")},
+		settingsBackRow(),
+	)
+	return fmt.Sprintf("🌙 Тихие часы: %s\n\nВ это время алерты в личном чате приходят без звука. Время указано в вашем часовом поясе (%s).", quietHoursLabel(settings), settings.Timezone), keyboard
+}
+
+// settingsBackRow returns the button row leading back to the settings menu
+func settingsBackRow() []map[string]string {
+	return []map[string]string{settingsCallback.Button("⬅️ Все настройки", "main")}
+}
+
+// languageLabel names the language of a user
+func languageLabel(language string) string {
+	if name, ok := languageNames[language]; ok {
+		return name
+	}
+	return "по умолчанию"
+}
+
+// defaultServerLabel names the default server of a user
+func defaultServerLabel(servers []models.ServerWithDetails, defaultServerID string) string {
+	if defaultServerID == "" {
+		return "не выбран"
+	}
+	if server := mapping.ServerByID(servers, defaultServerID); server != nil {
+		return fmt.Sprintf("⭐ %s(%s)", server.Name, server.ID)
+	}
+	return defaultServerID
+}
+
+// quietHoursLabel describes the quiet hours of a user
+func quietHoursLabel(settings *models.UserSettings) string {
+	if settings.QuietFrom == nil || settings.QuietTo == nil {
+		return "выключены"
+	}
+	return fmt.Sprintf("%02d:00–%02d:00", *settings.QuietFrom, *settings.QuietTo)
+}
+
+// markChosen marks the button of the current value
+func markChosen(chosen bool, text string) string {
+	if chosen {
+		return "✅ " + text
+	}
+	return text
+}
+
+// choose returns yes when cond holds and no otherwise
+func choose(cond bool, yes, no string) string {
+	if cond {
+		return yes
+	}
+	return no
+}
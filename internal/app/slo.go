@@ -0,0 +1,96 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/internal/slo"
+	"github.com/servereye/servereyebot/pkg/domain"
+)
+
+// handleDashboardCommand shows error budgets of the bot command classes and the health
+// of the bot's dependencies
+func (b *Bot) handleDashboardCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("📈 SLO бота (окно %s):\n\n", formatWindow(b.sloTracker.Window())))
+
+	for _, status := range b.sloTracker.Statuses() {
+		icon := "✅"
+		if status.Exhausted() {
+			icon = "🔥"
+		} else if status.BurnRate > 1 {
+			icon = "⚠️"
+		}
+
+		sb.WriteString(fmt.Sprintf("%s %s\n", icon, status.Class))
+		sb.WriteString(fmt.Sprintf("- Успешность: %.2f%% (цель %.2f%%)\n", status.SuccessRate*100, status.Target*100))
+		sb.WriteString(fmt.Sprintf("- Команд: %d, ошибок: %d\n", status.Total, status.Failed))
+		sb.WriteString(fmt.Sprintf("- Бюджет ошибок: %.1f%%\n", status.BudgetRemaining*100))
+		sb.WriteString(fmt.Sprintf("- Burn rate: %.2f\n\n", status.BurnRate))
+	}
+
+	if statuses := b.dependencyService.Statuses(); len(statuses) > 0 {
+		sb.WriteString(services.FormatDependencies(statuses, b.dependencyService.Events(), time.Now()))
+	}
+
+	return b.telegramSvc.SendMessage(ctx, chatID, strings.TrimRight(sb.String(), "\n"))
+}
+
+// runSLOCheck is a scheduler job alerting admins about exhausted error budgets
+func (b *Bot) runSLOCheck(ctx context.Context, now time.Time) error {
+	// The flag may be switched by a reload after the start
+	if !b.currentConfig().SLO.AlertsEnabled {
+		return nil
+	}
+
+	var exhausted []slo.Status
+	for _, status := range b.sloTracker.Statuses() {
+		if !status.Exhausted() {
+			delete(b.sloAlerted, status.Class)
+			continue
+		}
+		if b.sloAlerted[status.Class] {
+			continue
+		}
+		exhausted = append(exhausted, status)
+	}
+
+	if len(exhausted) == 0 {
+		return nil
+	}
+
+	admins, err := b.repo.ListAdminTelegramIDs(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, status := range exhausted {
+		message := fmt.Sprintf("🔥 Бюджет ошибок исчерпан: %s\n\nУспешность: %.2f%% (цель %.2f%%)\nОшибок: %d из %d за %s\nBurn rate: %.2f",
+			status.Class, status.SuccessRate*100, status.Target*100, status.Failed, status.Total,
+			formatWindow(b.sloTracker.Window()), status.BurnRate)
+
+		for _, adminID := range admins {
+			if err := b.telegramSvc.SendMessage(ctx, adminID, message); err != nil {
+				b.logger.Error("Failed to send SLO alert", "error", err, "telegram_id", adminID)
+			}
+		}
+
+		b.logger.Warn("Error budget exhausted", "class", status.Class, "burn_rate", status.BurnRate)
+		b.sloAlerted[status.Class] = true
+	}
+
+	return nil
+}
+
+// formatWindow formats an SLO window in days or hours
+func formatWindow(window time.Duration) string {
+	if window%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%d дн.", int(window/(24*time.Hour)))
+	}
+	return fmt.Sprintf("%d ч.", int(window/time.Hour))
+}
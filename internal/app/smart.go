@@ -0,0 +1,56 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/pkg/domain"
+)
+
+// smartUsage is shown when /smart arguments cannot be parsed
+const smartUsage = `💽 *Здоровье дисков*
+
+/smart [server_id] - SMART: самодиагностика, поврежденные секторы и температура дисков
+
+Если количество поврежденных секторов растет или диск не проходит самодиагностику, придет предупреждение.`
+
+// handleSMARTCommand shows the SMART health of the drives of a server
+func (b *Bot) handleSMARTCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+	if len(servers) == 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, "📭 У вас нет добавленных серверов.\n\nИспользуйте /add <server_id> для добавления сервера.")
+	}
+
+	server, args := resolveServerArg(servers, args)
+	if server == nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите сервер.\n\n"+smartUsage)
+	}
+	if len(args) > 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, smartUsage)
+	}
+
+	smart, err := b.smartService.Get(ctx, mapping.UserID(user), telegramID, server)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, agentErrorMessage(err, server, "❌ Не удалось получить SMART дисков. Убедитесь, что на сервере установлен smartmontools."))
+	}
+
+	return b.telegramSvc.SendMessage(ctx, chatID, b.smartService.FormatSMART(server, smart, time.Now()))
+}
+
+// runSMARTCheck is a scheduler job warning about drives likely to fail
+func (b *Bot) runSMARTCheck(ctx context.Context, now time.Time) error {
+	notifications, err := b.smartService.Check(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	b.deliverAlerts(ctx, notifications)
+	return nil
+}
@@ -0,0 +1,56 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/pkg/domain"
+)
+
+// handlePortsCommand shows the listening sockets of a server with their processes
+func (b *Bot) handlePortsCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	return b.withSocketServer(ctx, args, "/ports [server_id] - Слушающие порты сервера и их процессы", func(chatID, userID, telegramID int64, server *models.ServerWithDetails) error {
+		ports, err := b.socketService.Ports(ctx, userID, telegramID, server)
+		if err != nil {
+			return b.telegramSvc.SendMessage(ctx, chatID, agentErrorMessage(err, server, "❌ Не удалось получить открытые порты. Попробуйте позже."))
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, b.socketService.FormatPorts(server, ports, time.Now()))
+	})
+}
+
+// handleConnectionsCommand shows the established connections of a server per remote address
+func (b *Bot) handleConnectionsCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	return b.withSocketServer(ctx, args, "/connections [server_id] - Установленные соединения сервера по удаленным адресам", func(chatID, userID, telegramID int64, server *models.ServerWithDetails) error {
+		connections, err := b.socketService.Connections(ctx, userID, telegramID, server)
+		if err != nil {
+			return b.telegramSvc.SendMessage(ctx, chatID, agentErrorMessage(err, server, "❌ Не удалось получить соединения. Попробуйте позже."))
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, b.socketService.FormatConnections(server, connections, time.Now()))
+	})
+}
+
+// withSocketServer resolves the server of /ports and /connections and runs show for it
+func (b *Bot) withSocketServer(ctx context.Context, args []string, usage string, show func(chatID, userID, telegramID int64, server *models.ServerWithDetails) error) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+	if len(servers) == 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, "📭 У вас нет добавленных серверов.\n\nИспользуйте /add <server_id> для добавления сервера.")
+	}
+
+	server, args := resolveServerArg(servers, args)
+	if server == nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите сервер.\n\n"+usage)
+	}
+	if len(args) > 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, usage)
+	}
+
+	return show(chatID, mapping.UserID(user), telegramID, server)
+}
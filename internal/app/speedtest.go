@@ -0,0 +1,76 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/pkg/domain"
+)
+
+// speedtestUsage is shown when /speedtest arguments cannot be parsed
+const speedtestUsage = "/speedtest [server_id] - Задержка и скорость загрузки и отдачи сервера"
+
+// handleSpeedtestCommand runs a bandwidth test on a server and reports its result
+func (b *Bot) handleSpeedtestCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+	if len(servers) == 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, "📭 У вас нет добавленных серверов.\n\nИспользуйте /add <server_id> для добавления сервера.")
+	}
+
+	server, args := resolveServerArg(servers, args)
+	if server == nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите сервер.\n\n"+speedtestUsage)
+	}
+	if len(args) > 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, speedtestUsage)
+	}
+	if !services.Can(server, services.PermSpeedtest) {
+		return b.telegramSvc.SendMessage(ctx, chatID, "⛔ Запускать тест скорости может только администратор сервера.")
+	}
+
+	if wait := b.speedtestService.Remaining(server.ID, time.Now()); wait > 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, speedtestCooldownMessage(server.Name, wait))
+	}
+
+	// Tests outlive the update processing timeout, so report the result separately
+	testCtx, operationID := trackOperation(ctx, telegramID, fmt.Sprintf("тест скорости %s", server.Name))
+	if err := b.telegramSvc.SendMessageWithKeyboard(ctx, chatID,
+		fmt.Sprintf("⏳ Измеряю скорость сети %s, это займет до %d мин…", server.Name, int(math.Ceil(b.speedtestService.Timeout().Minutes()))),
+		createCancelKeyboard(operationID)); err != nil {
+		return err
+	}
+
+	go func() {
+		result, wait, err := b.speedtestService.Run(testCtx, mapping.UserID(user), telegramID, server)
+		var text string
+		switch {
+		case err != nil && isCancelled(err):
+			return
+		case err != nil:
+			text = agentErrorMessage(err, server, "❌ Не удалось измерить скорость. Проверьте, что на сервере установлен speedtest-cli или доступен тестовый адрес.")
+		case wait > 0:
+			text = speedtestCooldownMessage(server.Name, wait)
+		default:
+			text = services.FormatSpeedtest(server, result, time.Now())
+		}
+		if err := b.telegramSvc.SendMessage(testCtx, chatID, text); err != nil {
+			b.logger.Error("Failed to send speedtest result", "error", err, "server_id", server.ID)
+		}
+	}()
+	return nil
+}
+
+// speedtestCooldownMessage tells when the bandwidth of a server can be tested again
+func speedtestCooldownMessage(serverName string, wait time.Duration) string {
+	return fmt.Sprintf("⏳ Скорость сети %s уже измерялась недавно. Повторить можно через %d мин.", serverName, int(math.Ceil(wait.Minutes())))
+}
@@ -0,0 +1,58 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// sshKeyUsage is shown when /sshkey arguments cannot be parsed
+const sshKeyUsage = `🔑 /sshkey push <server_id> <публичный ключ>
+
+Добавляет ключ в authorized_keys, заданный в настройках агента. Пример:
+/sshkey push srv_12313 ssh-ed25519 AAAAC3Nza... alice@laptop
+
+Отправлять ключи может только владелец сервера, каждое действие записывается в /audit.`
+
+// handleSSHKeyCommand pushes an SSH public key to a server for emergency access
+func (b *Bot) handleSSHKeyCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	if len(args) < 4 || strings.ToLower(args[0]) != "push" {
+		return b.telegramSvc.SendMessage(ctx, chatID, sshKeyUsage)
+	}
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+
+	// The server is always named explicitly so a key never lands on the wrong host
+	server := mapping.ServerByIDOrName(servers, args[1])
+	if server == nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Сервер `%s` не найден в вашем списке.", args[1]))
+	}
+
+	key, err := b.sshKeyService.Parse(strings.Join(args[2:], " "))
+	if err != nil {
+		b.logger.Warn("Rejected SSH public key", "error", err, "telegram_id", telegramID)
+		return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Ключ не принят. Нужна одна строка публичного ключа без опций authorized_keys: %s, ключи ssh-rsa не короче %d бит.",
+			strings.Join(b.config.SSHKeys.AllowedTypes, ", "), b.config.SSHKeys.MinRSABits))
+	}
+
+	pushed, err := b.sshKeyService.Push(ctx, mapping.UserID(user), telegramID, server, key)
+	if err != nil {
+		if errors.IsErrorCode(err, errors.ErrCodeForbidden) {
+			return b.telegramSvc.SendMessage(ctx, chatID, "⛔ Добавлять SSH-ключи может только владелец сервера.")
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, agentErrorMessage(err, server, "❌ Не удалось добавить ключ. Попробуйте позже."))
+	}
+
+	return b.telegramSvc.SendMessage(ctx, chatID, services.FormatSSHKeyPushed(server, key, pushed))
+}
@@ -0,0 +1,159 @@
+package app
+
+import (
+	"context"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/config"
+	"github.com/servereye/servereyebot/internal/logger"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/internal/telegram"
+	"github.com/servereye/servereyebot/pkg/domain"
+)
+
+// connectWithRetry runs connect until it succeeds or the attempts of policy are used up,
+// so that a dependency restarting together with the bot does not fail its start. Delays
+// double up to the policy's maximum, with jitter spreading the reconnects of replicas
+// started at the same time.
+func connectWithRetry(policy config.RetryPolicy, log logger.Logger, name string, connect func() error) error {
+	delay := policy.Delay
+	for attempt := 1; ; attempt++ {
+		err := connect()
+		if err == nil {
+			if attempt > 1 {
+				log.Info("Connected to dependency", "dependency", name, "attempts", attempt)
+			}
+			return nil
+		}
+		if attempt >= policy.Attempts {
+			return err
+		}
+
+		wait := delay/2 + rand.N(delay/2+1)
+		log.Warn("Dependency unavailable at startup, retrying",
+			"dependency", name,
+			"attempt", attempt,
+			"retry_in", wait.String(),
+			"error", err)
+		time.Sleep(wait)
+
+		delay *= 2
+		if delay > policy.MaxDelay {
+			delay = policy.MaxDelay
+		}
+	}
+}
+
+// degradedCommands are answered while the database is unavailable
+var degradedCommands = map[string]bool{"help": true, "start": true}
+
+// degradedHandler lets the bot run while the database is unavailable after a degraded
+// start. It answers /help and /start and queues other updates, handled in order once the
+// database recovers.
+type degradedHandler struct {
+	next         UpdateHandler
+	dependencies *services.DependencyService
+	telegramSvc  domain.TelegramService
+	logger       logger.Logger
+	limit        int
+
+	mu       sync.Mutex
+	queue    []*telegram.Update
+	notified map[int64]bool // chats told that their updates are queued
+}
+
+// newDegradedHandler creates a handler queueing up to limit updates for next
+func newDegradedHandler(next UpdateHandler, dependencies *services.DependencyService, telegramSvc domain.TelegramService, log logger.Logger, limit int) *degradedHandler {
+	return &degradedHandler{
+		next:         next,
+		dependencies: dependencies,
+		telegramSvc:  telegramSvc,
+		logger:       log,
+		limit:        limit,
+		notified:     make(map[int64]bool),
+	}
+}
+
+// HandleUpdate handles an update, queueing it while the database is unavailable
+func (h *degradedHandler) HandleUpdate(ctx context.Context, update *telegram.Update) error {
+	if h.databaseUp() {
+		h.Replay(ctx)
+		return h.next.HandleUpdate(ctx, update)
+	}
+
+	if update.Message != nil && degradedCommands[commandOf(update.Message.Text)] {
+		return h.next.HandleUpdate(ctx, update)
+	}
+
+	chatID, ok := updateChatID(update)
+	h.mu.Lock()
+	h.queue = append(h.queue, update)
+	if len(h.queue) > h.limit {
+		h.logger.Warn("Degraded mode queue is full, dropping the oldest update", "update_id", h.queue[0].UpdateID)
+		h.queue = h.queue[1:]
+	}
+	notify := ok && !h.notified[chatID]
+	if notify {
+		h.notified[chatID] = true
+	}
+	h.mu.Unlock()
+
+	if notify {
+		return h.telegramSvc.SendMessage(ctx, chatID, "⏳ База данных временно недоступна. Ваши команды поставлены в очередь и будут выполнены после восстановления.")
+	}
+	return nil
+}
+
+// Replay handles the queued updates once the database is available again
+func (h *degradedHandler) Replay(ctx context.Context) {
+	if !h.databaseUp() {
+		return
+	}
+
+	h.mu.Lock()
+	queue := h.queue
+	h.queue = nil
+	h.notified = make(map[int64]bool)
+	h.mu.Unlock()
+
+	if len(queue) == 0 {
+		return
+	}
+	h.logger.Info("Database recovered, handling queued updates", "updates", len(queue))
+	for _, update := range queue {
+		if err := h.next.HandleUpdate(ctx, update); err != nil {
+			h.logger.Error("Failed to handle queued update", "error", err, "update_id", update.UpdateID)
+		}
+	}
+}
+
+// databaseUp reports whether the last database check succeeded
+func (h *degradedHandler) databaseUp() bool {
+	status, ok := h.dependencies.Status(services.DependencyDatabase)
+	return !ok || status.Up
+}
+
+// commandOf returns the command of a message without its slash and bot username, or an
+// empty string when the message is not a command
+func commandOf(text string) string {
+	if !strings.HasPrefix(text, "/") {
+		return ""
+	}
+	fields := strings.Fields(text)
+	name, _, _ := strings.Cut(strings.TrimPrefix(fields[0], "/"), "@")
+	return strings.ToLower(name)
+}
+
+// updateChatID returns the chat an update came from
+func updateChatID(update *telegram.Update) (int64, bool) {
+	switch {
+	case update.Message != nil:
+		return update.Message.Chat.ID, true
+	case update.CallbackQuery != nil:
+		return update.CallbackQuery.Message.Chat.ID, true
+	}
+	return 0, false
+}
@@ -0,0 +1,171 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/servereye/servereyebot/internal/callbacks"
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/internal/telegram"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/metrics"
+)
+
+// handleUpdatesCommand shows pending OS package updates of a server
+func (b *Bot) handleUpdatesCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+
+	if len(servers) == 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ У вас нет добавленных серверов. Используйте /add <server_id> для добавления сервера.")
+	}
+
+	server, _ := resolveServerArg(servers, args)
+	if server == nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите сервер: /updates <server_id>")
+	}
+
+	text, keyboard := fetchUpdatesMessage(ctx, b.updatesService, mapping.UserID(user), telegramID, server)
+	if keyboard == nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, text)
+	}
+	return b.telegramSvc.SendMessageWithKeyboard(ctx, chatID, text, keyboard)
+}
+
+// handleUpdatesCallback handles refreshing updates and installing security updates
+func (h *DefaultUpdateHandler) handleUpdatesCallback(ctx context.Context, callback *telegram.CallbackQuery, data callbacks.Data) error {
+	// Parse callback data: upd:action:server_id
+	params := data.Params
+	if len(params) != 2 {
+		h.logger.Error("Invalid callback data format", "params", params)
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неверный формат данных")
+	}
+
+	action, serverID := params[0], params[1]
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Внутренняя ошибка")
+	}
+
+	server := mapping.ServerByID(servers, serverID)
+	if server == nil {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Сервер не найден")
+	}
+
+	chatID := callback.Message.Chat.ID
+	messageID := callback.Message.MessageID
+
+	switch action {
+	case "list":
+		if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "Проверяю обновления"); err != nil {
+			h.logger.Error("Failed to answer callback", "error", err)
+		}
+		text, keyboard := fetchUpdatesMessage(ctx, h.updatesService, mapping.UserID(user), callback.From.ID, server)
+		return h.telegramSvc.EditMessage(ctx, chatID, messageID, text, keyboard)
+
+	case "apply":
+		if !services.Can(server, services.PermUpdates) {
+			return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "⛔ Устанавливать обновления может только владелец")
+		}
+		if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, ""); err != nil {
+			h.logger.Error("Failed to answer callback", "error", err)
+		}
+		return h.telegramSvc.EditMessage(ctx, chatID, messageID,
+			fmt.Sprintf("🛡 Установить обновления безопасности на %s(%s)?\n\nСлужбы обновляемых пакетов могут быть перезапущены.", server.Name, server.ID),
+			createApplyUpdatesConfirmKeyboard(server.ID))
+
+	case "applyok":
+		if !services.Can(server, services.PermUpdates) {
+			return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "⛔ Устанавливать обновления может только владелец")
+		}
+		if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "Устанавливаю обновления"); err != nil {
+			h.logger.Error("Failed to answer callback", "error", err)
+		}
+
+		// Installing updates outlives the update processing timeout, so finish in the background
+		applyCtx, operationID := trackOperation(ctx, callback.From.ID, fmt.Sprintf("установка обновлений безопасности на %s", server.Name))
+		if err := h.telegramSvc.EditMessage(ctx, chatID, messageID, fmt.Sprintf("⏳ Устанавливаю обновления безопасности на %s…", server.Name), createCancelKeyboard(operationID)); err != nil {
+			h.logger.Error("Failed to report update progress", "error", err)
+		}
+
+		go func() {
+			var text string
+			applied, err := h.updatesService.ApplySecurity(applyCtx, mapping.UserID(user), callback.From.ID, server)
+			switch {
+			case err != nil && isCancelled(err):
+				return
+			case err != nil && agentReported(err, metrics.ErrNoPackageManager.Error()):
+				text = fmt.Sprintf("❌ На %s не найден apt, dnf или yum.", server.Name)
+			case err != nil:
+				text = agentErrorMessage(err, server, fmt.Sprintf("❌ Не удалось установить обновления на %s. Проверьте, что агент запущен от root.", server.Name))
+			default:
+				text = services.FormatSecurityApplied(server, applied)
+			}
+			if err := h.telegramSvc.EditMessage(applyCtx, chatID, messageID, text, createUpdatesBackKeyboard(server.ID)); err != nil {
+				h.logger.Error("Failed to send update result", "error", err, "server_id", server.ID)
+			}
+		}()
+		return nil
+
+	default:
+		h.logger.Warn("Unknown updates action", "action", action)
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неизвестное действие")
+	}
+}
+
+// fetchUpdatesMessage retrieves pending updates and builds the message with its keyboard.
+// The keyboard is nil when updates could not be retrieved.
+func fetchUpdatesMessage(ctx context.Context, updatesService *services.UpdatesService, userID, telegramID int64, server *models.ServerWithDetails) (string, interface{}) {
+	updates, err := updatesService.Get(ctx, userID, telegramID, server)
+	if err != nil {
+		if agentReported(err, metrics.ErrNoPackageManager.Error()) {
+			return fmt.Sprintf("❌ На %s не найден apt, dnf или yum.", server.Name), nil
+		}
+		return agentErrorMessage(err, server, "❌ Не удалось получить список обновлений. Попробуйте позже."), nil
+	}
+
+	canApply := services.Can(server, services.PermUpdates) && services.SecurityUpdates(updates) > 0
+	return services.FormatUpdates(server, updates), createUpdatesKeyboard(server.ID, canApply)
+}
+
+// createUpdatesKeyboard creates inline keyboard refreshing updates and, for owners,
+// installing security updates
+func createUpdatesKeyboard(serverID string, canApply bool) interface{} {
+	row := []map[string]string{
+		updatesCallback.Button("🔄 Обновить", "list", serverID),
+	}
+	if canApply {
+		row = append([]map[string]string{
+			updatesCallback.Button("🛡 Установить обновления безопасности", "apply", serverID),
+		}, row...)
+	}
+
+	return [][]map[string]string{row}
+}
+
+// createApplyUpdatesConfirmKeyboard creates inline keyboard confirming security updates
+func createApplyUpdatesConfirmKeyboard(serverID string) interface{} {
+	return [][]map[string]string{
+		{
+			updatesCallback.Button("✅ Установить", "applyok", serverID),
+			updatesCallback.Button("❌ Отмена", "list", serverID),
+		},
+	}
+}
+
+// createUpdatesBackKeyboard creates inline keyboard returning to the update list
+func createUpdatesBackKeyboard(serverID string) interface{} {
+	return [][]map[string]string{
+		{
+			updatesCallback.Button("📦 К списку обновлений", "list", serverID),
+		},
+	}
+}
@@ -0,0 +1,137 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/internal/uptime"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// checkUsage is shown when /check arguments cannot be parsed
+const checkUsage = `🌐 *Проверки доступности*
+
+/check - Ваши проверки и их состояние
+/check add <url|host:port> [интервал] [server_id] - Проверять сайт или порт, например /check add https://example.com 60s
+/check history <id> - Доступность за сутки и последние проверки
+/check remove <id> - Удалить проверку
+
+Без server_id проверяет сам бот, это подходит для публичных адресов. С server_id проверку выполняет агент сервера (для владельцев), так можно проверять адреса внутренней сети. Когда адрес становится недоступен или восстанавливается, придет алерт категории uptime.`
+
+// handleCheckCommand manages uptime checks of HTTP and TCP endpoints
+func (b *Bot) handleCheckCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+
+	if len(args) == 0 || strings.ToLower(args[0]) == "list" {
+		checks := b.uptimeService.List(telegramID, mapping.ServerIDs(servers)...)
+		return b.telegramSvc.SendMessage(ctx, chatID, services.FormatUptimeChecks(checks, time.Now()))
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "add":
+		return b.addUptimeCheck(ctx, chatID, telegramID, user, servers, args[1:])
+
+	case "history", "remove":
+		if len(args) != 2 {
+			return b.telegramSvc.SendMessage(ctx, chatID, checkUsage)
+		}
+		id, err := strconv.ParseInt(strings.TrimPrefix(args[1], "#"), 10, 64)
+		if err != nil {
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите номер проверки из списка /check.")
+		}
+
+		check, ok := b.uptimeService.Get(id)
+		visible := ok && (check.TelegramID == telegramID || user.IsAdmin || check.ServerID != "" && mapping.ServerByID(servers, check.ServerID) != nil)
+		if !visible {
+			return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Проверка #%d не найдена.", id))
+		}
+
+		if strings.ToLower(args[0]) == "history" {
+			now := time.Now()
+			results, err := b.uptimeService.History(ctx, id, now)
+			if err != nil {
+				b.logger.Error("Failed to get uptime history", "error", err, "id", id)
+				return b.telegramSvc.SendMessage(ctx, chatID, dependencyMessage(b.dependencyService, "❌ Не удалось получить историю проверки. Попробуйте позже.", nil, services.DependencyDatabase))
+			}
+			return b.telegramSvc.SendMessage(ctx, chatID, services.FormatUptimeHistory(*check, results, now))
+		}
+
+		if check.TelegramID != telegramID && !user.IsAdmin {
+			return b.telegramSvc.SendMessage(ctx, chatID, "⛔ Удалить проверку может только тот, кто ее добавил.")
+		}
+		if _, err := b.uptimeService.Remove(ctx, id); err != nil {
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось удалить проверку. Попробуйте позже.")
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("✅ Проверка #%d удалена вместе с историей.", id))
+	}
+
+	return b.telegramSvc.SendMessage(ctx, chatID, checkUsage)
+}
+
+// addUptimeCheck handles /check add <target> [interval] [server_id]
+func (b *Bot) addUptimeCheck(ctx context.Context, chatID, telegramID int64, user *domain.User, servers []models.ServerWithDetails, args []string) error {
+	if len(args) == 0 || len(args) > 3 {
+		return b.telegramSvc.SendMessage(ctx, chatID, checkUsage)
+	}
+
+	target, err := uptime.ParseTarget(args[0])
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите адрес http://, https:// или host:port, например https://example.com или db.example.com:5432.")
+	}
+
+	interval := services.MinUptimeInterval
+	var server *models.ServerWithDetails
+	for _, arg := range args[1:] {
+		if d, err := time.ParseDuration(arg); err == nil {
+			interval = d
+			continue
+		}
+		if server = mapping.ServerByIDOrName(servers, arg); server == nil {
+			return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Сервер `%s` не найден в вашем списке.", arg))
+		}
+	}
+
+	check, err := b.uptimeService.Add(ctx, telegramID, server, target, interval)
+	if err != nil {
+		switch {
+		case isRoleError(err):
+			return b.telegramSvc.SendMessage(ctx, chatID, "⛔ Запускать проверки на агенте сервера может только его владелец.")
+		case errors.IsErrorCode(err, errors.ErrCodeForbidden):
+			return b.telegramSvc.SendMessage(ctx, chatID, "⛔ Адрес ведет во внутреннюю сеть, бот такие адреса не проверяет. Укажите сервер, чей агент будет проверять адрес: /check add "+args[0]+" <server_id>")
+		case errors.IsErrorCode(err, errors.ErrCodeValidation):
+			return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Не удалось добавить проверку: интервал от %s до %s, адрес должен существовать, не больше 20 проверок.", services.MinUptimeInterval, services.MaxUptimeInterval))
+		default:
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось сохранить проверку. Попробуйте позже.")
+		}
+	}
+
+	runner := "бот"
+	if server != nil {
+		runner = "агент " + server.Name
+	}
+	return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("✅ Проверка #%d добавлена: %s каждые %s, проверяет %s.\n\nПервый результат появится в течение минуты: /check history %d", check.ID, target.String(), interval, runner, check.ID))
+}
+
+// runUptimeChecks is a scheduler job probing uptime checks that are due
+func (b *Bot) runUptimeChecks(ctx context.Context, now time.Time) error {
+	notifications, err := b.uptimeService.Run(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	b.deliverAlerts(ctx, notifications)
+	return nil
+}
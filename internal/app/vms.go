@@ -0,0 +1,272 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/servereye/servereyebot/internal/callbacks"
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/internal/telegram"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// vmsUsage is shown when /vms arguments cannot be parsed
+const vmsUsage = `🖥️ *Виртуальные машины*
+
+/vms [server_id] - Виртуальные машины Proxmox или libvirt, их состояние и ресурсы
+/vms [server_id] start <vm> - Запустить виртуальную машину
+/vms [server_id] shutdown <vm> - Выключить виртуальную машину, после подтверждения
+
+Управлять виртуальными машинами может администратор сервера.`
+
+// vmNameTooLongMessage is shown for machines whose shutdown cannot fit in a button
+const vmNameTooLongMessage = "❌ Слишком длинное имя виртуальной машины для подтверждения."
+
+// handleVMsCommand lists the virtual machines of a server and starts or shuts them down
+func (b *Bot) handleVMsCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+
+	if len(servers) == 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ У вас нет добавленных серверов. Используйте /add <server_id> для добавления сервера.")
+	}
+
+	server, args := resolveServerArg(servers, args)
+	if server == nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите сервер.\n\n"+vmsUsage)
+	}
+
+	if len(args) == 0 {
+		text, keyboard := fetchVMsMessage(ctx, b.vmService, mapping.UserID(user), telegramID, server)
+		if keyboard == nil {
+			return b.telegramSvc.SendMessage(ctx, chatID, text)
+		}
+		return b.telegramSvc.SendMessageWithKeyboard(ctx, chatID, text, keyboard)
+	}
+
+	action, ok := parseVMAction(args[0])
+	if !ok || len(args) != 2 {
+		return b.telegramSvc.SendMessage(ctx, chatID, vmsUsage)
+	}
+	vm := args[1]
+	if !services.Can(server, services.PermVMs) {
+		return b.telegramSvc.SendMessage(ctx, chatID, "⛔ Управлять виртуальными машинами может только администратор сервера.")
+	}
+
+	if action == protocol.VMShutdown {
+		keyboard, err := createVMShutdownConfirmKeyboard(server.ID, vm)
+		if err != nil {
+			return b.telegramSvc.SendMessage(ctx, chatID, vmNameTooLongMessage)
+		}
+		return b.telegramSvc.SendMessageWithKeyboard(ctx, chatID,
+			fmt.Sprintf("⏹ Выключить виртуальную машину %s на %s(%s)?", vm, server.Name, server.ID), keyboard)
+	}
+
+	// VM operations may outlive the update processing timeout, so report the result separately
+	actionCtx, operationID := trackOperation(ctx, telegramID, vmOperationLabel(server, vm, action))
+	if err := b.telegramSvc.SendMessageWithKeyboard(ctx, chatID, vmProgressMessage(server, vm, action), createCancelKeyboard(operationID)); err != nil {
+		return err
+	}
+
+	go func() {
+		text := vmActionMessage(actionCtx, b.vmService, mapping.UserID(user), telegramID, server, vm, action)
+		if text == "" {
+			return
+		}
+		if err := b.telegramSvc.SendMessage(actionCtx, chatID, text); err != nil {
+			b.logger.Error("Failed to send VM action result", "error", err, "vm", vm)
+		}
+	}()
+	return nil
+}
+
+// handleVMsCallback handles virtual machine buttons
+func (h *DefaultUpdateHandler) handleVMsCallback(ctx context.Context, callback *telegram.CallbackQuery, data callbacks.Data) error {
+	// Parse callback data: vm:action:server_id[:vm]
+	params := data.Params
+	if len(params) < 2 {
+		h.logger.Error("Invalid callback data format", "params", params)
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неверный формат данных")
+	}
+
+	action, serverID := params[0], params[1]
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Внутренняя ошибка")
+	}
+
+	server := mapping.ServerByID(servers, serverID)
+	if server == nil {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Сервер не найден")
+	}
+
+	chatID := callback.Message.Chat.ID
+	messageID := callback.Message.MessageID
+
+	if action == "list" {
+		if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "Обновляю виртуальные машины"); err != nil {
+			h.logger.Error("Failed to answer callback", "error", err)
+		}
+		text, keyboard := fetchVMsMessage(ctx, h.vmService, mapping.UserID(user), callback.From.ID, server)
+		return h.telegramSvc.EditMessage(ctx, chatID, messageID, text, keyboard)
+	}
+
+	if len(params) != 3 || params[2] == "" {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неверный формат данных")
+	}
+	vm := params[2]
+	if !services.Can(server, services.PermVMs) {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "⛔ Только для администратора сервера")
+	}
+
+	if action == "confirm" {
+		keyboard, err := createVMShutdownConfirmKeyboard(server.ID, vm)
+		if err != nil {
+			return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, vmNameTooLongMessage)
+		}
+		if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, ""); err != nil {
+			h.logger.Error("Failed to answer callback", "error", err)
+		}
+		return h.telegramSvc.EditMessage(ctx, chatID, messageID,
+			fmt.Sprintf("⏹ Выключить виртуальную машину %s на %s(%s)?", vm, server.Name, server.ID), keyboard)
+	}
+
+	vmAction, ok := parseVMAction(action)
+	if !ok {
+		h.logger.Warn("Unknown VM action", "action", action)
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неизвестное действие")
+	}
+
+	if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, fmt.Sprintf("%s %s", vmAction, vm)); err != nil {
+		h.logger.Error("Failed to answer callback", "error", err)
+	}
+	// VM operations may outlive the update processing timeout, so finish in the background
+	actionCtx, operationID := trackOperation(ctx, callback.From.ID, vmOperationLabel(server, vm, vmAction))
+	if err := h.telegramSvc.EditMessage(ctx, chatID, messageID, vmProgressMessage(server, vm, vmAction), createCancelKeyboard(operationID)); err != nil {
+		h.logger.Error("Failed to report VM action progress", "error", err)
+	}
+
+	go func() {
+		text := vmActionMessage(actionCtx, h.vmService, mapping.UserID(user), callback.From.ID, server, vm, vmAction)
+		if text == "" {
+			return
+		}
+		if err := h.telegramSvc.EditMessage(actionCtx, chatID, messageID, text, createVMsBackKeyboard(server.ID)); err != nil {
+			h.logger.Error("Failed to send VM action result", "error", err, "vm", vm)
+		}
+	}()
+	return nil
+}
+
+// parseVMAction parses a virtual machine action name
+func parseVMAction(name string) (protocol.VMAction, bool) {
+	switch action := protocol.VMAction(strings.ToLower(name)); action {
+	case protocol.VMStart, protocol.VMShutdown:
+		return action, true
+	default:
+		return "", false
+	}
+}
+
+// fetchVMsMessage retrieves virtual machines and builds the message with its keyboard.
+// The keyboard is nil when virtual machines could not be retrieved.
+func fetchVMsMessage(ctx context.Context, vmService *services.VMService, userID, telegramID int64, server *models.ServerWithDetails) (string, interface{}) {
+	vms, err := vmService.List(ctx, userID, telegramID, server)
+	if err != nil {
+		return agentErrorMessage(err, server, "❌ Не удалось получить виртуальные машины. Попробуйте позже."), nil
+	}
+
+	return vmService.FormatVMs(server, vms), createVMsKeyboard(server.ID, vms.VMs, services.Can(server, services.PermVMs))
+}
+
+// vmActionMessage runs a virtual machine action and returns the result message, which is
+// empty when the user cancelled the action
+func vmActionMessage(ctx context.Context, vmService *services.VMService, userID, telegramID int64, server *models.ServerWithDetails, vm string, action protocol.VMAction) string {
+	result, err := vmService.RunAction(ctx, userID, telegramID, server, vm, action)
+	if err != nil {
+		if isCancelled(err) {
+			return ""
+		}
+		if errors.IsErrorCode(err, errors.ErrCodeForbidden) {
+			return "⛔ Управлять виртуальными машинами может только администратор сервера."
+		}
+		if agentReported(err, "not found") {
+			return fmt.Sprintf("❌ Виртуальная машина %s не найдена на сервере %s.", vm, server.Name)
+		}
+		return agentErrorMessage(err, server, fmt.Sprintf("❌ Не удалось выполнить %s для %s. Попробуйте позже.", action, vm))
+	}
+
+	return vmService.FormatVMAction(server, result)
+}
+
+// vmProgressMessage returns the message shown while a virtual machine action runs
+func vmProgressMessage(server *models.ServerWithDetails, vm string, action protocol.VMAction) string {
+	return fmt.Sprintf("⏳ %s %s на %s…", action, vm, server.Name)
+}
+
+// vmOperationLabel describes a virtual machine action in its cancellation message
+func vmOperationLabel(server *models.ServerWithDetails, vm string, action protocol.VMAction) string {
+	return fmt.Sprintf("%s %s на %s", action, vm, server.Name)
+}
+
+// createVMsKeyboard creates inline keyboard with start and shutdown buttons per virtual
+// machine for admins, and a refresh button
+func createVMsKeyboard(serverID string, vms []protocol.VM, canControl bool) interface{} {
+	var buttons [][]map[string]string
+
+	for _, vm := range vms {
+		if !canControl {
+			continue
+		}
+		if vm.State == "running" {
+			buttons = append(buttons, []map[string]string{
+				vmsCallback.Button(fmt.Sprintf("⏹ %s", vm.Name), "confirm", serverID, vm.ID),
+			})
+			continue
+		}
+		buttons = append(buttons, []map[string]string{
+			vmsCallback.Button(fmt.Sprintf("▶️ %s", vm.Name), "start", serverID, vm.ID),
+		})
+	}
+
+	buttons = append(buttons, []map[string]string{
+		vmsCallback.Button("🔄 Обновить", "list", serverID),
+	})
+
+	return buttons
+}
+
+// createVMShutdownConfirmKeyboard creates inline keyboard confirming a virtual machine
+// shutdown. callbacks.ErrTooLong is returned for IDs too long for the confirm button.
+func createVMShutdownConfirmKeyboard(serverID, vm string) (interface{}, error) {
+	shutdown, err := vmsCallback.Data("shutdown", serverID, vm)
+	if err != nil {
+		return nil, err
+	}
+	return [][]map[string]string{
+		{
+			{"text": "✅ Выключить", "callback_data": shutdown},
+			vmsCallback.Button("❌ Отмена", "list", serverID),
+		},
+	}, nil
+}
+
+// createVMsBackKeyboard creates inline keyboard returning to the virtual machine list
+func createVMsBackKeyboard(serverID string) interface{} {
+	return [][]map[string]string{
+		{
+			vmsCallback.Button("🖥️ К виртуальным машинам", "list", serverID),
+		},
+	}
+}
@@ -0,0 +1,158 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/callbacks"
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/internal/telegram"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// watchUsage is shown when /watch arguments cannot be parsed
+const watchUsage = `⚙️ *Отслеживание процессов*
+
+/watch [server_id] - Отслеживаемые процессы сервера
+/watch [server_id] add <process> [команда перезапуска] - Предупреждать, если процесс не запущен
+/watch [server_id] remove <process> - Перестать отслеживать процесс
+
+Агент сообщает запущенные процессы вместе с метриками. Команда перезапуска должна быть разрешена для /exec, тогда в алерте появится кнопка перезапуска. Отслеживать процессы может владелец сервера.`
+
+// watchOwnerMessage is shown to users who may not watch the processes of a server
+const watchOwnerMessage = "⛔ Отслеживать процессы сервера может только его владелец."
+
+// handleWatchCommand lists, adds and removes the processes watched on a server
+func (b *Bot) handleWatchCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	_, servers, err := contextServers(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+
+	if len(servers) == 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ У вас нет добавленных серверов. Используйте /add <server_id> для добавления сервера.")
+	}
+
+	server, args := resolveServerArg(servers, args)
+	if server == nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите сервер.\n\n"+watchUsage)
+	}
+
+	if len(args) == 0 {
+		watches, err := b.processWatches.List(ctx, server.ID)
+		if err != nil {
+			b.logger.Error("Failed to list process watches", "error", err, "server_id", server.ID)
+			return b.telegramSvc.SendMessage(ctx, chatID, dependencyMessage(b.dependencyService, "❌ Не удалось получить процессы. Попробуйте позже.", nil, services.DependencyDatabase))
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, b.processWatches.FormatWatches(server, watches))
+	}
+
+	if len(args) < 2 {
+		return b.telegramSvc.SendMessage(ctx, chatID, watchUsage)
+	}
+	name := args[1]
+	switch strings.ToLower(args[0]) {
+	case "add":
+		restartCommand := strings.Join(args[2:], " ")
+		if err := b.processWatches.Watch(ctx, telegramID, server, name, restartCommand); err != nil {
+			switch {
+			case errors.IsErrorCode(err, errors.ErrCodeValidation):
+				return b.telegramSvc.SendMessage(ctx, chatID, "❌ Имя процесса - латинские буквы, цифры, точка, дефис, _, @ и + (до 32 символов).")
+			case isRoleError(err):
+				return b.telegramSvc.SendMessage(ctx, chatID, watchOwnerMessage)
+			case errors.IsErrorCode(err, errors.ErrCodeForbidden):
+				return b.telegramSvc.SendMessage(ctx, chatID, "⛔ Команда перезапуска не разрешена.\n\n"+b.execUsage())
+			}
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось сохранить процесс. Попробуйте позже.")
+		}
+
+		message := fmt.Sprintf("✅ Процесс %s на %s(%s) отслеживается. Если агент перестанет его видеть, придет алерт.", name, server.Name, server.ID)
+		if restartCommand != "" {
+			message += "\n\nВ алерте будет кнопка перезапуска: " + restartCommand
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, message)
+
+	case "remove":
+		removed, err := b.processWatches.Unwatch(ctx, server, name)
+		if err != nil {
+			if errors.IsErrorCode(err, errors.ErrCodeForbidden) {
+				return b.telegramSvc.SendMessage(ctx, chatID, watchOwnerMessage)
+			}
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось удалить процесс. Попробуйте позже.")
+		}
+		if !removed {
+			return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Процесс %s не отслеживается.", name))
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("✅ Процесс %s больше не отслеживается.", name))
+
+	default:
+		return b.telegramSvc.SendMessage(ctx, chatID, watchUsage)
+	}
+}
+
+// runProcessWatchCheck is a scheduler job alerting about watched processes that stopped or started again
+func (b *Bot) runProcessWatchCheck(ctx context.Context, now time.Time) error {
+	notifications, err := b.processWatches.Check(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	b.deliverAlerts(ctx, notifications)
+	return nil
+}
+
+// handleProcessWatchCallback restarts a missing process from the button of its alert
+func (h *DefaultUpdateHandler) handleProcessWatchCallback(ctx context.Context, callback *telegram.CallbackQuery, data callbacks.Data) error {
+	// Parse callback data: pw:restart:server_id:process
+	params := data.Params
+	if len(params) != 3 || params[0] != "restart" {
+		h.logger.Error("Invalid callback data format", "params", params)
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Неверный формат данных")
+	}
+
+	serverID, name := params[1], params[2]
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Внутренняя ошибка")
+	}
+
+	server := mapping.ServerByID(servers, serverID)
+	if server == nil {
+		return h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "❌ Сервер не найден")
+	}
+
+	if err := h.telegramSvc.AnswerCallbackQuery(ctx, callback.ID, "Перезапускаю "+name); err != nil {
+		h.logger.Error("Failed to answer callback", "error", err)
+	}
+
+	chatID := callback.Message.Chat.ID
+	watch, result, err := h.processWatches.Restart(ctx, mapping.UserID(user), callback.From.ID, server, name)
+	if err != nil {
+		switch {
+		case errors.IsErrorCode(err, errors.ErrCodeNotFound):
+			return h.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Процесс %s больше не отслеживается.", name))
+		case errors.IsErrorCode(err, errors.ErrCodeValidation):
+			return h.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Для процесса %s не задана команда перезапуска.", name))
+		case isRoleError(err):
+			return h.telegramSvc.SendMessage(ctx, chatID, "⛔ Перезапускать процессы может только владелец сервера.")
+		case errors.IsErrorCode(err, errors.ErrCodeForbidden):
+			return h.telegramSvc.SendMessage(ctx, chatID, "⛔ Команда перезапуска больше не разрешена.")
+		}
+		return h.telegramSvc.SendMessage(ctx, chatID, agentErrorMessage(err, server, fmt.Sprintf("❌ Не удалось перезапустить %s. Попробуйте позже.", name)))
+	}
+
+	for _, chunk := range h.processWatches.FormatRestart(server, watch, result) {
+		if err := h.telegramSvc.SendMessage(ctx, chatID, chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/scheduler"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// windowUsage is shown when /window arguments cannot be parsed
+const windowUsage = `🛠️ *Окна работ*
+
+/window - Окна работ ваших серверов
+/window add [server_id] <день> <ЧЧ:ММ-ЧЧ:ММ> - Еженедельное окно, например /window add sat 02:00-04:00
+/window remove <id> - Удалить окно
+
+Во время окна алерты сервера не приходят сразу, а собираются в сводку, которая придет после окончания окна. Время указывается в вашем часовом поясе, его можно задать командой /report tz Europe/Moscow.`
+
+// windowOwnerMessage is shown to users who may not manage the deployment windows of a server
+const windowOwnerMessage = "⛔ Управлять окнами работ сервера может только его владелец."
+
+// handleWindowCommand manages recurring deployment windows holding alerts of servers
+func (b *Bot) handleWindowCommand(ctx context.Context, cmd *domain.Command, args []string) error {
+	telegramID := ctx.Value(userIDKey).(int64)
+	chatID := ctx.Value(chatIDKey).(int64)
+
+	user, servers, err := contextServers(ctx)
+	if err != nil {
+		return b.telegramSvc.SendMessage(ctx, chatID, "❌ Внутренняя ошибка. Попробуйте позже.")
+	}
+	if len(servers) == 0 {
+		return b.telegramSvc.SendMessage(ctx, chatID, "📭 У вас нет добавленных серверов.\n\nИспользуйте /add <server_id> для добавления сервера.")
+	}
+
+	if len(args) == 0 || strings.ToLower(args[0]) == "list" {
+		return b.telegramSvc.SendMessage(ctx, chatID, b.deploymentWindows.FormatWindows(servers, time.Now()))
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "add":
+		server, rest := resolveServerArg(servers, args[1:])
+		if server == nil {
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите сервер. Пример: /window add srv_12313 sat 02:00-04:00")
+		}
+		if len(rest) != 2 {
+			return b.telegramSvc.SendMessage(ctx, chatID, windowUsage)
+		}
+
+		window, err := scheduler.ParseWindow(rest[0], rest[1])
+		if err != nil {
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите день недели и время, например: sat 02:00-04:00")
+		}
+
+		timezone, err := b.reportService.GetTimezone(ctx, mapping.UserID(user))
+		if err != nil || timezone == "" {
+			timezone = "UTC"
+		}
+
+		stored, err := b.deploymentWindows.Add(ctx, server, telegramID, window, timezone)
+		if err != nil {
+			if errors.IsErrorCode(err, errors.ErrCodeForbidden) {
+				return b.telegramSvc.SendMessage(ctx, chatID, windowOwnerMessage)
+			}
+			if errors.IsErrorCode(err, errors.ErrCodeValidation) {
+				return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ У сервера %s слишком много окон работ. Удалите ненужные: /window remove <id>", server.Name))
+			}
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось сохранить окно работ. Попробуйте позже.")
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("✅ Окно работ #%d для %s: %s (%s).\n\nАлерты сервера во время окна придут сводкой после его окончания.", stored.ID, server.Name, window.String(), timezone))
+
+	case "remove":
+		if len(args) != 2 {
+			return b.telegramSvc.SendMessage(ctx, chatID, windowUsage)
+		}
+		id, err := strconv.ParseInt(strings.TrimPrefix(args[1], "#"), 10, 64)
+		if err != nil {
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Укажите номер окна из списка /window.")
+		}
+
+		window, ok := b.deploymentWindows.Get(id)
+		if !ok {
+			return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Окно работ #%d не найдено.", id))
+		}
+		owner := mapping.ServerByID(servers, window.ServerID)
+		if owner == nil {
+			return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("❌ Окно работ #%d не найдено.", id))
+		}
+
+		if _, err := b.deploymentWindows.Remove(ctx, owner, id); err != nil {
+			if errors.IsErrorCode(err, errors.ErrCodeForbidden) {
+				return b.telegramSvc.SendMessage(ctx, chatID, windowOwnerMessage)
+			}
+			return b.telegramSvc.SendMessage(ctx, chatID, "❌ Не удалось удалить окно работ. Попробуйте позже.")
+		}
+		return b.telegramSvc.SendMessage(ctx, chatID, fmt.Sprintf("✅ Окно работ #%d сервера %s удалено.", id, owner.Name))
+	}
+
+	return b.telegramSvc.SendMessage(ctx, chatID, windowUsage)
+}
+
+// runDeploymentWindowSummaries is a scheduler job sending the alerts held during
+// deployment and maintenance windows that are over. Whoever started a maintenance
+// without alerts during it is told that it ended.
+func (b *Bot) runDeploymentWindowSummaries(ctx context.Context, now time.Time) error {
+	summaries := b.deploymentWindows.DueSummaries(now)
+	b.sendAlerts(ctx, summaries)
+
+	for _, window := range b.deploymentWindows.ExpireMaintenance(ctx, now) {
+		if summarized(summaries, window.CreatedBy, window.ServerID) {
+			continue
+		}
+		message := fmt.Sprintf("🛠️ Обслуживание сервера %s завершено. Алертов за время обслуживания не было.", window.ServerID)
+		if err := b.telegramSvc.SendMessage(ctx, window.CreatedBy, message); err != nil {
+			b.logger.Error("Failed to send maintenance end notice", "error", err, "telegram_id", window.CreatedBy, "server_id", window.ServerID)
+		}
+	}
+	return nil
+}
+
+// summarized reports whether a summary of held alerts about a server was sent to a user
+func summarized(summaries []services.AlertNotification, telegramID int64, serverID string) bool {
+	for _, summary := range summaries {
+		if summary.TelegramID == telegramID && slices.Contains(summary.ServerIDs, serverID) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+// Package branding renders the deployment-specific texts of the bot: its display name,
+// welcome and help messages and support contact, in every supported locale.
+package branding
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates/*.tmpl
+var builtinTemplates embed.FS
+
+// Config represents branding of a deployment
+type Config struct {
+	Name           string // display name inserted into messages
+	Intro          string // welcome line under the greeting, the locale default when empty
+	SupportContact string // e.g. @admin or an email, a generic hint when empty
+	Locale         string // default locale, for users without a language of their own
+	TemplatesDir   string // optional directory with welcome.<locale>.tmpl and help.<locale>.tmpl overrides
+}
+
+// templateData is passed to welcome and help templates
+type templateData struct {
+	Name    string
+	Intro   string
+	Support string
+}
+
+// Branding holds the rendered texts of a deployment
+type Branding struct {
+	locale  string
+	name    string
+	welcome map[string]string // by locale
+	help    map[string]string // by locale
+	support map[string]string // by locale
+}
+
+// New renders the branded texts. Templates in cfg.TemplatesDir take precedence over the built-in ones.
+func New(cfg Config) (*Branding, error) {
+	if !SupportedLocale(cfg.Locale) {
+		return nil, fmt.Errorf("unsupported locale %q", cfg.Locale)
+	}
+
+	b := &Branding{
+		locale:  cfg.Locale,
+		name:    cfg.Name,
+		welcome: make(map[string]string),
+		help:    make(map[string]string),
+		support: make(map[string]string),
+	}
+	for locale := range messages {
+		data := templateData{
+			Name:    cfg.Name,
+			Intro:   cfg.Intro,
+			Support: message(locale, keySupportDefault),
+		}
+		if data.Intro == "" {
+			data.Intro = message(locale, keyIntro)
+		}
+		if cfg.SupportContact != "" {
+			data.Support = fmt.Sprintf(message(locale, keySupportContact), cfg.SupportContact)
+		}
+
+		welcome, err := render("welcome", locale, cfg, data)
+		if err != nil {
+			return nil, err
+		}
+		help, err := render("help", locale, cfg, data)
+		if err != nil {
+			return nil, err
+		}
+		b.welcome[locale], b.help[locale], b.support[locale] = welcome, help, data.Support
+	}
+
+	return b, nil
+}
+
+// Name returns the display name of the bot
+func (b *Branding) Name() string {
+	return b.name
+}
+
+// Locale returns the default locale
+func (b *Branding) Locale() string {
+	return b.locale
+}
+
+// Welcome returns the reply to /start in the default locale
+func (b *Branding) Welcome() string {
+	return b.welcome[b.locale]
+}
+
+// Help returns the reply to /help in the default locale
+func (b *Branding) Help() string {
+	return b.help[b.locale]
+}
+
+// Support returns the line telling users whom to contact in the default locale
+func (b *Branding) Support() string {
+	return b.support[b.locale]
+}
+
+// WelcomeIn returns the reply to /start in a locale, the default one when unsupported
+func (b *Branding) WelcomeIn(locale string) string {
+	if text, ok := b.welcome[locale]; ok {
+		return text
+	}
+	return b.Welcome()
+}
+
+// HelpIn returns the reply to /help in a locale, the default one when unsupported
+func (b *Branding) HelpIn(locale string) string {
+	if text, ok := b.help[locale]; ok {
+		return text
+	}
+	return b.Help()
+}
+
+// OtherCommandsIn returns the heading of commands the help of a locale does not describe
+func (b *Branding) OtherCommandsIn(locale string) string {
+	if !SupportedLocale(locale) {
+		locale = b.locale
+	}
+	return message(locale, keyOtherCommands)
+}
+
+// render executes the template of a message in a locale
+func render(name, locale string, cfg Config, data templateData) (string, error) {
+	text, err := loadTemplate(name, locale, cfg)
+	if err != nil {
+		return "", err
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %s template: %w", name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render %s template: %w", name, err)
+	}
+
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// loadTemplate reads a template from the templates directory, falling back to the built-in one
+func loadTemplate(name, locale string, cfg Config) (string, error) {
+	file := fmt.Sprintf("%s.%s.tmpl", name, locale)
+
+	if cfg.TemplatesDir != "" {
+		text, err := os.ReadFile(filepath.Join(cfg.TemplatesDir, file))
+		if err == nil {
+			return string(text), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to read %s template: %w", name, err)
+		}
+	}
+
+	text, err := builtinTemplates.ReadFile("templates/" + file)
+	if err != nil {
+		return "", fmt.Errorf("no %s template: %w", name, err)
+	}
+	return string(text), nil
+}
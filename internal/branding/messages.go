@@ -0,0 +1,45 @@
+package branding
+
+// Supported locales
+const (
+	LocaleRussian = "ru"
+	LocaleEnglish = "en"
+)
+
+// Keys of localized messages
+const (
+	keyIntro          = "intro"
+	keySupportDefault = "support_default"
+	keySupportContact = "support_contact"
+	keyOtherCommands  = "other_commands"
+)
+
+// messages are the localized texts inserted into templates
+var messages = map[string]map[string]string{
+	LocaleRussian: {
+		keyIntro:          "Я помогу вам мониторить ваши серверы.",
+		keySupportDefault: "Нужна помощь? Свяжитесь с администратором.",
+		keySupportContact: "Нужна помощь? Напишите %s.",
+		keyOtherCommands:  "*Другие команды:*",
+	},
+	LocaleEnglish: {
+		keyIntro:          "I will help you monitor your servers.",
+		keySupportDefault: "Need help? Contact the administrator.",
+		keySupportContact: "Need help? Contact %s.",
+		keyOtherCommands:  "*Other commands:*",
+	},
+}
+
+// SupportedLocale reports whether texts exist for a locale
+func SupportedLocale(locale string) bool {
+	_, ok := messages[locale]
+	return ok
+}
+
+// message returns a localized text, falling back to Russian
+func message(locale, key string) string {
+	if text, ok := messages[locale][key]; ok {
+		return text
+	}
+	return messages[LocaleRussian][key]
+}
@@ -0,0 +1,223 @@
+// Package callbacks encodes and routes the data of inline keyboard buttons. Data names an
+// action with the version of its parameters, followed by the parameters, and is signed
+// when a secret is set so that clients cannot forge buttons:
+//
+//	<action>[.<version>][:<param>]...[~<signature>]
+//
+// Version 0 is left out, which keeps unsigned data of version 0 actions identical to the
+// buttons sent before actions were versioned.
+package callbacks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/servereye/servereyebot/internal/telegram"
+)
+
+// MaxLength is the longest callback data Telegram accepts, in bytes
+const MaxLength = 64
+
+// signatureBytes is the length of the truncated HMAC-SHA256 signing data, 8 characters
+// once encoded. Forging a button takes a Telegram request per guess.
+const signatureBytes = 6
+
+var (
+	// ErrMalformed is returned for data that was not encoded by a codec
+	ErrMalformed = errors.New("malformed callback data")
+
+	// ErrSignature is returned for data whose signature is missing or wrong
+	ErrSignature = errors.New("invalid callback data signature")
+
+	// ErrUnknownAction is returned for data of an action without a handler
+	ErrUnknownAction = errors.New("unknown callback action")
+
+	// ErrOutdated is returned for data of another version than the handler of its action
+	ErrOutdated = errors.New("outdated callback data")
+
+	// ErrTooLong is returned when encoded data is longer than MaxLength
+	ErrTooLong = errors.New("callback data too long")
+)
+
+// paramEscaper escapes the separators of data in parameters
+var paramEscaper = strings.NewReplacer("%", "%25", ":", "%3A", "~", "%7E")
+
+// Action identifies what a button does. The version is raised whenever the parameters
+// of the action change meaning, so that buttons of older messages are rejected.
+type Action struct {
+	Name    string
+	Version int
+}
+
+// NewAction creates an action. Names must not contain '.', ':' or '~'.
+func NewAction(name string, version int) Action {
+	return Action{Name: name, Version: version}
+}
+
+// Data encodes a button of the action with the default codec
+func (a Action) Data(params ...string) (string, error) {
+	return defaultCodec.Load().Encode(a, params...)
+}
+
+// Button creates an inline keyboard button of the action with text. Buttons whose data
+// would be longer than MaxLength are returned as nil, which keyboards leave out.
+func (a Action) Button(text string, params ...string) map[string]string {
+	data, err := a.Data(params...)
+	if err != nil {
+		return nil
+	}
+	return map[string]string{"text": text, "callback_data": data}
+}
+
+// Data represents decoded callback data
+type Data struct {
+	Action  string
+	Version int
+	Params  []string
+}
+
+// Param returns the parameter at index i, or an empty string when there are fewer
+func (d Data) Param(i int) string {
+	if i < 0 || i >= len(d.Params) {
+		return ""
+	}
+	return d.Params[i]
+}
+
+// Codec encodes and decodes callback data, signing it when it has a secret
+type Codec struct {
+	secret []byte
+}
+
+// NewCodec creates a codec signing data with secret, or leaving it unsigned when empty
+func NewCodec(secret string) *Codec {
+	c := &Codec{}
+	if secret != "" {
+		c.secret = []byte(secret)
+	}
+	return c
+}
+
+// Encode encodes a button of action with params. ErrTooLong is returned when the data,
+// signature included, is longer than Telegram accepts.
+func (c *Codec) Encode(action Action, params ...string) (string, error) {
+	var sb strings.Builder
+	sb.WriteString(action.Name)
+	if action.Version > 0 {
+		sb.WriteByte('.')
+		sb.WriteString(strconv.Itoa(action.Version))
+	}
+	for _, param := range params {
+		sb.WriteByte(':')
+		sb.WriteString(paramEscaper.Replace(param))
+	}
+
+	if c.secret != nil {
+		signature := c.sign(sb.String())
+		sb.WriteByte('~')
+		sb.WriteString(signature)
+	}
+	if sb.Len() > MaxLength {
+		return "", fmt.Errorf("%w: %d bytes for action %s", ErrTooLong, sb.Len(), action.Name)
+	}
+	return sb.String(), nil
+}
+
+// Decode decodes callback data, verifying its signature when the codec has a secret
+func (c *Codec) Decode(data string) (Data, error) {
+	payload, signature, signed := strings.Cut(data, "~")
+	if c.secret != nil && (!signed || !hmac.Equal([]byte(signature), []byte(c.sign(payload)))) {
+		return Data{}, ErrSignature
+	}
+
+	fields := strings.Split(payload, ":")
+	decoded := Data{Action: fields[0]}
+	if name, version, ok := strings.Cut(fields[0], "."); ok {
+		v, err := strconv.Atoi(version)
+		if err != nil || v <= 0 {
+			return Data{}, fmt.Errorf("%w: version %q", ErrMalformed, version)
+		}
+		decoded.Action, decoded.Version = name, v
+	}
+	if decoded.Action == "" {
+		return Data{}, ErrMalformed
+	}
+
+	for _, field := range fields[1:] {
+		param, err := url.PathUnescape(field)
+		if err != nil {
+			return Data{}, fmt.Errorf("%w: %v", ErrMalformed, err)
+		}
+		decoded.Params = append(decoded.Params, param)
+	}
+	return decoded, nil
+}
+
+// sign returns the encoded signature of a payload
+func (c *Codec) sign(payload string) string {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:signatureBytes])
+}
+
+// defaultCodec encodes the buttons of Action.Data and decodes data routed by registries
+var defaultCodec atomic.Pointer[Codec]
+
+func init() {
+	defaultCodec.Store(NewCodec(""))
+}
+
+// SetSecret makes buttons signed with secret, or unsigned when empty. Buttons of messages
+// sent before the secret changed are rejected afterwards.
+func SetSecret(secret string) {
+	defaultCodec.Store(NewCodec(secret))
+}
+
+// HandlerFunc handles the press of a button with its decoded data
+type HandlerFunc func(ctx context.Context, callback *telegram.CallbackQuery, data Data) error
+
+// route is the handler of an action with the version of data it accepts
+type route struct {
+	version int
+	handler HandlerFunc
+}
+
+// Registry routes button presses to the handler of their action
+type Registry struct {
+	routes map[string]route
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{routes: make(map[string]route)}
+}
+
+// Handle registers the handler of an action, replacing any previous one
+func (r *Registry) Handle(action Action, handler HandlerFunc) {
+	r.routes[action.Name] = route{version: action.Version, handler: handler}
+}
+
+// Resolve decodes callback data with the default codec and returns the handler of its action
+func (r *Registry) Resolve(data string) (HandlerFunc, Data, error) {
+	decoded, err := defaultCodec.Load().Decode(data)
+	if err != nil {
+		return nil, Data{}, err
+	}
+
+	route, ok := r.routes[decoded.Action]
+	if !ok {
+		return nil, decoded, ErrUnknownAction
+	}
+	if decoded.Version != route.version {
+		return nil, decoded, ErrOutdated
+	}
+	return route.handler, decoded, nil
+}
@@ -0,0 +1,91 @@
+package callbacks_test
+
+import (
+	stderrors "errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/servereye/servereyebot/internal/callbacks"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	action := callbacks.NewAction("vms", 2)
+
+	tests := []struct {
+		name   string
+		secret string
+		params []string
+	}{
+		{name: "unsigned", params: []string{"list", "srv-1"}},
+		{name: "signed", secret: "s3cret", params: []string{"list", "srv-1"}},
+		{name: "escaped separators", secret: "s3cret", params: []string{"start", "a:b~c%d"}},
+		{name: "no params", secret: "s3cret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codec := callbacks.NewCodec(tt.secret)
+			data, err := codec.Encode(action, tt.params...)
+			if err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			decoded, err := codec.Decode(data)
+			if err != nil {
+				t.Fatalf("Decode(%q): %v", data, err)
+			}
+			if decoded.Action != action.Name || decoded.Version != action.Version || !reflect.DeepEqual(decoded.Params, tt.params) {
+				t.Errorf("Decode(%q) = %+v, want %s.%d with %q", data, decoded, action.Name, action.Version, tt.params)
+			}
+		})
+	}
+}
+
+func TestEncodeLength(t *testing.T) {
+	action := callbacks.NewAction("compose", 0)
+	prefix := len("compose:down:")
+
+	tests := []struct {
+		name    string
+		secret  string
+		project string
+		wantErr bool
+	}{
+		{name: "unsigned at the limit", project: strings.Repeat("p", callbacks.MaxLength-prefix)},
+		{name: "unsigned over the limit", project: strings.Repeat("p", callbacks.MaxLength-prefix+1), wantErr: true},
+		{name: "signature counted", secret: "s3cret", project: strings.Repeat("p", callbacks.MaxLength-prefix), wantErr: true},
+		{name: "signed at the limit", secret: "s3cret", project: strings.Repeat("p", callbacks.MaxLength-prefix-9)},
+		{name: "escaping counted", project: strings.Repeat(":", (callbacks.MaxLength-prefix)/3+1), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := callbacks.NewCodec(tt.secret).Encode(action, "down", tt.project)
+			if tt.wantErr {
+				if !stderrors.Is(err, callbacks.ErrTooLong) {
+					t.Errorf("Encode = %q, %v, want ErrTooLong", data, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			if len(data) > callbacks.MaxLength {
+				t.Errorf("Encode returned %d bytes, want at most %d", len(data), callbacks.MaxLength)
+			}
+		})
+	}
+}
+
+func TestButton(t *testing.T) {
+	action := callbacks.NewAction("logs", 0)
+
+	button := action.Button("🔄 Обновить", "srv-1", "web", "50")
+	if button["text"] != "🔄 Обновить" || button["callback_data"] != "logs:srv-1:web:50" {
+		t.Errorf("Button = %v, want the text and data of the action", button)
+	}
+
+	if button := action.Button("🔄 Обновить", "srv-1", strings.Repeat("c", callbacks.MaxLength), "50"); button != nil {
+		t.Errorf("Button with data over %d bytes = %v, want nil", callbacks.MaxLength, button)
+	}
+}
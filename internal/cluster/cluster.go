@@ -0,0 +1,40 @@
+// Package cluster coordinates replicas of the bot. One replica, the leader, polls Telegram
+// and runs scheduled jobs; updates are claimed before they are handled so that none is
+// handled twice when leadership moves to another replica.
+package cluster
+
+import (
+	"context"
+	"time"
+)
+
+// Store keeps the leadership lease and claimed keys shared by the replicas
+type Store interface {
+	// Acquire takes key for owner for ttl, or extends it when owner holds it already,
+	// reporting whether owner holds it
+	Acquire(ctx context.Context, key, owner string, ttl time.Duration) (bool, error)
+	// Release gives key up when owner holds it
+	Release(ctx context.Context, key, owner string) error
+	// Claim takes key for ttl, reporting whether it was free
+	Claim(ctx context.Context, key string, ttl time.Duration) (bool, error)
+}
+
+// RedisOptions configures the connection of the Redis store
+type RedisOptions struct {
+	Addr         string
+	Password     string
+	Database     int
+	PoolSize     int
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	Prefix       string // prepended to all keys
+}
+
+// Logger interface for cluster coordination
+type Logger interface {
+	Debug(msg string, fields ...interface{})
+	Info(msg string, fields ...interface{})
+	Warn(msg string, fields ...interface{})
+	Error(msg string, fields ...interface{})
+}
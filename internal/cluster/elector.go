@@ -0,0 +1,145 @@
+package cluster
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// leaderKey is the key of the leadership lease
+const leaderKey = "leader"
+
+// Elector campaigns for leadership among the replicas. The leader holds a lease it renews
+// three times per TTL; a replica that cannot renew in time steps down before the lease
+// lapses, so that two replicas are never leaders for long.
+type Elector struct {
+	store  Store
+	owner  string
+	ttl    time.Duration
+	logger Logger
+
+	mu     sync.Mutex
+	leader bool
+	resign context.CancelFunc // ends the leadership of this replica
+	stop   context.CancelFunc // ends the campaign
+	done   chan struct{}
+}
+
+// NewElector creates an elector campaigning as owner, a name unique to the replica
+func NewElector(store Store, owner string, ttl time.Duration, logger Logger) *Elector {
+	return &Elector{
+		store:  store,
+		owner:  owner,
+		ttl:    ttl,
+		logger: logger,
+		done:   make(chan struct{}),
+	}
+}
+
+// Run campaigns in background until ctx is done or Stop is called. lead is called on
+// election with a context that is cancelled when leadership is lost; it starts the work
+// of the leader and returns.
+func (e *Elector) Run(ctx context.Context, lead func(ctx context.Context)) {
+	ctx, cancel := context.WithCancel(ctx)
+	e.mu.Lock()
+	e.stop = cancel
+	e.mu.Unlock()
+
+	go func() {
+		defer close(e.done)
+
+		ticker := time.NewTicker(e.ttl / 3)
+		defer ticker.Stop()
+
+		var renewedAt time.Time
+		for {
+			renewedAt = e.campaign(ctx, renewedAt, lead)
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				e.stepDown("stopped")
+				return
+			}
+		}
+	}()
+}
+
+// campaign acquires or renews the lease and returns when it was last held
+func (e *Elector) campaign(ctx context.Context, renewedAt time.Time, lead func(ctx context.Context)) time.Time {
+	attemptCtx, cancel := context.WithTimeout(ctx, e.ttl/3)
+	held, err := e.store.Acquire(attemptCtx, leaderKey, e.owner, e.ttl)
+	cancel()
+
+	switch {
+	case err == nil && held:
+		if e.becomeLeader(ctx, lead) {
+			e.logger.Info("Elected leader", "instance", e.owner)
+		}
+		return time.Now()
+	case err != nil:
+		e.logger.Warn("Failed to renew leadership lease", "error", err, "instance", e.owner)
+		// Stay leader while the lease certainly has not lapsed yet
+		if e.IsLeader() && time.Since(renewedAt) < e.ttl*2/3 {
+			return renewedAt
+		}
+	}
+
+	e.stepDown("lost leadership lease")
+	return renewedAt
+}
+
+// becomeLeader starts leading, reporting whether this replica was a follower before
+func (e *Elector) becomeLeader(ctx context.Context, lead func(ctx context.Context)) bool {
+	e.mu.Lock()
+	if e.leader {
+		e.mu.Unlock()
+		return false
+	}
+	leaderCtx, resign := context.WithCancel(ctx)
+	e.leader = true
+	e.resign = resign
+	e.mu.Unlock()
+
+	lead(leaderCtx)
+	return true
+}
+
+// stepDown ends the leadership of this replica when it leads
+func (e *Elector) stepDown(reason string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.leader {
+		return
+	}
+	e.leader = false
+	e.resign()
+	e.logger.Warn("Stepped down as leader", "instance", e.owner, "reason", reason)
+}
+
+// IsLeader reports whether this replica leads
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leader
+}
+
+// Stop ends the campaign and gives up the lease, so that another replica takes over
+// without waiting for it to lapse
+func (e *Elector) Stop(ctx context.Context) error {
+	e.mu.Lock()
+	stop := e.stop
+	e.mu.Unlock()
+	if stop == nil {
+		return nil
+	}
+
+	stop()
+	select {
+	case <-e.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return e.store.Release(ctx, leaderKey, e.owner)
+}
@@ -0,0 +1,42 @@
+//go:build !redis
+
+package cluster
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// RedisStore is unavailable in binaries built without the redis build tag
+type RedisStore struct{}
+
+// NewRedisStore fails because the binary is built without Redis support
+func NewRedisStore(ctx context.Context, opts RedisOptions) (*RedisStore, error) {
+	return nil, errors.New("redis cluster store is not available (is the binary built with -tags redis?)")
+}
+
+// Acquire always fails
+func (s *RedisStore) Acquire(ctx context.Context, key, owner string, ttl time.Duration) (bool, error) {
+	return false, errors.New("redis cluster store is not available")
+}
+
+// Release always fails
+func (s *RedisStore) Release(ctx context.Context, key, owner string) error {
+	return errors.New("redis cluster store is not available")
+}
+
+// Claim always fails
+func (s *RedisStore) Claim(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return false, errors.New("redis cluster store is not available")
+}
+
+// Ping always fails
+func (s *RedisStore) Ping(ctx context.Context) error {
+	return errors.New("redis cluster store is not available")
+}
+
+// Close does nothing
+func (s *RedisStore) Close() error {
+	return nil
+}
@@ -0,0 +1,395 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/secrets"
+	"gopkg.in/yaml.v3"
+)
+
+// LoadFile loads the configuration from environment variables and defaults, then applies
+// the settings of a YAML file on top of them. Settings in the file take precedence so that
+// a reload picks up their changes, and the Telegram token may come from either; Validate
+// checks it is set. An empty path loads the environment only.
+//
+// The file is parsed with gopkg.in/yaml.v3 and decoded into the settings named by the yaml
+// tags of Config, with durations written such as 30s and comma-separated scalars accepted
+// for lists. Scalars may reference environment variables as ${VAR} or ${VAR:-default},
+// and secrets of Vault or AWS Secrets Manager as ${vault:path#key} or
+// ${aws-sm:secret_id#key}. Unknown keys and invalid values are recorded as problems
+// reported by Validate, while syntax errors fail the load.
+func LoadFile(path string) (*Config, error) {
+	if path == "" {
+		return Load()
+	}
+	cfg := loadEnvironment()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	root, err := parseYAML(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var fileProblems problems
+	decodeYAML(root, reflect.ValueOf(cfg).Elem(), "", &fileProblems)
+	for _, problem := range fileProblems {
+		cfg.problems = append(cfg.problems, Problem{Key: problem.Key, Message: path + " " + problem.Message})
+	}
+
+	resolveSecrets(cfg, secrets.NewResolver(cfg.Secrets.Options()))
+
+	cfg.File = path
+	return cfg, nil
+}
+
+// resolveSecrets replaces the secret references in the string settings of a configuration
+// with the secrets they point to. Failures are recorded as problems of the settings.
+func resolveSecrets(cfg *Config, resolver *secrets.Resolver) {
+	ctx := context.Background()
+	resolved := make(map[string]string)
+
+	var walk func(v reflect.Value, path string)
+	walk = func(v reflect.Value, path string) {
+		switch v.Kind() {
+		case reflect.Struct:
+			for i := 0; i < v.NumField(); i++ {
+				name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("yaml"), ",")
+				// The providers themselves are configured without references
+				if name != "" && name != "-" && !(path == "" && name == "secrets") {
+					walk(v.Field(i), joinYAMLPath(path, name))
+				}
+			}
+		case reflect.Slice:
+			for i := 0; i < v.Len(); i++ {
+				walk(v.Index(i), fmt.Sprintf("%s[%d]", path, i))
+			}
+		case reflect.String:
+			value := v.String()
+			if !secrets.HasReference(value) {
+				return
+			}
+			for _, ref := range secrets.References(value) {
+				if _, ok := resolved[ref]; ok {
+					continue
+				}
+				secret, err := resolver.Resolve(ctx, ref)
+				if err != nil {
+					cfg.problems.add(path, "%v", err)
+					return
+				}
+				resolved[ref] = secret
+			}
+			v.SetString(secrets.Replace(value, resolved))
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem(), "")
+
+	cfg.secretRefs = make(map[string]string, len(resolved))
+	for ref, secret := range resolved {
+		cfg.secretRefs[ref] = secrets.Fingerprint(secret)
+	}
+}
+
+// Options returns the options of the secret providers
+func (c SecretsConfig) Options() secrets.Options {
+	return secrets.Options{
+		VaultAddr:      c.VaultAddr,
+		VaultToken:     c.VaultToken,
+		VaultTokenFile: c.VaultTokenFile,
+		VaultNamespace: c.VaultNamespace,
+		AWSRegion:      c.AWSRegion,
+		AWSEndpoint:    c.AWSEndpoint,
+		Timeout:        c.Timeout,
+	}
+}
+
+// SecretReferences returns the fingerprints of the secrets referenced in the config file
+// by reference, to detect their rotation
+func (c *Config) SecretReferences() map[string]string {
+	refs := make(map[string]string, len(c.secretRefs))
+	for ref, fingerprint := range c.secretRefs {
+		refs[ref] = fingerprint
+	}
+	return refs
+}
+
+// yamlNode is a scalar, a sequence of scalars or a mapping of a YAML document
+type yamlNode struct {
+	line     int
+	scalar   *string
+	items    []string
+	keys     []string // mapping keys in file order
+	children map[string]*yamlNode
+}
+
+// parseYAML parses a YAML document into its root mapping. Scalars are decoded as strings
+// with environment variables expanded, except in single-quoted ones which are literal.
+func parseYAML(data string) (*yamlNode, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(data), &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return &yamlNode{children: map[string]*yamlNode{}}, nil
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: expected a mapping of settings", root.Line)
+	}
+	return convertYAML(root)
+}
+
+// convertYAML converts a node parsed by the YAML decoder, following aliases
+func convertYAML(n *yaml.Node) (*yamlNode, error) {
+	for n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+
+	switch n.Kind {
+	case yaml.MappingNode:
+		node := &yamlNode{line: n.Line, children: make(map[string]*yamlNode, len(n.Content)/2)}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			keyNode := n.Content[i]
+			if keyNode.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("line %d: mapping keys must be plain values", keyNode.Line)
+			}
+			key := keyNode.Value
+			if key == "<<" {
+				return nil, fmt.Errorf("line %d: merge keys are not supported", keyNode.Line)
+			}
+			if _, dup := node.children[key]; dup {
+				return nil, fmt.Errorf("line %d: duplicate key %q", keyNode.Line, key)
+			}
+			child, err := convertYAML(n.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			child.line = keyNode.Line
+			node.keys = append(node.keys, key)
+			node.children[key] = child
+		}
+		return node, nil
+
+	case yaml.SequenceNode:
+		node := &yamlNode{line: n.Line, items: make([]string, 0, len(n.Content))}
+		for _, itemNode := range n.Content {
+			item, err := convertYAMLScalar(itemNode)
+			if err != nil {
+				return nil, err
+			}
+			node.items = append(node.items, item)
+		}
+		return node, nil
+
+	default:
+		scalar, err := convertYAMLScalar(n)
+		if err != nil {
+			return nil, err
+		}
+		return &yamlNode{line: n.Line, scalar: &scalar}, nil
+	}
+}
+
+// convertYAMLScalar returns the string of a scalar node with environment variables expanded.
+// Single-quoted scalars are taken literally and null is empty.
+func convertYAMLScalar(n *yaml.Node) (string, error) {
+	for n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+
+	switch {
+	case n.Kind != yaml.ScalarNode:
+		return "", fmt.Errorf("line %d: expected a single value", n.Line)
+	case n.Tag == "!!null":
+		return "", nil
+	case n.Style&yaml.SingleQuotedStyle != 0:
+		return n.Value, nil
+	default:
+		return expandYAMLEnv(n.Value, n.Line)
+	}
+}
+
+// expandYAMLEnv replaces ${VAR} with the value of an environment variable and ${VAR:-default}
+// with the default when the variable is unset or empty. $$ stands for a literal $, and a $
+// not followed by { is kept, so that passwords containing $ need no escaping.
+func expandYAMLEnv(value string, line int) (string, error) {
+	if !strings.Contains(value, "$") {
+		return value, nil
+	}
+
+	var sb strings.Builder
+	var missing []string
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] != '$' || i+1 == len(value):
+			sb.WriteByte(value[i])
+		case value[i+1] == '$':
+			sb.WriteByte('$')
+			i++
+		case value[i+1] == '{':
+			end := strings.IndexByte(value[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("line %d: unterminated ${ in %q", line, value)
+			}
+			if secrets.HasReference(value[i : i+end+1]) {
+				// Secret references are resolved once the file is decoded
+				sb.WriteString(value[i : i+end+1])
+				i += end
+				continue
+			}
+			name, fallback, hasDefault := strings.Cut(value[i+2:i+end], ":-")
+			if !envNamePattern.MatchString(name) {
+				return "", fmt.Errorf("line %d: invalid environment variable name %q", line, name)
+			}
+			switch env := os.Getenv(name); {
+			case env != "":
+				sb.WriteString(env)
+			case hasDefault:
+				sb.WriteString(fallback)
+			default:
+				missing = append(missing, name)
+			}
+			i += end
+		default:
+			sb.WriteByte(value[i])
+		}
+	}
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("line %d: environment variable %s is not set, use ${%s:-default} for optional ones", line, strings.Join(missing, ", "), missing[0])
+	}
+	return sb.String(), nil
+}
+
+// envNamePattern matches environment variable names usable in ${VAR}
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// durationType is decoded from strings such as 30s or 5m
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// decodeYAML stores a parsed node in a configuration value. Invalid settings are recorded
+// as problems named by their dotted yaml path, and the others are still decoded.
+func decodeYAML(node *yamlNode, v reflect.Value, path string, p *problems) {
+	switch v.Kind() {
+	case reflect.Struct:
+		if node.children == nil {
+			p.add(path, "line %d: must be a mapping", node.line)
+			return
+		}
+		fields := make(map[string]reflect.Value)
+		for i := 0; i < v.NumField(); i++ {
+			name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("yaml"), ",")
+			if name != "" && name != "-" {
+				fields[name] = v.Field(i)
+			}
+		}
+		for _, key := range node.keys {
+			field, ok := fields[key]
+			if !ok {
+				p.add(joinYAMLPath(path, key), "line %d: unknown setting", node.children[key].line)
+				continue
+			}
+			decodeYAML(node.children[key], field, joinYAMLPath(path, key), p)
+		}
+		return
+
+	case reflect.Map:
+		if node.children == nil {
+			p.add(path, "line %d: must be a mapping", node.line)
+			return
+		}
+		m := reflect.MakeMapWithSize(v.Type(), len(node.keys))
+		for _, key := range node.keys {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			decodeYAML(node.children[key], elem, joinYAMLPath(path, key), p)
+			m.SetMapIndex(reflect.ValueOf(key), elem)
+		}
+		v.Set(m)
+		return
+
+	case reflect.Slice:
+		items := node.items
+		if items == nil {
+			if node.scalar == nil {
+				p.add(path, "line %d: must be a sequence", node.line)
+				return
+			}
+			// A comma-separated scalar is accepted like in the environment variables
+			items = []string{}
+			for _, item := range strings.Split(*node.scalar, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+		}
+		s := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			item := item
+			decodeYAML(&yamlNode{line: node.line, scalar: &item}, s.Index(i), fmt.Sprintf("%s[%d]", path, i), p)
+		}
+		v.Set(s)
+		return
+	}
+
+	if node.scalar == nil {
+		p.add(path, "line %d: must be a single value", node.line)
+		return
+	}
+	value := *node.scalar
+
+	var err error
+	expected := ""
+	switch {
+	case v.Type() == durationType:
+		var d time.Duration
+		if d, err = time.ParseDuration(value); err == nil {
+			v.SetInt(int64(d))
+		}
+		expected = "a duration such as 30s or 5m"
+	case v.Kind() == reflect.String:
+		v.SetString(value)
+	case v.Kind() == reflect.Bool:
+		var b bool
+		if b, err = strconv.ParseBool(value); err == nil {
+			v.SetBool(b)
+		}
+		expected = "true or false"
+	case v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64:
+		var n int64
+		if n, err = strconv.ParseInt(value, 10, v.Type().Bits()); err == nil {
+			v.SetInt(n)
+		}
+		expected = "an integer"
+	case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+		var f float64
+		if f, err = strconv.ParseFloat(value, v.Type().Bits()); err == nil {
+			v.SetFloat(f)
+		}
+		expected = "a number"
+	default:
+		p.add(path, "line %d: unsupported setting type", node.line)
+		return
+	}
+	if err != nil {
+		p.add(path, "line %d: invalid value %q, expected %s", node.line, value, expected)
+	}
+}
+
+// joinYAMLPath appends a key to a dotted setting path
+func joinYAMLPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
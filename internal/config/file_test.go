@@ -0,0 +1,373 @@
+package config
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/secrets"
+)
+
+// fileSettings covers every kind of setting the YAML decoder stores
+type fileSettings struct {
+	Name    string             `yaml:"name"`
+	Port    int                `yaml:"port"`
+	Timeout time.Duration      `yaml:"timeout"`
+	Debug   bool               `yaml:"debug"`
+	Ratio   float64            `yaml:"ratio"`
+	Tags    []string           `yaml:"tags"`
+	IDs     []int64            `yaml:"ids"`
+	Limits  map[string]float64 `yaml:"limits"`
+	Users   map[string][]int64 `yaml:"users"`
+	Nested  struct {
+		URL string `yaml:"url"`
+	} `yaml:"nested"`
+	Ignored string `yaml:"-"`
+}
+
+// decodeFile parses a document and decodes it into fileSettings
+func decodeFile(t *testing.T, data string) (fileSettings, problems, error) {
+	t.Helper()
+
+	var settings fileSettings
+	root, err := parseYAML(data)
+	if err != nil {
+		return settings, nil, err
+	}
+	var p problems
+	decodeYAML(root, reflect.ValueOf(&settings).Elem(), "", &p)
+	return settings, p, nil
+}
+
+func TestParseYAML(t *testing.T) {
+	t.Setenv("CONFIG_TEST_NAME", "from-env")
+	t.Setenv("CONFIG_TEST_EMPTY", "")
+
+	tests := []struct {
+		name string
+		data string
+		want fileSettings
+	}{
+		{
+			name: "empty document",
+			data: "# nothing here\n",
+		},
+		{
+			name: "scalars",
+			data: "name: bot\nport: 8080\ntimeout: 30s\ndebug: true\nratio: 0.75\n",
+			want: fileSettings{Name: "bot", Port: 8080, Timeout: 30 * time.Second, Debug: true, Ratio: 0.75},
+		},
+		{
+			name: "nested mapping with comments",
+			data: "# bot\nnested: # section\n  url: http://example.com/#anchor # trailing\n",
+			want: fileSettings{Nested: struct {
+				URL string `yaml:"url"`
+			}{URL: "http://example.com/#anchor"}},
+		},
+		{
+			name: "block sequence",
+			data: "tags:\n  - web\n  - \"db, primary\"\nids:\n- 1\n- 2\n",
+			want: fileSettings{Tags: []string{"web", "db, primary"}, IDs: []int64{1, 2}},
+		},
+		{
+			name: "flow sequence",
+			data: "tags: [web, 'db, primary', \"cache\"]\n",
+			want: fileSettings{Tags: []string{"web", "db, primary", "cache"}},
+		},
+		{
+			name: "comma-separated list",
+			data: "tags: web, db ,, cache\nids: \"1,2\"\n",
+			want: fileSettings{Tags: []string{"web", "db", "cache"}, IDs: []int64{1, 2}},
+		},
+		{
+			name: "empty sequence",
+			data: "tags: []\n",
+			want: fileSettings{Tags: []string{}},
+		},
+		{
+			name: "block and flow mappings",
+			data: "limits:\n  cpu: 90\n  disk: 85.5\nusers: {beta: [1, 2], alpha: []}\n",
+			want: fileSettings{Limits: map[string]float64{"cpu": 90, "disk": 85.5},
+				Users: map[string][]int64{"beta": {1, 2}, "alpha": {}}},
+		},
+		{
+			name: "environment variables",
+			data: "name: ${CONFIG_TEST_NAME}-${CONFIG_TEST_EMPTY:-fallback}\nnested:\n  url: \"${CONFIG_TEST_UNSET:-http://localhost}\"\n",
+			want: fileSettings{Name: "from-env-fallback", Nested: struct {
+				URL string `yaml:"url"`
+			}{URL: "http://localhost"}},
+		},
+		{
+			name: "dollar signs",
+			data: "name: pa$$word$ and $HOME\n",
+			want: fileSettings{Name: "pa$word$ and $HOME"},
+		},
+		{
+			name: "single-quoted scalars are literal",
+			data: "name: '${CONFIG_TEST_NAME} it''s'\n",
+			want: fileSettings{Name: "${CONFIG_TEST_NAME} it's"},
+		},
+		{
+			name: "secret references are kept",
+			data: "name: ${vault:secret/bot#token}\n",
+			want: fileSettings{Name: "${vault:secret/bot#token}"},
+		},
+		{
+			name: "null",
+			data: "name: ~\nnested:\n  url: null\ntags:\n",
+			want: fileSettings{Tags: []string{}},
+		},
+		{
+			name: "anchors and aliases",
+			data: "name: &shared bot\nnested:\n  url: *shared\n",
+			want: fileSettings{Name: "bot", Nested: struct {
+				URL string `yaml:"url"`
+			}{URL: "bot"}},
+		},
+		{
+			name: "document marker",
+			data: "---\nport: 1\n",
+			want: fileSettings{Port: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, p, err := decodeFile(t, tt.data)
+			if err != nil {
+				t.Fatalf("parseYAML: %v", err)
+			}
+			if len(p) > 0 {
+				t.Fatalf("problems: %v", p)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decoded %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{name: "tab indentation", data: "nested:\n\turl: x\n", wantErr: "line 2"},
+		{name: "bad indentation", data: "name: bot\n  port: 1\n", wantErr: "line 2"},
+		{name: "duplicate key", data: "name: a\nname: b\n", wantErr: "line 2: duplicate key \"name\""},
+		{name: "unterminated flow sequence", data: "tags: [a, b\n", wantErr: "line 1"},
+		{name: "unterminated quote", data: "name: \"bot\n", wantErr: "unexpected end of stream"},
+		{name: "sequence document", data: "- a\n- b\n", wantErr: "line 1: expected a mapping"},
+		{name: "scalar document", data: "bot\n", wantErr: "line 1: expected a mapping"},
+		{name: "nested sequence", data: "tags:\n  - [a, b]\n", wantErr: "line 2: expected a single value"},
+		{name: "mapping in a sequence", data: "tags:\n  - name: a\n", wantErr: "line 2: expected a single value"},
+		{name: "merge key", data: "base: &base\n  url: x\nnested:\n  <<: *base\n", wantErr: "line 4: merge keys"},
+		{name: "unset environment variable", data: "name: ${CONFIG_TEST_UNSET}\n", wantErr: "line 1: environment variable CONFIG_TEST_UNSET is not set"},
+		{name: "invalid environment variable name", data: "name: ${1BAD}\n", wantErr: "invalid environment variable name"},
+		{name: "unterminated variable", data: "name: ${CONFIG_TEST_NAME\n", wantErr: "unterminated ${"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseYAML(tt.data)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseYAML error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecodeYAMLProblems(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []Problem
+	}{
+		{name: "unknown setting", data: "name: bot\ncolour: red\n",
+			want: []Problem{{Key: "colour", Message: "line 2: unknown setting"}}},
+		{name: "unknown nested setting", data: "nested:\n  uri: x\n",
+			want: []Problem{{Key: "nested.uri", Message: "line 2: unknown setting"}}},
+		{name: "ignored field", data: "Ignored: x\n",
+			want: []Problem{{Key: "Ignored", Message: "line 1: unknown setting"}}},
+		{name: "invalid integer", data: "port: eighty\n",
+			want: []Problem{{Key: "port", Message: `line 1: invalid value "eighty", expected an integer`}}},
+		{name: "invalid duration", data: "timeout: 30\n",
+			want: []Problem{{Key: "timeout", Message: `line 1: invalid value "30", expected a duration such as 30s or 5m`}}},
+		{name: "invalid bool", data: "debug: maybe\n",
+			want: []Problem{{Key: "debug", Message: `line 1: invalid value "maybe", expected true or false`}}},
+		{name: "invalid list item", data: "ids: [1, x]\n",
+			want: []Problem{{Key: "ids[1]", Message: `line 1: invalid value "x", expected an integer`}}},
+		{name: "invalid map value", data: "limits:\n  cpu: high\n",
+			want: []Problem{{Key: "limits.cpu", Message: `line 2: invalid value "high", expected a number`}}},
+		{name: "scalar for a mapping", data: "nested: x\n",
+			want: []Problem{{Key: "nested", Message: "line 1: must be a mapping"}}},
+		{name: "mapping for a scalar", data: "name:\n  first: bot\n",
+			want: []Problem{{Key: "name", Message: "line 1: must be a single value"}}},
+		{name: "mapping for a list", data: "tags:\n  a: b\n",
+			want: []Problem{{Key: "tags", Message: "line 1: must be a sequence"}}},
+		{name: "valid settings are still decoded", data: "port: x\nname: bot\n",
+			want: []Problem{{Key: "port", Message: `line 1: invalid value "x", expected an integer`}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, p, err := decodeFile(t, tt.data)
+			if err != nil {
+				t.Fatalf("parseYAML: %v", err)
+			}
+			if !reflect.DeepEqual([]Problem(p), tt.want) {
+				t.Errorf("problems = %v, want %v", p, tt.want)
+			}
+			if tt.name == "valid settings are still decoded" && got.Name != "bot" {
+				t.Errorf("name = %q, want the valid setting decoded", got.Name)
+			}
+		})
+	}
+}
+
+// newVault starts a fake Vault serving KV version 2 secrets by path
+func newVault(t *testing.T, secrets map[string]map[string]string) string {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "test-token" {
+			w.WriteHeader(http.StatusForbidden)
+			_ = json.NewEncoder(w).Encode(map[string][]string{"errors": {"permission denied"}})
+			return
+		}
+		fields, ok := secrets[strings.TrimPrefix(r.URL.Path, "/v1/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string][]string{"errors": {}})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"data": fields, "metadata": map[string]int{"version": 1}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestResolveSecrets(t *testing.T) {
+	vault := newVault(t, map[string]map[string]string{
+		"secret/data/bot": {"token": "123:abc", "password": "s3cret"},
+		"secret/data/api": {"key": "api-key"},
+	})
+
+	cfg := &Config{}
+	cfg.Telegram.Token = "${vault:secret/data/bot#token}"
+	cfg.Database.Password = "${vault:secret/data/bot#password}"
+	cfg.Notify.SMTPPassword = "key=${vault:secret/data/api}; token=${vault:secret/data/bot#token}"
+	cfg.API.FallbackURLs = []string{"http://${vault:secret/data/api#key}.example.com"}
+	cfg.Redis.Password = "${vault:secret/data/bot#missing}"
+	cfg.Database.Host = "${vault:secret/data/unknown#host}"
+	cfg.App.Name = "plain $value"
+	// The providers are configured without references
+	cfg.Secrets.VaultToken = "${vault:secret/data/bot#token}"
+
+	resolver := secrets.NewResolver(secrets.Options{VaultAddr: vault, VaultToken: "test-token", Timeout: time.Second})
+	resolveSecrets(cfg, resolver)
+
+	resolved := map[string]string{
+		"telegram.token":       cfg.Telegram.Token,
+		"database.password":    cfg.Database.Password,
+		"notify.smtp_password": cfg.Notify.SMTPPassword,
+		"api.fallback_urls[0]": cfg.API.FallbackURLs[0],
+		"app.name":             cfg.App.Name,
+		"secrets.vault_token":  cfg.Secrets.VaultToken,
+	}
+	want := map[string]string{
+		"telegram.token":       "123:abc",
+		"database.password":    "s3cret",
+		"notify.smtp_password": "key=api-key; token=123:abc",
+		"api.fallback_urls[0]": "http://api-key.example.com",
+		"app.name":             "plain $value",
+		"secrets.vault_token":  "${vault:secret/data/bot#token}",
+	}
+	if !reflect.DeepEqual(resolved, want) {
+		t.Errorf("resolved settings = %v, want %v", resolved, want)
+	}
+
+	var keys []string
+	for _, problem := range cfg.problems {
+		keys = append(keys, problem.Key)
+	}
+	if want := []string{"database.host", "redis.password"}; !sameKeys(keys, want) {
+		t.Errorf("problems = %v, want ones of %v", cfg.problems, want)
+	}
+	if cfg.Redis.Password != "${vault:secret/data/bot#missing}" {
+		t.Errorf("unresolved setting = %q, want the reference kept", cfg.Redis.Password)
+	}
+
+	refs := cfg.SecretReferences()
+	if len(refs) != 4 {
+		t.Errorf("%d secret references, want 4: %v", len(refs), refs)
+	}
+	if got := refs["${vault:secret/data/bot#token}"]; got != secrets.Fingerprint("123:abc") {
+		t.Errorf("fingerprint of the token = %q, want the SHA-256 of the secret", got)
+	}
+}
+
+func TestLoadFileResolvesReferences(t *testing.T) {
+	vault := newVault(t, map[string]map[string]string{"secret/data/bot": {"token": "123:abc"}})
+	t.Setenv("VAULT_ADDR", vault)
+	t.Setenv("VAULT_TOKEN", "test-token")
+	t.Setenv("CONFIG_TEST_PORT", "9090")
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "telegram:\n  token: ${vault:secret/data/bot#token}\napp:\n  port: ${CONFIG_TEST_PORT}\n  colour: red\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if cfg.Telegram.Token != "123:abc" || cfg.App.Port != 9090 || cfg.File != path {
+		t.Errorf("loaded token %q, port %d, file %q", cfg.Telegram.Token, cfg.App.Port, cfg.File)
+	}
+
+	var unknown []Problem
+	for _, problem := range cfg.problems {
+		if problem.Key == "app.colour" {
+			unknown = append(unknown, problem)
+		}
+	}
+	if len(unknown) != 1 || !strings.HasPrefix(unknown[0].Message, path+" line 5") {
+		t.Errorf("problems = %v, want the unknown setting reported with the file and line", cfg.problems)
+	}
+
+	if err := os.WriteFile(path, []byte("app:\n  port: [1\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if _, err := LoadFile(path); err == nil || !strings.HasPrefix(err.Error(), path+": ") {
+		t.Errorf("LoadFile of a malformed file = %v, want a syntax error naming the file", err)
+	}
+}
+
+// sameKeys reports whether two lists hold the same keys in any order
+func sameKeys(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	seen := make(map[string]int)
+	for _, key := range got {
+		seen[key]++
+	}
+	for _, key := range want {
+		if seen[key] == 0 {
+			return false
+		}
+		seen[key]--
+	}
+	return true
+}
@@ -0,0 +1,229 @@
+// Package features evaluates feature flags gating experimental features. A flag is enabled
+// for the users listed in it and for a stable share of the others, so that a rollout can
+// grow without users switching between the old and the new behaviour.
+package features
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// refreshInterval is how long flags flipped at runtime are reused before the store is
+// read again, which bounds how late other replicas see a change
+const refreshInterval = 10 * time.Second
+
+// namePattern restricts flag names so that they are safe as store keys and in commands
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+// Flag represents the rollout of a feature
+type Flag struct {
+	Name    string  `json:"name"`
+	Rollout float64 `json:"rollout"`         // percentage of users, 100 enables the flag for everyone
+	Users   []int64 `json:"users,omitempty"` // Telegram IDs enabled regardless of the rollout
+}
+
+// State represents a flag with where its rollout comes from
+type State struct {
+	Flag
+	Override bool // flipped at runtime rather than configured
+}
+
+// Store keeps flags flipped at runtime
+type Store interface {
+	// List returns the stored flags by name
+	List(ctx context.Context) (map[string]Flag, error)
+	// Set stores a flag, replacing the one with the same name
+	Set(ctx context.Context, flag Flag) error
+	// Delete removes a flag and reports whether it was stored
+	Delete(ctx context.Context, name string) (bool, error)
+}
+
+// RedisOptions configures the connection of the Redis store
+type RedisOptions struct {
+	Addr         string
+	Password     string
+	Database     int
+	PoolSize     int
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	Prefix       string // prepended to all keys
+}
+
+// Flags evaluates feature flags. Flags flipped at runtime take precedence over the
+// configured defaults.
+type Flags struct {
+	store Store
+	now   func() time.Time
+
+	mu        sync.Mutex
+	defaults  map[string]Flag
+	overrides map[string]Flag
+	loadedAt  time.Time
+}
+
+// New creates feature flags with configured defaults and a store for runtime overrides
+func New(store Store, defaults map[string]Flag) *Flags {
+	return &Flags{
+		store:    store,
+		now:      time.Now,
+		defaults: defaults,
+	}
+}
+
+// Defaults builds the configured flags from rollout percentages and user lists by flag
+func Defaults(rollout map[string]float64, users map[string][]int64) map[string]Flag {
+	defaults := make(map[string]Flag, len(rollout)+len(users))
+	for name, percent := range rollout {
+		defaults[name] = Flag{Name: name, Rollout: percent}
+	}
+	for name, ids := range users {
+		flag := defaults[name]
+		flag.Name = name
+		flag.Users = append([]int64(nil), ids...)
+		defaults[name] = flag
+	}
+	return defaults
+}
+
+// SetDefaults replaces the configured flags, as on a configuration reload
+func (f *Flags) SetDefaults(defaults map[string]Flag) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.defaults = defaults
+}
+
+// Enabled reports whether a feature is enabled for a user. Unknown flags are disabled.
+// When the store is unreachable the overrides loaded last stay in effect.
+func (f *Flags) Enabled(ctx context.Context, name string, telegramID int64) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_ = f.refresh(ctx)
+
+	flag, ok := f.overrides[name]
+	if !ok {
+		if flag, ok = f.defaults[name]; !ok {
+			return false
+		}
+	}
+	return flag.enabled(telegramID)
+}
+
+// List returns all configured and overridden flags sorted by name
+func (f *Flags) List(ctx context.Context) ([]State, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	err := f.refresh(ctx)
+
+	states := make([]State, 0, len(f.defaults)+len(f.overrides))
+	for name, flag := range f.defaults {
+		if _, ok := f.overrides[name]; !ok {
+			states = append(states, State{Flag: flag})
+		}
+	}
+	for _, flag := range f.overrides {
+		states = append(states, State{Flag: flag, Override: true})
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Name < states[j].Name })
+	return states, err
+}
+
+// Get returns the effective rollout of a flag, or false when it is neither configured nor
+// overridden
+func (f *Flags) Get(ctx context.Context, name string) (State, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	err := f.refresh(ctx)
+	if flag, ok := f.overrides[name]; ok {
+		return State{Flag: flag, Override: true}, true, err
+	}
+	flag, ok := f.defaults[name]
+	return State{Flag: flag}, ok, err
+}
+
+// Set overrides a flag for all replicas
+func (f *Flags) Set(ctx context.Context, flag Flag) error {
+	if !ValidName(flag.Name) {
+		return fmt.Errorf("invalid feature flag name %q", flag.Name)
+	}
+	if flag.Rollout < 0 || flag.Rollout > 100 {
+		return fmt.Errorf("feature flag rollout must be between 0 and 100 percent")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.store.Set(ctx, flag); err != nil {
+		return err
+	}
+	if f.overrides != nil {
+		f.overrides[flag.Name] = flag
+	}
+	return nil
+}
+
+// Reset removes the override of a flag, restoring its configured rollout. It reports
+// whether the flag was overridden.
+func (f *Flags) Reset(ctx context.Context, name string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	removed, err := f.store.Delete(ctx, name)
+	if err != nil {
+		return false, err
+	}
+	delete(f.overrides, name)
+	return removed, nil
+}
+
+// refresh reloads the overrides once refreshInterval has passed. Must be called with mu held.
+func (f *Flags) refresh(ctx context.Context) error {
+	now := f.now()
+	if f.overrides != nil && now.Sub(f.loadedAt) < refreshInterval {
+		return nil
+	}
+
+	overrides, err := f.store.List(ctx)
+	// Failed reads are retried after the interval too instead of on every check
+	f.loadedAt = now
+	if err != nil {
+		if f.overrides == nil {
+			f.overrides = map[string]Flag{}
+		}
+		return fmt.Errorf("failed to load feature flags: %w", err)
+	}
+	f.overrides = overrides
+	return nil
+}
+
+// enabled reports whether the flag covers a user
+func (flag Flag) enabled(telegramID int64) bool {
+	for _, id := range flag.Users {
+		if id == telegramID {
+			return true
+		}
+	}
+	return flag.Rollout > 0 && Bucket(flag.Name, telegramID) < flag.Rollout
+}
+
+// Bucket places a user at a stable position between 0 and 100 for a flag. Positions of
+// different flags are independent, so the same users do not get every experiment first.
+func Bucket(name string, telegramID int64) float64 {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s:%d", name, telegramID)
+	return float64(h.Sum32()%10000) / 100
+}
+
+// ValidName reports whether a flag name is valid
+func ValidName(name string) bool {
+	return namePattern.MatchString(name)
+}
@@ -0,0 +1,49 @@
+package features
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryStore keeps flags flipped at runtime in process memory. They apply to this bot
+// instance only and are lost on restart.
+type MemoryStore struct {
+	mu    sync.Mutex
+	flags map[string]Flag
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{flags: make(map[string]Flag)}
+}
+
+// List returns the stored flags by name
+func (s *MemoryStore) List(ctx context.Context) (map[string]Flag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	flags := make(map[string]Flag, len(s.flags))
+	for name, flag := range s.flags {
+		flags[name] = flag
+	}
+	return flags, nil
+}
+
+// Set stores a flag
+func (s *MemoryStore) Set(ctx context.Context, flag Flag) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.flags[flag.Name] = flag
+	return nil
+}
+
+// Delete removes a flag
+func (s *MemoryStore) Delete(ctx context.Context, name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.flags[name]
+	delete(s.flags, name)
+	return ok, nil
+}
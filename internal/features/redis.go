@@ -0,0 +1,84 @@
+//go:build redis
+
+package features
+
+// The Redis store is linked only into binaries built with -tags redis, so that default
+// builds do not carry the Redis client.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore keeps flags flipped at runtime in a Redis hash so that all bot instances
+// share them and keep them across restarts
+type RedisStore struct {
+	client *redis.Client
+	key    string
+}
+
+// NewRedisStore connects to Redis and creates a store
+func NewRedisStore(ctx context.Context, opts RedisOptions) (*RedisStore, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:         opts.Addr,
+		Password:     opts.Password,
+		DB:           opts.Database,
+		PoolSize:     opts.PoolSize,
+		DialTimeout:  opts.DialTimeout,
+		ReadTimeout:  opts.ReadTimeout,
+		WriteTimeout: opts.WriteTimeout,
+	})
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	return &RedisStore{client: client, key: opts.Prefix + "flags"}, nil
+}
+
+// List returns the stored flags by name
+func (s *RedisStore) List(ctx context.Context) (map[string]Flag, error) {
+	values, err := s.client.HGetAll(ctx, s.key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	flags := make(map[string]Flag, len(values))
+	for name, value := range values {
+		var flag Flag
+		if err := json.Unmarshal([]byte(value), &flag); err != nil {
+			return nil, fmt.Errorf("failed to decode feature flag %s: %w", name, err)
+		}
+		flags[name] = flag
+	}
+	return flags, nil
+}
+
+// Set stores a flag
+func (s *RedisStore) Set(ctx context.Context, flag Flag) error {
+	data, err := json.Marshal(flag)
+	if err != nil {
+		return err
+	}
+	return s.client.HSet(ctx, s.key, flag.Name, data).Err()
+}
+
+// Delete removes a flag
+func (s *RedisStore) Delete(ctx context.Context, name string) (bool, error) {
+	deleted, err := s.client.HDel(ctx, s.key, name).Result()
+	return deleted > 0, err
+}
+
+// Ping checks that Redis is reachable
+func (s *RedisStore) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
+// Close closes the Redis connections
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
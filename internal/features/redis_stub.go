@@ -0,0 +1,41 @@
+//go:build !redis
+
+package features
+
+import (
+	"context"
+	"errors"
+)
+
+// RedisStore is unavailable in binaries built without the redis build tag
+type RedisStore struct{}
+
+// NewRedisStore fails because the binary is built without Redis support
+func NewRedisStore(ctx context.Context, opts RedisOptions) (*RedisStore, error) {
+	return nil, errors.New("redis feature flag store is not available (is the binary built with -tags redis?)")
+}
+
+// List always fails
+func (s *RedisStore) List(ctx context.Context) (map[string]Flag, error) {
+	return nil, errors.New("redis feature flag store is not available")
+}
+
+// Set always fails
+func (s *RedisStore) Set(ctx context.Context, flag Flag) error {
+	return errors.New("redis feature flag store is not available")
+}
+
+// Delete always fails
+func (s *RedisStore) Delete(ctx context.Context, name string) (bool, error) {
+	return false, errors.New("redis feature flag store is not available")
+}
+
+// Ping always fails
+func (s *RedisStore) Ping(ctx context.Context) error {
+	return errors.New("redis feature flag store is not available")
+}
+
+// Close does nothing
+func (s *RedisStore) Close() error {
+	return nil
+}
@@ -0,0 +1,127 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/tracing"
+)
+
+// agentKeyPrefixLength is how much of a server key the access log shows
+const agentKeyPrefixLength = 8
+
+// requestInfoContextKey is the context key of the details the access log collects
+type requestInfoContextKey struct{}
+
+// requestInfo collects details of a request that are known only inside its handler
+type requestInfo struct {
+	agentKey string
+}
+
+// statusRecorder remembers the status written to a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status before writing it
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write records the implicit 200 status of a body written without a header
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap exposes the wrapped writer, so that agent connections can take it over
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// UseTracer records a span of every API request with tracer
+func (s *HttpServer) UseTracer(tracer *tracing.Tracer) {
+	s.tracer = tracer
+}
+
+// accessLog logs method, path, status, latency and agent key of every API request and
+// records its span when a tracer is set
+func (s *HttpServer) accessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		span := s.tracer.Start(r.Method+" "+r.URL.Path, tracing.KindServer, r.Header.Get("traceparent"))
+		info := &requestInfo{}
+		recorder := &statusRecorder{ResponseWriter: w}
+		r = r.WithContext(tracing.ContextWithSpan(context.WithValue(r.Context(), requestInfoContextKey{}, info), span))
+
+		next.ServeHTTP(recorder, r)
+
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		route := r.Pattern
+		if route == "" {
+			route = r.URL.Path
+		}
+
+		fields := map[string]interface{}{
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"status":      status,
+			"duration_ms": time.Since(start).Milliseconds(),
+		}
+		if info.agentKey != "" {
+			fields["agent_key"] = agentKeyPrefix(info.agentKey)
+		}
+		if traceID := span.TraceID(); traceID != "" {
+			fields["trace_id"] = traceID
+		}
+		log := RequestLogger(s.logger, r).WithFields(fields)
+		if status >= http.StatusInternalServerError {
+			log.Warn("API request failed")
+		} else {
+			log.Info("API request")
+		}
+
+		span.SetAttribute("http.request.method", r.Method)
+		span.SetAttribute("http.route", route)
+		span.SetAttribute("http.response.status_code", status)
+		span.SetAttribute("request_id", RequestIDOf(r.Context()))
+		if info.agentKey != "" {
+			span.SetAttribute("agent.key_prefix", agentKeyPrefix(info.agentKey))
+		}
+		if status >= http.StatusInternalServerError {
+			span.SetFailed()
+		}
+		span.End()
+	})
+}
+
+// recordAgentKey passes the authenticated server key of a request to the access log
+func recordAgentKey(ctx context.Context, serverKey string) {
+	if info, ok := ctx.Value(requestInfoContextKey{}).(*requestInfo); ok {
+		info.agentKey = serverKey
+	}
+}
+
+// agentKeyPrefix shortens a server key so that logs do not hold full keys
+func agentKeyPrefix(serverKey string) string {
+	if len(serverKey) <= agentKeyPrefixLength {
+		return serverKey
+	}
+	return serverKey[:agentKeyPrefixLength] + "…"
+}
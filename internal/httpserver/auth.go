@@ -0,0 +1,169 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/servereye/servereyebot/internal/logger"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// agentKeyContextKey is the context key of the authenticated agent's server key
+type agentKeyContextKey struct{}
+
+// Authenticator guards API endpoints with bearer tokens. Agents use tokens derived
+// from their srv_ key with a secret of the bot; admin endpoints use a shared token.
+// Over TLS agents may instead present a client certificate issued to their srv_ key.
+type Authenticator struct {
+	secret            []byte
+	adminToken        string
+	requireClientCert bool
+	logger            logger.Logger
+}
+
+// NewAuthenticator creates an authenticator. Agent endpoints reject all requests while
+// secret is empty, admin endpoints while adminToken is empty. With requireClientCert
+// agent endpoints accept only client certificates, except the enrollment endpoint.
+func NewAuthenticator(secret, adminToken string, requireClientCert bool, log logger.Logger) *Authenticator {
+	return &Authenticator{
+		secret:            []byte(secret),
+		adminToken:        adminToken,
+		requireClientCert: requireClientCert,
+		logger:            log,
+	}
+}
+
+// AgentToken derives the bearer token of an agent from its server key.
+// The token has the form <server_key>.<hex HMAC-SHA256 of the key>.
+func (a *Authenticator) AgentToken(serverKey string) string {
+	if len(a.secret) == 0 {
+		return ""
+	}
+	return serverKey + "." + a.mac(serverKey)
+}
+
+// Agent requires an agent bearer token or client certificate and stores its server key
+// in the request context. known reports whether the key still belongs to a server.
+func (a *Authenticator) Agent(known func(ctx context.Context, serverKey string) bool, next http.Handler) http.Handler {
+	return a.agent(known, a.requireClientCert, next)
+}
+
+// AgentEnrollment is Agent that accepts bearer tokens even when client certificates are
+// required, for the endpoint agents obtain their first certificate from
+func (a *Authenticator) AgentEnrollment(known func(ctx context.Context, serverKey string) bool, next http.Handler) http.Handler {
+	return a.agent(known, false, next)
+}
+
+// agent authenticates an agent by its client certificate and bearer token. When both
+// are presented they must belong to the same server key.
+func (a *Authenticator) agent(known func(ctx context.Context, serverKey string) bool, requireCert bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		certKey, hasCert := clientCertKey(r)
+		if requireCert && !hasCert {
+			a.reject(w, r, "missing client certificate")
+			return
+		}
+
+		serverKey := certKey
+		if token, ok := bearerToken(r); ok || !hasCert {
+			if len(a.secret) == 0 {
+				WriteError(w, r, http.StatusServiceUnavailable, errors.ErrCodeUnavailable, "agent authentication is not configured")
+				return
+			}
+
+			dot := strings.LastIndex(token, ".")
+			if !ok || dot <= 0 {
+				a.reject(w, r, "missing agent token")
+				return
+			}
+
+			tokenKey, mac := token[:dot], token[dot+1:]
+			if !hmac.Equal([]byte(mac), []byte(a.mac(tokenKey))) {
+				a.reject(w, r, "invalid agent token")
+				return
+			}
+			if hasCert && tokenKey != certKey {
+				a.reject(w, r, "client certificate issued to another server key")
+				return
+			}
+			serverKey = tokenKey
+		}
+
+		if known != nil && !known(r.Context(), serverKey) {
+			a.reject(w, r, "unknown or revoked server key")
+			return
+		}
+
+		recordAgentKey(r.Context(), serverKey)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), agentKeyContextKey{}, serverKey)))
+	})
+}
+
+// Admin requires the shared admin bearer token
+func (a *Authenticator) Admin(next http.Handler) http.Handler {
+	return a.Token("admin", a.adminToken, next)
+}
+
+// Token requires a static bearer token, such as the one configured in an external
+// system posting to a webhook. Requests are rejected while token is empty.
+func (a *Authenticator) Token(name, token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			WriteError(w, r, http.StatusServiceUnavailable, errors.ErrCodeUnavailable, name+" authentication is not configured")
+			return
+		}
+
+		presented, ok := bearerToken(r)
+		if !ok || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+			a.reject(w, r, "invalid "+name+" token")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AgentKey returns the server key of the agent authenticated for the request
+func AgentKey(ctx context.Context) (string, bool) {
+	serverKey, ok := ctx.Value(agentKeyContextKey{}).(string)
+	return serverKey, ok
+}
+
+// mac computes the hex HMAC-SHA256 of a server key
+func (a *Authenticator) mac(serverKey string) string {
+	h := hmac.New(sha256.New, a.secret)
+	h.Write([]byte(serverKey))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// reject answers an unauthenticated request
+func (a *Authenticator) reject(w http.ResponseWriter, r *http.Request, reason string) {
+	RequestLogger(a.logger, r).Warn("Rejected API request", "path", r.URL.Path, "remote_addr", r.RemoteAddr, "reason", reason)
+	w.Header().Set("WWW-Authenticate", `Bearer realm="servereye"`)
+	WriteError(w, r, http.StatusUnauthorized, errors.ErrCodeUnauthorized, "unauthorized")
+}
+
+// clientCertKey returns the server key of a verified client certificate of a request
+func clientCertKey(r *http.Request) (string, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	serverKey := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	return serverKey, serverKey != ""
+}
+
+// bearerToken extracts the bearer token of a request
+func bearerToken(r *http.Request) (string, bool) {
+	const prefix = "Bearer "
+
+	header := r.Header.Get("Authorization")
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(header[len(prefix):]), true
+}
@@ -0,0 +1,151 @@
+package httpserver_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/servereye/servereyebot/internal/httpserver"
+	"github.com/servereye/servereyebot/internal/logger"
+)
+
+// newAuthenticator creates an authenticator logging nothing
+func newAuthenticator(t *testing.T, secret, adminToken string, requireClientCert bool) *httpserver.Authenticator {
+	t.Helper()
+
+	log, err := logger.New(logger.LoggerConfig{Level: "panic"})
+	if err != nil {
+		t.Fatalf("logger.New: %v", err)
+	}
+	return httpserver.NewAuthenticator(secret, adminToken, requireClientCert, log)
+}
+
+// agentHandler answers with the server key the request was authenticated for
+var agentHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	serverKey, _ := httpserver.AgentKey(r.Context())
+	w.Write([]byte(serverKey))
+})
+
+// agentRequest builds a request with an optional bearer token and client certificate
+func agentRequest(token, certKey string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/api/metrics", nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	if certKey != "" {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: certKey}}
+		r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+	return r
+}
+
+func TestAuthenticatorAgent(t *testing.T) {
+	auth := newAuthenticator(t, "secret", "", false)
+	other := newAuthenticator(t, "other secret", "", false)
+	known := func(ctx context.Context, serverKey string) bool { return serverKey != "srv_revoked" }
+	handler := auth.Agent(known, agentHandler)
+
+	tests := []struct {
+		name    string
+		token   string
+		certKey string
+		status  int
+		key     string
+	}{
+		{name: "valid token", token: auth.AgentToken("srv_a"), status: http.StatusOK, key: "srv_a"},
+		{name: "no credentials", status: http.StatusUnauthorized},
+		{name: "token of another secret", token: other.AgentToken("srv_a"), status: http.StatusUnauthorized},
+		{name: "token of another key", token: "srv_b." + auth.AgentToken("srv_a")[len("srv_a."):], status: http.StatusUnauthorized},
+		{name: "token without MAC", token: "srv_a", status: http.StatusUnauthorized},
+		{name: "revoked key", token: auth.AgentToken("srv_revoked"), status: http.StatusUnauthorized},
+		{name: "client certificate", certKey: "srv_a", status: http.StatusOK, key: "srv_a"},
+		{name: "certificate and token of one key", token: auth.AgentToken("srv_a"), certKey: "srv_a", status: http.StatusOK, key: "srv_a"},
+		{name: "certificate and token of two keys", token: auth.AgentToken("srv_b"), certKey: "srv_a", status: http.StatusUnauthorized},
+		{name: "certificate of a revoked key", certKey: "srv_revoked", status: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, agentRequest(tt.token, tt.certKey))
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d", w.Code, tt.status)
+			}
+			if tt.status == http.StatusOK && w.Body.String() != tt.key {
+				t.Errorf("authenticated as %q, want %q", w.Body.String(), tt.key)
+			}
+			if tt.status == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("rejection without a WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+func TestAuthenticatorRequireClientCert(t *testing.T) {
+	auth := newAuthenticator(t, "secret", "", true)
+	token := auth.AgentToken("srv_a")
+
+	w := httptest.NewRecorder()
+	auth.Agent(nil, agentHandler).ServeHTTP(w, agentRequest(token, ""))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("token without certificate: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	// Agents enroll for their first certificate with a token
+	w = httptest.NewRecorder()
+	auth.AgentEnrollment(nil, agentHandler).ServeHTTP(w, agentRequest(token, ""))
+	if w.Code != http.StatusOK || w.Body.String() != "srv_a" {
+		t.Errorf("enrollment with a token: status %d as %q, want %d as srv_a", w.Code, w.Body.String(), http.StatusOK)
+	}
+}
+
+func TestAuthenticatorUnconfigured(t *testing.T) {
+	auth := newAuthenticator(t, "", "", false)
+	if token := auth.AgentToken("srv_a"); token != "" {
+		t.Errorf("AgentToken without a secret = %q, want none", token)
+	}
+
+	for name, handler := range map[string]http.Handler{
+		"agent": auth.Agent(nil, agentHandler),
+		"admin": auth.Admin(agentHandler),
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, agentRequest("srv_a.00", ""))
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s endpoint without configuration: status %d, want %d", name, w.Code, http.StatusServiceUnavailable)
+		}
+	}
+}
+
+func TestAuthenticatorAdmin(t *testing.T) {
+	auth := newAuthenticator(t, "secret", "admin-token", false)
+	handler := auth.Admin(agentHandler)
+
+	tests := []struct {
+		header string
+		status int
+	}{
+		{header: "Bearer admin-token", status: http.StatusOK},
+		{header: "bearer admin-token", status: http.StatusOK},
+		{header: "Bearer admin-token2", status: http.StatusUnauthorized},
+		{header: "Bearer " + auth.AgentToken("srv_a"), status: http.StatusUnauthorized},
+		{header: "admin-token", status: http.StatusUnauthorized},
+		{header: "", status: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/admin", nil)
+		if tt.header != "" {
+			r.Header.Set("Authorization", tt.header)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("Authorization %q: status %d, want %d", tt.header, w.Code, tt.status)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"regexp"
+
+	"github.com/servereye/servereyebot/internal/logger"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// RequestIDHeader carries the ID of a request. An ID sent by the client is kept so that
+// its logs and ours can be correlated; otherwise one is generated.
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID bounds request IDs taken from clients, since they end up in logs
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// requestIDContextKey is the context key of the request ID
+type requestIDContextKey struct{}
+
+// ErrorResponse is the body of every failed API request. Status and Error repeat the
+// outcome in the shape agents released before the envelope understand.
+type ErrorResponse struct {
+	Code      errors.ErrorCode `json:"code"`
+	Message   string           `json:"message"`
+	RequestID string           `json:"request_id"`
+	Status    string           `json:"status"`
+	Error     string           `json:"error"`
+}
+
+// RequestID assigns every request an ID, stored in the request context and returned in
+// the X-Request-ID header
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDContextKey{}, id)))
+	})
+}
+
+// RequestIDOf returns the ID of the request a context belongs to
+func RequestIDOf(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// RequestLogger returns a logger tagging entries with the ID of a request
+func RequestLogger(log logger.Logger, r *http.Request) logger.Logger {
+	return log.WithField("request_id", RequestIDOf(r.Context()))
+}
+
+// WriteError writes the JSON error envelope of a failed request
+func WriteError(w http.ResponseWriter, r *http.Request, status int, code errors.ErrorCode, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(ErrorResponse{
+		Code:      code,
+		Message:   message,
+		RequestID: RequestIDOf(r.Context()),
+		Status:    "error",
+		Error:     message,
+	})
+}
+
+// MethodNotAllowed rejects a request with an unsupported method
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	WriteError(w, r, http.StatusMethodNotAllowed, errors.ErrCodeMethodNotAllowed, "method not allowed")
+}
+
+// ErrorCodeOf returns the code of an application error, or fallback for other errors
+func ErrorCodeOf(err error, fallback errors.ErrorCode) errors.ErrorCode {
+	if appErr, ok := err.(*errors.AppError); ok {
+		return appErr.Code
+	}
+	return fallback
+}
+
+// newRequestID generates a random request ID
+func newRequestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
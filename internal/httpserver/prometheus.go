@@ -0,0 +1,28 @@
+package httpserver
+
+import (
+	"io"
+	"net/http"
+)
+
+// PrometheusSource writes metrics in Prometheus text exposition format
+type PrometheusSource interface {
+	WritePrometheus(w io.Writer) error
+}
+
+// PrometheusHandler exposes metrics of several sources on a single endpoint
+func PrometheusHandler(sources ...PrometheusSource) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			MethodNotAllowed(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		for _, source := range sources {
+			if err := source.WritePrometheus(w); err != nil {
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,52 @@
+package httpserver
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/servereye/servereyebot/internal/ratelimit"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// RateLimit rejects requests over rule with 429 Too Many Requests. key extracts the
+// rate limited identity of a request, such as its client IP or agent key; requests
+// without one pass through. A nil limiter disables rate limiting.
+func RateLimit(limiter *ratelimit.Limiter, scope string, rule ratelimit.Rule, key func(r *http.Request) string, next http.Handler) http.Handler {
+	if limiter == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := key(r)
+		if id == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		decision := limiter.Allow(r.Context(), scope, id, rule)
+		if !decision.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(decision.RetryAfter.Seconds()))))
+			WriteError(w, r, http.StatusTooManyRequests, errors.ErrCodeRateLimit, "too many requests")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ClientIP returns the IP address of the peer of a request
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// AgentKeyOf returns the server key of the agent authenticated for a request
+func AgentKeyOf(r *http.Request) string {
+	serverKey, _ := AgentKey(r.Context())
+	return serverKey
+}
@@ -7,22 +7,32 @@ import (
 	"time"
 
 	"github.com/servereye/servereyebot/internal/logger"
+	"github.com/servereye/servereyebot/internal/tracing"
 )
 
 // Server represents HTTP server for health checks
 type HttpServer struct {
 	server *http.Server
+	mux    *http.ServeMux
 	logger logger.Logger
+	tracer *tracing.Tracer // nil unless spans are exported
+}
+
+// Timeouts represents HTTP server timeouts
+type Timeouts struct {
+	Read  time.Duration
+	Write time.Duration
+	Idle  time.Duration
 }
 
 // New creates a new HTTP server
-func New(port int, log logger.Logger) *HttpServer {
+func New(port int, timeouts Timeouts, log logger.Logger) *HttpServer {
 	mux := http.NewServeMux()
 
 	// Health check endpoint
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			MethodNotAllowed(w, r)
 			return
 		}
 
@@ -34,7 +44,7 @@ func New(port int, log logger.Logger) *HttpServer {
 	// Ready check endpoint
 	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			MethodNotAllowed(w, r)
 			return
 		}
 
@@ -43,26 +53,39 @@ func New(port int, log logger.Logger) *HttpServer {
 		_, _ = w.Write([]byte(`{"status":"ready","timestamp":"` + time.Now().UTC().Format(time.RFC3339) + `"}`))
 	})
 
-	server := &http.Server{
-		Addr:         fmt.Sprintf(":%d", port),
-		Handler:      mux,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		IdleTimeout:  60 * time.Second,
-	}
-
-	return &HttpServer{
-		server: server,
+	s := &HttpServer{
+		server: &http.Server{
+			Addr:         fmt.Sprintf(":%d", port),
+			ReadTimeout:  timeouts.Read,
+			WriteTimeout: timeouts.Write,
+			IdleTimeout:  timeouts.Idle,
+		},
+		mux:    mux,
 		logger: log,
 	}
+	s.server.Handler = RequestID(s.accessLog(mux))
+
+	return s
+}
+
+// Handle registers an additional handler for the given pattern
+func (s *HttpServer) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
 }
 
 // Start starts the HTTP server
 func (s *HttpServer) Start(ctx context.Context) error {
-	s.logger.Info("Starting HTTP server", "port", s.server.Addr)
+	s.logger.Info("Starting HTTP server", "port", s.server.Addr, "tls", s.server.TLSConfig != nil)
 
 	go func() {
-		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if s.server.TLSConfig != nil {
+			// Certificates are already loaded into the TLS configuration
+			err = s.server.ListenAndServeTLS("", "")
+		} else {
+			err = s.server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			s.logger.Error("HTTP server error", "error", err)
 		}
 	}()
@@ -74,8 +97,5 @@ func (s *HttpServer) Start(ctx context.Context) error {
 func (s *HttpServer) Stop(ctx context.Context) error {
 	s.logger.Info("Stopping HTTP server")
 
-	shutdownCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
-	defer cancel()
-
-	return s.server.Shutdown(shutdownCtx)
+	return s.server.Shutdown(ctx)
 }
@@ -0,0 +1,165 @@
+package httpserver
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+)
+
+// NewTLSConfig loads the certificate of the HTTP server. When clientCAFile is set,
+// agents may present client certificates issued by that CA; whether a certificate is
+// required is decided per endpoint by the Authenticator, so that agents can still
+// enroll with a bearer token.
+func NewTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server certificate: %w", err)
+	}
+
+	cfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if clientCAFile != "" {
+		data, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", clientCAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return cfg, nil
+}
+
+// UseTLS makes the server serve HTTPS with the given configuration
+func (s *HttpServer) UseTLS(cfg *tls.Config) {
+	s.server.TLSConfig = cfg
+}
+
+// CertIssuer signs agent client certificates with the client CA. The common name of
+// a certificate is the srv_ key of the agent, which binds it to the server.
+type CertIssuer struct {
+	ca       *x509.Certificate
+	caPEM    []byte
+	key      crypto.Signer
+	validity time.Duration
+}
+
+// LoadCertIssuer loads the client CA certificate and its private key
+func LoadCertIssuer(caFile, keyFile string, validity time.Duration) (*CertIssuer, error) {
+	caPEM, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA: %w", err)
+	}
+	block, _ := pem.Decode(caPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no certificate found in %s", caFile)
+	}
+	ca, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse client CA: %w", err)
+	}
+	if !ca.IsCA {
+		return nil, fmt.Errorf("certificate in %s is not a CA", caFile)
+	}
+
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA key: %w", err)
+	}
+	key, err := parsePrivateKey(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse client CA key: %w", err)
+	}
+
+	return &CertIssuer{
+		ca:       ca,
+		caPEM:    pem.EncodeToMemory(block),
+		key:      key,
+		validity: validity,
+	}, nil
+}
+
+// Issue signs a client certificate for the key in a PEM encoded certificate request.
+// The subject of the request is ignored: the certificate is issued to serverKey.
+// The certificate does not outlive the CA.
+func (i *CertIssuer) Issue(csrPEM []byte, serverKey string, now time.Time) ([]byte, time.Time, error) {
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, time.Time{}, fmt.Errorf("no certificate request found")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to parse certificate request: %w", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, time.Time{}, fmt.Errorf("invalid certificate request signature: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	notAfter := now.Add(i.validity)
+	if notAfter.After(i.ca.NotAfter) {
+		notAfter = i.ca.NotAfter
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: serverKey},
+		NotBefore:    now.Add(-time.Minute), // tolerate clock skew of agents
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, i.ca, csr.PublicKey, i.key)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to sign certificate: %w", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), notAfter, nil
+}
+
+// CACertificatePEM returns the PEM encoded client CA certificate
+func (i *CertIssuer) CACertificatePEM() []byte {
+	return i.caPEM
+}
+
+// parsePrivateKey parses a PEM encoded PKCS#8, PKCS#1 or EC private key
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+		return signer, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported private key format %q", block.Type)
+}
@@ -0,0 +1,244 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+)
+
+// Store persists batches of metric samples
+type Store interface {
+	InsertMetricSamples(ctx context.Context, samples []models.MetricSample) error
+}
+
+// Logger interface for ingestion writer
+type Logger interface {
+	Debug(msg string, fields ...interface{})
+	Info(msg string, fields ...interface{})
+	Warn(msg string, fields ...interface{})
+	Error(msg string, fields ...interface{})
+}
+
+// Config represents buffering limits of the writer
+type Config struct {
+	BatchSize     int           // samples per insert, a full batch is flushed immediately
+	FlushInterval time.Duration // maximum time a partial batch waits
+	MaxBuffer     int           // buffered samples kept before the oldest are dropped
+}
+
+// entry is a buffered sample with the time it was accepted
+type entry struct {
+	sample     models.MetricSample
+	enqueuedAt time.Time
+}
+
+// Stats represents the ingestion state of the writer
+type Stats struct {
+	Buffered int           `json:"buffered"`
+	Dropped  int64         `json:"dropped"`
+	Written  int64         `json:"written"`
+	Failed   int64         `json:"failed"` // batches the store rejected
+	Lag      time.Duration `json:"lag_ns"` // age of the oldest buffered sample
+}
+
+// Writer buffers metric samples and writes them to the store in batches.
+// When the store falls behind, the oldest buffered samples are dropped.
+type Writer struct {
+	store  Store
+	config Config
+	logger Logger
+
+	mu      sync.Mutex
+	buffer  []entry
+	dropped int64
+	written int64
+	failed  int64
+
+	flush  chan struct{}
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewWriter creates a new batching writer
+func NewWriter(store Store, config Config, logger Logger) *Writer {
+	if config.BatchSize <= 0 {
+		config.BatchSize = 500
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = 5 * time.Second
+	}
+	if config.MaxBuffer < config.BatchSize {
+		config.MaxBuffer = config.BatchSize
+	}
+
+	return &Writer{
+		store:  store,
+		config: config,
+		logger: logger,
+		flush:  make(chan struct{}, 1),
+	}
+}
+
+// Add buffers samples for writing without blocking the caller
+func (w *Writer) Add(samples ...models.MetricSample) {
+	if len(samples) == 0 {
+		return
+	}
+
+	now := time.Now()
+
+	w.mu.Lock()
+	for _, sample := range samples {
+		w.buffer = append(w.buffer, entry{sample: sample, enqueuedAt: now})
+	}
+	w.trimLocked()
+	full := len(w.buffer) >= w.config.BatchSize
+	w.mu.Unlock()
+
+	if full {
+		select {
+		case w.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Start starts the flush loop in background
+func (w *Writer) Start(ctx context.Context) {
+	ctx, w.cancel = context.WithCancel(ctx)
+
+	w.logger.Info("Starting metrics ingestion", "batch_size", w.config.BatchSize,
+		"flush_interval", w.config.FlushInterval.String(), "max_buffer", w.config.MaxBuffer)
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		ticker := time.NewTicker(w.config.FlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				w.Flush(ctx)
+			case <-w.flush:
+				w.Flush(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the flush loop and writes the remaining samples
+func (w *Writer) Stop(ctx context.Context) error {
+	if w.cancel != nil {
+		w.cancel()
+	}
+	w.wg.Wait()
+
+	if err := w.Flush(ctx); err != nil {
+		stats := w.Stats()
+		return fmt.Errorf("failed to flush %d buffered metric samples: %w", stats.Buffered, err)
+	}
+
+	w.logger.Info("Metrics ingestion stopped")
+	return nil
+}
+
+// Flush writes buffered samples in batches until the buffer is empty or the store fails.
+// A failed batch is put back in front of the buffer and retried on the next flush.
+func (w *Writer) Flush(ctx context.Context) error {
+	for {
+		w.mu.Lock()
+		n := len(w.buffer)
+		if n > w.config.BatchSize {
+			n = w.config.BatchSize
+		}
+		batch := make([]entry, n)
+		copy(batch, w.buffer[:n])
+		w.buffer = w.buffer[n:]
+		w.mu.Unlock()
+
+		if n == 0 {
+			return nil
+		}
+
+		samples := make([]models.MetricSample, n)
+		for i, e := range batch {
+			samples[i] = e.sample
+		}
+
+		if err := w.store.InsertMetricSamples(ctx, samples); err != nil {
+			w.mu.Lock()
+			w.failed++
+			w.buffer = append(batch, w.buffer...)
+			w.trimLocked()
+			w.mu.Unlock()
+
+			w.logger.Error("Failed to write metric samples", "error", err, "samples", n)
+			return err
+		}
+
+		w.mu.Lock()
+		w.written += int64(n)
+		w.mu.Unlock()
+
+		w.logger.Debug("Metric samples written", "samples", n)
+	}
+}
+
+// trimLocked drops the oldest samples exceeding the buffer limit, w.mu must be held
+func (w *Writer) trimLocked() {
+	if excess := len(w.buffer) - w.config.MaxBuffer; excess > 0 {
+		w.buffer = append([]entry(nil), w.buffer[excess:]...)
+		w.dropped += int64(excess)
+	}
+}
+
+// Stats returns the current ingestion state
+func (w *Writer) Stats() Stats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	stats := Stats{
+		Buffered: len(w.buffer),
+		Dropped:  w.dropped,
+		Written:  w.written,
+		Failed:   w.failed,
+	}
+	if len(w.buffer) > 0 {
+		stats.Lag = time.Since(w.buffer[0].enqueuedAt)
+	}
+	return stats
+}
+
+// WritePrometheus writes ingestion metrics in Prometheus text exposition format
+func (w *Writer) WritePrometheus(out io.Writer) error {
+	stats := w.Stats()
+
+	metrics := []struct {
+		name  string
+		help  string
+		kind  string
+		value float64
+	}{
+		{"servereyebot_ingest_buffered_samples", "Metric samples waiting to be written.", "gauge", float64(stats.Buffered)},
+		{"servereyebot_ingest_lag_seconds", "Age of the oldest buffered metric sample.", "gauge", stats.Lag.Seconds()},
+		{"servereyebot_ingest_written_samples_total", "Metric samples written to the database.", "counter", float64(stats.Written)},
+		{"servereyebot_ingest_dropped_samples_total", "Metric samples dropped because the buffer was full.", "counter", float64(stats.Dropped)},
+		{"servereyebot_ingest_failed_batches_total", "Batches the database failed to write.", "counter", float64(stats.Failed)},
+	}
+
+	for _, m := range metrics {
+		if _, err := fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", m.name, m.help, m.name, m.kind, m.name, m.value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,170 @@
+package ingest_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/ingest"
+	"github.com/servereye/servereyebot/internal/models"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, fields ...interface{}) {}
+func (nopLogger) Info(msg string, fields ...interface{})  {}
+func (nopLogger) Warn(msg string, fields ...interface{})  {}
+func (nopLogger) Error(msg string, fields ...interface{}) {}
+
+// sampleStore records the batches written to it, failing while down
+type sampleStore struct {
+	mu      sync.Mutex
+	batches [][]models.MetricSample
+	down    bool
+	written chan int
+}
+
+func (s *sampleStore) InsertMetricSamples(ctx context.Context, samples []models.MetricSample) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.down {
+		return fmt.Errorf("connection refused")
+	}
+	s.batches = append(s.batches, append([]models.MetricSample(nil), samples...))
+	if s.written != nil {
+		s.written <- len(samples)
+	}
+	return nil
+}
+
+func (s *sampleStore) setDown(down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.down = down
+}
+
+// values returns the values of the written samples in order
+func (s *sampleStore) values() []float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var values []float64
+	for _, batch := range s.batches {
+		for _, sample := range batch {
+			values = append(values, sample.Value)
+		}
+	}
+	return values
+}
+
+// samples creates samples with the values from from to to
+func samples(from, to int) []models.MetricSample {
+	var samples []models.MetricSample
+	for v := from; v <= to; v++ {
+		samples = append(samples, models.MetricSample{ServerKey: "srv_a", Name: "cpu_percent", Value: float64(v)})
+	}
+	return samples
+}
+
+func TestWriterFlushesInBatches(t *testing.T) {
+	store := &sampleStore{}
+	writer := ingest.NewWriter(store, ingest.Config{BatchSize: 3, FlushInterval: time.Hour, MaxBuffer: 10}, nopLogger{})
+
+	writer.Add(samples(1, 7)...)
+	if err := writer.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	if len(store.batches) != 3 || len(store.batches[0]) != 3 || len(store.batches[2]) != 1 {
+		t.Errorf("wrote %d batches, want batches of 3, 3 and 1", len(store.batches))
+	}
+	if got := fmt.Sprint(store.values()); got != "[1 2 3 4 5 6 7]" {
+		t.Errorf("wrote %s, want 1 to 7 in order", got)
+	}
+	if stats := writer.Stats(); stats.Buffered != 0 || stats.Written != 7 || stats.Lag != 0 {
+		t.Errorf("Stats = %+v, want 7 written and nothing buffered", stats)
+	}
+}
+
+func TestWriterRetriesFailedBatches(t *testing.T) {
+	store := &sampleStore{down: true}
+	writer := ingest.NewWriter(store, ingest.Config{BatchSize: 2, FlushInterval: time.Hour, MaxBuffer: 4}, nopLogger{})
+	ctx := context.Background()
+
+	writer.Add(samples(1, 3)...)
+	if err := writer.Flush(ctx); err == nil {
+		t.Fatal("Flush to a failing store succeeded")
+	}
+	if stats := writer.Stats(); stats.Buffered != 3 || stats.Failed != 1 || stats.Lag <= 0 {
+		t.Errorf("Stats after a failed flush = %+v, want 3 buffered and 1 failed batch", stats)
+	}
+
+	// Once the buffer is full the oldest samples are dropped
+	writer.Add(samples(4, 6)...)
+	if stats := writer.Stats(); stats.Buffered != 4 || stats.Dropped != 2 {
+		t.Errorf("Stats after overflow = %+v, want 4 buffered and 2 dropped", stats)
+	}
+
+	store.setDown(false)
+	if err := writer.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if got := fmt.Sprint(store.values()); got != "[3 4 5 6]" {
+		t.Errorf("wrote %s, want the newest samples 3 to 6 in order", got)
+	}
+
+	var out strings.Builder
+	if err := writer.WritePrometheus(&out); err != nil {
+		t.Fatalf("WritePrometheus: %v", err)
+	}
+	for _, line := range []string{
+		"servereyebot_ingest_written_samples_total 4\n",
+		"servereyebot_ingest_dropped_samples_total 2\n",
+		"servereyebot_ingest_failed_batches_total 1\n",
+		"servereyebot_ingest_buffered_samples 0\n",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("metrics miss %q:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestWriterStartAndStop(t *testing.T) {
+	store := &sampleStore{written: make(chan int, 8)}
+	writer := ingest.NewWriter(store, ingest.Config{BatchSize: 3, FlushInterval: time.Hour, MaxBuffer: 10}, nopLogger{})
+	writer.Start(context.Background())
+
+	// A full batch is written without waiting for the interval
+	writer.Add(samples(1, 3)...)
+	select {
+	case n := <-store.written:
+		if n != 3 {
+			t.Errorf("wrote a batch of %d, want 3", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a full batch was not written")
+	}
+
+	// Stop writes the partial batch left
+	writer.Add(samples(4, 5)...)
+	if err := writer.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if got := fmt.Sprint(store.values()); got != "[1 2 3 4 5]" {
+		t.Errorf("wrote %s, want 1 to 5", got)
+	}
+}
+
+func TestWriterStopReportsUnwrittenSamples(t *testing.T) {
+	store := &sampleStore{down: true}
+	writer := ingest.NewWriter(store, ingest.Config{BatchSize: 3, FlushInterval: time.Hour}, nopLogger{})
+	writer.Start(context.Background())
+	writer.Add(samples(1, 2)...)
+
+	err := writer.Stop(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "2 buffered") {
+		t.Errorf("Stop = %v, want an error naming the 2 buffered samples", err)
+	}
+}
@@ -161,6 +161,16 @@ func (l *LogrusLogger) WithError(err error) Logger {
 	}
 }
 
+// SetLevel changes the level of the logger and of all loggers derived from it
+func (l *LogrusLogger) SetLevel(level string) error {
+	parsed, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	l.logger.SetLevel(parsed)
+	return nil
+}
+
 // LoggerConfig represents logger configuration
 type LoggerConfig struct {
 	Level      string `yaml:"level"`
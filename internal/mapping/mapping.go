@@ -0,0 +1,61 @@
+// Package mapping converts between storage models, domain types and Telegram types,
+// so that handlers never copy fields or cast IDs by hand.
+//
+// A user has two identifiers that are easy to mix up: the database ID, which keys
+// user_servers and every other per-user table, and the Telegram ID, which addresses
+// messages. Domain users carry both; UserID returns the former.
+package mapping
+
+import (
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/telegram"
+	"github.com/servereye/servereyebot/pkg/domain"
+)
+
+// UserID returns the database ID of a user, as expected by repositories and services
+func UserID(user *domain.User) int64 {
+	return int64(user.ID)
+}
+
+// UserFromModel converts a stored user to a domain user
+func UserFromModel(user *models.User) *domain.User {
+	return &domain.User{
+		ID:         int(user.ID),
+		TelegramID: user.TelegramID,
+		Username:   user.Username,
+		FirstName:  user.FirstName,
+		LastName:   user.LastName,
+		IsAdmin:    user.IsAdmin,
+		CreatedAt:  user.CreatedAt,
+		LastSeen:   user.UpdatedAt,
+	}
+}
+
+// UserToModel converts a domain user to a user to store. The database ID is left
+// zero so that the database assigns it.
+func UserToModel(user *domain.User) *models.User {
+	return &models.User{
+		TelegramID: user.TelegramID,
+		Username:   user.Username,
+		FirstName:  user.FirstName,
+		LastName:   user.LastName,
+		IsAdmin:    user.IsAdmin,
+		IsActive:   true,
+	}
+}
+
+// UserFromTelegram converts the sender of an update to a domain user. Its database ID
+// is unknown and stays zero; load the user with GetUser to work with the database.
+func UserFromTelegram(from telegram.User, isAdmin bool, now time.Time) *domain.User {
+	return &domain.User{
+		TelegramID: from.ID,
+		Username:   from.Username,
+		FirstName:  from.FirstName,
+		LastName:   from.LastName,
+		IsAdmin:    isAdmin,
+		CreatedAt:  now,
+		LastSeen:   now,
+	}
+}
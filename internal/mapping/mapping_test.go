@@ -0,0 +1,122 @@
+package mapping_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/telegram"
+	"github.com/servereye/servereyebot/pkg/domain"
+)
+
+func TestUserID(t *testing.T) {
+	tests := []struct {
+		name string
+		user domain.User
+		want int64
+	}{
+		{name: "database ID", user: domain.User{ID: 7, TelegramID: 123456789}, want: 7},
+		{name: "unsaved user", user: domain.User{TelegramID: 123456789}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mapping.UserID(&tt.user); got != tt.want {
+				t.Errorf("UserID = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserFromModel(t *testing.T) {
+	created := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	updated := created.Add(48 * time.Hour)
+
+	tests := []struct {
+		name  string
+		model models.User
+		want  domain.User
+	}{
+		{
+			name: "admin",
+			model: models.User{ID: 7, TelegramID: 123456789, Username: "alice", FirstName: "Alice", LastName: "Smith",
+				IsAdmin: true, IsActive: true, CreatedAt: created, UpdatedAt: updated},
+			want: domain.User{ID: 7, TelegramID: 123456789, Username: "alice", FirstName: "Alice", LastName: "Smith",
+				IsAdmin: true, CreatedAt: created, LastSeen: updated},
+		},
+		{
+			name:  "user without a profile",
+			model: models.User{ID: 8, TelegramID: 987654321},
+			want:  domain.User{ID: 8, TelegramID: 987654321},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mapping.UserFromModel(&tt.model); !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("UserFromModel = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserToModel(t *testing.T) {
+	tests := []struct {
+		name string
+		user domain.User
+		want models.User
+	}{
+		{
+			name: "database ID is not copied",
+			user: domain.User{ID: 7, TelegramID: 123456789, Username: "alice", FirstName: "Alice", IsAdmin: true},
+			want: models.User{TelegramID: 123456789, Username: "alice", FirstName: "Alice", IsAdmin: true, IsActive: true},
+		},
+		{
+			name: "user from an update",
+			user: domain.User{TelegramID: 987654321, LastName: "Jones"},
+			want: models.User{TelegramID: 987654321, LastName: "Jones", IsActive: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mapping.UserToModel(&tt.user); !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("UserToModel = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserFromTelegram(t *testing.T) {
+	now := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		from    telegram.User
+		isAdmin bool
+		want    domain.User
+	}{
+		{
+			name:    "admin",
+			from:    telegram.User{ID: 123456789, Username: "alice", FirstName: "Alice", LastName: "Smith"},
+			isAdmin: true,
+			want: domain.User{TelegramID: 123456789, Username: "alice", FirstName: "Alice", LastName: "Smith",
+				IsAdmin: true, CreatedAt: now, LastSeen: now},
+		},
+		{
+			name: "Telegram ID is not taken as the database ID",
+			from: telegram.User{ID: 987654321},
+			want: domain.User{TelegramID: 987654321, CreatedAt: now, LastSeen: now},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mapping.UserFromTelegram(tt.from, tt.isAdmin, now); !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("UserFromTelegram = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package mapping
+
+import "github.com/servereye/servereyebot/internal/models"
+
+// ServerIDs returns the IDs of servers, such as srv_12313, in their order
+func ServerIDs(servers []models.ServerWithDetails) []string {
+	ids := make([]string, 0, len(servers))
+	for _, server := range servers {
+		ids = append(ids, server.ID)
+	}
+	return ids
+}
+
+// ServerByID returns the server with an ID, or nil when the user has no such server.
+// The returned server points into servers.
+func ServerByID(servers []models.ServerWithDetails, serverID string) *models.ServerWithDetails {
+	for i := range servers {
+		if servers[i].ID == serverID {
+			return &servers[i]
+		}
+	}
+	return nil
+}
+
+// ServerByIDOrName returns the server a user named in a command: the server with that ID,
+// or else the only server with that name. It returns nil when no server matches and when
+// several servers share the name, so that a command never picks one of them by chance.
+// The returned server points into servers.
+func ServerByIDOrName(servers []models.ServerWithDetails, idOrName string) *models.ServerWithDetails {
+	if server := ServerByID(servers, idOrName); server != nil {
+		return server
+	}
+
+	var found *models.ServerWithDetails
+	for i := range servers {
+		if servers[i].Name != idOrName {
+			continue
+		}
+		if found != nil {
+			return nil
+		}
+		found = &servers[i]
+	}
+	return found
+}
@@ -0,0 +1,108 @@
+package mapping_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/models"
+)
+
+// testServers returns servers of a user, two of them with the same name
+func testServers() []models.ServerWithDetails {
+	return []models.ServerWithDetails{
+		{Server: models.Server{ID: "srv_1", Name: "web"}, Role: "owner", ServerKey: "key-1"},
+		{Server: models.Server{ID: "srv_2", Name: "db"}, Role: "viewer", ServerKey: "key-2"},
+		{Server: models.Server{ID: "srv_3", Name: "web"}, Role: "owner", ServerKey: "key-3"},
+	}
+}
+
+func TestServerIDs(t *testing.T) {
+	tests := []struct {
+		name    string
+		servers []models.ServerWithDetails
+		want    []string
+	}{
+		{name: "in order", servers: testServers(), want: []string{"srv_1", "srv_2", "srv_3"}},
+		{name: "no servers", servers: nil, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mapping.ServerIDs(tt.servers); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ServerIDs = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServerByID(t *testing.T) {
+	servers := testServers()
+
+	tests := []struct {
+		name     string
+		serverID string
+		wantKey  string // empty when no server is found
+	}{
+		{name: "first server", serverID: "srv_1", wantKey: "key-1"},
+		{name: "last server", serverID: "srv_3", wantKey: "key-3"},
+		{name: "name is not an ID", serverID: "web"},
+		{name: "unknown server", serverID: "srv_4"},
+		{name: "empty ID", serverID: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mapping.ServerByID(servers, tt.serverID)
+			if tt.wantKey == "" {
+				if got != nil {
+					t.Errorf("ServerByID = %+v, want nil", *got)
+				}
+				return
+			}
+			if got == nil || got.ServerKey != tt.wantKey {
+				t.Fatalf("ServerByID = %+v, want the server with key %s", got, tt.wantKey)
+			}
+		})
+	}
+
+	// Callers update the server they found in place
+	mapping.ServerByID(servers, "srv_2").Name = "postgres"
+	if servers[1].Name != "postgres" {
+		t.Error("ServerByID returned a copy instead of the server in the slice")
+	}
+}
+
+func TestServerByIDOrName(t *testing.T) {
+	servers := append(testServers(),
+		models.ServerWithDetails{Server: models.Server{ID: "srv_4", Name: "srv_2"}, Role: "owner", ServerKey: "key-4"},
+	)
+
+	tests := []struct {
+		name     string
+		idOrName string
+		wantKey  string // empty when no server is found
+	}{
+		{name: "ID", idOrName: "srv_1", wantKey: "key-1"},
+		{name: "unique name", idOrName: "db", wantKey: "key-2"},
+		{name: "ID before a name equal to it", idOrName: "srv_2", wantKey: "key-2"},
+		{name: "name shared by servers", idOrName: "web"},
+		{name: "unknown server", idOrName: "mail"},
+		{name: "empty argument", idOrName: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mapping.ServerByIDOrName(servers, tt.idOrName)
+			if tt.wantKey == "" {
+				if got != nil {
+					t.Errorf("ServerByIDOrName = %+v, want nil", *got)
+				}
+				return
+			}
+			if got == nil || got.ServerKey != tt.wantKey {
+				t.Fatalf("ServerByIDOrName = %+v, want the server with key %s", got, tt.wantKey)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+// Package metricscache stores fetched server metrics by server key, in process memory or
+// in Redis so that bot instances share them and keep them across restarts.
+package metricscache
+
+import "time"
+
+// RedisOptions configures the connection of the Redis store
+type RedisOptions struct {
+	Addr         string
+	Password     string
+	Database     int
+	PoolSize     int
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	Prefix       string // prepended to all keys
+}
@@ -0,0 +1,76 @@
+package metricscache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/servereye/servereyebot/pkg/domain"
+)
+
+// memoryEntry is cached metrics of one server
+type memoryEntry struct {
+	metrics   *domain.MetricsCache
+	expiresAt time.Time
+}
+
+// MemoryStore keeps metrics in process memory. The cache is per bot instance and lost on
+// restart.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	now     func() time.Time
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string]memoryEntry),
+		now:     time.Now,
+	}
+}
+
+// Get retrieves the metrics of a server, or nil when none are cached
+func (s *MemoryStore) Get(ctx context.Context, serverKey string) (*domain.MetricsCache, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[serverKey]
+	if !ok {
+		return nil, nil
+	}
+	if !s.now().Before(entry.expiresAt) {
+		delete(s.entries, serverKey)
+		return nil, nil
+	}
+	return entry.metrics, nil
+}
+
+// Set caches the metrics of a server for ttl
+func (s *MemoryStore) Set(ctx context.Context, metrics *domain.MetricsCache, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[metrics.ServerKey] = memoryEntry{metrics: metrics, expiresAt: s.now().Add(ttl)}
+	return nil
+}
+
+// Delete drops the metrics of servers
+func (s *MemoryStore) Delete(ctx context.Context, serverKeys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range serverKeys {
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+// Clear drops all metrics
+func (s *MemoryStore) Clear(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = make(map[string]memoryEntry)
+	return nil
+}
@@ -0,0 +1,111 @@
+//go:build redis
+
+package metricscache
+
+// The Redis store is linked only into binaries built with -tags redis, so that default
+// builds do not carry the Redis client.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/servereye/servereyebot/pkg/domain"
+)
+
+// clearBatch is the number of keys scanned per round trip when clearing the cache
+const clearBatch = 100
+
+// RedisStore keeps metrics in Redis so that all bot instances share them
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore connects to Redis and creates a store
+func NewRedisStore(ctx context.Context, opts RedisOptions) (*RedisStore, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:         opts.Addr,
+		Password:     opts.Password,
+		DB:           opts.Database,
+		PoolSize:     opts.PoolSize,
+		DialTimeout:  opts.DialTimeout,
+		ReadTimeout:  opts.ReadTimeout,
+		WriteTimeout: opts.WriteTimeout,
+	})
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	return &RedisStore{client: client, prefix: opts.Prefix}, nil
+}
+
+// Get retrieves the metrics of a server, or nil when none are cached
+func (s *RedisStore) Get(ctx context.Context, serverKey string) (*domain.MetricsCache, error) {
+	data, err := s.client.Get(ctx, s.prefix+serverKey).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var metrics domain.MetricsCache
+	if err := json.Unmarshal(data, &metrics); err != nil {
+		return nil, fmt.Errorf("failed to decode cached metrics: %w", err)
+	}
+	return &metrics, nil
+}
+
+// Set caches the metrics of a server for ttl
+func (s *RedisStore) Set(ctx context.Context, metrics *domain.MetricsCache, ttl time.Duration) error {
+	data, err := json.Marshal(metrics)
+	if err != nil {
+		return fmt.Errorf("failed to encode metrics: %w", err)
+	}
+	return s.client.Set(ctx, s.prefix+metrics.ServerKey, data, ttl).Err()
+}
+
+// Delete drops the metrics of servers
+func (s *RedisStore) Delete(ctx context.Context, serverKeys ...string) error {
+	if len(serverKeys) == 0 {
+		return nil
+	}
+
+	keys := make([]string, len(serverKeys))
+	for i, key := range serverKeys {
+		keys[i] = s.prefix + key
+	}
+	return s.client.Del(ctx, keys...).Err()
+}
+
+// Clear drops all metrics under the prefix of the store
+func (s *RedisStore) Clear(ctx context.Context) error {
+	iter := s.client.Scan(ctx, 0, s.prefix+"*", clearBatch).Iterator()
+	var keys []string
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	return s.client.Del(ctx, keys...).Err()
+}
+
+// Ping checks that Redis is reachable
+func (s *RedisStore) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
+// Close closes the Redis connections
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,49 @@
+//go:build !redis
+
+package metricscache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/servereye/servereyebot/pkg/domain"
+)
+
+// RedisStore is unavailable in binaries built without the redis build tag
+type RedisStore struct{}
+
+// NewRedisStore fails because the binary is built without Redis support
+func NewRedisStore(ctx context.Context, opts RedisOptions) (*RedisStore, error) {
+	return nil, errors.New("redis metrics cache is not available (is the binary built with -tags redis?)")
+}
+
+// Get always fails
+func (s *RedisStore) Get(ctx context.Context, serverKey string) (*domain.MetricsCache, error) {
+	return nil, errors.New("redis metrics cache is not available")
+}
+
+// Set always fails
+func (s *RedisStore) Set(ctx context.Context, metrics *domain.MetricsCache, ttl time.Duration) error {
+	return errors.New("redis metrics cache is not available")
+}
+
+// Delete always fails
+func (s *RedisStore) Delete(ctx context.Context, serverKeys ...string) error {
+	return errors.New("redis metrics cache is not available")
+}
+
+// Clear always fails
+func (s *RedisStore) Clear(ctx context.Context) error {
+	return errors.New("redis metrics cache is not available")
+}
+
+// Ping always fails
+func (s *RedisStore) Ping(ctx context.Context) error {
+	return errors.New("redis metrics cache is not available")
+}
+
+// Close does nothing
+func (s *RedisStore) Close() error {
+	return nil
+}
@@ -0,0 +1,440 @@
+// Package migrate applies the versioned schema migrations of the migrations package.
+// Applied versions are recorded in the schema_migrations table.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+
+	"github.com/servereye/servereyebot/migrations"
+)
+
+// Migration represents a schema migration read from NNN_name.sql and NNN_name.down.sql
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string // empty when the migration cannot be reverted
+}
+
+// Status represents a migration and whether it is applied
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrator applies migrations to a database
+type Migrator struct {
+	db         *sql.DB
+	driver     string
+	migrations []Migration
+}
+
+// New creates a migrator for the embedded migrations of the driver
+func New(db *sql.DB, driver string) (*Migrator, error) {
+	files, err := migrations.For(driver)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := load(files)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, driver: driver, migrations: list}, nil
+}
+
+// Open connects to the database and creates a migrator for it. The caller closes the
+// returned database once done.
+func Open(driver, databaseURL string) (*Migrator, *sql.DB, error) {
+	db, err := sql.Open(driver, databaseURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	migrator, err := New(db, driver)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	return migrator, db, nil
+}
+
+// Latest returns the version of the newest known migration
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up applies all pending migrations in order and returns them. A database holding the
+// schema created by the docker-entrypoint-initdb.d mount of earlier releases but no
+// migration history has the migrations of that schema recorded as applied first. Any
+// other schema without history is refused: its version has to be recorded with Force.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(applied) == 0 {
+		legacy, err := m.hasTable(ctx, "users")
+		if err != nil {
+			return nil, err
+		}
+		if legacy {
+			if applied, err = m.adoptBaseline(ctx); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var done []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		if err := m.apply(ctx, migration, migration.Up, true); err != nil {
+			return done, err
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Down reverts the given number of most recently applied migrations and returns them
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if migration.Down == "" {
+			return done, fmt.Errorf("migration %03d_%s has no down script", migration.Version, migration.Name)
+		}
+		if err := m.apply(ctx, migration, migration.Down, false); err != nil {
+			return done, err
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Force records migrations up to version as applied and later ones as not applied,
+// without running them
+func (m *Migrator) Force(ctx context.Context, version int) error {
+	if version < 0 || version > m.Latest() {
+		return fmt.Errorf("unknown migration version %d (latest is %d)", version, m.Latest())
+	}
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version > "+m.placeholder(1), version); err != nil {
+		return fmt.Errorf("failed to reset migration history: %w", err)
+	}
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok || migration.Version > version {
+			continue
+		}
+		if err := m.record(ctx, tx, migration); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Status returns all known migrations with the time they were applied
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Migration: migration}
+		if at, ok := applied[migration.Version]; ok {
+			at := at
+			status.AppliedAt = &at
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// apply runs a script of a migration and updates the history in one transaction.
+// MySQL commits DDL implicitly, so a failed MySQL migration may be partially applied.
+func (m *Migrator) apply(ctx context.Context, migration Migration, script string, up bool) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := m.exec(ctx, tx, script); err != nil {
+		return fmt.Errorf("migration %03d_%s failed: %w", migration.Version, migration.Name, err)
+	}
+
+	if up {
+		err = m.record(ctx, tx, migration)
+	} else {
+		_, err = tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = "+m.placeholder(1), migration.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update migration history: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// exec runs a migration script. lib/pq runs scripts of several statements, including
+// function bodies, as one query; the MySQL driver needs them split.
+func (m *Migrator) exec(ctx context.Context, tx *sql.Tx, script string) error {
+	if m.driver != "mysql" {
+		_, err := tx.ExecContext(ctx, script)
+		return err
+	}
+
+	for _, statement := range splitStatements(script) {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// record marks a migration as applied
+func (m *Migrator) record(ctx context.Context, tx *sql.Tx, migration Migration) error {
+	_, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO schema_migrations (version, name, applied_at) VALUES (%s, %s, %s)",
+		m.placeholder(1), m.placeholder(2), m.placeholder(3)), migration.Version, migration.Name, time.Now().UTC())
+	return err
+}
+
+// applied returns the applied versions with the time they were applied
+func (m *Migrator) applied(ctx context.Context) (map[int]time.Time, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.db.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migration history: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, fmt.Errorf("failed to read migration history: %w", err)
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// adoptBaseline records the migrations of the initdb schema of earlier releases as
+// applied: 001_initial_schema, and 002_add_server_name_update when its function exists.
+// Schemas holding tables of later migrations are not guessed at.
+func (m *Migrator) adoptBaseline(ctx context.Context) (map[int]time.Time, error) {
+	version, err := m.baselineVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if version == 0 {
+		return nil, fmt.Errorf("database has a schema but no migration history, record the applied version with -migrate force -migrate-version N (latest is %d)", m.Latest())
+	}
+
+	if err := m.Force(ctx, version); err != nil {
+		return nil, fmt.Errorf("failed to record the baseline schema: %w", err)
+	}
+	return m.applied(ctx)
+}
+
+// baselineVersion returns the last migration of the initdb schema the database holds,
+// 0 when it holds another schema. Only PostgreSQL was set up by initdb.
+func (m *Migrator) baselineVersion(ctx context.Context) (int, error) {
+	if m.driver == "mysql" {
+		return 0, nil
+	}
+
+	// report_schedules comes with 003, the first migration past the initdb schema
+	later, err := m.hasTable(ctx, "report_schedules")
+	if err != nil || later {
+		return 0, err
+	}
+	for _, table := range []string{"servers", "user_servers"} {
+		ok, err := m.hasTable(ctx, table)
+		if err != nil || !ok {
+			return 0, err
+		}
+	}
+
+	var functions int
+	query := "SELECT COUNT(*) FROM information_schema.routines WHERE routine_schema = current_schema() AND routine_name = $1"
+	if err := m.db.QueryRowContext(ctx, query, "update_server_name").Scan(&functions); err != nil {
+		return 0, fmt.Errorf("failed to inspect schema: %w", err)
+	}
+	if functions > 0 {
+		return 2, nil
+	}
+	return 1, nil
+}
+
+// ensureTable creates the migration history table
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	query := `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`
+	if _, err := m.db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to create migration history table: %w", err)
+	}
+	return nil
+}
+
+// hasTable reports whether a table exists in the current schema
+func (m *Migrator) hasTable(ctx context.Context, table string) (bool, error) {
+	schema := "current_schema()"
+	if m.driver == "mysql" {
+		schema = "DATABASE()"
+	}
+
+	var count int
+	query := fmt.Sprintf("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = %s AND table_name = %s", schema, m.placeholder(1))
+	if err := m.db.QueryRowContext(ctx, query, table).Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to inspect schema: %w", err)
+	}
+	return count > 0, nil
+}
+
+// placeholder returns the n-th query parameter of the driver
+func (m *Migrator) placeholder(n int) string {
+	if m.driver == "mysql" {
+		return "?"
+	}
+	return "$" + strconv.Itoa(n)
+}
+
+// load reads and orders the migrations of a directory
+func load(files fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+
+		base := strings.TrimSuffix(entry.Name(), ".sql")
+		down := strings.HasSuffix(base, ".down")
+		base = strings.TrimSuffix(base, ".down")
+
+		prefix, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("invalid migration file name '%s', expected NNN_name.sql", entry.Name())
+		}
+
+		content, err := fs.ReadFile(files, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		migration, exists := byVersion[version]
+		if !exists {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		} else if migration.Name != name {
+			return nil, fmt.Errorf("migrations %03d_%s and %03d_%s share a version", version, migration.Name, version, name)
+		}
+
+		if down {
+			migration.Down = string(content)
+		} else {
+			migration.Up = string(content)
+		}
+	}
+
+	list := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %03d_%s has a down script only", migration.Version, migration.Name)
+		}
+		list = append(list, *migration)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, nil
+}
+
+// splitStatements splits a script at semicolons outside of quotes and comments
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	var quote byte
+
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '-' && i+1 < len(script) && script[i+1] == '-':
+			for i < len(script) && script[i] != '\n' {
+				i++
+			}
+			current.WriteByte('\n')
+			continue
+		case c == ';':
+			if statement := strings.TrimSpace(current.String()); statement != "" {
+				statements = append(statements, statement)
+			}
+			current.Reset()
+			continue
+		}
+		current.WriteByte(c)
+	}
+
+	if statement := strings.TrimSpace(current.String()); statement != "" {
+		statements = append(statements, statement)
+	}
+	return statements
+}
@@ -0,0 +1,313 @@
+package migrate_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/migrate"
+)
+
+// fakeSchema is a database answering the queries of the migrator. Scripts are recorded
+// rather than run.
+type fakeSchema struct {
+	mu        sync.Mutex
+	tables    map[string]bool
+	functions map[string]bool
+	history   map[int]time.Time
+	scripts   []string
+	fail      string // scripts containing it fail
+}
+
+// fakeDriver opens connections to the schema registered under a name
+type fakeDriver struct {
+	mu      sync.Mutex
+	schemas map[string]*fakeSchema
+}
+
+var schemas = &fakeDriver{schemas: make(map[string]*fakeSchema)}
+
+func init() {
+	sql.Register("fakeschema", schemas)
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return &fakeConn{schema: d.schemas[name]}, nil
+}
+
+// fakeConn runs statements on a fake schema. Transactions are not isolated.
+type fakeConn struct {
+	schema *fakeSchema
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("prepared statements are not supported")
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) { return c, nil }
+
+func (c *fakeConn) Commit() error { return nil }
+
+func (c *fakeConn) Rollback() error { return nil }
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	s := c.schema
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(query, "CREATE TABLE IF NOT EXISTS schema_migrations"):
+	case strings.HasPrefix(query, "INSERT INTO schema_migrations"):
+		s.history[int(args[0].Value.(int64))] = args[2].Value.(time.Time)
+	case strings.HasPrefix(query, "DELETE FROM schema_migrations WHERE version >"):
+		for version := range s.history {
+			if int64(version) > args[0].Value.(int64) {
+				delete(s.history, version)
+			}
+		}
+	case strings.HasPrefix(query, "DELETE FROM schema_migrations WHERE version ="):
+		delete(s.history, int(args[0].Value.(int64)))
+	default:
+		if s.fail != "" && strings.Contains(query, s.fail) {
+			return nil, fmt.Errorf("syntax error")
+		}
+		s.scripts = append(s.scripts, query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	s := c.schema
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(query, "SELECT version, applied_at FROM schema_migrations"):
+		rows := &fakeRows{columns: []string{"version", "applied_at"}}
+		for version, at := range s.history {
+			rows.values = append(rows.values, []driver.Value{int64(version), at})
+		}
+		return rows, nil
+	case strings.Contains(query, "information_schema.tables"):
+		return countRows(s.tables[args[0].Value.(string)]), nil
+	case strings.Contains(query, "information_schema.routines"):
+		return countRows(s.functions[args[0].Value.(string)]), nil
+	}
+	return nil, fmt.Errorf("unexpected query %q", query)
+}
+
+// fakeRows are the rows of a query result
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func countRows(exists bool) *fakeRows {
+	count := int64(0)
+	if exists {
+		count = 1
+	}
+	return &fakeRows{columns: []string{"count"}, values: [][]driver.Value{{count}}}
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// newMigrator creates a migrator of the PostgreSQL migrations on a fake schema holding
+// the given tables and functions
+func newMigrator(t *testing.T, tables, functions []string) (*migrate.Migrator, *fakeSchema) {
+	t.Helper()
+
+	schema := &fakeSchema{tables: make(map[string]bool), functions: make(map[string]bool), history: make(map[int]time.Time)}
+	for _, table := range tables {
+		schema.tables[table] = true
+	}
+	for _, function := range functions {
+		schema.functions[function] = true
+	}
+
+	schemas.mu.Lock()
+	schemas.schemas[t.Name()] = schema
+	schemas.mu.Unlock()
+
+	db, err := sql.Open("fakeschema", t.Name())
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migrate.New(db, "postgres")
+	if err != nil {
+		t.Fatalf("migrate.New: %v", err)
+	}
+	return migrator, schema
+}
+
+// versions returns the applied versions of a schema in order
+func (s *fakeSchema) versions() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	versions := make([]int, 0, len(s.history))
+	for version := range s.history {
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+// upTo returns the versions from from to n
+func upTo(from, n int) []int {
+	var versions []int
+	for v := from; v <= n; v++ {
+		versions = append(versions, v)
+	}
+	return versions
+}
+
+func equalVersions(a, b []int) bool {
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+func migrationVersions(migrations []migrate.Migration) []int {
+	versions := make([]int, len(migrations))
+	for i, migration := range migrations {
+		versions[i] = migration.Version
+	}
+	return versions
+}
+
+func TestMigratorUpDownForce(t *testing.T) {
+	migrator, schema := newMigrator(t, nil, nil)
+	ctx := context.Background()
+	latest := migrator.Latest()
+	if latest < 3 {
+		t.Fatalf("Latest = %d, want at least 3 migrations", latest)
+	}
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if got := migrationVersions(applied); !equalVersions(got, upTo(1, latest)) {
+		t.Fatalf("Up applied %v, want 1 to %d in order", got, latest)
+	}
+	if !strings.Contains(schema.scripts[0], "CREATE TABLE IF NOT EXISTS users") || len(schema.scripts) != latest {
+		t.Errorf("ran %d scripts starting with %.40q, want the %d up scripts", len(schema.scripts), schema.scripts[0], latest)
+	}
+
+	if applied, err := migrator.Up(ctx); err != nil || len(applied) != 0 {
+		t.Errorf("second Up = %v, %v, want nothing applied", migrationVersions(applied), err)
+	}
+
+	reverted, err := migrator.Down(ctx, 2)
+	if err != nil {
+		t.Fatalf("Down: %v", err)
+	}
+	if got := migrationVersions(reverted); !equalVersions(got, []int{latest, latest - 1}) {
+		t.Errorf("Down reverted %v, want %d and %d", got, latest, latest-1)
+	}
+	if got := schema.versions(); !equalVersions(got, upTo(1, latest-2)) {
+		t.Errorf("history after Down %v, want 1 to %d", got, latest-2)
+	}
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	for _, status := range statuses {
+		if (status.AppliedAt != nil) != (status.Version <= latest-2) {
+			t.Errorf("status of %03d_%s: applied at %v", status.Version, status.Name, status.AppliedAt)
+		}
+	}
+
+	if err := migrator.Force(ctx, 3); err != nil {
+		t.Fatalf("Force: %v", err)
+	}
+	if got := schema.versions(); !equalVersions(got, upTo(1, 3)) {
+		t.Errorf("history after Force(3) %v, want 1 to 3", got)
+	}
+	if err := migrator.Force(ctx, latest+1); err == nil {
+		t.Error("Force of an unknown version succeeded")
+	}
+}
+
+func TestMigratorUpFailure(t *testing.T) {
+	migrator, schema := newMigrator(t, nil, nil)
+	schema.fail = "CREATE TABLE IF NOT EXISTS report_schedules"
+
+	applied, err := migrator.Up(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "003_report_schedules") {
+		t.Fatalf("Up = %v, want migration 003 to fail", err)
+	}
+	if got := migrationVersions(applied); !equalVersions(got, []int{1, 2}) {
+		t.Errorf("Up applied %v before failing, want 1 and 2", got)
+	}
+	if got := schema.versions(); !equalVersions(got, []int{1, 2}) {
+		t.Errorf("history %v, want 1 and 2", got)
+	}
+}
+
+func TestMigratorAdoptsInitdbSchema(t *testing.T) {
+	tests := []struct {
+		name      string
+		tables    []string
+		functions []string
+		baseline  int // 0 when Up must refuse the schema
+	}{
+		{name: "both initdb migrations", tables: []string{"users", "servers", "user_servers"}, functions: []string{"update_server_name"}, baseline: 2},
+		{name: "initial schema only", tables: []string{"users", "servers", "user_servers"}, baseline: 1},
+		{name: "schema of later migrations", tables: []string{"users", "servers", "user_servers", "report_schedules"}, functions: []string{"update_server_name"}},
+		{name: "foreign users table", tables: []string{"users"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrator, schema := newMigrator(t, tt.tables, tt.functions)
+
+			applied, err := migrator.Up(context.Background())
+			if tt.baseline == 0 {
+				if err == nil || !strings.Contains(err.Error(), "-migrate force") {
+					t.Errorf("Up = %v, want a refusal naming -migrate force", err)
+				}
+				if len(schema.scripts) != 0 || len(schema.versions()) != 0 {
+					t.Errorf("refused schema ran %d scripts and recorded %v", len(schema.scripts), schema.versions())
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Up: %v", err)
+			}
+			if got := migrationVersions(applied); !equalVersions(got, upTo(tt.baseline+1, migrator.Latest())) {
+				t.Errorf("Up applied %v, want %d to %d", got, tt.baseline+1, migrator.Latest())
+			}
+			if got := schema.versions(); !equalVersions(got, upTo(1, migrator.Latest())) {
+				t.Errorf("history %v, want all migrations", got)
+			}
+			if strings.Contains(schema.scripts[0], "CREATE TABLE IF NOT EXISTS users") {
+				t.Error("Up ran the initial schema again")
+			}
+		})
+	}
+}
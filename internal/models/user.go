@@ -17,6 +17,27 @@ type User struct {
 	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// UserSummary represents a user listed to admins with the number of their servers
+type UserSummary struct {
+	User
+	Servers int `json:"servers" db:"servers"`
+}
+
+// UserStats represents registration and activity counts of the users of the bot. A user
+// is seen when their profile is written, which happens at most once per user cache TTL.
+type UserStats struct {
+	Total     int `json:"total"`
+	Active    int `json:"active"`
+	Admins    int `json:"admins"`
+	Deleted   int `json:"deleted"` // deactivated with /forgetme
+	NewDay    int `json:"new_day"`
+	NewWeek   int `json:"new_week"`
+	NewMonth  int `json:"new_month"`
+	SeenDay   int `json:"seen_day"`
+	SeenWeek  int `json:"seen_week"`
+	SeenMonth int `json:"seen_month"`
+}
+
 // Server represents a server in the database
 type Server struct {
 	ID          string    `json:"id" db:"id"`
@@ -42,3 +63,316 @@ type ServerWithDetails struct {
 	AddedAt   time.Time `json:"added_at"`
 	ServerKey string    `json:"server_key"` // API key for metrics
 }
+
+// ReportSchedule represents a user's scheduled summary report
+type ReportSchedule struct {
+	ID             int64      `json:"id" db:"id"`
+	UserID         int64      `json:"user_id" db:"user_id"`
+	TelegramID     int64      `json:"telegram_id" db:"telegram_id"`
+	Timezone       string     `json:"timezone" db:"timezone"`
+	Frequency      string     `json:"frequency" db:"frequency"`
+	Weekday        int        `json:"weekday" db:"weekday"`
+	Hour           int        `json:"hour" db:"hour"`
+	Minute         int        `json:"minute" db:"minute"`
+	Sections       string     `json:"sections" db:"sections"`         // comma-separated report sections, empty for the default
+	ServerOrder    string     `json:"server_order" db:"server_order"` // comma-separated server IDs listed first
+	LastSentAt     *time.Time `json:"last_sent_at" db:"last_sent_at"`
+	FailedAttempts int        `json:"failed_attempts" db:"failed_attempts"` // failed deliveries of the due report
+	RetryAt        *time.Time `json:"retry_at,omitempty" db:"retry_at"`     // when the due report is retried after a failure
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+}
+
+// CommandHistory represents an audited action executed against a server
+type CommandHistory struct {
+	ID         int64     `json:"id" db:"id"`
+	UserID     int64     `json:"user_id" db:"user_id"`
+	TelegramID int64     `json:"telegram_id" db:"telegram_id"`
+	ServerID   string    `json:"server_id" db:"server_id"`
+	Command    string    `json:"command" db:"command"`
+	Payload    string    `json:"payload" db:"payload"`
+	Envelope   string    `json:"envelope" db:"envelope"` // protocol message sent to the agent, if any
+	Response   string    `json:"response" db:"response"`
+	Success    bool      `json:"success" db:"success"`
+	Error      string    `json:"error" db:"error"`
+	DurationMs int64     `json:"duration_ms" db:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+// MetricSample represents a single historical value of a server metric
+type MetricSample struct {
+	ServerKey   string    `json:"server_key" db:"server_key"`
+	Name        string    `json:"name" db:"name"` // e.g. cpu_percent, load_1m
+	Value       float64   `json:"value" db:"value"`
+	CollectedAt time.Time `json:"collected_at" db:"collected_at"`
+}
+
+// MetricHour represents aggregated samples of a metric within one hour
+type MetricHour struct {
+	Hour    time.Time `json:"hour" db:"hour"` // start of the hour
+	Avg     float64   `json:"avg" db:"avg"`
+	Max     float64   `json:"max" db:"max"`
+	Samples int       `json:"samples" db:"samples"`
+}
+
+// MetricSummary summarizes the samples of a metric collected within a period
+type MetricSummary struct {
+	Avg     float64 `json:"avg" db:"avg"`
+	First   float64 `json:"first" db:"first"` // oldest sample of the period
+	Last    float64 `json:"last" db:"last"`   // latest sample of the period
+	Samples int     `json:"samples" db:"samples"`
+}
+
+// AlertLogEntry records an alert a user was sent about a server
+type AlertLogEntry struct {
+	TelegramID int64     `json:"telegram_id" db:"telegram_id"`
+	ServerID   string    `json:"server_id" db:"server_id"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+// CustomCommand represents a named bot command running an agent script on a server
+type CustomCommand struct {
+	ID           int64     `json:"id" db:"id"`
+	ServerID     string    `json:"server_id" db:"server_id"`
+	Name         string    `json:"name" db:"name"`                   // bot command without the slash, e.g. deploy
+	Script       string    `json:"script" db:"script"`               // absolute script path on the server
+	RequiredRole string    `json:"required_role" db:"required_role"` // minimum server role: viewer, admin, owner
+	CreatedBy    int64     `json:"created_by" db:"created_by"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+// PairingCode represents a one-time code linking a newly started agent to a user
+type PairingCode struct {
+	ID         int64      `json:"id" db:"id"`
+	Code       string     `json:"code" db:"code"` // 6 digits
+	UserID     int64      `json:"user_id" db:"user_id"`
+	TelegramID int64      `json:"telegram_id" db:"telegram_id"`
+	ServerID   string     `json:"server_id,omitempty" db:"server_id"` // set once the code is used
+	ExpiresAt  time.Time  `json:"expires_at" db:"expires_at"`
+	UsedAt     *time.Time `json:"used_at,omitempty" db:"used_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+}
+
+// AccountLinkCode represents a one-time code linking a ServerEye-Web account to a user
+type AccountLinkCode struct {
+	ID         int64      `json:"id" db:"id"`
+	Code       string     `json:"code" db:"code"` // 8 characters
+	UserID     int64      `json:"user_id" db:"user_id"`
+	TelegramID int64      `json:"telegram_id" db:"telegram_id"`
+	WebUserID  string     `json:"web_user_id,omitempty" db:"web_user_id"` // set once the code is used
+	ExpiresAt  time.Time  `json:"expires_at" db:"expires_at"`
+	UsedAt     *time.Time `json:"used_at,omitempty" db:"used_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+}
+
+// LinkedAccount represents a ServerEye-Web account sharing the identity of a user
+type LinkedAccount struct {
+	ID         int64      `json:"id" db:"id"`
+	UserID     int64      `json:"user_id" db:"user_id"`
+	TelegramID int64      `json:"telegram_id" db:"telegram_id"`
+	WebUserID  string     `json:"web_user_id" db:"web_user_id"`
+	TokenHash  string     `json:"-" db:"token_hash"` // hex SHA-256 of the token issued to the web app
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+}
+
+// ServerKey represents the key versions of a server agent
+type ServerKey struct {
+	ServerID          string     `json:"server_id" db:"server_id"`     // stable server ID, e.g. srv_12313
+	Key               string     `json:"-" db:"server_key"`            // key the agent authenticates with
+	Version           int        `json:"key_version" db:"key_version"` // incremented on every completed rotation
+	PendingKey        string     `json:"-" db:"pending_key"`           // issued, not yet picked up by the agent
+	PreviousKey       string     `json:"-" db:"previous_key"`          // replaced key, valid until PreviousExpiresAt
+	PreviousExpiresAt *time.Time `json:"previous_key_expires_at,omitempty" db:"previous_key_expires_at"`
+	RotatedBy         int64      `json:"key_rotated_by,omitempty" db:"key_rotated_by"` // Telegram ID of the user who requested the rotation
+}
+
+// Tag represents metadata of a tag grouping servers that share infrastructure
+type Tag struct {
+	Name              string `json:"name" db:"name"`
+	Description       string `json:"description" db:"description"`                               // e.g. shared database db-1
+	CorrelationWindow int    `json:"correlation_window_seconds" db:"correlation_window_seconds"` // seconds, 0 for the default window
+}
+
+// ServerTag represents a tag assigned to a server
+type ServerTag struct {
+	ServerID string `json:"server_id" db:"server_id"`
+	Tag      string `json:"tag" db:"tag"`
+}
+
+// AlertTarget represents a server and one of the users notified about its alerts
+type AlertTarget struct {
+	ServerID   string `json:"server_id" db:"server_id"`
+	Name       string `json:"name" db:"name"`
+	ServerKey  string `json:"server_key" db:"server_key"`
+	TelegramID int64  `json:"telegram_id" db:"telegram_id"`
+}
+
+// NotificationChannel represents an external channel receiving alerts and reports of a user
+type NotificationChannel struct {
+	ID        int64     `json:"id" db:"id"`
+	UserID    int64     `json:"user_id" db:"user_id"`
+	ServerID  string    `json:"server_id,omitempty" db:"server_id"` // empty for all servers of the user
+	Kind      string    `json:"kind" db:"kind"`                     // slack, discord, email, webhook
+	Target    string    `json:"target" db:"target"`                 // webhook URL or email address
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// RestartPolicy represents a limit of container restarts enforced by the agent of a server
+type RestartPolicy struct {
+	ServerID    string     `json:"server_id" db:"server_id"`
+	Container   string     `json:"container" db:"container"`
+	MaxRestarts int        `json:"max_restarts" db:"max_restarts"` // exits per hour before auto-restart stops
+	CreatedBy   int64      `json:"created_by" db:"created_by"`     // Telegram ID of the owner to alert
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	TrippedAt   *time.Time `json:"tripped_at,omitempty" db:"tripped_at"` // when the agent last stopped restarting
+}
+
+// ProcessWatch represents a process that must be running on a server
+type ProcessWatch struct {
+	ServerID       string    `json:"server_id" db:"server_id"`
+	Name           string    `json:"name" db:"name"`                                 // process name as reported by the agent
+	RestartCommand string    `json:"restart_command,omitempty" db:"restart_command"` // allow-listed command offered as a restart button
+	CreatedBy      int64     `json:"created_by" db:"created_by"`                     // Telegram ID of the owner who added the watch
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
+
+// LogWatch represents a log file the agent of a server tails for lines matching a pattern
+type LogWatch struct {
+	ID        int64     `json:"id" db:"id"`
+	ServerID  string    `json:"server_id" db:"server_id"`
+	Path      string    `json:"path" db:"path"`             // absolute path of the log file
+	Pattern   string    `json:"pattern" db:"pattern"`       // regular expression matched against new lines
+	CreatedBy int64     `json:"created_by" db:"created_by"` // Telegram ID of the owner to alert
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// FirewallBlock represents an address blocked in the firewall of a server from the bot
+type FirewallBlock struct {
+	ID        int64     `json:"id" db:"id"`
+	ServerID  string    `json:"server_id" db:"server_id"`
+	Address   string    `json:"address" db:"address"`       // IP address or CIDR network
+	CreatedBy int64     `json:"created_by" db:"created_by"` // Telegram ID of the owner who blocked it
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// PassiveCheck represents the last result of a check submitted by an external monitoring system
+type PassiveCheck struct {
+	ServerID  string    `json:"server_id" db:"server_id"`
+	Service   string    `json:"service" db:"service"` // HOST for host checks
+	Host      string    `json:"host" db:"host"`
+	State     int       `json:"state" db:"state"` // Nagios plugin exit code
+	Output    string    `json:"output" db:"output"`
+	CheckedAt time.Time `json:"checked_at" db:"checked_at"`
+	ChangedAt time.Time `json:"changed_at" db:"changed_at"` // when the check entered its state
+}
+
+// DeploymentWindow represents a recurring weekly window of planned work on a server,
+// during which its alerts are held for a summary
+type DeploymentWindow struct {
+	ID          int64     `json:"id" db:"id"`
+	ServerID    string    `json:"server_id" db:"server_id"`
+	Weekday     int       `json:"weekday" db:"weekday"`           // 0 is Sunday
+	StartMinute int       `json:"start_minute" db:"start_minute"` // minutes after midnight
+	EndMinute   int       `json:"end_minute" db:"end_minute"`     // not after the start for windows past midnight
+	Timezone    string    `json:"timezone" db:"timezone"`
+	CreatedBy   int64     `json:"created_by" db:"created_by"` // Telegram ID
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// MaintenanceWindow represents one-off maintenance of a server
+type MaintenanceWindow struct {
+	ID        int64     `json:"id" db:"id"`
+	ServerID  string    `json:"server_id" db:"server_id"`
+	StartsAt  time.Time `json:"starts_at" db:"starts_at"`
+	EndsAt    time.Time `json:"ends_at" db:"ends_at"`
+	CreatedBy int64     `json:"created_by" db:"created_by"` // Telegram ID
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// AlertRoute represents a chat the alerts of a category about a user's servers are sent
+// to instead of the private chat of the user
+type AlertRoute struct {
+	ID         int64     `json:"id" db:"id"`
+	TelegramID int64     `json:"telegram_id" db:"telegram_id"`
+	ServerID   string    `json:"server_id" db:"server_id"` // empty for all servers of the user
+	Category   string    `json:"category" db:"category"`   // "all" for every category
+	ChatID     int64     `json:"chat_id" db:"chat_id"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+// UptimeCheck represents an HTTP or TCP endpoint probed on schedule by the bot or by the
+// agent of a server
+type UptimeCheck struct {
+	ID              int64      `json:"id" db:"id"`
+	TelegramID      int64      `json:"telegram_id" db:"telegram_id"` // user who added the check and gets its alerts
+	ServerID        string     `json:"server_id" db:"server_id"`     // agent running the check, empty when the bot runs it
+	Kind            string     `json:"kind" db:"kind"`               // http or tcp
+	Target          string     `json:"target" db:"target"`
+	IntervalSeconds int        `json:"interval_seconds" db:"interval_seconds"`
+	Up              *bool      `json:"up,omitempty" db:"up"` // nil until the first result
+	CheckedAt       *time.Time `json:"checked_at,omitempty" db:"checked_at"`
+	ChangedAt       *time.Time `json:"changed_at,omitempty" db:"changed_at"` // when the check entered its state
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+}
+
+// UptimeResult represents a single probe of an uptime check
+type UptimeResult struct {
+	ID         int64     `json:"id" db:"id"`
+	CheckID    int64     `json:"check_id" db:"check_id"`
+	Up         bool      `json:"up" db:"up"`
+	LatencyMs  int64     `json:"latency_ms" db:"latency_ms"`
+	StatusCode int       `json:"status_code" db:"status_code"` // HTTP status, 0 for TCP checks
+	Error      string    `json:"error" db:"error"`
+	CheckedAt  time.Time `json:"checked_at" db:"checked_at"`
+}
+
+// ServerGuest represents time-boxed viewer access of a user to a server
+type ServerGuest struct {
+	ID         int64     `json:"id" db:"id"`
+	ServerID   string    `json:"server_id" db:"server_id"`
+	ServerName string    `json:"server_name" db:"server_name"`
+	UserID     int64     `json:"user_id" db:"user_id"`
+	TelegramID int64     `json:"telegram_id" db:"telegram_id"` // of the guest
+	Username   string    `json:"username" db:"username"`       // of the guest, may be empty
+	GrantedBy  int64     `json:"granted_by" db:"granted_by"`   // Telegram ID of the owner who granted access
+	ExpiresAt  time.Time `json:"expires_at" db:"expires_at"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+// ChatServer represents a server attached to a group chat
+type ChatServer struct {
+	ChatID    int64     `json:"chat_id" db:"chat_id"`
+	ServerID  string    `json:"server_id" db:"server_id"`
+	BoundBy   int64     `json:"bound_by" db:"bound_by"` // user who attached the server
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// UserSettings represents the preferences of a user
+type UserSettings struct {
+	UserID          int64     `json:"user_id" db:"user_id"`
+	DefaultServerID string    `json:"default_server_id" db:"default_server_id"` // empty when unset
+	Language        string    `json:"language" db:"language"`                   // empty for the deployment default
+	CompactMetrics  bool      `json:"compact_metrics" db:"compact_metrics"`
+	QuietFrom       *int      `json:"quiet_from,omitempty" db:"quiet_from"` // hour alerts turn silent, nil when off
+	QuietTo         *int      `json:"quiet_to,omitempty" db:"quiet_to"`     // hour alerts sound again
+	NotifyAlerts    bool      `json:"notify_alerts" db:"notify_alerts"`     // publish alerts to notification channels
+	NotifyReports   bool      `json:"notify_reports" db:"notify_reports"`   // publish reports to notification channels
+	Timezone        string    `json:"timezone" db:"timezone"`               // of the user, read only
+	UpdatedAt       time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// OutboxMessage represents an alert persisted before it is sent to Telegram
+type OutboxMessage struct {
+	ID            int64      `json:"id" db:"id"`
+	ChatID        int64      `json:"chat_id" db:"chat_id"`
+	TelegramID    int64      `json:"telegram_id" db:"telegram_id"` // user the alert is for, reached when the chat is not, 0 for group chat alerts
+	Text          string     `json:"text" db:"text"`
+	Keyboard      string     `json:"keyboard" db:"keyboard"` // JSON inline keyboard, empty for none
+	Quiet         bool       `json:"quiet" db:"quiet"`       // sent silently to the private chat of the user
+	Attempts      int        `json:"attempts" db:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" db:"next_attempt_at"`
+	LastError     string     `json:"last_error" db:"last_error"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty" db:"delivered_at"`
+	FailedAt      *time.Time `json:"failed_at,omitempty" db:"failed_at"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,77 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+)
+
+// SMTPConfig represents the mail server sending email notifications
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// emailSender sends plain text email over SMTP
+type emailSender struct {
+	cfg SMTPConfig
+}
+
+func (s *emailSender) Validate(target string) error {
+	addr, err := mail.ParseAddress(target)
+	if err != nil || addr.Address != target {
+		return fmt.Errorf("invalid email address")
+	}
+	return nil
+}
+
+func (s *emailSender) Send(ctx context.Context, target string, msg Message) error {
+	subject := msg.Title
+	if subject == "" {
+		subject = firstLine(msg.Text)
+	}
+
+	var body strings.Builder
+	body.WriteString("From: " + s.cfg.From + "\r\n")
+	body.WriteString("To: " + target + "\r\n")
+	body.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	body.WriteString("MIME-Version: 1.0\r\n")
+	body.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	body.WriteString("\r\n")
+	body.WriteString(strings.ReplaceAll(msg.Text, "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if s.cfg.Username != "" {
+		auth = smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)
+	}
+
+	// net/smtp does not take a context, so the send runs until the server answers
+	done := make(chan error, 1)
+	go func() {
+		addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+		done <- smtp.SendMail(addr, auth, s.cfg.From, []string{target}, []byte(body.String()))
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// firstLine returns the first line of a text
+func firstLine(text string) string {
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		return text[:i]
+	}
+	return text
+}
@@ -0,0 +1,155 @@
+// Package notify delivers alerts and reports to channels besides Telegram:
+// Slack and Discord incoming webhooks, email over SMTP and generic JSON webhooks.
+package notify
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Channel kinds
+const (
+	KindSlack   = "slack"
+	KindDiscord = "discord"
+	KindEmail   = "email"
+	KindWebhook = "webhook"
+)
+
+// Message is a notification sent to a channel
+type Message struct {
+	Title string
+	Text  string
+}
+
+// Sender delivers messages to targets of one channel kind
+type Sender interface {
+	// Validate checks a target before it is stored
+	Validate(target string) error
+	Send(ctx context.Context, target string, msg Message) error
+}
+
+// Channel is a target of a channel kind, optionally limited to some servers
+type Channel struct {
+	Kind     string
+	Target   string
+	ServerID string // empty for all servers
+}
+
+// Logger interface for notifications
+type Logger interface {
+	Debug(msg string, fields ...interface{})
+	Info(msg string, fields ...interface{})
+	Warn(msg string, fields ...interface{})
+	Error(msg string, fields ...interface{})
+}
+
+// Config represents delivery settings of the channels
+type Config struct {
+	Timeout time.Duration
+	SMTP    SMTPConfig
+}
+
+// Dispatcher publishes messages to the channels of their recipients
+type Dispatcher struct {
+	senders map[string]Sender
+	timeout time.Duration
+	logger  Logger
+}
+
+// NewDispatcher creates a dispatcher with senders for all channel kinds.
+// Email is available only when an SMTP host is configured.
+func NewDispatcher(cfg Config, logger Logger) *Dispatcher {
+	client := &http.Client{Timeout: cfg.Timeout}
+
+	senders := map[string]Sender{
+		KindSlack:   &slackSender{client: client},
+		KindDiscord: &discordSender{client: client},
+		KindWebhook: &webhookSender{client: client},
+	}
+	if cfg.SMTP.Host != "" {
+		senders[KindEmail] = &emailSender{cfg: cfg.SMTP}
+	}
+
+	return &Dispatcher{
+		senders: senders,
+		timeout: cfg.Timeout,
+		logger:  logger,
+	}
+}
+
+// Kinds returns the available channel kinds in alphabetical order
+func (d *Dispatcher) Kinds() []string {
+	kinds := make([]string, 0, len(d.senders))
+	for kind := range d.senders {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// Validate checks that a target can receive notifications of a channel kind
+func (d *Dispatcher) Validate(kind, target string) error {
+	sender, ok := d.senders[kind]
+	if !ok {
+		return fmt.Errorf("unknown channel kind %q", kind)
+	}
+	return sender.Validate(target)
+}
+
+// Publish sends a message about servers to the channels covering any of them; a message
+// about no particular server goes to all channels. Every channel is tried, the returned
+// error joins the failures.
+func (d *Dispatcher) Publish(ctx context.Context, channels []Channel, serverIDs []string, msg Message) error {
+	var errs []error
+	for _, channel := range channels {
+		if channel.ServerID != "" && len(serverIDs) > 0 && !slices.Contains(serverIDs, channel.ServerID) {
+			continue
+		}
+
+		sender, ok := d.senders[channel.Kind]
+		if !ok {
+			d.logger.Warn("Skipping notification channel of unavailable kind", "kind", channel.Kind)
+			continue
+		}
+
+		sendCtx, cancel := context.WithTimeout(ctx, d.timeout)
+		err := sender.Send(sendCtx, channel.Target, msg)
+		cancel()
+		if err != nil {
+			d.logger.Error("Failed to send notification", "error", err, "kind", channel.Kind)
+			errs = append(errs, fmt.Errorf("%s: %w", channel.Kind, err))
+		}
+	}
+
+	return stderrors.Join(errs...)
+}
+
+// validateWebhookURL checks that a webhook URL uses HTTPS and, when hosts are given, one of them
+func validateWebhookURL(target string, hosts ...string) error {
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid webhook URL")
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("webhook URL must use https")
+	}
+	if len(hosts) > 0 && !slices.Contains(hosts, strings.ToLower(u.Hostname())) {
+		return fmt.Errorf("webhook URL must point to %s", strings.Join(hosts, " or "))
+	}
+	return nil
+}
+
+// fullText joins the title and the text of a message
+func fullText(msg Message) string {
+	if msg.Title == "" {
+		return msg.Text
+	}
+	return msg.Title + "\n\n" + msg.Text
+}
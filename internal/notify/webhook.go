@@ -0,0 +1,92 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// discordMaxContent is the longest message content Discord accepts
+const discordMaxContent = 2000
+
+// slackSender posts to Slack incoming webhooks
+type slackSender struct {
+	client *http.Client
+}
+
+func (s *slackSender) Validate(target string) error {
+	return validateWebhookURL(target, "hooks.slack.com")
+}
+
+func (s *slackSender) Send(ctx context.Context, target string, msg Message) error {
+	return postJSON(ctx, s.client, target, map[string]string{"text": fullText(msg)})
+}
+
+// discordSender posts to Discord webhooks
+type discordSender struct {
+	client *http.Client
+}
+
+func (s *discordSender) Validate(target string) error {
+	return validateWebhookURL(target, "discord.com", "discordapp.com")
+}
+
+func (s *discordSender) Send(ctx context.Context, target string, msg Message) error {
+	content := []rune(fullText(msg))
+	if len(content) > discordMaxContent {
+		content = append(content[:discordMaxContent-1], '…')
+	}
+	return postJSON(ctx, s.client, target, map[string]string{"content": string(content)})
+}
+
+// webhookPayload is the body posted to generic webhooks
+type webhookPayload struct {
+	Title  string    `json:"title"`
+	Text   string    `json:"text"`
+	SentAt time.Time `json:"sent_at"`
+}
+
+// webhookSender posts JSON to arbitrary HTTPS endpoints
+type webhookSender struct {
+	client *http.Client
+}
+
+func (s *webhookSender) Validate(target string) error {
+	return validateWebhookURL(target)
+}
+
+func (s *webhookSender) Send(ctx context.Context, target string, msg Message) error {
+	return postJSON(ctx, s.client, target, webhookPayload{Title: msg.Title, Text: msg.Text, SentAt: time.Now().UTC()})
+}
+
+// postJSON posts a JSON body and expects a 2xx response
+func postJSON(ctx context.Context, client *http.Client, target string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
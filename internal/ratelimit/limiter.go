@@ -0,0 +1,157 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Store counts events per key within fixed windows
+type Store interface {
+	// Increment counts an event of key in its current window and returns the number
+	// of events in the window and the time until the window resets
+	Increment(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error)
+}
+
+// RedisOptions configures the connection of the Redis store
+type RedisOptions struct {
+	Addr         string
+	Password     string
+	Database     int
+	PoolSize     int
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	Prefix       string // prepended to all keys
+}
+
+// Rule limits events to Limit per Window
+type Rule struct {
+	Limit  int
+	Window time.Duration
+}
+
+// Decision is the outcome of a rate limit check
+type Decision struct {
+	Allowed    bool
+	Count      int64         // events of the key in the current window, including this one
+	RetryAfter time.Duration // time until the window resets
+}
+
+// FirstRejected reports whether the event is the first one over the limit in its window,
+// so that callers can warn once instead of on every rejected event
+func (d Decision) FirstRejected(rule Rule) bool {
+	return !d.Allowed && d.Count == int64(rule.Limit)+1
+}
+
+// counters counts decisions of one scope
+type counters struct {
+	allowed int64
+	limited int64
+	errors  int64
+}
+
+// Limiter applies rate limit rules to keys within named scopes
+type Limiter struct {
+	store Store
+
+	mu     sync.Mutex
+	scopes map[string]*counters
+}
+
+// New creates a limiter counting events in store
+func New(store Store) *Limiter {
+	return &Limiter{
+		store:  store,
+		scopes: make(map[string]*counters),
+	}
+}
+
+// Allow counts an event of key within scope and reports whether the rule allows it.
+// When the store fails, the event is allowed so that an outage does not lock users out.
+func (l *Limiter) Allow(ctx context.Context, scope, key string, rule Rule) Decision {
+	if rule.Limit <= 0 {
+		return Decision{Allowed: true}
+	}
+
+	count, reset, err := l.store.Increment(ctx, scope+":"+key, rule.Window)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c, ok := l.scopes[scope]
+	if !ok {
+		c = &counters{}
+		l.scopes[scope] = c
+	}
+
+	if err != nil {
+		c.errors++
+		return Decision{Allowed: true}
+	}
+
+	decision := Decision{Allowed: count <= int64(rule.Limit), Count: count, RetryAfter: reset}
+	if decision.Allowed {
+		c.allowed++
+	} else {
+		c.limited++
+	}
+	return decision
+}
+
+// Ping checks the store when it depends on a remote service
+func (l *Limiter) Ping(ctx context.Context) error {
+	if pinger, ok := l.store.(interface {
+		Ping(ctx context.Context) error
+	}); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+// Close releases the store when it holds connections
+func (l *Limiter) Close() error {
+	if closer, ok := l.store.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// WritePrometheus writes rate limit decisions per scope in Prometheus text exposition format
+func (l *Limiter) WritePrometheus(w io.Writer) error {
+	l.mu.Lock()
+	scopes := make([]string, 0, len(l.scopes))
+	snapshot := make(map[string]counters, len(l.scopes))
+	for scope, c := range l.scopes {
+		scopes = append(scopes, scope)
+		snapshot[scope] = *c
+	}
+	l.mu.Unlock()
+	sort.Strings(scopes)
+
+	metrics := []struct {
+		name  string
+		help  string
+		value func(c counters) int64
+	}{
+		{"servereyebot_ratelimit_allowed_total", "Requests allowed by the rate limiter.", func(c counters) int64 { return c.allowed }},
+		{"servereyebot_ratelimit_limited_total", "Requests rejected by the rate limiter.", func(c counters) int64 { return c.limited }},
+		{"servereyebot_ratelimit_errors_total", "Rate limit checks that failed and were allowed.", func(c counters) int64 { return c.errors }},
+	}
+
+	for _, m := range metrics {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", m.name, m.help, m.name); err != nil {
+			return err
+		}
+		for _, scope := range scopes {
+			if _, err := fmt.Fprintf(w, "%s{scope=%q} %d\n", m.name, scope, m.value(snapshot[scope])); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package ratelimit_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/ratelimit"
+	"github.com/servereye/servereyebot/internal/testutil"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	store := testutil.NewRateLimitStore(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC))
+	limiter := ratelimit.New(store)
+	rule := ratelimit.Rule{Limit: 2, Window: time.Minute}
+	ctx := context.Background()
+
+	tests := []struct {
+		name          string
+		advance       time.Duration
+		key           string
+		allowed       bool
+		firstRejected bool
+	}{
+		{name: "first event", key: "42", allowed: true},
+		{name: "at the limit", key: "42", allowed: true},
+		{name: "over the limit", key: "42", allowed: false, firstRejected: true},
+		{name: "still over the limit", key: "42", allowed: false},
+		{name: "other key", key: "43", allowed: true},
+		{name: "next window", advance: time.Minute, key: "42", allowed: true},
+	}
+
+	for _, tt := range tests {
+		store.Advance(tt.advance)
+		decision := limiter.Allow(ctx, "commands", tt.key, rule)
+		if decision.Allowed != tt.allowed {
+			t.Errorf("%s: Allowed = %v, want %v", tt.name, decision.Allowed, tt.allowed)
+		}
+		if got := decision.FirstRejected(rule); got != tt.firstRejected {
+			t.Errorf("%s: FirstRejected = %v, want %v", tt.name, got, tt.firstRejected)
+		}
+		if !decision.Allowed && decision.RetryAfter <= 0 {
+			t.Errorf("%s: RetryAfter = %v, want positive", tt.name, decision.RetryAfter)
+		}
+	}
+}
+
+func TestLimiterAllowsWhenStoreFails(t *testing.T) {
+	store := testutil.NewRateLimitStore(time.Now())
+	store.Fail("Increment", errors.New("connection refused"))
+	limiter := ratelimit.New(store)
+	rule := ratelimit.Rule{Limit: 1, Window: time.Minute}
+
+	for i := 0; i < 3; i++ {
+		if decision := limiter.Allow(context.Background(), "commands", "42", rule); !decision.Allowed {
+			t.Fatalf("event %d rejected while the store is down", i+1)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := limiter.WritePrometheus(&buf); err != nil {
+		t.Fatalf("WritePrometheus: %v", err)
+	}
+	if want := `servereyebot_ratelimit_errors_total{scope="commands"} 3`; !strings.Contains(buf.String(), want) {
+		t.Errorf("metrics do not contain %q:\n%s", want, buf.String())
+	}
+}
+
+func TestLimiterWithoutLimitSkipsStore(t *testing.T) {
+	store := testutil.NewRateLimitStore(time.Now())
+	limiter := ratelimit.New(store)
+
+	if decision := limiter.Allow(context.Background(), "commands", "42", ratelimit.Rule{}); !decision.Allowed {
+		t.Fatal("event rejected without a limit")
+	}
+	if calls := store.Calls("Increment"); calls != 0 {
+		t.Errorf("store called %d times, want 0", calls)
+	}
+}
+
+func TestLimiterPingAndClose(t *testing.T) {
+	store := testutil.NewRateLimitStore(time.Now())
+	limiter := ratelimit.New(store)
+
+	if err := limiter.Ping(context.Background()); err != nil {
+		t.Errorf("Ping: %v", err)
+	}
+
+	down := errors.New("connection refused")
+	store.FailAll(down)
+	if err := limiter.Ping(context.Background()); !errors.Is(err, down) {
+		t.Errorf("Ping = %v, want %v", err, down)
+	}
+	if err := limiter.Close(); !errors.Is(err, down) {
+		t.Errorf("Close = %v, want %v", err, down)
+	}
+}
@@ -0,0 +1,32 @@
+//go:build !redis
+
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// RedisStore is unavailable in binaries built without the redis build tag
+type RedisStore struct{}
+
+// NewRedisStore fails because the binary is built without Redis support
+func NewRedisStore(ctx context.Context, opts RedisOptions) (*RedisStore, error) {
+	return nil, errors.New("redis rate limit store is not available (is the binary built with -tags redis?)")
+}
+
+// Increment always fails
+func (s *RedisStore) Increment(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error) {
+	return 0, 0, errors.New("redis rate limit store is not available")
+}
+
+// Ping always fails
+func (s *RedisStore) Ping(ctx context.Context) error {
+	return errors.New("redis rate limit store is not available")
+}
+
+// Close does nothing
+func (s *RedisStore) Close() error {
+	return nil
+}
@@ -0,0 +1,182 @@
+// Package render builds Telegram messages in MarkdownV2. Values inserted into a message,
+// such as server, container or disk names, are escaped so that they neither break
+// parsing nor add formatting of their own; formatting comes only from the helpers.
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// ParseMode is the Telegram parse mode of rendered messages
+const ParseMode = "MarkdownV2"
+
+// Markdown is text in MarkdownV2, safe to send as is
+type Markdown string
+
+// markdownEscaper escapes the characters MarkdownV2 reserves outside of code
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`,
+	"~", `\~`, "`", "\\`", ">", `\>`, "#", `\#`, "+", `\+`, "-", `\-`, "=", `\=`,
+	"|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`,
+)
+
+// codeEscaper escapes the characters MarkdownV2 reserves inside code
+var codeEscaper = strings.NewReplacer(`\`, `\\`, "`", "\\`")
+
+// Escape escapes text for MarkdownV2
+func Escape(text string) string {
+	return markdownEscaper.Replace(text)
+}
+
+// Text returns plain text as Markdown
+func Text(text string) Markdown {
+	return Markdown(Escape(text))
+}
+
+// Bold returns a value in bold
+func Bold(v interface{}) Markdown {
+	return "*" + value(v) + "*"
+}
+
+// Italic returns a value in italics
+func Italic(v interface{}) Markdown {
+	return "_" + value(v) + "_"
+}
+
+// Code returns a value in a monospace font
+func Code(v interface{}) Markdown {
+	if m, ok := v.(Markdown); ok {
+		v = Plain(string(m))
+	}
+	return Markdown("`" + codeEscaper.Replace(fmt.Sprint(v)) + "`")
+}
+
+// Pre returns text as a preformatted block, keeping its columns aligned
+func Pre(text string) Markdown {
+	return Markdown("```\n" + codeEscaper.Replace(text) + "\n```")
+}
+
+// value escapes a value unless it is Markdown already
+func value(v interface{}) Markdown {
+	if m, ok := v.(Markdown); ok {
+		return m
+	}
+	return Text(fmt.Sprint(v))
+}
+
+// Plain converts MarkdownV2 back to plain text, for places without formatting such as
+// the audit log, or when Telegram rejects a message
+func Plain(text string) string {
+	var sb strings.Builder
+	escaped, code := false, false
+	for _, r := range text {
+		switch {
+		case escaped:
+			sb.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '`':
+			code = !code
+		case !code && strings.ContainsRune("*_~|", r):
+			// formatting marker
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// Template renders messages from text/template templates. Literal text of a template
+// and every value it prints are escaped; bold, italic and code add formatting.
+type Template struct {
+	tmpl *template.Template
+}
+
+// Funcs are available in templates, besides the text/template builtins
+var funcs = template.FuncMap{
+	"escape": value,
+	"bold":   Bold,
+	"italic": Italic,
+	"code":   Code,
+}
+
+// Parse parses the templates of a text
+func Parse(name, text string) (*Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return newTemplate(tmpl), nil
+}
+
+// ParseFS parses the templates of files matching the patterns
+func ParseFS(fsys fs.FS, patterns ...string) (*Template, error) {
+	tmpl, err := template.New("").Option("missingkey=error").Funcs(funcs).ParseFS(fsys, patterns...)
+	if err != nil {
+		return nil, err
+	}
+	return newTemplate(tmpl), nil
+}
+
+// Must panics when parsing templates failed, for templates built into the binary
+func Must(t *Template, err error) *Template {
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// newTemplate makes parsed templates escape their literal text and printed values
+func newTemplate(tmpl *template.Template) *Template {
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			escapeNode(t.Tree.Root)
+		}
+	}
+	return &Template{tmpl: tmpl}
+}
+
+// escapeNode escapes the text of a template node and pipes the values it prints through escape
+func escapeNode(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			escapeNode(child)
+		}
+	case *parse.TextNode:
+		n.Text = []byte(Escape(string(n.Text)))
+	case *parse.ActionNode:
+		// Actions assigning variables print nothing
+		if len(n.Pipe.Decl) == 0 {
+			ident := parse.NewIdentifier("escape").SetPos(n.Pos)
+			n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{NodeType: parse.NodeCommand, Pos: n.Pos, Args: []parse.Node{ident}})
+		}
+	case *parse.IfNode:
+		escapeNode(n.List)
+		escapeNode(n.ElseList)
+	case *parse.RangeNode:
+		escapeNode(n.List)
+		escapeNode(n.ElseList)
+	case *parse.WithNode:
+		escapeNode(n.List)
+		escapeNode(n.ElseList)
+	}
+}
+
+// Execute renders a named template
+func (t *Template) Execute(name string, data interface{}) (Markdown, error) {
+	var buf bytes.Buffer
+	if err := t.tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+		return "", fmt.Errorf("failed to render %s: %w", name, err)
+	}
+	return Markdown(buf.String()), nil
+}
@@ -0,0 +1,2300 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+)
+
+// MySQLRepository implements database operations for MySQL and MariaDB
+type MySQLRepository struct {
+	db *sql.DB
+}
+
+// NewMySQLRepository creates a new MySQL repository. databaseURL is a driver DSN,
+// e.g. "servereye:secret@tcp(localhost:3306)/servereye?parseTime=true".
+// The driver is only linked into binaries built with the mysql build tag.
+func NewMySQLRepository(databaseURL string) (*MySQLRepository, error) {
+	r, err := openMySQLRepository(databaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Test connection
+	if err := r.db.Ping(); err != nil {
+		r.db.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	return r, nil
+}
+
+// openMySQLRepository creates a MySQL repository without connecting to the database
+func openMySQLRepository(databaseURL string) (*MySQLRepository, error) {
+	db, err := sql.Open("mysql", databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database (is the binary built with -tags mysql?): %w", err)
+	}
+
+	// Set connection pool
+	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(5)
+	db.SetConnMaxLifetime(5 * time.Minute)
+
+	return &MySQLRepository{db: db}, nil
+}
+
+// Ping checks that the database is reachable
+func (r *MySQLRepository) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+// Close closes the database connection
+func (r *MySQLRepository) Close() error {
+	return r.db.Close()
+}
+
+// maxMetricRowsPerInsert keeps multi-row inserts below the MySQL placeholder limit
+const maxMetricRowsPerInsert = 1000
+
+// CreateUser creates a new user
+func (r *MySQLRepository) CreateUser(user *models.User) error {
+	// LAST_INSERT_ID(id) makes the ID of an existing row available on update
+	query := `
+INSERT INTO users (telegram_id, username, first_name, last_name, is_admin, is_active)
+VALUES (?, ?, ?, ?, ?, ?)
+ON DUPLICATE KEY UPDATE
+id = LAST_INSERT_ID(id),
+username = VALUES(username),
+first_name = VALUES(first_name),
+last_name = VALUES(last_name),
+is_admin = VALUES(is_admin),
+is_active = true,
+deleted_at = NULL,
+updated_at = CURRENT_TIMESTAMP
+`
+
+	result, err := r.db.Exec(query, user.TelegramID, user.Username, user.FirstName, user.LastName, user.IsAdmin, user.IsActive)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err == nil {
+		user.ID = id
+	}
+	return err
+}
+
+// GetUser retrieves a user by Telegram ID
+func (r *MySQLRepository) GetUser(userID int64) (*models.User, error) {
+	query := `
+SELECT id, telegram_id, username, first_name, last_name, is_admin, is_active, created_at, updated_at
+FROM users WHERE telegram_id = ?
+`
+
+	var user models.User
+	err := r.db.QueryRow(query, userID).Scan(
+		&user.ID, &user.TelegramID, &user.Username, &user.FirstName, &user.LastName,
+		&user.IsAdmin, &user.IsActive, &user.CreatedAt, &user.UpdatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// GetUserByID retrieves a user by internal ID
+func (r *MySQLRepository) GetUserByID(userID int64) (*models.User, error) {
+	query := `
+SELECT id, telegram_id, username, first_name, last_name, is_admin, is_active, created_at, updated_at
+FROM users WHERE id = ?
+`
+
+	var user models.User
+	err := r.db.QueryRow(query, userID).Scan(
+		&user.ID, &user.TelegramID, &user.Username, &user.FirstName, &user.LastName,
+		&user.IsAdmin, &user.IsActive, &user.CreatedAt, &user.UpdatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// AddServerToUser adds a server to a user's server list as its owner, since adding it
+// takes the server key
+func (r *MySQLRepository) AddServerToUser(userID int64, serverID, source string) error {
+	// First, ensure the server exists
+	if err := r.ensureServerExists(serverID); err != nil {
+		return err
+	}
+
+	// Then add the relationship
+	query := `INSERT IGNORE INTO user_servers (user_id, server_id, role) VALUES (?, ?, ?)`
+
+	_, err := r.db.Exec(query, userID, serverID, "owner")
+	return err
+}
+
+// ensureServerExists creates a server if it doesn't exist
+func (r *MySQLRepository) ensureServerExists(serverID string) error {
+	query := `INSERT IGNORE INTO servers (server_id, name, description) VALUES (?, ?, '')`
+
+	_, err := r.db.Exec(query, serverID, serverID)
+	return err
+}
+
+// GetUserServers retrieves all servers for a user
+func (r *MySQLRepository) GetUserServers(userID int64) ([]models.ServerWithDetails, error) {
+	query := `
+SELECT s.server_id as id, s.name, COALESCE(s.description, ''), s.created_at, s.updated_at,
+       COALESCE(s.server_key, s.server_id) as server_key, us.role as source, us.added_at
+FROM servers s
+INNER JOIN user_servers us ON s.server_id = us.server_id
+WHERE us.user_id = ?
+ORDER BY us.added_at DESC
+`
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var servers []models.ServerWithDetails
+	for rows.Next() {
+		var server models.ServerWithDetails
+		err := rows.Scan(
+			&server.ID, &server.Name, &server.Description,
+			&server.CreatedAt, &server.UpdatedAt,
+			&server.ServerKey, &server.Role, &server.AddedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		servers = append(servers, server)
+	}
+
+	return servers, rows.Err()
+}
+
+// RemoveServerFromUser removes a server from a user's server list
+func (r *MySQLRepository) RemoveServerFromUser(userID int64, serverID string) error {
+	query := `DELETE FROM user_servers WHERE user_id = ? AND server_id = ?`
+	_, err := r.db.Exec(query, userID, serverID)
+	return err
+}
+
+// IsServerOwnedByUser checks if a server is owned by a user
+func (r *MySQLRepository) IsServerOwnedByUser(userID int64, serverID string) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM user_servers WHERE user_id = ? AND server_id = ?)`
+
+	var exists bool
+	err := r.db.QueryRow(query, userID, serverID).Scan(&exists)
+	return exists, err
+}
+
+// UpdateServerName updates the name of a server
+func (r *MySQLRepository) UpdateServerName(ctx context.Context, serverID, newName string) error {
+	query := `UPDATE servers SET name = ?, updated_at = CURRENT_TIMESTAMP WHERE server_id = ?`
+	_, err := r.db.ExecContext(ctx, query, newName, serverID)
+	return err
+}
+
+// SetServerRole changes the role of a user on a server
+func (r *MySQLRepository) SetServerRole(ctx context.Context, userID int64, serverID, role string) error {
+	query := `UPDATE user_servers SET role = ? WHERE user_id = ? AND server_id = ?`
+	_, err := r.db.ExecContext(ctx, query, role, userID, serverID)
+	return err
+}
+
+// SetUserTimezone updates the timezone of a user
+func (r *MySQLRepository) SetUserTimezone(ctx context.Context, userID int64, timezone string) error {
+	query := `UPDATE users SET timezone = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	_, err := r.db.ExecContext(ctx, query, timezone, userID)
+	return err
+}
+
+// GetUserTimezone retrieves the timezone of a user
+func (r *MySQLRepository) GetUserTimezone(ctx context.Context, userID int64) (string, error) {
+	query := `SELECT COALESCE(timezone, 'UTC') FROM users WHERE id = ?`
+
+	var timezone string
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&timezone)
+	return timezone, err
+}
+
+// GetUserSettings retrieves the settings of a user, the defaults when none are stored
+func (r *MySQLRepository) GetUserSettings(ctx context.Context, userID int64) (*models.UserSettings, error) {
+	return r.queryUserSettings(ctx, userSettingsQuery+`WHERE u.id = ?`, userID)
+}
+
+// GetUserSettingsByTelegramID retrieves the settings of a user by Telegram ID
+func (r *MySQLRepository) GetUserSettingsByTelegramID(ctx context.Context, telegramID int64) (*models.UserSettings, error) {
+	return r.queryUserSettings(ctx, userSettingsQuery+`WHERE u.telegram_id = ?`, telegramID)
+}
+
+// queryUserSettings scans the settings row returned by query
+func (r *MySQLRepository) queryUserSettings(ctx context.Context, query string, args ...interface{}) (*models.UserSettings, error) {
+	var settings models.UserSettings
+	var quietFrom, quietTo sql.NullInt64
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(
+		&settings.UserID, &settings.DefaultServerID, &settings.Language, &settings.CompactMetrics,
+		&quietFrom, &quietTo, &settings.NotifyAlerts, &settings.NotifyReports,
+		&settings.Timezone, &settings.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if quietFrom.Valid && quietTo.Valid {
+		from, to := int(quietFrom.Int64), int(quietTo.Int64)
+		settings.QuietFrom, settings.QuietTo = &from, &to
+	}
+	return &settings, nil
+}
+
+// UpsertUserSettings stores the settings of a user, except the timezone kept with the user
+func (r *MySQLRepository) UpsertUserSettings(ctx context.Context, settings *models.UserSettings) error {
+	query := `
+INSERT INTO user_settings (user_id, default_server_id, language, compact_metrics, quiet_from, quiet_to, notify_alerts, notify_reports)
+VALUES (?, NULLIF(?, ''), NULLIF(?, ''), ?, ?, ?, ?, ?)
+ON DUPLICATE KEY UPDATE
+default_server_id = VALUES(default_server_id),
+language = VALUES(language),
+compact_metrics = VALUES(compact_metrics),
+quiet_from = VALUES(quiet_from),
+quiet_to = VALUES(quiet_to),
+notify_alerts = VALUES(notify_alerts),
+notify_reports = VALUES(notify_reports)
+`
+
+	_, err := r.db.ExecContext(ctx, query,
+		settings.UserID, settings.DefaultServerID, settings.Language, settings.CompactMetrics,
+		settings.QuietFrom, settings.QuietTo, settings.NotifyAlerts, settings.NotifyReports,
+	)
+	return err
+}
+
+// UpsertReportSchedule creates or replaces the report schedule of a user
+func (r *MySQLRepository) UpsertReportSchedule(ctx context.Context, schedule *models.ReportSchedule) error {
+	query := `
+INSERT INTO report_schedules (user_id, frequency, weekday, hour, minute)
+VALUES (?, ?, ?, ?, ?)
+ON DUPLICATE KEY UPDATE
+frequency = VALUES(frequency),
+weekday = VALUES(weekday),
+hour = VALUES(hour),
+minute = VALUES(minute),
+last_sent_at = NULL,
+failed_attempts = 0,
+retry_at = NULL,
+created_at = CURRENT_TIMESTAMP
+`
+
+	if _, err := r.db.ExecContext(ctx, query, schedule.UserID, schedule.Frequency, schedule.Weekday, schedule.Hour, schedule.Minute); err != nil {
+		return err
+	}
+
+	return r.db.QueryRowContext(ctx, `SELECT id, created_at FROM report_schedules WHERE user_id = ?`, schedule.UserID).
+		Scan(&schedule.ID, &schedule.CreatedAt)
+}
+
+// GetReportSchedule retrieves the report schedule of a user
+func (r *MySQLRepository) GetReportSchedule(ctx context.Context, userID int64) (*models.ReportSchedule, error) {
+	query := `
+SELECT rs.id, rs.user_id, u.telegram_id, COALESCE(u.timezone, 'UTC'), rs.frequency, rs.weekday,
+       rs.hour, rs.minute, COALESCE(rs.sections, ''), COALESCE(rs.server_order, ''), rs.last_sent_at,
+       rs.failed_attempts, rs.retry_at, rs.created_at
+FROM report_schedules rs
+INNER JOIN users u ON u.id = rs.user_id
+WHERE rs.user_id = ?
+`
+
+	var schedule models.ReportSchedule
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(
+		&schedule.ID, &schedule.UserID, &schedule.TelegramID, &schedule.Timezone, &schedule.Frequency,
+		&schedule.Weekday, &schedule.Hour, &schedule.Minute, &schedule.Sections, &schedule.ServerOrder,
+		&schedule.LastSentAt, &schedule.FailedAttempts, &schedule.RetryAt, &schedule.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &schedule, nil
+}
+
+// SetReportTemplate stores the sections and server order of the report schedule of a user.
+// It returns sql.ErrNoRows when the user has no schedule.
+func (r *MySQLRepository) SetReportTemplate(ctx context.Context, userID int64, sections, serverOrder string) error {
+	query := `UPDATE report_schedules SET sections = ?, server_order = ? WHERE user_id = ?`
+
+	result, err := r.db.ExecContext(ctx, query, sections, serverOrder, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected > 0 {
+		return nil
+	}
+
+	// MySQL counts changed rows only, so an unchanged template also affects none
+	var exists bool
+	if err := r.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM report_schedules WHERE user_id = ?)`, userID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteReportSchedule removes the report schedule of a user
+func (r *MySQLRepository) DeleteReportSchedule(ctx context.Context, userID int64) error {
+	query := `DELETE FROM report_schedules WHERE user_id = ?`
+	_, err := r.db.ExecContext(ctx, query, userID)
+	return err
+}
+
+// ListReportSchedules retrieves all report schedules of active users
+func (r *MySQLRepository) ListReportSchedules(ctx context.Context) ([]models.ReportSchedule, error) {
+	query := `
+SELECT rs.id, rs.user_id, u.telegram_id, COALESCE(u.timezone, 'UTC'), rs.frequency, rs.weekday,
+       rs.hour, rs.minute, COALESCE(rs.sections, ''), COALESCE(rs.server_order, ''), rs.last_sent_at,
+       rs.failed_attempts, rs.retry_at, rs.created_at
+FROM report_schedules rs
+INNER JOIN users u ON u.id = rs.user_id
+WHERE u.is_active = true
+`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var schedules []models.ReportSchedule
+	for rows.Next() {
+		var schedule models.ReportSchedule
+		err := rows.Scan(
+			&schedule.ID, &schedule.UserID, &schedule.TelegramID, &schedule.Timezone, &schedule.Frequency,
+			&schedule.Weekday, &schedule.Hour, &schedule.Minute, &schedule.Sections, &schedule.ServerOrder,
+			&schedule.LastSentAt, &schedule.FailedAttempts, &schedule.RetryAt, &schedule.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	return schedules, rows.Err()
+}
+
+// MarkReportSent records the time a scheduled report was delivered
+func (r *MySQLRepository) MarkReportSent(ctx context.Context, scheduleID int64, sentAt time.Time) error {
+	query := `UPDATE report_schedules SET last_sent_at = ?, failed_attempts = 0, retry_at = NULL WHERE id = ?`
+	_, err := r.db.ExecContext(ctx, query, sentAt, scheduleID)
+	return err
+}
+
+// MarkReportFailed records a failed delivery of a scheduled report and when to retry it
+func (r *MySQLRepository) MarkReportFailed(ctx context.Context, scheduleID int64, attempts int, retryAt time.Time) error {
+	query := `UPDATE report_schedules SET failed_attempts = ?, retry_at = ? WHERE id = ?`
+	_, err := r.db.ExecContext(ctx, query, attempts, retryAt, scheduleID)
+	return err
+}
+
+// InsertAlertLog records the alerts users were sent about their servers
+func (r *MySQLRepository) InsertAlertLog(ctx context.Context, entries []models.AlertLogEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, len(entries))
+	args := make([]interface{}, 0, len(entries)*3)
+	for i, entry := range entries {
+		placeholders[i] = "(?, ?, ?)"
+		args = append(args, entry.TelegramID, entry.ServerID, entry.CreatedAt)
+	}
+
+	query := `INSERT INTO alert_log (telegram_id, server_id, created_at) VALUES ` + strings.Join(placeholders, ", ")
+	_, err := r.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+// CountAlerts counts the alerts a user was sent about a server since the given time
+func (r *MySQLRepository) CountAlerts(ctx context.Context, telegramID int64, serverID string, since time.Time) (int, error) {
+	query := `SELECT COUNT(*) FROM alert_log WHERE telegram_id = ? AND server_id = ? AND created_at >= ?`
+
+	var count int
+	err := r.db.QueryRowContext(ctx, query, telegramID, serverID, since).Scan(&count)
+	return count, err
+}
+
+// DeleteAlertLog removes the alert records created before the given time
+func (r *MySQLRepository) DeleteAlertLog(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM alert_log WHERE created_at < ?`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// CreateCommandHistory records an executed action in the audit log
+func (r *MySQLRepository) CreateCommandHistory(ctx context.Context, entry *models.CommandHistory) error {
+	query := `
+INSERT INTO command_history (user_id, telegram_id, server_id, command, payload, envelope, response, success, error, duration_ms)
+VALUES (NULLIF(?, 0), ?, ?, ?, ?, NULLIF(?, ''), ?, ?, ?, ?)
+`
+
+	result, err := r.db.ExecContext(ctx, query,
+		entry.UserID, entry.TelegramID, entry.ServerID, entry.Command, entry.Payload,
+		entry.Envelope, entry.Response, entry.Success, entry.Error, entry.DurationMs,
+	)
+	if err != nil {
+		return err
+	}
+
+	if entry.ID, err = result.LastInsertId(); err != nil {
+		return err
+	}
+
+	return r.db.QueryRowContext(ctx, `SELECT created_at FROM command_history WHERE id = ?`, entry.ID).Scan(&entry.CreatedAt)
+}
+
+// GetCommandHistory retrieves a single audit log entry by ID
+func (r *MySQLRepository) GetCommandHistory(ctx context.Context, id int64) (*models.CommandHistory, error) {
+	query := `
+SELECT ch.id, COALESCE(ch.user_id, 0), ch.telegram_id, ch.server_id, ch.command, COALESCE(ch.payload, ''),
+       COALESCE(ch.envelope, ''), COALESCE(ch.response, ''), ch.success, COALESCE(ch.error, ''), ch.duration_ms, ch.created_at
+FROM command_history ch
+WHERE ch.id = ?
+`
+
+	entries, err := r.queryCommandHistory(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return &entries[0], nil
+}
+
+// ListCommandHistoryForUser retrieves the latest actions on servers available to a user
+func (r *MySQLRepository) ListCommandHistoryForUser(ctx context.Context, userID int64, limit int) ([]models.CommandHistory, error) {
+	query := `
+SELECT ch.id, COALESCE(ch.user_id, 0), ch.telegram_id, ch.server_id, ch.command, COALESCE(ch.payload, ''),
+       COALESCE(ch.envelope, ''), COALESCE(ch.response, ''), ch.success, COALESCE(ch.error, ''), ch.duration_ms, ch.created_at
+FROM command_history ch
+WHERE ch.server_id IN (SELECT server_id FROM user_servers WHERE user_id = ?)
+ORDER BY ch.created_at DESC
+LIMIT ?
+`
+
+	return r.queryCommandHistory(ctx, query, userID, limit)
+}
+
+// ListCommandHistory retrieves the latest actions across all servers
+func (r *MySQLRepository) ListCommandHistory(ctx context.Context, limit int) ([]models.CommandHistory, error) {
+	query := `
+SELECT ch.id, COALESCE(ch.user_id, 0), ch.telegram_id, ch.server_id, ch.command, COALESCE(ch.payload, ''),
+       COALESCE(ch.envelope, ''), COALESCE(ch.response, ''), ch.success, COALESCE(ch.error, ''), ch.duration_ms, ch.created_at
+FROM command_history ch
+ORDER BY ch.created_at DESC
+LIMIT ?
+`
+
+	return r.queryCommandHistory(ctx, query, limit)
+}
+
+// ListAdminTelegramIDs retrieves Telegram IDs of all active admins
+func (r *MySQLRepository) ListAdminTelegramIDs(ctx context.Context) ([]int64, error) {
+	query := `SELECT telegram_id FROM users WHERE is_admin = true AND is_active = true`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// ListAlertTargets retrieves all servers together with the Telegram IDs of their active users
+func (r *MySQLRepository) ListAlertTargets(ctx context.Context) ([]models.AlertTarget, error) {
+	query := `
+SELECT s.server_id, s.name, COALESCE(s.server_key, s.server_id), u.telegram_id
+FROM servers s
+INNER JOIN user_servers us ON us.server_id = s.server_id
+INNER JOIN users u ON u.id = us.user_id
+WHERE s.is_active = true AND u.is_active = true
+ORDER BY s.server_id
+`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var targets []models.AlertTarget
+	for rows.Next() {
+		var target models.AlertTarget
+		if err := rows.Scan(&target.ServerID, &target.Name, &target.ServerKey, &target.TelegramID); err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+
+	return targets, rows.Err()
+}
+
+// GetUserByUsername retrieves a user by Telegram username, without the leading @
+func (r *MySQLRepository) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	query := `
+SELECT id, telegram_id, username, first_name, last_name, is_admin, is_active, created_at, updated_at
+FROM users WHERE LOWER(username) = LOWER(?)
+`
+
+	var user models.User
+	err := r.db.QueryRowContext(ctx, query, username).Scan(
+		&user.ID, &user.TelegramID, &user.Username, &user.FirstName, &user.LastName,
+		&user.IsAdmin, &user.IsActive, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// AddServerTag assigns a tag to a server
+func (r *MySQLRepository) AddServerTag(ctx context.Context, serverID, tag string) error {
+	_, err := r.db.ExecContext(ctx, `INSERT IGNORE INTO server_tags (server_id, tag) VALUES (?, ?)`, serverID, tag)
+	return err
+}
+
+// RemoveServerTag removes a tag from a server, reporting whether it was assigned
+func (r *MySQLRepository) RemoveServerTag(ctx context.Context, serverID, tag string) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM server_tags WHERE server_id = ? AND tag = ?`, serverID, tag)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// ListServerTags retrieves the tags of all servers
+func (r *MySQLRepository) ListServerTags(ctx context.Context) ([]models.ServerTag, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT server_id, tag FROM server_tags ORDER BY server_id, tag`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var tags []models.ServerTag
+	for rows.Next() {
+		var tag models.ServerTag
+		if err := rows.Scan(&tag.ServerID, &tag.Tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
+
+// UpsertTag creates or replaces the metadata of a tag
+func (r *MySQLRepository) UpsertTag(ctx context.Context, tag *models.Tag) error {
+	query := `
+INSERT INTO tags (name, description, correlation_window_seconds)
+VALUES (?, ?, ?)
+ON DUPLICATE KEY UPDATE
+description = VALUES(description),
+correlation_window_seconds = VALUES(correlation_window_seconds)
+`
+
+	_, err := r.db.ExecContext(ctx, query, tag.Name, tag.Description, tag.CorrelationWindow)
+	return err
+}
+
+// ListTags retrieves the metadata of all tags
+func (r *MySQLRepository) ListTags(ctx context.Context) ([]models.Tag, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT name, description, correlation_window_seconds FROM tags ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var tags []models.Tag
+	for rows.Next() {
+		var tag models.Tag
+		if err := rows.Scan(&tag.Name, &tag.Description, &tag.CorrelationWindow); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
+
+// AddNotificationChannel stores a notification channel and sets its ID
+func (r *MySQLRepository) AddNotificationChannel(ctx context.Context, channel *models.NotificationChannel) error {
+	result, err := r.db.ExecContext(ctx,
+		`INSERT INTO notification_channels (user_id, server_id, kind, target) VALUES (?, NULLIF(?, ''), ?, ?)`,
+		channel.UserID, channel.ServerID, channel.Kind, channel.Target)
+	if err != nil {
+		return err
+	}
+
+	channel.ID, err = result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	channel.CreatedAt = time.Now()
+	return nil
+}
+
+// RemoveNotificationChannel removes a channel of a user, reporting whether it existed
+func (r *MySQLRepository) RemoveNotificationChannel(ctx context.Context, userID, id int64) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM notification_channels WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// ListNotificationChannels retrieves the notification channels of a user by Telegram ID
+func (r *MySQLRepository) ListNotificationChannels(ctx context.Context, telegramID int64) ([]models.NotificationChannel, error) {
+	query := `
+SELECT nc.id, nc.user_id, COALESCE(nc.server_id, ''), nc.kind, nc.target, nc.created_at
+FROM notification_channels nc
+INNER JOIN users u ON u.id = nc.user_id
+WHERE u.telegram_id = ?
+ORDER BY nc.id
+`
+
+	rows, err := r.db.QueryContext(ctx, query, telegramID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var channels []models.NotificationChannel
+	for rows.Next() {
+		var channel models.NotificationChannel
+		if err := rows.Scan(&channel.ID, &channel.UserID, &channel.ServerID, &channel.Kind, &channel.Target, &channel.CreatedAt); err != nil {
+			return nil, err
+		}
+		channels = append(channels, channel)
+	}
+
+	return channels, rows.Err()
+}
+
+// BindChatServer attaches a server to a group chat, keeping the existing binding if any
+func (r *MySQLRepository) BindChatServer(ctx context.Context, binding *models.ChatServer) error {
+	query := `
+INSERT IGNORE INTO chat_servers (chat_id, server_id, bound_by)
+VALUES (?, ?, ?)
+`
+
+	_, err := r.db.ExecContext(ctx, query, binding.ChatID, binding.ServerID, binding.BoundBy)
+	return err
+}
+
+// UnbindChatServer detaches a server from a group chat, reporting whether it was attached
+func (r *MySQLRepository) UnbindChatServer(ctx context.Context, chatID int64, serverID string) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM chat_servers WHERE chat_id = ? AND server_id = ?`, chatID, serverID)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// ListChatServers retrieves the servers attached to a group chat
+func (r *MySQLRepository) ListChatServers(ctx context.Context, chatID int64) ([]models.ServerWithDetails, error) {
+	query := `
+SELECT s.server_id, s.name, COALESCE(s.description, ''), s.created_at, s.updated_at,
+       COALESCE(s.server_key, s.server_id), cs.created_at
+FROM chat_servers cs
+INNER JOIN servers s ON s.server_id = cs.server_id
+WHERE cs.chat_id = ?
+ORDER BY cs.created_at
+`
+
+	rows, err := r.db.QueryContext(ctx, query, chatID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var servers []models.ServerWithDetails
+	for rows.Next() {
+		var server models.ServerWithDetails
+		err := rows.Scan(
+			&server.ID, &server.Name, &server.Description,
+			&server.CreatedAt, &server.UpdatedAt,
+			&server.ServerKey, &server.AddedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		servers = append(servers, server)
+	}
+
+	return servers, rows.Err()
+}
+
+// ListChatBindings retrieves all servers attached to group chats
+func (r *MySQLRepository) ListChatBindings(ctx context.Context) ([]models.ChatServer, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT chat_id, server_id, bound_by, created_at FROM chat_servers ORDER BY chat_id, server_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var bindings []models.ChatServer
+	for rows.Next() {
+		var binding models.ChatServer
+		if err := rows.Scan(&binding.ChatID, &binding.ServerID, &binding.BoundBy, &binding.CreatedAt); err != nil {
+			return nil, err
+		}
+		bindings = append(bindings, binding)
+	}
+
+	return bindings, rows.Err()
+}
+
+// UpsertRestartPolicy creates or replaces the restart policy of a container. A replaced
+// policy starts over, so its tripped state is cleared.
+func (r *MySQLRepository) UpsertRestartPolicy(ctx context.Context, policy *models.RestartPolicy) error {
+	query := `
+INSERT INTO restart_policies (server_id, container, max_restarts, created_by)
+VALUES (?, ?, ?, ?)
+ON DUPLICATE KEY UPDATE
+max_restarts = VALUES(max_restarts),
+created_by = VALUES(created_by),
+tripped_at = NULL
+`
+
+	_, err := r.db.ExecContext(ctx, query, policy.ServerID, policy.Container, policy.MaxRestarts, policy.CreatedBy)
+	return err
+}
+
+// DeleteRestartPolicy removes the restart policy of a container, reporting whether it existed
+func (r *MySQLRepository) DeleteRestartPolicy(ctx context.Context, serverID, container string) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM restart_policies WHERE server_id = ? AND container = ?`, serverID, container)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// ListRestartPolicies retrieves the restart policies of the containers of a server
+func (r *MySQLRepository) ListRestartPolicies(ctx context.Context, serverID string) ([]models.RestartPolicy, error) {
+	query := `
+SELECT server_id, container, max_restarts, created_by, created_at, tripped_at
+FROM restart_policies
+WHERE server_id = ?
+ORDER BY container
+`
+
+	rows, err := r.db.QueryContext(ctx, query, serverID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var policies []models.RestartPolicy
+	for rows.Next() {
+		var policy models.RestartPolicy
+		if err := rows.Scan(&policy.ServerID, &policy.Container, &policy.MaxRestarts, &policy.CreatedBy, &policy.CreatedAt, &policy.TrippedAt); err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+
+	return policies, rows.Err()
+}
+
+// MarkRestartPolicyTripped records when the agent stopped restarting a container.
+// It returns sql.ErrNoRows when the container has no policy.
+func (r *MySQLRepository) MarkRestartPolicyTripped(ctx context.Context, serverID, container string, at time.Time) (*models.RestartPolicy, error) {
+	if _, err := r.db.ExecContext(ctx, `UPDATE restart_policies SET tripped_at = ? WHERE server_id = ? AND container = ?`, at, serverID, container); err != nil {
+		return nil, err
+	}
+
+	query := `
+SELECT server_id, container, max_restarts, created_by, created_at, tripped_at
+FROM restart_policies
+WHERE server_id = ? AND container = ?
+`
+
+	var policy models.RestartPolicy
+	err := r.db.QueryRowContext(ctx, query, serverID, container).
+		Scan(&policy.ServerID, &policy.Container, &policy.MaxRestarts, &policy.CreatedBy, &policy.CreatedAt, &policy.TrippedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// UpsertProcessWatch creates or replaces the watch of a process
+func (r *MySQLRepository) UpsertProcessWatch(ctx context.Context, watch *models.ProcessWatch) error {
+	query := `
+INSERT INTO process_watches (server_id, name, restart_command, created_by)
+VALUES (?, ?, ?, ?)
+ON DUPLICATE KEY UPDATE
+restart_command = VALUES(restart_command),
+created_by = VALUES(created_by)
+`
+
+	_, err := r.db.ExecContext(ctx, query, watch.ServerID, watch.Name, watch.RestartCommand, watch.CreatedBy)
+	return err
+}
+
+// DeleteProcessWatch removes the watch of a process, reporting whether it existed
+func (r *MySQLRepository) DeleteProcessWatch(ctx context.Context, serverID, name string) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM process_watches WHERE server_id = ? AND name = ?`, serverID, name)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// GetProcessWatch retrieves the watch of a process
+func (r *MySQLRepository) GetProcessWatch(ctx context.Context, serverID, name string) (*models.ProcessWatch, error) {
+	query := `
+SELECT server_id, name, restart_command, created_by, created_at
+FROM process_watches
+WHERE server_id = ? AND name = ?
+`
+
+	var watch models.ProcessWatch
+	err := r.db.QueryRowContext(ctx, query, serverID, name).Scan(&watch.ServerID, &watch.Name, &watch.RestartCommand, &watch.CreatedBy, &watch.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &watch, nil
+}
+
+// ListProcessWatches retrieves the watches of all servers
+func (r *MySQLRepository) ListProcessWatches(ctx context.Context) ([]models.ProcessWatch, error) {
+	query := `
+SELECT server_id, name, restart_command, created_by, created_at
+FROM process_watches
+ORDER BY server_id, name
+`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var watches []models.ProcessWatch
+	for rows.Next() {
+		var watch models.ProcessWatch
+		if err := rows.Scan(&watch.ServerID, &watch.Name, &watch.RestartCommand, &watch.CreatedBy, &watch.CreatedAt); err != nil {
+			return nil, err
+		}
+		watches = append(watches, watch)
+	}
+
+	return watches, rows.Err()
+}
+
+// AddLogWatch creates a log watch, setting its ID
+func (r *MySQLRepository) AddLogWatch(ctx context.Context, watch *models.LogWatch) error {
+	result, err := r.db.ExecContext(ctx,
+		`INSERT INTO log_watches (server_id, path, pattern, created_by) VALUES (?, ?, ?, ?)`,
+		watch.ServerID, watch.Path, watch.Pattern, watch.CreatedBy)
+	if err != nil {
+		return err
+	}
+
+	watch.ID, err = result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	watch.CreatedAt = time.Now()
+	return nil
+}
+
+// DeleteLogWatch removes a log watch of a server, reporting whether it existed
+func (r *MySQLRepository) DeleteLogWatch(ctx context.Context, serverID string, id int64) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM log_watches WHERE server_id = ? AND id = ?`, serverID, id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// ListLogWatches retrieves the log watches of a server
+func (r *MySQLRepository) ListLogWatches(ctx context.Context, serverID string) ([]models.LogWatch, error) {
+	query := `
+SELECT id, server_id, path, pattern, created_by, created_at
+FROM log_watches
+WHERE server_id = ?
+ORDER BY id
+`
+
+	rows, err := r.db.QueryContext(ctx, query, serverID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var watches []models.LogWatch
+	for rows.Next() {
+		var watch models.LogWatch
+		if err := rows.Scan(&watch.ID, &watch.ServerID, &watch.Path, &watch.Pattern, &watch.CreatedBy, &watch.CreatedAt); err != nil {
+			return nil, err
+		}
+		watches = append(watches, watch)
+	}
+
+	return watches, rows.Err()
+}
+
+// AddFirewallBlock stores a block, or takes over the existing block of the address,
+// setting its ID
+func (r *MySQLRepository) AddFirewallBlock(ctx context.Context, block *models.FirewallBlock) error {
+	query := `
+INSERT INTO firewall_blocks (server_id, address, created_by)
+VALUES (?, ?, ?)
+ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id), created_by = VALUES(created_by)
+`
+
+	result, err := r.db.ExecContext(ctx, query, block.ServerID, block.Address, block.CreatedBy)
+	if err != nil {
+		return err
+	}
+
+	block.ID, err = result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	block.CreatedAt = time.Now()
+	return nil
+}
+
+// GetFirewallBlock retrieves a firewall block
+func (r *MySQLRepository) GetFirewallBlock(ctx context.Context, id int64) (*models.FirewallBlock, error) {
+	query := `
+SELECT id, server_id, address, created_by, created_at
+FROM firewall_blocks
+WHERE id = ?
+`
+
+	var block models.FirewallBlock
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&block.ID, &block.ServerID, &block.Address, &block.CreatedBy, &block.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &block, nil
+}
+
+// DeleteFirewallBlock removes a firewall block, reporting whether it existed
+func (r *MySQLRepository) DeleteFirewallBlock(ctx context.Context, id int64) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM firewall_blocks WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// ListFirewallBlocks retrieves the addresses blocked on a server
+func (r *MySQLRepository) ListFirewallBlocks(ctx context.Context, serverID string) ([]models.FirewallBlock, error) {
+	query := `
+SELECT id, server_id, address, created_by, created_at
+FROM firewall_blocks
+WHERE server_id = ?
+ORDER BY id
+`
+
+	rows, err := r.db.QueryContext(ctx, query, serverID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var blocks []models.FirewallBlock
+	for rows.Next() {
+		var block models.FirewallBlock
+		if err := rows.Scan(&block.ID, &block.ServerID, &block.Address, &block.CreatedBy, &block.CreatedAt); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+
+	return blocks, rows.Err()
+}
+
+// RecordPassiveCheck stores a check result and returns the previous result of the
+// check, nil for a new check
+func (r *MySQLRepository) RecordPassiveCheck(ctx context.Context, check *models.PassiveCheck) (*models.PassiveCheck, error) {
+	previous, err := r.getPassiveCheck(ctx, check.ServerID, check.Service)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	query := `
+INSERT INTO passive_checks (server_id, service, host, state, output, checked_at, changed_at)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+ON DUPLICATE KEY UPDATE
+host = VALUES(host),
+changed_at = IF(state <> VALUES(state), VALUES(checked_at), changed_at),
+state = VALUES(state),
+output = VALUES(output),
+checked_at = VALUES(checked_at)
+`
+
+	// changed_at is assigned before state, MySQL evaluates the assignments in order
+	if _, err := r.db.ExecContext(ctx, query, check.ServerID, check.Service, check.Host, check.State, check.Output, check.CheckedAt, check.CheckedAt); err != nil {
+		return nil, err
+	}
+	return previous, nil
+}
+
+// getPassiveCheck retrieves the last result of a check
+func (r *MySQLRepository) getPassiveCheck(ctx context.Context, serverID, service string) (*models.PassiveCheck, error) {
+	query := `
+SELECT server_id, service, host, state, COALESCE(output, ''), checked_at, changed_at
+FROM passive_checks
+WHERE server_id = ? AND service = ?
+`
+
+	var check models.PassiveCheck
+	err := r.db.QueryRowContext(ctx, query, serverID, service).
+		Scan(&check.ServerID, &check.Service, &check.Host, &check.State, &check.Output, &check.CheckedAt, &check.ChangedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &check, nil
+}
+
+// ListPassiveChecks retrieves the last results of the passive checks of a server
+func (r *MySQLRepository) ListPassiveChecks(ctx context.Context, serverID string) ([]models.PassiveCheck, error) {
+	query := `
+SELECT server_id, service, host, state, COALESCE(output, ''), checked_at, changed_at
+FROM passive_checks
+WHERE server_id = ?
+ORDER BY state DESC, service
+`
+
+	rows, err := r.db.QueryContext(ctx, query, serverID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var checks []models.PassiveCheck
+	for rows.Next() {
+		var check models.PassiveCheck
+		if err := rows.Scan(&check.ServerID, &check.Service, &check.Host, &check.State, &check.Output, &check.CheckedAt, &check.ChangedAt); err != nil {
+			return nil, err
+		}
+		checks = append(checks, check)
+	}
+
+	return checks, rows.Err()
+}
+
+// AddDeploymentWindow stores a deployment window and sets its ID
+func (r *MySQLRepository) AddDeploymentWindow(ctx context.Context, window *models.DeploymentWindow) error {
+	result, err := r.db.ExecContext(ctx,
+		`INSERT INTO deployment_windows (server_id, weekday, start_minute, end_minute, timezone, created_by) VALUES (?, ?, ?, ?, ?, ?)`,
+		window.ServerID, window.Weekday, window.StartMinute, window.EndMinute, window.Timezone, window.CreatedBy)
+	if err != nil {
+		return err
+	}
+
+	window.ID, err = result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	window.CreatedAt = time.Now()
+	return nil
+}
+
+// DeleteDeploymentWindow removes a deployment window, reporting whether it existed
+func (r *MySQLRepository) DeleteDeploymentWindow(ctx context.Context, id int64) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM deployment_windows WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// ListDeploymentWindows retrieves the deployment windows of all servers
+func (r *MySQLRepository) ListDeploymentWindows(ctx context.Context) ([]models.DeploymentWindow, error) {
+	query := `
+SELECT id, server_id, weekday, start_minute, end_minute, timezone, created_by, created_at
+FROM deployment_windows
+ORDER BY server_id, weekday, start_minute
+`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var windows []models.DeploymentWindow
+	for rows.Next() {
+		var window models.DeploymentWindow
+		if err := rows.Scan(&window.ID, &window.ServerID, &window.Weekday, &window.StartMinute, &window.EndMinute, &window.Timezone, &window.CreatedBy, &window.CreatedAt); err != nil {
+			return nil, err
+		}
+		windows = append(windows, window)
+	}
+
+	return windows, rows.Err()
+}
+
+// AddMaintenanceWindow stores a maintenance window and sets its ID
+func (r *MySQLRepository) AddMaintenanceWindow(ctx context.Context, window *models.MaintenanceWindow) error {
+	result, err := r.db.ExecContext(ctx,
+		`INSERT INTO maintenance_windows (server_id, starts_at, ends_at, created_by) VALUES (?, ?, ?, ?)`,
+		window.ServerID, window.StartsAt, window.EndsAt, window.CreatedBy)
+	if err != nil {
+		return err
+	}
+
+	window.ID, err = result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	window.CreatedAt = time.Now()
+	return nil
+}
+
+// DeleteMaintenanceWindow removes a maintenance window, reporting whether it existed
+func (r *MySQLRepository) DeleteMaintenanceWindow(ctx context.Context, id int64) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM maintenance_windows WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// ListMaintenanceWindows retrieves the maintenance windows of all servers
+func (r *MySQLRepository) ListMaintenanceWindows(ctx context.Context) ([]models.MaintenanceWindow, error) {
+	query := `
+SELECT id, server_id, starts_at, ends_at, created_by, created_at
+FROM maintenance_windows
+ORDER BY server_id, starts_at
+`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var windows []models.MaintenanceWindow
+	for rows.Next() {
+		var window models.MaintenanceWindow
+		if err := rows.Scan(&window.ID, &window.ServerID, &window.StartsAt, &window.EndsAt, &window.CreatedBy, &window.CreatedAt); err != nil {
+			return nil, err
+		}
+		windows = append(windows, window)
+	}
+
+	return windows, rows.Err()
+}
+
+// UpsertAlertRoute stores a route, replacing the route of the same user, server and category
+func (r *MySQLRepository) UpsertAlertRoute(ctx context.Context, route *models.AlertRoute) error {
+	query := `
+INSERT INTO alert_routes (telegram_id, server_id, category, chat_id)
+VALUES (?, ?, ?, ?)
+ON DUPLICATE KEY UPDATE
+id = LAST_INSERT_ID(id),
+chat_id = VALUES(chat_id)
+`
+
+	result, err := r.db.ExecContext(ctx, query, route.TelegramID, route.ServerID, route.Category, route.ChatID)
+	if err != nil {
+		return err
+	}
+
+	route.ID, err = result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	route.CreatedAt = time.Now()
+	return nil
+}
+
+// DeleteAlertRoute removes the route of a user, server and category, reporting whether it existed
+func (r *MySQLRepository) DeleteAlertRoute(ctx context.Context, telegramID int64, serverID, category string) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM alert_routes WHERE telegram_id = ? AND server_id = ? AND category = ?`, telegramID, serverID, category)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// ListAlertRoutes retrieves the alert routes of all users
+func (r *MySQLRepository) ListAlertRoutes(ctx context.Context) ([]models.AlertRoute, error) {
+	query := `
+SELECT id, telegram_id, server_id, category, chat_id, created_at
+FROM alert_routes
+ORDER BY telegram_id, server_id, category
+`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var routes []models.AlertRoute
+	for rows.Next() {
+		var route models.AlertRoute
+		if err := rows.Scan(&route.ID, &route.TelegramID, &route.ServerID, &route.Category, &route.ChatID, &route.CreatedAt); err != nil {
+			return nil, err
+		}
+		routes = append(routes, route)
+	}
+
+	return routes, rows.Err()
+}
+
+// AddUptimeCheck stores an uptime check and sets its ID
+func (r *MySQLRepository) AddUptimeCheck(ctx context.Context, check *models.UptimeCheck) error {
+	query := `
+INSERT INTO uptime_checks (telegram_id, server_id, kind, target, interval_seconds)
+VALUES (?, ?, ?, ?, ?)
+`
+
+	result, err := r.db.ExecContext(ctx, query, check.TelegramID, check.ServerID, check.Kind, check.Target, check.IntervalSeconds)
+	if err != nil {
+		return err
+	}
+
+	check.ID, err = result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	check.CreatedAt = time.Now()
+	return nil
+}
+
+// DeleteUptimeCheck removes an uptime check with its history, reporting whether it existed
+func (r *MySQLRepository) DeleteUptimeCheck(ctx context.Context, id int64) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM uptime_checks WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// ListUptimeChecks retrieves the uptime checks of all users
+func (r *MySQLRepository) ListUptimeChecks(ctx context.Context) ([]models.UptimeCheck, error) {
+	query := `
+SELECT id, telegram_id, server_id, kind, target, interval_seconds, up, checked_at, changed_at, created_at
+FROM uptime_checks
+ORDER BY id
+`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var checks []models.UptimeCheck
+	for rows.Next() {
+		var check models.UptimeCheck
+		if err := rows.Scan(&check.ID, &check.TelegramID, &check.ServerID, &check.Kind, &check.Target, &check.IntervalSeconds,
+			&check.Up, &check.CheckedAt, &check.ChangedAt, &check.CreatedAt); err != nil {
+			return nil, err
+		}
+		checks = append(checks, check)
+	}
+
+	return checks, rows.Err()
+}
+
+// RecordUptimeResult stores a probe and the resulting state of its check
+func (r *MySQLRepository) RecordUptimeResult(ctx context.Context, result *models.UptimeResult, check *models.UptimeCheck) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	query := `
+INSERT INTO uptime_check_results (check_id, up, latency_ms, status_code, error, checked_at)
+VALUES (?, ?, ?, ?, ?, ?)
+`
+	inserted, err := tx.ExecContext(ctx, query, result.CheckID, result.Up, result.LatencyMs, result.StatusCode, result.Error, result.CheckedAt)
+	if err != nil {
+		return err
+	}
+	if result.ID, err = inserted.LastInsertId(); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `UPDATE uptime_checks SET up = ?, checked_at = ?, changed_at = ? WHERE id = ?`,
+		check.Up, check.CheckedAt, check.ChangedAt, check.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ListUptimeResults retrieves the probes of a check since a time, newest first
+func (r *MySQLRepository) ListUptimeResults(ctx context.Context, checkID int64, since time.Time) ([]models.UptimeResult, error) {
+	query := `
+SELECT id, check_id, up, latency_ms, status_code, error, checked_at
+FROM uptime_check_results
+WHERE check_id = ? AND checked_at >= ?
+ORDER BY checked_at DESC
+`
+
+	rows, err := r.db.QueryContext(ctx, query, checkID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var results []models.UptimeResult
+	for rows.Next() {
+		var result models.UptimeResult
+		if err := rows.Scan(&result.ID, &result.CheckID, &result.Up, &result.LatencyMs, &result.StatusCode, &result.Error, &result.CheckedAt); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// DeleteUptimeResultsBefore removes the probes older than a time
+func (r *MySQLRepository) DeleteUptimeResultsBefore(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM uptime_check_results WHERE checked_at < ?`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GrantServerGuest gives the guest role on the server to the server and stores or extends the grant
+func (r *MySQLRepository) GrantServerGuest(ctx context.Context, guest *models.ServerGuest) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, `INSERT IGNORE INTO user_servers (user_id, server_id, role) VALUES (?, ?, 'guest')`, guest.UserID, guest.ServerID); err != nil {
+		return err
+	}
+
+	query := `
+INSERT INTO server_guests (server_id, user_id, granted_by, expires_at)
+VALUES (?, ?, ?, ?)
+ON DUPLICATE KEY UPDATE
+id = LAST_INSERT_ID(id),
+granted_by = VALUES(granted_by),
+expires_at = VALUES(expires_at)
+`
+	result, err := tx.ExecContext(ctx, query, guest.ServerID, guest.UserID, guest.GrantedBy, guest.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	if guest.ID, err = result.LastInsertId(); err != nil {
+		return err
+	}
+	guest.CreatedAt = time.Now()
+
+	return tx.Commit()
+}
+
+// RevokeServerGuest removes a grant and the guest role it gave, reporting whether it existed
+func (r *MySQLRepository) RevokeServerGuest(ctx context.Context, serverID string, userID int64) (revoked bool, err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM server_guests WHERE server_id = ? AND user_id = ?`, serverID, userID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	if affected > 0 {
+		if _, err = tx.ExecContext(ctx, `DELETE FROM user_servers WHERE user_id = ? AND server_id = ? AND role = 'guest'`, userID, serverID); err != nil {
+			return false, err
+		}
+	}
+
+	return affected > 0, tx.Commit()
+}
+
+// ListServerGuests retrieves the guests of a server, soonest expiring first
+func (r *MySQLRepository) ListServerGuests(ctx context.Context, serverID string) ([]models.ServerGuest, error) {
+	return r.queryServerGuests(ctx, `WHERE g.server_id = ?`, serverID)
+}
+
+// ListExpiredServerGuests retrieves the grants of all servers that expired by now
+func (r *MySQLRepository) ListExpiredServerGuests(ctx context.Context, now time.Time) ([]models.ServerGuest, error) {
+	return r.queryServerGuests(ctx, `WHERE g.expires_at <= ?`, now)
+}
+
+// queryServerGuests retrieves the grants matching a WHERE clause with their guests
+func (r *MySQLRepository) queryServerGuests(ctx context.Context, where string, arg interface{}) ([]models.ServerGuest, error) {
+	query := `
+SELECT g.id, g.server_id, COALESCE(s.name, g.server_id), g.user_id, u.telegram_id, COALESCE(u.username, ''), g.granted_by, g.expires_at, g.created_at
+FROM server_guests g
+INNER JOIN users u ON u.id = g.user_id
+LEFT JOIN servers s ON s.server_id = g.server_id
+` + where + `
+ORDER BY g.expires_at, g.id
+`
+
+	rows, err := r.db.QueryContext(ctx, query, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var guests []models.ServerGuest
+	for rows.Next() {
+		var guest models.ServerGuest
+		if err := rows.Scan(&guest.ID, &guest.ServerID, &guest.ServerName, &guest.UserID, &guest.TelegramID, &guest.Username,
+			&guest.GrantedBy, &guest.ExpiresAt, &guest.CreatedAt); err != nil {
+			return nil, err
+		}
+		guests = append(guests, guest)
+	}
+
+	return guests, rows.Err()
+}
+
+// SoftDeleteUser deactivates a user, clears their profile and removes their servers,
+// alerts and settings
+func (r *MySQLRepository) SoftDeleteUser(ctx context.Context, userID, telegramID int64, deletedAt time.Time) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, `
+UPDATE users SET username = '', first_name = '', last_name = '', is_active = false, deleted_at = ?, updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+`, deletedAt, userID); err != nil {
+		return err
+	}
+
+	for _, query := range []string{
+		`DELETE FROM user_servers WHERE user_id = ?`,
+		`DELETE FROM server_guests WHERE user_id = ?`,
+		`DELETE FROM chat_servers WHERE bound_by = ?`,
+		`DELETE FROM pairing_codes WHERE user_id = ?`,
+		`DELETE FROM notification_channels WHERE user_id = ?`,
+		`DELETE FROM report_schedules WHERE user_id = ?`,
+		`DELETE FROM user_settings WHERE user_id = ?`,
+	} {
+		if _, err = tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+	}
+	for _, query := range []string{
+		`DELETE FROM alert_routes WHERE telegram_id = ?`,
+		`DELETE FROM uptime_checks WHERE telegram_id = ?`,
+	} {
+		if _, err = tx.ExecContext(ctx, query, telegramID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ListActiveTelegramIDs retrieves the Telegram IDs of all active users
+func (r *MySQLRepository) ListActiveTelegramIDs(ctx context.Context) ([]int64, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT telegram_id FROM users WHERE is_active = true ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// GetUserStats counts users registered and seen within a day, week and month of now
+func (r *MySQLRepository) GetUserStats(ctx context.Context, now time.Time) (*models.UserStats, error) {
+	query := `
+SELECT COUNT(*),
+       COALESCE(SUM(CASE WHEN is_active = true THEN 1 ELSE 0 END), 0),
+       COALESCE(SUM(CASE WHEN is_admin = true AND is_active = true THEN 1 ELSE 0 END), 0),
+       COALESCE(SUM(CASE WHEN deleted_at IS NOT NULL THEN 1 ELSE 0 END), 0),
+       COALESCE(SUM(CASE WHEN created_at >= ? THEN 1 ELSE 0 END), 0),
+       COALESCE(SUM(CASE WHEN created_at >= ? THEN 1 ELSE 0 END), 0),
+       COALESCE(SUM(CASE WHEN created_at >= ? THEN 1 ELSE 0 END), 0),
+       COALESCE(SUM(CASE WHEN is_active = true AND updated_at >= ? THEN 1 ELSE 0 END), 0),
+       COALESCE(SUM(CASE WHEN is_active = true AND updated_at >= ? THEN 1 ELSE 0 END), 0),
+       COALESCE(SUM(CASE WHEN is_active = true AND updated_at >= ? THEN 1 ELSE 0 END), 0)
+FROM users
+`
+
+	day, week, month := now.Add(-24*time.Hour), now.Add(-7*24*time.Hour), now.Add(-30*24*time.Hour)
+
+	var stats models.UserStats
+	err := r.db.QueryRowContext(ctx, query, day, week, month, day, week, month).Scan(
+		&stats.Total, &stats.Active, &stats.Admins, &stats.Deleted,
+		&stats.NewDay, &stats.NewWeek, &stats.NewMonth,
+		&stats.SeenDay, &stats.SeenWeek, &stats.SeenMonth,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+// ListUsers retrieves a page of users with their server counts, most recently seen first
+func (r *MySQLRepository) ListUsers(ctx context.Context, offset, limit int) ([]models.UserSummary, error) {
+	query := `
+SELECT u.id, u.telegram_id, COALESCE(u.username, ''), COALESCE(u.first_name, ''), COALESCE(u.last_name, ''),
+       u.is_admin, u.is_active, u.created_at, u.updated_at,
+       (SELECT COUNT(*) FROM user_servers us WHERE us.user_id = u.id)
+FROM users u
+ORDER BY u.updated_at DESC, u.id DESC
+LIMIT ? OFFSET ?
+`
+
+	rows, err := r.db.QueryContext(ctx, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var users []models.UserSummary
+	for rows.Next() {
+		var user models.UserSummary
+		if err := rows.Scan(
+			&user.ID, &user.TelegramID, &user.Username, &user.FirstName, &user.LastName,
+			&user.IsAdmin, &user.IsActive, &user.CreatedAt, &user.UpdatedAt, &user.Servers,
+		); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// InsertMetricSamples stores metric samples in bulk with multi-row inserts
+func (r *MySQLRepository) InsertMetricSamples(ctx context.Context, samples []models.MetricSample) error {
+	for start := 0; start < len(samples); start += maxMetricRowsPerInsert {
+		end := start + maxMetricRowsPerInsert
+		if end > len(samples) {
+			end = len(samples)
+		}
+		batch := samples[start:end]
+
+		placeholders := make([]string, len(batch))
+		args := make([]interface{}, 0, len(batch)*4)
+		for i, sample := range batch {
+			placeholders[i] = "(?, ?, ?, ?)"
+			args = append(args, sample.ServerKey, sample.Name, sample.Value, sample.CollectedAt)
+		}
+
+		query := `INSERT INTO metrics_history (server_key, name, value, collected_at) VALUES ` + strings.Join(placeholders, ", ")
+		if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetMetricPeak retrieves the highest sample of a metric collected since the given time.
+// It returns sql.ErrNoRows when there are no samples.
+func (r *MySQLRepository) GetMetricPeak(ctx context.Context, serverKey, name string, since time.Time) (*models.MetricSample, error) {
+	query := `
+SELECT server_key, name, value, collected_at
+FROM metrics_history
+WHERE server_key = ? AND name = ? AND collected_at >= ?
+ORDER BY value DESC, collected_at DESC
+LIMIT 1
+`
+
+	var sample models.MetricSample
+	err := r.db.QueryRowContext(ctx, query, serverKey, name, since).Scan(
+		&sample.ServerKey, &sample.Name, &sample.Value, &sample.CollectedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sample, nil
+}
+
+// ListBusiestMetricHours aggregates a metric by hour since the given time and returns
+// the hours with the highest average, busiest first
+func (r *MySQLRepository) ListBusiestMetricHours(ctx context.Context, serverKey, name string, since time.Time, limit int) ([]models.MetricHour, error) {
+	query := `
+SELECT TIMESTAMP(DATE_FORMAT(collected_at, '%Y-%m-%d %H:00:00')) AS hour, AVG(value), MAX(value), COUNT(*)
+FROM metrics_history
+WHERE server_key = ? AND name = ? AND collected_at >= ?
+GROUP BY hour
+ORDER BY AVG(value) DESC, hour DESC
+LIMIT ?
+`
+
+	rows, err := r.db.QueryContext(ctx, query, serverKey, name, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var hours []models.MetricHour
+	for rows.Next() {
+		var hour models.MetricHour
+		if err := rows.Scan(&hour.Hour, &hour.Avg, &hour.Max, &hour.Samples); err != nil {
+			return nil, err
+		}
+		hours = append(hours, hour)
+	}
+
+	return hours, rows.Err()
+}
+
+// GetMetricSummary summarizes the samples of a metric collected since the given time.
+// It returns sql.ErrNoRows when there are no samples.
+func (r *MySQLRepository) GetMetricSummary(ctx context.Context, serverKey, name string, since time.Time) (*models.MetricSummary, error) {
+	query := `
+SELECT AVG(value), COUNT(*),
+       SUBSTRING_INDEX(GROUP_CONCAT(value ORDER BY collected_at ASC), ',', 1),
+       SUBSTRING_INDEX(GROUP_CONCAT(value ORDER BY collected_at DESC), ',', 1)
+FROM metrics_history
+WHERE server_key = ? AND name = ? AND collected_at >= ?
+HAVING COUNT(*) > 0
+`
+
+	var summary models.MetricSummary
+	err := r.db.QueryRowContext(ctx, query, serverKey, name, since).Scan(
+		&summary.Avg, &summary.Samples, &summary.First, &summary.Last,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &summary, nil
+}
+
+// UpsertCustomCommand creates a custom command or replaces the one with the same name on the server
+func (r *MySQLRepository) UpsertCustomCommand(ctx context.Context, command *models.CustomCommand) error {
+	query := `
+INSERT INTO custom_commands (server_id, name, script, required_role, created_by)
+VALUES (?, ?, ?, ?, NULLIF(?, 0))
+ON DUPLICATE KEY UPDATE
+script = VALUES(script),
+required_role = VALUES(required_role),
+created_by = VALUES(created_by),
+created_at = CURRENT_TIMESTAMP
+`
+
+	if _, err := r.db.ExecContext(ctx, query, command.ServerID, command.Name, command.Script, command.RequiredRole, command.CreatedBy); err != nil {
+		return err
+	}
+
+	return r.db.QueryRowContext(ctx, `SELECT id, created_at FROM custom_commands WHERE server_id = ? AND name = ?`, command.ServerID, command.Name).
+		Scan(&command.ID, &command.CreatedAt)
+}
+
+// DeleteCustomCommand removes a custom command of a server, reporting whether it existed
+func (r *MySQLRepository) DeleteCustomCommand(ctx context.Context, serverID, name string) (bool, error) {
+	query := `DELETE FROM custom_commands WHERE server_id = ? AND name = ?`
+
+	result, err := r.db.ExecContext(ctx, query, serverID, name)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// ListCustomCommands retrieves custom commands of all servers
+func (r *MySQLRepository) ListCustomCommands(ctx context.Context) ([]models.CustomCommand, error) {
+	query := `
+SELECT id, server_id, name, script, required_role, COALESCE(created_by, 0), created_at
+FROM custom_commands
+ORDER BY name, server_id
+`
+
+	return r.queryCustomCommands(ctx, query)
+}
+
+// CreatePairingCode stores a new pairing code
+func (r *MySQLRepository) CreatePairingCode(ctx context.Context, code *models.PairingCode) error {
+	query := `INSERT INTO pairing_codes (code, user_id, telegram_id, expires_at) VALUES (?, ?, ?, ?)`
+
+	result, err := r.db.ExecContext(ctx, query, code.Code, code.UserID, code.TelegramID, code.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	if code.ID, err = result.LastInsertId(); err != nil {
+		return err
+	}
+	code.CreatedAt = time.Now()
+	return nil
+}
+
+// ClaimPairingCode marks an unused, unexpired code as used by a server
+func (r *MySQLRepository) ClaimPairingCode(ctx context.Context, code, serverID string, now time.Time) (*models.PairingCode, error) {
+	query := `
+UPDATE pairing_codes SET used_at = ?, server_id = ?
+WHERE code = ? AND used_at IS NULL AND expires_at > ?
+`
+
+	result, err := r.db.ExecContext(ctx, query, now, serverID, code, now)
+	if err != nil {
+		return nil, err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if affected == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	query = `
+SELECT id, code, user_id, telegram_id, server_id, expires_at, used_at, created_at
+FROM pairing_codes WHERE code = ?
+`
+
+	var pairing models.PairingCode
+	err = r.db.QueryRowContext(ctx, query, code).Scan(
+		&pairing.ID, &pairing.Code, &pairing.UserID, &pairing.TelegramID, &pairing.ServerID,
+		&pairing.ExpiresAt, &pairing.UsedAt, &pairing.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pairing, nil
+}
+
+// DeleteExpiredPairingCodes removes codes that expired before the given time
+func (r *MySQLRepository) DeleteExpiredPairingCodes(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM pairing_codes WHERE expires_at <= ?`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// CreateAccountLinkCode stores a new account link code
+func (r *MySQLRepository) CreateAccountLinkCode(ctx context.Context, code *models.AccountLinkCode) error {
+	query := `INSERT INTO account_link_codes (code, user_id, telegram_id, expires_at) VALUES (?, ?, ?, ?)`
+
+	result, err := r.db.ExecContext(ctx, query, code.Code, code.UserID, code.TelegramID, code.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	if code.ID, err = result.LastInsertId(); err != nil {
+		return err
+	}
+	code.CreatedAt = time.Now()
+	return nil
+}
+
+// ClaimAccountLinkCode marks an unused, unexpired code as used by a web account
+func (r *MySQLRepository) ClaimAccountLinkCode(ctx context.Context, code, webUserID string, now time.Time) (*models.AccountLinkCode, error) {
+	query := `
+UPDATE account_link_codes SET used_at = ?, web_user_id = ?
+WHERE code = ? AND used_at IS NULL AND expires_at > ?
+`
+
+	result, err := r.db.ExecContext(ctx, query, now, webUserID, code, now)
+	if err != nil {
+		return nil, err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if affected == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	query = `
+SELECT id, code, user_id, telegram_id, web_user_id, expires_at, used_at, created_at
+FROM account_link_codes WHERE code = ?
+`
+
+	var link models.AccountLinkCode
+	err = r.db.QueryRowContext(ctx, query, code).Scan(
+		&link.ID, &link.Code, &link.UserID, &link.TelegramID, &link.WebUserID,
+		&link.ExpiresAt, &link.UsedAt, &link.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &link, nil
+}
+
+// DeleteExpiredAccountLinkCodes removes codes that expired before the given time
+func (r *MySQLRepository) DeleteExpiredAccountLinkCodes(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM account_link_codes WHERE expires_at <= ?`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ReplaceLinkedAccount stores a linked account, replacing the previous links of both the
+// user and the web account
+func (r *MySQLRepository) ReplaceLinkedAccount(ctx context.Context, account *models.LinkedAccount) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM linked_accounts WHERE user_id = ? OR web_user_id = ?`, account.UserID, account.WebUserID); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO linked_accounts (user_id, telegram_id, web_user_id, token_hash) VALUES (?, ?, ?, ?)`
+	result, err := tx.ExecContext(ctx, query, account.UserID, account.TelegramID, account.WebUserID, account.TokenHash)
+	if err != nil {
+		return err
+	}
+	if account.ID, err = result.LastInsertId(); err != nil {
+		return err
+	}
+	account.CreatedAt = time.Now()
+
+	return tx.Commit()
+}
+
+// GetLinkedAccountByToken returns the account a token hash was issued to and records its use
+func (r *MySQLRepository) GetLinkedAccountByToken(ctx context.Context, tokenHash string, now time.Time) (*models.LinkedAccount, error) {
+	if _, err := r.db.ExecContext(ctx, `UPDATE linked_accounts SET last_used_at = ? WHERE token_hash = ?`, now, tokenHash); err != nil {
+		return nil, err
+	}
+
+	return r.queryLinkedAccount(ctx, `WHERE token_hash = ?`, tokenHash)
+}
+
+// GetLinkedAccount returns the linked account of a user
+func (r *MySQLRepository) GetLinkedAccount(ctx context.Context, userID int64) (*models.LinkedAccount, error) {
+	return r.queryLinkedAccount(ctx, `WHERE user_id = ?`, userID)
+}
+
+// DeleteLinkedAccount removes the linked account of a user, reporting whether it existed
+func (r *MySQLRepository) DeleteLinkedAccount(ctx context.Context, userID int64) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM linked_accounts WHERE user_id = ?`, userID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// queryLinkedAccount retrieves the linked account matching a WHERE clause
+func (r *MySQLRepository) queryLinkedAccount(ctx context.Context, where string, args ...interface{}) (*models.LinkedAccount, error) {
+	query := `
+SELECT id, user_id, telegram_id, web_user_id, token_hash, last_used_at, created_at
+FROM linked_accounts ` + where
+
+	var account models.LinkedAccount
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(
+		&account.ID, &account.UserID, &account.TelegramID, &account.WebUserID, &account.TokenHash,
+		&account.LastUsedAt, &account.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &account, nil
+}
+
+// GetServerKey retrieves the key versions of the server an agent key belongs to,
+// matching the current, pending and previous keys. It returns sql.ErrNoRows for unknown keys.
+func (r *MySQLRepository) GetServerKey(ctx context.Context, key string) (*models.ServerKey, error) {
+	return r.queryServerKey(ctx, `WHERE COALESCE(server_key, server_id) = ? OR pending_key = ? OR previous_key = ?`, key, key, key)
+}
+
+// SetPendingServerKey stores a newly issued key of a server until its agent picks it up.
+// It returns sql.ErrNoRows when the server does not exist.
+func (r *MySQLRepository) SetPendingServerKey(ctx context.Context, serverID, key string, rotatedBy int64) error {
+	result, err := r.db.ExecContext(ctx, `UPDATE servers SET pending_key = ?, key_rotated_by = ? WHERE server_id = ?`, key, rotatedBy, serverID)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// PromoteServerKey makes the pending key of a server current, keeping the replaced key
+// valid until previousExpiresAt. It returns sql.ErrNoRows when no key is pending.
+func (r *MySQLRepository) PromoteServerKey(ctx context.Context, serverID string, previousExpiresAt time.Time) (*models.ServerKey, error) {
+	// MySQL assigns left to right, so the previous key is saved before server_key changes
+	query := `
+UPDATE servers
+SET previous_key = COALESCE(server_key, server_id), previous_key_expires_at = ?,
+    server_key = pending_key, pending_key = NULL, key_version = key_version + 1
+WHERE server_id = ? AND pending_key IS NOT NULL
+`
+
+	result, err := r.db.ExecContext(ctx, query, previousExpiresAt, serverID)
+	if err != nil {
+		return nil, err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if affected == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return r.queryServerKey(ctx, `WHERE server_id = ?`, serverID)
+}
+
+// ExpirePreviousServerKeys invalidates replaced keys whose grace window ended before the given time
+func (r *MySQLRepository) ExpirePreviousServerKeys(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `UPDATE servers SET previous_key = NULL, previous_key_expires_at = NULL WHERE previous_key_expires_at <= ?`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetServerSecret retrieves the end-to-end secret of the server an agent key belongs to,
+// matching the current, pending and previous keys. It returns sql.ErrNoRows for unknown
+// keys and servers without a secret.
+func (r *MySQLRepository) GetServerSecret(ctx context.Context, key string) (string, error) {
+	var secret string
+	if err := r.db.QueryRowContext(ctx, `SELECT e2e_secret FROM servers WHERE (COALESCE(server_key, server_id) = ? OR pending_key = ? OR previous_key = ?) AND e2e_secret IS NOT NULL`, key, key, key).Scan(&secret); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// SetServerSecret stores the end-to-end secret of a server.
+// It returns sql.ErrNoRows when the server does not exist.
+func (r *MySQLRepository) SetServerSecret(ctx context.Context, serverID, secret string) error {
+	result, err := r.db.ExecContext(ctx, `UPDATE servers SET e2e_secret = ? WHERE server_id = ?`, secret, serverID)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// queryServerKey scans the key versions of the server matched by the where clause
+func (r *MySQLRepository) queryServerKey(ctx context.Context, where string, args ...interface{}) (*models.ServerKey, error) {
+	query := `
+SELECT server_id, COALESCE(server_key, server_id), key_version, COALESCE(pending_key, ''),
+       COALESCE(previous_key, ''), previous_key_expires_at, COALESCE(key_rotated_by, 0)
+FROM servers
+` + where
+
+	var key models.ServerKey
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(
+		&key.ServerID, &key.Key, &key.Version, &key.PendingKey,
+		&key.PreviousKey, &key.PreviousExpiresAt, &key.RotatedBy,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+// queryCommandHistory scans command history rows returned by query
+func (r *MySQLRepository) queryCommandHistory(ctx context.Context, query string, args ...interface{}) ([]models.CommandHistory, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var entries []models.CommandHistory
+	for rows.Next() {
+		var entry models.CommandHistory
+		err := rows.Scan(
+			&entry.ID, &entry.UserID, &entry.TelegramID, &entry.ServerID, &entry.Command, &entry.Payload,
+			&entry.Envelope, &entry.Response, &entry.Success, &entry.Error, &entry.DurationMs, &entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// queryCustomCommands scans custom command rows returned by query
+func (r *MySQLRepository) queryCustomCommands(ctx context.Context, query string, args ...interface{}) ([]models.CustomCommand, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var commands []models.CustomCommand
+	for rows.Next() {
+		var command models.CustomCommand
+		err := rows.Scan(
+			&command.ID, &command.ServerID, &command.Name, &command.Script,
+			&command.RequiredRole, &command.CreatedBy, &command.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, command)
+	}
+
+	return commands, rows.Err()
+}
+
+// EnqueueOutboxMessages stores messages to send, setting their IDs
+func (r *MySQLRepository) EnqueueOutboxMessages(ctx context.Context, messages []*models.OutboxMessage) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	query := `
+INSERT INTO alert_outbox (chat_id, telegram_id, text, keyboard, quiet, next_attempt_at, last_error)
+VALUES (?, ?, ?, ?, ?, ?, '')
+`
+	now := time.Now()
+	for _, message := range messages {
+		result, execErr := tx.ExecContext(ctx, query, message.ChatID, message.TelegramID, message.Text, message.Keyboard,
+			message.Quiet, message.NextAttemptAt)
+		if execErr != nil {
+			return execErr
+		}
+		if message.ID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+		message.CreatedAt = now
+	}
+
+	return tx.Commit()
+}
+
+// ClaimOutboxMessages returns up to limit pending messages due by now, moving their next
+// attempt to leaseUntil. Each message is claimed with a conditional update, so messages
+// claimed by another replica meanwhile are skipped.
+func (r *MySQLRepository) ClaimOutboxMessages(ctx context.Context, now, leaseUntil time.Time, limit int) ([]*models.OutboxMessage, error) {
+	query := `
+SELECT id, chat_id, telegram_id, text, keyboard, quiet, attempts, next_attempt_at, last_error, delivered_at, failed_at, created_at
+FROM alert_outbox
+WHERE delivered_at IS NULL AND failed_at IS NULL AND next_attempt_at <= ?
+ORDER BY id
+LIMIT ?
+`
+
+	rows, err := r.db.QueryContext(ctx, query, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := scanOutboxMessages(rows)
+	_ = rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var claimed []*models.OutboxMessage
+	for _, message := range candidates {
+		result, err := r.db.ExecContext(ctx, `UPDATE alert_outbox SET next_attempt_at = ? WHERE id = ? AND next_attempt_at = ? AND delivered_at IS NULL AND failed_at IS NULL`,
+			leaseUntil, message.ID, message.NextAttemptAt)
+		if err != nil {
+			return nil, err
+		}
+		if affected, err := result.RowsAffected(); err != nil {
+			return nil, err
+		} else if affected == 1 {
+			message.NextAttemptAt = leaseUntil
+			claimed = append(claimed, message)
+		}
+	}
+
+	return claimed, nil
+}
+
+// MarkOutboxDelivered records the delivery of a message
+func (r *MySQLRepository) MarkOutboxDelivered(ctx context.Context, id int64, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE alert_outbox SET delivered_at = ? WHERE id = ?`, at, id)
+	return err
+}
+
+// RescheduleOutboxMessage records a failed attempt and when to retry
+func (r *MySQLRepository) RescheduleOutboxMessage(ctx context.Context, id int64, attempts int, nextAttemptAt time.Time, lastError string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE alert_outbox SET attempts = ?, next_attempt_at = ?, last_error = ? WHERE id = ?`,
+		attempts, nextAttemptAt, lastError, id)
+	return err
+}
+
+// MarkOutboxFailed records the last failed attempt of a message that is not retried
+func (r *MySQLRepository) MarkOutboxFailed(ctx context.Context, id int64, attempts int, at time.Time, lastError string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE alert_outbox SET attempts = ?, failed_at = ?, last_error = ? WHERE id = ?`,
+		attempts, at, lastError, id)
+	return err
+}
+
+// DeleteOutboxMessages removes delivered and failed messages created before the given time
+func (r *MySQLRepository) DeleteOutboxMessages(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM alert_outbox WHERE created_at < ? AND (delivered_at IS NOT NULL OR failed_at IS NOT NULL)`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
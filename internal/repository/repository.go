@@ -0,0 +1,316 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+)
+
+// UserStore persists users and their servers
+type UserStore interface {
+	CreateUser(user *models.User) error
+	GetUser(userID int64) (*models.User, error)
+	GetUserByID(userID int64) (*models.User, error)
+	AddServerToUser(userID int64, serverID, source string) error
+	GetUserServers(userID int64) ([]models.ServerWithDetails, error)
+	RemoveServerFromUser(userID int64, serverID string) error
+	IsServerOwnedByUser(userID int64, serverID string) (bool, error)
+	UpdateServerName(ctx context.Context, serverID, newName string) error
+	SetServerRole(ctx context.Context, userID int64, serverID, role string) error
+	ListAdminTelegramIDs(ctx context.Context) ([]int64, error)
+	ListAlertTargets(ctx context.Context) ([]models.AlertTarget, error)
+	// GetUserByUsername retrieves a user by Telegram username, without the leading @
+	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
+	// SoftDeleteUser deactivates a user, clears their profile and removes their servers,
+	// alerts and settings. The command audit log is kept.
+	SoftDeleteUser(ctx context.Context, userID, telegramID int64, deletedAt time.Time) error
+	ListActiveTelegramIDs(ctx context.Context) ([]int64, error)
+	// GetUserStats counts users registered and seen within a day, week and month of now
+	GetUserStats(ctx context.Context, now time.Time) (*models.UserStats, error)
+	// ListUsers retrieves a page of users, most recently seen first
+	ListUsers(ctx context.Context, offset, limit int) ([]models.UserSummary, error)
+}
+
+// ReportStore persists user timezones and report schedules
+type ReportStore interface {
+	SetUserTimezone(ctx context.Context, userID int64, timezone string) error
+	GetUserTimezone(ctx context.Context, userID int64) (string, error)
+	UpsertReportSchedule(ctx context.Context, schedule *models.ReportSchedule) error
+	GetReportSchedule(ctx context.Context, userID int64) (*models.ReportSchedule, error)
+	SetReportTemplate(ctx context.Context, userID int64, sections, serverOrder string) error
+	DeleteReportSchedule(ctx context.Context, userID int64) error
+	ListReportSchedules(ctx context.Context) ([]models.ReportSchedule, error)
+	// MarkReportSent records the delivery of a scheduled report, clearing failed attempts
+	MarkReportSent(ctx context.Context, scheduleID int64, sentAt time.Time) error
+	// MarkReportFailed records a failed delivery of a scheduled report and when to retry it
+	MarkReportFailed(ctx context.Context, scheduleID int64, attempts int, retryAt time.Time) error
+}
+
+// AlertLogStore records the alerts users were sent about their servers
+type AlertLogStore interface {
+	InsertAlertLog(ctx context.Context, entries []models.AlertLogEntry) error
+	CountAlerts(ctx context.Context, telegramID int64, serverID string, since time.Time) (int, error)
+	DeleteAlertLog(ctx context.Context, before time.Time) (int64, error)
+}
+
+// SettingsStore persists the preferences of users
+type SettingsStore interface {
+	// GetUserSettings retrieves the settings of a user, the defaults when none are stored.
+	// It returns sql.ErrNoRows when the user does not exist.
+	GetUserSettings(ctx context.Context, userID int64) (*models.UserSettings, error)
+	// GetUserSettingsByTelegramID retrieves the settings of a user by Telegram ID
+	GetUserSettingsByTelegramID(ctx context.Context, telegramID int64) (*models.UserSettings, error)
+	// UpsertUserSettings stores the settings of a user, except the timezone kept with the user
+	UpsertUserSettings(ctx context.Context, settings *models.UserSettings) error
+}
+
+// AuditStore persists the command audit log
+type AuditStore interface {
+	CreateCommandHistory(ctx context.Context, entry *models.CommandHistory) error
+	GetCommandHistory(ctx context.Context, id int64) (*models.CommandHistory, error)
+	ListCommandHistoryForUser(ctx context.Context, userID int64, limit int) ([]models.CommandHistory, error)
+	ListCommandHistory(ctx context.Context, limit int) ([]models.CommandHistory, error)
+}
+
+// MetricsStore persists historical server metrics
+type MetricsStore interface {
+	InsertMetricSamples(ctx context.Context, samples []models.MetricSample) error
+	GetMetricPeak(ctx context.Context, serverKey, name string, since time.Time) (*models.MetricSample, error)
+	ListBusiestMetricHours(ctx context.Context, serverKey, name string, since time.Time, limit int) ([]models.MetricHour, error)
+	// GetMetricSummary summarizes the samples of a metric collected since the given time,
+	// sql.ErrNoRows when there are none
+	GetMetricSummary(ctx context.Context, serverKey, name string, since time.Time) (*models.MetricSummary, error)
+}
+
+// CommandStore persists custom user-defined commands
+type CommandStore interface {
+	UpsertCustomCommand(ctx context.Context, command *models.CustomCommand) error
+	DeleteCustomCommand(ctx context.Context, serverID, name string) (bool, error)
+	ListCustomCommands(ctx context.Context) ([]models.CustomCommand, error)
+}
+
+// PairingStore persists one-time agent pairing codes
+type PairingStore interface {
+	CreatePairingCode(ctx context.Context, code *models.PairingCode) error
+	// ClaimPairingCode marks an unused, unexpired code as used by a server.
+	// It returns sql.ErrNoRows when no such code exists.
+	ClaimPairingCode(ctx context.Context, code, serverID string, now time.Time) (*models.PairingCode, error)
+	DeleteExpiredPairingCodes(ctx context.Context, before time.Time) (int64, error)
+}
+
+// AccountLinkStore persists one-time web account link codes and the linked accounts
+type AccountLinkStore interface {
+	CreateAccountLinkCode(ctx context.Context, code *models.AccountLinkCode) error
+	// ClaimAccountLinkCode marks an unused, unexpired code as used by a web account.
+	// It returns sql.ErrNoRows when no such code exists.
+	ClaimAccountLinkCode(ctx context.Context, code, webUserID string, now time.Time) (*models.AccountLinkCode, error)
+	DeleteExpiredAccountLinkCodes(ctx context.Context, before time.Time) (int64, error)
+	// ReplaceLinkedAccount stores a linked account, replacing the previous links of both
+	// the user and the web account, and sets its ID
+	ReplaceLinkedAccount(ctx context.Context, account *models.LinkedAccount) error
+	// GetLinkedAccountByToken returns the account a token hash was issued to and records
+	// its use. It returns sql.ErrNoRows for unknown tokens.
+	GetLinkedAccountByToken(ctx context.Context, tokenHash string, now time.Time) (*models.LinkedAccount, error)
+	// GetLinkedAccount returns the linked account of a user or sql.ErrNoRows
+	GetLinkedAccount(ctx context.Context, userID int64) (*models.LinkedAccount, error)
+	DeleteLinkedAccount(ctx context.Context, userID int64) (bool, error)
+}
+
+// KeyStore persists key versions of server agents
+type KeyStore interface {
+	GetServerKey(ctx context.Context, key string) (*models.ServerKey, error)
+	SetPendingServerKey(ctx context.Context, serverID, key string, rotatedBy int64) error
+	PromoteServerKey(ctx context.Context, serverID string, previousExpiresAt time.Time) (*models.ServerKey, error)
+	ExpirePreviousServerKeys(ctx context.Context, before time.Time) (int64, error)
+	// GetServerSecret retrieves the end-to-end secret of the server an agent key belongs to.
+	// It returns sql.ErrNoRows for unknown keys and servers without a secret.
+	GetServerSecret(ctx context.Context, key string) (string, error)
+	SetServerSecret(ctx context.Context, serverID, secret string) error
+}
+
+// TagStore persists server tags and their metadata
+type TagStore interface {
+	AddServerTag(ctx context.Context, serverID, tag string) error
+	RemoveServerTag(ctx context.Context, serverID, tag string) (bool, error)
+	ListServerTags(ctx context.Context) ([]models.ServerTag, error)
+	UpsertTag(ctx context.Context, tag *models.Tag) error
+	ListTags(ctx context.Context) ([]models.Tag, error)
+}
+
+// NotifyStore persists external notification channels of users
+type NotifyStore interface {
+	AddNotificationChannel(ctx context.Context, channel *models.NotificationChannel) error
+	RemoveNotificationChannel(ctx context.Context, userID, id int64) (bool, error)
+	ListNotificationChannels(ctx context.Context, telegramID int64) ([]models.NotificationChannel, error)
+}
+
+// ChatStore persists servers attached to group chats
+type ChatStore interface {
+	BindChatServer(ctx context.Context, binding *models.ChatServer) error
+	UnbindChatServer(ctx context.Context, chatID int64, serverID string) (bool, error)
+	ListChatServers(ctx context.Context, chatID int64) ([]models.ServerWithDetails, error)
+	ListChatBindings(ctx context.Context) ([]models.ChatServer, error)
+}
+
+// RestartPolicyStore persists restart policies of containers
+type RestartPolicyStore interface {
+	UpsertRestartPolicy(ctx context.Context, policy *models.RestartPolicy) error
+	DeleteRestartPolicy(ctx context.Context, serverID, container string) (bool, error)
+	ListRestartPolicies(ctx context.Context, serverID string) ([]models.RestartPolicy, error)
+	// MarkRestartPolicyTripped records when the agent stopped restarting a container.
+	// It returns sql.ErrNoRows when the container has no policy.
+	MarkRestartPolicyTripped(ctx context.Context, serverID, container string, at time.Time) (*models.RestartPolicy, error)
+}
+
+// ProcessWatchStore persists the processes watched on servers
+type ProcessWatchStore interface {
+	UpsertProcessWatch(ctx context.Context, watch *models.ProcessWatch) error
+	DeleteProcessWatch(ctx context.Context, serverID, name string) (bool, error)
+	// GetProcessWatch returns sql.ErrNoRows when the process is not watched
+	GetProcessWatch(ctx context.Context, serverID, name string) (*models.ProcessWatch, error)
+	// ListProcessWatches retrieves the watches of all servers
+	ListProcessWatches(ctx context.Context) ([]models.ProcessWatch, error)
+}
+
+// LogWatchStore persists the log files agents tail for patterns
+type LogWatchStore interface {
+	AddLogWatch(ctx context.Context, watch *models.LogWatch) error
+	DeleteLogWatch(ctx context.Context, serverID string, id int64) (bool, error)
+	ListLogWatches(ctx context.Context, serverID string) ([]models.LogWatch, error)
+}
+
+// FirewallStore persists the addresses blocked on servers
+type FirewallStore interface {
+	// AddFirewallBlock stores a block, or takes over the existing block of the address,
+	// setting its ID
+	AddFirewallBlock(ctx context.Context, block *models.FirewallBlock) error
+	// GetFirewallBlock returns sql.ErrNoRows when the block does not exist
+	GetFirewallBlock(ctx context.Context, id int64) (*models.FirewallBlock, error)
+	DeleteFirewallBlock(ctx context.Context, id int64) (bool, error)
+	ListFirewallBlocks(ctx context.Context, serverID string) ([]models.FirewallBlock, error)
+}
+
+// PassiveCheckStore persists the last results of passive checks
+type PassiveCheckStore interface {
+	// RecordPassiveCheck stores a check result and returns the previous result of the
+	// check, nil for a new check
+	RecordPassiveCheck(ctx context.Context, check *models.PassiveCheck) (*models.PassiveCheck, error)
+	ListPassiveChecks(ctx context.Context, serverID string) ([]models.PassiveCheck, error)
+}
+
+// DeploymentWindowStore persists deployment and maintenance windows of servers
+type DeploymentWindowStore interface {
+	// AddDeploymentWindow stores a deployment window and sets its ID
+	AddDeploymentWindow(ctx context.Context, window *models.DeploymentWindow) error
+	DeleteDeploymentWindow(ctx context.Context, id int64) (bool, error)
+	ListDeploymentWindows(ctx context.Context) ([]models.DeploymentWindow, error)
+	// AddMaintenanceWindow stores a maintenance window and sets its ID
+	AddMaintenanceWindow(ctx context.Context, window *models.MaintenanceWindow) error
+	DeleteMaintenanceWindow(ctx context.Context, id int64) (bool, error)
+	ListMaintenanceWindows(ctx context.Context) ([]models.MaintenanceWindow, error)
+}
+
+// AlertRouteStore persists the chats alerts of a category are routed to
+type AlertRouteStore interface {
+	// UpsertAlertRoute stores a route, replacing the route of the same user, server and category
+	UpsertAlertRoute(ctx context.Context, route *models.AlertRoute) error
+	DeleteAlertRoute(ctx context.Context, telegramID int64, serverID, category string) (bool, error)
+	ListAlertRoutes(ctx context.Context) ([]models.AlertRoute, error)
+}
+
+// UptimeCheckStore persists uptime checks and their status history
+type UptimeCheckStore interface {
+	// AddUptimeCheck stores an uptime check and sets its ID
+	AddUptimeCheck(ctx context.Context, check *models.UptimeCheck) error
+	DeleteUptimeCheck(ctx context.Context, id int64) (bool, error)
+	ListUptimeChecks(ctx context.Context) ([]models.UptimeCheck, error)
+	// RecordUptimeResult stores a probe and the resulting state of its check
+	RecordUptimeResult(ctx context.Context, result *models.UptimeResult, check *models.UptimeCheck) error
+	// ListUptimeResults retrieves the probes of a check since a time, newest first
+	ListUptimeResults(ctx context.Context, checkID int64, since time.Time) ([]models.UptimeResult, error)
+	DeleteUptimeResultsBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+// GuestStore persists time-boxed guest access to servers
+type GuestStore interface {
+	// GrantServerGuest gives the guest role on the server and stores or extends the
+	// grant, setting its ID
+	GrantServerGuest(ctx context.Context, guest *models.ServerGuest) error
+	// RevokeServerGuest removes a grant together with the guest role it gave, leaving
+	// other links of the user alone, and reports whether it existed
+	RevokeServerGuest(ctx context.Context, serverID string, userID int64) (bool, error)
+	ListServerGuests(ctx context.Context, serverID string) ([]models.ServerGuest, error)
+	ListExpiredServerGuests(ctx context.Context, now time.Time) ([]models.ServerGuest, error)
+}
+
+// OutboxStore persists alerts until Telegram confirms their delivery
+type OutboxStore interface {
+	// EnqueueOutboxMessages stores messages to send, setting their IDs
+	EnqueueOutboxMessages(ctx context.Context, messages []*models.OutboxMessage) error
+	// ClaimOutboxMessages returns up to limit pending messages due by now, oldest first,
+	// moving their next attempt to leaseUntil so that other replicas skip them meanwhile
+	ClaimOutboxMessages(ctx context.Context, now, leaseUntil time.Time, limit int) ([]*models.OutboxMessage, error)
+	MarkOutboxDelivered(ctx context.Context, id int64, at time.Time) error
+	// RescheduleOutboxMessage records a failed attempt and when to retry
+	RescheduleOutboxMessage(ctx context.Context, id int64, attempts int, nextAttemptAt time.Time, lastError string) error
+	// MarkOutboxFailed records the last failed attempt of a message that is not retried
+	MarkOutboxFailed(ctx context.Context, id int64, attempts int, at time.Time, lastError string) error
+	// DeleteOutboxMessages removes delivered and failed messages created before the given time
+	DeleteOutboxMessages(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Repository is the complete storage backend of the bot
+type Repository interface {
+	UserStore
+	ReportStore
+	AlertLogStore
+	SettingsStore
+	AuditStore
+	MetricsStore
+	CommandStore
+	PairingStore
+	AccountLinkStore
+	KeyStore
+	TagStore
+	NotifyStore
+	ChatStore
+	RestartPolicyStore
+	ProcessWatchStore
+	LogWatchStore
+	FirewallStore
+	PassiveCheckStore
+	DeploymentWindowStore
+	AlertRouteStore
+	UptimeCheckStore
+	GuestStore
+	OutboxStore
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// New creates a repository for the given database driver
+func New(driver, databaseURL string) (Repository, error) {
+	switch driver {
+	case "postgres":
+		return NewPostgresRepository(databaseURL)
+	case "mysql":
+		return NewMySQLRepository(databaseURL)
+	default:
+		return nil, fmt.Errorf("unsupported database driver '%s'", driver)
+	}
+}
+
+// NewUnchecked creates a repository for the given database driver without connecting
+// to the database, which may be unreachable until later
+func NewUnchecked(driver, databaseURL string) (Repository, error) {
+	switch driver {
+	case "postgres":
+		return openPostgresRepository(databaseURL)
+	case "mysql":
+		return openMySQLRepository(databaseURL)
+	default:
+		return nil, fmt.Errorf("unsupported database driver '%s'", driver)
+	}
+}
@@ -0,0 +1,129 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// Frequency represents how often a schedule fires
+type Frequency string
+
+const (
+	FrequencyDaily  Frequency = "daily"
+	FrequencyWeekly Frequency = "weekly"
+)
+
+// weekdays maps short and full weekday names to time.Weekday
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// Schedule represents a cron-like daily or weekly schedule
+type Schedule struct {
+	Frequency Frequency
+	Weekday   time.Weekday
+	Hour      int
+	Minute    int
+}
+
+// Parse parses schedule arguments like "daily 09:00" or "weekly mon 09:00"
+func Parse(args []string) (*Schedule, error) {
+	if len(args) == 0 {
+		return nil, errors.NewRequiredFieldError("frequency")
+	}
+
+	schedule := &Schedule{
+		Frequency: Frequency(strings.ToLower(args[0])),
+		Weekday:   time.Monday,
+	}
+
+	rest := args[1:]
+	switch schedule.Frequency {
+	case FrequencyDaily:
+	case FrequencyWeekly:
+		if len(rest) > 0 {
+			if day, ok := weekdays[strings.ToLower(rest[0])]; ok {
+				schedule.Weekday = day
+				rest = rest[1:]
+			}
+		}
+	default:
+		return nil, errors.NewValidationError("unknown frequency", map[string]interface{}{"frequency": args[0]})
+	}
+
+	clock := "09:00"
+	if len(rest) > 0 {
+		clock = rest[0]
+	}
+
+	hour, minute, err := parseClock(clock)
+	if err != nil {
+		return nil, err
+	}
+	schedule.Hour = hour
+	schedule.Minute = minute
+
+	return schedule, nil
+}
+
+// parseClock parses HH:MM into hour and minute
+func parseClock(clock string) (int, int, error) {
+	parts := strings.Split(clock, ":")
+	if len(parts) != 2 {
+		return 0, 0, errors.NewValidationError("invalid time format, expected HH:MM", map[string]interface{}{"time": clock})
+	}
+
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, 0, errors.NewValidationError("invalid hour", map[string]interface{}{"time": clock})
+	}
+
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil || minute < 0 || minute > 59 {
+		return 0, 0, errors.NewValidationError("invalid minute", map[string]interface{}{"time": clock})
+	}
+
+	return hour, minute, nil
+}
+
+// Next returns the first fire time strictly after the given time in the given location
+func (s *Schedule) Next(after time.Time, loc *time.Location) time.Time {
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	local := after.In(loc)
+	next := time.Date(local.Year(), local.Month(), local.Day(), s.Hour, s.Minute, 0, 0, loc)
+
+	if s.Frequency == FrequencyWeekly {
+		days := (int(s.Weekday) - int(next.Weekday()) + 7) % 7
+		next = next.AddDate(0, 0, days)
+		if !next.After(local) {
+			next = next.AddDate(0, 0, 7)
+		}
+		return next
+	}
+
+	if !next.After(local) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// String returns a human-readable representation of the schedule
+func (s *Schedule) String() string {
+	if s.Frequency == FrequencyWeekly {
+		return fmt.Sprintf("weekly %s %02d:%02d", strings.ToLower(s.Weekday.String()[:3]), s.Hour, s.Minute)
+	}
+	return fmt.Sprintf("daily %02d:%02d", s.Hour, s.Minute)
+}
@@ -0,0 +1,128 @@
+package scheduler_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/scheduler"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{args: []string{"daily"}, want: "daily 09:00"},
+		{args: []string{"daily", "18:30"}, want: "daily 18:30"},
+		{args: []string{"Weekly", "FRIDAY", "7:05"}, want: "weekly fri 07:05"},
+		{args: []string{"weekly", "08:00"}, want: "weekly mon 08:00"},
+		{args: []string{"weekly", "sun"}, want: "weekly sun 09:00"},
+		{args: []string{}, wantErr: true},
+		{args: []string{"monthly", "09:00"}, wantErr: true},
+		{args: []string{"daily", "24:00"}, wantErr: true},
+		{args: []string{"daily", "09:60"}, wantErr: true},
+		{args: []string{"daily", "0900"}, wantErr: true},
+		{args: []string{"weekly", "someday", "09:00"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		schedule, err := scheduler.Parse(tt.args)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Parse(%q) = %s, want an error", tt.args, schedule)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.args, err)
+			continue
+		}
+		if got := schedule.String(); got != tt.want {
+			t.Errorf("Parse(%q) = %s, want %s", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	moscow := time.FixedZone("MSK", 3*60*60)
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+
+	// 2026-10-16 is a Friday
+	tests := []struct {
+		name     string
+		schedule scheduler.Schedule
+		after    time.Time
+		loc      *time.Location
+		want     time.Time
+	}{
+		{
+			name:     "daily later today",
+			schedule: scheduler.Schedule{Frequency: scheduler.FrequencyDaily, Hour: 9},
+			after:    time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC),
+			want:     time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "daily at the fire time",
+			schedule: scheduler.Schedule{Frequency: scheduler.FrequencyDaily, Hour: 9},
+			after:    time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC),
+			want:     time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "daily across a month",
+			schedule: scheduler.Schedule{Frequency: scheduler.FrequencyDaily, Hour: 6, Minute: 30},
+			after:    time.Date(2026, 10, 31, 7, 0, 0, 0, time.UTC),
+			want:     time.Date(2026, 11, 1, 6, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "daily in the user's timezone",
+			schedule: scheduler.Schedule{Frequency: scheduler.FrequencyDaily, Hour: 9},
+			after:    time.Date(2026, 10, 16, 7, 0, 0, 0, time.UTC), // 10:00 in Moscow
+			loc:      moscow,
+			want:     time.Date(2026, 10, 17, 6, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "daily across the end of daylight saving time",
+			schedule: scheduler.Schedule{Frequency: scheduler.FrequencyDaily, Hour: 9},
+			after:    time.Date(2026, 10, 31, 14, 0, 0, 0, time.UTC), // 10:00 EDT
+			loc:      newYork,
+			want:     time.Date(2026, 11, 1, 14, 0, 0, 0, time.UTC), // 09:00 EST
+		},
+		{
+			name:     "weekly later this week",
+			schedule: scheduler.Schedule{Frequency: scheduler.FrequencyWeekly, Weekday: time.Monday, Hour: 9},
+			after:    time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC),
+			want:     time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "weekly later today",
+			schedule: scheduler.Schedule{Frequency: scheduler.FrequencyWeekly, Weekday: time.Friday, Hour: 9},
+			after:    time.Date(2026, 10, 16, 8, 59, 0, 0, time.UTC),
+			want:     time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "weekly at the fire time",
+			schedule: scheduler.Schedule{Frequency: scheduler.FrequencyWeekly, Weekday: time.Friday, Hour: 9},
+			after:    time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC),
+			want:     time.Date(2026, 10, 23, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "weekly on another day in the user's timezone",
+			schedule: scheduler.Schedule{Frequency: scheduler.FrequencyWeekly, Weekday: time.Saturday, Hour: 1},
+			after:    time.Date(2026, 10, 16, 21, 30, 0, 0, time.UTC), // Saturday 00:30 in Moscow
+			loc:      moscow,
+			want:     time.Date(2026, 10, 16, 22, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.schedule.Next(tt.after, tt.loc); !got.Equal(tt.want) {
+				t.Errorf("Next(%v) = %v, want %v", tt.after, got.UTC(), tt.want)
+			}
+		})
+	}
+}
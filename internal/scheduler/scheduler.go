@@ -0,0 +1,102 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Job is a periodic task executed by the scheduler on every tick
+type Job func(ctx context.Context, now time.Time) error
+
+// Logger interface for scheduler
+type Logger interface {
+	Debug(msg string, fields ...interface{})
+	Info(msg string, fields ...interface{})
+	Warn(msg string, fields ...interface{})
+	Error(msg string, fields ...interface{})
+}
+
+// namedJob couples a job with its name for logging
+type namedJob struct {
+	name string
+	job  Job
+}
+
+// Scheduler runs registered jobs at a fixed interval
+type Scheduler struct {
+	interval time.Duration
+	logger   Logger
+	jobs     []namedJob
+	mu       sync.Mutex
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// New creates a new scheduler ticking at the given interval
+func New(interval time.Duration, logger Logger) *Scheduler {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	return &Scheduler{
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// Register adds a job to the scheduler
+func (s *Scheduler) Register(name string, job Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs = append(s.jobs, namedJob{name: name, job: job})
+}
+
+// Start starts the scheduler loop in background
+func (s *Scheduler) Start(ctx context.Context) {
+	ctx, s.cancel = context.WithCancel(ctx)
+
+	s.logger.Info("Starting scheduler", "interval", s.interval.String(), "jobs", len(s.jobs))
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				s.runJobs(ctx, now)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the scheduler and waits for running jobs to finish
+func (s *Scheduler) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+
+	s.logger.Info("Scheduler stopped")
+}
+
+// runJobs executes all registered jobs sequentially
+func (s *Scheduler) runJobs(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	jobs := make([]namedJob, len(s.jobs))
+	copy(jobs, s.jobs)
+	s.mu.Unlock()
+
+	for _, j := range jobs {
+		if err := j.job(ctx, now); err != nil {
+			s.logger.Error("Scheduled job failed", "job", j.name, "error", err)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// Window represents a weekly time window like "sat 02:00-04:00". A window whose end
+// is not after its start runs past midnight into the next day.
+type Window struct {
+	Weekday time.Weekday
+	Start   int // minutes after midnight
+	End     int // minutes after midnight
+}
+
+// ParseWindow parses a weekday and a time span like "sat" and "02:00-04:00"
+func ParseWindow(day, span string) (*Window, error) {
+	weekday, ok := weekdays[strings.ToLower(day)]
+	if !ok {
+		return nil, errors.NewValidationError("unknown weekday", map[string]interface{}{"day": day})
+	}
+
+	from, to, ok := strings.Cut(span, "-")
+	if !ok {
+		return nil, errors.NewValidationError("invalid time span format, expected HH:MM-HH:MM", map[string]interface{}{"span": span})
+	}
+
+	startHour, startMinute, err := parseClock(from)
+	if err != nil {
+		return nil, err
+	}
+	endHour, endMinute, err := parseClock(to)
+	if err != nil {
+		return nil, err
+	}
+
+	window := &Window{
+		Weekday: weekday,
+		Start:   startHour*60 + startMinute,
+		End:     endHour*60 + endMinute,
+	}
+	if window.Start == window.End {
+		return nil, errors.NewValidationError("window must not be empty", map[string]interface{}{"span": span})
+	}
+	return window, nil
+}
+
+// Duration returns the length of the window
+func (w Window) Duration() time.Duration {
+	minutes := w.End - w.Start
+	if minutes <= 0 {
+		minutes += 24 * 60
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// Active reports whether t falls within an occurrence of the window in the given
+// location and returns the end of that occurrence
+func (w Window) Active(t time.Time, loc *time.Location) (time.Time, bool) {
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	// The occurrence containing t started today or, running past midnight, yesterday
+	local := t.In(loc)
+	for days := 0; days <= 1; days++ {
+		day := local.AddDate(0, 0, -days)
+		if day.Weekday() != w.Weekday {
+			continue
+		}
+
+		start := time.Date(day.Year(), day.Month(), day.Day(), w.Start/60, w.Start%60, 0, 0, loc)
+		end := start.Add(w.Duration())
+		if !local.Before(start) && local.Before(end) {
+			return end, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// String returns a human-readable representation of the window
+func (w Window) String() string {
+	return fmt.Sprintf("%s %02d:%02d-%02d:%02d", strings.ToLower(w.Weekday.String()[:3]), w.Start/60, w.Start%60, w.End/60, w.End%60)
+}
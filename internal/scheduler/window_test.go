@@ -0,0 +1,129 @@
+package scheduler_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/scheduler"
+)
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		day      string
+		span     string
+		want     string
+		duration time.Duration
+		wantErr  bool
+	}{
+		{day: "sat", span: "02:00-04:00", want: "sat 02:00-04:00", duration: 2 * time.Hour},
+		{day: "Sunday", span: "23:30-01:00", want: "sun 23:30-01:00", duration: 90 * time.Minute},
+		{day: "mon", span: "00:00-23:59", want: "mon 00:00-23:59", duration: 24*time.Hour - time.Minute},
+		{day: "sat", span: "02:00-02:00", wantErr: true},
+		{day: "sat", span: "02:00", wantErr: true},
+		{day: "sat", span: "02:00-25:00", wantErr: true},
+		{day: "someday", span: "02:00-04:00", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		window, err := scheduler.ParseWindow(tt.day, tt.span)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseWindow(%q, %q) = %s, want an error", tt.day, tt.span, window)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseWindow(%q, %q): %v", tt.day, tt.span, err)
+			continue
+		}
+		if window.String() != tt.want || window.Duration() != tt.duration {
+			t.Errorf("ParseWindow(%q, %q) = %s lasting %v, want %s lasting %v", tt.day, tt.span, window, window.Duration(), tt.want, tt.duration)
+		}
+	}
+}
+
+func TestWindowActive(t *testing.T) {
+	moscow := time.FixedZone("MSK", 3*60*60)
+	maintenance := scheduler.Window{Weekday: time.Saturday, Start: 2 * 60, End: 4 * 60}
+	overnight := scheduler.Window{Weekday: time.Saturday, Start: 23 * 60, End: 60}
+
+	// 2026-10-17 is a Saturday
+	tests := []struct {
+		name   string
+		window scheduler.Window
+		at     time.Time
+		loc    *time.Location
+		active bool
+		end    time.Time
+	}{
+		{
+			name:   "at the start",
+			window: maintenance,
+			at:     time.Date(2026, 10, 17, 2, 0, 0, 0, time.UTC),
+			active: true,
+			end:    time.Date(2026, 10, 17, 4, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "before the start",
+			window: maintenance,
+			at:     time.Date(2026, 10, 17, 1, 59, 0, 0, time.UTC),
+		},
+		{
+			name:   "at the end",
+			window: maintenance,
+			at:     time.Date(2026, 10, 17, 4, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "on another day",
+			window: maintenance,
+			at:     time.Date(2026, 10, 18, 3, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "in the user's timezone",
+			window: maintenance,
+			at:     time.Date(2026, 10, 17, 0, 30, 0, 0, time.UTC), // 03:30 in Moscow
+			loc:    moscow,
+			active: true,
+			end:    time.Date(2026, 10, 17, 1, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "outside in the user's timezone",
+			window: maintenance,
+			at:     time.Date(2026, 10, 17, 3, 0, 0, 0, time.UTC), // 06:00 in Moscow
+			loc:    moscow,
+		},
+		{
+			name:   "overnight before midnight",
+			window: overnight,
+			at:     time.Date(2026, 10, 17, 23, 30, 0, 0, time.UTC),
+			active: true,
+			end:    time.Date(2026, 10, 18, 1, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "overnight past midnight",
+			window: overnight,
+			at:     time.Date(2026, 10, 18, 0, 30, 0, 0, time.UTC),
+			active: true,
+			end:    time.Date(2026, 10, 18, 1, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "overnight past its end",
+			window: overnight,
+			at:     time.Date(2026, 10, 18, 1, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "overnight on the morning of its day",
+			window: overnight,
+			at:     time.Date(2026, 10, 17, 0, 30, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			end, active := tt.window.Active(tt.at, tt.loc)
+			if active != tt.active || !end.Equal(tt.end) {
+				t.Errorf("Active(%v) = %v, %v, want %v, %v", tt.at, end, active, tt.end, tt.active)
+			}
+		})
+	}
+}
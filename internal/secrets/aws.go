@@ -0,0 +1,82 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/smithy-go"
+)
+
+// awsProvider reads secrets of AWS Secrets Manager. Credentials are found by the default
+// chain of the AWS SDK: environment variables, shared config and credentials files, SSO,
+// web identity tokens and the roles of ECS tasks and EC2 instances.
+type awsProvider struct {
+	region   string
+	endpoint string
+	timeout  time.Duration
+
+	mu sync.Mutex
+	sm *secretsmanager.Client // created on the first fetch, keeping its credentials cached
+}
+
+// Fetch reads a secret. A secret holding a JSON object has its fields returned, any other
+// secret is returned under the empty key.
+func (p *awsProvider) Fetch(ctx context.Context, secretID string) (map[string]string, error) {
+	if p.region == "" {
+		return nil, errors.New("AWS_REGION is not set")
+	}
+	sm, err := p.secretsManager(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := sm.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(secretID)})
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) {
+			return nil, fmt.Errorf("secrets manager returned %s: %s", apiErr.ErrorCode(), apiErr.ErrorMessage())
+		}
+		return nil, err
+	}
+	if out.SecretString == nil {
+		return nil, errors.New("secret holds binary data, only string secrets are supported")
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(*out.SecretString), &fields); err == nil {
+		return stringFields(fields), nil
+	}
+	return map[string]string{"": *out.SecretString}, nil
+}
+
+// secretsManager returns the Secrets Manager client, loading the AWS configuration on the
+// first call. A failed load is retried on the next fetch.
+func (p *awsProvider) secretsManager(ctx context.Context) (*secretsmanager.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.sm != nil {
+		return p.sm, nil
+	}
+
+	// The SDK's own client is kept so that AWS_CA_BUNDLE still applies
+	httpClient := awshttp.NewBuildableClient().WithTimeout(p.timeout)
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(p.region), awsconfig.WithHTTPClient(httpClient))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+	p.sm = secretsmanager.NewFromConfig(cfg, func(o *secretsmanager.Options) {
+		if p.endpoint != "" {
+			o.BaseEndpoint = aws.String(p.endpoint)
+		}
+	})
+	return p.sm, nil
+}
@@ -0,0 +1,161 @@
+package secrets_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/secrets"
+)
+
+// secretsManager is a fake AWS Secrets Manager recording the credentials requests are
+// signed with
+type secretsManager struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	credentials []string // access key and scope of the Authorization of every request
+	tokens      []string // X-Amz-Security-Token of every request
+}
+
+// newSecretsManager starts a fake Secrets Manager holding secrets by ID
+func newSecretsManager(t *testing.T, values map[string]map[string]string) *secretsManager {
+	t.Helper()
+
+	sm := &secretsManager{}
+	sm.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		credential, _, _ := strings.Cut(strings.TrimPrefix(auth, "AWS4-HMAC-SHA256 Credential="), ",")
+		sm.mu.Lock()
+		sm.credentials = append(sm.credentials, credential)
+		sm.tokens = append(sm.tokens, r.Header.Get("X-Amz-Security-Token"))
+		sm.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" || !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 ") {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"InvalidRequestException","message":"unsigned or unknown request"}`))
+			return
+		}
+
+		var input struct{ SecretId string }
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		value, ok := values[input.SecretId]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"ResourceNotFoundException","message":"Secrets Manager can't find the specified secret."}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(value)
+	}))
+	t.Cleanup(sm.Close)
+	return sm
+}
+
+// isolateAWS keeps the host's AWS configuration and instance metadata out of a test
+func isolateAWS(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	for _, name := range []string{"AWS_PROFILE", "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN",
+		"AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_CONTAINER_CREDENTIALS_FULL_URI", "AWS_CA_BUNDLE"} {
+		t.Setenv(name, "")
+	}
+	return dir
+}
+
+func TestAWSResolve(t *testing.T) {
+	isolateAWS(t)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY")
+	t.Setenv("AWS_SESSION_TOKEN", "session-token")
+
+	sm := newSecretsManager(t, map[string]map[string]string{
+		"bot":    {"SecretString": `{"token":"123:abc","port":5432}`},
+		"plain":  {"SecretString": "hunter2"},
+		"binary": {"SecretBinary": "aGk="},
+	})
+	resolver := secrets.NewResolver(secrets.Options{AWSRegion: "eu-west-1", AWSEndpoint: sm.URL + "/", Timeout: time.Second})
+
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr string
+	}{
+		{ref: "${aws-sm:bot#token}", want: "123:abc"},
+		{ref: "${aws-sm:bot#port}", want: "5432"},
+		{ref: "${aws-sm:plain}", want: "hunter2"},
+		{ref: "${aws-sm:bot}", wantErr: "has 2 fields, name one with #key"},
+		{ref: "${aws-sm:bot#password}", wantErr: `has no field "password"`},
+		{ref: "${aws-sm:binary}", wantErr: "binary data"},
+		{ref: "${aws-sm:missing#token}", wantErr: "ResourceNotFoundException: Secrets Manager can't find the specified secret."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			got, err := resolver.Resolve(context.Background(), tt.ref)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Resolve error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Resolve = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	for i, credential := range sm.credentials {
+		if !strings.HasPrefix(credential, "AKIDEXAMPLE/") || !strings.HasSuffix(credential, "/eu-west-1/secretsmanager/aws4_request") {
+			t.Errorf("request signed with credential %q, want AKIDEXAMPLE in eu-west-1", credential)
+		}
+		if sm.tokens[i] != "session-token" {
+			t.Errorf("request sent session token %q, want the one of AWS_SESSION_TOKEN", sm.tokens[i])
+		}
+	}
+}
+
+func TestAWSSharedCredentials(t *testing.T) {
+	dir := isolateAWS(t)
+	credentials := "[default]\naws_access_key_id = AKIDFROMFILE\naws_secret_access_key = secret\n"
+	if err := os.WriteFile(filepath.Join(dir, "credentials"), []byte(credentials), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	sm := newSecretsManager(t, map[string]map[string]string{"plain": {"SecretString": "hunter2"}})
+	resolver := secrets.NewResolver(secrets.Options{AWSRegion: "us-east-1", AWSEndpoint: sm.URL, Timeout: time.Second})
+
+	if got, err := resolver.Resolve(context.Background(), "${aws-sm:plain}"); err != nil || got != "hunter2" {
+		t.Fatalf("Resolve = %q, %v", got, err)
+	}
+	if credential := sm.credentials[0]; !strings.HasPrefix(credential, "AKIDFROMFILE/") {
+		t.Errorf("request signed with credential %q, want the key of the shared credentials file", credential)
+	}
+}
+
+func TestAWSWithoutRegion(t *testing.T) {
+	resolver := secrets.NewResolver(secrets.Options{Timeout: time.Second})
+
+	if _, err := resolver.Resolve(context.Background(), "${aws-sm:plain}"); err == nil || !strings.Contains(err.Error(), "AWS_REGION is not set") {
+		t.Errorf("Resolve error = %v, want the missing region reported", err)
+	}
+}
@@ -0,0 +1,134 @@
+// Package secrets fetches secrets referenced in the configuration from HashiCorp Vault and
+// AWS Secrets Manager, so that tokens and passwords need not be stored in environment
+// variables or files. A reference has the form ${vault:path#key} or ${aws-sm:id#key}.
+package secrets
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Provider names used in references
+const (
+	ProviderVault = "vault"
+	ProviderAWS   = "aws-sm"
+)
+
+// referencePattern matches a reference with its provider, path and optional key
+var referencePattern = regexp.MustCompile(`\$\{(vault|aws-sm):([^}#]+)(?:#([^}]+))?\}`)
+
+// Options configures the providers
+type Options struct {
+	VaultAddr      string
+	VaultToken     string
+	VaultTokenFile string // read on every fetch, as rotated by Vault Agent
+	VaultNamespace string
+	AWSRegion      string
+	AWSEndpoint    string // Secrets Manager endpoint, derived from the region when empty
+	Timeout        time.Duration
+}
+
+// Provider fetches the fields of a secret
+type Provider interface {
+	// Fetch returns the fields of a secret. A secret without fields, such as an AWS secret
+	// holding a plain string, is returned under the empty key.
+	Fetch(ctx context.Context, path string) (map[string]string, error)
+}
+
+// Resolver replaces references with the secrets they point to
+type Resolver struct {
+	providers map[string]Provider
+}
+
+// NewResolver creates a resolver with the Vault and AWS Secrets Manager providers
+func NewResolver(opts Options) *Resolver {
+	client := &http.Client{Timeout: opts.Timeout}
+	return &Resolver{providers: map[string]Provider{
+		ProviderVault: &vaultProvider{
+			addr:      strings.TrimRight(opts.VaultAddr, "/"),
+			token:     opts.VaultToken,
+			tokenFile: opts.VaultTokenFile,
+			namespace: opts.VaultNamespace,
+			client:    client,
+		},
+		ProviderAWS: &awsProvider{
+			region:   opts.AWSRegion,
+			endpoint: strings.TrimRight(opts.AWSEndpoint, "/"),
+			timeout:  opts.Timeout,
+		},
+	}}
+}
+
+// HasReference reports whether a value contains a reference
+func HasReference(value string) bool {
+	return referencePattern.MatchString(value)
+}
+
+// References returns the references contained in a value
+func References(value string) []string {
+	return referencePattern.FindAllString(value, -1)
+}
+
+// Replace replaces the references in a value with already resolved secrets
+func Replace(value string, resolved map[string]string) string {
+	return referencePattern.ReplaceAllStringFunc(value, func(ref string) string {
+		return resolved[ref]
+	})
+}
+
+// Fingerprint returns the SHA-256 of a secret, to detect its rotation without keeping
+// another copy of it
+func Fingerprint(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Resolve fetches the secret of a single reference
+func (r *Resolver) Resolve(ctx context.Context, ref string) (string, error) {
+	match := referencePattern.FindStringSubmatch(ref)
+	if match == nil || match[0] != ref {
+		return "", fmt.Errorf("invalid secret reference %q", ref)
+	}
+	provider, path, key := match[1], strings.TrimSpace(match[2]), strings.TrimSpace(match[3])
+
+	fields, err := r.providers[provider].Fetch(ctx, path)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch %s secret %s: %w", provider, path, err)
+	}
+
+	if key == "" {
+		// A secret with a single field needs no key
+		if len(fields) != 1 {
+			return "", fmt.Errorf("%s secret %s has %d fields, name one with #key", provider, path, len(fields))
+		}
+		for _, value := range fields {
+			return value, nil
+		}
+	}
+	value, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("%s secret %s has no field %q", provider, path, key)
+	}
+	return value, nil
+}
+
+// stringFields converts the fields of a JSON object to strings
+func stringFields(data map[string]json.RawMessage) map[string]string {
+	fields := make(map[string]string, len(data))
+	for key, raw := range data {
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil {
+			fields[key] = s
+			continue
+		}
+		fields[key] = string(raw)
+	}
+	return fields
+}
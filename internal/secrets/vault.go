@@ -0,0 +1,88 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// maxResponseSize limits the responses read from secret providers
+const maxResponseSize = 1 << 20
+
+// vaultProvider reads secrets of the KV secrets engine, versions 1 and 2. Paths are API
+// paths, such as secret/data/servereye for a KV v2 mount named secret.
+type vaultProvider struct {
+	addr      string
+	token     string
+	tokenFile string
+	namespace string
+	client    *http.Client
+}
+
+// vaultResponse represents a KV read. Version 2 nests the fields under data.data.
+type vaultResponse struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []string                   `json:"errors"`
+}
+
+// Fetch reads the fields of a secret
+func (p *vaultProvider) Fetch(ctx context.Context, path string) (map[string]string, error) {
+	if p.addr == "" {
+		return nil, errors.New("VAULT_ADDR is not set")
+	}
+
+	token := p.token
+	if p.tokenFile != "" {
+		data, err := os.ReadFile(p.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Vault token file: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token == "" {
+		return nil, errors.New("VAULT_TOKEN or VAULT_TOKEN_FILE is not set")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.addr+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if p.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.namespace)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body vaultResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&body); err != nil && resp.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("failed to decode Vault response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if len(body.Errors) > 0 {
+			return nil, fmt.Errorf("vault returned %d: %s", resp.StatusCode, strings.Join(body.Errors, "; "))
+		}
+		return nil, fmt.Errorf("vault returned %d", resp.StatusCode)
+	}
+
+	data := body.Data
+	if nested, ok := data["data"]; ok {
+		if _, versioned := data["metadata"]; versioned {
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(nested, &fields); err != nil {
+				return nil, fmt.Errorf("failed to decode Vault secret: %w", err)
+			}
+			data = fields
+		}
+	}
+	return stringFields(data), nil
+}
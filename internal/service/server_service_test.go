@@ -0,0 +1,125 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/servereye/servereyebot/internal/service"
+	"github.com/servereye/servereyebot/internal/storage"
+	"github.com/servereye/servereyebot/internal/testutil"
+	"github.com/servereye/servereyebot/pkg/domain"
+)
+
+// newServerService creates a server service on a fake database holding one user
+func newServerService(t *testing.T) (*service.ServerService, *testutil.Database) {
+	t.Helper()
+
+	db := testutil.NewDatabase()
+	if err := db.CreateUser(context.Background(), &domain.User{TelegramID: 1001, Username: "alice"}); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	return service.NewServerService(
+		storage.NewServerRepositoryAdapter(db),
+		storage.NewUserRepositoryAdapter(db),
+		storage.NewUserServerRepositoryAdapter(db),
+	), db
+}
+
+func TestAddServerToUserCreatesMissingServer(t *testing.T) {
+	svc, db := newServerService(t)
+	ctx := context.Background()
+
+	if err := svc.AddServerToUser(ctx, 1001, "srv_12313", "owner"); err != nil {
+		t.Fatalf("AddServerToUser: %v", err)
+	}
+
+	server, err := db.GetServerByServerID(ctx, "srv_12313")
+	if err != nil {
+		t.Fatalf("server was not created: %v", err)
+	}
+	if server.Name != "srv_12313" || !server.IsActive {
+		t.Errorf("created server = %+v, want an active server named after its ID", server)
+	}
+
+	// A second user of the same server must not create it again
+	if err := db.CreateUser(ctx, &domain.User{TelegramID: 1002}); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if err := svc.AddServerToUser(ctx, 1002, "srv_12313", "viewer"); err != nil {
+		t.Fatalf("AddServerToUser of a known server: %v", err)
+	}
+	if calls := db.Calls("CreateServer"); calls != 1 {
+		t.Errorf("CreateServer called %d times, want 1", calls)
+	}
+}
+
+func TestServerServiceErrors(t *testing.T) {
+	errDown := errors.New("connection refused")
+
+	tests := []struct {
+		name    string
+		fail    string // method of the database failing with errDown, none when empty
+		run     func(ctx context.Context, svc *service.ServerService) error
+		wantErr string
+	}{
+		{
+			name: "unknown user",
+			run: func(ctx context.Context, svc *service.ServerService) error {
+				return svc.AddServerToUser(ctx, 2002, "srv_1", "owner")
+			},
+			wantErr: "failed to get user",
+		},
+		{
+			name: "server creation fails",
+			fail: "CreateServer",
+			run: func(ctx context.Context, svc *service.ServerService) error {
+				return svc.AddServerToUser(ctx, 1001, "srv_1", "owner")
+			},
+			wantErr: "failed to create server",
+		},
+		{
+			name: "link fails",
+			fail: "CreateUserServer",
+			run: func(ctx context.Context, svc *service.ServerService) error {
+				return svc.AddServerToUser(ctx, 1001, "srv_1", "owner")
+			},
+			wantErr: "failed to add server to user",
+		},
+		{
+			name: "unknown server",
+			run: func(ctx context.Context, svc *service.ServerService) error {
+				return svc.RemoveServerFromUser(ctx, 1001, "srv_1")
+			},
+			wantErr: "failed to get server",
+		},
+		{
+			name: "listing fails",
+			fail: "ListServersByUserID",
+			run: func(ctx context.Context, svc *service.ServerService) error {
+				_, err := svc.ListUserServers(ctx, 1001)
+				return err
+			},
+			wantErr: "failed to list servers",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, db := newServerService(t)
+			if tt.fail != "" {
+				db.Fail(tt.fail, errDown)
+			}
+
+			err := tt.run(context.Background(), svc)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+			}
+			if tt.fail != "" && !errors.Is(err, errDown) {
+				t.Errorf("error %v does not wrap the database error", err)
+			}
+		})
+	}
+}
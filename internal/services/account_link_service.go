@@ -0,0 +1,224 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	stderrors "errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/repository"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+const (
+	// accountLinkCodeLength is the length of /link codes
+	accountLinkCodeLength = 8
+	// accountLinkCodeAlphabet leaves out characters that are easily confused when typed
+	accountLinkCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	// maxWebUserIDLength matches linked_accounts.web_user_id
+	maxWebUserIDLength = 128
+)
+
+// AccountLinkService links ServerEye-Web accounts to users through one-time codes, so that
+// the web app and the bot share the same user identity and server list. Codes are only
+// exchanged by the web app authenticated with its own token, hence no per-address limits.
+type AccountLinkService struct {
+	repo   repository.AccountLinkStore
+	audit  *AuditService
+	ttl    time.Duration
+	logger Logger
+}
+
+// NewAccountLinkService creates a new account link service. Codes are valid for ttl.
+func NewAccountLinkService(repo repository.AccountLinkStore, audit *AuditService, ttl time.Duration, logger Logger) *AccountLinkService {
+	return &AccountLinkService{
+		repo:   repo,
+		audit:  audit,
+		ttl:    ttl,
+		logger: logger,
+	}
+}
+
+// CreateCode generates a new link code for a user
+func (s *AccountLinkService) CreateCode(ctx context.Context, userID, telegramID int64) (*models.AccountLinkCode, error) {
+	var lastErr error
+	for i := 0; i < pairingCodeAttempts; i++ {
+		code, err := randomAccountLinkCode()
+		if err != nil {
+			return nil, err
+		}
+
+		link := &models.AccountLinkCode{
+			Code:       code,
+			UserID:     userID,
+			TelegramID: telegramID,
+			ExpiresAt:  time.Now().Add(s.ttl),
+		}
+
+		// A unique violation means the code is still stored for someone else
+		if lastErr = s.repo.CreateAccountLinkCode(ctx, link); lastErr == nil {
+			return link, nil
+		}
+	}
+
+	s.logger.Error("Failed to create account link code", "error", lastErr, "user_id", userID)
+	return nil, lastErr
+}
+
+// Link exchanges a code for a token identifying the user who generated it. The web
+// account replaces any account previously linked to the user, and a web account linked
+// to another user before is moved. Only the SHA-256 of the token is stored.
+func (s *AccountLinkService) Link(ctx context.Context, code, webUserID string) (*models.LinkedAccount, string, error) {
+	started := time.Now()
+
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != accountLinkCodeLength {
+		return nil, "", errors.NewValidationError("link code must have 8 characters", nil)
+	}
+	if err := validateWebUserID(webUserID); err != nil {
+		return nil, "", err
+	}
+
+	link, err := s.repo.ClaimAccountLinkCode(ctx, code, webUserID, started)
+	if err != nil {
+		if stderrors.Is(err, sql.ErrNoRows) {
+			return nil, "", errors.NewNotFoundError("link code")
+		}
+		return nil, "", err
+	}
+
+	token, err := randomAccountToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	account := &models.LinkedAccount{
+		UserID:     link.UserID,
+		TelegramID: link.TelegramID,
+		WebUserID:  webUserID,
+		TokenHash:  hashAccountToken(token),
+	}
+	err = s.repo.ReplaceLinkedAccount(ctx, account)
+	s.audit.RecordResult(ctx, link.UserID, link.TelegramID, "", AuditCommandLinkAccount,
+		fmt.Sprintf("code_id=%d web_user=%s", link.ID, webUserID), "", started, err)
+	if err != nil {
+		s.logger.Error("Failed to store linked account", "error", err, "user_id", link.UserID, "web_user_id", webUserID)
+		return nil, "", err
+	}
+
+	s.logger.Info("Web account linked", "user_id", link.UserID, "web_user_id", webUserID)
+	return account, token, nil
+}
+
+// Authenticate returns the linked account a token was issued to
+func (s *AccountLinkService) Authenticate(ctx context.Context, token string) (*models.LinkedAccount, error) {
+	if token == "" {
+		return nil, errors.NewUnauthorizedError("account token required")
+	}
+
+	account, err := s.repo.GetLinkedAccountByToken(ctx, hashAccountToken(token), time.Now())
+	if err != nil {
+		if stderrors.Is(err, sql.ErrNoRows) {
+			return nil, errors.NewUnauthorizedError("invalid account token")
+		}
+		return nil, err
+	}
+	return account, nil
+}
+
+// Get returns the web account linked to a user, or nil when there is none
+func (s *AccountLinkService) Get(ctx context.Context, userID int64) (*models.LinkedAccount, error) {
+	account, err := s.repo.GetLinkedAccount(ctx, userID)
+	if err != nil {
+		if stderrors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return account, nil
+}
+
+// Unlink removes the web account linked to a user, revoking its token. It reports
+// whether an account was linked.
+func (s *AccountLinkService) Unlink(ctx context.Context, userID, telegramID int64) (bool, error) {
+	started := time.Now()
+
+	removed, err := s.repo.DeleteLinkedAccount(ctx, userID)
+	s.audit.RecordResult(ctx, userID, telegramID, "", AuditCommandUnlinkAccount, "", "", started, err)
+	if err != nil {
+		s.logger.Error("Failed to unlink web account", "error", err, "user_id", userID)
+		return false, err
+	}
+
+	if removed {
+		s.logger.Info("Web account unlinked", "user_id", userID)
+	}
+	return removed, nil
+}
+
+// Cleanup removes expired link codes
+func (s *AccountLinkService) Cleanup(ctx context.Context, now time.Time) error {
+	deleted, err := s.repo.DeleteExpiredAccountLinkCodes(ctx, now)
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		s.logger.Debug("Expired account link codes deleted", "count", deleted)
+	}
+	return nil
+}
+
+// TTL returns how long link codes are valid
+func (s *AccountLinkService) TTL() time.Duration {
+	return s.ttl
+}
+
+// validateWebUserID checks the ID of a ServerEye-Web account
+func validateWebUserID(webUserID string) error {
+	if webUserID == "" || len(webUserID) > maxWebUserIDLength {
+		return errors.NewValidationError("web user ID must have 1 to 128 characters", nil)
+	}
+	for _, r := range webUserID {
+		if !unicode.IsPrint(r) || unicode.IsSpace(r) {
+			return errors.NewValidationError("web user ID contains invalid characters", map[string]interface{}{"web_user_id": webUserID})
+		}
+	}
+	return nil
+}
+
+// randomAccountLinkCode generates a random 8-character link code
+func randomAccountLinkCode() (string, error) {
+	code := make([]byte, accountLinkCodeLength)
+	limit := big.NewInt(int64(len(accountLinkCodeAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, limit)
+		if err != nil {
+			return "", err
+		}
+		code[i] = accountLinkCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// randomAccountToken generates a random token for a linked web account
+func randomAccountToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// hashAccountToken returns the hex SHA-256 a token is stored as
+func hashAccountToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
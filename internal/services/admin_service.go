@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/repository"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+const (
+	// UsersPageSize is the number of users listed per page of /users
+	UsersPageSize = 20
+
+	// broadcastInterval spaces broadcast messages to stay below the Telegram limit of
+	// about 30 messages per second across all chats
+	broadcastInterval = 50 * time.Millisecond
+
+	// maxBroadcastLength bounds announcements to a single Telegram message
+	maxBroadcastLength = 4000
+)
+
+// BroadcastResult represents the delivery of an announcement
+type BroadcastResult struct {
+	Recipients int
+	Sent       int
+	Failed     int // mostly users who blocked the bot
+	Cancelled  bool
+}
+
+// AdminService gives admins an overview of the users of the bot and sends them
+// announcements
+type AdminService struct {
+	users  repository.UserStore
+	logger Logger
+
+	mu            sync.Mutex
+	stopBroadcast context.CancelFunc // set while a broadcast runs
+}
+
+// NewAdminService creates a new admin service
+func NewAdminService(users repository.UserStore, logger Logger) *AdminService {
+	return &AdminService{
+		users:  users,
+		logger: logger,
+	}
+}
+
+// Stats counts registered, active and recently seen users
+func (s *AdminService) Stats(ctx context.Context, now time.Time) (*models.UserStats, error) {
+	return s.users.GetUserStats(ctx, now)
+}
+
+// Users retrieves a page of users, numbered from 1, most recently seen first
+func (s *AdminService) Users(ctx context.Context, page int) ([]models.UserSummary, error) {
+	if page < 1 {
+		page = 1
+	}
+	return s.users.ListUsers(ctx, (page-1)*UsersPageSize, UsersPageSize)
+}
+
+// ValidateBroadcast checks an announcement before it is sent
+func ValidateBroadcast(text string) error {
+	if strings.TrimSpace(text) == "" {
+		return errors.NewValidationError("announcement is empty", nil)
+	}
+	if len(text) > maxBroadcastLength {
+		return errors.NewValidationError("announcement is too long", map[string]interface{}{"max_length": maxBroadcastLength})
+	}
+	return nil
+}
+
+// Broadcast sends an announcement to all active users with send, one message per
+// broadcastInterval. Only one broadcast runs at a time; it stops early on StopBroadcast
+// or when ctx is done.
+func (s *AdminService) Broadcast(ctx context.Context, text string, send func(ctx context.Context, telegramID int64, text string) error) (*BroadcastResult, error) {
+	if err := ValidateBroadcast(text); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	s.mu.Lock()
+	busy := s.stopBroadcast != nil
+	if !busy {
+		s.stopBroadcast = cancel
+	}
+	s.mu.Unlock()
+	if busy {
+		return nil, errors.NewValidationError("broadcast already in progress", nil)
+	}
+	defer func() {
+		s.mu.Lock()
+		s.stopBroadcast = nil
+		s.mu.Unlock()
+	}()
+
+	recipients, err := s.users.ListActiveTelegramIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BroadcastResult{Recipients: len(recipients)}
+	ticker := time.NewTicker(broadcastInterval)
+	defer ticker.Stop()
+
+	for _, telegramID := range recipients {
+		select {
+		case <-ctx.Done():
+			result.Cancelled = true
+			s.logger.Warn("Broadcast stopped", "sent", result.Sent, "recipients", result.Recipients)
+			return result, nil
+		case <-ticker.C:
+		}
+
+		if err := send(ctx, telegramID, text); err != nil {
+			s.logger.Debug("Failed to deliver broadcast", "error", err, "telegram_id", telegramID)
+			result.Failed++
+			continue
+		}
+		result.Sent++
+	}
+
+	s.logger.Info("Broadcast sent", "sent", result.Sent, "failed", result.Failed, "recipients", result.Recipients)
+	return result, nil
+}
+
+// StopBroadcast stops the running broadcast, reporting whether one was running
+func (s *AdminService) StopBroadcast() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopBroadcast == nil {
+		return false
+	}
+	s.stopBroadcast()
+	return true
+}
+
+// FormatUserStats formats user counts together with a page of users
+func FormatUserStats(stats *models.UserStats, users []models.UserSummary, page int, now time.Time) string {
+	var sb strings.Builder
+	sb.WriteString("👥 Пользователи\n\n")
+	sb.WriteString(fmt.Sprintf("Всего: %d, активных: %d, администраторов: %d, удалились: %d\n", stats.Total, stats.Active, stats.Admins, stats.Deleted))
+	sb.WriteString(fmt.Sprintf("Новые: %d за сутки, %d за неделю, %d за месяц\n", stats.NewDay, stats.NewWeek, stats.NewMonth))
+	sb.WriteString(fmt.Sprintf("Заходили: %d за сутки, %d за неделю, %d за месяц\n", stats.SeenDay, stats.SeenWeek, stats.SeenMonth))
+
+	pages := (stats.Total + UsersPageSize - 1) / UsersPageSize
+	if pages == 0 {
+		return strings.TrimRight(sb.String(), "\n")
+	}
+	sb.WriteString(fmt.Sprintf("\nСтраница %d из %d, сначала недавно заходившие:\n", page, pages))
+
+	for _, user := range users {
+		name := user.Username
+		if name != "" {
+			name = "@" + name
+		} else if name = strings.TrimSpace(user.FirstName + " " + user.LastName); name == "" {
+			name = "без имени"
+		}
+
+		var flags string
+		if user.IsAdmin {
+			flags += " 👑"
+		}
+		if !user.IsActive {
+			flags += " 🗑"
+		}
+
+		sb.WriteString(fmt.Sprintf("- %s (%d)%s: серверов %d, регистрация %s назад, последний визит %s назад\n",
+			name, user.TelegramID, flags, user.Servers, formatAge(now.Sub(user.CreatedAt)), formatAge(now.Sub(user.UpdatedAt))))
+	}
+
+	if page < pages {
+		sb.WriteString(fmt.Sprintf("\nСледующая страница: /users %d", page+1))
+	}
+
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// FormatBroadcastResult formats the delivery of an announcement
+func FormatBroadcastResult(result *BroadcastResult) string {
+	if result.Cancelled {
+		return fmt.Sprintf("⛔ Рассылка остановлена: доставлено %d из %d, не доставлено %d.", result.Sent, result.Recipients, result.Failed)
+	}
+	if result.Failed > 0 {
+		return fmt.Sprintf("📣 Рассылка завершена: доставлено %d из %d. Не доставлено %d, обычно это пользователи, заблокировавшие бота.", result.Sent, result.Recipients, result.Failed)
+	}
+	return fmt.Sprintf("📣 Рассылка завершена: доставлено %d из %d.", result.Sent, result.Recipients)
+}
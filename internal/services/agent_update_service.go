@@ -0,0 +1,265 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/pkg/docker"
+	"github.com/servereye/servereyebot/pkg/errors"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+const (
+	// agentRestartDelay is how long an updating agent is left alone before it is asked for its version
+	agentRestartDelay = 30 * time.Second
+
+	// agentLostGrace is how long after its rollback window an agent may stay unreachable
+	// before the update is reported as lost
+	agentLostGrace = 5 * time.Minute
+)
+
+// Outcomes of agent updates
+const (
+	AgentUpdateDone       = "updated"
+	AgentUpdateRolledBack = "rolled_back"
+	AgentUpdateLost       = "lost" // the agent reconnected neither with the new nor with the previous release
+)
+
+// agentVersionPattern matches pinned releases such as 1.4.2 or v1.5.0-rc.1
+var agentVersionPattern = regexp.MustCompile(`^v?\d+\.\d+\.\d+(-[0-9A-Za-z.]+)?$`)
+
+// AgentUpdate represents an agent update waiting for the agent to come back
+type AgentUpdate struct {
+	ServerID      string
+	ServerName    string
+	ServerKey     string
+	TelegramID    int64 // user who started the update
+	Channel       string
+	FromVersion   string
+	TargetVersion string
+	StartedAt     time.Time
+	Deadline      time.Time // the agent rolls back unless it reconnects by then
+}
+
+// AgentUpdateOutcome represents how an agent update ended
+type AgentUpdateOutcome struct {
+	Update  AgentUpdate
+	Status  string
+	Version string // release the agent runs, empty when it is lost
+}
+
+// AgentUpdateService updates agents to the latest release of a channel or to a pinned
+// version. The agent restarts into the new release and restores the previous one itself
+// when the new release cannot reach the bot within the rollback window; the bot follows
+// each update until the agent reports the release it ended up with.
+type AgentUpdateService struct {
+	docker        *docker.Client
+	rollbackAfter time.Duration
+	logger        Logger
+
+	mu      sync.Mutex
+	pending map[string]*AgentUpdate // server ID -> update in progress
+}
+
+// NewAgentUpdateService creates a new agent update service giving updated agents
+// rollbackAfter to reconnect
+func NewAgentUpdateService(dockerClient *docker.Client, rollbackAfter time.Duration, logger Logger) *AgentUpdateService {
+	return &AgentUpdateService{
+		docker:        dockerClient,
+		rollbackAfter: rollbackAfter,
+		logger:        logger,
+		pending:       make(map[string]*AgentUpdate),
+	}
+}
+
+// ParseAgentUpdateTarget parses the target of an update: a channel, or a version pinned
+// within the stable channel
+func ParseAgentUpdateTarget(value string) (channel, version string, ok bool) {
+	switch value = strings.ToLower(value); {
+	case value == "" || value == "latest" || value == protocol.ChannelStable:
+		return protocol.ChannelStable, "", true
+	case value == protocol.ChannelBeta:
+		return protocol.ChannelBeta, "", true
+	case agentVersionPattern.MatchString(value):
+		return protocol.ChannelStable, strings.TrimPrefix(value, "v"), true
+	default:
+		return "", "", false
+	}
+}
+
+// Version retrieves the release the agent of a server runs on behalf of a user
+func (s *AgentUpdateService) Version(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails) (*protocol.AgentVersionResponse, error) {
+	version, err := s.docker.GetAgentVersion(WithActor(ctx, userID, telegramID), server.ServerKey)
+	if err != nil {
+		s.logger.Error("Failed to get agent version", "error", err, "server_key", server.ServerKey)
+		return nil, err
+	}
+	return version, nil
+}
+
+// Pending returns the update in progress on a server
+func (s *AgentUpdateService) Pending(serverID string) (AgentUpdate, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	update, ok := s.pending[serverID]
+	if !ok {
+		return AgentUpdate{}, false
+	}
+	return *update, true
+}
+
+// RollbackAfter returns the time updated agents are given to reconnect
+func (s *AgentUpdateService) RollbackAfter() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.rollbackAfter
+}
+
+// SetRollbackAfter changes the time agents updated from now on are given to reconnect
+func (s *AgentUpdateService) SetRollbackAfter(rollbackAfter time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rollbackAfter = rollbackAfter
+}
+
+// Start asks the agent of a server to update itself. Only owners may update agents, and
+// a server updates one release at a time.
+func (s *AgentUpdateService) Start(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails, channel, version string, now time.Time) (*AgentUpdate, error) {
+	if err := Authorize(server, PermAgentUpdate); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	rollbackAfter := s.rollbackAfter
+	_, busy := s.pending[server.ID]
+	if !busy {
+		// Reserve the server while the agent is asked, so that a second update waits
+		s.pending[server.ID] = &AgentUpdate{ServerID: server.ID, StartedAt: now, Deadline: now.Add(rollbackAfter)}
+	}
+	s.mu.Unlock()
+	if busy {
+		return nil, errors.NewValidationError("agent update already in progress", map[string]interface{}{"server_id": server.ID})
+	}
+
+	updating, err := s.docker.UpdateAgent(WithActor(ctx, userID, telegramID), server.ServerKey, channel, version, rollbackAfter)
+	if err != nil {
+		s.mu.Lock()
+		delete(s.pending, server.ID)
+		s.mu.Unlock()
+		s.logger.Error("Failed to start agent update", "error", err, "server_key", server.ServerKey, "channel", channel, "version", version)
+		return nil, err
+	}
+
+	update := &AgentUpdate{
+		ServerID:      server.ID,
+		ServerName:    server.Name,
+		ServerKey:     server.ServerKey,
+		TelegramID:    telegramID,
+		Channel:       channel,
+		FromVersion:   updating.CurrentVersion,
+		TargetVersion: updating.TargetVersion,
+		StartedAt:     now,
+		Deadline:      now.Add(rollbackAfter),
+	}
+	s.mu.Lock()
+	s.pending[server.ID] = update
+	s.mu.Unlock()
+
+	s.logger.Info("Agent update started", "server_id", server.ID, "from", update.FromVersion, "to", update.TargetVersion, "channel", channel)
+	return update, nil
+}
+
+// Verify asks agents being updated for their release and returns the updates that ended:
+// the agent runs the new release, reports a rollback or still runs the previous release
+// after its rollback window, or stayed unreachable well past it
+func (s *AgentUpdateService) Verify(ctx context.Context, now time.Time) []AgentUpdateOutcome {
+	s.mu.Lock()
+	var updates []AgentUpdate
+	for _, update := range s.pending {
+		if update.ServerKey != "" && now.Sub(update.StartedAt) >= agentRestartDelay {
+			updates = append(updates, *update)
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(updates, func(i, j int) bool { return updates[i].StartedAt.Before(updates[j].StartedAt) })
+
+	var outcomes []AgentUpdateOutcome
+	for _, update := range updates {
+		outcome, done := s.verify(ctx, update, now)
+		if !done {
+			continue
+		}
+
+		s.mu.Lock()
+		delete(s.pending, update.ServerID)
+		s.mu.Unlock()
+
+		s.logger.Info("Agent update finished", "server_id", update.ServerID, "status", outcome.Status, "version", outcome.Version)
+		outcomes = append(outcomes, outcome)
+	}
+	return outcomes
+}
+
+// verify checks a single update, reporting whether it ended
+func (s *AgentUpdateService) verify(ctx context.Context, update AgentUpdate, now time.Time) (AgentUpdateOutcome, bool) {
+	outcome := AgentUpdateOutcome{Update: update}
+
+	version, err := s.docker.GetAgentVersion(ctx, update.ServerKey)
+	if err != nil {
+		if now.After(update.Deadline.Add(agentLostGrace)) {
+			outcome.Status = AgentUpdateLost
+			return outcome, true
+		}
+		return outcome, false
+	}
+
+	outcome.Version = version.Version
+	switch {
+	case version.RolledBack:
+		outcome.Status = AgentUpdateRolledBack
+	case version.Version == update.TargetVersion:
+		outcome.Status = AgentUpdateDone
+	case now.After(update.Deadline):
+		outcome.Status = AgentUpdateRolledBack
+	default:
+		return outcome, false
+	}
+	return outcome, true
+}
+
+// FormatAgentVersion formats the release an agent runs and its update in progress
+func FormatAgentVersion(server *models.ServerWithDetails, version *protocol.AgentVersionResponse, pending *AgentUpdate) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("🤖 Агент %s(%s): версия %s, канал %s\n", server.Name, server.ID, version.Version, version.Channel))
+	if version.RolledBack {
+		sb.WriteString("↩️ Последнее обновление не удалось, агент вернулся на предыдущую версию.\n")
+	}
+	if pending != nil {
+		sb.WriteString(fmt.Sprintf("⏳ Идет обновление до %s\n", pending.TargetVersion))
+	}
+	sb.WriteString(fmt.Sprintf("\nОбновить: /update %s stable, /update %s beta или /update %s 1.4.2", server.ID, server.ID, server.ID))
+	return sb.String()
+}
+
+// FormatAgentUpdateOutcome formats how an agent update ended
+func FormatAgentUpdateOutcome(outcome AgentUpdateOutcome) string {
+	update := outcome.Update
+	switch outcome.Status {
+	case AgentUpdateDone:
+		return fmt.Sprintf("✅ Агент %s(%s) обновлен: %s → %s.", update.ServerName, update.ServerID, update.FromVersion, outcome.Version)
+	case AgentUpdateRolledBack:
+		return fmt.Sprintf("↩️ Агент %s(%s) не смог подключиться на версии %s и вернулся на %s.", update.ServerName, update.ServerID, update.TargetVersion, outcome.Version)
+	default:
+		return fmt.Sprintf("🚨 Агент %s(%s) не вышел на связь после обновления до %s, ни на новой, ни на прежней версии %s. Проверьте сервер.",
+			update.ServerName, update.ServerID, update.TargetVersion, update.FromVersion)
+	}
+}
@@ -0,0 +1,237 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/repository"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// maxAlertRoutes bounds the alert routes of a user
+const maxAlertRoutes = 50
+
+// AlertRouteService routes alerts of a category to another chat than the private chat of
+// the user, e.g. disk alerts to an infrastructure group. A route applies to one server or
+// to all servers of the user and to one category or to all of them; the most specific
+// route of an alert wins, a server route over a category one.
+type AlertRouteService struct {
+	repo   repository.AlertRouteStore
+	logger Logger
+
+	mu     sync.Mutex
+	routes map[int64][]models.AlertRoute // Telegram ID -> routes
+}
+
+// NewAlertRouteService creates a new alert route service
+func NewAlertRouteService(repo repository.AlertRouteStore, logger Logger) *AlertRouteService {
+	return &AlertRouteService{
+		repo:   repo,
+		logger: logger,
+		routes: make(map[int64][]models.AlertRoute),
+	}
+}
+
+// ParseAlertCategory validates the category of a route
+func ParseAlertCategory(value string) (string, bool) {
+	category := strings.ToLower(value)
+	switch category {
+	case "mem", "ram":
+		category = "memory"
+	case "temp":
+		category = "temperature"
+	case "smart":
+		category = "disk"
+	}
+	_, ok := alertCategoryLabels[category]
+	return category, ok
+}
+
+// AlertCategories lists the categories alerts may be routed by
+func AlertCategories() []string {
+	return []string{AlertCategoryAll, "cpu", "memory", "disk", "temperature", "load", AlertCategoryContainers, AlertCategoryChecks, AlertCategoryUptime}
+}
+
+// Load loads the alert routes of all users from the database
+func (s *AlertRouteService) Load(ctx context.Context) error {
+	stored, err := s.repo.ListAlertRoutes(ctx)
+	if err != nil {
+		return err
+	}
+
+	routes := make(map[int64][]models.AlertRoute)
+	for _, route := range stored {
+		routes[route.TelegramID] = append(routes[route.TelegramID], route)
+	}
+
+	s.mu.Lock()
+	s.routes = routes
+	s.mu.Unlock()
+
+	s.logger.Info("Alert routes loaded", "count", len(stored))
+	return nil
+}
+
+// Set routes the alerts of a category about a server, or all servers when serverID is
+// empty, to a chat. Routing to the private chat of the user overrides a broader route.
+func (s *AlertRouteService) Set(ctx context.Context, telegramID int64, serverID, category string, chatID int64) (*models.AlertRoute, error) {
+	s.mu.Lock()
+	count := len(s.routes[telegramID])
+	_, exists := s.find(telegramID, serverID, category)
+	s.mu.Unlock()
+	if count >= maxAlertRoutes && !exists {
+		return nil, errors.NewValidationError("too many alert routes", map[string]interface{}{"telegram_id": telegramID, "max": maxAlertRoutes})
+	}
+
+	route := &models.AlertRoute{
+		TelegramID: telegramID,
+		ServerID:   serverID,
+		Category:   category,
+		ChatID:     chatID,
+	}
+	if err := s.repo.UpsertAlertRoute(ctx, route); err != nil {
+		s.logger.Error("Failed to save alert route", "error", err, "telegram_id", telegramID, "category", category)
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if i, ok := s.find(telegramID, serverID, category); ok {
+		s.routes[telegramID][i] = *route
+	} else {
+		s.routes[telegramID] = append(s.routes[telegramID], *route)
+	}
+	s.mu.Unlock()
+
+	s.logger.Info("Alert route set", "telegram_id", telegramID, "server_id", serverID, "category", category, "chat_id", chatID)
+	return route, nil
+}
+
+// Remove removes a route, reporting whether it existed
+func (s *AlertRouteService) Remove(ctx context.Context, telegramID int64, serverID, category string) (bool, error) {
+	removed, err := s.repo.DeleteAlertRoute(ctx, telegramID, serverID, category)
+	if err != nil {
+		s.logger.Error("Failed to remove alert route", "error", err, "telegram_id", telegramID, "category", category)
+		return false, err
+	}
+
+	s.mu.Lock()
+	if i, ok := s.find(telegramID, serverID, category); ok {
+		routes := s.routes[telegramID]
+		s.routes[telegramID] = append(routes[:i:i], routes[i+1:]...)
+	}
+	s.mu.Unlock()
+
+	return removed, nil
+}
+
+// List returns the routes of a user
+func (s *AlertRouteService) List(telegramID int64) []models.AlertRoute {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	routes := append([]models.AlertRoute(nil), s.routes[telegramID]...)
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].ServerID != routes[j].ServerID {
+			return routes[i].ServerID < routes[j].ServerID
+		}
+		return routes[i].Category < routes[j].Category
+	})
+	return routes
+}
+
+// Route returns the chat an alert is sent to, the private chat of its user when no
+// route applies. An alert about several servers follows their server routes only when
+// they all lead to the same chat.
+func (s *AlertRouteService) Route(notification AlertNotification) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	routes := s.routes[notification.TelegramID]
+	if len(routes) == 0 {
+		return notification.TelegramID
+	}
+
+	chatID, found := int64(0), len(notification.ServerIDs) > 0
+	for _, serverID := range notification.ServerIDs {
+		route, ok := s.match(routes, serverID, notification.Category)
+		if !ok || chatID != 0 && route.ChatID != chatID {
+			found = false
+			break
+		}
+		chatID = route.ChatID
+	}
+	if found {
+		return chatID
+	}
+
+	if route, ok := s.match(routes, "", notification.Category); ok {
+		return route.ChatID
+	}
+	return notification.TelegramID
+}
+
+// match returns the most specific route of a server and category, preferring the exact
+// category and then routes of all categories
+func (s *AlertRouteService) match(routes []models.AlertRoute, serverID, category string) (models.AlertRoute, bool) {
+	var best models.AlertRoute
+	found := false
+	for _, route := range routes {
+		if route.ServerID != serverID {
+			continue
+		}
+		if category != "" && route.Category == category {
+			return route, true
+		}
+		if route.Category == AlertCategoryAll {
+			best, found = route, true
+		}
+	}
+	return best, found
+}
+
+// find returns the index of the route of a user, server and category. Callers hold mu.
+func (s *AlertRouteService) find(telegramID int64, serverID, category string) (int, bool) {
+	for i, route := range s.routes[telegramID] {
+		if route.ServerID == serverID && route.Category == category {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// FormatAlertRoutes formats the routes of a user
+func FormatAlertRoutes(routes []models.AlertRoute, telegramID int64) string {
+	if len(routes) == 0 {
+		return "🔀 Все алерты приходят в личный чат.\n\nЧтобы отправлять, например, алерты дисков в группу, напишите в ней /route disk."
+	}
+
+	var sb strings.Builder
+	sb.WriteString("🔀 Маршруты алертов:\n\n")
+	for _, route := range routes {
+		servers := "все серверы"
+		if route.ServerID != "" {
+			servers = route.ServerID
+		}
+
+		chat := "личный чат"
+		if route.ChatID != telegramID {
+			chat = fmt.Sprintf("групповой чат %d", route.ChatID)
+		}
+
+		sb.WriteString(fmt.Sprintf("- %s, %s → %s\n", alertCategoryLabels[route.Category], servers, chat))
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// FormatAlertCategories lists the categories alerts may be routed by
+func FormatAlertCategories() string {
+	var sb strings.Builder
+	for _, category := range AlertCategories() {
+		sb.WriteString(fmt.Sprintf("%s - %s\n", category, alertCategoryLabels[category]))
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
@@ -0,0 +1,490 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/alerts"
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/repository"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// maxCorrelationWindow bounds the correlation window of a tag
+const maxCorrelationWindow = time.Hour
+
+// tagName restricts tag names to short lowercase identifiers
+var tagName = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+// alertMetricLabels names the metrics alert thresholds may be set for
+var alertMetricLabels = map[string]string{
+	"cpu":         "CPU",
+	"memory":      "Память",
+	"disk":        "Диск",
+	"temperature": "Температура",
+	"load":        "Load",
+}
+
+// Alert categories besides the metrics of alertMetricLabels, which categorize threshold
+// alerts. Users route alerts of a category to another chat with /route.
+const (
+	AlertCategoryAll        = "all" // routes every category
+	AlertCategoryContainers = "containers"
+	AlertCategoryChecks     = "checks" // external monitoring: passive checks and Alertmanager
+	AlertCategoryUptime     = "uptime"
+)
+
+// alertCategoryLabels names the alert categories users may route
+var alertCategoryLabels = map[string]string{
+	AlertCategoryAll:        "Все алерты",
+	"cpu":                   "CPU",
+	"memory":                "Память",
+	"disk":                  "Диск и SMART",
+	"temperature":           "Температура",
+	"load":                  "Load",
+	AlertCategoryContainers: "Контейнеры",
+	AlertCategoryChecks:     "Внешний мониторинг",
+	AlertCategoryUptime:     "Доступность сайтов и портов",
+	AlertCategoryProcesses:  "Процессы",
+	AlertCategoryLogs:       "Логи",
+	AlertCategoryBackups:    "Резервные копии",
+}
+
+// AlertNotification is an alert message for one user
+type AlertNotification struct {
+	TelegramID int64
+	ServerIDs  []string // servers the alert is about
+	Category   string   // alert category routes apply to, empty for alerts of several categories
+	Text       string
+	Keyboard   [][]map[string]string // buttons under the alert in Telegram, dropped from summaries
+}
+
+// AlertService checks server metrics against thresholds and correlates alerts
+// of servers sharing a tag into one message
+type AlertService struct {
+	targets        repository.UserStore
+	tags           repository.TagStore
+	metricsService *MetricsServiceImpl
+	thresholds     map[string]float64
+	defaultWindow  time.Duration
+	correlator     *alerts.Correlator
+	logger         Logger
+
+	mu         sync.Mutex
+	firing     map[string]bool            // server ID + metric -> currently above threshold
+	tagInfo    map[string]models.Tag      // tag name -> metadata
+	serverTags map[string]map[string]bool // server ID -> tags
+}
+
+// NewAlertService creates a new alert service. Alerts of servers sharing a tag are held for
+// the correlation window of the tag, or defaultWindow when the tag has none.
+func NewAlertService(targets repository.UserStore, tags repository.TagStore, metricsService *MetricsServiceImpl, thresholds map[string]float64, defaultWindow time.Duration, logger Logger) *AlertService {
+	return &AlertService{
+		targets:        targets,
+		tags:           tags,
+		metricsService: metricsService,
+		thresholds:     thresholds,
+		defaultWindow:  defaultWindow,
+		correlator:     alerts.NewCorrelator(),
+		logger:         logger,
+		firing:         make(map[string]bool),
+		tagInfo:        make(map[string]models.Tag),
+		serverTags:     make(map[string]map[string]bool),
+	}
+}
+
+// Enabled reports whether any alert threshold is configured
+func (s *AlertService) Enabled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.thresholds) > 0
+}
+
+// SetDefaults changes the alert thresholds and the correlation window of tags without
+// one of their own. Alerts already firing keep firing until their metric recovers.
+func (s *AlertService) SetDefaults(thresholds map[string]float64, defaultWindow time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.thresholds = thresholds
+	s.defaultWindow = defaultWindow
+}
+
+// currentThresholds returns the alert thresholds by metric. The map is replaced, never
+// changed, by SetDefaults and must not be modified.
+func (s *AlertService) currentThresholds() map[string]float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.thresholds
+}
+
+// Load loads server tags and tag metadata from the database
+func (s *AlertService) Load(ctx context.Context) error {
+	tags, err := s.tags.ListTags(ctx)
+	if err != nil {
+		return err
+	}
+	serverTags, err := s.tags.ListServerTags(ctx)
+	if err != nil {
+		return err
+	}
+
+	info := make(map[string]models.Tag, len(tags))
+	for _, tag := range tags {
+		info[tag.Name] = tag
+	}
+	byServer := make(map[string]map[string]bool)
+	for _, st := range serverTags {
+		if byServer[st.ServerID] == nil {
+			byServer[st.ServerID] = make(map[string]bool)
+		}
+		byServer[st.ServerID][st.Tag] = true
+	}
+
+	s.mu.Lock()
+	s.tagInfo = info
+	s.serverTags = byServer
+	s.mu.Unlock()
+
+	s.logger.Info("Server tags loaded", "tags", len(tags), "assignments", len(serverTags))
+	return nil
+}
+
+// TagServer assigns a tag to a server
+func (s *AlertService) TagServer(ctx context.Context, server *models.ServerWithDetails, tag string) error {
+	if err := Authorize(server, PermTags); err != nil {
+		return err
+	}
+	serverID := server.ID
+
+	tag = strings.ToLower(tag)
+	if !tagName.MatchString(tag) {
+		return errors.NewValidationError("invalid tag name", map[string]interface{}{"tag": tag})
+	}
+
+	if err := s.tags.AddServerTag(ctx, serverID, tag); err != nil {
+		s.logger.Error("Failed to tag server", "error", err, "server_id", serverID, "tag", tag)
+		return err
+	}
+
+	s.mu.Lock()
+	if s.serverTags[serverID] == nil {
+		s.serverTags[serverID] = make(map[string]bool)
+	}
+	s.serverTags[serverID][tag] = true
+	s.mu.Unlock()
+
+	return nil
+}
+
+// UntagServer removes a tag from a server, reporting whether it was assigned
+func (s *AlertService) UntagServer(ctx context.Context, server *models.ServerWithDetails, tag string) (bool, error) {
+	if err := Authorize(server, PermTags); err != nil {
+		return false, err
+	}
+	serverID := server.ID
+
+	tag = strings.ToLower(tag)
+
+	removed, err := s.tags.RemoveServerTag(ctx, serverID, tag)
+	if err != nil {
+		s.logger.Error("Failed to untag server", "error", err, "server_id", serverID, "tag", tag)
+		return false, err
+	}
+
+	s.mu.Lock()
+	delete(s.serverTags[serverID], tag)
+	s.mu.Unlock()
+
+	return removed, nil
+}
+
+// SetTagWindow sets the correlation window of a tag, zero restores the default.
+// Tags are shared, so they are set up by the users managing the tags of one of the servers carrying them.
+func (s *AlertService) SetTagWindow(ctx context.Context, servers []models.ServerWithDetails, tag string, window time.Duration) error {
+	if err := s.authorizeTag(servers, tag); err != nil {
+		return err
+	}
+	if window < 0 || window > maxCorrelationWindow {
+		return errors.NewValidationError("correlation window out of range", map[string]interface{}{"window": window.String()})
+	}
+
+	return s.updateTag(ctx, tag, func(t *models.Tag) {
+		t.CorrelationWindow = int(window / time.Second)
+	})
+}
+
+// SetTagDescription sets the description of a tag shown in correlated alerts
+func (s *AlertService) SetTagDescription(ctx context.Context, servers []models.ServerWithDetails, tag, description string) error {
+	if err := s.authorizeTag(servers, tag); err != nil {
+		return err
+	}
+	return s.updateTag(ctx, tag, func(t *models.Tag) {
+		t.Description = strings.TrimSpace(description)
+	})
+}
+
+// HasTag reports whether any of the servers carries the tag
+func (s *AlertService) HasTag(servers []models.ServerWithDetails, tag string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, server := range servers {
+		if s.serverTags[server.ID][strings.ToLower(tag)] {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeTag returns a forbidden error unless one of the servers the user may manage
+// the tags of carries the tag
+func (s *AlertService) authorizeTag(servers []models.ServerWithDetails, tag string) error {
+	var managed []models.ServerWithDetails
+	for _, server := range servers {
+		if Can(&server, PermTags) {
+			managed = append(managed, server)
+		}
+	}
+	if !s.HasTag(managed, tag) {
+		return errors.NewForbiddenError(fmt.Sprintf("server %s role required", permissionRoles[PermTags]))
+	}
+	return nil
+}
+
+// Check evaluates the metrics of all servers against the thresholds and returns
+// the alert notifications that are due, correlating alerts of servers sharing a tag
+func (s *AlertService) Check(ctx context.Context, now time.Time) ([]AlertNotification, error) {
+	targets, err := s.targets.ListAlertTargets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Group recipients by server, keeping the order of the targets
+	var servers []models.AlertTarget
+	recipients := make(map[string][]int64)
+	for _, target := range targets {
+		if _, ok := recipients[target.ServerID]; !ok {
+			servers = append(servers, target)
+		}
+		recipients[target.ServerID] = append(recipients[target.ServerID], target.TelegramID)
+	}
+
+	thresholds := s.currentThresholds()
+
+	for _, server := range servers {
+		metrics, err := s.metricsService.GetServerMetrics(server.ServerKey)
+		if err != nil {
+			s.logger.Warn("Failed to get metrics for alerts", "error", err, "server_key", server.ServerKey)
+			continue
+		}
+
+		for metric, value := range alertValues(&metrics.Metrics) {
+			threshold, ok := thresholds[metric]
+			if !ok {
+				continue
+			}
+
+			key := server.ServerID + "/" + metric
+			s.mu.Lock()
+			wasFiring := s.firing[key]
+			s.firing[key] = value >= threshold
+			s.mu.Unlock()
+
+			if value < threshold || wasFiring {
+				continue
+			}
+
+			s.correlator.Add(alerts.Alert{
+				ServerID:   server.ServerID,
+				ServerName: server.Name,
+				Metric:     metric,
+				Value:      value,
+				Threshold:  threshold,
+				Recipients: recipients[server.ServerID],
+				FiredAt:    now,
+			}, s.tagWindows(server.ServerID))
+		}
+	}
+
+	var notifications []AlertNotification
+	for _, group := range s.correlator.Due(now) {
+		notifications = append(notifications, s.formatGroup(group)...)
+	}
+	return notifications, nil
+}
+
+// FormatTags formats the tags of the user's servers with their metadata
+func (s *AlertService) FormatTags(servers []models.ServerWithDetails) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var sb strings.Builder
+	used := make(map[string]bool)
+	for _, server := range servers {
+		tags := sortedKeys(s.serverTags[server.ID])
+		if len(tags) == 0 {
+			continue
+		}
+		if sb.Len() == 0 {
+			sb.WriteString("🏷️ Теги серверов:\n\n")
+		}
+		sb.WriteString(fmt.Sprintf("%s(%s): %s\n", server.Name, server.ID, strings.Join(tags, ", ")))
+		for _, tag := range tags {
+			used[tag] = true
+		}
+	}
+
+	if sb.Len() == 0 {
+		return "🏷️ У ваших серверов нет тегов.\n\nДобавьте тег: /tag add <server_id> <tag>"
+	}
+
+	sb.WriteString("\nОкна корреляции:\n")
+	for _, tag := range sortedKeys(used) {
+		info := s.tagInfo[tag]
+		sb.WriteString(fmt.Sprintf("- %s: %s", tag, s.window(info)))
+		if info.Description != "" {
+			sb.WriteString(" - " + info.Description)
+		}
+		sb.WriteString("\n")
+	}
+
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// updateTag changes the metadata of a tag and stores it
+func (s *AlertService) updateTag(ctx context.Context, tag string, update func(t *models.Tag)) error {
+	tag = strings.ToLower(tag)
+	if !tagName.MatchString(tag) {
+		return errors.NewValidationError("invalid tag name", map[string]interface{}{"tag": tag})
+	}
+
+	s.mu.Lock()
+	info, ok := s.tagInfo[tag]
+	s.mu.Unlock()
+	if !ok {
+		info = models.Tag{Name: tag}
+	}
+	update(&info)
+
+	if err := s.tags.UpsertTag(ctx, &info); err != nil {
+		s.logger.Error("Failed to save tag", "error", err, "tag", tag)
+		return err
+	}
+
+	s.mu.Lock()
+	s.tagInfo[tag] = info
+	s.mu.Unlock()
+
+	return nil
+}
+
+// tagWindows returns the correlation windows of the tags of a server
+func (s *AlertService) tagWindows(serverID string) map[string]time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	windows := make(map[string]time.Duration)
+	for tag := range s.serverTags[serverID] {
+		windows[tag] = s.window(s.tagInfo[tag])
+	}
+	return windows
+}
+
+// window returns the correlation window of a tag
+func (s *AlertService) window(tag models.Tag) time.Duration {
+	if tag.CorrelationWindow > 0 {
+		return time.Duration(tag.CorrelationWindow) * time.Second
+	}
+	return s.defaultWindow
+}
+
+// formatGroup formats a group of alerts for each of its recipients. A recipient who can see
+// several servers of a correlated group gets one "possible common cause" message.
+func (s *AlertService) formatGroup(group alerts.Group) []AlertNotification {
+	byRecipient := make(map[int64][]alerts.Alert)
+	var order []int64
+	for _, alert := range group.Alerts {
+		for _, id := range alert.Recipients {
+			if _, ok := byRecipient[id]; !ok {
+				order = append(order, id)
+			}
+			byRecipient[id] = append(byRecipient[id], alert)
+		}
+	}
+
+	s.mu.Lock()
+	description := s.tagInfo[group.Tag].Description
+	s.mu.Unlock()
+
+	var notifications []AlertNotification
+	for _, id := range order {
+		visible := alerts.Group{Tag: group.Tag, Alerts: byRecipient[id]}
+		if !visible.Correlated() {
+			for _, alert := range visible.Alerts {
+				notifications = append(notifications, AlertNotification{TelegramID: id, ServerIDs: []string{alert.ServerID}, Category: alert.Metric, Text: formatAlert(alert)})
+			}
+			continue
+		}
+
+		category := visible.Alerts[0].Metric
+		var sb strings.Builder
+		sb.WriteString(fmt.Sprintf("🚨 Возможная общая причина: тег %s, серверов с проблемами: %d\n", group.Tag, len(visible.Servers())))
+		if description != "" {
+			sb.WriteString(description + "\n")
+		}
+		sb.WriteString("\n")
+		for _, alert := range visible.Alerts {
+			sb.WriteString(fmt.Sprintf("🖥️ %s(%s): %s %.1f (порог %.1f)\n",
+				alert.ServerName, alert.ServerID, alertMetricLabels[alert.Metric], alert.Value, alert.Threshold))
+			if alert.Metric != category {
+				category = ""
+			}
+		}
+		notifications = append(notifications, AlertNotification{TelegramID: id, ServerIDs: visible.Servers(), Category: category, Text: strings.TrimRight(sb.String(), "\n")})
+	}
+
+	return notifications
+}
+
+// formatAlert formats a single alert
+func formatAlert(alert alerts.Alert) string {
+	return fmt.Sprintf("🚨 %s(%s): %s %.1f (порог %.1f)",
+		alert.ServerName, alert.ServerID, alertMetricLabels[alert.Metric], alert.Value, alert.Threshold)
+}
+
+// alertValues extracts the values alert thresholds are checked against
+func alertValues(metrics *domain.ServerMetrics) map[string]float64 {
+	disk := metrics.Disk
+	for _, d := range metrics.DiskDetails {
+		if d.UsedPercent > disk {
+			disk = d.UsedPercent
+		}
+	}
+
+	return map[string]float64{
+		"cpu":         metrics.CPU,
+		"memory":      metrics.Memory,
+		"disk":        disk,
+		"temperature": metrics.TemperatureDetails.HighestTemperature,
+		"load":        metrics.CPUUsage.LoadAverage.Load1min,
+	}
+}
+
+// sortedKeys returns the keys of a set in alphabetical order
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
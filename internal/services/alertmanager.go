@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/servereye/servereyebot/internal/alerts"
+	"github.com/servereye/servereyebot/internal/models"
+)
+
+// maxAlertmanagerAlertsPerMessage bounds the alerts listed in one message, Alertmanager
+// groups may hold hundreds of them
+const maxAlertmanagerAlertsPerMessage = 20
+
+// AlertmanagerResult represents the outcome of an Alertmanager webhook
+type AlertmanagerResult struct {
+	Notifications []AlertNotification
+	Matched       int // alerts mapped to a server
+	Unmatched     int // alerts without a known server in their label
+}
+
+// FromAlertmanager maps the alerts of an Alertmanager webhook to servers by the value of
+// serverLabel, which may hold the server ID or name, and builds one message per user of
+// the servers. Values such as "web-01:9100" of the instance label match without the port.
+func (s *AlertService) FromAlertmanager(ctx context.Context, webhook *alerts.AlertmanagerWebhook, serverLabel string) (*AlertmanagerResult, error) {
+	targets, err := s.targets.ListAlertTargets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	servers := make(map[string]models.AlertTarget)
+	recipients := make(map[string][]int64)
+	for _, target := range targets {
+		servers[strings.ToLower(target.ServerID)] = target
+		servers[strings.ToLower(target.Name)] = target
+		recipients[target.ServerID] = append(recipients[target.ServerID], target.TelegramID)
+	}
+
+	result := &AlertmanagerResult{}
+	byRecipient := make(map[int64][]alertmanagerEntry)
+	for _, alert := range webhook.Alerts {
+		server, ok := matchAlertServer(servers, alert.Labels[serverLabel])
+		if !ok {
+			result.Unmatched++
+			continue
+		}
+		result.Matched++
+
+		for _, telegramID := range recipients[server.ServerID] {
+			byRecipient[telegramID] = append(byRecipient[telegramID], alertmanagerEntry{alert: alert, server: server})
+		}
+	}
+
+	telegramIDs := make([]int64, 0, len(byRecipient))
+	for telegramID := range byRecipient {
+		telegramIDs = append(telegramIDs, telegramID)
+	}
+	sort.Slice(telegramIDs, func(i, j int) bool { return telegramIDs[i] < telegramIDs[j] })
+
+	for _, telegramID := range telegramIDs {
+		entries := byRecipient[telegramID]
+		result.Notifications = append(result.Notifications, AlertNotification{
+			TelegramID: telegramID,
+			ServerIDs:  alertmanagerServerIDs(entries),
+			Category:   AlertCategoryChecks,
+			Text:       formatAlertmanagerAlerts(webhook.ExternalURL, entries),
+		})
+	}
+
+	if result.Unmatched > 0 {
+		s.logger.Warn("Alertmanager alerts without a known server", "count", result.Unmatched, "label", serverLabel, "receiver", webhook.Receiver)
+	}
+	return result, nil
+}
+
+// alertmanagerEntry represents an Alertmanager alert mapped to a server
+type alertmanagerEntry struct {
+	alert  alerts.AlertmanagerAlert
+	server models.AlertTarget
+}
+
+// matchAlertServer finds the server named by a label value, by ID or name, with or without a port
+func matchAlertServer(servers map[string]models.AlertTarget, value string) (models.AlertTarget, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return models.AlertTarget{}, false
+	}
+	if server, ok := servers[value]; ok {
+		return server, true
+	}
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		server, ok := servers[host]
+		return server, ok
+	}
+	return models.AlertTarget{}, false
+}
+
+// alertmanagerServerIDs returns the distinct servers of mapped alerts
+func alertmanagerServerIDs(entries []alertmanagerEntry) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, entry := range entries {
+		if !seen[entry.server.ServerID] {
+			seen[entry.server.ServerID] = true
+			ids = append(ids, entry.server.ServerID)
+		}
+	}
+	return ids
+}
+
+// formatAlertmanagerAlerts formats the Prometheus alerts of a user, firing ones first
+func formatAlertmanagerAlerts(externalURL string, entries []alertmanagerEntry) string {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].alert.Status == alerts.AlertmanagerFiring && entries[j].alert.Status != alerts.AlertmanagerFiring
+	})
+
+	firing := 0
+	for _, entry := range entries {
+		if entry.alert.Status == alerts.AlertmanagerFiring {
+			firing++
+		}
+	}
+
+	var sb strings.Builder
+	switch {
+	case firing == 0:
+		sb.WriteString("✅ Prometheus: алерты решены\n\n")
+	case firing == len(entries):
+		sb.WriteString(fmt.Sprintf("🔥 Prometheus: %d алерт(ов)\n\n", firing))
+	default:
+		sb.WriteString(fmt.Sprintf("🔥 Prometheus: %d алерт(ов), %d решено\n\n", firing, len(entries)-firing))
+	}
+
+	for i, entry := range entries {
+		if i == maxAlertmanagerAlertsPerMessage {
+			sb.WriteString(fmt.Sprintf("… и еще %d\n", len(entries)-i))
+			break
+		}
+
+		icon := "🔴"
+		if entry.alert.Status != alerts.AlertmanagerFiring {
+			icon = "✅"
+		}
+		sb.WriteString(fmt.Sprintf("%s %s — %s(%s)", icon, entry.alert.Name(), entry.server.Name, entry.server.ServerID))
+		if severity := entry.alert.Labels["severity"]; severity != "" {
+			sb.WriteString(fmt.Sprintf(" [%s]", severity))
+		}
+		sb.WriteString("\n")
+		if summary := entry.alert.Summary(); summary != "" {
+			sb.WriteString(summary + "\n")
+		}
+	}
+
+	if externalURL != "" {
+		sb.WriteString("\nAlertmanager: " + externalURL)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/repository"
+	"github.com/servereye/servereyebot/internal/slo"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// Audited command names
+const (
+	AuditCommandMetrics       = "metrics"
+	AuditCommandAddServer     = "add_server"
+	AuditCommandRemoveServer  = "remove_server"
+	AuditCommandRenameServer  = "rename_server"
+	AuditCommandExecDenied    = "exec_denied" // shell command rejected by the allow-list
+	AuditCommandDefine        = "define_command"
+	AuditCommandUndefine      = "remove_command"
+	AuditCommandPairServer    = "pair_server"
+	AuditCommandRotateKey     = "rotate_key"
+	AuditCommandSSHKeyDenied  = "ssh_key_denied" // SSH key push by a user who does not own the server
+	AuditCommandLinkAccount   = "link_account"
+	AuditCommandUnlinkAccount = "unlink_account"
+)
+
+// auditCommandClasses maps audited commands to their SLO class
+var auditCommandClasses = map[string]slo.Class{
+	AuditCommandMetrics:       slo.ClassMetrics,
+	AuditCommandAddServer:     slo.ClassAdmin,
+	AuditCommandRemoveServer:  slo.ClassAdmin,
+	AuditCommandRenameServer:  slo.ClassAdmin,
+	AuditCommandPairServer:    slo.ClassAdmin,
+	AuditCommandRotateKey:     slo.ClassAdmin,
+	AuditCommandLinkAccount:   slo.ClassAdmin,
+	AuditCommandUnlinkAccount: slo.ClassAdmin,
+
+	// Agent commands are audited under their protocol message type
+	string(protocol.TypeGetContainerLogs):  slo.ClassContainers,
+	string(protocol.TypeGetContainerStats): slo.ClassContainers,
+	string(protocol.TypeListImages):        slo.ClassContainers,
+	string(protocol.TypePullImage):         slo.ClassContainers,
+	string(protocol.TypePruneImages):       slo.ClassContainers,
+	string(protocol.TypeListCompose):       slo.ClassContainers,
+	string(protocol.TypeComposeAction):     slo.ClassContainers,
+	string(protocol.TypeExecCommand):       slo.ClassAdmin,
+	string(protocol.TypeRunScript):         slo.ClassAdmin,
+	string(protocol.TypeListDir):           slo.ClassAdmin,
+	string(protocol.TypeReadFile):          slo.ClassAdmin,
+	string(protocol.TypeBlockAddress):      slo.ClassAdmin,
+	string(protocol.TypeUnblockAddress):    slo.ClassAdmin,
+	string(protocol.TypeRunSpeedtest):      slo.ClassAdmin,
+	string(protocol.TypePowerAction):       slo.ClassAdmin,
+	string(protocol.TypeVMAction):          slo.ClassAdmin,
+}
+
+// maxAuditResponseLength limits the stored response length (in characters) of an audited command
+const maxAuditResponseLength = 4096
+
+// actorKey is the context key of the user executing agent commands
+type actorKey struct{}
+
+// actor identifies the user on whose behalf an agent command is executed
+type actor struct {
+	userID     int64
+	telegramID int64
+}
+
+// WithActor returns a context attributing agent commands to the given user in the audit log
+func WithActor(ctx context.Context, userID, telegramID int64) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor{userID: userID, telegramID: telegramID})
+}
+
+// AuditService records and lists commands executed against servers
+type AuditService struct {
+	repo    repository.AuditStore
+	tracker *slo.Tracker
+	logger  Logger
+}
+
+// NewAuditService creates a new audit service. Outcomes of audited commands are
+// reported to tracker when it is not nil.
+func NewAuditService(repo repository.AuditStore, tracker *slo.Tracker, logger Logger) *AuditService {
+	return &AuditService{
+		repo:    repo,
+		tracker: tracker,
+		logger:  logger,
+	}
+}
+
+// Record stores an executed command in the audit log. Failures are only logged
+// so that auditing never breaks the audited action itself.
+func (s *AuditService) Record(ctx context.Context, entry *models.CommandHistory) {
+	if class, ok := auditCommandClasses[entry.Command]; ok && s.tracker != nil {
+		s.tracker.Record(class, entry.Success)
+	}
+
+	if runes := []rune(entry.Response); len(runes) > maxAuditResponseLength {
+		entry.Response = string(runes[:maxAuditResponseLength])
+	}
+
+	if err := s.repo.CreateCommandHistory(ctx, entry); err != nil {
+		s.logger.Error("Failed to record command history",
+			"error", err,
+			"command", entry.Command,
+			"server_id", entry.ServerID,
+			"telegram_id", entry.TelegramID)
+	}
+}
+
+// RecordResult stores the outcome of a command started at the given time
+func (s *AuditService) RecordResult(ctx context.Context, userID, telegramID int64, serverID, command, payload, response string, started time.Time, err error) {
+	entry := &models.CommandHistory{
+		UserID:     userID,
+		TelegramID: telegramID,
+		ServerID:   serverID,
+		Command:    command,
+		Payload:    payload,
+		Response:   response,
+		Success:    err == nil,
+		DurationMs: time.Since(started).Milliseconds(),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	s.Record(ctx, entry)
+}
+
+// RecordExchange stores an agent command envelope and its response in the audit log.
+// It implements docker.Recorder.
+func (s *AuditService) RecordExchange(ctx context.Context, serverKey string, req, resp *protocol.Message, elapsed time.Duration, err error) {
+	a, _ := ctx.Value(actorKey{}).(actor)
+
+	entry := &models.CommandHistory{
+		UserID:     a.userID,
+		TelegramID: a.telegramID,
+		ServerID:   serverKey,
+		Command:    string(req.Type),
+		Success:    err == nil,
+		DurationMs: elapsed.Milliseconds(),
+	}
+
+	if payload, err := json.Marshal(req.Payload); err == nil {
+		entry.Payload = string(payload)
+	}
+	if envelope, err := json.Marshal(req); err == nil {
+		entry.Envelope = string(envelope)
+	}
+	if resp != nil {
+		entry.Response = FormatResponsePayload(resp)
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	s.Record(ctx, entry)
+}
+
+// FormatResponsePayload renders the payload of an agent response the way it is stored in the audit log
+func FormatResponsePayload(resp *protocol.Message) string {
+	data, err := json.MarshalIndent(resp.Payload, "", "  ")
+	if err != nil {
+		return ""
+	}
+
+	response := string(data)
+	if runes := []rune(response); len(runes) > maxAuditResponseLength {
+		response = string(runes[:maxAuditResponseLength])
+	}
+	return response
+}
+
+// Get retrieves a single audit log entry
+func (s *AuditService) Get(ctx context.Context, id int64) (*models.CommandHistory, error) {
+	return s.repo.GetCommandHistory(ctx, id)
+}
+
+// ListForUser retrieves the latest commands executed on servers of a user
+func (s *AuditService) ListForUser(ctx context.Context, userID int64, limit int) ([]models.CommandHistory, error) {
+	return s.repo.ListCommandHistoryForUser(ctx, userID, limit)
+}
+
+// ListAll retrieves the latest commands executed on all servers
+func (s *AuditService) ListAll(ctx context.Context, limit int) ([]models.CommandHistory, error) {
+	return s.repo.ListCommandHistory(ctx, limit)
+}
+
+// FormatHistory formats audit log entries for display
+func (s *AuditService) FormatHistory(entries []models.CommandHistory, showUser bool) string {
+	if len(entries) == 0 {
+		return "История команд пуста."
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("📜 Последние действия (%d):\n\n", len(entries)))
+
+	for _, entry := range entries {
+		status := "✅"
+		if !entry.Success {
+			status = "❌"
+		}
+
+		sb.WriteString(fmt.Sprintf("%s #%d %s %s на %s", status, entry.ID, entry.CreatedAt.Format("02.01.2006 15:04"), entry.Command, entry.ServerID))
+		if entry.Payload != "" {
+			sb.WriteString(fmt.Sprintf(" [%s]", entry.Payload))
+		}
+		sb.WriteString(fmt.Sprintf(" (%d мс)", entry.DurationMs))
+		if showUser {
+			sb.WriteString(fmt.Sprintf("\n- Пользователь: %d", entry.TelegramID))
+		}
+		if entry.Error != "" {
+			sb.WriteString(fmt.Sprintf("\n- Ошибка: %s", entry.Error))
+		}
+		sb.WriteString("\n")
+	}
+
+	return strings.TrimRight(sb.String(), "\n")
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/repository"
+	"github.com/servereye/servereyebot/pkg/docker"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// AlertCategoryBackups categorizes alerts about stale or failing backups
+const AlertCategoryBackups = "backups"
+
+// BackupService shows the restic and borg repositories of user servers and warns when
+// the last successful backup of a repository gets older than its maximum age or its
+// last run failed. Repositories are configured on the agents.
+type BackupService struct {
+	docker   *docker.Client
+	targets  repository.UserStore
+	interval time.Duration
+	maxAge   time.Duration
+	logger   Logger
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	healthy   map[string]bool // server ID + repository -> whether it was healthy at the last check
+}
+
+// NewBackupService creates a new backup service checking repositories every interval
+// and alerting when the last successful backup is older than maxAge
+func NewBackupService(dockerClient *docker.Client, targets repository.UserStore, interval, maxAge time.Duration, logger Logger) *BackupService {
+	return &BackupService{
+		docker:   dockerClient,
+		targets:  targets,
+		interval: interval,
+		maxAge:   maxAge,
+		logger:   logger,
+		healthy:  make(map[string]bool),
+	}
+}
+
+// Get retrieves the backup repositories of a server on behalf of a user
+func (s *BackupService) Get(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails) (*protocol.BackupsResponse, error) {
+	backups, err := s.docker.GetBackups(WithActor(ctx, userID, telegramID), server.ServerKey)
+	if err != nil {
+		s.logger.Error("Failed to get backups", "error", err, "server_key", server.ServerKey)
+		return nil, err
+	}
+	return backups, nil
+}
+
+// SetMaxAge changes the age of the last successful backup alerts are sent at, for
+// repositories without a maximum age of their own
+func (s *BackupService) SetMaxAge(maxAge time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.maxAge = maxAge
+}
+
+// Check reads the repositories of all servers once the check interval has passed and
+// returns warnings about repositories that became stale or failing since the previous
+// check, and notices about repositories that recovered
+func (s *BackupService) Check(ctx context.Context, now time.Time) ([]AlertNotification, error) {
+	s.mu.Lock()
+	due := now.Sub(s.checkedAt) >= s.interval
+	if due {
+		s.checkedAt = now
+	}
+	s.mu.Unlock()
+	if !due {
+		return nil, nil
+	}
+
+	targets, err := s.targets.ListAlertTargets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var servers []models.AlertTarget
+	recipients := make(map[string][]int64)
+	for _, target := range targets {
+		if _, ok := recipients[target.ServerID]; !ok {
+			servers = append(servers, target)
+		}
+		recipients[target.ServerID] = append(recipients[target.ServerID], target.TelegramID)
+	}
+
+	var notifications []AlertNotification
+	for _, server := range servers {
+		backups, err := s.docker.GetBackups(ctx, server.ServerKey)
+		if err != nil {
+			s.logger.Warn("Failed to get backups for alerts", "error", err, "server_key", server.ServerKey)
+			continue
+		}
+
+		var changes []string
+		for _, repo := range backups.Repositories {
+			if repo.Error != "" {
+				continue
+			}
+			if change := s.compare(server.ServerID, repo, now); change != "" {
+				changes = append(changes, change)
+			}
+		}
+		if len(changes) == 0 {
+			continue
+		}
+
+		text := fmt.Sprintf("💾 Резервные копии %s(%s)\n\n%s\n\nПодробнее: /backups %s", server.Name, server.ServerID, strings.Join(changes, "\n"), server.ServerID)
+		for _, telegramID := range recipients[server.ServerID] {
+			notifications = append(notifications, AlertNotification{
+				TelegramID: telegramID,
+				ServerIDs:  []string{server.ServerID},
+				Category:   AlertCategoryBackups,
+				Text:       text,
+			})
+		}
+	}
+
+	sort.SliceStable(notifications, func(i, j int) bool { return notifications[i].TelegramID < notifications[j].TelegramID })
+	return notifications, nil
+}
+
+// compare records whether a repository is healthy and returns the line about its change,
+// if any. The first check of a repository reports it only when it is unhealthy.
+func (s *BackupService) compare(serverID string, repo protocol.BackupRepository, now time.Time) string {
+	problem := s.problem(repo, now)
+
+	s.mu.Lock()
+	wasHealthy, seen := s.healthy[serverID+"/"+repo.Name]
+	s.healthy[serverID+"/"+repo.Name] = problem == ""
+	s.mu.Unlock()
+
+	switch {
+	case problem != "" && (!seen || wasHealthy):
+		return fmt.Sprintf("🔴 %s (%s): %s", repo.Name, repo.Tool, problem)
+	case problem == "" && seen && !wasHealthy:
+		return fmt.Sprintf("🟢 %s (%s): резервное копирование восстановилось, последняя копия %s назад", repo.Name, repo.Tool, formatAge(now.Sub(lastBackup(repo))))
+	default:
+		return ""
+	}
+}
+
+// problem describes why a repository is unhealthy, empty when it is healthy
+func (s *BackupService) problem(repo protocol.BackupRepository, now time.Time) string {
+	last := lastBackup(repo)
+	s.mu.Lock()
+	maxAge := s.maxAge
+	s.mu.Unlock()
+	if repo.MaxAgeSeconds > 0 {
+		maxAge = time.Duration(repo.MaxAgeSeconds) * time.Second
+	}
+
+	switch {
+	case repo.LastRunFailed:
+		return "последний запуск завершился ошибкой"
+	case last.IsZero():
+		return "успешных копий нет"
+	case now.Sub(last) > maxAge:
+		return fmt.Sprintf("последняя успешная копия %s назад (порог %s)", formatAge(now.Sub(last)), formatAge(maxAge))
+	default:
+		return ""
+	}
+}
+
+// FormatBackups formats the backup repositories of a server
+func (s *BackupService) FormatBackups(server *models.ServerWithDetails, backups *protocol.BackupsResponse, now time.Time) string {
+	if len(backups.Repositories) == 0 {
+		return fmt.Sprintf("💾 На %s(%s) не настроены репозитории резервных копий.\n\nДобавьте репозитории restic или borg в конфигурацию агента.", server.Name, server.ID)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("💾 Резервные копии %s(%s):\n\n", server.Name, server.ID))
+
+	for _, repo := range backups.Repositories {
+		if repo.Error != "" {
+			sb.WriteString(fmt.Sprintf("⚪ %s (%s): не удалось прочитать репозиторий (%s)\n\n", repo.Name, repo.Tool, truncateOutput(repo.Error, 200)))
+			continue
+		}
+
+		icon, status := "🟢", "в порядке"
+		if problem := s.problem(repo, now); problem != "" {
+			icon, status = "🔴", problem
+		}
+		sb.WriteString(fmt.Sprintf("%s %s (%s) — %s\n", icon, repo.Name, repo.Tool, status))
+		if last := lastBackup(repo); !last.IsZero() {
+			sb.WriteString(fmt.Sprintf("   Последняя копия: %s UTC (%s назад)\n", last.UTC().Format("02.01.2006 15:04"), formatAge(now.Sub(last))))
+		}
+		sb.WriteString(fmt.Sprintf("   Снимков: %d, размер: %s\n\n", repo.Snapshots, formatBytes(uint64(max(repo.Size, 0)))))
+	}
+
+	sb.WriteString(fmt.Sprintf("🕐 %s UTC", now.UTC().Format("15:04:05")))
+	return sb.String()
+}
+
+// lastBackup returns when a repository was last backed up successfully, falling back to
+// its latest snapshot for agents that do not track backup runs
+func lastBackup(repo protocol.BackupRepository) time.Time {
+	if !repo.LastSuccess.IsZero() {
+		return repo.LastSuccess
+	}
+	return repo.LastSnapshot
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/repository"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// maxChatServers bounds the servers attached to a group chat
+const maxChatServers = 20
+
+// ChatService manages servers attached to group chats. Members of a group see the
+// metrics of its servers as viewers, and alerts of the servers are posted to the group.
+type ChatService struct {
+	repo   repository.ChatStore
+	logger Logger
+}
+
+// NewChatService creates a new group chat service
+func NewChatService(repo repository.ChatStore, logger Logger) *ChatService {
+	return &ChatService{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// Bind attaches a server of a user to a group chat. Only server admins may share a
+// server with a group, since every member of the group can read its metrics.
+func (s *ChatService) Bind(ctx context.Context, chatID, userID int64, server *models.ServerWithDetails) error {
+	if err := Authorize(server, PermChats); err != nil {
+		return err
+	}
+
+	servers, err := s.repo.ListChatServers(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	if len(servers) >= maxChatServers {
+		return errors.NewValidationError("too many servers in chat", map[string]interface{}{"max": maxChatServers})
+	}
+
+	binding := &models.ChatServer{
+		ChatID:   chatID,
+		ServerID: server.ID,
+		BoundBy:  userID,
+	}
+	if err := s.repo.BindChatServer(ctx, binding); err != nil {
+		s.logger.Error("Failed to bind server to chat", "error", err, "chat_id", chatID, "server_id", server.ID)
+		return err
+	}
+
+	s.logger.Info("Server bound to chat", "chat_id", chatID, "server_id", server.ID, "user_id", userID)
+	return nil
+}
+
+// Unbind detaches a server from a group chat, reporting whether it was attached
+func (s *ChatService) Unbind(ctx context.Context, chatID int64, server *models.ServerWithDetails) (bool, error) {
+	if err := Authorize(server, PermChats); err != nil {
+		return false, err
+	}
+
+	removed, err := s.repo.UnbindChatServer(ctx, chatID, server.ID)
+	if err != nil {
+		s.logger.Error("Failed to unbind server from chat", "error", err, "chat_id", chatID, "server_id", server.ID)
+		return false, err
+	}
+	if removed {
+		s.logger.Info("Server unbound from chat", "chat_id", chatID, "server_id", server.ID)
+	}
+	return removed, nil
+}
+
+// Servers returns the servers attached to a group chat, with the viewer role of group members
+func (s *ChatService) Servers(ctx context.Context, chatID int64) ([]models.ServerWithDetails, error) {
+	servers, err := s.repo.ListChatServers(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range servers {
+		servers[i].Role = RoleViewer
+	}
+	return servers, nil
+}
+
+// ChatsByServer returns the group chats each server is attached to
+func (s *ChatService) ChatsByServer(ctx context.Context) (map[string][]int64, error) {
+	bindings, err := s.repo.ListChatBindings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	chats := make(map[string][]int64)
+	for _, binding := range bindings {
+		chats[binding.ServerID] = append(chats[binding.ServerID], binding.ChatID)
+	}
+	return chats, nil
+}
+
+// FormatChatServers formats the servers attached to a group chat
+func FormatChatServers(servers []models.ServerWithDetails) string {
+	if len(servers) == 0 {
+		return "👥 К этому чату не привязано ни одного сервера.\n\nАдминистратор сервера может привязать его командой /bind <server_id>."
+	}
+
+	var sb strings.Builder
+	sb.WriteString("👥 Серверы этого чата:\n\n")
+	for _, server := range servers {
+		sb.WriteString(fmt.Sprintf("🖥️ %s (%s)\n", server.Name, server.ID))
+	}
+	sb.WriteString("\nУчастники чата видят метрики этих серверов, алерты приходят в чат.")
+	return sb.String()
+}
@@ -0,0 +1,514 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/pkg/docker"
+	"github.com/servereye/servereyebot/pkg/errors"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// maxMessageLength keeps formatted output below the Telegram message limit
+const maxMessageLength = 3500
+
+// maxPendingCommandsShown bounds the pending commands listed in one message
+const maxPendingCommandsShown = 30
+
+// ContainerService manages Docker containers on user servers
+type ContainerService struct {
+	docker *docker.Client
+	logger Logger
+}
+
+// NewContainerService creates a new container service
+func NewContainerService(dockerClient *docker.Client, logger Logger) *ContainerService {
+	return &ContainerService{
+		docker: dockerClient,
+		logger: logger,
+	}
+}
+
+// GetLogs retrieves the last lines of container logs on behalf of a user. Logs may hold
+// secrets, so only server admins may read them.
+func (s *ContainerService) GetLogs(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails, container string, lines int) (*protocol.ContainerLogsResponse, error) {
+	if err := Authorize(server, PermContainerLogs); err != nil {
+		return nil, err
+	}
+
+	ctx = WithActor(ctx, userID, telegramID)
+
+	logs, err := s.docker.GetContainerLogs(ctx, server.ServerKey, container, docker.LogsOptions{Tail: lines})
+	if err != nil {
+		s.logger.Error("Failed to get container logs", "error", err, "server_key", server.ServerKey, "container", container)
+		return nil, err
+	}
+
+	return logs, nil
+}
+
+// FormatLogs formats container logs for display, keeping the most recent lines
+// when the output exceeds the message limit
+func (s *ContainerService) FormatLogs(server *models.ServerWithDetails, logs *protocol.ContainerLogsResponse, lines int) string {
+	name := logs.ContainerName
+	if name == "" {
+		name = logs.ContainerID
+	}
+
+	header := fmt.Sprintf("📄 Логи %s на %s(%s), последние %d строк:\n\n", name, server.Name, server.ID, lines)
+	if len(logs.Lines) == 0 {
+		return header + "Логи пусты."
+	}
+
+	body := strings.Join(logs.Lines, "\n")
+	if len(body) > maxMessageLength {
+		body = strings.ToValidUTF8(body[len(body)-maxMessageLength:], "")
+		if idx := strings.Index(body, "\n"); idx >= 0 {
+			body = body[idx+1:]
+		}
+		body = "…\n" + body
+	}
+
+	return header + body
+}
+
+// GetStats retrieves resource usage of all running containers on behalf of a user
+func (s *ContainerService) GetStats(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails) (*protocol.ContainerStatsResponse, error) {
+	ctx = WithActor(ctx, userID, telegramID)
+
+	stats, err := s.docker.GetContainerStats(ctx, server.ServerKey)
+	if err != nil {
+		s.logger.Error("Failed to get container stats", "error", err, "server_key", server.ServerKey)
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// FormatStats formats container resource usage for display, grouped by compose project
+// and sorted by CPU usage. Containers with a restart policy show it below their usage.
+func (s *ContainerService) FormatStats(server *models.ServerWithDetails, stats *protocol.ContainerStatsResponse, policies map[string]models.RestartPolicy) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("📈 Контейнеры на %s(%s):\n\n", server.Name, server.ID))
+
+	if len(stats.Containers) == 0 {
+		sb.WriteString("Нет запущенных контейнеров.")
+		return sb.String()
+	}
+
+	// Group containers by compose project, standalone containers go last
+	containers := make([]protocol.ContainerStats, len(stats.Containers))
+	copy(containers, stats.Containers)
+	sort.SliceStable(containers, func(i, j int) bool {
+		if containers[i].Project != containers[j].Project {
+			if containers[i].Project == "" || containers[j].Project == "" {
+				return containers[j].Project == ""
+			}
+			return containers[i].Project < containers[j].Project
+		}
+		return containers[i].CPUPercent > containers[j].CPUPercent
+	})
+
+	project := ""
+	for i, c := range containers {
+		if i == 0 || c.Project != project {
+			project = c.Project
+			if project != "" {
+				sb.WriteString(fmt.Sprintf("📦 Проект %s\n\n", project))
+			} else if i > 0 {
+				sb.WriteString("📦 Без проекта\n\n")
+			}
+		}
+
+		name := c.Name
+		if name == "" {
+			name = c.ContainerID
+		}
+		sb.WriteString(fmt.Sprintf("🐳 %s\n", name))
+		sb.WriteString(fmt.Sprintf("- CPU: %.1f%%\n", c.CPUPercent))
+		sb.WriteString(fmt.Sprintf("- Память: %s / %s (%.1f%%)\n", formatBytes(c.MemoryUsage), formatBytes(c.MemoryLimit), c.MemoryPercent))
+		sb.WriteString(fmt.Sprintf("- Сеть: ↓%s ↑%s\n", formatBytes(c.NetworkRx), formatBytes(c.NetworkTx)))
+		sb.WriteString(fmt.Sprintf("- Диск: чтение %s, запись %s\n", formatBytes(c.BlockRead), formatBytes(c.BlockWrite)))
+		if policy, ok := policies[c.Name]; ok {
+			sb.WriteString(fmt.Sprintf("- Перезапуск: %s\n", FormatRestartPolicy(policy)))
+		}
+		sb.WriteString("\n")
+	}
+
+	result := strings.TrimRight(sb.String(), "\n")
+	if runes := []rune(result); len(runes) > maxMessageLength {
+		result = string(runes[:maxMessageLength]) + "\n…"
+	}
+	return result
+}
+
+// formatBytes formats a byte count with a binary unit
+func formatBytes(bytes uint64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	div, exp := uint64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+// ListImages retrieves images present on a server on behalf of a user, newest first
+func (s *ContainerService) ListImages(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails) ([]protocol.ImageInfo, error) {
+	ctx = WithActor(ctx, userID, telegramID)
+
+	list, err := s.docker.ListImages(ctx, server.ServerKey)
+	if err != nil {
+		s.logger.Error("Failed to list images", "error", err, "server_key", server.ServerKey)
+		return nil, err
+	}
+
+	images := list.Images
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].CreatedAt.After(images[j].CreatedAt)
+	})
+	return images, nil
+}
+
+// PullImage pulls the latest version of an image on behalf of a user. Only server
+// admins may pull images.
+func (s *ContainerService) PullImage(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails, image string) (*protocol.ImagePullResponse, error) {
+	if err := Authorize(server, PermImages); err != nil {
+		return nil, err
+	}
+
+	ctx = WithActor(ctx, userID, telegramID)
+
+	pulled, err := s.docker.PullImage(ctx, server.ServerKey, image)
+	if err != nil {
+		s.logger.Error("Failed to pull image", "error", err, "server_key", server.ServerKey, "image", image)
+		return nil, err
+	}
+
+	s.logger.Info("Image pulled", "server_key", server.ServerKey, "image", image, "status", pulled.Status)
+	return pulled, nil
+}
+
+// PruneImages removes dangling images on behalf of a user. Only server admins may prune.
+func (s *ContainerService) PruneImages(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails) (*protocol.ImagesPrunedResponse, error) {
+	if err := Authorize(server, PermImages); err != nil {
+		return nil, err
+	}
+
+	ctx = WithActor(ctx, userID, telegramID)
+
+	pruned, err := s.docker.PruneImages(ctx, server.ServerKey, true)
+	if err != nil {
+		s.logger.Error("Failed to prune images", "error", err, "server_key", server.ServerKey)
+		return nil, err
+	}
+
+	s.logger.Info("Images pruned", "server_key", server.ServerKey, "deleted", len(pruned.Deleted), "space_reclaimed", pruned.SpaceReclaimed)
+	return pruned, nil
+}
+
+// FormatImages formats images with their size and age for display
+func (s *ContainerService) FormatImages(server *models.ServerWithDetails, images []protocol.ImageInfo) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("🗂 Образы на %s(%s):\n\n", server.Name, server.ID))
+
+	if len(images) == 0 {
+		sb.WriteString("Образов нет.")
+		return sb.String()
+	}
+
+	var total uint64
+	dangling := 0
+	for _, img := range images {
+		total += img.Size
+		if IsDanglingImage(img) {
+			dangling++
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("🐳 %s\n", ImageReference(img)))
+		sb.WriteString(fmt.Sprintf("- %s, %s, создан %s назад\n", ShortImageID(img.ID), formatBytes(img.Size), formatAge(time.Since(img.CreatedAt))))
+	}
+
+	if dangling > 0 {
+		sb.WriteString(fmt.Sprintf("\n🧹 Неиспользуемых образов: %d\n", dangling))
+	}
+	sb.WriteString(fmt.Sprintf("\nВсего: %d образов, %s", len(images), formatBytes(total)))
+
+	result := sb.String()
+	if runes := []rune(result); len(runes) > maxMessageLength {
+		result = string(runes[:maxMessageLength]) + "\n…"
+	}
+	return result
+}
+
+// FormatPull formats the result of an image pull for display
+func (s *ContainerService) FormatPull(server *models.ServerWithDetails, pulled *protocol.ImagePullResponse) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("✅ Образ %s обновлен на %s(%s)\n", pulled.Image, server.Name, server.ID))
+	if pulled.Status != "" {
+		sb.WriteString(fmt.Sprintf("- Статус: %s\n", pulled.Status))
+	}
+	if pulled.Digest != "" {
+		sb.WriteString(fmt.Sprintf("- Digest: %s\n", pulled.Digest))
+	}
+
+	if len(pulled.Progress) > 0 {
+		// Summarize layers by their final status, e.g. "Pull complete: 5"
+		counts := make(map[string]int)
+		var statuses []string
+		for _, p := range pulled.Progress {
+			if counts[p.Status] == 0 {
+				statuses = append(statuses, p.Status)
+			}
+			counts[p.Status]++
+		}
+		sb.WriteString(fmt.Sprintf("- Слоев: %d\n", len(pulled.Progress)))
+		for _, status := range statuses {
+			sb.WriteString(fmt.Sprintf("  • %s: %d\n", status, counts[status]))
+		}
+	}
+
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// FormatPrune formats the result of an image prune for display
+func (s *ContainerService) FormatPrune(server *models.ServerWithDetails, pruned *protocol.ImagesPrunedResponse) string {
+	if len(pruned.Deleted) == 0 {
+		return fmt.Sprintf("🧹 На %s(%s) нет неиспользуемых образов.", server.Name, server.ID)
+	}
+	return fmt.Sprintf("🧹 Удалено образов на %s(%s): %d, освобождено %s", server.Name, server.ID, len(pruned.Deleted), formatBytes(pruned.SpaceReclaimed))
+}
+
+// IsDanglingImage reports whether an image has no repository or tag
+func IsDanglingImage(img protocol.ImageInfo) bool {
+	return img.Repository == "" || img.Repository == "<none>"
+}
+
+// ImageReference returns the repository:tag reference of an image
+func ImageReference(img protocol.ImageInfo) string {
+	if img.Tag == "" || img.Tag == "<none>" {
+		return img.Repository
+	}
+	return img.Repository + ":" + img.Tag
+}
+
+// ShortImageID returns the 12 character form of an image ID, as shown by docker images
+func ShortImageID(id string) string {
+	id = strings.TrimPrefix(id, "sha256:")
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// formatAge formats a duration as a coarse human readable age
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Hour:
+		return fmt.Sprintf("%d мин", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%d ч", int(d.Hours()))
+	case d < 30*24*time.Hour:
+		return fmt.Sprintf("%d дн", int(d.Hours()/24))
+	default:
+		return fmt.Sprintf("%d мес", int(d.Hours()/24/30))
+	}
+}
+
+// ListComposeProjects retrieves compose projects on a server on behalf of a user
+func (s *ContainerService) ListComposeProjects(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails) ([]protocol.ComposeProject, error) {
+	ctx = WithActor(ctx, userID, telegramID)
+
+	list, err := s.docker.ListComposeProjects(ctx, server.ServerKey)
+	if err != nil {
+		s.logger.Error("Failed to list compose projects", "error", err, "server_key", server.ServerKey)
+		return nil, err
+	}
+
+	projects := list.Projects
+	sort.Slice(projects, func(i, j int) bool {
+		return projects[i].Name < projects[j].Name
+	})
+	return projects, nil
+}
+
+// RunComposeAction brings a compose project up, down or restarts it on behalf of a user.
+// Only server admins may run compose actions.
+func (s *ContainerService) RunComposeAction(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails, project string, action protocol.ComposeAction) (*protocol.ComposeActionResponse, error) {
+	if err := Authorize(server, PermCompose); err != nil {
+		return nil, err
+	}
+
+	ctx = WithActor(ctx, userID, telegramID)
+
+	result, err := s.docker.RunComposeAction(ctx, server.ServerKey, project, action)
+	if err != nil {
+		s.logger.Error("Failed to run compose action", "error", err, "server_key", server.ServerKey, "project", project, "action", action)
+		return nil, err
+	}
+
+	s.logger.Info("Compose action completed", "server_key", server.ServerKey, "project", project, "action", action)
+	return result, nil
+}
+
+// CancelOperation cancels a long-running operation, such as an image pull or a compose
+// action, that the user started. The agent is asked to stop the command as well.
+func (s *ContainerService) CancelOperation(ctx context.Context, userID, telegramID int64, id string) (docker.Operation, *protocol.CommandCancelledResponse, error) {
+	op, ok := s.docker.Operation(id)
+	if !ok {
+		return docker.Operation{}, nil, errors.NewNotFoundError("operation")
+	}
+	if op.Owner != telegramID {
+		return op, nil, errors.NewForbiddenError("operation was started by another user")
+	}
+
+	cancelled, err := s.docker.Cancel(WithActor(ctx, userID, telegramID), id)
+	if err != nil {
+		s.logger.Warn("Agent did not confirm cancellation", "error", err, "server_key", op.ServerKey, "type", op.Type)
+		return op, nil, err
+	}
+
+	s.logger.Info("Operation cancelled", "server_key", op.ServerKey, "type", op.Type, "stopped", cancelled.Stopped)
+	return op, cancelled, nil
+}
+
+// CancelRequests cancels the agent commands a user's requests in a chat still wait for
+func (s *ContainerService) CancelRequests(ctx context.Context, userID, telegramID, chatID int64) []docker.Operation {
+	cancelled := s.docker.CancelRequests(WithActor(ctx, userID, telegramID), chatID, telegramID)
+	for _, op := range cancelled {
+		s.logger.Info("Request cancelled", "server_key", op.ServerKey, "type", op.Type, "chat_id", chatID, "telegram_id", telegramID)
+	}
+	return cancelled
+}
+
+// PendingCommands returns the commands sent to the agent of a server that it has not
+// answered yet, oldest first
+func (s *ContainerService) PendingCommands(server *models.ServerWithDetails) []docker.Operation {
+	return s.docker.Pending(server.ServerKey)
+}
+
+// PurgeCommands stops waiting for the commands of a server pending for at least olderThan.
+// Only owners may purge, since the commands may have been sent by other users.
+func (s *ContainerService) PurgeCommands(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails, olderThan time.Duration) ([]docker.Operation, error) {
+	if err := Authorize(server, PermPurgeCommands); err != nil {
+		return nil, err
+	}
+
+	purged := s.docker.Purge(WithActor(ctx, userID, telegramID), server.ServerKey, olderThan, time.Now())
+	s.logger.Info("Pending commands purged", "server_key", server.ServerKey, "telegram_id", telegramID, "count", len(purged), "older_than", olderThan)
+	return purged, nil
+}
+
+// FormatPendingCommands formats the commands waiting for the agent of a server with their age
+func FormatPendingCommands(server *models.ServerWithDetails, pending []docker.Operation, now time.Time) string {
+	if len(pending) == 0 {
+		return fmt.Sprintf("✅ Бот не ждет ответа агента %s(%s): команд в очереди нет.", server.Name, server.ID)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("⏳ Команды, ожидающие ответа агента %s(%s): %d\n\n", server.Name, server.ID, len(pending)))
+	writeOperations(&sb, pending, now)
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// FormatPurgedCommands formats the commands the bot stopped waiting for
+func FormatPurgedCommands(server *models.ServerWithDetails, purged []docker.Operation, olderThan time.Duration, now time.Time) string {
+	if len(purged) == 0 {
+		return fmt.Sprintf("✅ На %s(%s) нет команд, ожидающих дольше %s.", server.Name, server.ID, olderThan)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("🧹 Бот перестал ждать ответа агента %s(%s) на команды: %d. Агента попросили остановить их.\n\n", server.Name, server.ID, len(purged)))
+	writeOperations(&sb, purged, now)
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// writeOperations writes commands in flight with their age, one per line
+func writeOperations(sb *strings.Builder, ops []docker.Operation, now time.Time) {
+	for i, op := range ops {
+		if i == maxPendingCommandsShown {
+			sb.WriteString(fmt.Sprintf("… и еще %d\n", len(ops)-i))
+			break
+		}
+		sb.WriteString(fmt.Sprintf("%d. %s — %s", i+1, op.Type, now.Sub(op.Started).Round(time.Second)))
+		if op.Label != "" {
+			sb.WriteString(" (" + op.Label + ")")
+		}
+		sb.WriteString("\n")
+	}
+}
+
+// FormatComposeProjects formats compose projects with the status of their services for display
+func (s *ContainerService) FormatComposeProjects(server *models.ServerWithDetails, projects []protocol.ComposeProject) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("📦 Compose-проекты на %s(%s):\n\n", server.Name, server.ID))
+
+	if len(projects) == 0 {
+		sb.WriteString("Compose-проекты не найдены.")
+		return sb.String()
+	}
+
+	for _, project := range projects {
+		writeComposeProject(&sb, project)
+		sb.WriteString("\n")
+	}
+
+	result := strings.TrimRight(sb.String(), "\n")
+	if runes := []rune(result); len(runes) > maxMessageLength {
+		result = string(runes[:maxMessageLength]) + "\n…"
+	}
+	return result
+}
+
+// FormatComposeResult formats the result of a compose project operation for display
+func (s *ContainerService) FormatComposeResult(server *models.ServerWithDetails, result *protocol.ComposeActionResponse) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("✅ docker compose %s выполнен для %s на %s(%s)\n\n", result.Action, result.Project, server.Name, server.ID))
+
+	if result.State.Name != "" {
+		writeComposeProject(&sb, result.State)
+	}
+
+	if len(result.Output) > 0 {
+		sb.WriteString("\n")
+		sb.WriteString(strings.Join(result.Output, "\n"))
+	}
+
+	text := strings.TrimRight(sb.String(), "\n")
+	if runes := []rune(text); len(runes) > maxMessageLength {
+		text = string(runes[:maxMessageLength]) + "\n…"
+	}
+	return text
+}
+
+// writeComposeProject writes a compose project with its services
+func writeComposeProject(sb *strings.Builder, project protocol.ComposeProject) {
+	sb.WriteString(fmt.Sprintf("📦 %s — %s\n", project.Name, project.Status))
+	for _, svc := range project.Services {
+		state := svc.State
+		if svc.Health != "" {
+			state += ", " + svc.Health
+		}
+		sb.WriteString(fmt.Sprintf("- %s %s: %s\n", composeStateIcon(svc), svc.Name, state))
+	}
+}
+
+// composeStateIcon returns an icon reflecting the state of a compose service
+func composeStateIcon(svc protocol.ComposeService) string {
+	switch {
+	case svc.Health == "unhealthy":
+		return "🟠"
+	case svc.State == "running":
+		return "🟢"
+	default:
+		return "🔴"
+	}
+}
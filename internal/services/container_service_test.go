@@ -0,0 +1,58 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/pkg/errors"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+func TestAgentCommandsRequireAdmin(t *testing.T) {
+	// The role checks run before the agent is asked, so no docker client is needed
+	containers := services.NewContainerService(nil, nopLogger{})
+	files := services.NewFileService(nil, 1024, 10, nopLogger{})
+
+	commands := map[string]func(ctx context.Context, server *models.ServerWithDetails) error{
+		"logs": func(ctx context.Context, server *models.ServerWithDetails) error {
+			_, err := containers.GetLogs(ctx, 7, 1001, server, "nginx", 50)
+			return err
+		},
+		"pull": func(ctx context.Context, server *models.ServerWithDetails) error {
+			_, err := containers.PullImage(ctx, 7, 1001, server, "nginx:latest")
+			return err
+		},
+		"prune": func(ctx context.Context, server *models.ServerWithDetails) error {
+			_, err := containers.PruneImages(ctx, 7, 1001, server)
+			return err
+		},
+		"compose": func(ctx context.Context, server *models.ServerWithDetails) error {
+			_, err := containers.RunComposeAction(ctx, 7, 1001, server, "web", protocol.ComposeRestart)
+			return err
+		},
+		"ls": func(ctx context.Context, server *models.ServerWithDetails) error {
+			_, err := files.ListDir(ctx, 7, 1001, server, "/etc")
+			return err
+		},
+		"cat": func(ctx context.Context, server *models.ServerWithDetails) error {
+			_, err := files.ReadFile(ctx, 7, 1001, server, "/etc/passwd", false)
+			return err
+		},
+		"du": func(ctx context.Context, server *models.ServerWithDetails) error {
+			_, err := files.DiskUsage(ctx, 7, 1001, server, "/home")
+			return err
+		},
+	}
+
+	for name, run := range commands {
+		for _, role := range []string{services.RoleGuest, services.RoleViewer, ""} {
+			server := &models.ServerWithDetails{Role: role}
+			err := run(context.Background(), server)
+			if !errors.IsErrorCode(err, errors.ErrCodeForbidden) {
+				t.Errorf("%s as %q: error = %v, want forbidden", name, role, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/mapping"
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/repository"
+	"github.com/servereye/servereyebot/pkg/docker"
+	"github.com/servereye/servereyebot/pkg/errors"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// customCommandName restricts custom command names to what Telegram accepts as a bot command
+var customCommandName = regexp.MustCompile(`^[a-z][a-z0-9_]{1,31}$`)
+
+// CustomCommandTarget is a custom command resolved on one of the user's servers
+type CustomCommandTarget struct {
+	Command models.CustomCommand
+	Server  *models.ServerWithDetails
+}
+
+// CustomCommandService manages named commands running agent scripts on servers
+type CustomCommandService struct {
+	repo       repository.CommandStore
+	docker     *docker.Client
+	audit      *AuditService
+	scriptDirs []string
+	logger     Logger
+
+	mu       sync.RWMutex
+	commands map[string][]models.CustomCommand // name -> definitions on different servers
+}
+
+// NewCustomCommandService creates a new custom command service.
+// Scripts may only be run from scriptDirs.
+func NewCustomCommandService(repo repository.CommandStore, dockerClient *docker.Client, audit *AuditService, scriptDirs []string, logger Logger) *CustomCommandService {
+	var dirs []string
+	for _, dir := range scriptDirs {
+		if dir = strings.TrimSpace(dir); dir != "" {
+			dirs = append(dirs, path.Clean(dir))
+		}
+	}
+
+	return &CustomCommandService{
+		repo:       repo,
+		docker:     dockerClient,
+		audit:      audit,
+		scriptDirs: dirs,
+		logger:     logger,
+		commands:   make(map[string][]models.CustomCommand),
+	}
+}
+
+// Load loads all custom commands from the database
+func (s *CustomCommandService) Load(ctx context.Context) error {
+	commands, err := s.repo.ListCustomCommands(ctx)
+	if err != nil {
+		return err
+	}
+
+	index := make(map[string][]models.CustomCommand)
+	for _, command := range commands {
+		index[command.Name] = append(index[command.Name], command)
+	}
+
+	s.mu.Lock()
+	s.commands = index
+	s.mu.Unlock()
+
+	s.logger.Info("Custom commands loaded", "commands", len(commands), "names", len(index))
+	return nil
+}
+
+// Names returns the names of all defined custom commands
+func (s *CustomCommandService) Names() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make([]string, 0, len(s.commands))
+	for name := range s.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Defined reports whether a custom command with the name exists on any server
+func (s *CustomCommandService) Defined(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.commands[name]) > 0
+}
+
+// ScriptDirs returns the directories scripts may be run from
+func (s *CustomCommandService) ScriptDirs() []string {
+	return s.scriptDirs
+}
+
+// Define creates or replaces a custom command on a server on behalf of a user
+func (s *CustomCommandService) Define(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails, name, script, requiredRole string) (*models.CustomCommand, error) {
+	if err := Authorize(server, PermCustomCommands); err != nil {
+		return nil, err
+	}
+	started := time.Now()
+
+	name = strings.ToLower(strings.TrimPrefix(name, "/"))
+	if !customCommandName.MatchString(name) {
+		return nil, errors.NewValidationError("invalid command name", map[string]interface{}{"name": name})
+	}
+	if !IsValidRole(requiredRole) {
+		return nil, errors.NewValidationError("unknown role", map[string]interface{}{"role": requiredRole})
+	}
+	if !s.scriptAllowed(script) {
+		return nil, errors.NewForbiddenError("script is outside the allowed directories")
+	}
+
+	command := &models.CustomCommand{
+		ServerID:     server.ID,
+		Name:         name,
+		Script:       script,
+		RequiredRole: requiredRole,
+		CreatedBy:    userID,
+	}
+
+	err := s.repo.UpsertCustomCommand(ctx, command)
+	s.audit.RecordResult(ctx, userID, telegramID, server.ID, AuditCommandDefine,
+		fmt.Sprintf("name=%s script=%s role=%s", name, script, requiredRole), "", started, err)
+	if err != nil {
+		s.logger.Error("Failed to save custom command", "error", err, "server_id", server.ID, "name", name)
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defs := s.commands[name]
+	replaced := false
+	for i := range defs {
+		if defs[i].ServerID == server.ID {
+			defs[i] = *command
+			replaced = true
+		}
+	}
+	if !replaced {
+		defs = append(defs, *command)
+	}
+	s.commands[name] = defs
+	s.mu.Unlock()
+
+	return command, nil
+}
+
+// Remove deletes a custom command of a server on behalf of a user, reporting whether it existed
+func (s *CustomCommandService) Remove(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails, name string) (bool, error) {
+	if err := Authorize(server, PermCustomCommands); err != nil {
+		return false, err
+	}
+	started := time.Now()
+	name = strings.ToLower(strings.TrimPrefix(name, "/"))
+
+	removed, err := s.repo.DeleteCustomCommand(ctx, server.ID, name)
+	s.audit.RecordResult(ctx, userID, telegramID, server.ID, AuditCommandUndefine, "name="+name, "", started, err)
+	if err != nil {
+		s.logger.Error("Failed to delete custom command", "error", err, "server_id", server.ID, "name", name)
+		return false, err
+	}
+
+	s.mu.Lock()
+	defs := s.commands[name][:0]
+	for _, def := range s.commands[name] {
+		if def.ServerID != server.ID {
+			defs = append(defs, def)
+		}
+	}
+	if len(defs) == 0 {
+		delete(s.commands, name)
+	} else {
+		s.commands[name] = defs
+	}
+	s.mu.Unlock()
+
+	return removed, nil
+}
+
+// ForServers returns the custom commands defined on the given servers
+func (s *CustomCommandService) ForServers(servers []models.ServerWithDetails) []CustomCommandTarget {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var targets []CustomCommandTarget
+	for i := range servers {
+		for _, defs := range s.commands {
+			for _, def := range defs {
+				if def.ServerID == servers[i].ID {
+					targets = append(targets, CustomCommandTarget{Command: def, Server: &servers[i]})
+				}
+			}
+		}
+	}
+
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].Command.Name != targets[j].Command.Name {
+			return targets[i].Command.Name < targets[j].Command.Name
+		}
+		return targets[i].Server.ID < targets[j].Server.ID
+	})
+	return targets
+}
+
+// Resolve returns the definitions of a custom command on the given servers
+func (s *CustomCommandService) Resolve(name string, servers []models.ServerWithDetails) []CustomCommandTarget {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var targets []CustomCommandTarget
+	for _, def := range s.commands[name] {
+		if server := mapping.ServerByID(servers, def.ServerID); server != nil {
+			targets = append(targets, CustomCommandTarget{Command: def, Server: server})
+		}
+	}
+	return targets
+}
+
+// Run runs the script of a custom command on behalf of a user
+func (s *CustomCommandService) Run(ctx context.Context, userID, telegramID int64, target CustomCommandTarget, args []string) (*protocol.ExecResultResponse, error) {
+	if err := s.Authorize(target); err != nil {
+		return nil, err
+	}
+	for _, arg := range args {
+		if strings.ContainsAny(arg, shellMetacharacters) {
+			return nil, errors.NewValidationError("argument contains shell metacharacters", map[string]interface{}{"arg": arg})
+		}
+	}
+
+	// The directory allow-list may have shrunk since the command was defined
+	if !s.scriptAllowed(target.Command.Script) {
+		return nil, errors.NewForbiddenError("script is outside the allowed directories")
+	}
+
+	ctx = WithActor(ctx, userID, telegramID)
+
+	result, err := s.docker.RunScript(ctx, target.Server.ServerKey, target.Command.Script, args)
+	if err != nil {
+		s.logger.Error("Failed to run custom command", "error", err, "server_key", target.Server.ServerKey, "name", target.Command.Name)
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Authorize returns a forbidden error unless the user's role on the server of a command
+// is the role the command requires or higher
+func (s *CustomCommandService) Authorize(target CustomCommandTarget) error {
+	return requireRole(target.Server, target.Command.RequiredRole)
+}
+
+// FormatResult formats script output as messages, each below the Telegram message limit
+func (s *CustomCommandService) FormatResult(target CustomCommandTarget, result *protocol.ExecResultResponse) []string {
+	return formatExecResult(target.Server, "/"+target.Command.Name, result)
+}
+
+// FormatList formats custom commands available on the user's servers
+func (s *CustomCommandService) FormatList(targets []CustomCommandTarget) string {
+	if len(targets) == 0 {
+		return "🧩 Пользовательских команд нет.\n\nДобавьте команду: /command add <server_id> <name> <script> [role]"
+	}
+
+	var sb strings.Builder
+	sb.WriteString("🧩 Пользовательские команды:\n\n")
+	for _, target := range targets {
+		sb.WriteString(fmt.Sprintf("/%s на %s(%s)\n", target.Command.Name, target.Server.Name, target.Server.ID))
+		sb.WriteString(fmt.Sprintf("   %s, роль: %s\n", target.Command.Script, target.Command.RequiredRole))
+	}
+	return sb.String()
+}
+
+// scriptAllowed reports whether a script path lies inside one of the allowed directories
+func (s *CustomCommandService) scriptAllowed(script string) bool {
+	if !path.IsAbs(script) || path.Clean(script) != script || strings.ContainsAny(script, shellMetacharacters) {
+		return false
+	}
+
+	for _, dir := range s.scriptDirs {
+		if strings.HasPrefix(script, strings.TrimSuffix(dir, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/servereye/servereyebot/internal/services"
+)
+
+func TestHasRole(t *testing.T) {
+	tests := []struct {
+		role     string
+		required string
+		want     bool
+	}{
+		{role: services.RoleOwner, required: services.RoleOwner, want: true},
+		{role: services.RoleOwner, required: services.RoleAdmin, want: true},
+		{role: services.RoleAdmin, required: services.RoleOwner, want: false},
+		{role: services.RoleViewer, required: services.RoleAdmin, want: false},
+		{role: services.RoleGuest, required: services.RoleViewer, want: true},
+		{role: services.RoleGuest, required: services.RoleAdmin, want: false},
+		{role: services.RoleViewer, required: services.RoleGuest, want: true},
+		{role: "", required: services.RoleViewer, want: false},
+		{role: services.RoleOwner, required: "root", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := services.HasRole(tt.role, tt.required); got != tt.want {
+			t.Errorf("HasRole(%q, %q) = %v, want %v", tt.role, tt.required, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Dependencies of the bot checked by DependencyService
+const (
+	DependencyDatabase = "database"
+	DependencyMetrics  = "metrics"
+	DependencyRedis    = "redis"
+)
+
+// maxDependencyEvents bounds the state changes of dependencies kept for /dashboard
+const maxDependencyEvents = 20
+
+// dependencyOutages describe unavailable dependencies in messages to users
+var dependencyOutages = map[string]string{
+	DependencyDatabase: "База данных бота недоступна",
+	DependencyMetrics:  "Сервис метрик недоступен",
+	DependencyRedis:    "Redis недоступен",
+}
+
+// DependencyCheck checks whether a dependency is available
+type DependencyCheck func(ctx context.Context) error
+
+// DependencyStatus is the last known state of a dependency
+type DependencyStatus struct {
+	Name      string
+	Up        bool
+	Since     time.Time // when the dependency entered its current state
+	CheckedAt time.Time
+	Err       error // last check error while down
+}
+
+// DependencyEvent is a state change of a dependency, or a change noted while its
+// state stayed the same, such as a failover to another address
+type DependencyEvent struct {
+	Name   string
+	Up     bool
+	At     time.Time
+	Err    error  // check error when the dependency went down
+	Detail string // what changed, for noted events
+}
+
+// dependency is a registered dependency with its cached status
+type dependency struct {
+	check  DependencyCheck
+	status DependencyStatus
+}
+
+// DependencyService caches the health of the bot's dependencies, refreshed by periodic
+// checks, so that handlers can tell users which dependency failed and since when
+// instead of a generic error.
+type DependencyService struct {
+	timeout time.Duration
+	logger  Logger
+
+	mu     sync.RWMutex
+	deps   map[string]*dependency
+	names  []string
+	events []DependencyEvent // latest state changes, oldest first
+}
+
+// NewDependencyService creates a dependency service. Each check may take up to timeout.
+func NewDependencyService(timeout time.Duration, logger Logger) *DependencyService {
+	return &DependencyService{
+		timeout: timeout,
+		logger:  logger,
+		deps:    make(map[string]*dependency),
+	}
+}
+
+// Register adds a dependency. It counts as available until its first failed check.
+func (s *DependencyService) Register(name string, check DependencyCheck) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.deps[name]; !exists {
+		s.names = append(s.names, name)
+	}
+	s.deps[name] = &dependency{
+		check:  check,
+		status: DependencyStatus{Name: name, Up: true, Since: time.Now()},
+	}
+}
+
+// Check runs the checks of all dependencies and records state changes
+func (s *DependencyService) Check(ctx context.Context) {
+	s.mu.RLock()
+	names := append([]string(nil), s.names...)
+	s.mu.RUnlock()
+
+	for _, name := range names {
+		s.mu.RLock()
+		check := s.deps[name].check
+		s.mu.RUnlock()
+
+		checkCtx, cancel := context.WithTimeout(ctx, s.timeout)
+		err := check(checkCtx)
+		cancel()
+
+		s.record(name, err, time.Now())
+	}
+}
+
+// MarkDown records a dependency as unavailable after a failure detected outside the
+// periodic checks, such as a failed connection at startup
+func (s *DependencyService) MarkDown(name string, err error) {
+	s.mu.RLock()
+	_, ok := s.deps[name]
+	s.mu.RUnlock()
+	if ok {
+		s.record(name, err, time.Now())
+	}
+}
+
+// Note records a change of a dependency that kept its state, so that it shows among
+// the latest events
+func (s *DependencyService) Note(name, detail string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dep, ok := s.deps[name]
+	if !ok {
+		return
+	}
+	s.addEvent(DependencyEvent{Name: name, Up: dep.status.Up, At: time.Now(), Detail: detail})
+	s.logger.Info("Dependency changed", "dependency", name, "change", detail)
+}
+
+// record stores the result of a check
+func (s *DependencyService) record(name string, err error, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := &s.deps[name].status
+	up := err == nil
+	if up != status.Up {
+		status.Since = now
+		s.addEvent(DependencyEvent{Name: name, Up: up, At: now, Err: err})
+		if up {
+			s.logger.Info("Dependency recovered", "dependency", name)
+		} else {
+			s.logger.Error("Dependency unavailable", "dependency", name, "error", err)
+		}
+	}
+	status.Up = up
+	status.Err = err
+	status.CheckedAt = now
+}
+
+// addEvent appends an event, dropping the oldest ones over the limit. The caller holds s.mu.
+func (s *DependencyService) addEvent(event DependencyEvent) {
+	s.events = append(s.events, event)
+	if len(s.events) > maxDependencyEvents {
+		s.events = s.events[len(s.events)-maxDependencyEvents:]
+	}
+}
+
+// Status returns the cached status of a dependency
+func (s *DependencyService) Status(name string) (DependencyStatus, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	dep, ok := s.deps[name]
+	if !ok {
+		return DependencyStatus{}, false
+	}
+	return dep.status, true
+}
+
+// Statuses returns the cached statuses of all dependencies in registration order
+func (s *DependencyService) Statuses() []DependencyStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	statuses := make([]DependencyStatus, 0, len(s.names))
+	for _, name := range s.names {
+		statuses = append(statuses, s.deps[name].status)
+	}
+	return statuses
+}
+
+// Events returns the latest state changes of the dependencies, newest first
+func (s *DependencyService) Events() []DependencyEvent {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := make([]DependencyEvent, len(s.events))
+	for i, event := range s.events {
+		events[len(s.events)-1-i] = event
+	}
+	return events
+}
+
+// Unavailable returns a message for users when any of the given dependencies is down.
+// Times are shown in loc. The second result is false while all of them are available.
+func (s *DependencyService) Unavailable(loc *time.Location, names ...string) (string, bool) {
+	for _, name := range names {
+		status, ok := s.Status(name)
+		if !ok || status.Up {
+			continue
+		}
+		return FormatDependencyOutage(status, loc), true
+	}
+	return "", false
+}
+
+// FormatDependencyOutage formats an outage of a dependency for users
+func FormatDependencyOutage(status DependencyStatus, loc *time.Location) string {
+	outage, ok := dependencyOutages[status.Name]
+	if !ok {
+		outage = status.Name + " недоступен"
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+
+	since := status.Since.In(loc)
+	when := since.Format("15:04")
+	if !sameDay(since, time.Now().In(loc)) {
+		when = since.Format("02.01 15:04")
+	}
+
+	return fmt.Sprintf("⚠️ %s с %s, мы уже работаем над этим. Попробуйте позже.", outage, when)
+}
+
+// FormatDependencies formats the health of the dependencies and their latest state
+// changes for admins
+func FormatDependencies(statuses []DependencyStatus, events []DependencyEvent, now time.Time) string {
+	var sb strings.Builder
+	sb.WriteString("🔌 Зависимости:\n")
+	for _, status := range statuses {
+		icon, state := "✅", "доступен"
+		if !status.Up {
+			icon, state = "❌", "недоступен"
+		}
+		sb.WriteString(fmt.Sprintf("%s %s: %s %s", icon, status.Name, state, now.Sub(status.Since).Round(time.Second)))
+		if !status.Up && status.Err != nil {
+			sb.WriteString(" (" + truncateOutput(status.Err.Error(), 100) + ")")
+		}
+		sb.WriteString("\n")
+	}
+
+	if len(events) > 0 {
+		sb.WriteString("\nПоследние события:\n")
+		for _, event := range events {
+			state := "восстановился"
+			if event.Detail != "" {
+				state = event.Detail
+			} else if !event.Up {
+				state = "стал недоступен"
+			}
+			sb.WriteString(fmt.Sprintf("- %s UTC: %s %s\n", event.At.UTC().Format("02.01 15:04:05"), event.Name, state))
+		}
+	}
+
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// sameDay reports whether two times fall on the same calendar day
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
@@ -0,0 +1,477 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/repository"
+	"github.com/servereye/servereyebot/internal/scheduler"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+const (
+	// maxDeploymentWindows bounds the deployment windows of a server
+	maxDeploymentWindows = 14
+
+	// maxHeldAlertsPerSummary bounds the alerts listed in a post-window summary
+	maxHeldAlertsPerSummary = 20
+
+	// maxMaintenance bounds the duration of a maintenance window
+	maxMaintenance = 7 * 24 * time.Hour
+)
+
+// deploymentWindow is a stored deployment window with its parsed schedule
+type deploymentWindow struct {
+	models.DeploymentWindow
+	window scheduler.Window
+	loc    *time.Location
+}
+
+// heldAlert is an alert held back during a deployment window
+type heldAlert struct {
+	notification AlertNotification
+	heldAt       time.Time
+}
+
+// DeploymentWindowService knows the recurring windows of planned work on servers and
+// their one-off maintenance windows. Alerts of servers in a window are held instead of
+// paging users, and sent as one summary per user once the window is over. Held alerts
+// are kept in memory and lost on restart.
+type DeploymentWindowService struct {
+	repo   repository.DeploymentWindowStore
+	logger Logger
+
+	mu          sync.Mutex
+	windows     map[string][]deploymentWindow         // server ID -> windows
+	maintenance map[string][]models.MaintenanceWindow // server ID -> maintenance windows
+	held        map[int64][]heldAlert                 // Telegram ID -> alerts held during windows
+}
+
+// NewDeploymentWindowService creates a new deployment window service
+func NewDeploymentWindowService(repo repository.DeploymentWindowStore, logger Logger) *DeploymentWindowService {
+	return &DeploymentWindowService{
+		repo:        repo,
+		logger:      logger,
+		windows:     make(map[string][]deploymentWindow),
+		maintenance: make(map[string][]models.MaintenanceWindow),
+		held:        make(map[int64][]heldAlert),
+	}
+}
+
+// Load loads the deployment and maintenance windows of all servers from the database
+func (s *DeploymentWindowService) Load(ctx context.Context) error {
+	stored, err := s.repo.ListDeploymentWindows(ctx)
+	if err != nil {
+		return err
+	}
+	storedMaintenance, err := s.repo.ListMaintenanceWindows(ctx)
+	if err != nil {
+		return err
+	}
+
+	windows := make(map[string][]deploymentWindow)
+	for _, w := range stored {
+		windows[w.ServerID] = append(windows[w.ServerID], s.parse(w))
+	}
+	maintenance := make(map[string][]models.MaintenanceWindow)
+	for _, m := range storedMaintenance {
+		maintenance[m.ServerID] = append(maintenance[m.ServerID], m)
+	}
+
+	s.mu.Lock()
+	s.windows = windows
+	s.maintenance = maintenance
+	s.mu.Unlock()
+
+	s.logger.Info("Deployment windows loaded", "count", len(stored), "maintenance", len(storedMaintenance))
+	return nil
+}
+
+// Add stores a deployment window of a server, its times read in the given timezone
+func (s *DeploymentWindowService) Add(ctx context.Context, server *models.ServerWithDetails, telegramID int64, window *scheduler.Window, timezone string) (*models.DeploymentWindow, error) {
+	if err := Authorize(server, PermWindows); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	count := len(s.windows[server.ID])
+	s.mu.Unlock()
+	if count >= maxDeploymentWindows {
+		return nil, errors.NewValidationError("too many deployment windows", map[string]interface{}{"server_id": server.ID, "max": maxDeploymentWindows})
+	}
+
+	stored := &models.DeploymentWindow{
+		ServerID:    server.ID,
+		Weekday:     int(window.Weekday),
+		StartMinute: window.Start,
+		EndMinute:   window.End,
+		Timezone:    timezone,
+		CreatedBy:   telegramID,
+	}
+	if err := s.repo.AddDeploymentWindow(ctx, stored); err != nil {
+		s.logger.Error("Failed to save deployment window", "error", err, "server_id", server.ID)
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.windows[server.ID] = append(s.windows[server.ID], s.parse(*stored))
+	s.mu.Unlock()
+
+	s.logger.Info("Deployment window added", "server_id", server.ID, "window", window.String(), "timezone", timezone)
+	return stored, nil
+}
+
+// Get returns a deployment window by ID
+func (s *DeploymentWindowService) Get(id int64) (*models.DeploymentWindow, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, windows := range s.windows {
+		for _, w := range windows {
+			if w.ID == id {
+				stored := w.DeploymentWindow
+				return &stored, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Remove removes a deployment window of a server, reporting whether it existed
+func (s *DeploymentWindowService) Remove(ctx context.Context, server *models.ServerWithDetails, id int64) (bool, error) {
+	if err := Authorize(server, PermWindows); err != nil {
+		return false, err
+	}
+	if window, ok := s.Get(id); !ok || window.ServerID != server.ID {
+		return false, nil
+	}
+
+	removed, err := s.repo.DeleteDeploymentWindow(ctx, id)
+	if err != nil {
+		s.logger.Error("Failed to remove deployment window", "error", err, "id", id)
+		return false, err
+	}
+
+	s.mu.Lock()
+	for serverID, windows := range s.windows {
+		for i, w := range windows {
+			if w.ID == id {
+				s.windows[serverID] = append(windows[:i:i], windows[i+1:]...)
+				break
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	return removed, nil
+}
+
+// StartMaintenance puts a server into maintenance from now on for a duration. Alerts of
+// the server are held until the maintenance is over or ended.
+func (s *DeploymentWindowService) StartMaintenance(ctx context.Context, server *models.ServerWithDetails, telegramID int64, duration time.Duration, now time.Time) (*models.MaintenanceWindow, error) {
+	if err := Authorize(server, PermMaintenance); err != nil {
+		return nil, err
+	}
+	if duration < time.Minute || duration > maxMaintenance {
+		return nil, errors.NewValidationError("invalid maintenance duration", map[string]interface{}{"duration": duration.String(), "max": maxMaintenance.String()})
+	}
+
+	stored := &models.MaintenanceWindow{
+		ServerID:  server.ID,
+		StartsAt:  now,
+		EndsAt:    now.Add(duration),
+		CreatedBy: telegramID,
+	}
+	if err := s.repo.AddMaintenanceWindow(ctx, stored); err != nil {
+		s.logger.Error("Failed to save maintenance window", "error", err, "server_id", server.ID)
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.maintenance[server.ID] = append(s.maintenance[server.ID], *stored)
+	s.mu.Unlock()
+
+	s.logger.Info("Maintenance started", "server_id", server.ID, "until", stored.EndsAt)
+	return stored, nil
+}
+
+// EndMaintenance ends the maintenance of a server early, reporting whether it was in maintenance
+func (s *DeploymentWindowService) EndMaintenance(ctx context.Context, server *models.ServerWithDetails, now time.Time) (bool, error) {
+	if err := Authorize(server, PermMaintenance); err != nil {
+		return false, err
+	}
+	serverID := server.ID
+
+	s.mu.Lock()
+	var ending []models.MaintenanceWindow
+	for _, m := range s.maintenance[serverID] {
+		if !now.Before(m.StartsAt) && now.Before(m.EndsAt) {
+			ending = append(ending, m)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, m := range ending {
+		if _, err := s.repo.DeleteMaintenanceWindow(ctx, m.ID); err != nil {
+			s.logger.Error("Failed to end maintenance", "error", err, "server_id", serverID, "id", m.ID)
+			return false, err
+		}
+		s.removeMaintenance(m.ID)
+	}
+
+	if len(ending) > 0 {
+		s.logger.Info("Maintenance ended early", "server_id", serverID)
+	}
+	return len(ending) > 0, nil
+}
+
+// ExpireMaintenance removes the maintenance windows that are over and returns them
+func (s *DeploymentWindowService) ExpireMaintenance(ctx context.Context, now time.Time) []models.MaintenanceWindow {
+	s.mu.Lock()
+	var expired []models.MaintenanceWindow
+	for _, windows := range s.maintenance {
+		for _, m := range windows {
+			if !now.Before(m.EndsAt) {
+				expired = append(expired, m)
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	var removed []models.MaintenanceWindow
+	for _, m := range expired {
+		if _, err := s.repo.DeleteMaintenanceWindow(ctx, m.ID); err != nil {
+			s.logger.Error("Failed to remove expired maintenance window", "error", err, "id", m.ID)
+			continue
+		}
+		s.removeMaintenance(m.ID)
+		removed = append(removed, m)
+	}
+	return removed
+}
+
+// InMaintenance reports whether a server is in maintenance and returns when it ends
+func (s *DeploymentWindowService) InMaintenance(serverID string, now time.Time) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.inMaintenance(serverID, now)
+}
+
+// Active reports whether a server is in a deployment window and returns when it ends
+func (s *DeploymentWindowService) Active(serverID string, now time.Time) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.active(serverID, now)
+}
+
+// Hold holds back the alerts about servers that are all in a deployment window and
+// returns the alerts to deliver now
+func (s *DeploymentWindowService) Hold(notifications []AlertNotification, now time.Time) []AlertNotification {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deliver []AlertNotification
+	for _, notification := range notifications {
+		if !s.allActive(notification.ServerIDs, now) {
+			deliver = append(deliver, notification)
+			continue
+		}
+		s.held[notification.TelegramID] = append(s.held[notification.TelegramID], heldAlert{notification: notification, heldAt: now})
+	}
+
+	if held := len(notifications) - len(deliver); held > 0 {
+		s.logger.Info("Alerts held during deployment windows", "count", held)
+	}
+	return deliver
+}
+
+// DueSummaries returns a summary of the alerts held for each user and servers whose
+// deployment windows are over
+func (s *DeploymentWindowService) DueSummaries(now time.Time) []AlertNotification {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	telegramIDs := make([]int64, 0, len(s.held))
+	for telegramID := range s.held {
+		telegramIDs = append(telegramIDs, telegramID)
+	}
+	sort.Slice(telegramIDs, func(i, j int) bool { return telegramIDs[i] < telegramIDs[j] })
+
+	var summaries []AlertNotification
+	for _, telegramID := range telegramIDs {
+		var keep []heldAlert
+		var keys []string
+		due := make(map[string][]heldAlert) // servers of the alerts -> alerts
+		for _, alert := range s.held[telegramID] {
+			if s.anyActive(alert.notification.ServerIDs, now) {
+				keep = append(keep, alert)
+				continue
+			}
+			key := strings.Join(alert.notification.ServerIDs, ",")
+			if _, ok := due[key]; !ok {
+				keys = append(keys, key)
+			}
+			due[key] = append(due[key], alert)
+		}
+
+		// Servers are summarized separately, so group chats get only alerts of their servers
+		for _, key := range keys {
+			category := due[key][0].notification.Category
+			for _, alert := range due[key] {
+				if alert.notification.Category != category {
+					category = ""
+				}
+			}
+			summaries = append(summaries, AlertNotification{
+				TelegramID: telegramID,
+				ServerIDs:  due[key][0].notification.ServerIDs,
+				Category:   category,
+				Text:       formatHeldAlerts(due[key]),
+			})
+		}
+
+		if len(keep) == 0 {
+			delete(s.held, telegramID)
+		} else {
+			s.held[telegramID] = keep
+		}
+	}
+	return summaries
+}
+
+// FormatWindows formats the deployment windows of servers with their IDs
+func (s *DeploymentWindowService) FormatWindows(servers []models.ServerWithDetails, now time.Time) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var sb strings.Builder
+	for _, server := range servers {
+		windows := s.windows[server.ID]
+		if len(windows) == 0 {
+			continue
+		}
+		if sb.Len() == 0 {
+			sb.WriteString("🛠️ Окна работ:\n\n")
+		}
+
+		sb.WriteString(fmt.Sprintf("🖥️ %s(%s)", server.Name, server.ID))
+		if end, ok := s.active(server.ID, now); ok {
+			sb.WriteString(fmt.Sprintf(" — идут работы, еще %s", end.Sub(now).Round(time.Minute)))
+		}
+		sb.WriteString("\n")
+		for _, w := range windows {
+			sb.WriteString(fmt.Sprintf("#%d %s (%s)\n", w.ID, w.window.String(), w.Timezone))
+		}
+		sb.WriteString("\n")
+	}
+
+	if sb.Len() == 0 {
+		return "🛠️ Окна работ не заданы.\n\nДобавьте окно: /window add <server_id> sat 02:00-04:00"
+	}
+
+	sb.WriteString("Алерты серверов в окне работ придут одной сводкой после его окончания.")
+	return sb.String()
+}
+
+// active returns the end of the deployment or maintenance window a server is in. The
+// caller holds the lock.
+func (s *DeploymentWindowService) active(serverID string, now time.Time) (time.Time, bool) {
+	latest, _ := s.inMaintenance(serverID, now)
+	for _, w := range s.windows[serverID] {
+		if end, ok := w.window.Active(now, w.loc); ok && end.After(latest) {
+			latest = end
+		}
+	}
+	return latest, !latest.IsZero()
+}
+
+// inMaintenance returns the end of the maintenance of a server. The caller holds the lock.
+func (s *DeploymentWindowService) inMaintenance(serverID string, now time.Time) (time.Time, bool) {
+	var latest time.Time
+	for _, m := range s.maintenance[serverID] {
+		if !now.Before(m.StartsAt) && now.Before(m.EndsAt) && m.EndsAt.After(latest) {
+			latest = m.EndsAt
+		}
+	}
+	return latest, !latest.IsZero()
+}
+
+// removeMaintenance forgets a maintenance window
+func (s *DeploymentWindowService) removeMaintenance(id int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for serverID, windows := range s.maintenance {
+		for i, m := range windows {
+			if m.ID == id {
+				s.maintenance[serverID] = append(windows[:i:i], windows[i+1:]...)
+				if len(s.maintenance[serverID]) == 0 {
+					delete(s.maintenance, serverID)
+				}
+				return
+			}
+		}
+	}
+}
+
+// allActive reports whether all servers are in a deployment window. The caller holds the lock.
+func (s *DeploymentWindowService) allActive(serverIDs []string, now time.Time) bool {
+	if len(serverIDs) == 0 {
+		return false
+	}
+	for _, serverID := range serverIDs {
+		if _, ok := s.active(serverID, now); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// anyActive reports whether any of the servers is in a deployment window. The caller holds the lock.
+func (s *DeploymentWindowService) anyActive(serverIDs []string, now time.Time) bool {
+	for _, serverID := range serverIDs {
+		if _, ok := s.active(serverID, now); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// parse parses the schedule of a stored deployment window
+func (s *DeploymentWindowService) parse(stored models.DeploymentWindow) deploymentWindow {
+	loc, err := time.LoadLocation(stored.Timezone)
+	if err != nil {
+		s.logger.Warn("Invalid deployment window timezone, falling back to UTC", "timezone", stored.Timezone, "id", stored.ID)
+		loc = time.UTC
+	}
+
+	return deploymentWindow{
+		DeploymentWindow: stored,
+		window:           scheduler.Window{Weekday: time.Weekday(stored.Weekday), Start: stored.StartMinute, End: stored.EndMinute},
+		loc:              loc,
+	}
+}
+
+// formatHeldAlerts formats the alerts held during a deployment window, one line each
+func formatHeldAlerts(held []heldAlert) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("🛠️ Окно работ завершилось. Алерты за время окна: %d\n\n", len(held)))
+
+	for i, alert := range held {
+		if i == maxHeldAlertsPerSummary {
+			sb.WriteString(fmt.Sprintf("… и еще %d\n", len(held)-i))
+			break
+		}
+		line, _, _ := strings.Cut(alert.notification.Text, "\n")
+		sb.WriteString(fmt.Sprintf("%s UTC %s\n", alert.heldAt.UTC().Format("15:04"), line))
+	}
+
+	return strings.TrimRight(sb.String(), "\n")
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/pkg/docker"
+	"github.com/servereye/servereyebot/pkg/errors"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// shellMetacharacters are rejected in commands even though agents execute them without a shell
+const shellMetacharacters = "|&;<>()$`\\\"'*?[]{}#~\n"
+
+// ExecService runs allow-listed shell commands on user servers
+type ExecService struct {
+	docker    *docker.Client
+	audit     *AuditService
+	allowList [][]string // patterns split into words
+	logger    Logger
+}
+
+// NewExecService creates a new exec service. Every allow-list entry is a command pattern
+// whose words are matched one by one, "*" matches a single argument, e.g. "journalctl -n * --no-pager".
+func NewExecService(dockerClient *docker.Client, audit *AuditService, allowList []string, logger Logger) *ExecService {
+	var patterns [][]string
+	for _, entry := range allowList {
+		if words := strings.Fields(entry); len(words) > 0 {
+			patterns = append(patterns, words)
+		}
+	}
+
+	return &ExecService{
+		docker:    dockerClient,
+		audit:     audit,
+		allowList: patterns,
+		logger:    logger,
+	}
+}
+
+// AllowList returns the allowed command patterns
+func (s *ExecService) AllowList() []string {
+	patterns := make([]string, len(s.allowList))
+	for i, words := range s.allowList {
+		patterns[i] = strings.Join(words, " ")
+	}
+	return patterns
+}
+
+// Allowed reports whether a command split into words matches the allow-list
+func (s *ExecService) Allowed(words []string) bool {
+	for _, word := range words {
+		if strings.ContainsAny(word, shellMetacharacters) {
+			return false
+		}
+	}
+
+	for _, pattern := range s.allowList {
+		if matchCommand(pattern, words) {
+			return true
+		}
+	}
+	return false
+}
+
+// Exec runs a command on behalf of an admin of the server. Commands missing from the allow-list
+// are rejected with a forbidden error and recorded in the audit log without reaching the agent.
+func (s *ExecService) Exec(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails, command string) (*protocol.ExecResultResponse, error) {
+	if err := Authorize(server, PermExec); err != nil {
+		return nil, err
+	}
+
+	words := strings.Fields(command)
+	if len(words) == 0 {
+		return nil, errors.NewRequiredFieldError("command")
+	}
+
+	if !s.Allowed(words) {
+		err := errors.NewForbiddenError("command is not in the allow-list")
+		s.logger.Warn("Rejected shell command", "command", command, "server_key", server.ServerKey, "telegram_id", telegramID)
+		s.audit.RecordResult(ctx, userID, telegramID, server.ServerKey, AuditCommandExecDenied, command, "", time.Now(), err)
+		return nil, err
+	}
+
+	ctx = WithActor(ctx, userID, telegramID)
+
+	result, err := s.docker.ExecCommand(ctx, server.ServerKey, words[0], words[1:])
+	if err != nil {
+		s.logger.Error("Failed to execute shell command", "error", err, "server_key", server.ServerKey, "command", command)
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// FormatResult formats command output as messages, each below the Telegram message limit
+func (s *ExecService) FormatResult(server *models.ServerWithDetails, command string, result *protocol.ExecResultResponse) []string {
+	return formatExecResult(server, command, result)
+}
+
+// matchCommand reports whether command words match a pattern of the same length
+func matchCommand(pattern, words []string) bool {
+	if len(pattern) != len(words) {
+		return false
+	}
+
+	for i, p := range pattern {
+		if p == "*" {
+			continue
+		}
+		if ok, err := path.Match(p, words[i]); err != nil || !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// formatExecResult formats the output of a command or script as messages, each below
+// the Telegram message limit
+func formatExecResult(server *models.ServerWithDetails, title string, result *protocol.ExecResultResponse) []string {
+	status := "✅"
+	if result.ExitCode != 0 {
+		status = "⚠️"
+	}
+	header := fmt.Sprintf("%s %s на %s(%s), код выхода %d\n\n", status, title, server.Name, server.ID, result.ExitCode)
+
+	output := strings.TrimRight(result.Output, "\n")
+	if output == "" {
+		return []string{header + "Вывод пуст."}
+	}
+	if result.Truncated {
+		output += "\n… (вывод обрезан агентом)"
+	}
+
+	return chunkMessage(header, output)
+}
+
+// chunkMessage splits a long body into numbered messages, the first one starting with header
+func chunkMessage(header, body string) []string {
+	chunks := splitMessage(body, maxMessageLength)
+	chunks[0] = header + chunks[0]
+	if len(chunks) > 1 {
+		for i := range chunks {
+			chunks[i] = fmt.Sprintf("[%d/%d]\n%s", i+1, len(chunks), chunks[i])
+		}
+	}
+	return chunks
+}
+
+// splitMessage splits text into chunks of at most limit characters, preferring line breaks
+func splitMessage(text string, limit int) []string {
+	var chunks []string
+
+	runes := []rune(text)
+	for len(runes) > limit {
+		cut := limit
+		for i := limit; i > limit/2; i-- {
+			if runes[i-1] == '\n' {
+				cut = i
+				break
+			}
+		}
+		chunks = append(chunks, strings.TrimRight(string(runes[:cut]), "\n"))
+		runes = runes[cut:]
+	}
+
+	return append(chunks, string(runes))
+}
@@ -0,0 +1,76 @@
+package services_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+func TestExecAllowed(t *testing.T) {
+	svc := services.NewExecService(nil, nil, []string{
+		"uptime",
+		"df -h",
+		"journalctl -n * --no-pager",
+		"systemctl status nginx*",
+		"  ",
+	}, nopLogger{})
+
+	tests := []struct {
+		command string
+		want    bool
+	}{
+		{command: "uptime", want: true},
+		{command: "uptime -p", want: false},
+		{command: "df -h", want: true},
+		{command: "df -h /", want: false},
+		{command: "df", want: false},
+		{command: "journalctl -n 100 --no-pager", want: true},
+		{command: "journalctl -n 100", want: false},
+		{command: "journalctl -f 100 --no-pager", want: false},
+		{command: "systemctl status nginx", want: true},
+		{command: "systemctl status nginx-proxy", want: true},
+		{command: "systemctl status sshd", want: false},
+		{command: "systemctl restart nginx", want: false},
+		{command: "ls", want: false},
+		// Shell metacharacters are rejected even where a wildcard would match them
+		{command: "journalctl -n $(reboot) --no-pager", want: false},
+		{command: "journalctl -n 1;reboot --no-pager", want: false},
+		{command: "journalctl -n `id` --no-pager", want: false},
+		{command: "systemctl status nginx|sh", want: false},
+		{command: "systemctl status nginx*", want: false},
+		{command: "uptime&&reboot", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := svc.Allowed(strings.Fields(tt.command)); got != tt.want {
+			t.Errorf("Allowed(%q) = %v, want %v", tt.command, got, tt.want)
+		}
+	}
+
+	if got := svc.AllowList(); len(got) != 4 || got[2] != "journalctl -n * --no-pager" {
+		t.Errorf("AllowList = %q, want the 4 non-empty patterns", got)
+	}
+}
+
+func TestExecRejectsCommandsOutsideAllowList(t *testing.T) {
+	store := &auditStore{}
+	audit := services.NewAuditService(store, nil, nopLogger{})
+	svc := services.NewExecService(nil, audit, []string{"uptime"}, nopLogger{})
+	server := &models.ServerWithDetails{Server: models.Server{ID: "srv_1"}, Role: services.RoleAdmin, ServerKey: "key_1"}
+
+	// The agent is never reached, so no Docker client is needed
+	if _, err := svc.Exec(context.Background(), 7, 1001, server, "rm -rf /"); !errors.IsErrorCode(err, errors.ErrCodeForbidden) {
+		t.Fatalf("Exec outside the allow-list = %v, want forbidden", err)
+	}
+	if _, err := svc.Exec(context.Background(), 7, 1001, server, "   "); !errors.IsErrorCode(err, errors.ErrCodeRequired) {
+		t.Errorf("Exec of an empty command = %v, want a required field error", err)
+	}
+
+	if len(store.entries) != 1 || store.entries[0].Command != services.AuditCommandExecDenied || store.entries[0].Payload != "rm -rf /" {
+		t.Errorf("audit log %+v, want the denied command only", store.entries)
+	}
+}
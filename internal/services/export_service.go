@@ -0,0 +1,277 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/repository"
+)
+
+// Formats of data exports
+const (
+	ExportJSON = "json"
+	ExportCSV  = "csv"
+)
+
+const (
+	// maxExportedCommands bounds the command history included in an export
+	maxExportedCommands = 100
+
+	// exportHistoryScan is how many recent actions on the servers of a user are scanned
+	// for the ones the user ran
+	exportHistoryScan = 1000
+)
+
+// UserExport represents everything the bot stores about a user. Server keys are left
+// out since they authenticate agents rather than describe the user.
+type UserExport struct {
+	ExportedAt           time.Time                    `json:"exported_at"`
+	Profile              ExportedProfile              `json:"profile"`
+	Servers              []ExportedServer             `json:"servers"`
+	AlertRoutes          []models.AlertRoute          `json:"alert_routes"`
+	UptimeChecks         []models.UptimeCheck         `json:"uptime_checks"`
+	NotificationChannels []models.NotificationChannel `json:"notification_channels"`
+	ReportSchedule       *models.ReportSchedule       `json:"report_schedule,omitempty"`
+	Settings             *models.UserSettings         `json:"settings"`
+	CommandHistory       []ExportedCommand            `json:"command_history"`
+}
+
+// ExportedProfile represents the profile of an exported user
+type ExportedProfile struct {
+	TelegramID int64     `json:"telegram_id"`
+	Username   string    `json:"username"`
+	FirstName  string    `json:"first_name"`
+	LastName   string    `json:"last_name"`
+	Timezone   string    `json:"timezone"`
+	IsAdmin    bool      `json:"is_admin"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ExportedServer represents a server linked to an exported user
+type ExportedServer struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Role    string    `json:"role"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// ExportedCommand represents an action the exported user ran against a server
+type ExportedCommand struct {
+	ServerID  string    `json:"server_id"`
+	Command   string    `json:"command"`
+	Payload   string    `json:"payload,omitempty"`
+	Success   bool      `json:"success"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ExportService collects the data stored about a user, for users asking what the bot
+// keeps about them
+type ExportService struct {
+	users    repository.UserStore
+	reports  repository.ReportStore
+	settings repository.SettingsStore
+	audit    repository.AuditStore
+	routes   repository.AlertRouteStore
+	uptime   repository.UptimeCheckStore
+	channels repository.NotifyStore
+	logger   Logger
+}
+
+// NewExportService creates a new export service
+func NewExportService(repo repository.Repository, logger Logger) *ExportService {
+	return &ExportService{
+		users:    repo,
+		reports:  repo,
+		settings: repo,
+		audit:    repo,
+		routes:   repo,
+		uptime:   repo,
+		channels: repo,
+		logger:   logger,
+	}
+}
+
+// Export collects the profile, servers, alert rules and recent commands of a user
+func (s *ExportService) Export(ctx context.Context, userID, telegramID int64, now time.Time) (*UserExport, error) {
+	user, err := s.users.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &UserExport{
+		ExportedAt: now.UTC(),
+		Profile: ExportedProfile{
+			TelegramID: user.TelegramID,
+			Username:   user.Username,
+			FirstName:  user.FirstName,
+			LastName:   user.LastName,
+			IsAdmin:    user.IsAdmin,
+			CreatedAt:  user.CreatedAt,
+		},
+		Servers:              []ExportedServer{},
+		AlertRoutes:          []models.AlertRoute{},
+		UptimeChecks:         []models.UptimeCheck{},
+		NotificationChannels: []models.NotificationChannel{},
+		CommandHistory:       []ExportedCommand{},
+	}
+
+	if export.Profile.Timezone, err = s.reports.GetUserTimezone(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	if export.Settings, err = s.settings.GetUserSettings(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	servers, err := s.users.GetUserServers(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, server := range servers {
+		export.Servers = append(export.Servers, ExportedServer{ID: server.ID, Name: server.Name, Role: server.Role, AddedAt: server.AddedAt})
+	}
+
+	routes, err := s.routes.ListAlertRoutes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, route := range routes {
+		if route.TelegramID == telegramID {
+			export.AlertRoutes = append(export.AlertRoutes, route)
+		}
+	}
+
+	checks, err := s.uptime.ListUptimeChecks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, check := range checks {
+		if check.TelegramID == telegramID {
+			export.UptimeChecks = append(export.UptimeChecks, check)
+		}
+	}
+
+	channels, err := s.channels.ListNotificationChannels(ctx, telegramID)
+	if err != nil {
+		return nil, err
+	}
+	export.NotificationChannels = append(export.NotificationChannels, channels...)
+
+	schedule, err := s.reports.GetReportSchedule(ctx, userID)
+	switch {
+	case err == nil:
+		export.ReportSchedule = schedule
+	case !stderrors.Is(err, sql.ErrNoRows):
+		return nil, err
+	}
+
+	// The history of a user's servers includes actions of their co-owners, keep only the user's
+	history, err := s.audit.ListCommandHistoryForUser(ctx, userID, exportHistoryScan)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range history {
+		if entry.TelegramID != telegramID || len(export.CommandHistory) >= maxExportedCommands {
+			continue
+		}
+		export.CommandHistory = append(export.CommandHistory, ExportedCommand{
+			ServerID:  entry.ServerID,
+			Command:   entry.Command,
+			Payload:   entry.Payload,
+			Success:   entry.Success,
+			Error:     entry.Error,
+			CreatedAt: entry.CreatedAt,
+		})
+	}
+
+	s.logger.Info("User data exported", "telegram_id", telegramID, "servers", len(export.Servers), "commands", len(export.CommandHistory))
+	return export, nil
+}
+
+// EncodeExport encodes an export as indented JSON, or as CSV with one row per record:
+// section, id, server_id, name, value, created_at
+func EncodeExport(export *UserExport, format string) ([]byte, error) {
+	if format == ExportJSON {
+		return json.MarshalIndent(export, "", "  ")
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	write := func(section, id, serverID, name, value string, createdAt time.Time) {
+		created := ""
+		if !createdAt.IsZero() {
+			created = createdAt.UTC().Format(time.RFC3339)
+		}
+		_ = w.Write([]string{section, id, serverID, name, value, created})
+	}
+
+	_ = w.Write([]string{"section", "id", "server_id", "name", "value", "created_at"})
+
+	profile := export.Profile
+	for _, field := range [][2]string{
+		{"telegram_id", strconv.FormatInt(profile.TelegramID, 10)},
+		{"username", profile.Username},
+		{"first_name", profile.FirstName},
+		{"last_name", profile.LastName},
+		{"timezone", profile.Timezone},
+		{"is_admin", strconv.FormatBool(profile.IsAdmin)},
+	} {
+		write("profile", "", "", field[0], field[1], time.Time{})
+	}
+	write("profile", "", "", "exported_at", "", export.ExportedAt)
+	write("profile", "", "", "created_at", "", profile.CreatedAt)
+
+	for _, server := range export.Servers {
+		write("server", "", server.ID, server.Name, server.Role, server.AddedAt)
+	}
+	for _, route := range export.AlertRoutes {
+		write("alert_route", strconv.FormatInt(route.ID, 10), route.ServerID, route.Category, strconv.FormatInt(route.ChatID, 10), route.CreatedAt)
+	}
+	for _, check := range export.UptimeChecks {
+		write("uptime_check", strconv.FormatInt(check.ID, 10), check.ServerID, check.Kind+" "+check.Target,
+			(time.Duration(check.IntervalSeconds) * time.Second).String(), check.CreatedAt)
+	}
+	for _, channel := range export.NotificationChannels {
+		write("notification_channel", strconv.FormatInt(channel.ID, 10), channel.ServerID, channel.Kind, channel.Target, channel.CreatedAt)
+	}
+	if schedule := export.ReportSchedule; schedule != nil {
+		write("report_schedule", strconv.FormatInt(schedule.ID, 10), "", schedule.Frequency,
+			fmt.Sprintf("weekday %d %02d:%02d %s", schedule.Weekday, schedule.Hour, schedule.Minute, profile.Timezone), schedule.CreatedAt)
+	}
+	if settings := export.Settings; settings != nil {
+		quietHours := ""
+		if settings.QuietFrom != nil && settings.QuietTo != nil {
+			quietHours = fmt.Sprintf("%02d-%02d", *settings.QuietFrom, *settings.QuietTo)
+		}
+		for _, field := range [][2]string{
+			{"default_server", settings.DefaultServerID},
+			{"language", settings.Language},
+			{"compact_metrics", strconv.FormatBool(settings.CompactMetrics)},
+			{"quiet_hours", quietHours},
+			{"notify_alerts", strconv.FormatBool(settings.NotifyAlerts)},
+			{"notify_reports", strconv.FormatBool(settings.NotifyReports)},
+		} {
+			write("settings", "", "", field[0], field[1], time.Time{})
+		}
+	}
+	for _, entry := range export.CommandHistory {
+		value := "ok"
+		if !entry.Success {
+			value = "error: " + entry.Error
+		}
+		write("command", "", entry.ServerID, strings.TrimSpace(entry.Command+" "+entry.Payload), value, entry.CreatedAt)
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/pkg/docker"
+	"github.com/servereye/servereyebot/pkg/errors"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+const (
+	// diskUsageDepth is the directory depth /du sums sizes to
+	diskUsageDepth = 2
+
+	// diskUsageEntries is the number of largest directories /du shows
+	diskUsageEntries = 20
+)
+
+// FileService browses files on user servers read-only
+type FileService struct {
+	docker       *docker.Client
+	maxReadBytes int64
+	maxEntries   int
+	logger       Logger
+}
+
+// NewFileService creates a new file service reading at most maxReadBytes per file
+// and showing at most maxEntries per directory
+func NewFileService(dockerClient *docker.Client, maxReadBytes int64, maxEntries int, logger Logger) *FileService {
+	return &FileService{
+		docker:       dockerClient,
+		maxReadBytes: maxReadBytes,
+		maxEntries:   maxEntries,
+		logger:       logger,
+	}
+}
+
+// ListDir lists a directory on behalf of a user. Only server admins may browse files.
+func (s *FileService) ListDir(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails, dir string) (*protocol.DirListingResponse, error) {
+	if err := Authorize(server, PermFiles); err != nil {
+		return nil, err
+	}
+
+	dir, err := cleanRemotePath(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = WithActor(ctx, userID, telegramID)
+
+	listing, err := s.docker.ListDir(ctx, server.ServerKey, dir)
+	if err != nil {
+		s.logger.Error("Failed to list directory", "error", err, "server_key", server.ServerKey, "path", dir)
+		return nil, err
+	}
+
+	return listing, nil
+}
+
+// ReadFile reads the beginning of a file, or its end when tail is set, on behalf of a user.
+// Only server admins may read files.
+func (s *FileService) ReadFile(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails, file string, tail bool) (*protocol.FileContentResponse, error) {
+	if err := Authorize(server, PermFiles); err != nil {
+		return nil, err
+	}
+
+	file, err := cleanRemotePath(file)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = WithActor(ctx, userID, telegramID)
+
+	content, err := s.docker.ReadFile(ctx, server.ServerKey, file, s.maxReadBytes, tail)
+	if err != nil {
+		s.logger.Error("Failed to read file", "error", err, "server_key", server.ServerKey, "path", file)
+		return nil, err
+	}
+
+	return content, nil
+}
+
+// DiskUsage retrieves the largest directories under a path on behalf of a user
+func (s *FileService) DiskUsage(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails, dir string) (*protocol.DiskUsageResponse, error) {
+	if err := Authorize(server, PermFiles); err != nil {
+		return nil, err
+	}
+
+	dir, err := cleanRemotePath(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = WithActor(ctx, userID, telegramID)
+
+	usage, err := s.docker.GetDiskUsage(ctx, server.ServerKey, dir, diskUsageDepth, diskUsageEntries)
+	if err != nil {
+		s.logger.Error("Failed to get disk usage", "error", err, "server_key", server.ServerKey, "path", dir)
+		return nil, err
+	}
+
+	return usage, nil
+}
+
+// FormatListing formats a directory listing, directories first
+func (s *FileService) FormatListing(server *models.ServerWithDetails, listing *protocol.DirListingResponse) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("📁 %s на %s(%s):\n\n", listing.Path, server.Name, server.ID))
+
+	if len(listing.Entries) == 0 {
+		sb.WriteString("Каталог пуст.")
+		return sb.String()
+	}
+
+	entries := make([]protocol.DirEntry, len(listing.Entries))
+	copy(entries, listing.Entries)
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].IsDir != entries[j].IsDir {
+			return entries[i].IsDir
+		}
+		return entries[i].Name < entries[j].Name
+	})
+
+	truncated := listing.Truncated
+	if len(entries) > s.maxEntries {
+		entries = entries[:s.maxEntries]
+		truncated = true
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir {
+			sb.WriteString(fmt.Sprintf("📁 %s/\n", entry.Name))
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("📄 %s  %s  %s\n", entry.Name, formatBytes(uint64(entry.Size)), entry.Mode))
+	}
+
+	if truncated {
+		sb.WriteString(fmt.Sprintf("\n… показаны первые %d записей", len(entries)))
+	}
+
+	return sb.String()
+}
+
+// FormatContent formats file contents as messages, each below the Telegram message limit
+func (s *FileService) FormatContent(server *models.ServerWithDetails, content *protocol.FileContentResponse, tail bool) []string {
+	header := fmt.Sprintf("📄 %s на %s(%s), %s", content.Path, server.Name, server.ID, formatBytes(uint64(content.Size)))
+	if content.Truncated {
+		part := "первые"
+		if tail {
+			part = "последние"
+		}
+		header += fmt.Sprintf(", %s %s", part, formatBytes(uint64(s.maxReadBytes)))
+	}
+	header += ":\n\n"
+
+	if content.Binary {
+		return []string{header + "Двоичный файл, содержимое не показано."}
+	}
+	if content.Content == "" {
+		return []string{header + "Файл пуст."}
+	}
+
+	return chunkMessage(header, strings.ToValidUTF8(content.Content, ""))
+}
+
+// FormatDiskUsage formats the largest directories under a path with their share of it
+func (s *FileService) FormatDiskUsage(server *models.ServerWithDetails, usage *protocol.DiskUsageResponse) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("💽 %s на %s(%s): %s\n", usage.Path, server.Name, server.ID, formatBytes(uint64(usage.Size))))
+	if usage.FilesystemSize > 0 {
+		sb.WriteString(fmt.Sprintf("Файловая система: занято %s из %s (%.0f%%)\n",
+			formatBytes(uint64(usage.FilesystemUsed)), formatBytes(uint64(usage.FilesystemSize)), float64(usage.FilesystemUsed)/float64(usage.FilesystemSize)*100))
+	}
+	sb.WriteString("\n")
+
+	entries := make([]protocol.DiskUsageEntry, len(usage.Entries))
+	copy(entries, usage.Entries)
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Size > entries[j].Size })
+	if len(entries) > diskUsageEntries {
+		entries = entries[:diskUsageEntries]
+	}
+
+	if len(entries) == 0 {
+		sb.WriteString("Подкаталогов нет.\n")
+	}
+	for i, entry := range entries {
+		sb.WriteString(fmt.Sprintf("%d. %s — %s", i+1, entry.Path, formatBytes(uint64(entry.Size))))
+		if usage.Size > 0 {
+			sb.WriteString(fmt.Sprintf(" (%.0f%%)", float64(entry.Size)/float64(usage.Size)*100))
+		}
+		sb.WriteString("\n")
+	}
+
+	if usage.Unreadable > 0 {
+		sb.WriteString(fmt.Sprintf("\n⚠️ Не удалось прочитать каталогов: %d, их размер не учтен.", usage.Unreadable))
+	}
+
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// cleanRemotePath normalizes an absolute path on a server
+func cleanRemotePath(p string) (string, error) {
+	if !path.IsAbs(p) {
+		return "", errors.NewValidationError("path must be absolute", map[string]interface{}{"path": p})
+	}
+	return path.Clean(p), nil
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	stderrors "errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/repository"
+	"github.com/servereye/servereyebot/pkg/docker"
+	"github.com/servereye/servereyebot/pkg/errors"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// maxFirewallRules bounds the firewall rules shown in one message
+const maxFirewallRules = 40
+
+// FirewallService shows the firewall of user servers and blocks addresses in it. Blocks
+// are recorded by the bot so they can be listed and reverted.
+type FirewallService struct {
+	repo   repository.FirewallStore
+	docker *docker.Client
+	logger Logger
+}
+
+// NewFirewallService creates a new firewall service
+func NewFirewallService(repo repository.FirewallStore, dockerClient *docker.Client, logger Logger) *FirewallService {
+	return &FirewallService{
+		repo:   repo,
+		docker: dockerClient,
+		logger: logger,
+	}
+}
+
+// ParseBlockAddress parses an IP address or CIDR network to block into its canonical
+// form. Loopback and unspecified addresses are rejected, blocking them would cut off
+// the agent or the whole server.
+func ParseBlockAddress(value string) (string, error) {
+	var ip net.IP
+	address := value
+	if strings.Contains(value, "/") {
+		networkIP, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return "", errors.NewValidationError("invalid network", map[string]interface{}{"address": value})
+		}
+		ones, _ := network.Mask.Size()
+		if ones == 0 {
+			return "", errors.NewValidationError("network covers every address", map[string]interface{}{"address": value})
+		}
+		ip, address = networkIP, network.String()
+	} else {
+		if ip = net.ParseIP(value); ip == nil {
+			return "", errors.NewValidationError("invalid address", map[string]interface{}{"address": value})
+		}
+		address = ip.String()
+	}
+
+	if ip.IsLoopback() || ip.IsUnspecified() {
+		return "", errors.NewValidationError("address must not be blocked", map[string]interface{}{"address": value})
+	}
+	return address, nil
+}
+
+// Status retrieves the firewall of a server on behalf of a user
+func (s *FirewallService) Status(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails) (*protocol.FirewallStatusResponse, error) {
+	status, err := s.docker.GetFirewall(WithActor(ctx, userID, telegramID), server.ServerKey)
+	if err != nil {
+		s.logger.Error("Failed to get firewall status", "error", err, "server_key", server.ServerKey)
+		return nil, err
+	}
+	return status, nil
+}
+
+// List retrieves the addresses blocked on a server from the bot
+func (s *FirewallService) List(ctx context.Context, serverID string) ([]models.FirewallBlock, error) {
+	return s.repo.ListFirewallBlocks(ctx, serverID)
+}
+
+// Block drops incoming traffic from an address on a server and records the block. Only
+// owners may block addresses.
+func (s *FirewallService) Block(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails, value string) (*models.FirewallBlock, error) {
+	if err := Authorize(server, PermFirewall); err != nil {
+		return nil, err
+	}
+	address, err := ParseBlockAddress(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.docker.BlockAddress(WithActor(ctx, userID, telegramID), server.ServerKey, address); err != nil {
+		s.logger.Error("Failed to block address", "error", err, "server_key", server.ServerKey, "address", address)
+		return nil, err
+	}
+
+	block := &models.FirewallBlock{ServerID: server.ID, Address: address, CreatedBy: telegramID}
+	if err := s.repo.AddFirewallBlock(ctx, block); err != nil {
+		s.logger.Error("Failed to record firewall block", "error", err, "server_id", server.ID, "address", address)
+		return nil, err
+	}
+
+	s.logger.Warn("Address blocked", "server_id", server.ID, "address", address, "telegram_id", telegramID)
+	return block, nil
+}
+
+// Unblock removes a block recorded for a server from its firewall. Only owners may
+// unblock addresses.
+func (s *FirewallService) Unblock(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails, id int64) (*models.FirewallBlock, error) {
+	if err := Authorize(server, PermFirewall); err != nil {
+		return nil, err
+	}
+
+	block, err := s.repo.GetFirewallBlock(ctx, id)
+	if err != nil {
+		if stderrors.Is(err, sql.ErrNoRows) {
+			return nil, errors.NewNotFoundError(fmt.Sprintf("firewall block %d", id))
+		}
+		return nil, err
+	}
+	if block.ServerID != server.ID {
+		return nil, errors.NewNotFoundError(fmt.Sprintf("firewall block %d", id))
+	}
+
+	if _, err := s.docker.UnblockAddress(WithActor(ctx, userID, telegramID), server.ServerKey, block.Address); err != nil {
+		s.logger.Error("Failed to unblock address", "error", err, "server_key", server.ServerKey, "address", block.Address)
+		return nil, err
+	}
+	if _, err := s.repo.DeleteFirewallBlock(ctx, id); err != nil {
+		s.logger.Error("Failed to delete firewall block", "error", err, "server_id", server.ID, "address", block.Address)
+		return nil, err
+	}
+
+	s.logger.Info("Address unblocked", "server_id", server.ID, "address", block.Address, "telegram_id", telegramID)
+	return block, nil
+}
+
+// FormatFirewall formats the firewall of a server with the addresses blocked from the bot
+func FormatFirewall(server *models.ServerWithDetails, status *protocol.FirewallStatusResponse, blocks []models.FirewallBlock, now time.Time) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("🧱 Файрвол %s(%s)\n\n", server.Name, server.ID))
+
+	switch {
+	case status.Backend == "":
+		sb.WriteString("⚠️ Агент не нашел ufw, nftables или iptables.\n")
+	case !status.Active:
+		sb.WriteString(fmt.Sprintf("🔴 %s выключен\n", status.Backend))
+	default:
+		sb.WriteString(fmt.Sprintf("🟢 %s включен", status.Backend))
+		if status.DefaultPolicy != "" {
+			sb.WriteString(fmt.Sprintf(", входящие по умолчанию: %s", status.DefaultPolicy))
+		}
+		sb.WriteString("\n")
+	}
+
+	if len(status.Rules) > 0 {
+		sb.WriteString(fmt.Sprintf("\nПравила (%d):\n", len(status.Rules)))
+		for i, rule := range status.Rules {
+			if i == maxFirewallRules {
+				sb.WriteString(fmt.Sprintf("… и еще %d\n", len(status.Rules)-maxFirewallRules))
+				break
+			}
+			sb.WriteString("• " + formatFirewallRule(rule) + "\n")
+		}
+	}
+
+	if len(blocks) > 0 {
+		sb.WriteString("\n⛔ Заблокированы из бота:\n")
+		for _, block := range blocks {
+			sb.WriteString(fmt.Sprintf("#%d %s — %s\n", block.ID, block.Address, block.CreatedAt.UTC().Format("02.01.2006 15:04")))
+		}
+	}
+
+	sb.WriteString(fmt.Sprintf("\n🕐 %s UTC", now.UTC().Format("15:04:05")))
+	return sb.String()
+}
+
+// formatFirewallRule formats a firewall rule on one line
+func formatFirewallRule(rule protocol.FirewallRule) string {
+	if rule.Raw != "" && rule.Port == "" && rule.Source == "" && rule.Protocol == "" {
+		return rule.Raw
+	}
+
+	port := rule.Port
+	if port == "" {
+		port = "все порты"
+	}
+	if rule.Protocol != "" {
+		port += "/" + rule.Protocol
+	}
+	source := rule.Source
+	if source == "" {
+		source = "отовсюду"
+	}
+	return fmt.Sprintf("%s %s из %s", strings.ToUpper(rule.Action), port, source)
+}
@@ -0,0 +1,207 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/api"
+	"github.com/servereye/servereyebot/internal/repository"
+)
+
+const (
+	// fleetStatsConcurrency bounds the servers queried at once from the ServerEye API
+	fleetStatsConcurrency = 8
+
+	// fleetStatsCacheTTL is how long collected fleet stats are reused, as collecting them
+	// takes two API requests per server
+	fleetStatsCacheTTL = time.Minute
+
+	// fleetStatsUnknown labels servers whose agent version or OS could not be retrieved
+	fleetStatsUnknown = "unknown"
+)
+
+// FleetCount represents the number of servers sharing an agent version or OS
+type FleetCount struct {
+	Name    string `json:"name"`
+	Servers int    `json:"servers"`
+}
+
+// FleetStats represents the state of all servers with active users
+type FleetStats struct {
+	Servers       int          `json:"servers"`
+	Online        int          `json:"online"`
+	Offline       int          `json:"offline"`
+	Unknown       int          `json:"unknown"` // status could not be retrieved
+	AgentVersions []FleetCount `json:"agent_versions"`
+	OS            []FleetCount `json:"os"`
+	CollectedAt   time.Time    `json:"collected_at"`
+}
+
+// fleetServer is the state of one server collected for fleet stats
+type fleetServer struct {
+	status  string // online, offline or unknown
+	version string
+	os      string
+}
+
+// FleetStatsService counts online servers and the agent versions and operating systems
+// they run, to track the rollout of agent releases
+type FleetStatsService struct {
+	users     repository.UserStore
+	apiClient *api.Client
+	timeout   time.Duration
+	logger    Logger
+
+	mu     sync.Mutex
+	cached *FleetStats
+}
+
+// NewFleetStatsService creates a new fleet stats service. Every server has timeout to
+// answer before it is counted as unknown.
+func NewFleetStatsService(users repository.UserStore, apiClient *api.Client, timeout time.Duration, logger Logger) *FleetStatsService {
+	return &FleetStatsService{
+		users:     users,
+		apiClient: apiClient,
+		timeout:   timeout,
+		logger:    logger,
+	}
+}
+
+// Stats collects the fleet stats, reusing the last ones for fleetStatsCacheTTL
+func (s *FleetStatsService) Stats(ctx context.Context, now time.Time) (*FleetStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cached != nil && now.Sub(s.cached.CollectedAt) < fleetStatsCacheTTL {
+		return s.cached, nil
+	}
+
+	targets, err := s.users.ListAlertTargets(ctx)
+	if err != nil {
+		s.logger.Error("Failed to list servers for fleet stats", "error", err)
+		return nil, err
+	}
+
+	// Alert targets list a server once per user
+	keys := make(map[string]string)
+	for _, target := range targets {
+		keys[target.ServerID] = target.ServerKey
+	}
+
+	servers := make([]fleetServer, 0, len(keys))
+	results := make(chan fleetServer, len(keys))
+	slots := make(chan struct{}, fleetStatsConcurrency)
+	var wg sync.WaitGroup
+	for _, serverKey := range keys {
+		wg.Add(1)
+		go func(serverKey string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			results <- s.collect(ctx, serverKey)
+		}(serverKey)
+	}
+	wg.Wait()
+	close(results)
+	for server := range results {
+		servers = append(servers, server)
+	}
+
+	stats := &FleetStats{Servers: len(servers), CollectedAt: now}
+	versions := make(map[string]int)
+	systems := make(map[string]int)
+	for _, server := range servers {
+		switch server.status {
+		case "online":
+			stats.Online++
+		case "offline":
+			stats.Offline++
+		default:
+			stats.Unknown++
+		}
+		versions[server.version]++
+		systems[server.os]++
+	}
+	stats.AgentVersions = fleetCounts(versions)
+	stats.OS = fleetCounts(systems)
+
+	s.cached = stats
+	return stats, nil
+}
+
+// collect retrieves the status and operating system of a server
+func (s *FleetStatsService) collect(ctx context.Context, serverKey string) fleetServer {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	server := fleetServer{status: fleetStatsUnknown, version: fleetStatsUnknown, os: fleetStatsUnknown}
+	if status, err := s.apiClient.GetServerStatus(ctx, serverKey); err == nil {
+		server.status = "offline"
+		if status.Online {
+			server.status = "online"
+		}
+		if status.AgentVersion != "" {
+			server.version = status.AgentVersion
+		}
+	} else {
+		s.logger.Debug("Failed to get server status for fleet stats", "error", err, "server_key", serverKey)
+	}
+
+	if info, err := s.apiClient.GetServerStaticInfo(ctx, serverKey); err == nil {
+		if name := strings.TrimSpace(info.ServerInfo.OS + " " + info.ServerInfo.OSVersion); name != "" {
+			server.os = name
+		}
+	} else {
+		s.logger.Debug("Failed to get server static info for fleet stats", "error", err, "server_key", serverKey)
+	}
+
+	return server
+}
+
+// fleetCounts sorts counted names, the most common first
+func fleetCounts(counts map[string]int) []FleetCount {
+	list := make([]FleetCount, 0, len(counts))
+	for name, servers := range counts {
+		list = append(list, FleetCount{Name: name, Servers: servers})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Servers != list[j].Servers {
+			return list[i].Servers > list[j].Servers
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// FormatFleetStats formats the online servers and the agent version and OS distributions
+func FormatFleetStats(stats *FleetStats) string {
+	var sb strings.Builder
+	sb.WriteString("🛰 Серверы\n\n")
+	sb.WriteString(fmt.Sprintf("Всего: %d, онлайн: %d, офлайн: %d, нет данных: %d\n", stats.Servers, stats.Online, stats.Offline, stats.Unknown))
+	if stats.Servers == 0 {
+		return strings.TrimRight(sb.String(), "\n")
+	}
+
+	sb.WriteString("\nВерсии агента:\n")
+	writeFleetCounts(&sb, stats.AgentVersions, stats.Servers)
+	sb.WriteString("\nОС:\n")
+	writeFleetCounts(&sb, stats.OS, stats.Servers)
+
+	sb.WriteString(fmt.Sprintf("\n🕐 %s UTC", stats.CollectedAt.UTC().Format("15:04:05")))
+	return sb.String()
+}
+
+// writeFleetCounts writes a distribution with the share of every entry
+func writeFleetCounts(sb *strings.Builder, counts []FleetCount, total int) {
+	for _, count := range counts {
+		name := count.Name
+		if name == fleetStatsUnknown {
+			name = "нет данных"
+		}
+		sb.WriteString(fmt.Sprintf("- %s: %d (%.0f%%)\n", name, count.Servers, float64(count.Servers)*100/float64(total)))
+	}
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	stderrors "errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/repository"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+const (
+	// MinGuestDuration and MaxGuestDuration bound how long guest access lasts
+	MinGuestDuration = time.Hour
+	MaxGuestDuration = 30 * 24 * time.Hour
+
+	// maxServerGuests bounds the guests of a server
+	maxServerGuests = 20
+)
+
+// GuestService grants time-boxed read access to servers, e.g. 48 hours for a contractor.
+// A grant adds the user to the server with the guest role, which has the rights of a
+// viewer; once it expires a scheduler job removes the access again and both parties are
+// notified.
+type GuestService struct {
+	repo   repository.GuestStore
+	users  repository.UserStore
+	logger Logger
+}
+
+// NewGuestService creates a new guest service
+func NewGuestService(repo repository.GuestStore, users repository.UserStore, logger Logger) *GuestService {
+	return &GuestService{
+		repo:   repo,
+		users:  users,
+		logger: logger,
+	}
+}
+
+// FindUser resolves a guest given as @username or Telegram ID. Guests must have started
+// the bot, otherwise they can neither be found nor receive messages.
+func (s *GuestService) FindUser(ctx context.Context, ref string) (*models.User, error) {
+	var (
+		user *models.User
+		err  error
+	)
+	if telegramID, parseErr := strconv.ParseInt(ref, 10, 64); parseErr == nil {
+		user, err = s.users.GetUser(telegramID)
+	} else {
+		user, err = s.users.GetUserByUsername(ctx, strings.TrimPrefix(ref, "@"))
+	}
+
+	if stderrors.Is(err, sql.ErrNoRows) {
+		return nil, errors.NewNotFoundError("user")
+	}
+	return user, err
+}
+
+// Grant gives a user guest access to a server until now+duration. Granting again to a
+// guest replaces the expiry. Only owners may grant access, and users that already have
+// access of their own cannot become guests.
+func (s *GuestService) Grant(ctx context.Context, telegramID int64, server *models.ServerWithDetails, guest *models.User, duration time.Duration, now time.Time) (*models.ServerGuest, error) {
+	if err := Authorize(server, PermGuests); err != nil {
+		return nil, err
+	}
+	if duration < MinGuestDuration || duration > MaxGuestDuration {
+		return nil, errors.NewValidationError("guest access duration out of range", map[string]interface{}{"duration": duration.String(), "min": MinGuestDuration.String(), "max": MaxGuestDuration.String()})
+	}
+	if guest.TelegramID == telegramID {
+		return nil, errors.NewValidationError("cannot grant guest access to yourself", map[string]interface{}{"telegram_id": telegramID})
+	}
+
+	guests, err := s.repo.ListServerGuests(ctx, server.ID)
+	if err != nil {
+		s.logger.Error("Failed to list server guests", "error", err, "server_id", server.ID)
+		return nil, err
+	}
+	existing := false
+	for _, g := range guests {
+		existing = existing || g.UserID == guest.ID
+	}
+	if !existing && len(guests) >= maxServerGuests {
+		return nil, errors.NewValidationError("too many server guests", map[string]interface{}{"server_id": server.ID, "max": maxServerGuests})
+	}
+
+	if !existing {
+		hasAccess, err := s.users.IsServerOwnedByUser(guest.ID, server.ID)
+		if err != nil {
+			return nil, err
+		}
+		if hasAccess {
+			return nil, errors.NewValidationError("user already has access to the server", map[string]interface{}{"server_id": server.ID, "telegram_id": guest.TelegramID})
+		}
+	}
+
+	grant := &models.ServerGuest{
+		ServerID:   server.ID,
+		ServerName: server.Name,
+		UserID:     guest.ID,
+		TelegramID: guest.TelegramID,
+		Username:   guest.Username,
+		GrantedBy:  telegramID,
+		ExpiresAt:  now.Add(duration),
+	}
+	if err := s.repo.GrantServerGuest(ctx, grant); err != nil {
+		s.logger.Error("Failed to grant guest access", "error", err, "server_id", server.ID, "guest", guest.TelegramID)
+		return nil, err
+	}
+
+	s.logger.Info("Guest access granted", "server_id", server.ID, "guest", guest.TelegramID, "granted_by", telegramID, "expires_at", grant.ExpiresAt)
+	return grant, nil
+}
+
+// Revoke ends the guest access of a user before it expires, reporting whether it existed
+func (s *GuestService) Revoke(ctx context.Context, server *models.ServerWithDetails, guest *models.User) (bool, error) {
+	if err := Authorize(server, PermGuests); err != nil {
+		return false, err
+	}
+
+	revoked, err := s.repo.RevokeServerGuest(ctx, server.ID, guest.ID)
+	if err != nil {
+		s.logger.Error("Failed to revoke guest access", "error", err, "server_id", server.ID, "guest", guest.TelegramID)
+		return false, err
+	}
+	if revoked {
+		s.logger.Info("Guest access revoked", "server_id", server.ID, "guest", guest.TelegramID)
+	}
+	return revoked, nil
+}
+
+// List returns the guests of a server
+func (s *GuestService) List(ctx context.Context, serverID string) ([]models.ServerGuest, error) {
+	return s.repo.ListServerGuests(ctx, serverID)
+}
+
+// Expire revokes the grants that expired by now and returns them
+func (s *GuestService) Expire(ctx context.Context, now time.Time) ([]models.ServerGuest, error) {
+	expired, err := s.repo.ListExpiredServerGuests(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var revoked []models.ServerGuest
+	for _, guest := range expired {
+		ok, err := s.repo.RevokeServerGuest(ctx, guest.ServerID, guest.UserID)
+		if err != nil {
+			s.logger.Error("Failed to revoke expired guest access", "error", err, "server_id", guest.ServerID, "guest", guest.TelegramID)
+			continue
+		}
+		if ok {
+			s.logger.Info("Guest access expired", "server_id", guest.ServerID, "guest", guest.TelegramID)
+			revoked = append(revoked, guest)
+		}
+	}
+	return revoked, nil
+}
+
+// GuestName returns how a guest is shown to users
+func GuestName(guest models.ServerGuest) string {
+	if guest.Username != "" {
+		return "@" + guest.Username
+	}
+	return strconv.FormatInt(guest.TelegramID, 10)
+}
+
+// FormatGuests formats the guests of a server
+func FormatGuests(server *models.ServerWithDetails, guests []models.ServerGuest, now time.Time) string {
+	if len(guests) == 0 {
+		return fmt.Sprintf("👥 У сервера %s нет гостей.\n\nДать временный доступ: /guest %s @username 48h", server.Name, server.ID)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("👥 Гости сервера %s:\n\n", server.Name))
+	for _, guest := range guests {
+		sb.WriteString(fmt.Sprintf("- %s, доступ до %s UTC (осталось %s)\n",
+			GuestName(guest), guest.ExpiresAt.UTC().Format("02.01.2006 15:04"), formatAge(guest.ExpiresAt.Sub(now))))
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
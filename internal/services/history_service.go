@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	stderrors "errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/repository"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// busiestHoursLimit is how many busiest hours /top reports
+const busiestHoursLimit = 3
+
+// maxHistoryPeriod bounds how far back history queries look
+const maxHistoryPeriod = 90 * 24 * time.Hour
+
+// HistoryMetric describes a stored metric that history queries accept
+type HistoryMetric struct {
+	Alias string // name used in commands, e.g. cpu
+	Name  string // stored sample name, e.g. cpu_percent
+	Unit  string
+}
+
+// historyMetrics lists the metrics recorded by metricSamples under their command aliases
+var historyMetrics = []HistoryMetric{
+	{Alias: "cpu", Name: "cpu_percent", Unit: "%"},
+	{Alias: "memory", Name: "memory_percent", Unit: "%"},
+	{Alias: "disk", Name: "disk_percent", Unit: "%"},
+	{Alias: "network", Name: "network_mbps", Unit: " Mbps"},
+	{Alias: "temp", Name: "temperature_celsius", Unit: "°C"},
+	{Alias: "load", Name: "load_1m", Unit: ""},
+	{Alias: "processes", Name: "processes_total", Unit: ""},
+}
+
+// MetricTop summarizes a metric over a period
+type MetricTop struct {
+	Metric HistoryMetric
+	Period time.Duration
+	Peak   *models.MetricSample // nil when no samples were stored in the period
+	Hours  []models.MetricHour  // busiest hours, busiest first
+}
+
+// HistoryService answers questions about stored metrics history
+type HistoryService struct {
+	repo   repository.MetricsStore
+	logger Logger
+}
+
+// NewHistoryService creates a new metrics history service
+func NewHistoryService(repo repository.MetricsStore, logger Logger) *HistoryService {
+	return &HistoryService{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// HistoryMetrics returns the metrics history queries accept
+func HistoryMetrics() []HistoryMetric {
+	return historyMetrics
+}
+
+// FindHistoryMetric finds a metric by its alias or stored name
+func FindHistoryMetric(name string) (HistoryMetric, bool) {
+	name = strings.ToLower(name)
+	for _, metric := range historyMetrics {
+		if metric.Alias == name || metric.Name == name {
+			return metric, true
+		}
+	}
+	return HistoryMetric{}, false
+}
+
+// ParseHistoryPeriod parses a period such as 6h, 7d or 2w
+func ParseHistoryPeriod(value string) (time.Duration, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if len(value) < 2 {
+		return 0, errors.NewValidationError("invalid period", map[string]interface{}{"period": value})
+	}
+
+	units := map[byte]time.Duration{'h': time.Hour, 'd': 24 * time.Hour, 'w': 7 * 24 * time.Hour}
+	unit, ok := units[value[len(value)-1]]
+	n, err := strconv.Atoi(value[:len(value)-1])
+	if !ok || err != nil || n <= 0 {
+		return 0, errors.NewValidationError("invalid period", map[string]interface{}{"period": value})
+	}
+
+	period := time.Duration(n) * unit
+	if period > maxHistoryPeriod {
+		return 0, errors.NewValidationError("period too long", map[string]interface{}{"period": value, "max": maxHistoryPeriod.String()})
+	}
+	return period, nil
+}
+
+// Top finds when a metric of a server peaked within the period and its busiest hours
+func (s *HistoryService) Top(ctx context.Context, serverKey string, metric HistoryMetric, period time.Duration, now time.Time) (*MetricTop, error) {
+	since := now.Add(-period)
+	top := &MetricTop{Metric: metric, Period: period}
+
+	peak, err := s.repo.GetMetricPeak(ctx, serverKey, metric.Name, since)
+	if err != nil {
+		if stderrors.Is(err, sql.ErrNoRows) {
+			return top, nil
+		}
+		s.logger.Error("Failed to get metric peak", "error", err, "server_key", serverKey, "metric", metric.Name)
+		return nil, err
+	}
+	top.Peak = peak
+
+	top.Hours, err = s.repo.ListBusiestMetricHours(ctx, serverKey, metric.Name, since, busiestHoursLimit)
+	if err != nil {
+		s.logger.Error("Failed to get busiest hours", "error", err, "server_key", serverKey, "metric", metric.Name)
+		return nil, err
+	}
+
+	return top, nil
+}
+
+// FormatTop formats a metric summary for display with times in the given location
+func (s *HistoryService) FormatTop(server *models.ServerWithDetails, top *MetricTop, periodLabel string, loc *time.Location) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("🏔️ %s на %s(%s) за %s\n\n", top.Metric.Alias, server.Name, server.ID, periodLabel))
+
+	if top.Peak == nil {
+		sb.WriteString("Нет сохраненных данных за этот период.")
+		return sb.String()
+	}
+
+	sb.WriteString(fmt.Sprintf("Пик: %s в %s\n", formatMetricValue(top.Peak.Value, top.Metric.Unit),
+		top.Peak.CollectedAt.In(loc).Format("02.01.2006 15:04")))
+
+	if len(top.Hours) > 0 {
+		sb.WriteString("\nСамые загруженные часы:\n")
+		for i, hour := range top.Hours {
+			start := hour.Hour.In(loc)
+			sb.WriteString(fmt.Sprintf("%d. %s-%s: среднее %s, максимум %s\n", i+1,
+				start.Format("02.01 15:04"), start.Add(time.Hour).Format("15:04"),
+				formatMetricValue(hour.Avg, top.Metric.Unit), formatMetricValue(hour.Max, top.Metric.Unit)))
+		}
+	}
+
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// formatMetricValue formats a metric value with its unit
+func formatMetricValue(value float64, unit string) string {
+	return fmt.Sprintf("%.1f%s", value, unit)
+}
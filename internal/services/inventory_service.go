@@ -0,0 +1,435 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/servereye/servereyebot/internal/api"
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// inventoryBOM is the byte order mark spreadsheet applications may start files with
+var inventoryBOM = []byte("\xef\xbb\xbf")
+
+// Formats of server inventories
+const (
+	InventoryCSV  = "csv"
+	InventoryYAML = "yaml"
+)
+
+const (
+	// MaxInventorySize bounds the size of an uploaded inventory file in bytes
+	MaxInventorySize = 256 << 10
+
+	// maxInventoryServers bounds the servers imported from a single file
+	maxInventoryServers = 500
+
+	// maxInventoryNameLength bounds the length of an imported server name in characters
+	maxInventoryNameLength = 64
+
+	// inventorySource is the source servers imported from files are added with
+	inventorySource = "TGBot"
+)
+
+// InventoryEntry represents a server of an inventory file. The name is optional.
+type InventoryEntry struct {
+	Line int // line of the file the server is described on
+	Key  string
+	Name string
+}
+
+// InventoryFailure represents a server of an inventory that was not imported
+type InventoryFailure struct {
+	Line   int
+	Key    string
+	Reason string
+}
+
+// ImportReport summarizes the import of an inventory
+type ImportReport struct {
+	Added     []string // keys of servers added to the user
+	Renamed   []string // keys of servers of the user that got the name of the file
+	Unchanged []string // keys of servers the user already had with the same name
+	Failed    []InventoryFailure
+}
+
+// InventoryFormat returns the format of an inventory file by its extension, empty when
+// the file is no inventory
+func InventoryFormat(fileName string) string {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".csv":
+		return InventoryCSV
+	case ".yaml", ".yml":
+		return InventoryYAML
+	}
+	return ""
+}
+
+// InventoryService imports the servers of a user from inventory files and exports them
+type InventoryService struct {
+	users  *UserService
+	audit  *AuditService
+	logger Logger
+}
+
+// NewInventoryService creates a new inventory service
+func NewInventoryService(users *UserService, audit *AuditService, logger Logger) *InventoryService {
+	return &InventoryService{
+		users:  users,
+		audit:  audit,
+		logger: logger,
+	}
+}
+
+// ParseInventory parses an inventory file of a format. Entries that cannot be imported,
+// such as malformed keys or duplicates, are returned as failures, while a file that is
+// not an inventory at all fails as a whole.
+func ParseInventory(data []byte, format string) ([]InventoryEntry, []InventoryFailure, error) {
+	var entries []InventoryEntry
+	var err error
+	switch format {
+	case InventoryCSV:
+		entries, err = parseInventoryCSV(data)
+	case InventoryYAML:
+		entries, err = parseInventoryYAML(data)
+	default:
+		return nil, nil, errors.NewValidationError(fmt.Sprintf("unsupported inventory format %q", format), nil)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil, errors.NewValidationError("inventory has no servers", nil)
+	}
+	if len(entries) > maxInventoryServers {
+		return nil, nil, errors.NewValidationError(fmt.Sprintf("inventory has more than %d servers", maxInventoryServers), nil)
+	}
+
+	var valid []InventoryEntry
+	var failed []InventoryFailure
+	seen := make(map[string]int)
+	for _, entry := range entries {
+		switch {
+		case api.ValidateServerID(entry.Key) != nil:
+			failed = append(failed, InventoryFailure{Line: entry.Line, Key: entry.Key, Reason: "неверный формат ключа"})
+		case seen[entry.Key] > 0:
+			failed = append(failed, InventoryFailure{Line: entry.Line, Key: entry.Key, Reason: fmt.Sprintf("повтор строки %d", seen[entry.Key])})
+		case utf8.RuneCountInString(entry.Name) > maxInventoryNameLength:
+			failed = append(failed, InventoryFailure{Line: entry.Line, Key: entry.Key, Reason: fmt.Sprintf("имя длиннее %d символов", maxInventoryNameLength)})
+		default:
+			seen[entry.Key] = entry.Line
+			valid = append(valid, entry)
+		}
+	}
+	return valid, failed, nil
+}
+
+// parseInventoryCSV parses key,name records. A header naming the columns is optional.
+func parseInventoryCSV(data []byte) ([]InventoryEntry, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, inventoryBOM)))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	var entries []InventoryEntry
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.NewValidationError(fmt.Sprintf("malformed CSV: %v", err), nil)
+		}
+		line, _ := reader.FieldPos(0)
+
+		key := strings.TrimSpace(record[0])
+		if len(entries) == 0 && (strings.EqualFold(key, "key") || strings.EqualFold(key, "server_id")) {
+			continue // header
+		}
+		if key == "" {
+			continue
+		}
+
+		entry := InventoryEntry{Line: line, Key: key}
+		if len(record) > 1 {
+			entry.Name = strings.TrimSpace(record[1])
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// parseInventoryYAML parses a sequence of servers with key and name, either at the top
+// level or under a servers key:
+//
+//	servers:
+//	  - key: srv_1
+//	    name: Web 1
+//	  - {key: srv_2, name: DB}
+func parseInventoryYAML(data []byte) ([]InventoryEntry, error) {
+	var entries []InventoryEntry
+	var current *InventoryEntry
+	itemIndent := -1
+
+	for i, raw := range strings.Split(string(bytes.TrimPrefix(data, inventoryBOM)), "\n") {
+		number := i + 1
+		text := strings.TrimRight(stripInventoryComment(strings.TrimRight(raw, "\r")), " \t")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		indent := len(text) - len(trimmed)
+
+		if strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+			if itemIndent >= 0 && indent != itemIndent {
+				return nil, errors.NewValidationError(fmt.Sprintf("line %d: unexpected indentation", number), nil)
+			}
+			itemIndent = indent
+			entries = append(entries, InventoryEntry{Line: number})
+			current = &entries[len(entries)-1]
+
+			item := strings.TrimSpace(strings.TrimPrefix(trimmed, "-"))
+			if strings.HasPrefix(item, "{") {
+				if !strings.HasSuffix(item, "}") {
+					return nil, errors.NewValidationError(fmt.Sprintf("line %d: unterminated flow mapping", number), nil)
+				}
+				for _, field := range strings.Split(item[1:len(item)-1], ",") {
+					if err := setInventoryField(current, field, number); err != nil {
+						return nil, err
+					}
+				}
+				continue
+			}
+			if item != "" {
+				if err := setInventoryField(current, item, number); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		if current == nil || indent <= itemIndent {
+			// Only the key holding the sequence may precede it
+			if key, value, _ := strings.Cut(trimmed, ":"); current == nil && strings.TrimSpace(key) == "servers" && strings.TrimSpace(value) == "" {
+				continue
+			}
+			return nil, errors.NewValidationError(fmt.Sprintf("line %d: expected a list of servers with key and name", number), nil)
+		}
+		if err := setInventoryField(current, trimmed, number); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, entry := range entries {
+		if entry.Key == "" {
+			return nil, errors.NewValidationError(fmt.Sprintf("line %d: server without key", entry.Line), nil)
+		}
+	}
+	return entries, nil
+}
+
+// setInventoryField sets the field of a key: value pair of a YAML server
+func setInventoryField(entry *InventoryEntry, field string, line int) error {
+	key, value, ok := strings.Cut(field, ":")
+	if !ok {
+		return errors.NewValidationError(fmt.Sprintf("line %d: expected key: value", line), nil)
+	}
+	scalar, err := unquoteInventoryScalar(strings.TrimSpace(value))
+	if err != nil {
+		return errors.NewValidationError(fmt.Sprintf("line %d: %v", line, err), nil)
+	}
+
+	switch strings.TrimSpace(key) {
+	case "key", "server_id":
+		entry.Key = scalar
+	case "name":
+		entry.Name = scalar
+	default:
+		// Other fields, such as notes kept next to the servers, are ignored
+	}
+	return nil
+}
+
+// unquoteInventoryScalar returns the value of a plain, single or double quoted YAML scalar
+func unquoteInventoryScalar(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return "", fmt.Errorf("malformed double-quoted string %s", value)
+		}
+		return unquoted, nil
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return "", fmt.Errorf("malformed single-quoted string %s", value)
+		}
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	}
+	return value, nil
+}
+
+// stripInventoryComment removes a comment from a YAML line, keeping # inside quotes
+func stripInventoryComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// Import adds the servers of an inventory to a user and gives them the names of the file.
+// Servers the user already has are only renamed.
+func (s *InventoryService) Import(ctx context.Context, userID, telegramID int64, username, firstName string, entries []InventoryEntry) (*ImportReport, error) {
+	servers, err := s.users.GetUserServers(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]models.ServerWithDetails, len(servers))
+	for _, server := range servers {
+		existing[server.ID] = server
+	}
+
+	report := &ImportReport{}
+	for _, entry := range entries {
+		server, owned := existing[entry.Key]
+		if !owned {
+			started := time.Now()
+			err := s.users.AddServerToUser(ctx, userID, entry.Key, inventorySource)
+			s.audit.RecordResult(ctx, userID, telegramID, entry.Key, AuditCommandAddServer, "source=import", "", started, err)
+			if err != nil {
+				s.logger.Warn("Failed to import server", "error", err, "server_id", entry.Key, "user_id", userID)
+				report.Failed = append(report.Failed, InventoryFailure{Line: entry.Line, Key: entry.Key, Reason: importFailureReason(err)})
+				continue
+			}
+			if err := s.users.AddTelegramIdentifierToServer(ctx, userID, entry.Key, strconv.FormatInt(telegramID, 10), username, firstName); err != nil {
+				s.logger.Warn("Failed to add Telegram identifier to server", "error", err, "server_id", entry.Key, "telegram_id", telegramID)
+			}
+			report.Added = append(report.Added, entry.Key)
+		}
+
+		if entry.Name == "" || (owned && server.Name == entry.Name) {
+			if owned {
+				report.Unchanged = append(report.Unchanged, entry.Key)
+			}
+			continue
+		}
+
+		started := time.Now()
+		err := s.users.UpdateServerName(ctx, userID, entry.Key, entry.Name)
+		s.audit.RecordResult(ctx, userID, telegramID, entry.Key, AuditCommandRenameServer, "name="+entry.Name, "", started, err)
+		if err != nil {
+			s.logger.Warn("Failed to name imported server", "error", err, "server_id", entry.Key, "user_id", userID)
+			report.Failed = append(report.Failed, InventoryFailure{Line: entry.Line, Key: entry.Key, Reason: "не удалось задать имя"})
+			continue
+		}
+		if owned {
+			report.Renamed = append(report.Renamed, entry.Key)
+		}
+	}
+
+	s.logger.Info("Servers imported", "user_id", userID, "added", len(report.Added), "renamed", len(report.Renamed), "failed", len(report.Failed))
+	return report, nil
+}
+
+// importFailureReason describes why a server could not be added
+func importFailureReason(err error) string {
+	switch {
+	case stderrors.Is(err, errors.ErrServerNotFound):
+		return "сервер не найден"
+	case stderrors.Is(err, errors.ErrInvalidKey):
+		return "неверный формат ключа"
+	case stderrors.Is(err, errors.ErrAPIUnavailable):
+		return "не удалось проверить сервер, повторите позже"
+	}
+	return "не удалось добавить"
+}
+
+// FormatImportReport formats the summary of an import, listing the failed servers with
+// the lines of the file they are on
+func FormatImportReport(report *ImportReport, invalid []InventoryFailure) string {
+	failed := append(append([]InventoryFailure(nil), invalid...), report.Failed...)
+
+	var sb strings.Builder
+	sb.WriteString("📥 Импорт серверов\n\n")
+	sb.WriteString(fmt.Sprintf("✅ Добавлено: %d\n", len(report.Added)))
+	sb.WriteString(fmt.Sprintf("✏️ Переименовано: %d\n", len(report.Renamed)))
+	sb.WriteString(fmt.Sprintf("➖ Без изменений: %d\n", len(report.Unchanged)))
+	sb.WriteString(fmt.Sprintf("❌ Ошибок: %d\n", len(failed)))
+
+	const maxListed = 20
+	if len(failed) > 0 {
+		sb.WriteString("\n")
+		for i, failure := range failed {
+			if i == maxListed {
+				sb.WriteString(fmt.Sprintf("…и еще %d\n", len(failed)-maxListed))
+				break
+			}
+			sb.WriteString(fmt.Sprintf("• строка %d, %s: %s\n", failure.Line, failure.Key, failure.Reason))
+		}
+	}
+
+	if len(report.Added) > 0 {
+		sb.WriteString("\nИспользуйте /servers для просмотра всех ваших серверов.")
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// Export returns the servers of a user as an inventory file of a format, which Import accepts
+func (s *InventoryService) Export(ctx context.Context, userID int64, format string) ([]byte, int, error) {
+	servers, err := s.users.GetUserServers(ctx, userID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	data, err := EncodeInventory(servers, format)
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, len(servers), nil
+}
+
+// EncodeInventory encodes servers as an inventory file of a format
+func EncodeInventory(servers []models.ServerWithDetails, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case InventoryCSV:
+		w := csv.NewWriter(&buf)
+		_ = w.Write([]string{"key", "name"})
+		for _, server := range servers {
+			_ = w.Write([]string{server.ID, server.Name})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return nil, err
+		}
+
+	case InventoryYAML:
+		buf.WriteString("servers:\n")
+		for _, server := range servers {
+			buf.WriteString(fmt.Sprintf("  - key: %s\n    name: %s\n", strconv.Quote(server.ID), strconv.Quote(server.Name)))
+		}
+
+	default:
+		return nil, errors.NewValidationError(fmt.Sprintf("unsupported inventory format %q", format), nil)
+	}
+	return buf.Bytes(), nil
+}
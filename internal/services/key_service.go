@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	stderrors "errors"
+	"fmt"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/api"
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/repository"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// Key states reported to agents on heartbeat
+const (
+	KeyStatusCurrent = "current" // the agent uses the current key
+	KeyStatusRotate  = "rotate"  // the agent must switch to the returned key
+	KeyStatusRotated = "rotated" // the agent switched to the new key, the rotation is complete
+)
+
+// KeyHeartbeat is the reply to an agent checking its key
+type KeyHeartbeat struct {
+	Status  string
+	Key     string // key to switch to, set for KeyStatusRotate
+	Version int
+	Server  *models.ServerKey
+}
+
+// KeyService rotates the keys server agents authenticate with. A new key is pending until
+// the agent picks it up on heartbeat and then replaces the old key, which stays valid for
+// a grace window.
+type KeyService struct {
+	repo   repository.KeyStore
+	audit  *AuditService
+	grace  time.Duration
+	logger Logger
+}
+
+// NewKeyService creates a new key rotation service. Replaced keys stay valid for grace.
+func NewKeyService(repo repository.KeyStore, audit *AuditService, grace time.Duration, logger Logger) *KeyService {
+	return &KeyService{
+		repo:   repo,
+		audit:  audit,
+		grace:  grace,
+		logger: logger,
+	}
+}
+
+// Rotate issues a new key for a server on behalf of a user. The agent picks it up on its next heartbeat.
+func (s *KeyService) Rotate(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails) error {
+	if err := Authorize(server, PermRotateKey); err != nil {
+		return err
+	}
+	started := time.Now()
+
+	key, err := randomServerKey()
+	if err != nil {
+		return err
+	}
+
+	err = s.repo.SetPendingServerKey(ctx, server.ID, key, telegramID)
+	s.audit.RecordResult(ctx, userID, telegramID, server.ID, AuditCommandRotateKey, "", "", started, err)
+	if err != nil {
+		if stderrors.Is(err, sql.ErrNoRows) {
+			return errors.NewNotFoundError(fmt.Sprintf("server '%s'", server.ID))
+		}
+		s.logger.Error("Failed to issue server key", "error", err, "server_id", server.ID)
+		return err
+	}
+
+	s.logger.Info("Server key rotation requested", "server_id", server.ID, "user_id", userID)
+	return nil
+}
+
+// Heartbeat reports to an agent whether it has to switch keys. An agent presenting
+// the pending key completes the rotation.
+func (s *KeyService) Heartbeat(ctx context.Context, key string, now time.Time) (*KeyHeartbeat, error) {
+	if err := api.ValidateServerID(key); err != nil {
+		return nil, err
+	}
+
+	current, err := s.repo.GetServerKey(ctx, key)
+	if err != nil {
+		if stderrors.Is(err, sql.ErrNoRows) {
+			return nil, errors.NewNotFoundError("server key")
+		}
+		return nil, err
+	}
+
+	switch key {
+	case current.PendingKey:
+		rotated, err := s.repo.PromoteServerKey(ctx, current.ServerID, now.Add(s.grace))
+		if err != nil {
+			s.logger.Error("Failed to promote server key", "error", err, "server_id", current.ServerID)
+			return nil, err
+		}
+		s.logger.Info("Server key rotated", "server_id", rotated.ServerID, "key_version", rotated.Version)
+		return &KeyHeartbeat{Status: KeyStatusRotated, Version: rotated.Version, Server: rotated}, nil
+
+	case current.Key:
+		if current.PendingKey != "" {
+			return &KeyHeartbeat{Status: KeyStatusRotate, Key: current.PendingKey, Version: current.Version + 1, Server: current}, nil
+		}
+		return &KeyHeartbeat{Status: KeyStatusCurrent, Version: current.Version, Server: current}, nil
+
+	default:
+		// A replaced key within its grace window, e.g. a second agent instance that missed the switch
+		if current.PreviousExpiresAt == nil || !current.PreviousExpiresAt.After(now) {
+			return nil, errors.NewNotFoundError("server key")
+		}
+		return &KeyHeartbeat{Status: KeyStatusRotate, Key: current.Key, Version: current.Version, Server: current}, nil
+	}
+}
+
+// Known reports whether a key belongs to a server: it is current, pending or replaced within its grace window
+func (s *KeyService) Known(ctx context.Context, key string, now time.Time) bool {
+	current, err := s.repo.GetServerKey(ctx, key)
+	if err != nil {
+		if !stderrors.Is(err, sql.ErrNoRows) {
+			s.logger.Error("Failed to look up server key", "error", err)
+		}
+		return false
+	}
+
+	if key == current.Key || key == current.PendingKey {
+		return true
+	}
+	return current.PreviousExpiresAt != nil && current.PreviousExpiresAt.After(now)
+}
+
+// Cleanup invalidates replaced keys whose grace window has ended
+func (s *KeyService) Cleanup(ctx context.Context, now time.Time) error {
+	expired, err := s.repo.ExpirePreviousServerKeys(ctx, now)
+	if err != nil {
+		return err
+	}
+	if expired > 0 {
+		s.logger.Info("Replaced server keys invalidated", "count", expired)
+	}
+	return nil
+}
+
+// Grace returns how long replaced keys stay valid
+func (s *KeyService) Grace() time.Duration {
+	return s.grace
+}
+
+// randomServerKey generates a new random srv_ key
+func randomServerKey() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "srv_" + hex.EncodeToString(buf), nil
+}
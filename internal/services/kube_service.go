@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/pkg/docker"
+	"github.com/servereye/servereyebot/pkg/errors"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// maxListedPods bounds the pods shown in one message
+const maxListedPods = 50
+
+// kubeNamespacePattern matches Kubernetes namespace names, which are DNS labels
+var kubeNamespacePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// KubeService shows the Kubernetes nodes and pods seen by agents running on cluster nodes
+type KubeService struct {
+	docker *docker.Client
+	logger Logger
+}
+
+// NewKubeService creates a new Kubernetes service
+func NewKubeService(dockerClient *docker.Client, logger Logger) *KubeService {
+	return &KubeService{
+		docker: dockerClient,
+		logger: logger,
+	}
+}
+
+// Pods retrieves the nodes and the pods of a namespace, or of all namespaces when it is
+// empty, on behalf of a user
+func (s *KubeService) Pods(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails, namespace string) (*protocol.PodListResponse, error) {
+	if namespace != "" && !kubeNamespacePattern.MatchString(namespace) {
+		return nil, errors.NewValidationError("invalid namespace", map[string]interface{}{"namespace": namespace})
+	}
+
+	pods, err := s.docker.ListPods(WithActor(ctx, userID, telegramID), server.ServerKey, namespace)
+	if err != nil {
+		s.logger.Error("Failed to list pods", "error", err, "server_key", server.ServerKey, "namespace", namespace)
+		return nil, err
+	}
+	return pods, nil
+}
+
+// FormatPods formats the nodes and pods seen from a server. Pods that are not healthy
+// are listed first.
+func (s *KubeService) FormatPods(server *models.ServerWithDetails, pods *protocol.PodListResponse, namespace string, now time.Time) string {
+	if !pods.Available {
+		return fmt.Sprintf("☸️ Агент %s(%s) не имеет доступа к Kubernetes.\n\nЗапустите агент в кластере с сервисным аккаунтом или на узле с настроенным kubectl.", server.Name, server.ID)
+	}
+
+	var sb strings.Builder
+	scope := "все пространства имен"
+	if namespace != "" {
+		scope = namespace
+	}
+	sb.WriteString(fmt.Sprintf("☸️ Kubernetes с %s(%s), %s\n", server.Name, server.ID, scope))
+
+	if len(pods.Nodes) > 0 {
+		sb.WriteString(fmt.Sprintf("\nУзлы (%d):\n", len(pods.Nodes)))
+		for _, node := range pods.Nodes {
+			icon, status := "🟢", "Ready"
+			if !node.Ready {
+				icon, status = "🔴", "NotReady"
+			}
+			if len(node.Conditions) > 0 {
+				if node.Ready {
+					icon = "🟠"
+				}
+				status += ", " + strings.Join(node.Conditions, ", ")
+			}
+			sb.WriteString(fmt.Sprintf("%s %s — %s", icon, node.Name, status))
+			if node.Version != "" {
+				sb.WriteString(" (" + node.Version + ")")
+			}
+			sb.WriteString("\n")
+		}
+	}
+
+	list := append([]protocol.KubePod(nil), pods.Pods...)
+	sort.SliceStable(list, func(i, j int) bool {
+		if podHealthy(list[i]) != podHealthy(list[j]) {
+			return !podHealthy(list[i])
+		}
+		if list[i].Namespace != list[j].Namespace {
+			return list[i].Namespace < list[j].Namespace
+		}
+		return list[i].Name < list[j].Name
+	})
+
+	unhealthy := 0
+	for _, pod := range list {
+		if !podHealthy(pod) {
+			unhealthy++
+		}
+	}
+	sb.WriteString(fmt.Sprintf("\nПоды (%d, с проблемами %d):\n", len(list), unhealthy))
+	if len(list) == 0 {
+		sb.WriteString("Подов нет.\n")
+	}
+
+	for i, pod := range list {
+		if i == maxListedPods {
+			sb.WriteString(fmt.Sprintf("… и еще %d\n", len(list)-maxListedPods))
+			break
+		}
+
+		icon := "🟢"
+		switch {
+		case pod.Phase == "Succeeded":
+			icon = "⚪"
+		case !podHealthy(pod):
+			icon = "🔴"
+		case pod.Restarts > 0:
+			icon = "🟡"
+		}
+
+		name := pod.Name
+		if namespace == "" {
+			name = pod.Namespace + "/" + pod.Name
+		}
+		status := pod.Phase
+		if pod.Reason != "" {
+			status = pod.Reason
+		}
+		sb.WriteString(fmt.Sprintf("%s %s — %s, %d/%d", icon, name, status, pod.Ready, pod.Containers))
+		if pod.Restarts > 0 {
+			sb.WriteString(fmt.Sprintf(", перезапусков: %d", pod.Restarts))
+		}
+		if !pod.StartedAt.IsZero() {
+			sb.WriteString(", " + formatAge(now.Sub(pod.StartedAt)))
+		}
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString(fmt.Sprintf("\n🕐 %s UTC", now.UTC().Format("15:04:05")))
+	return sb.String()
+}
+
+// podHealthy reports whether a pod completed or runs with all its containers ready
+func podHealthy(pod protocol.KubePod) bool {
+	switch pod.Phase {
+	case "Succeeded":
+		return true
+	case "Running":
+		return pod.Reason == "" && pod.Ready == pod.Containers
+	default:
+		return false
+	}
+}
@@ -0,0 +1,287 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/repository"
+	"github.com/servereye/servereyebot/pkg/docker"
+	"github.com/servereye/servereyebot/pkg/errors"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// AlertCategoryLogs categorizes alerts about lines matched in watched log files
+const AlertCategoryLogs = "logs"
+
+const (
+	// maxLogWatches bounds the log watches of a server
+	maxLogWatches = 20
+
+	// maxLogWatchField bounds the length of the path and the pattern of a log watch
+	maxLogWatchField = 255
+
+	// logMatchAlertWindow is the window alerts of a log watch are counted in
+	logMatchAlertWindow = 10 * time.Minute
+
+	// logMatchAlertLimit bounds the alerts of a log watch within logMatchAlertWindow
+	logMatchAlertLimit = 3
+
+	// logMatchDedupWindow is how long a line already alerted on is not alerted on again
+	logMatchDedupWindow = time.Hour
+
+	// logMatchLines bounds the lines quoted in one alert
+	logMatchLines = 5
+
+	// maxLogMatchLine bounds the length of a quoted line
+	maxLogMatchLine = 300
+)
+
+// logMatchState tracks the alerts of a log watch for rate limiting and deduplication
+type logMatchState struct {
+	windowStart time.Time
+	alerts      int                  // alerts sent since windowStart
+	suppressed  int                  // matching lines dropped by the rate limit since the last alert
+	seen        map[string]time.Time // line -> when it was last alerted on
+}
+
+// LogWatchService manages log watches. Watches are stored by the bot and pushed to
+// agents, which tail the files and report new lines matching the patterns. Reported
+// lines reach the owner of the watch as alerts, without repeating a line within
+// logMatchDedupWindow and at most logMatchAlertLimit times per logMatchAlertWindow.
+type LogWatchService struct {
+	repo   repository.LogWatchStore
+	keys   repository.KeyStore
+	docker *docker.Client
+	logger Logger
+
+	mu    sync.Mutex
+	state map[int64]*logMatchState // watch ID -> alert state
+}
+
+// NewLogWatchService creates a new log watch service
+func NewLogWatchService(repo repository.LogWatchStore, keys repository.KeyStore, dockerClient *docker.Client, logger Logger) *LogWatchService {
+	return &LogWatchService{
+		repo:   repo,
+		keys:   keys,
+		docker: dockerClient,
+		logger: logger,
+		state:  make(map[int64]*logMatchState),
+	}
+}
+
+// Add stores a log watch and pushes the watches of the server to its agent. Only owners
+// may add watches. An agent that cannot be reached picks the watch up when it next
+// fetches its watches, which is reported by synced.
+func (s *LogWatchService) Add(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails, file, pattern string) (watch *models.LogWatch, synced bool, err error) {
+	if err := Authorize(server, PermLogWatch); err != nil {
+		return nil, false, err
+	}
+	if !path.IsAbs(file) || path.Clean(file) != file || len(file) > maxLogWatchField {
+		return nil, false, errors.NewValidationError("invalid log file path", map[string]interface{}{"path": file})
+	}
+	if _, err := regexp.Compile(pattern); err != nil || pattern == "" || len(pattern) > maxLogWatchField {
+		return nil, false, errors.NewValidationError("invalid log pattern", map[string]interface{}{"pattern": pattern})
+	}
+
+	watches, err := s.repo.ListLogWatches(ctx, server.ID)
+	if err != nil {
+		s.logger.Error("Failed to list log watches", "error", err, "server_id", server.ID)
+		return nil, false, err
+	}
+	if len(watches) >= maxLogWatches {
+		return nil, false, errors.NewValidationError("too many log watches", map[string]interface{}{"server_id": server.ID, "max": maxLogWatches})
+	}
+
+	watch = &models.LogWatch{ServerID: server.ID, Path: file, Pattern: pattern, CreatedBy: telegramID}
+	if err := s.repo.AddLogWatch(ctx, watch); err != nil {
+		s.logger.Error("Failed to store log watch", "error", err, "server_id", server.ID, "path", file)
+		return nil, false, err
+	}
+
+	s.logger.Info("Log watch added", "server_id", server.ID, "watch_id", watch.ID, "path", file)
+	return watch, s.push(WithActor(ctx, userID, telegramID), server), nil
+}
+
+// Remove deletes a log watch of a server, reporting whether it existed
+func (s *LogWatchService) Remove(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails, id int64) (removed, synced bool, err error) {
+	if err := Authorize(server, PermLogWatch); err != nil {
+		return false, false, err
+	}
+
+	removed, err = s.repo.DeleteLogWatch(ctx, server.ID, id)
+	if err != nil {
+		s.logger.Error("Failed to remove log watch", "error", err, "server_id", server.ID, "watch_id", id)
+		return false, false, err
+	}
+	if !removed {
+		return false, true, nil
+	}
+
+	s.mu.Lock()
+	delete(s.state, id)
+	s.mu.Unlock()
+
+	s.logger.Info("Log watch removed", "server_id", server.ID, "watch_id", id)
+	return true, s.push(WithActor(ctx, userID, telegramID), server), nil
+}
+
+// List retrieves the log watches of a server
+func (s *LogWatchService) List(ctx context.Context, serverID string) ([]models.LogWatch, error) {
+	return s.repo.ListLogWatches(ctx, serverID)
+}
+
+// ForAgent returns the log watches the agent with the given key has to tail
+func (s *LogWatchService) ForAgent(ctx context.Context, serverKey string) ([]protocol.LogWatch, error) {
+	key, err := s.keys.GetServerKey(ctx, serverKey)
+	if err != nil {
+		return nil, err
+	}
+
+	watches, err := s.repo.ListLogWatches(ctx, key.ServerID)
+	if err != nil {
+		return nil, err
+	}
+	return agentLogWatches(watches), nil
+}
+
+// Matched turns the matching lines reported by the agent with the given key into alerts
+// for the owners of the watches. Lines of unknown watches, repeated lines and lines over
+// the rate limit are dropped; dropped lines are counted in the next alert of the watch.
+func (s *LogWatchService) Matched(ctx context.Context, serverKey string, report protocol.LogMatchReport, now time.Time) ([]AlertNotification, error) {
+	key, err := s.keys.GetServerKey(ctx, serverKey)
+	if err != nil {
+		return nil, err
+	}
+
+	watches, err := s.repo.ListLogWatches(ctx, key.ServerID)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make(map[int64][]string)
+	for _, match := range report.Matches {
+		lines[match.WatchID] = append(lines[match.WatchID], strings.TrimSpace(match.Line))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var notifications []AlertNotification
+	for _, watch := range watches {
+		if len(lines[watch.ID]) == 0 {
+			continue
+		}
+
+		state := s.state[watch.ID]
+		if state == nil {
+			state = &logMatchState{seen: make(map[string]time.Time)}
+			s.state[watch.ID] = state
+		}
+		for line, at := range state.seen {
+			if now.Sub(at) >= logMatchDedupWindow {
+				delete(state.seen, line)
+			}
+		}
+
+		var fresh []string
+		for _, line := range lines[watch.ID] {
+			if _, ok := state.seen[line]; ok || line == "" {
+				continue
+			}
+			state.seen[line] = now
+			fresh = append(fresh, line)
+		}
+		if len(fresh) == 0 {
+			continue
+		}
+
+		if now.Sub(state.windowStart) >= logMatchAlertWindow {
+			state.windowStart = now
+			state.alerts = 0
+		}
+		if state.alerts >= logMatchAlertLimit {
+			state.suppressed += len(fresh)
+			continue
+		}
+		state.alerts++
+
+		notifications = append(notifications, AlertNotification{
+			TelegramID: watch.CreatedBy,
+			ServerIDs:  []string{watch.ServerID},
+			Category:   AlertCategoryLogs,
+			Text:       formatLogMatches(watch, fresh, state.suppressed),
+		})
+		state.suppressed = 0
+	}
+
+	if len(notifications) > 0 {
+		s.logger.Info("Log matches reported", "server_id", key.ServerID, "matches", len(report.Matches), "alerts", len(notifications))
+	}
+	return notifications, nil
+}
+
+// push sends the log watches of a server to its agent, reporting whether it applied them
+func (s *LogWatchService) push(ctx context.Context, server *models.ServerWithDetails) bool {
+	watches, err := s.repo.ListLogWatches(ctx, server.ID)
+	if err != nil {
+		s.logger.Error("Failed to list log watches", "error", err, "server_id", server.ID)
+		return false
+	}
+
+	if _, err := s.docker.SetLogWatches(ctx, server.ServerKey, agentLogWatches(watches)); err != nil {
+		s.logger.Warn("Failed to push log watches to agent", "error", err, "server_id", server.ID)
+		return false
+	}
+	return true
+}
+
+// agentLogWatches converts stored log watches to the watches sent to agents
+func agentLogWatches(watches []models.LogWatch) []protocol.LogWatch {
+	result := make([]protocol.LogWatch, 0, len(watches))
+	for _, watch := range watches {
+		result = append(result, protocol.LogWatch{ID: watch.ID, Path: watch.Path, Pattern: watch.Pattern})
+	}
+	return result
+}
+
+// formatLogMatches formats an alert quoting the new matching lines of a log watch
+func formatLogMatches(watch models.LogWatch, lines []string, suppressed int) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("📜 %s на сервере %s: строки по шаблону %s\n\n", watch.Path, watch.ServerID, watch.Pattern))
+	for i, line := range lines {
+		if i == logMatchLines {
+			sb.WriteString(fmt.Sprintf("… и еще %d\n", len(lines)-logMatchLines))
+			break
+		}
+		if utf8.RuneCountInString(line) > maxLogMatchLine {
+			line = string([]rune(line)[:maxLogMatchLine]) + "…"
+		}
+		sb.WriteString(line + "\n")
+	}
+	if suppressed > 0 {
+		sb.WriteString(fmt.Sprintf("\nС прошлого алерта пропущено совпадений: %d", suppressed))
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// FormatLogWatches formats the log watches of a server
+func FormatLogWatches(server *models.ServerWithDetails, watches []models.LogWatch) string {
+	if len(watches) == 0 {
+		return fmt.Sprintf("📜 На %s(%s) нет отслеживаемых логов.\n\nДобавить: /logwatch %s add /var/log/syslog OOM", server.Name, server.ID, server.ID)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("📜 Отслеживаемые логи %s(%s):\n\n", server.Name, server.ID))
+	for _, watch := range watches {
+		sb.WriteString(fmt.Sprintf("#%d %s — %s\n", watch.ID, watch.Path, watch.Pattern))
+	}
+	sb.WriteString(fmt.Sprintf("\nУдалить: /logwatch %s remove <id>", server.ID))
+	return sb.String()
+}
@@ -2,22 +2,49 @@ package services
 
 import (
 	"context"
+	"embed"
+	"encoding/json"
 	"fmt"
 	"sort"
 	"strings"
-	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/servereye/servereyebot/internal/api"
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/render"
+	"github.com/servereye/servereyebot/pkg/docker"
 	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+	"github.com/servereye/servereyebot/pkg/protocol"
 )
 
 // MetricsServiceImpl implements ServerMetricsService
 type MetricsServiceImpl struct {
-	apiClient  *api.Client
-	cache      map[string]*domain.MetricsCache
-	cacheMutex sync.RWMutex
-	logger     Logger
+	apiClient    *api.Client
+	cache        MetricsCache
+	cacheTTL     time.Duration
+	typeTTLs     map[string]time.Duration
+	fetchTimeout atomic.Int64 // time.Duration, changed by configuration reloads
+	history      MetricsRecorder
+	docker       *docker.Client // nil until UseAgent, agent commands such as GPU readings fail
+	lastKnownTTL time.Duration  // how long fetched metrics are kept for LastKnownMetrics
+	severity     atomic.Pointer[severityThresholds]
+	logger       Logger
+}
+
+// MetricsCache stores fetched metrics by server key. Backed by Redis, it is shared by all
+// bot instances.
+type MetricsCache interface {
+	Get(ctx context.Context, serverKey string) (*domain.MetricsCache, error) // nil when none are cached
+	Set(ctx context.Context, metrics *domain.MetricsCache, ttl time.Duration) error
+	Delete(ctx context.Context, serverKeys ...string) error
+	Clear(ctx context.Context) error
+}
+
+// MetricsRecorder accepts metric samples for historical storage
+type MetricsRecorder interface {
+	Add(samples ...models.MetricSample)
 }
 
 // Logger interface for metrics service
@@ -28,22 +55,48 @@ type Logger interface {
 	Error(msg string, fields ...interface{})
 }
 
-// NewMetricsService creates a new metrics service
-func NewMetricsService(apiClient *api.Client, logger Logger) *MetricsServiceImpl {
-	return &MetricsServiceImpl{
+// NewMetricsService creates a new metrics service.
+// Fetched metrics are recorded to history unless it is nil. Metric commands are served
+// from cache for the TTL of their metric type in typeTTLs, or cacheTTL otherwise.
+func NewMetricsService(apiClient *api.Client, fetchTimeout time.Duration, cache MetricsCache, cacheTTL time.Duration, typeTTLs map[string]time.Duration, history MetricsRecorder, logger Logger) *MetricsServiceImpl {
+	s := &MetricsServiceImpl{
 		apiClient: apiClient,
-		cache:     make(map[string]*domain.MetricsCache),
+		cache:     cache,
+		cacheTTL:  cacheTTL,
+		typeTTLs:  typeTTLs,
+		history:   history,
 		logger:    logger,
 	}
+	s.fetchTimeout.Store(int64(fetchTimeout))
+	s.severity.Store(&severityThresholds{warningRatio: defaultWarningRatio})
+	return s
 }
 
-// GetServerMetrics retrieves server metrics directly from API (no cache)
+// UseAgent retrieves the metrics the API does not collect, such as GPU readings, with
+// commands to server agents through dockerClient
+func (s *MetricsServiceImpl) UseAgent(dockerClient *docker.Client) {
+	s.docker = dockerClient
+}
+
+// KeepLastKnown keeps fetched metrics for ttl, however short their cache TTL, so that
+// LastKnownMetrics can answer while a server is unreachable
+func (s *MetricsServiceImpl) KeepLastKnown(ttl time.Duration) {
+	s.lastKnownTTL = ttl
+}
+
+// SetFetchTimeout changes the time metrics retrieval may take including retries
+func (s *MetricsServiceImpl) SetFetchTimeout(timeout time.Duration) {
+	s.fetchTimeout.Store(int64(timeout))
+}
+
+// GetServerMetrics retrieves server metrics directly from API, bypassing the cache. The
+// metrics are cached for later metric commands.
 func (s *MetricsServiceImpl) GetServerMetrics(serverKey string) (*domain.LegacyMetricsResponse, error) {
 	fmt.Printf("=== GETTING FRESH METRICS FROM API ===\n")
 	s.logger.Info("Getting fresh server metrics from API", "server_key", serverKey)
 
 	// Fetch from API
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.fetchTimeout.Load()))
 	defer cancel()
 
 	metrics, err := s.apiClient.GetServerMetrics(ctx, serverKey)
@@ -52,121 +105,247 @@ func (s *MetricsServiceImpl) GetServerMetrics(serverKey string) (*domain.LegacyM
 		return nil, err
 	}
 
+	if s.history != nil {
+		s.history.Add(metricSamples(serverKey, &metrics.Metrics)...)
+	}
+
 	// Convert new API structure to legacy format for compatibility
 	legacyMetrics := s.convertToLegacyMetrics(metrics)
 
+	// Keep the metrics as long as the longest TTL, shorter ones expire on reading
+	if ttl := max(s.maxCacheTTL(), s.lastKnownTTL); ttl > 0 {
+		entry := &domain.MetricsCache{ServerKey: serverKey, Metrics: legacyMetrics, FetchedAt: time.Now()}
+		if err := s.cache.Set(ctx, entry, ttl); err != nil {
+			s.logger.Warn("Failed to cache server metrics", "error", err, "server_key", serverKey)
+		}
+	}
+
 	fmt.Printf("=== METRICS CONVERTED SUCCESSFULLY ===\n")
 	s.logger.Info("Server metrics retrieved and converted successfully", "server_key", serverKey)
 	return legacyMetrics, nil
 }
 
-// FormatCPU formats CPU metrics for display
+// GetCachedMetrics retrieves server metrics for a metric type, from the cache while they
+// are younger than the TTL of the type unless refresh is set. It also returns when the
+// metrics were fetched.
+func (s *MetricsServiceImpl) GetCachedMetrics(serverKey, metricType string, refresh bool) (*domain.LegacyMetricsResponse, time.Time, error) {
+	if !refresh && s.CacheTTL(metricType) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.fetchTimeout.Load()))
+		entry, err := s.cache.Get(ctx, serverKey)
+		cancel()
+
+		// An unavailable cache only costs a fetch
+		if err != nil {
+			s.logger.Warn("Failed to read cached server metrics", "error", err, "server_key", serverKey)
+		} else if entry != nil && time.Since(entry.FetchedAt) < s.CacheTTL(metricType) {
+			s.logger.Debug("Serving cached server metrics", "server_key", serverKey, "type", metricType, "fetched_at", entry.FetchedAt)
+			return entry.Metrics, entry.FetchedAt, nil
+		}
+	}
+
+	fetchedAt := time.Now()
+	metrics, err := s.GetServerMetrics(serverKey)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return metrics, fetchedAt, nil
+}
+
+// LastKnownMetrics retrieves the latest metrics fetched from a server however old they
+// are, to answer with while the server cannot be reached. It returns nil metrics when
+// none are kept.
+func (s *MetricsServiceImpl) LastKnownMetrics(serverKey string) (*domain.LegacyMetricsResponse, time.Time, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.fetchTimeout.Load()))
+	defer cancel()
+
+	entry, err := s.cache.Get(ctx, serverKey)
+	if err != nil || entry == nil {
+		return nil, time.Time{}, err
+	}
+	return entry.Metrics, entry.FetchedAt, nil
+}
+
+// CacheTTL returns how long metrics are served from the cache for a metric type
+func (s *MetricsServiceImpl) CacheTTL(metricType string) time.Duration {
+	if ttl, ok := s.typeTTLs[metricType]; ok {
+		return ttl
+	}
+	return s.cacheTTL
+}
+
+// maxCacheTTL returns the longest TTL of any metric type
+func (s *MetricsServiceImpl) maxCacheTTL() time.Duration {
+	ttl := s.cacheTTL
+	for _, typeTTL := range s.typeTTLs {
+		if typeTTL > ttl {
+			ttl = typeTTL
+		}
+	}
+	return ttl
+}
+
+// FormatMetricsAge formats how long ago metrics were fetched, in MarkdownV2
+func FormatMetricsAge(fetchedAt, now time.Time) string {
+	age := now.Sub(fetchedAt)
+	if age < time.Minute {
+		return string(render.Italic(fmt.Sprintf("🕒 Данные получены %d с назад", int(age.Seconds()))))
+	}
+	return string(render.Italic(fmt.Sprintf("🕒 Данные получены %s назад", formatAge(age))))
+}
+
+// FormatLastKnownAge labels metrics kept from before a server became unreachable with
+// when they were fetched, in MarkdownV2. Times are shown in loc, or UTC when nil.
+func FormatLastKnownAge(fetchedAt, now time.Time, loc *time.Location) string {
+	zone := ""
+	if loc == nil {
+		loc, zone = time.UTC, " UTC"
+	}
+
+	at := fetchedAt.In(loc)
+	layout := "15:04"
+	if now.In(loc).Format("2006-01-02") != at.Format("2006-01-02") {
+		layout = "02.01 15:04"
+	}
+	return string(render.Italic(fmt.Sprintf("⚠️ Сервер недоступен. Последние известные данные на %s%s (%s назад)", at.Format(layout), zone, formatAge(now.Sub(fetchedAt)))))
+}
+
+//go:embed templates/metrics.tmpl
+var metricTemplateFiles embed.FS
+
+// metricTemplates render the messages of metric commands
+var metricTemplates = render.Must(render.ParseFS(metricTemplateFiles, "templates/metrics.tmpl"))
+
+// maxListedInterfaces limits the network interfaces listed by FormatNetwork
+const maxListedInterfaces = 5
+
+// renderMetrics renders a metric template, falling back to a plain error line
+func (s *MetricsServiceImpl) renderMetrics(name string, data interface{}, unavailable string) string {
+	text, err := metricTemplates.Execute(name, data)
+	if err != nil {
+		s.logger.Error("Failed to render metrics", "error", err, "template", name)
+		return string(render.Text(unavailable))
+	}
+	return strings.TrimRight(string(text), "\n")
+}
+
+// memoryData adds the total memory to metrics, which the new structure lacks
+type memoryData struct {
+	*domain.NewServerMetrics
+	MemoryTotalGB float64
+	Severity      severityIcons
+}
+
+// cpuData represents CPU metrics with the severity of their values
+type cpuData struct {
+	*domain.NewServerMetrics
+	Severity severityIcons
+}
+
+// legacyData represents metrics in the legacy structure with the severity of their values
+type legacyData struct {
+	*domain.ServerMetrics
+	Severity severityIcons
+}
+
+// summaryDisk represents the disk shown in the summary of all metrics
+type summaryDisk struct {
+	Path        string
+	UsedPercent int
+	UsedGB      float64
+	TotalGB     float64
+}
+
+// summaryData represents the summary of all metrics
+type summaryData struct {
+	memoryData
+	FirstDisk   *summaryDisk
+	UptimeHours int
+}
+
+// legacySummaryData represents the summary of all metrics in the legacy structure
+type legacySummaryData struct {
+	*domain.ServerMetrics
+	FirstDisk *domain.DiskDetails
+	Severity  severityIcons
+}
+
+// temperatureData represents temperatures together with the storage devices
+type temperatureData struct {
+	Details  domain.TemperatureDetails
+	Storage  []domain.StorageTemperature
+	Severity severityIcons
+}
+
+// legacyNetworkData represents network metrics with the busiest interfaces
+type legacyNetworkData struct {
+	domain.NetworkDetails
+	Interfaces []domain.NetworkInterfaceExtended
+}
+
+// FormatCPU formats CPU metrics for display, in MarkdownV2
 func (s *MetricsServiceImpl) FormatCPU(metrics *domain.ServerMetrics) string {
 	if metrics == nil {
-		return "❌ Метрики CPU недоступны"
+		return string(render.Text("❌ Метрики CPU недоступны"))
 	}
 
 	// Try to use new metrics structure first
+	severity := s.severityIcons(metrics)
 	if newMetrics, err := s.convertToNewMetrics(metrics); err == nil {
-		var sb strings.Builder
-		sb.WriteString(fmt.Sprintf("🖥️ Загрузка процессора: %.1f%%\n", newMetrics.CPUPercent))
-		sb.WriteString(fmt.Sprintf("- Load Average: %.2f, %.2f, %.2f\n",
-			newMetrics.LoadAverage.Min1,
-			newMetrics.LoadAverage.Min5,
-			newMetrics.LoadAverage.Min15))
-		sb.WriteString(fmt.Sprintf("- Процессы: %d (%d running)",
-			newMetrics.ProcessesTotal, newMetrics.ProcessesRunning))
-		return sb.String()
+		return s.renderMetrics("cpu", cpuData{NewServerMetrics: newMetrics, Severity: severity}, "❌ Метрики CPU недоступны")
 	}
 
 	// Fallback to legacy structure
-	var sb strings.Builder
-	sb.WriteString(fmt.Sprintf("🖥️ Загрузка процессора: %.1f%%\n", metrics.CPU))
-	sb.WriteString(fmt.Sprintf("- User: %.1f%%\n", metrics.CPUUsage.UsageUser))
-	sb.WriteString(fmt.Sprintf("- System: %.1f%%\n", metrics.CPUUsage.UsageSystem))
-	sb.WriteString(fmt.Sprintf("- Idle: %.1f%%\n", metrics.CPUUsage.UsageIdle))
-	sb.WriteString(fmt.Sprintf("- Load Average: %.2f, %.2f, %.2f\n",
-		metrics.CPUUsage.LoadAverage.Load1min,
-		metrics.CPUUsage.LoadAverage.Load5min,
-		metrics.CPUUsage.LoadAverage.Load15min))
-	sb.WriteString(fmt.Sprintf("- Ядра: %d @ %.1f MHz", metrics.CPUUsage.Cores, metrics.CPUUsage.Frequency))
-
-	return sb.String()
+	return s.renderMetrics("cpu_legacy", legacyData{ServerMetrics: metrics, Severity: severity}, "❌ Метрики CPU недоступны")
 }
 
-// FormatMemory formats memory metrics for display
+// FormatMemory formats memory metrics for display, in MarkdownV2
 func (s *MetricsServiceImpl) FormatMemory(metrics *domain.ServerMetrics) string {
 	if metrics == nil {
-		return "❌ Метрики памяти недоступны"
+		return string(render.Text("❌ Метрики памяти недоступны"))
 	}
 
 	// Try to use new metrics structure first
+	severity := s.severityIcons(metrics)
 	if newMetrics, err := s.convertToNewMetrics(metrics); err == nil {
-		var sb strings.Builder
-		sb.WriteString(fmt.Sprintf("💾 Память: %.1f%% использовано\n", newMetrics.MemoryPercent))
-		sb.WriteString(fmt.Sprintf("- Всего: %.1f GB\n", newMetrics.MemoryDetails.UsedGB+newMetrics.MemoryDetails.FreeGB+newMetrics.MemoryDetails.AvailableGB))
-		sb.WriteString(fmt.Sprintf("- Использовано: %.1f GB\n", newMetrics.MemoryDetails.UsedGB))
-		sb.WriteString(fmt.Sprintf("- Доступно: %.1f GB\n", newMetrics.MemoryDetails.AvailableGB))
-		sb.WriteString(fmt.Sprintf("- Свободно: %.1f GB\n", newMetrics.MemoryDetails.FreeGB))
-		sb.WriteString(fmt.Sprintf("- Кеш: %.1f GB\n", newMetrics.MemoryDetails.CachedGB))
-		sb.WriteString(fmt.Sprintf("- Буферы: %.1f GB", newMetrics.MemoryDetails.BuffersGB))
-		return sb.String()
+		data := newMemoryData(newMetrics)
+		data.Severity = severity
+		return s.renderMetrics("memory", data, "❌ Метрики памяти недоступны")
 	}
 
 	// Fallback to legacy structure
-	var sb strings.Builder
-	sb.WriteString(fmt.Sprintf("💾 Память: %.1f%% использовано\n", metrics.Memory))
-	sb.WriteString(fmt.Sprintf("- Всего: %.2f GB\n", metrics.MemoryDetails.TotalGB))
-	sb.WriteString(fmt.Sprintf("- Использовано: %.2f GB\n", metrics.MemoryDetails.UsedGB))
-	sb.WriteString(fmt.Sprintf("- Доступно: %.2f GB\n", metrics.MemoryDetails.AvailableGB))
-	sb.WriteString(fmt.Sprintf("- Свободно: %.2f GB", metrics.MemoryDetails.FreeGB))
+	return s.renderMetrics("memory_legacy", legacyData{ServerMetrics: metrics, Severity: severity}, "❌ Метрики памяти недоступны")
+}
 
-	return sb.String()
+// newMemoryData computes the total memory of metrics in the new structure
+func newMemoryData(metrics *domain.NewServerMetrics) memoryData {
+	return memoryData{
+		NewServerMetrics: metrics,
+		MemoryTotalGB:    metrics.MemoryDetails.UsedGB + metrics.MemoryDetails.FreeGB + metrics.MemoryDetails.AvailableGB,
+	}
 }
 
-// FormatDisk formats disk metrics for display
+// FormatDisk formats disk metrics for display, in MarkdownV2
 func (s *MetricsServiceImpl) FormatDisk(metrics *domain.ServerMetrics) string {
 	if metrics == nil {
-		return "❌ Метрики диска недоступны"
+		return string(render.Text("❌ Метрики диска недоступны"))
 	}
 
 	// Try to use new metrics structure first
 	if newMetrics, err := s.convertToNewMetrics(metrics); err == nil {
-		var sb strings.Builder
-		sb.WriteString("💿 Дисковое пространство:\n")
-
-		for _, disk := range newMetrics.DiskDetails {
-			sb.WriteString(fmt.Sprintf("%s\n", disk.Path))
-			sb.WriteString(fmt.Sprintf("- Использовано: %d GB (%.0f%%)\n", int(disk.UsedGB), float64(disk.UsedPercent)))
-			sb.WriteString(fmt.Sprintf("- Свободно: %d GB\n", int(disk.FreeGB)))
-		}
-
-		return sb.String()
+		return s.renderMetrics("disk", newMetrics, "❌ Метрики диска недоступны")
 	}
 
 	// Fallback to legacy structure
 	if len(metrics.DiskDetails) == 0 {
-		return "❌ Метрики диска недоступны"
+		return string(render.Text("❌ Метрики диска недоступны"))
 	}
-
-	var sb strings.Builder
-	sb.WriteString("💿 Дисковое пространство:\n")
-
-	for _, disk := range metrics.DiskDetails {
-		sb.WriteString(fmt.Sprintf("%s\n", disk.Path))
-		sb.WriteString(fmt.Sprintf("- Файловая система: %s\n", disk.Filesystem))
-		sb.WriteString(fmt.Sprintf("- Всего: %d GB\n", int(disk.TotalGB)))
-		sb.WriteString(fmt.Sprintf("- Использовано: %d GB (%.0f%%)\n", int(disk.UsedGB), disk.UsedPercent))
-		sb.WriteString(fmt.Sprintf("- Свободно: %d GB\n", int(disk.FreeGB)))
-	}
-
-	return sb.String()
+	return s.renderMetrics("disk_legacy", metrics, "❌ Метрики диска недоступны")
 }
 
-// FormatTemperature formats temperature metrics for display
+// FormatTemperature formats temperature metrics for display, in MarkdownV2
 func (s *MetricsServiceImpl) FormatTemperature(metrics *domain.ServerMetrics) string {
 	if metrics == nil {
-		return "❌ Метрики температуры недоступны"
+		return string(render.Text("❌ Метрики температуры недоступны"))
 	}
 
 	// Debug log to see what we actually have
@@ -176,65 +355,29 @@ func (s *MetricsServiceImpl) FormatTemperature(metrics *domain.ServerMetrics) st
 		"system", metrics.TemperatureDetails.SystemTemperature,
 		"highest", metrics.TemperatureDetails.HighestTemperature)
 
-	var sb strings.Builder
-	sb.WriteString("🌡️ Температура:\n")
-	sb.WriteString(fmt.Sprintf("- CPU: %.1f°C\n", metrics.TemperatureDetails.CPUTemperature))
-	sb.WriteString(fmt.Sprintf("- GPU: %.1f°C\n", metrics.TemperatureDetails.GPUTemperature))
-	sb.WriteString(fmt.Sprintf("- System: %.1f°C\n", metrics.TemperatureDetails.SystemTemperature))
-	sb.WriteString(fmt.Sprintf("- Максимальная: %.1f°C\n", metrics.TemperatureDetails.HighestTemperature))
-
-	// Try to get fresh storage temperatures from API
-	// We'll make a separate API call to get the latest metrics with storage temps
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	// Get server key from cache or use a default approach
-	var serverKey string
-	s.cacheMutex.RLock()
-	for key := range s.cache {
-		serverKey = key
-		break // Use first available server key
-	}
-	s.cacheMutex.RUnlock()
-
-	if serverKey != "" {
-		if freshMetrics, err := s.apiClient.GetServerMetrics(ctx, serverKey); err == nil {
-			for _, storage := range freshMetrics.Metrics.Temperatures.Storage {
-				deviceName := storage.Device
-				if len(deviceName) > 10 {
-					deviceName = deviceName[len(deviceName)-10:] // Show last 10 chars
-				}
-				sb.WriteString(fmt.Sprintf("- Накопитель %s: %.1f°C\n", deviceName, storage.Temperature))
-			}
+	data := temperatureData{Details: metrics.TemperatureDetails, Severity: s.severityIcons(metrics)}
+	for _, storage := range metrics.TemperatureDetails.Storage {
+		if len(storage.Device) > 10 {
+			storage.Device = storage.Device[len(storage.Device)-10:] // Show last 10 chars
 		}
+		data.Storage = append(data.Storage, storage)
 	}
 
-	return sb.String()
+	return s.renderMetrics("temperature", data, "❌ Метрики температуры недоступны")
 }
 
-// FormatNetwork formats network metrics for display
+// FormatNetwork formats network metrics for display, in MarkdownV2
 func (s *MetricsServiceImpl) FormatNetwork(metrics *domain.ServerMetrics) string {
 	if metrics == nil {
-		return "❌ Метрики сети недоступны"
+		return string(render.Text("❌ Метрики сети недоступны"))
 	}
 
 	// Try to use new metrics structure first
 	if newMetrics, err := s.convertToNewMetrics(metrics); err == nil {
-		var sb strings.Builder
-		sb.WriteString("🌐 Сеть:\n")
-		sb.WriteString(fmt.Sprintf("- Прием: %.2f Mbps\n", newMetrics.NetworkDetails.TotalRxMbps))
-		sb.WriteString(fmt.Sprintf("- Передача: %.2f Mbps\n", newMetrics.NetworkDetails.TotalTxMbps))
-		sb.WriteString(fmt.Sprintf("- Общий трафик: %.2f Mbps", newMetrics.NetworkMbps))
-
-		return sb.String()
+		return s.renderMetrics("network", newMetrics, "❌ Метрики сети недоступны")
 	}
 
 	// Fallback to legacy structure
-	var sb strings.Builder
-	sb.WriteString("🌐 Сеть:\n")
-	sb.WriteString(fmt.Sprintf("- Прием: %.2f Mbps\n", metrics.NetworkDetails.TotalRxMbps))
-	sb.WriteString(fmt.Sprintf("- Передача: %.2f Mbps\n", metrics.NetworkDetails.TotalTxMbps))
-
 	// Sort interfaces by traffic (rx + tx)
 	interfaces := make([]domain.NetworkInterfaceExtended, len(metrics.NetworkDetails.Interfaces))
 	for i, iface := range metrics.NetworkDetails.Interfaces {
@@ -250,128 +393,227 @@ func (s *MetricsServiceImpl) FormatNetwork(metrics *domain.ServerMetrics) string
 	sort.Slice(interfaces, func(i, j int) bool {
 		return (interfaces[i].RxMbps + interfaces[i].TxMbps) > (interfaces[j].RxMbps + interfaces[j].TxMbps)
 	})
-
-	sb.WriteString("- Интерфейсы:\n")
-	maxInterfaces := 5
-	if len(interfaces) < maxInterfaces {
-		maxInterfaces = len(interfaces)
+	if len(interfaces) > maxListedInterfaces {
+		interfaces = interfaces[:maxListedInterfaces]
 	}
 
-	for i := 0; i < maxInterfaces; i++ {
-		iface := interfaces[i]
-		sb.WriteString(fmt.Sprintf("  - %s: ↑%.2f ↓%.2f Mbps\n", iface.Name, iface.TxMbps, iface.RxMbps))
-	}
-
-	return sb.String()
+	return s.renderMetrics("network_legacy", legacyNetworkData{NetworkDetails: metrics.NetworkDetails, Interfaces: interfaces}, "❌ Метрики сети недоступны")
 }
 
-// FormatSystem formats system information for display
+// FormatSystem formats system information for display, in MarkdownV2
 func (s *MetricsServiceImpl) FormatSystem(metrics *domain.ServerMetrics) string {
 	if metrics == nil {
-		return "❌ Системная информация недоступна"
+		return string(render.Text("❌ Системная информация недоступна"))
 	}
 
-	var sb strings.Builder
-	sb.WriteString("🖥️ Система:\n")
-	sb.WriteString(fmt.Sprintf("- Хостнейм: %s\n", metrics.SystemDetails.Hostname))
-	sb.WriteString(fmt.Sprintf("- ОС: %s\n", metrics.SystemDetails.OS))
-	sb.WriteString(fmt.Sprintf("- Ядро: %s\n", metrics.SystemDetails.Kernel))
-	sb.WriteString(fmt.Sprintf("- Архитектура: %s\n", metrics.SystemDetails.Architecture))
-	sb.WriteString(fmt.Sprintf("- Аптайм: %s\n", metrics.SystemDetails.UptimeHuman))
-	sb.WriteString(fmt.Sprintf("- Процессы: %d (%d running)",
-		metrics.SystemDetails.ProcessesTotal,
-		metrics.SystemDetails.ProcessesRunning))
-
-	return sb.String()
+	return s.renderMetrics("system", metrics.SystemDetails, "❌ Системная информация недоступна")
 }
 
-// FormatAll formats all metrics in a compact view
+// FormatAll formats all metrics in a compact view, in MarkdownV2
 func (s *MetricsServiceImpl) FormatAll(metrics *domain.ServerMetrics) string {
 	if metrics == nil {
-		return "❌ Метрики недоступны"
+		return string(render.Text("❌ Метрики недоступны"))
 	}
 
 	// Try to use new metrics structure first
+	severity := s.severityIcons(metrics)
 	if newMetrics, err := s.convertToNewMetrics(metrics); err == nil {
-		var sb strings.Builder
-		sb.WriteString("📊 Общая сводка метрик:\n\n")
-
-		// CPU
-		sb.WriteString(fmt.Sprintf("🖥️ CPU: %.1f%% (Load: %.2f)\n",
-			newMetrics.CPUPercent, newMetrics.LoadAverage.Min1))
-
-		// Memory
-		totalMemory := newMetrics.MemoryDetails.UsedGB + newMetrics.MemoryDetails.FreeGB + newMetrics.MemoryDetails.AvailableGB
-		sb.WriteString(fmt.Sprintf("💾 Память: %.1f%% (%.1f/%.1f GB)\n",
-			newMetrics.MemoryPercent, newMetrics.MemoryDetails.UsedGB, totalMemory))
-
+		data := summaryData{
+			memoryData:  newMemoryData(newMetrics),
+			UptimeHours: newMetrics.UptimeSeconds / 3600,
+		}
+		data.Severity = severity
 		// Disk (show first disk)
 		if len(newMetrics.DiskDetails) > 0 {
 			disk := newMetrics.DiskDetails[0]
-			sb.WriteString(fmt.Sprintf("💿 Диск %s: %.0f%% (%d/%d GB)\n",
-				disk.Path, float64(disk.UsedPercent), int(disk.UsedGB), int(disk.UsedGB+disk.FreeGB)))
+			data.FirstDisk = &summaryDisk{Path: disk.Path, UsedPercent: disk.UsedPercent, UsedGB: disk.UsedGB, TotalGB: disk.UsedGB + disk.FreeGB}
 		}
+		return s.renderMetrics("all", data, "❌ Метрики недоступны")
+	}
+
+	// Fallback to legacy structure
+	data := legacySummaryData{ServerMetrics: metrics, Severity: severity}
+	if len(metrics.DiskDetails) > 0 {
+		data.FirstDisk = &metrics.DiskDetails[0]
+	}
+	return s.renderMetrics("all_legacy", data, "❌ Метрики недоступны")
+}
+
+// FormatCompact formats metrics of a type in a single line, for chats preferring
+// compact output over the detailed breakdown, in MarkdownV2
+func (s *MetricsServiceImpl) FormatCompact(metricType string, metrics *domain.ServerMetrics) (string, bool) {
+	switch metricType {
+	case "cpu", "memory", "disk", "temperature", "network", "system", "all":
+	default:
+		return "", false
+	}
+	if metrics == nil {
+		return string(render.Text("❌ Метрики недоступны")), true
+	}
 
-		// Network
-		sb.WriteString(fmt.Sprintf("🌐 Сеть: ↑%.2f ↓%.2f Mbps\n",
-			newMetrics.NetworkDetails.TotalTxMbps, newMetrics.NetworkDetails.TotalRxMbps))
+	data := legacyData{ServerMetrics: metrics, Severity: s.severityIcons(metrics)}
+	return s.renderMetrics("compact_"+metricType, data, "❌ Метрики недоступны"), true
+}
 
-		// Temperature
-		sb.WriteString(fmt.Sprintf("🌡️ Температура: %.1f°C (CPU)\n", newMetrics.Temperatures.CPU))
+// gpuCard represents a GPU with its readings formatted for display, a dash for readings
+// the GPU does not report
+type gpuCard struct {
+	Index       int
+	Name        string
+	Utilization string
+	Memory      string
+	Temperature string
+	Power       string
+}
 
-		// System
-		uptimeHours := newMetrics.UptimeSeconds / 3600
-		sb.WriteString(fmt.Sprintf("⏰ Аптайм: %d ч, Процессы: %d", uptimeHours, newMetrics.ProcessesTotal))
+// gpuData represents the GPUs of a server
+type gpuData struct {
+	ServerName string
+	ServerID   string
+	Driver     string
+	GPUs       []gpuCard
+}
 
-		return sb.String()
+// GetGPU retrieves the GPU readings of a server from its agent on behalf of a user
+func (s *MetricsServiceImpl) GetGPU(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails) (*protocol.GPUResponse, error) {
+	if s.docker == nil {
+		return nil, errors.NewInternalError("agent commands are not configured", nil)
 	}
 
-	// Fallback to legacy structure
-	var sb strings.Builder
-	sb.WriteString("📊 Общая сводка метрик:\n\n")
+	gpu, err := s.docker.GetGPU(WithActor(ctx, userID, telegramID), server.ServerKey)
+	if err != nil {
+		s.logger.Error("Failed to get GPU metrics", "error", err, "server_key", server.ServerKey)
+		return nil, err
+	}
+	return gpu, nil
+}
 
-	// CPU
-	sb.WriteString(fmt.Sprintf("🖥️ CPU: %.1f%% (Load: %.2f)\n",
-		metrics.CPU, metrics.CPUUsage.LoadAverage.Load1min))
+// FormatGPU formats the GPU readings of a server for display, in MarkdownV2
+func (s *MetricsServiceImpl) FormatGPU(server *models.ServerWithDetails, gpu *protocol.GPUResponse) string {
+	if gpu == nil || !gpu.Available || len(gpu.GPUs) == 0 {
+		return string(render.Text(fmt.Sprintf("🎮 На сервере %s(%s) не найдено GPU NVIDIA.\n\nДля метрик GPU нужны драйвер NVIDIA и nvidia-smi.", server.Name, server.ID)))
+	}
 
-	// Memory
-	sb.WriteString(fmt.Sprintf("💾 Память: %.1f%% (%.1f/%.1f GB)\n",
-		metrics.Memory, metrics.MemoryDetails.UsedGB, metrics.MemoryDetails.TotalGB))
+	data := gpuData{ServerName: server.Name, ServerID: server.ID, Driver: gpu.Driver}
+	for _, device := range gpu.GPUs {
+		card := gpuCard{
+			Index:       device.Index,
+			Name:        device.Name,
+			Utilization: gpuReading("%.0f%%", device.Utilization),
+			Temperature: gpuReading("%.0f°C", device.Temperature),
+			Power:       gpuReading("%.0f W", device.PowerDrawW),
+		}
+		if device.PowerDrawW >= 0 && device.PowerLimitW > 0 {
+			card.Power = fmt.Sprintf("%.0f / %.0f W", device.PowerDrawW, device.PowerLimitW)
+		}
+		card.Memory = "—"
+		if device.MemoryUsedMB >= 0 && device.MemoryTotalMB > 0 {
+			card.Memory = fmt.Sprintf("%.1f / %.1f GB (%.0f%%)", device.MemoryUsedMB/1024, device.MemoryTotalMB/1024, device.MemoryUsedMB/device.MemoryTotalMB*100)
+		}
+		data.GPUs = append(data.GPUs, card)
+	}
 
-	// Disk (show first disk)
-	if len(metrics.DiskDetails) > 0 {
-		disk := metrics.DiskDetails[0]
-		sb.WriteString(fmt.Sprintf("💿 Диск %s: %.0f%% (%d/%d GB)\n",
-			disk.Path, disk.UsedPercent, int(disk.UsedGB), int(disk.TotalGB)))
+	return s.renderMetrics("gpu", data, "❌ Метрики GPU недоступны")
+}
+
+// gpuReading formats a GPU reading, a dash when the GPU does not report it
+func gpuReading(format string, value float64) string {
+	if value < 0 {
+		return "—"
 	}
+	return fmt.Sprintf(format, value)
+}
 
-	// Network
-	sb.WriteString(fmt.Sprintf("🌐 Сеть: ↑%.2f ↓%.2f Mbps\n",
-		metrics.NetworkDetails.TotalTxMbps, metrics.NetworkDetails.TotalRxMbps))
+// FormatInlineSummary formats the key metrics in one line, used as the description
+// of inline query results where only a single line fits
+func (s *MetricsServiceImpl) FormatInlineSummary(metrics *domain.ServerMetrics) string {
+	if metrics == nil {
+		return "Метрики недоступны"
+	}
 
-	// Temperature
-	sb.WriteString(fmt.Sprintf("🌡️ Температура: %.1f°C (CPU)\n",
-		metrics.TemperatureDetails.CPUTemperature))
+	parts := []string{
+		fmt.Sprintf("CPU %.0f%%", metrics.CPU),
+		fmt.Sprintf("RAM %.0f%%", metrics.Memory),
+	}
+	if len(metrics.DiskDetails) > 0 {
+		parts = append(parts, fmt.Sprintf("Диск %.0f%%", metrics.DiskDetails[0].UsedPercent))
+	}
+	if metrics.TemperatureDetails.CPUTemperature > 0 {
+		parts = append(parts, fmt.Sprintf("%.0f°C", metrics.TemperatureDetails.CPUTemperature))
+	}
+	return strings.Join(parts, " · ")
+}
 
-	// System
-	sb.WriteString(fmt.Sprintf("⏰ Аптайм: %s", metrics.SystemDetails.UptimeHuman))
+// MetricsExport represents metrics of a server as returned by the --json flag of
+// metric commands, with the fields of the metric type only
+type MetricsExport struct {
+	ServerID    string      `json:"server_id"`
+	ServerName  string      `json:"server_name"`
+	Type        string      `json:"type"`
+	RetrievedAt time.Time   `json:"retrieved_at"`
+	Metrics     interface{} `json:"metrics"`
+}
 
-	return sb.String()
+// MarshalMetrics encodes the metrics of a type as indented JSON
+func (s *MetricsServiceImpl) MarshalMetrics(server *models.ServerWithDetails, metricType string, metrics *domain.ServerMetrics, now time.Time) ([]byte, error) {
+	var section interface{}
+	switch metricType {
+	case "cpu":
+		section = struct {
+			CPU      float64                `json:"cpu"`
+			CPUUsage domain.CPUUsageDetails `json:"cpu_usage"`
+		}{metrics.CPU, metrics.CPUUsage}
+	case "memory":
+		section = struct {
+			Memory        float64              `json:"memory"`
+			MemoryDetails domain.MemoryDetails `json:"memory_details"`
+		}{metrics.Memory, metrics.MemoryDetails}
+	case "disk":
+		section = struct {
+			Disk        float64              `json:"disk"`
+			DiskDetails []domain.DiskDetails `json:"disk_details"`
+		}{metrics.Disk, metrics.DiskDetails}
+	case "temperature":
+		section = metrics.TemperatureDetails
+	case "network":
+		section = struct {
+			Network        float64               `json:"network"`
+			NetworkDetails domain.NetworkDetails `json:"network_details"`
+		}{metrics.Network, metrics.NetworkDetails}
+	case "system":
+		section = metrics.SystemDetails
+	case "all":
+		section = metrics
+	default:
+		return nil, fmt.Errorf("unknown metric type '%s'", metricType)
+	}
+
+	return json.MarshalIndent(MetricsExport{
+		ServerID:    server.ID,
+		ServerName:  server.Name,
+		Type:        metricType,
+		RetrievedAt: now.UTC(),
+		Metrics:     section,
+	}, "", "  ")
 }
 
 // ClearCache clears the metrics cache for a specific server or all servers
 func (s *MetricsServiceImpl) ClearCache(serverKey ...string) {
-	s.cacheMutex.Lock()
-	defer s.cacheMutex.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.fetchTimeout.Load()))
+	defer cancel()
 
 	if len(serverKey) == 0 {
 		// Clear all cache
-		s.cache = make(map[string]*domain.MetricsCache)
+		if err := s.cache.Clear(ctx); err != nil {
+			s.logger.Error("Failed to clear metrics cache", "error", err)
+			return
+		}
 		s.logger.Info("All metrics cache cleared")
 	} else {
 		// Clear specific server cache
-		for _, key := range serverKey {
-			delete(s.cache, key)
+		if err := s.cache.Delete(ctx, serverKey...); err != nil {
+			s.logger.Error("Failed to clear metrics cache", "error", err, "server_keys", serverKey)
+			return
 		}
 		s.logger.Info("Metrics cache cleared", "server_keys", serverKey)
 	}
@@ -379,18 +621,45 @@ func (s *MetricsServiceImpl) ClearCache(serverKey ...string) {
 
 // GetCacheStatus returns cache status information
 func (s *MetricsServiceImpl) GetCacheStatus() map[string]interface{} {
-	s.cacheMutex.RLock()
-	defer s.cacheMutex.RUnlock()
-
-	status := make(map[string]interface{})
-	status["cached_servers"] = len(s.cache)
-	status["cache_entries"] = make([]string, 0, len(s.cache))
-
-	for serverKey := range s.cache {
-		status["cache_entries"] = append(status["cache_entries"].([]string), serverKey)
+	return map[string]interface{}{
+		"backend":   fmt.Sprintf("%T", s.cache),
+		"ttl":       s.cacheTTL.String(),
+		"type_ttls": s.typeTTLs,
 	}
+}
 
-	return status
+// metricSamples flattens server metrics into samples for historical storage
+func metricSamples(serverKey string, metrics *domain.NewServerMetrics) []models.MetricSample {
+	collectedAt, err := time.Parse(time.RFC3339, metrics.Timestamp)
+	if err != nil {
+		collectedAt = time.Now()
+	}
+
+	values := []struct {
+		name  string
+		value float64
+	}{
+		{"cpu_percent", metrics.CPUPercent},
+		{"memory_percent", metrics.MemoryPercent},
+		{"disk_percent", metrics.DiskPercent},
+		{"network_mbps", metrics.NetworkMbps},
+		{"temperature_celsius", metrics.TemperatureCelsius},
+		{"load_1m", metrics.LoadAverage.Min1},
+		{"load_5m", metrics.LoadAverage.Min5},
+		{"load_15m", metrics.LoadAverage.Min15},
+		{"processes_total", float64(metrics.ProcessesTotal)},
+	}
+
+	samples := make([]models.MetricSample, len(values))
+	for i, v := range values {
+		samples[i] = models.MetricSample{
+			ServerKey:   serverKey,
+			Name:        v.name,
+			Value:       v.value,
+			CollectedAt: collectedAt,
+		}
+	}
+	return samples
 }
 
 // convertToNewMetrics converts legacy ServerMetrics to NewServerMetrics
@@ -423,6 +692,7 @@ func (s *MetricsServiceImpl) convertToNewMetrics(metrics *domain.ServerMetrics)
 			CPU:     metrics.TemperatureDetails.CPUTemperature,
 			GPU:     metrics.TemperatureDetails.GPUTemperature,
 			Highest: metrics.TemperatureDetails.HighestTemperature,
+			Storage: metrics.TemperatureDetails.Storage,
 		},
 		UptimeSeconds:     metrics.SystemDetails.UptimeSeconds,
 		ProcessesTotal:    metrics.SystemDetails.ProcessesTotal,
@@ -520,6 +790,7 @@ func (s *MetricsServiceImpl) convertToLegacyMetrics(newResponse *domain.MetricsR
 		GPUTemperature:     newResponse.Metrics.Temperatures.GPU,
 		SystemTemperature:  newResponse.Metrics.Temperatures.CPU, // Use CPU as system temp fallback
 		HighestTemperature: newResponse.Metrics.Temperatures.Highest,
+		Storage:            newResponse.Metrics.Temperatures.Storage,
 	}
 
 	// Convert system details
@@ -530,6 +801,7 @@ func (s *MetricsServiceImpl) convertToLegacyMetrics(newResponse *domain.MetricsR
 		ProcessesTotal:    newResponse.Metrics.ProcessesTotal,
 		ProcessesRunning:  newResponse.Metrics.ProcessesRunning,
 		ProcessesSleeping: newResponse.Metrics.ProcessesSleeping,
+		ProcessNames:      newResponse.Metrics.ProcessNames,
 	}
 
 	return legacyResponse
@@ -0,0 +1,129 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/metricscache"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/pkg/domain"
+)
+
+// nopLogger discards log output so it does not skew the measurements
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, fields ...interface{}) {}
+func (nopLogger) Info(msg string, fields ...interface{})  {}
+func (nopLogger) Warn(msg string, fields ...interface{})  {}
+func (nopLogger) Error(msg string, fields ...interface{}) {}
+
+// sampleMetrics returns metrics of a typical server with several disks and interfaces
+func sampleMetrics() *domain.ServerMetrics {
+	return &domain.ServerMetrics{
+		CPU: 42.5,
+		CPUUsage: domain.CPUUsageDetails{
+			UsageTotal:  42.5,
+			UsageUser:   30.1,
+			UsageSystem: 12.4,
+			UsageIdle:   57.5,
+			LoadAverage: domain.LoadAverage{Load1min: 1.21, Load5min: 0.98, Load15min: 0.75},
+			Cores:       8,
+			Frequency:   3200,
+		},
+		Memory: 63.2,
+		MemoryDetails: domain.MemoryDetails{
+			TotalGB:     32,
+			UsedGB:      20.2,
+			AvailableGB: 11.8,
+			FreeGB:      4.3,
+			UsedPercent: 63.2,
+		},
+		Disk: 71,
+		DiskDetails: []domain.DiskDetails{
+			{Path: "/", TotalGB: 250, UsedGB: 177.5, FreeGB: 72.5, UsedPercent: 71, Filesystem: "ext4"},
+			{Path: "/var/lib/docker", TotalGB: 500, UsedGB: 310, FreeGB: 190, UsedPercent: 62, Filesystem: "xfs"},
+			{Path: "/backup", TotalGB: 2000, UsedGB: 1650, FreeGB: 350, UsedPercent: 82.5, Filesystem: "ext4"},
+		},
+		Network: 120.4,
+		NetworkDetails: domain.NetworkDetails{
+			Interfaces: []domain.NetworkInterface{
+				{Name: "eth0", IP: "10.0.0.12", BytesSent: 1 << 34, BytesRecv: 1 << 35, Up: true},
+				{Name: "docker0", IP: "172.17.0.1", BytesSent: 1 << 30, BytesRecv: 1 << 31, Up: true},
+			},
+			TotalRxMbps: 80.3,
+			TotalTxMbps: 40.1,
+		},
+		TemperatureDetails: domain.TemperatureDetails{
+			CPUTemperature:     61,
+			GPUTemperature:     48,
+			SystemTemperature:  39,
+			HighestTemperature: 61,
+			TemperatureUnit:    "celsius",
+		},
+		SystemDetails: domain.SystemDetails{
+			Hostname:          "web-01",
+			OS:                "Ubuntu 24.04 LTS",
+			Kernel:            "6.8.0-45-generic",
+			Architecture:      "x86_64",
+			UptimeSeconds:     int((45 * 24 * time.Hour).Seconds()),
+			UptimeHuman:       "45 days",
+			ProcessesTotal:    312,
+			ProcessesRunning:  3,
+			ProcessesSleeping: 309,
+		},
+	}
+}
+
+// newBenchService creates a metrics service formatting without an API client
+func newBenchService() *services.MetricsServiceImpl {
+	return services.NewMetricsService(nil, time.Second, metricscache.NewMemoryStore(), 0, nil, nil, nopLogger{})
+}
+
+// benchmarkFormat measures a formatter of the metrics of a typical server
+func benchmarkFormat(b *testing.B, format func(*domain.ServerMetrics) string) {
+	metrics := sampleMetrics()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = format(metrics)
+	}
+}
+
+func BenchmarkFormatCPU(b *testing.B) {
+	benchmarkFormat(b, newBenchService().FormatCPU)
+}
+
+func BenchmarkFormatMemory(b *testing.B) {
+	benchmarkFormat(b, newBenchService().FormatMemory)
+}
+
+func BenchmarkFormatDisk(b *testing.B) {
+	benchmarkFormat(b, newBenchService().FormatDisk)
+}
+
+func BenchmarkFormatTemperature(b *testing.B) {
+	benchmarkFormat(b, newBenchService().FormatTemperature)
+}
+
+func BenchmarkFormatNetwork(b *testing.B) {
+	benchmarkFormat(b, newBenchService().FormatNetwork)
+}
+
+func BenchmarkFormatSystem(b *testing.B) {
+	benchmarkFormat(b, newBenchService().FormatSystem)
+}
+
+func BenchmarkFormatAll(b *testing.B) {
+	benchmarkFormat(b, newBenchService().FormatAll)
+}
+
+func BenchmarkFormatInlineSummary(b *testing.B) {
+	benchmarkFormat(b, newBenchService().FormatInlineSummary)
+}
+
+func BenchmarkFormatCompact(b *testing.B) {
+	svc := newBenchService()
+	benchmarkFormat(b, func(metrics *domain.ServerMetrics) string {
+		text, _ := svc.FormatCompact("all", metrics)
+		return text
+	})
+}
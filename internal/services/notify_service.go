@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/notify"
+	"github.com/servereye/servereyebot/internal/repository"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// maxNotificationChannels bounds the channels of a user
+const maxNotificationChannels = 10
+
+// notificationKindLabels names channel kinds for users
+var notificationKindLabels = map[string]string{
+	notify.KindSlack:   "Slack",
+	notify.KindDiscord: "Discord",
+	notify.KindEmail:   "Email",
+	notify.KindWebhook: "Webhook",
+}
+
+// NotifyService manages the external notification channels of users and publishes
+// alerts and reports to them alongside Telegram
+type NotifyService struct {
+	repo       repository.NotifyStore
+	dispatcher *notify.Dispatcher
+	logger     Logger
+}
+
+// NewNotifyService creates a new notification channel service
+func NewNotifyService(repo repository.NotifyStore, dispatcher *notify.Dispatcher, logger Logger) *NotifyService {
+	return &NotifyService{
+		repo:       repo,
+		dispatcher: dispatcher,
+		logger:     logger,
+	}
+}
+
+// Kinds returns the channel kinds users can add
+func (s *NotifyService) Kinds() []string {
+	return s.dispatcher.Kinds()
+}
+
+// AddChannel adds a channel of a user, limited to one server when serverID is set
+func (s *NotifyService) AddChannel(ctx context.Context, userID, telegramID int64, kind, target, serverID string) (*models.NotificationChannel, error) {
+	kind = strings.ToLower(kind)
+	if err := s.dispatcher.Validate(kind, target); err != nil {
+		return nil, errors.NewValidationError(err.Error(), map[string]interface{}{"kind": kind})
+	}
+
+	channels, err := s.repo.ListNotificationChannels(ctx, telegramID)
+	if err != nil {
+		return nil, err
+	}
+	if len(channels) >= maxNotificationChannels {
+		return nil, errors.NewValidationError("too many notification channels", map[string]interface{}{"max": maxNotificationChannels})
+	}
+
+	channel := &models.NotificationChannel{
+		UserID:   userID,
+		ServerID: serverID,
+		Kind:     kind,
+		Target:   target,
+	}
+	if err := s.repo.AddNotificationChannel(ctx, channel); err != nil {
+		s.logger.Error("Failed to add notification channel", "error", err, "user_id", userID, "kind", kind)
+		return nil, err
+	}
+
+	s.logger.Info("Notification channel added", "user_id", userID, "kind", kind, "server_id", serverID)
+	return channel, nil
+}
+
+// RemoveChannel removes a channel of a user, reporting whether it existed
+func (s *NotifyService) RemoveChannel(ctx context.Context, userID, id int64) (bool, error) {
+	return s.repo.RemoveNotificationChannel(ctx, userID, id)
+}
+
+// ListChannels returns the channels of a user
+func (s *NotifyService) ListChannels(ctx context.Context, telegramID int64) ([]models.NotificationChannel, error) {
+	return s.repo.ListNotificationChannels(ctx, telegramID)
+}
+
+// Publish sends a message to the channels of a user covering any of serverIDs,
+// or to all channels of the user when serverIDs is empty
+func (s *NotifyService) Publish(ctx context.Context, telegramID int64, serverIDs []string, msg notify.Message) error {
+	channels, err := s.repo.ListNotificationChannels(ctx, telegramID)
+	if err != nil {
+		return err
+	}
+	if len(channels) == 0 {
+		return nil
+	}
+
+	targets := make([]notify.Channel, 0, len(channels))
+	for _, channel := range channels {
+		targets = append(targets, notify.Channel{Kind: channel.Kind, Target: channel.Target, ServerID: channel.ServerID})
+	}
+
+	return s.dispatcher.Publish(ctx, targets, serverIDs, msg)
+}
+
+// FormatChannels formats the channels of a user
+func FormatChannels(channels []models.NotificationChannel) string {
+	if len(channels) == 0 {
+		return "🔔 Дополнительных каналов уведомлений нет, алерты и отчеты приходят только в Telegram."
+	}
+
+	var sb strings.Builder
+	sb.WriteString("🔔 Каналы уведомлений:\n\n")
+	for _, channel := range channels {
+		scope := "все серверы"
+		if channel.ServerID != "" {
+			scope = "сервер " + channel.ServerID
+		}
+		sb.WriteString(fmt.Sprintf("#%d %s: %s (%s)\n", channel.ID, notificationKindLabels[channel.Kind], maskTarget(channel), scope))
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// maskTarget hides the secret path of webhook URLs, which grants posting to the channel
+func maskTarget(channel models.NotificationChannel) string {
+	if channel.Kind == notify.KindEmail {
+		return channel.Target
+	}
+
+	target := channel.Target
+	if i := strings.Index(target, "://"); i >= 0 {
+		if j := strings.IndexByte(target[i+3:], '/'); j >= 0 {
+			return target[:i+3+j] + "/…"
+		}
+	}
+	return target
+}
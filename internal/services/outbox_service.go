@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/repository"
+)
+
+const (
+	// outboxLease is how long a claimed message is left to the replica sending it before
+	// it is sent again, e.g. after a crash while sending
+	outboxLease = time.Minute
+
+	// outboxBatch bounds the messages claimed at once
+	outboxBatch = 100
+
+	// outboxRetention is how long delivered and failed messages are kept
+	outboxRetention = 7 * 24 * time.Hour
+)
+
+// RetryPolicy represents retry behaviour of outbox and report deliveries
+type RetryPolicy struct {
+	Attempts int
+	Delay    time.Duration // before the first retry, doubled after every further failure
+	MaxDelay time.Duration
+}
+
+// OutboxSender sends a message, returning nil once Telegram confirmed its delivery
+type OutboxSender func(ctx context.Context, message *models.OutboxMessage) error
+
+// OutboxService persists alerts before they are sent, so that an alert detected right
+// before a crash or during a Telegram outage is still delivered. Messages are marked
+// delivered only after Telegram confirmed them and retried with exponential backoff
+// otherwise.
+type OutboxService struct {
+	repo   repository.OutboxStore
+	policy RetryPolicy
+	logger Logger
+
+	mu        sync.Mutex // serializes the deliveries of this replica
+	cleanedAt time.Time
+}
+
+// NewOutboxService creates a new outbox service
+func NewOutboxService(repo repository.OutboxStore, policy RetryPolicy, logger Logger) *OutboxService {
+	return &OutboxService{
+		repo:   repo,
+		policy: policy,
+		logger: logger,
+	}
+}
+
+// NewOutboxMessage creates a message for a chat. telegramID is the user reached when the
+// chat cannot be, 0 for none, and quiet sends the message silently to the user.
+func NewOutboxMessage(chatID, telegramID int64, text string, keyboard [][]map[string]string, quiet bool) *models.OutboxMessage {
+	message := &models.OutboxMessage{
+		ChatID:     chatID,
+		TelegramID: telegramID,
+		Text:       text,
+		Quiet:      quiet,
+	}
+	if len(keyboard) > 0 {
+		if data, err := json.Marshal(keyboard); err == nil {
+			message.Keyboard = string(data)
+		}
+	}
+	return message
+}
+
+// OutboxKeyboard returns the inline keyboard of a message, nil for none
+func OutboxKeyboard(message *models.OutboxMessage) [][]map[string]string {
+	if message.Keyboard == "" {
+		return nil
+	}
+	var keyboard [][]map[string]string
+	if err := json.Unmarshal([]byte(message.Keyboard), &keyboard); err != nil {
+		return nil
+	}
+	return keyboard
+}
+
+// Enqueue persists messages to be sent right away
+func (s *OutboxService) Enqueue(ctx context.Context, messages []*models.OutboxMessage, now time.Time) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	for _, message := range messages {
+		message.NextAttemptAt = now
+	}
+	return s.repo.EnqueueOutboxMessages(ctx, messages)
+}
+
+// Deliver sends the messages due by now and returns how many were delivered. Failed
+// messages are retried later until the attempts of the policy are used up.
+func (s *OutboxService) Deliver(ctx context.Context, now time.Time, send OutboxSender) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cleanup(ctx, now)
+
+	delivered := 0
+	for {
+		messages, err := s.repo.ClaimOutboxMessages(ctx, now, now.Add(outboxLease), outboxBatch)
+		if err != nil {
+			return delivered, err
+		}
+
+		for _, message := range messages {
+			if err := send(ctx, message); err != nil {
+				s.fail(ctx, message, err)
+				continue
+			}
+			if err := s.repo.MarkOutboxDelivered(ctx, message.ID, time.Now()); err != nil {
+				// The lease expires and the message is sent again, better twice than never
+				s.logger.Error("Failed to mark outbox message delivered", "error", err, "id", message.ID)
+				continue
+			}
+			delivered++
+		}
+
+		if len(messages) < outboxBatch {
+			return delivered, nil
+		}
+	}
+}
+
+// fail records a failed attempt, scheduling a retry while attempts are left
+func (s *OutboxService) fail(ctx context.Context, message *models.OutboxMessage, sendErr error) {
+	attempts := message.Attempts + 1
+	now := time.Now()
+
+	if attempts >= s.policy.Attempts {
+		s.logger.Error("Giving up on alert delivery", "error", sendErr, "id", message.ID, "chat_id", message.ChatID, "attempts", attempts)
+		if err := s.repo.MarkOutboxFailed(ctx, message.ID, attempts, now, sendErr.Error()); err != nil {
+			s.logger.Error("Failed to mark outbox message failed", "error", err, "id", message.ID)
+		}
+		return
+	}
+
+	retryAt := now.Add(s.policy.backoff(attempts))
+	s.logger.Warn("Failed to deliver alert, retrying", "error", sendErr, "id", message.ID, "chat_id", message.ChatID, "attempts", attempts, "retry_at", retryAt)
+	if err := s.repo.RescheduleOutboxMessage(ctx, message.ID, attempts, retryAt, sendErr.Error()); err != nil {
+		s.logger.Error("Failed to reschedule outbox message", "error", err, "id", message.ID)
+	}
+}
+
+// backoff returns the delay before the retry following the given number of attempts
+func (p RetryPolicy) backoff(attempts int) time.Duration {
+	delay := p.Delay
+	for i := 1; i < attempts && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// cleanup removes old delivered and failed messages once a day
+func (s *OutboxService) cleanup(ctx context.Context, now time.Time) {
+	if now.Sub(s.cleanedAt) < 24*time.Hour {
+		return
+	}
+	s.cleanedAt = now
+
+	deleted, err := s.repo.DeleteOutboxMessages(ctx, now.Add(-outboxRetention))
+	if err != nil {
+		s.logger.Error("Failed to delete old outbox messages", "error", err)
+		return
+	}
+	if deleted > 0 {
+		s.logger.Info("Deleted old outbox messages", "count", deleted)
+	}
+}
@@ -0,0 +1,191 @@
+package services_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/services"
+)
+
+// outboxStore keeps outbox messages in memory, claiming them the way the SQL
+// repositories do
+type outboxStore struct {
+	mu       sync.Mutex
+	messages []*models.OutboxMessage
+	deletes  int
+}
+
+func (s *outboxStore) EnqueueOutboxMessages(ctx context.Context, messages []*models.OutboxMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, message := range messages {
+		message.ID = int64(len(s.messages) + 1)
+		stored := *message
+		s.messages = append(s.messages, &stored)
+	}
+	return nil
+}
+
+func (s *outboxStore) ClaimOutboxMessages(ctx context.Context, now, leaseUntil time.Time, limit int) ([]*models.OutboxMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var claimed []*models.OutboxMessage
+	for _, message := range s.messages {
+		if len(claimed) == limit {
+			break
+		}
+		if message.DeliveredAt != nil || message.FailedAt != nil || message.NextAttemptAt.After(now) {
+			continue
+		}
+		message.NextAttemptAt = leaseUntil
+		copied := *message
+		claimed = append(claimed, &copied)
+	}
+	return claimed, nil
+}
+
+func (s *outboxStore) MarkOutboxDelivered(ctx context.Context, id int64, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages[id-1].DeliveredAt = &at
+	return nil
+}
+
+func (s *outboxStore) RescheduleOutboxMessage(ctx context.Context, id int64, attempts int, nextAttemptAt time.Time, lastError string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	message := s.messages[id-1]
+	message.Attempts, message.NextAttemptAt, message.LastError = attempts, nextAttemptAt, lastError
+	return nil
+}
+
+func (s *outboxStore) MarkOutboxFailed(ctx context.Context, id int64, attempts int, at time.Time, lastError string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	message := s.messages[id-1]
+	message.Attempts, message.FailedAt, message.LastError = attempts, &at, lastError
+	return nil
+}
+
+func (s *outboxStore) DeleteOutboxMessages(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deletes++
+	return 0, nil
+}
+
+// message returns a copy of a stored message
+func (s *outboxStore) message(id int64) models.OutboxMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *s.messages[id-1]
+}
+
+// chatSender sends messages to chats, failing those in down
+type chatSender struct {
+	down map[int64]bool
+	sent []int64
+}
+
+func (s *chatSender) send(ctx context.Context, message *models.OutboxMessage) error {
+	if s.down[message.ChatID] {
+		return fmt.Errorf("chat %d unreachable", message.ChatID)
+	}
+	s.sent = append(s.sent, message.ChatID)
+	return nil
+}
+
+func TestOutboxRetriesFailedDeliveries(t *testing.T) {
+	store := &outboxStore{}
+	outbox := services.NewOutboxService(store, services.RetryPolicy{Attempts: 5, Delay: time.Minute, MaxDelay: time.Hour}, nopLogger{})
+	sender := &chatSender{down: map[int64]bool{1001: true}}
+	ctx := context.Background()
+	now := time.Now()
+
+	messages := []*models.OutboxMessage{
+		services.NewOutboxMessage(1001, 1001, "CPU 95%", nil, false),
+		services.NewOutboxMessage(2002, 2002, "disk 91%", nil, false),
+	}
+	if err := outbox.Enqueue(ctx, messages, now); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	before := time.Now()
+	if delivered, err := outbox.Deliver(ctx, now, sender.send); err != nil || delivered != 1 {
+		t.Fatalf("Deliver = %d, %v, want 1 delivered", delivered, err)
+	}
+	failed := store.message(1)
+	if failed.Attempts != 1 || failed.LastError == "" || failed.NextAttemptAt.Before(before.Add(time.Minute)) || failed.NextAttemptAt.After(time.Now().Add(time.Minute)) {
+		t.Errorf("failed message %+v, want 1 attempt retried in a minute", failed)
+	}
+
+	// Nothing is due until the retry
+	if delivered, err := outbox.Deliver(ctx, now.Add(30*time.Second), sender.send); err != nil || delivered != 0 || len(sender.sent) != 1 {
+		t.Fatalf("Deliver before the retry = %d, %v, sent %v, want nothing sent again", delivered, err, sender.sent)
+	}
+
+	sender.down[1001] = false
+	if delivered, err := outbox.Deliver(ctx, now.Add(2*time.Minute), sender.send); err != nil || delivered != 1 {
+		t.Fatalf("Deliver at the retry = %d, %v, want 1 delivered", delivered, err)
+	}
+	if retried := store.message(1); retried.DeliveredAt == nil {
+		t.Errorf("retried message %+v, want it delivered", retried)
+	}
+	if len(sender.sent) != 2 || sender.sent[0] != 2002 || sender.sent[1] != 1001 {
+		t.Errorf("sent to %v, want 2002 then 1001 once each", sender.sent)
+	}
+}
+
+func TestOutboxBacksOffAndGivesUp(t *testing.T) {
+	store := &outboxStore{}
+	outbox := services.NewOutboxService(store, services.RetryPolicy{Attempts: 4, Delay: time.Minute, MaxDelay: 3 * time.Minute}, nopLogger{})
+	sender := &chatSender{down: map[int64]bool{1001: true}}
+	ctx := context.Background()
+	now := time.Now()
+
+	if err := outbox.Enqueue(ctx, []*models.OutboxMessage{services.NewOutboxMessage(1001, 1001, "CPU 95%", nil, false)}, now); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	// Delays double up to the maximum
+	for attempt, delay := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute} {
+		before := time.Now()
+		if _, err := outbox.Deliver(ctx, now, sender.send); err != nil {
+			t.Fatalf("Deliver: %v", err)
+		}
+		message := store.message(1)
+		if message.Attempts != attempt+1 || message.FailedAt != nil {
+			t.Fatalf("after attempt %d: %+v, want it rescheduled", attempt+1, message)
+		}
+		if wait := message.NextAttemptAt.Sub(before); wait < delay || wait > delay+time.Second {
+			t.Errorf("after attempt %d: retry in %v, want %v", attempt+1, wait, delay)
+		}
+		now = message.NextAttemptAt
+	}
+
+	if _, err := outbox.Deliver(ctx, now, sender.send); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	if message := store.message(1); message.Attempts != 4 || message.FailedAt == nil {
+		t.Fatalf("after the last attempt: %+v, want it failed", message)
+	}
+
+	// Failed messages are not sent again
+	sender.down[1001] = false
+	if delivered, err := outbox.Deliver(ctx, now.Add(time.Hour), sender.send); err != nil || delivered != 0 || len(sender.sent) != 0 {
+		t.Errorf("Deliver after giving up = %d, %v, sent %v, want nothing sent", delivered, err, sender.sent)
+	}
+
+	// Old messages are cleaned up once a day
+	if store.deletes != 1 {
+		t.Errorf("%d cleanups within a day, want 1", store.deletes)
+	}
+	outbox.Deliver(ctx, now.Add(25*time.Hour), sender.send)
+	if store.deletes != 2 {
+		t.Errorf("%d cleanups after a day, want 2", store.deletes)
+	}
+}
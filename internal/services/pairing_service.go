@@ -0,0 +1,199 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	stderrors "errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/repository"
+	"github.com/servereye/servereyebot/pkg/errors"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// pairingCodeAttempts is how many times a colliding random code is regenerated
+const pairingCodeAttempts = 5
+
+// PairedServer is a server linked to a user by pairing
+type PairedServer struct {
+	Pairing   *models.PairingCode
+	ServerKey string
+	Secret    string // end-to-end secret of the server, only ever handed to its agent
+}
+
+// PairingService links newly started agents to users through one-time codes
+type PairingService struct {
+	repo        repository.PairingStore
+	keys        repository.KeyStore
+	users       *UserService
+	audit       *AuditService
+	ttl         time.Duration
+	maxAttempts int
+	logger      Logger
+
+	mu       sync.Mutex
+	failures map[string][]time.Time // client address -> times of failed attempts within ttl
+}
+
+// NewPairingService creates a new pairing service. Codes are valid for ttl and every
+// client address may fail at most maxAttempts times within ttl.
+func NewPairingService(repo repository.PairingStore, keys repository.KeyStore, users *UserService, audit *AuditService, ttl time.Duration, maxAttempts int, logger Logger) *PairingService {
+	return &PairingService{
+		repo:        repo,
+		keys:        keys,
+		users:       users,
+		audit:       audit,
+		ttl:         ttl,
+		maxAttempts: maxAttempts,
+		logger:      logger,
+		failures:    make(map[string][]time.Time),
+	}
+}
+
+// CreateCode generates a new pairing code for a user
+func (s *PairingService) CreateCode(ctx context.Context, userID, telegramID int64) (*models.PairingCode, error) {
+	var lastErr error
+	for i := 0; i < pairingCodeAttempts; i++ {
+		code, err := randomPairingCode()
+		if err != nil {
+			return nil, err
+		}
+
+		pairing := &models.PairingCode{
+			Code:       code,
+			UserID:     userID,
+			TelegramID: telegramID,
+			ExpiresAt:  time.Now().Add(s.ttl),
+		}
+
+		// A unique violation means the code is still stored for someone else
+		if lastErr = s.repo.CreatePairingCode(ctx, pairing); lastErr == nil {
+			return pairing, nil
+		}
+	}
+
+	s.logger.Error("Failed to create pairing code", "error", lastErr, "user_id", userID)
+	return nil, lastErr
+}
+
+// Pair creates a server for the user who generated the code, issuing its key and its
+// end-to-end secret. It is called by agents started with the code; remoteAddr identifies
+// the caller for brute force protection. Agents can't name the key themselves, so a code
+// can't be used to take over a server that already exists.
+func (s *PairingService) Pair(ctx context.Context, code, remoteAddr string) (*PairedServer, error) {
+	started := time.Now()
+
+	if s.limited(remoteAddr, started) {
+		return nil, errors.NewRateLimitError("too many failed pairing attempts")
+	}
+
+	if len(code) != 6 {
+		s.recordFailure(remoteAddr, started)
+		return nil, errors.NewValidationError("pairing code must have 6 digits", nil)
+	}
+
+	serverKey, err := randomServerKey()
+	if err != nil {
+		return nil, err
+	}
+
+	pairing, err := s.repo.ClaimPairingCode(ctx, code, serverKey, started)
+	if err != nil {
+		if stderrors.Is(err, sql.ErrNoRows) {
+			s.recordFailure(remoteAddr, started)
+			return nil, errors.NewNotFoundError("pairing code")
+		}
+		return nil, err
+	}
+
+	secret, err := protocol.NewSecret()
+	if err == nil {
+		err = s.users.AddIssuedServer(ctx, pairing.UserID, serverKey)
+	}
+	if err == nil {
+		// The server was created for the code, so the user who generated it owns the server
+		err = s.users.SetServerRole(ctx, pairing.UserID, serverKey, RoleOwner)
+	}
+	if err == nil {
+		err = s.keys.SetServerSecret(ctx, serverKey, secret)
+	}
+	s.audit.RecordResult(ctx, pairing.UserID, pairing.TelegramID, serverKey, AuditCommandPairServer,
+		fmt.Sprintf("code_id=%d remote=%s", pairing.ID, remoteAddr), "", started, err)
+	if err != nil {
+		s.logger.Error("Failed to link paired server", "error", err, "server_key", serverKey, "user_id", pairing.UserID)
+		return nil, err
+	}
+
+	s.logger.Info("Server paired", "server_key", serverKey, "user_id", pairing.UserID)
+	return &PairedServer{Pairing: pairing, ServerKey: serverKey, Secret: secret}, nil
+}
+
+// Cleanup removes expired codes and forgets old failed attempts
+func (s *PairingService) Cleanup(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	for addr, attempts := range s.failures {
+		if recent := recentAttempts(attempts, now.Add(-s.ttl)); len(recent) > 0 {
+			s.failures[addr] = recent
+		} else {
+			delete(s.failures, addr)
+		}
+	}
+	s.mu.Unlock()
+
+	deleted, err := s.repo.DeleteExpiredPairingCodes(ctx, now)
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		s.logger.Debug("Expired pairing codes deleted", "count", deleted)
+	}
+	return nil
+}
+
+// TTL returns how long pairing codes are valid
+func (s *PairingService) TTL() time.Duration {
+	return s.ttl
+}
+
+// limited reports whether a client address has used up its failed attempts
+func (s *PairingService) limited(remoteAddr string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempts := recentAttempts(s.failures[remoteAddr], now.Add(-s.ttl))
+	s.failures[remoteAddr] = attempts
+	return len(attempts) >= s.maxAttempts
+}
+
+// recordFailure remembers a failed attempt of a client address
+func (s *PairingService) recordFailure(remoteAddr string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures[remoteAddr] = append(s.failures[remoteAddr], now)
+}
+
+// recentAttempts returns the attempts made after since
+func recentAttempts(attempts []time.Time, since time.Time) []time.Time {
+	recent := attempts[:0]
+	for _, at := range attempts {
+		if at.After(since) {
+			recent = append(recent, at)
+		}
+	}
+	return recent
+}
+
+// randomPairingCode generates a random 6-digit code
+func randomPairingCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
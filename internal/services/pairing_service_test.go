@@ -0,0 +1,230 @@
+package services_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/repository"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// auditStore keeps audit records in memory
+type auditStore struct {
+	mu      sync.Mutex
+	entries []models.CommandHistory
+}
+
+func (s *auditStore) CreateCommandHistory(ctx context.Context, entry *models.CommandHistory) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, *entry)
+	return nil
+}
+
+func (s *auditStore) GetCommandHistory(ctx context.Context, id int64) (*models.CommandHistory, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (s *auditStore) ListCommandHistoryForUser(ctx context.Context, userID int64, limit int) ([]models.CommandHistory, error) {
+	return nil, nil
+}
+
+func (s *auditStore) ListCommandHistory(ctx context.Context, limit int) ([]models.CommandHistory, error) {
+	return nil, nil
+}
+
+// pairingRepo keeps pairing codes, server links and secrets in memory, claiming codes the
+// way the SQL repositories do
+type pairingRepo struct {
+	repository.UserStore
+	repository.KeyStore
+
+	mu      sync.Mutex
+	codes   map[string]*models.PairingCode
+	roles   map[string]string // user ID/server ID -> role
+	secrets map[string]string // server ID -> end-to-end secret
+}
+
+func newPairingRepo() *pairingRepo {
+	return &pairingRepo{
+		codes:   make(map[string]*models.PairingCode),
+		roles:   make(map[string]string),
+		secrets: make(map[string]string),
+	}
+}
+
+func (r *pairingRepo) CreatePairingCode(ctx context.Context, code *models.PairingCode) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.codes[code.Code]; ok {
+		return fmt.Errorf("duplicate code %s", code.Code)
+	}
+	stored := *code
+	r.codes[code.Code] = &stored
+	return nil
+}
+
+func (r *pairingRepo) ClaimPairingCode(ctx context.Context, code, serverID string, now time.Time) (*models.PairingCode, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pairing, ok := r.codes[code]
+	if !ok || pairing.UsedAt != nil || !pairing.ExpiresAt.After(now) {
+		return nil, sql.ErrNoRows
+	}
+	pairing.UsedAt, pairing.ServerID = &now, serverID
+	claimed := *pairing
+	return &claimed, nil
+}
+
+func (r *pairingRepo) DeleteExpiredPairingCodes(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (r *pairingRepo) AddServerToUser(userID int64, serverID, source string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.roles[fmt.Sprintf("%d/%s", userID, serverID)] = services.RoleOwner
+	return nil
+}
+
+func (r *pairingRepo) SetServerRole(ctx context.Context, userID int64, serverID, role string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.roles[fmt.Sprintf("%d/%s", userID, serverID)] = role
+	return nil
+}
+
+func (r *pairingRepo) SetServerSecret(ctx context.Context, serverID, secret string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.secrets[serverID] = secret
+	return nil
+}
+
+// newPairingService creates a pairing service over an in-memory repository
+func newPairingService(ttl time.Duration, maxAttempts int) (*services.PairingService, *pairingRepo) {
+	repo := newPairingRepo()
+	users := services.NewUserService(repo, nil, nil)
+	audit := services.NewAuditService(&auditStore{}, nil, nopLogger{})
+	return services.NewPairingService(repo, repo, users, audit, ttl, maxAttempts, nopLogger{}), repo
+}
+
+func TestPairIssuesServer(t *testing.T) {
+	svc, repo := newPairingService(time.Minute, 5)
+	ctx := context.Background()
+
+	code, err := svc.CreateCode(ctx, 7, 1001)
+	if err != nil {
+		t.Fatalf("CreateCode: %v", err)
+	}
+	if len(code.Code) != 6 || strings.Trim(code.Code, "0123456789") != "" {
+		t.Errorf("CreateCode = %q, want 6 digits", code.Code)
+	}
+
+	paired, err := svc.Pair(ctx, code.Code, "203.0.113.7")
+	if err != nil {
+		t.Fatalf("Pair: %v", err)
+	}
+	if !strings.HasPrefix(paired.ServerKey, "srv_") || paired.Pairing.ServerID != paired.ServerKey {
+		t.Errorf("Pair issued key %q for code of server %q, want a new srv_ key", paired.ServerKey, paired.Pairing.ServerID)
+	}
+	if paired.Pairing.TelegramID != 1001 {
+		t.Errorf("Pair returned the code of %d, want 1001", paired.Pairing.TelegramID)
+	}
+	if role := repo.roles["7/"+paired.ServerKey]; role != services.RoleOwner {
+		t.Errorf("role of the code owner = %q, want %q", role, services.RoleOwner)
+	}
+	if paired.Secret == "" || repo.secrets[paired.ServerKey] != paired.Secret {
+		t.Errorf("stored secret %q, want the returned %q", repo.secrets[paired.ServerKey], paired.Secret)
+	}
+
+	// Another code gets another server
+	code, err = svc.CreateCode(ctx, 7, 1001)
+	if err != nil {
+		t.Fatalf("CreateCode: %v", err)
+	}
+	second, err := svc.Pair(ctx, code.Code, "203.0.113.7")
+	if err != nil {
+		t.Fatalf("Pair: %v", err)
+	}
+	if second.ServerKey == paired.ServerKey || second.Secret == paired.Secret {
+		t.Errorf("second pairing issued %q, want a key and secret of its own", second.ServerKey)
+	}
+}
+
+func TestPairCodeSingleUse(t *testing.T) {
+	svc, repo := newPairingService(time.Minute, 5)
+	ctx := context.Background()
+
+	code, err := svc.CreateCode(ctx, 7, 1001)
+	if err != nil {
+		t.Fatalf("CreateCode: %v", err)
+	}
+	if _, err := svc.Pair(ctx, code.Code, "203.0.113.7"); err != nil {
+		t.Fatalf("Pair: %v", err)
+	}
+
+	if paired, err := svc.Pair(ctx, code.Code, "198.51.100.9"); !errors.IsErrorCode(err, errors.ErrCodeNotFound) {
+		t.Errorf("Pair with a used code = %+v, %v, want a not found error", paired, err)
+	}
+	if len(repo.secrets) != 1 {
+		t.Errorf("%d servers paired, want 1", len(repo.secrets))
+	}
+}
+
+func TestPairCodeExpiry(t *testing.T) {
+	svc, repo := newPairingService(10*time.Millisecond, 5)
+	ctx := context.Background()
+
+	code, err := svc.CreateCode(ctx, 7, 1001)
+	if err != nil {
+		t.Fatalf("CreateCode: %v", err)
+	}
+	if ttl := time.Until(code.ExpiresAt); ttl <= 0 || ttl > 10*time.Millisecond {
+		t.Errorf("code expires in %v, want within the 10ms TTL", ttl)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	if paired, err := svc.Pair(ctx, code.Code, "203.0.113.7"); !errors.IsErrorCode(err, errors.ErrCodeNotFound) {
+		t.Errorf("Pair with an expired code = %+v, %v, want a not found error", paired, err)
+	}
+	if len(repo.secrets) != 0 {
+		t.Errorf("%d servers paired with an expired code, want none", len(repo.secrets))
+	}
+}
+
+func TestPairBruteForceLimit(t *testing.T) {
+	svc, _ := newPairingService(time.Minute, 3)
+	ctx := context.Background()
+
+	code, err := svc.CreateCode(ctx, 7, 1001)
+	if err != nil {
+		t.Fatalf("CreateCode: %v", err)
+	}
+	n, _ := strconv.Atoi(code.Code)
+	wrong := fmt.Sprintf("%06d", (n+1)%1000000)
+
+	// Malformed and unknown codes count as failures
+	for i, guess := range []string{"12", wrong, wrong} {
+		if _, err := svc.Pair(ctx, guess, "203.0.113.7"); err == nil || errors.IsErrorCode(err, errors.ErrCodeRateLimit) {
+			t.Fatalf("attempt %d with %q = %v, want it rejected but not limited", i+1, guess, err)
+		}
+	}
+
+	if _, err := svc.Pair(ctx, code.Code, "203.0.113.7"); !errors.IsErrorCode(err, errors.ErrCodeRateLimit) {
+		t.Errorf("Pair after 3 failed attempts = %v, want a rate limit error", err)
+	}
+
+	// The limit is per client address and the code is still usable
+	if _, err := svc.Pair(ctx, code.Code, "198.51.100.9"); err != nil {
+		t.Errorf("Pair from another address: %v", err)
+	}
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/servereye/servereyebot/internal/alerts"
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/repository"
+)
+
+const (
+	// maxPassiveCheckService bounds the service names stored for passive checks
+	maxPassiveCheckService = 255
+
+	// maxPassiveCheckOutput bounds the plugin output stored and shown for a check
+	maxPassiveCheckOutput = 1024
+)
+
+// PassiveCheckIngest represents the outcome of a batch of submitted check results
+type PassiveCheckIngest struct {
+	Notifications []AlertNotification
+	Accepted      int // results stored for a server
+	Skipped       int // results without a known server or with an invalid service name
+}
+
+// PassiveCheckService receives check results of Nagios, Icinga and Zabbix, so that servers
+// can move to ServerEye gradually while their alerts already arrive in Telegram. Results are
+// mapped to servers by host name, which may be the server ID or name, and users are
+// alerted when a check changes its state.
+type PassiveCheckService struct {
+	repo    repository.PassiveCheckStore
+	targets repository.UserStore
+	logger  Logger
+}
+
+// NewPassiveCheckService creates a new passive check service
+func NewPassiveCheckService(repo repository.PassiveCheckStore, targets repository.UserStore, logger Logger) *PassiveCheckService {
+	return &PassiveCheckService{
+		repo:    repo,
+		targets: targets,
+		logger:  logger,
+	}
+}
+
+// Ingest stores check results and builds one alert per user of the servers whose checks
+// changed state. The first result of a check alerts only when it is not OK.
+func (s *PassiveCheckService) Ingest(ctx context.Context, results []alerts.PassiveCheckResult, now time.Time) (*PassiveCheckIngest, error) {
+	targets, err := s.targets.ListAlertTargets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	servers := make(map[string]models.AlertTarget)
+	recipients := make(map[string][]int64)
+	for _, target := range targets {
+		servers[strings.ToLower(target.ServerID)] = target
+		servers[strings.ToLower(target.Name)] = target
+		recipients[target.ServerID] = append(recipients[target.ServerID], target.TelegramID)
+	}
+
+	ingest := &PassiveCheckIngest{}
+	byRecipient := make(map[int64][]passiveCheckChange)
+	for _, result := range results {
+		result.Normalize()
+		server, ok := matchAlertServer(servers, result.Host)
+		if !ok || len(result.Service) > maxPassiveCheckService {
+			ingest.Skipped++
+			continue
+		}
+
+		check := &models.PassiveCheck{
+			ServerID:  server.ServerID,
+			Service:   result.Service,
+			Host:      result.Host,
+			State:     int(result.State),
+			Output:    truncateOutput(result.Output, maxPassiveCheckOutput),
+			CheckedAt: result.CheckedAt(now),
+		}
+		previous, err := s.repo.RecordPassiveCheck(ctx, check)
+		if err != nil {
+			s.logger.Error("Failed to store passive check", "error", err, "server_id", server.ServerID, "service", result.Service)
+			return nil, err
+		}
+		ingest.Accepted++
+
+		if previous == nil && result.State == alerts.CheckOK || previous != nil && previous.State == check.State {
+			continue
+		}
+
+		change := passiveCheckChange{check: *check, server: server}
+		if previous != nil {
+			change.previous = alerts.CheckState(previous.State)
+			change.since = previous.ChangedAt
+		}
+		for _, telegramID := range recipients[server.ServerID] {
+			byRecipient[telegramID] = append(byRecipient[telegramID], change)
+		}
+	}
+
+	telegramIDs := make([]int64, 0, len(byRecipient))
+	for telegramID := range byRecipient {
+		telegramIDs = append(telegramIDs, telegramID)
+	}
+	sort.Slice(telegramIDs, func(i, j int) bool { return telegramIDs[i] < telegramIDs[j] })
+
+	for _, telegramID := range telegramIDs {
+		changes := byRecipient[telegramID]
+		ids := make([]string, 0, len(changes))
+		seen := make(map[string]bool)
+		for _, change := range changes {
+			if !seen[change.server.ServerID] {
+				seen[change.server.ServerID] = true
+				ids = append(ids, change.server.ServerID)
+			}
+		}
+
+		ingest.Notifications = append(ingest.Notifications, AlertNotification{
+			TelegramID: telegramID,
+			ServerIDs:  ids,
+			Category:   AlertCategoryChecks,
+			Text:       formatPassiveCheckChanges(changes, now),
+		})
+	}
+
+	if ingest.Skipped > 0 {
+		s.logger.Warn("Passive check results skipped", "count", ingest.Skipped)
+	}
+	return ingest, nil
+}
+
+// List returns the last results of the passive checks of a server, failing ones first
+func (s *PassiveCheckService) List(ctx context.Context, serverID string) ([]models.PassiveCheck, error) {
+	return s.repo.ListPassiveChecks(ctx, serverID)
+}
+
+// passiveCheckChange represents a check that changed its state
+type passiveCheckChange struct {
+	check    models.PassiveCheck
+	server   models.AlertTarget
+	previous alerts.CheckState
+	since    time.Time // when the check entered the previous state, zero for a new check
+}
+
+// formatPassiveCheckChanges formats the state changes of the checks of a user
+func formatPassiveCheckChanges(changes []passiveCheckChange, now time.Time) string {
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].check.State > changes[j].check.State })
+
+	var sb strings.Builder
+	sb.WriteString("📟 Внешний мониторинг: изменилось состояние проверок\n\n")
+
+	for i, change := range changes {
+		if i == maxAlertmanagerAlertsPerMessage {
+			sb.WriteString(fmt.Sprintf("… и еще %d\n", len(changes)-i))
+			break
+		}
+
+		state := alerts.CheckState(change.check.State)
+		sb.WriteString(fmt.Sprintf("%s %s — %s(%s): %s", state.Icon(), change.check.Service, change.server.Name, change.server.ServerID, state))
+		if !change.since.IsZero() {
+			sb.WriteString(fmt.Sprintf(" (был %s %s)", change.previous, now.Sub(change.since).Round(time.Second)))
+		}
+		sb.WriteString("\n")
+		if change.check.Output != "" {
+			sb.WriteString(change.check.Output + "\n")
+		}
+	}
+
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// FormatPassiveChecks formats the last results of the passive checks of a server
+func FormatPassiveChecks(server *models.ServerWithDetails, checks []models.PassiveCheck, now time.Time) string {
+	if len(checks) == 0 {
+		return fmt.Sprintf("📟 Для %s(%s) не поступало результатов внешних проверок.\n\nNagios, Icinga и Zabbix могут отправлять их на /api/v1/passive-checks с именем хоста %s.", server.Name, server.ID, server.ID)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("📟 Внешние проверки %s(%s):\n\n", server.Name, server.ID))
+	for _, check := range checks {
+		state := alerts.CheckState(check.State)
+		sb.WriteString(fmt.Sprintf("%s %s: %s уже %s, проверено %s назад\n", state.Icon(), check.Service, state, now.Sub(check.ChangedAt).Round(time.Second), now.Sub(check.CheckedAt).Round(time.Second)))
+		if check.Output != "" {
+			sb.WriteString("   " + truncateOutput(check.Output, 200) + "\n")
+		}
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// truncateOutput shortens plugin output to limit bytes without splitting a character
+func truncateOutput(output string, limit int) string {
+	if len(output) <= limit {
+		return output
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(output[cut]) {
+		cut--
+	}
+	return output[:cut] + "…"
+}
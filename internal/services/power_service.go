@@ -0,0 +1,220 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/pkg/docker"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// Power actions of servers
+const (
+	PowerReboot   = "reboot"
+	PowerShutdown = "shutdown"
+)
+
+const (
+	// PowerConfirmWindow is how long a reboot or shutdown can be confirmed after it was requested
+	PowerConfirmWindow = 30 * time.Second
+
+	// powerActionDelay is how long agents wait before rebooting or shutting down
+	powerActionDelay = 5 * time.Second
+
+	// powerRebootDeadline is how long a rebooting server may stay offline before it is reported
+	powerRebootDeadline = 10 * time.Minute
+
+	// powerShutdownDeadline is how long a server may stay online after a shutdown before it is reported
+	powerShutdownDeadline = 5 * time.Minute
+
+	// powerProbeTimeout bounds a single reachability probe of a server
+	powerProbeTimeout = 10 * time.Second
+)
+
+// powerConfirmation represents a reboot or shutdown waiting for confirmation
+type powerConfirmation struct {
+	serverID   string
+	action     string
+	telegramID int64
+	expiresAt  time.Time
+}
+
+// PowerAction represents a reboot or shutdown followed until the server went offline
+// and, for reboots, came back
+type PowerAction struct {
+	ServerID   string
+	ServerName string
+	ServerKey  string
+	Action     string
+	TelegramID int64 // user who confirmed the action
+	StartedAt  time.Time
+	OfflineAt  time.Time // zero while the server has not been seen offline
+	Deadline   time.Time
+}
+
+// PowerService reboots and shuts down servers. Actions are confirmed within
+// PowerConfirmWindow by the owner who requested them, and the server is followed
+// afterwards so that the owner learns when it went offline and came back.
+type PowerService struct {
+	docker *docker.Client
+	logger Logger
+
+	mu            sync.Mutex
+	confirmations map[string]*powerConfirmation // token -> action waiting for confirmation
+	running       map[string]bool               // server ID -> action being followed
+}
+
+// NewPowerService creates a new power service
+func NewPowerService(dockerClient *docker.Client, logger Logger) *PowerService {
+	return &PowerService{
+		docker:        dockerClient,
+		logger:        logger,
+		confirmations: make(map[string]*powerConfirmation),
+		running:       make(map[string]bool),
+	}
+}
+
+// Request registers a reboot or shutdown of a server waiting for confirmation and returns
+// the token that confirms it. Only owners may reboot or shut down servers.
+func (s *PowerService) Request(telegramID int64, server *models.ServerWithDetails, action string, now time.Time) (string, error) {
+	if err := Authorize(server, PermPower); err != nil {
+		return "", err
+	}
+	if action != PowerReboot && action != PowerShutdown {
+		return "", errors.NewValidationError("unknown power action", map[string]interface{}{"action": action})
+	}
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.NewInternalError("failed to generate confirmation token", err)
+	}
+	token := hex.EncodeToString(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, confirmation := range s.confirmations {
+		if now.After(confirmation.expiresAt) {
+			delete(s.confirmations, key)
+		}
+	}
+	s.confirmations[token] = &powerConfirmation{
+		serverID:   server.ID,
+		action:     action,
+		telegramID: telegramID,
+		expiresAt:  now.Add(PowerConfirmWindow),
+	}
+	return token, nil
+}
+
+// Cancel drops a reboot or shutdown waiting for confirmation, reporting whether it was
+// requested by the user
+func (s *PowerService) Cancel(token string, telegramID int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	confirmation, ok := s.confirmations[token]
+	if !ok || confirmation.telegramID != telegramID {
+		return false
+	}
+	delete(s.confirmations, token)
+	return true
+}
+
+// Confirm dispatches a requested reboot or shutdown to the agent of the server. Only the
+// user who requested it may confirm; the token is used up, and unknown or expired tokens
+// are reported as not found.
+func (s *PowerService) Confirm(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails, token string, now time.Time) (*PowerAction, error) {
+	if err := Authorize(server, PermPower); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	confirmation, ok := s.confirmations[token]
+	if ok && confirmation.telegramID != telegramID {
+		s.mu.Unlock()
+		return nil, errors.NewForbiddenError("power action requested by another user")
+	}
+	delete(s.confirmations, token)
+	if !ok || now.After(confirmation.expiresAt) || confirmation.serverID != server.ID {
+		s.mu.Unlock()
+		return nil, errors.NewNotFoundError("power action confirmation")
+	}
+	if s.running[server.ID] {
+		s.mu.Unlock()
+		return nil, errors.NewValidationError("power action already in progress", map[string]interface{}{"server_id": server.ID})
+	}
+	s.running[server.ID] = true
+	s.mu.Unlock()
+
+	if _, err := s.docker.PowerAction(WithActor(ctx, userID, telegramID), server.ServerKey, confirmation.action, powerActionDelay); err != nil {
+		s.Finish(server.ID)
+		s.logger.Error("Failed to dispatch power action", "error", err, "server_key", server.ServerKey, "action", confirmation.action)
+		return nil, err
+	}
+
+	deadline := powerRebootDeadline
+	if confirmation.action == PowerShutdown {
+		deadline = powerShutdownDeadline
+	}
+
+	s.logger.Warn("Power action dispatched", "server_id", server.ID, "action", confirmation.action, "telegram_id", telegramID)
+	return &PowerAction{
+		ServerID:   server.ID,
+		ServerName: server.Name,
+		ServerKey:  server.ServerKey,
+		Action:     confirmation.action,
+		TelegramID: telegramID,
+		StartedAt:  now,
+		Deadline:   now.Add(powerActionDelay + deadline),
+	}, nil
+}
+
+// Reachable reports whether the agent of a server answers
+func (s *PowerService) Reachable(ctx context.Context, action *PowerAction) bool {
+	ctx, cancel := context.WithTimeout(ctx, powerProbeTimeout)
+	defer cancel()
+
+	_, err := s.docker.GetAgentVersion(ctx, action.ServerKey)
+	return err == nil
+}
+
+// Observe advances a power action with whether its server is reachable, returning the
+// message about a change of its state, if any, and whether following it has ended
+func (s *PowerService) Observe(action *PowerAction, reachable bool, now time.Time) (text string, done bool) {
+	switch {
+	case !reachable && action.OfflineAt.IsZero():
+		action.OfflineAt = now
+		if action.Action == PowerShutdown {
+			return fmt.Sprintf("⏻ Сервер %s(%s) выключен.", action.ServerName, action.ServerID), true
+		}
+		return fmt.Sprintf("🔴 Сервер %s(%s) ушел на перезагрузку, жду возвращения…", action.ServerName, action.ServerID), false
+
+	case reachable && !action.OfflineAt.IsZero():
+		return fmt.Sprintf("🟢 Сервер %s(%s) снова в сети. Перезагрузка заняла %s.", action.ServerName, action.ServerID, now.Sub(action.StartedAt).Round(time.Second)), true
+
+	case now.Before(action.Deadline):
+		return "", false
+
+	case !action.OfflineAt.IsZero():
+		return fmt.Sprintf("🚨 Сервер %s(%s) не вернулся в сеть за %s после перезагрузки. Проверьте сервер.", action.ServerName, action.ServerID, powerRebootDeadline), true
+
+	case action.Action == PowerShutdown:
+		return fmt.Sprintf("⚠️ Сервер %s(%s) все еще в сети через %s после выключения. Проверьте, что агент запущен от root.", action.ServerName, action.ServerID, powerShutdownDeadline), true
+
+	default:
+		return fmt.Sprintf("⚠️ Сервер %s(%s) не уходил из сети за %s после перезагрузки. Возможно, перезагрузка не удалась или прошла быстрее проверки.", action.ServerName, action.ServerID, powerRebootDeadline), true
+	}
+}
+
+// Finish stops following the power action of a server
+func (s *PowerService) Finish(serverID string) {
+	s.mu.Lock()
+	delete(s.running, serverID)
+	s.mu.Unlock()
+}
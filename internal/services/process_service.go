@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/pkg/docker"
+	"github.com/servereye/servereyebot/pkg/errors"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+const (
+	// DefaultTopProcesses is the number of processes /top shows when none is given
+	DefaultTopProcesses = 10
+
+	// MaxTopProcesses bounds the processes shown in one message
+	MaxTopProcesses = 30
+
+	// maxProcessCommand bounds the command line shown for a process
+	maxProcessCommand = 60
+)
+
+// ProcessService shows the processes of user servers
+type ProcessService struct {
+	docker *docker.Client
+	logger Logger
+}
+
+// NewProcessService creates a new process service
+func NewProcessService(dockerClient *docker.Client, logger Logger) *ProcessService {
+	return &ProcessService{
+		docker: dockerClient,
+		logger: logger,
+	}
+}
+
+// ParseProcessSort parses the sort column of /top, "cpu" or "mem"
+func ParseProcessSort(value string) (protocol.ProcessSort, bool) {
+	switch strings.ToLower(value) {
+	case "cpu":
+		return protocol.ProcessSortCPU, true
+	case "mem", "memory", "ram":
+		return protocol.ProcessSortMemory, true
+	default:
+		return "", false
+	}
+}
+
+// Top retrieves the processes of a server using the most CPU or memory on behalf of a user
+func (s *ProcessService) Top(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails, sortBy protocol.ProcessSort, limit int) (*protocol.TopProcessesResponse, error) {
+	if limit < 1 || limit > MaxTopProcesses {
+		return nil, errors.NewValidationError("process count out of range", map[string]interface{}{"limit": limit, "max": MaxTopProcesses})
+	}
+
+	ctx = WithActor(ctx, userID, telegramID)
+
+	top, err := s.docker.GetTopProcesses(ctx, server.ServerKey, sortBy, limit)
+	if err != nil {
+		s.logger.Error("Failed to get top processes", "error", err, "server_key", server.ServerKey, "sort_by", sortBy)
+		return nil, err
+	}
+
+	return top, nil
+}
+
+// FormatTop formats the top processes of a server
+func (s *ProcessService) FormatTop(server *models.ServerWithDetails, sortBy protocol.ProcessSort, top *protocol.TopProcessesResponse, now time.Time) string {
+	column := "CPU"
+	if sortBy == protocol.ProcessSortMemory {
+		column = "памяти"
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("⚙️ Процессы %s(%s) по %s", server.Name, server.ID, column))
+	if top.Total > 0 {
+		sb.WriteString(fmt.Sprintf(", %d из %d", len(top.Processes), top.Total))
+	}
+	sb.WriteString(":\n\n")
+
+	if len(top.Processes) == 0 {
+		sb.WriteString("Агент не вернул процессов.\n")
+	}
+
+	for i, p := range top.Processes {
+		sb.WriteString(fmt.Sprintf("%d. %s (PID %d, %s) — CPU %.1f%%, память %.1f%% (%s)\n",
+			i+1, p.Name, p.PID, p.User, p.CPUPercent, p.MemoryPercent, formatBytes(p.MemoryBytes)))
+		if command := strings.TrimSpace(p.Command); command != "" && command != p.Name {
+			if runes := []rune(command); len(runes) > maxProcessCommand {
+				command = string(runes[:maxProcessCommand]) + "…"
+			}
+			sb.WriteString("   " + command + "\n")
+		}
+	}
+
+	sb.WriteString(fmt.Sprintf("\n🕐 %s UTC", now.UTC().Format("15:04:05")))
+	return sb.String()
+}
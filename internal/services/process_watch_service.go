@@ -0,0 +1,256 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/callbacks"
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/repository"
+	"github.com/servereye/servereyebot/pkg/errors"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// AlertCategoryProcesses categorizes alerts about watched processes
+const AlertCategoryProcesses = "processes"
+
+// ProcessWatchCallback is the action of the button restarting a missing process, with
+// parameters restart, server_id and process name
+var ProcessWatchCallback = callbacks.NewAction("pw", 0)
+
+// processName restricts watched process names to what agents report as a process name
+var processName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.@+-]{0,31}$`)
+
+// ProcessWatchService alerts when a process watched on a server is no longer reported
+// by its agent and offers restarting it with a configured allow-listed command
+type ProcessWatchService struct {
+	repo    repository.ProcessWatchStore
+	targets repository.UserStore
+	metrics *MetricsServiceImpl
+	exec    *ExecService
+	logger  Logger
+
+	mu      sync.Mutex
+	missing map[string]bool // server ID + process name -> missing at the last check
+}
+
+// NewProcessWatchService creates a new process watch service
+func NewProcessWatchService(repo repository.ProcessWatchStore, targets repository.UserStore, metrics *MetricsServiceImpl, exec *ExecService, logger Logger) *ProcessWatchService {
+	return &ProcessWatchService{
+		repo:    repo,
+		targets: targets,
+		metrics: metrics,
+		exec:    exec,
+		logger:  logger,
+		missing: make(map[string]bool),
+	}
+}
+
+// Watch starts watching a process on a server. The restart command, if any, must match
+// the allow-list of /exec.
+func (s *ProcessWatchService) Watch(ctx context.Context, telegramID int64, server *models.ServerWithDetails, name, restartCommand string) error {
+	if err := Authorize(server, PermProcessWatch); err != nil {
+		return err
+	}
+	if !processName.MatchString(name) {
+		return errors.NewValidationError("invalid process name", map[string]interface{}{"name": name})
+	}
+	restartCommand = strings.Join(strings.Fields(restartCommand), " ")
+	if restartCommand != "" && !s.exec.Allowed(strings.Fields(restartCommand)) {
+		return errors.NewForbiddenError("restart command is not in the allow-list")
+	}
+
+	watch := &models.ProcessWatch{ServerID: server.ID, Name: name, RestartCommand: restartCommand, CreatedBy: telegramID}
+	if err := s.repo.UpsertProcessWatch(ctx, watch); err != nil {
+		s.logger.Error("Failed to store process watch", "error", err, "server_id", server.ID, "process", name)
+		return err
+	}
+
+	s.logger.Info("Process watch added", "server_id", server.ID, "process", name, "telegram_id", telegramID)
+	return nil
+}
+
+// Unwatch stops watching a process, reporting whether it was watched
+func (s *ProcessWatchService) Unwatch(ctx context.Context, server *models.ServerWithDetails, name string) (bool, error) {
+	if err := Authorize(server, PermProcessWatch); err != nil {
+		return false, err
+	}
+	removed, err := s.repo.DeleteProcessWatch(ctx, server.ID, name)
+	if err != nil {
+		s.logger.Error("Failed to remove process watch", "error", err, "server_id", server.ID, "process", name)
+		return false, err
+	}
+
+	s.mu.Lock()
+	delete(s.missing, server.ID+"\x00"+name)
+	s.mu.Unlock()
+
+	return removed, nil
+}
+
+// List retrieves the watches of a server
+func (s *ProcessWatchService) List(ctx context.Context, serverID string) ([]models.ProcessWatch, error) {
+	watches, err := s.repo.ListProcessWatches(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []models.ProcessWatch
+	for _, watch := range watches {
+		if watch.ServerID == serverID {
+			list = append(list, watch)
+		}
+	}
+	return list, nil
+}
+
+// Restart runs the restart command of a watched process on behalf of a user
+func (s *ProcessWatchService) Restart(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails, name string) (*models.ProcessWatch, *protocol.ExecResultResponse, error) {
+	if err := Authorize(server, PermProcessWatch); err != nil {
+		return nil, nil, err
+	}
+	watch, err := s.repo.GetProcessWatch(ctx, server.ID, name)
+	if err == sql.ErrNoRows {
+		return nil, nil, errors.NewNotFoundError("process watch")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if watch.RestartCommand == "" {
+		return nil, nil, errors.NewValidationError("process has no restart command", map[string]interface{}{"process": name})
+	}
+
+	result, err := s.exec.Exec(ctx, userID, telegramID, server, watch.RestartCommand)
+	if err != nil {
+		return watch, nil, err
+	}
+	return watch, result, nil
+}
+
+// FormatRestart formats the output of the restart command of a process as messages
+func (s *ProcessWatchService) FormatRestart(server *models.ServerWithDetails, watch *models.ProcessWatch, result *protocol.ExecResultResponse) []string {
+	return formatExecResult(server, watch.RestartCommand, result)
+}
+
+// Check compares the watched processes with the processes agents report in their metrics
+// and returns alerts about processes that disappeared or are running again. Servers whose
+// agent does not report processes are skipped.
+func (s *ProcessWatchService) Check(ctx context.Context, now time.Time) ([]AlertNotification, error) {
+	watches, err := s.repo.ListProcessWatches(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(watches) == 0 {
+		return nil, nil
+	}
+
+	byServer := make(map[string][]models.ProcessWatch)
+	for _, watch := range watches {
+		byServer[watch.ServerID] = append(byServer[watch.ServerID], watch)
+	}
+
+	targets, err := s.targets.ListAlertTargets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var servers []models.AlertTarget
+	recipients := make(map[string][]int64)
+	for _, target := range targets {
+		if len(byServer[target.ServerID]) == 0 {
+			continue
+		}
+		if _, ok := recipients[target.ServerID]; !ok {
+			servers = append(servers, target)
+		}
+		recipients[target.ServerID] = append(recipients[target.ServerID], target.TelegramID)
+	}
+
+	var notifications []AlertNotification
+	for _, server := range servers {
+		metrics, _, err := s.metrics.GetCachedMetrics(server.ServerKey, "system", false)
+		if err != nil {
+			s.logger.Warn("Failed to get metrics for process watches", "error", err, "server_key", server.ServerKey)
+			continue
+		}
+		names := metrics.Metrics.SystemDetails.ProcessNames
+		if names == nil {
+			continue
+		}
+
+		running := make(map[string]bool, len(names))
+		for _, name := range names {
+			running[name] = true
+		}
+
+		for _, watch := range byServer[server.ServerID] {
+			key := watch.ServerID + "\x00" + watch.Name
+			missing := !running[watch.Name]
+
+			s.mu.Lock()
+			wasMissing := s.missing[key]
+			s.missing[key] = missing
+			s.mu.Unlock()
+
+			if missing == wasMissing {
+				continue
+			}
+
+			var text string
+			var keyboard [][]map[string]string
+			if missing {
+				text = fmt.Sprintf("⚙️ Процесс %s не запущен на сервере %s(%s)", watch.Name, server.Name, server.ServerID)
+				if watch.RestartCommand != "" {
+					text += fmt.Sprintf("\n\nКоманда перезапуска: %s", watch.RestartCommand)
+					keyboard = [][]map[string]string{{ProcessWatchCallback.Button("🔄 Перезапустить "+watch.Name, "restart", watch.ServerID, watch.Name)}}
+				}
+			} else {
+				text = fmt.Sprintf("✅ Процесс %s снова запущен на сервере %s(%s)", watch.Name, server.Name, server.ServerID)
+			}
+
+			for _, telegramID := range recipients[server.ServerID] {
+				notifications = append(notifications, AlertNotification{
+					TelegramID: telegramID,
+					ServerIDs:  []string{server.ServerID},
+					Category:   AlertCategoryProcesses,
+					Text:       text,
+					Keyboard:   keyboard,
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(notifications, func(i, j int) bool { return notifications[i].TelegramID < notifications[j].TelegramID })
+	return notifications, nil
+}
+
+// FormatWatches formats the watched processes of a server with their state at the last check
+func (s *ProcessWatchService) FormatWatches(server *models.ServerWithDetails, watches []models.ProcessWatch) string {
+	if len(watches) == 0 {
+		return fmt.Sprintf("⚙️ На %s(%s) нет отслеживаемых процессов.\n\nДобавить: /watch %s add nginx", server.Name, server.ID, server.ID)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("⚙️ Отслеживаемые процессы %s(%s):\n\n", server.Name, server.ID))
+	for _, watch := range watches {
+		state := "🟢"
+		if s.missing[watch.ServerID+"\x00"+watch.Name] {
+			state = "🔴"
+		}
+		sb.WriteString(fmt.Sprintf("%s %s", state, watch.Name))
+		if watch.RestartCommand != "" {
+			sb.WriteString(fmt.Sprintf(" — перезапуск: %s", watch.RestartCommand))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
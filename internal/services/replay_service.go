@@ -0,0 +1,193 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/pkg/docker"
+	"github.com/servereye/servereyebot/pkg/errors"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// maxDiffLines limits the diff size produced by a replay
+const maxDiffLines = 400
+
+// ReplayResult represents the outcome of a replayed command
+type ReplayResult struct {
+	Entry    *models.CommandHistory
+	Response string
+	Error    string
+	Duration time.Duration
+	Diff     []string // lines prefixed with "- " (recorded) and "+ " (replayed), empty when identical
+}
+
+// ReplayService re-sends recorded agent commands in debug mode to reproduce issues
+type ReplayService struct {
+	audit   *AuditService
+	agent   docker.Agent
+	timeout time.Duration
+	logger  Logger
+}
+
+// NewReplayService creates a new replay service
+func NewReplayService(audit *AuditService, agent docker.Agent, timeout time.Duration, logger Logger) *ReplayService {
+	return &ReplayService{
+		audit:   audit,
+		agent:   agent,
+		timeout: timeout,
+		logger:  logger,
+	}
+}
+
+// Replay re-sends the envelope of a recorded command and diffs the new response against the recorded one
+func (s *ReplayService) Replay(ctx context.Context, historyID int64) (*ReplayResult, error) {
+	entry, err := s.audit.Get(ctx, historyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.Envelope == "" {
+		return nil, errors.NewValidationError("command has no recorded envelope", map[string]interface{}{"id": historyID, "command": entry.Command})
+	}
+
+	var msg protocol.Message
+	if err := json.Unmarshal([]byte(entry.Envelope), &msg); err != nil {
+		return nil, errors.NewInternalError("failed to decode recorded envelope", err)
+	}
+
+	replay := protocol.NewMessage(msg.Type, msg.Payload)
+	replay.Debug = true
+
+	s.logger.Info("Replaying agent command", "history_id", historyID, "type", replay.Type, "server_id", entry.ServerID, "message_id", replay.ID)
+
+	sendCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	started := time.Now()
+	resp, err := s.agent.SendCommand(sendCtx, entry.ServerID, replay)
+
+	result := &ReplayResult{
+		Entry:    entry,
+		Duration: time.Since(started),
+	}
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.Response = FormatResponsePayload(resp)
+	}
+
+	result.Diff = diffLines(splitLines(entry.Response), splitLines(result.Response))
+	return result, nil
+}
+
+// FormatReplay formats a replay result for display
+func (s *ReplayService) FormatReplay(result *ReplayResult) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("🔁 Повтор команды #%d (%s на %s)\n", result.Entry.ID, result.Entry.Command, result.Entry.ServerID))
+	sb.WriteString(fmt.Sprintf("- Записано: %s, %d мс\n", result.Entry.CreatedAt.Format("02.01.2006 15:04"), result.Entry.DurationMs))
+	sb.WriteString(fmt.Sprintf("- Повтор: %d мс\n", result.Duration.Milliseconds()))
+
+	if result.Entry.Error != "" || result.Error != "" {
+		sb.WriteString(fmt.Sprintf("- Ошибка (записано): %s\n", valueOrDash(result.Entry.Error)))
+		sb.WriteString(fmt.Sprintf("- Ошибка (повтор): %s\n", valueOrDash(result.Error)))
+	}
+
+	if len(result.Diff) == 0 {
+		sb.WriteString("\n✅ Ответ совпадает с записанным.")
+		return sb.String()
+	}
+
+	diff := strings.Join(result.Diff, "\n")
+	if runes := []rune(diff); len(runes) > maxMessageLength {
+		diff = string(runes[:maxMessageLength]) + "\n…"
+	}
+
+	sb.WriteString("\n⚠️ Ответ отличается:\n")
+	sb.WriteString(diff)
+	return sb.String()
+}
+
+// valueOrDash returns a dash for empty values
+func valueOrDash(value string) string {
+	if value == "" {
+		return "—"
+	}
+	return value
+}
+
+// splitLines splits text into lines, returning no lines for empty text
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// diffLines returns a line diff of a and b based on their longest common subsequence.
+// Large inputs are compared line by line to bound memory usage.
+func diffLines(a, b []string) []string {
+	if len(a)*len(b) > maxDiffLines*maxDiffLines {
+		return diffLinesByIndex(a, b)
+	}
+
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var diff []string
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, "- "+a[i])
+			i++
+		default:
+			diff = append(diff, "+ "+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		diff = append(diff, "- "+a[i])
+	}
+	for ; j < len(b); j++ {
+		diff = append(diff, "+ "+b[j])
+	}
+
+	return diff
+}
+
+// diffLinesByIndex compares lines at the same positions
+func diffLinesByIndex(a, b []string) []string {
+	var diff []string
+	for i := 0; i < len(a) || i < len(b); i++ {
+		switch {
+		case i >= len(a):
+			diff = append(diff, "+ "+b[i])
+		case i >= len(b):
+			diff = append(diff, "- "+a[i])
+		case a[i] != b[i]:
+			diff = append(diff, "- "+a[i], "+ "+b[i])
+		}
+	}
+	return diff
+}
@@ -0,0 +1,490 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	stderrors "errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/repository"
+	"github.com/servereye/servereyebot/internal/scheduler"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/errors"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// Report sections that a report template may include
+const (
+	ReportSectionUptime     = "uptime"
+	ReportSectionCPU        = "cpu"
+	ReportSectionMemory     = "memory"
+	ReportSectionDisk       = "disk"
+	ReportSectionProcesses  = "processes"
+	ReportSectionAlerts     = "alerts"
+	ReportSectionContainers = "containers"
+)
+
+const (
+	// reportTopProcesses is the number of busiest processes listed for a server
+	reportTopProcesses = 3
+	// alertLogRetention keeps the sent alerts a weekly report counts
+	alertLogRetention = 8 * 24 * time.Hour
+)
+
+// reportSections lists all report sections in the order they are rendered
+var reportSections = []string{
+	ReportSectionUptime,
+	ReportSectionCPU,
+	ReportSectionMemory,
+	ReportSectionDisk,
+	ReportSectionProcesses,
+	ReportSectionAlerts,
+	ReportSectionContainers,
+}
+
+// defaultReportSections reproduce the report layout used before templates existed
+var defaultReportSections = []string{
+	ReportSectionUptime,
+	ReportSectionCPU,
+	ReportSectionMemory,
+	ReportSectionDisk,
+	ReportSectionProcesses,
+	ReportSectionAlerts,
+}
+
+// ReportTemplate selects the sections of a report and the order of its servers
+type ReportTemplate struct {
+	Sections    []string // empty for the default sections
+	ServerOrder []string // server IDs listed first, remaining servers follow
+}
+
+// ReportSections returns the names of all report sections
+func ReportSections() []string {
+	return reportSections
+}
+
+// ParseReportSections validates a list of report section names, dropping duplicates
+func ParseReportSections(names []string) ([]string, error) {
+	var sections []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		for _, section := range strings.Split(name, ",") {
+			section = strings.ToLower(strings.TrimSpace(section))
+			if section == "" || seen[section] {
+				continue
+			}
+			if !slices.Contains(reportSections, section) {
+				return nil, errors.NewValidationError("unknown report section", map[string]interface{}{"section": section})
+			}
+			seen[section] = true
+			sections = append(sections, section)
+		}
+	}
+
+	if len(sections) == 0 {
+		return nil, errors.NewValidationError("no report sections given", nil)
+	}
+	return sections, nil
+}
+
+// TemplateFromModel extracts the report template stored with a schedule
+func TemplateFromModel(rs *models.ReportSchedule) ReportTemplate {
+	return ReportTemplate{
+		Sections:    splitList(rs.Sections),
+		ServerOrder: splitList(rs.ServerOrder),
+	}
+}
+
+// has reports whether the template includes a section
+func (t ReportTemplate) has(section string) bool {
+	if len(t.Sections) == 0 {
+		return slices.Contains(defaultReportSections, section)
+	}
+	return slices.Contains(t.Sections, section)
+}
+
+// orderServers sorts servers listed in the template first, in its order
+func (t ReportTemplate) orderServers(servers []models.ServerWithDetails) []models.ServerWithDetails {
+	rank := make(map[string]int, len(t.ServerOrder))
+	for i, id := range t.ServerOrder {
+		rank[id] = i + 1
+	}
+
+	ordered := make([]models.ServerWithDetails, len(servers))
+	copy(ordered, servers)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		ri, rj := rank[ordered[i].ID], rank[ordered[j].ID]
+		if ri == 0 || rj == 0 {
+			return ri != 0 && rj == 0
+		}
+		return ri < rj
+	})
+	return ordered
+}
+
+// ServerReport is what a report shows about one server
+type ServerReport struct {
+	Name     string
+	ServerID string
+	Metrics  *domain.ServerMetrics
+	Period   time.Duration // covered by the summaries and the alert count
+
+	// Summaries of the metric history over the period, nil without samples
+	CPU    *models.MetricSummary
+	Memory *models.MetricSummary
+	Disk   *models.MetricSummary
+
+	Processes []protocol.ProcessInfo // busiest processes by CPU, nil when unavailable
+	Alerts    int                    // alerts sent about the server during the period, -1 when unknown
+}
+
+// ReportService builds and schedules periodic server summary reports
+type ReportService struct {
+	repo             repository.ReportStore
+	alerts           repository.AlertLogStore
+	history          repository.MetricsStore
+	userService      *UserService
+	metricsService   *MetricsServiceImpl
+	containerService *ContainerService
+	processService   *ProcessService
+	policy           RetryPolicy
+	logger           Logger
+
+	mu        sync.Mutex
+	cleanedAt time.Time
+}
+
+// NewReportService creates a new report service. Reports that fail to be built or sent
+// are retried as the policy says before the occurrence is skipped.
+func NewReportService(repo repository.ReportStore, alerts repository.AlertLogStore, history repository.MetricsStore, userService *UserService, metricsService *MetricsServiceImpl, containerService *ContainerService, processService *ProcessService, policy RetryPolicy, logger Logger) *ReportService {
+	return &ReportService{
+		repo:             repo,
+		alerts:           alerts,
+		history:          history,
+		userService:      userService,
+		metricsService:   metricsService,
+		containerService: containerService,
+		processService:   processService,
+		policy:           policy,
+		logger:           logger,
+	}
+}
+
+// ReportPeriod returns the time a report of the given frequency covers
+func ReportPeriod(frequency string) time.Duration {
+	if frequency == string(scheduler.FrequencyWeekly) {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// SetSchedule creates or replaces the report schedule of a user
+func (s *ReportService) SetSchedule(ctx context.Context, userID int64, schedule *scheduler.Schedule) error {
+	return s.repo.UpsertReportSchedule(ctx, &models.ReportSchedule{
+		UserID:    userID,
+		Frequency: string(schedule.Frequency),
+		Weekday:   int(schedule.Weekday),
+		Hour:      schedule.Hour,
+		Minute:    schedule.Minute,
+	})
+}
+
+// GetSchedule retrieves the report schedule of a user
+func (s *ReportService) GetSchedule(ctx context.Context, userID int64) (*models.ReportSchedule, error) {
+	return s.repo.GetReportSchedule(ctx, userID)
+}
+
+// SetTemplate stores the report template of a user's schedule.
+// It returns sql.ErrNoRows when the user has no schedule.
+func (s *ReportService) SetTemplate(ctx context.Context, userID int64, tmpl ReportTemplate) error {
+	return s.repo.SetReportTemplate(ctx, userID, strings.Join(tmpl.Sections, ","), strings.Join(tmpl.ServerOrder, ","))
+}
+
+// DisableSchedule removes the report schedule of a user
+func (s *ReportService) DisableSchedule(ctx context.Context, userID int64) error {
+	return s.repo.DeleteReportSchedule(ctx, userID)
+}
+
+// SetTimezone validates and stores the timezone of a user
+func (s *ReportService) SetTimezone(ctx context.Context, userID int64, timezone string) error {
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return fmt.Errorf("unknown timezone '%s'", timezone)
+	}
+	return s.repo.SetUserTimezone(ctx, userID, timezone)
+}
+
+// GetTimezone retrieves the timezone of a user
+func (s *ReportService) GetTimezone(ctx context.Context, userID int64) (string, error) {
+	return s.repo.GetUserTimezone(ctx, userID)
+}
+
+// DueSchedules returns all schedules whose next fire time has passed, leaving out
+// failed reports until their retry is due
+func (s *ReportService) DueSchedules(ctx context.Context, now time.Time) ([]models.ReportSchedule, error) {
+	schedules, err := s.repo.ListReportSchedules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var due []models.ReportSchedule
+	for _, rs := range schedules {
+		if rs.RetryAt != nil && rs.RetryAt.After(now) {
+			continue
+		}
+
+		loc, err := time.LoadLocation(rs.Timezone)
+		if err != nil {
+			s.logger.Warn("Invalid user timezone, falling back to UTC", "timezone", rs.Timezone, "user_id", rs.UserID)
+			loc = time.UTC
+		}
+
+		reference := rs.CreatedAt
+		if rs.LastSentAt != nil {
+			reference = *rs.LastSentAt
+		}
+
+		if !ScheduleFromModel(&rs).Next(reference, loc).After(now) {
+			due = append(due, rs)
+		}
+	}
+
+	return due, nil
+}
+
+// MarkSent records the delivery time of a scheduled report
+func (s *ReportService) MarkSent(ctx context.Context, scheduleID int64, sentAt time.Time) error {
+	return s.repo.MarkReportSent(ctx, scheduleID, sentAt)
+}
+
+// MarkFailed records a scheduled report that could not be built or sent, retrying it with
+// exponential backoff. Once the attempts of the policy are used up the occurrence is
+// skipped and the schedule waits for the next one.
+func (s *ReportService) MarkFailed(ctx context.Context, rs *models.ReportSchedule, now time.Time, reportErr error) error {
+	attempts := rs.FailedAttempts + 1
+	if attempts >= s.policy.Attempts {
+		s.logger.Error("Giving up on scheduled report", "error", reportErr, "schedule_id", rs.ID, "user_id", rs.UserID, "attempts", attempts)
+		return s.repo.MarkReportSent(ctx, rs.ID, now)
+	}
+
+	retryAt := now.Add(s.policy.backoff(attempts))
+	s.logger.Warn("Failed to deliver scheduled report, retrying", "error", reportErr, "schedule_id", rs.ID, "user_id", rs.UserID, "attempts", attempts, "retry_at", retryAt)
+	return s.repo.MarkReportFailed(ctx, rs.ID, attempts, retryAt)
+}
+
+// RecordAlerts logs the alerts sent to users, so that reports can count them per server
+func (s *ReportService) RecordAlerts(ctx context.Context, notifications []AlertNotification, now time.Time) error {
+	var entries []models.AlertLogEntry
+	for _, notification := range notifications {
+		for _, serverID := range notification.ServerIDs {
+			entries = append(entries, models.AlertLogEntry{TelegramID: notification.TelegramID, ServerID: serverID, CreatedAt: now})
+		}
+	}
+	return s.alerts.InsertAlertLog(ctx, entries)
+}
+
+// Cleanup removes logged alerts too old for any report once a day
+func (s *ReportService) Cleanup(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.cleanedAt) < 24*time.Hour {
+		return
+	}
+	s.cleanedAt = now
+
+	deleted, err := s.alerts.DeleteAlertLog(ctx, now.Add(-alertLogRetention))
+	if err != nil {
+		s.logger.Error("Failed to delete old alert log", "error", err)
+		return
+	}
+	if deleted > 0 {
+		s.logger.Info("Deleted old alert log", "count", deleted)
+	}
+}
+
+// BuildReport builds a summary report covering all servers of a user over a period,
+// rendering the sections of the template with its servers first
+func (s *ReportService) BuildReport(ctx context.Context, userID, telegramID int64, title string, tmpl ReportTemplate, period time.Duration) (string, error) {
+	servers, err := s.userService.GetUserServers(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("📋 %s\n\n", title))
+
+	if len(servers) == 0 {
+		sb.WriteString("У вас нет добавленных серверов.")
+		return sb.String(), nil
+	}
+
+	since := time.Now().Add(-period)
+	for _, server := range tmpl.orderServers(servers) {
+		metrics, err := s.metricsService.GetServerMetrics(server.ServerKey)
+		if err != nil {
+			s.logger.Warn("Failed to get metrics for report", "error", err, "server_key", server.ServerKey)
+			sb.WriteString(fmt.Sprintf("🖥️ %s(%s)\n- ❌ Метрики недоступны\n\n", server.Name, server.ID))
+			continue
+		}
+
+		report := &ServerReport{Name: server.Name, ServerID: server.ID, Metrics: &metrics.Metrics, Period: period, Alerts: -1}
+		if tmpl.has(ReportSectionCPU) {
+			report.CPU = s.metricSummary(ctx, server.ServerKey, "cpu_percent", since)
+		}
+		if tmpl.has(ReportSectionMemory) {
+			report.Memory = s.metricSummary(ctx, server.ServerKey, "memory_percent", since)
+		}
+		if tmpl.has(ReportSectionDisk) {
+			report.Disk = s.metricSummary(ctx, server.ServerKey, "disk_percent", since)
+		}
+		if tmpl.has(ReportSectionProcesses) {
+			if top, err := s.processService.Top(ctx, userID, telegramID, &server, protocol.ProcessSortCPU, reportTopProcesses); err == nil {
+				report.Processes = top.Processes
+			}
+		}
+		if tmpl.has(ReportSectionAlerts) {
+			if count, err := s.alerts.CountAlerts(ctx, telegramID, server.ID, since); err == nil {
+				report.Alerts = count
+			} else {
+				s.logger.Warn("Failed to count alerts for report", "error", err, "server_id", server.ID)
+			}
+		}
+		sb.WriteString(s.FormatServerReport(report, tmpl))
+
+		if tmpl.has(ReportSectionContainers) {
+			sb.WriteString(s.formatContainersSection(ctx, userID, telegramID, &server))
+		}
+		sb.WriteString("\n")
+	}
+
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+// FormatServerReport formats a summary of one server for a report
+func (s *ReportService) FormatServerReport(report *ServerReport, tmpl ReportTemplate) string {
+	metrics := report.Metrics
+	period := formatReportPeriod(report.Period)
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("🖥️ %s(%s)\n", report.Name, report.ServerID))
+	if tmpl.has(ReportSectionUptime) {
+		sb.WriteString(fmt.Sprintf("- Аптайм: %s\n", metrics.SystemDetails.UptimeHuman))
+	}
+	if tmpl.has(ReportSectionCPU) {
+		sb.WriteString(fmt.Sprintf("- CPU: %.1f%% (Load: %.2f)%s\n", metrics.CPU, metrics.CPUUsage.LoadAverage.Load1min, formatAverage(report.CPU, period)))
+	}
+	if tmpl.has(ReportSectionMemory) {
+		sb.WriteString(fmt.Sprintf("- Память: %.1f%% (%.1f/%.1f GB)%s\n", metrics.Memory, metrics.MemoryDetails.UsedGB, metrics.MemoryDetails.TotalGB, formatAverage(report.Memory, period)))
+	}
+
+	if tmpl.has(ReportSectionDisk) {
+		for _, disk := range metrics.DiskDetails {
+			sb.WriteString(fmt.Sprintf("- Диск %s: %.0f%% (%d/%d GB)\n", disk.Path, disk.UsedPercent, int(disk.UsedGB), int(disk.TotalGB)))
+		}
+		if report.Disk != nil && report.Disk.Samples > 1 {
+			sb.WriteString(fmt.Sprintf("- Рост диска %s: %+.1f п.п.\n", period, report.Disk.Last-report.Disk.First))
+		}
+	}
+
+	if tmpl.has(ReportSectionProcesses) {
+		sb.WriteString(fmt.Sprintf("- Процессы: %d (%d running)\n", metrics.SystemDetails.ProcessesTotal, metrics.SystemDetails.ProcessesRunning))
+		for _, p := range report.Processes {
+			sb.WriteString(fmt.Sprintf("   ⚙️ %s: CPU %.1f%%, память %.1f%%\n", p.Name, p.CPUPercent, p.MemoryPercent))
+		}
+	}
+
+	if tmpl.has(ReportSectionAlerts) {
+		if report.Alerts < 0 {
+			sb.WriteString("- Алерты: ❌ недоступны\n")
+		} else {
+			sb.WriteString(fmt.Sprintf("- Алерты %s: %d\n", period, report.Alerts))
+		}
+	}
+	return sb.String()
+}
+
+// metricSummary summarizes the history of a metric, nil when it has no samples or
+// the history is unavailable
+func (s *ReportService) metricSummary(ctx context.Context, serverKey, name string, since time.Time) *models.MetricSummary {
+	summary, err := s.history.GetMetricSummary(ctx, serverKey, name, since)
+	if err != nil {
+		if !stderrors.Is(err, sql.ErrNoRows) {
+			s.logger.Warn("Failed to summarize metric history for report", "error", err, "server_key", serverKey, "metric", name)
+		}
+		return nil
+	}
+	return summary
+}
+
+// formatAverage formats the average of a metric summary, empty without one
+func formatAverage(summary *models.MetricSummary, period string) string {
+	if summary == nil {
+		return ""
+	}
+	return fmt.Sprintf(", в среднем %s %.1f%%", period, summary.Avg)
+}
+
+// formatReportPeriod describes the period a report covers
+func formatReportPeriod(period time.Duration) string {
+	if period >= 7*24*time.Hour {
+		return "за неделю"
+	}
+	return "за сутки"
+}
+
+// formatContainersSection formats a short container summary of a server, listing the busiest containers
+func (s *ReportService) formatContainersSection(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails) string {
+	const topContainers = 3
+
+	stats, err := s.containerService.GetStats(ctx, userID, telegramID, server)
+	if err != nil {
+		return "- Контейнеры: ❌ недоступны\n"
+	}
+
+	containers := make([]protocol.ContainerStats, len(stats.Containers))
+	copy(containers, stats.Containers)
+	sort.Slice(containers, func(i, j int) bool {
+		return containers[i].CPUPercent > containers[j].CPUPercent
+	})
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("- Контейнеры: %d запущено\n", len(containers)))
+	for i, c := range containers {
+		if i == topContainers {
+			break
+		}
+		name := c.Name
+		if name == "" {
+			name = c.ContainerID
+		}
+		sb.WriteString(fmt.Sprintf("   🐳 %s: CPU %.1f%%, память %s\n", name, c.CPUPercent, formatBytes(c.MemoryUsage)))
+	}
+	return sb.String()
+}
+
+// ScheduleFromModel converts a stored report schedule to a scheduler.Schedule
+func ScheduleFromModel(rs *models.ReportSchedule) *scheduler.Schedule {
+	return &scheduler.Schedule{
+		Frequency: scheduler.Frequency(rs.Frequency),
+		Weekday:   time.Weekday(rs.Weekday),
+		Hour:      rs.Hour,
+		Minute:    rs.Minute,
+	}
+}
+
+// splitList splits a stored comma-separated list, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,149 @@
+package services_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/repository"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/pkg/domain"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// reportStore keeps report schedules in memory
+type reportStore struct {
+	repository.ReportStore
+
+	schedules []models.ReportSchedule
+}
+
+func (s *reportStore) ListReportSchedules(ctx context.Context) ([]models.ReportSchedule, error) {
+	return s.schedules, nil
+}
+
+func (s *reportStore) MarkReportSent(ctx context.Context, scheduleID int64, sentAt time.Time) error {
+	rs := s.schedule(scheduleID)
+	rs.LastSentAt, rs.FailedAttempts, rs.RetryAt = &sentAt, 0, nil
+	return nil
+}
+
+func (s *reportStore) MarkReportFailed(ctx context.Context, scheduleID int64, attempts int, retryAt time.Time) error {
+	rs := s.schedule(scheduleID)
+	rs.FailedAttempts, rs.RetryAt = attempts, &retryAt
+	return nil
+}
+
+func (s *reportStore) schedule(id int64) *models.ReportSchedule {
+	for i := range s.schedules {
+		if s.schedules[i].ID == id {
+			return &s.schedules[i]
+		}
+	}
+	return nil
+}
+
+func TestFormatServerReport(t *testing.T) {
+	svc := services.NewReportService(nil, nil, nil, nil, nil, nil, nil, services.RetryPolicy{}, nopLogger{})
+	report := &services.ServerReport{
+		Name:     "web",
+		ServerID: "srv_1",
+		Metrics: &domain.ServerMetrics{
+			CPU:         42,
+			Memory:      61.5,
+			DiskDetails: []domain.DiskDetails{{Path: "/", UsedPercent: 70, UsedGB: 70, TotalGB: 100}},
+		},
+		Period: services.ReportPeriod("weekly"),
+		CPU:    &models.MetricSummary{Avg: 23.44, First: 10, Last: 40, Samples: 100},
+		Memory: &models.MetricSummary{Avg: 55, First: 50, Last: 60, Samples: 100},
+		Disk:   &models.MetricSummary{Avg: 68, First: 66.5, Last: 70, Samples: 100},
+		Processes: []protocol.ProcessInfo{
+			{Name: "postgres", CPUPercent: 12.5, MemoryPercent: 20},
+			{Name: "nginx", CPUPercent: 3, MemoryPercent: 1.5},
+		},
+		Alerts: 4,
+	}
+
+	text := svc.FormatServerReport(report, services.ReportTemplate{})
+	for _, want := range []string{
+		"- CPU: 42.0% (Load: 0.00), в среднем за неделю 23.4%",
+		"- Память: 61.5% (0.0/0.0 GB), в среднем за неделю 55.0%",
+		"- Рост диска за неделю: +3.5 п.п.",
+		"⚙️ postgres: CPU 12.5%, память 20.0%",
+		"⚙️ nginx: CPU 3.0%, память 1.5%",
+		"- Алерты за неделю: 4",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("report lacks %q:\n%s", want, text)
+		}
+	}
+
+	// Without history the current values are shown alone
+	report.CPU, report.Memory, report.Disk, report.Alerts = nil, nil, nil, -1
+	text = svc.FormatServerReport(report, services.ReportTemplate{})
+	for _, unwanted := range []string{"в среднем", "Рост диска"} {
+		if strings.Contains(text, unwanted) {
+			t.Errorf("report without history shows %q:\n%s", unwanted, text)
+		}
+	}
+	if !strings.Contains(text, "- Алерты: ❌ недоступны") {
+		t.Errorf("report with an unknown alert count:\n%s", text)
+	}
+}
+
+func TestScheduledReportBackoff(t *testing.T) {
+	created := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	store := &reportStore{schedules: []models.ReportSchedule{
+		{ID: 1, UserID: 7, Timezone: "UTC", Frequency: "daily", Hour: 9, CreatedAt: created},
+	}}
+	svc := services.NewReportService(store, nil, nil, nil, nil, nil, nil, services.RetryPolicy{Attempts: 3, Delay: 5 * time.Minute, MaxDelay: time.Hour}, nopLogger{})
+	ctx := context.Background()
+	now := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	failure := context.DeadlineExceeded
+
+	due := func(at time.Time) bool {
+		schedules, err := svc.DueSchedules(ctx, at)
+		if err != nil {
+			t.Fatalf("DueSchedules: %v", err)
+		}
+		return len(schedules) == 1
+	}
+
+	if !due(now) {
+		t.Fatal("schedule not due at its fire time")
+	}
+
+	for i, delay := range []time.Duration{5 * time.Minute, 10 * time.Minute} {
+		if err := svc.MarkFailed(ctx, &store.schedules[0], now, failure); err != nil {
+			t.Fatalf("MarkFailed: %v", err)
+		}
+		rs := store.schedules[0]
+		if rs.FailedAttempts != i+1 || rs.RetryAt == nil || !rs.RetryAt.Equal(now.Add(delay)) {
+			t.Fatalf("after failure %d: attempts %d, retry at %v, want %d and %v", i+1, rs.FailedAttempts, rs.RetryAt, i+1, now.Add(delay))
+		}
+		if due(now.Add(delay - time.Second)) {
+			t.Errorf("after failure %d: schedule due before its retry", i+1)
+		}
+		now = now.Add(delay)
+		if !due(now) {
+			t.Errorf("after failure %d: schedule not due at its retry", i+1)
+		}
+	}
+
+	// The last attempt skips the occurrence until the next fire time
+	if err := svc.MarkFailed(ctx, &store.schedules[0], now, failure); err != nil {
+		t.Fatalf("MarkFailed: %v", err)
+	}
+	rs := store.schedules[0]
+	if rs.FailedAttempts != 0 || rs.RetryAt != nil || rs.LastSentAt == nil || !rs.LastSentAt.Equal(now) {
+		t.Errorf("after giving up: %+v, want the occurrence marked sent", rs)
+	}
+	if due(now.Add(time.Hour)) {
+		t.Error("skipped occurrence is still due")
+	}
+	if !due(time.Date(2026, 10, 2, 9, 0, 0, 0, time.UTC)) {
+		t.Error("schedule not due at its next fire time")
+	}
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	stderrors "errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/repository"
+	"github.com/servereye/servereyebot/pkg/docker"
+	"github.com/servereye/servereyebot/pkg/errors"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+const (
+	// restartPolicyWindow is the window restarts of a policy are counted in
+	restartPolicyWindow = time.Hour
+
+	// maxRestartPolicyLimit bounds the restarts per hour a policy may allow
+	maxRestartPolicyLimit = 100
+)
+
+// RestartPolicyService manages restart policies of containers. Policies are stored by
+// the bot and pushed to agents, which enforce them with Docker events: a container
+// exiting more often than its policy allows is no longer restarted and its owner is alerted.
+type RestartPolicyService struct {
+	repo   repository.RestartPolicyStore
+	keys   repository.KeyStore
+	docker *docker.Client
+	logger Logger
+}
+
+// NewRestartPolicyService creates a new restart policy service
+func NewRestartPolicyService(repo repository.RestartPolicyStore, keys repository.KeyStore, dockerClient *docker.Client, logger Logger) *RestartPolicyService {
+	return &RestartPolicyService{
+		repo:   repo,
+		keys:   keys,
+		docker: dockerClient,
+		logger: logger,
+	}
+}
+
+// Set stores the restart policy of a container and pushes the policies of the server
+// to its agent. Only owners may set policies. An agent that cannot be reached picks
+// the policy up when it next fetches its policies, which is reported by synced.
+func (s *RestartPolicyService) Set(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails, container string, maxRestarts int) (synced bool, err error) {
+	if err := Authorize(server, PermRestartPolicy); err != nil {
+		return false, err
+	}
+	if container == "" || strings.ContainsAny(container, " /:") {
+		return false, errors.NewValidationError("invalid container name", map[string]interface{}{"container": container})
+	}
+	if maxRestarts < 1 || maxRestarts > maxRestartPolicyLimit {
+		return false, errors.NewValidationError("restart limit out of range", map[string]interface{}{"max_restarts": maxRestarts, "max": maxRestartPolicyLimit})
+	}
+
+	policy := &models.RestartPolicy{
+		ServerID:    server.ID,
+		Container:   container,
+		MaxRestarts: maxRestarts,
+		CreatedBy:   telegramID,
+	}
+	if err := s.repo.UpsertRestartPolicy(ctx, policy); err != nil {
+		s.logger.Error("Failed to store restart policy", "error", err, "server_id", server.ID, "container", container)
+		return false, err
+	}
+
+	s.logger.Info("Restart policy set", "server_id", server.ID, "container", container, "max_restarts", maxRestarts)
+	return s.push(WithActor(ctx, userID, telegramID), server), nil
+}
+
+// Remove deletes the restart policy of a container, reporting whether it existed
+func (s *RestartPolicyService) Remove(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails, container string) (removed, synced bool, err error) {
+	if err := Authorize(server, PermRestartPolicy); err != nil {
+		return false, false, err
+	}
+
+	removed, err = s.repo.DeleteRestartPolicy(ctx, server.ID, container)
+	if err != nil {
+		s.logger.Error("Failed to remove restart policy", "error", err, "server_id", server.ID, "container", container)
+		return false, false, err
+	}
+	if !removed {
+		return false, true, nil
+	}
+
+	s.logger.Info("Restart policy removed", "server_id", server.ID, "container", container)
+	return true, s.push(WithActor(ctx, userID, telegramID), server), nil
+}
+
+// List returns the restart policies of a server by container name
+func (s *RestartPolicyService) List(ctx context.Context, serverID string) (map[string]models.RestartPolicy, error) {
+	policies, err := s.repo.ListRestartPolicies(ctx, serverID)
+	if err != nil {
+		return nil, err
+	}
+
+	byContainer := make(map[string]models.RestartPolicy, len(policies))
+	for _, policy := range policies {
+		byContainer[policy.Container] = policy
+	}
+	return byContainer, nil
+}
+
+// ForAgent returns the policies the agent with the given key has to enforce
+func (s *RestartPolicyService) ForAgent(ctx context.Context, serverKey string) ([]protocol.RestartPolicy, error) {
+	key, err := s.keys.GetServerKey(ctx, serverKey)
+	if err != nil {
+		return nil, err
+	}
+
+	policies, err := s.repo.ListRestartPolicies(ctx, key.ServerID)
+	if err != nil {
+		return nil, err
+	}
+	return agentPolicies(policies), nil
+}
+
+// Tripped records that the agent with the given key stopped restarting a container and
+// returns its policy, whose owner has to be alerted
+func (s *RestartPolicyService) Tripped(ctx context.Context, serverKey string, report protocol.RestartPolicyTripped, now time.Time) (*models.RestartPolicy, error) {
+	key, err := s.keys.GetServerKey(ctx, serverKey)
+	if err != nil {
+		return nil, err
+	}
+
+	at := report.StoppedAt
+	if at.IsZero() || at.After(now) {
+		at = now
+	}
+
+	policy, err := s.repo.MarkRestartPolicyTripped(ctx, key.ServerID, report.Container, at)
+	if err != nil {
+		if stderrors.Is(err, sql.ErrNoRows) {
+			return nil, errors.NewNotFoundError(fmt.Sprintf("restart policy of container '%s'", report.Container))
+		}
+		return nil, err
+	}
+
+	s.logger.Warn("Container auto-restart stopped by policy", "server_id", key.ServerID, "container", report.Container, "restarts", report.Restarts)
+	return policy, nil
+}
+
+// push sends the policies of a server to its agent, reporting whether it applied them
+func (s *RestartPolicyService) push(ctx context.Context, server *models.ServerWithDetails) bool {
+	policies, err := s.repo.ListRestartPolicies(ctx, server.ID)
+	if err != nil {
+		s.logger.Error("Failed to list restart policies", "error", err, "server_id", server.ID)
+		return false
+	}
+
+	if _, err := s.docker.SetRestartPolicies(ctx, server.ServerKey, agentPolicies(policies)); err != nil {
+		s.logger.Warn("Failed to push restart policies to agent", "error", err, "server_id", server.ID)
+		return false
+	}
+	return true
+}
+
+// agentPolicies converts stored policies to the policies sent to agents
+func agentPolicies(policies []models.RestartPolicy) []protocol.RestartPolicy {
+	result := make([]protocol.RestartPolicy, 0, len(policies))
+	for _, policy := range policies {
+		result = append(result, protocol.RestartPolicy{
+			Container:     policy.Container,
+			MaxRestarts:   policy.MaxRestarts,
+			WindowSeconds: int(restartPolicyWindow.Seconds()),
+		})
+	}
+	return result
+}
+
+// FormatRestartPolicies formats the restart policies of a server
+func FormatRestartPolicies(server *models.ServerWithDetails, policies map[string]models.RestartPolicy) string {
+	if len(policies) == 0 {
+		return fmt.Sprintf("🔁 На %s(%s) нет политик перезапуска.\n\nДобавьте политику: /restartpolicy %s set <контейнер> <рестартов в час>", server.Name, server.ID, server.ID)
+	}
+
+	names := make([]string, 0, len(policies))
+	for name := range policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("🔁 Политики перезапуска на %s(%s):\n\n", server.Name, server.ID))
+	for _, name := range names {
+		sb.WriteString(fmt.Sprintf("🐳 %s: %s\n", name, FormatRestartPolicy(policies[name])))
+	}
+	sb.WriteString("\nЕсли контейнер падает чаще, агент перестает его перезапускать и присылает алерт.")
+	return sb.String()
+}
+
+// FormatRestartPolicy formats a single policy, as shown next to its container
+func FormatRestartPolicy(policy models.RestartPolicy) string {
+	text := fmt.Sprintf("не больше %d рестартов в час", policy.MaxRestarts)
+	if policy.TrippedAt != nil {
+		text += fmt.Sprintf(", ⛔ авторестарт остановлен %s", policy.TrippedAt.UTC().Format("02.01 15:04 UTC"))
+	}
+	return text
+}
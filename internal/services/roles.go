@@ -0,0 +1,133 @@
+package services
+
+import (
+	stderrors "errors"
+	"fmt"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// Server roles of a user. Guests have the rights of viewers, but their links are told
+// apart so that ending guest access never removes a link of its own.
+const (
+	RoleGuest  = "guest"
+	RoleViewer = "viewer"
+	RoleAdmin  = "admin"
+	RoleOwner  = "owner"
+)
+
+// roleRanks orders server roles by privilege
+var roleRanks = map[string]int{
+	RoleGuest:  1,
+	RoleViewer: 1,
+	RoleAdmin:  2,
+	RoleOwner:  3,
+}
+
+// IsValidRole reports whether role is a known server role
+func IsValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// HasRole reports whether a server role grants at least the required one
+func HasRole(role, required string) bool {
+	rank, ok := roleRanks[required]
+	return ok && roleRanks[role] >= rank
+}
+
+// Permission is something a user does on one of their servers
+type Permission string
+
+// Permissions guarded by a server role
+const (
+	PermRename         Permission = "rename"
+	PermContainerLogs  Permission = "container_logs"
+	PermImages         Permission = "images"
+	PermCompose        Permission = "compose"
+	PermFiles          Permission = "files"
+	PermExec           Permission = "exec"
+	PermSpeedtest      Permission = "speedtest"
+	PermVMs            Permission = "vms"
+	PermChats          Permission = "chats"
+	PermPurgeCommands  Permission = "purge_commands"
+	PermPower          Permission = "power"
+	PermFirewall       Permission = "firewall"
+	PermGuests         Permission = "guests"
+	PermUpdates        Permission = "updates"
+	PermAgentUpdate    Permission = "agent_update"
+	PermSSHKeys        Permission = "ssh_keys"
+	PermRotateKey      Permission = "rotate_key"
+	PermRestartPolicy  Permission = "restart_policy"
+	PermLogWatch       Permission = "log_watch"
+	PermProcessWatch   Permission = "process_watch"
+	PermTags           Permission = "tags"
+	PermWindows        Permission = "windows"
+	PermMaintenance    Permission = "maintenance"
+	PermUptime         Permission = "uptime"
+	PermCustomCommands Permission = "custom_commands"
+)
+
+// permissionRoles is the one policy of the bot: the server role each permission requires.
+// Only the role on the server counts. Bot admins get no rights on servers of their own
+// list beyond their role there.
+var permissionRoles = map[Permission]string{
+	PermRename:         RoleAdmin,
+	PermContainerLogs:  RoleAdmin,
+	PermImages:         RoleAdmin,
+	PermCompose:        RoleAdmin,
+	PermFiles:          RoleAdmin,
+	PermExec:           RoleAdmin,
+	PermSpeedtest:      RoleAdmin,
+	PermVMs:            RoleAdmin,
+	PermChats:          RoleAdmin,
+	PermPurgeCommands:  RoleOwner,
+	PermPower:          RoleOwner,
+	PermFirewall:       RoleOwner,
+	PermGuests:         RoleOwner,
+	PermUpdates:        RoleOwner,
+	PermAgentUpdate:    RoleOwner,
+	PermSSHKeys:        RoleOwner,
+	PermRotateKey:      RoleOwner,
+	PermRestartPolicy:  RoleOwner,
+	PermLogWatch:       RoleOwner,
+	PermProcessWatch:   RoleOwner,
+	PermTags:           RoleOwner,
+	PermWindows:        RoleOwner,
+	PermMaintenance:    RoleOwner,
+	PermUptime:         RoleOwner,
+	PermCustomCommands: RoleOwner,
+}
+
+// Can reports whether the user's role on a server grants a permission
+func Can(server *models.ServerWithDetails, perm Permission) bool {
+	return HasRole(server.Role, permissionRoles[perm])
+}
+
+// Authorize returns a forbidden error unless the user's role on a server grants a permission
+func Authorize(server *models.ServerWithDetails, perm Permission) error {
+	return requireRole(server, permissionRoles[perm])
+}
+
+// requireRole returns a forbidden error naming the required role unless the user's
+// role on a server grants it
+func requireRole(server *models.ServerWithDetails, required string) error {
+	if HasRole(server.Role, required) {
+		return nil
+	}
+	err := errors.NewForbiddenError(fmt.Sprintf("server %s role required", required))
+	err.Details = map[string]interface{}{"server_id": server.ID, "role": server.Role, "required_role": required}
+	return err
+}
+
+// RequiredRole returns the server role a forbidden error asks for, if it was
+// returned by a role check
+func RequiredRole(err error) (string, bool) {
+	var appErr *errors.AppError
+	if !stderrors.As(err, &appErr) || appErr.Code != errors.ErrCodeForbidden {
+		return "", false
+	}
+	role, ok := appErr.Details["required_role"].(string)
+	return role, ok
+}
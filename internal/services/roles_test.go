@@ -0,0 +1,119 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/scheduler"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+func TestServerActionsRequireRole(t *testing.T) {
+	// The role checks run before any store or agent is used, so none is needed
+	exec := services.NewExecService(nil, nil, []string{"uptime"}, nopLogger{})
+	keys := services.NewKeyService(nil, nil, time.Hour, nopLogger{})
+	windows := services.NewDeploymentWindowService(nil, nopLogger{})
+	watches := services.NewProcessWatchService(nil, nil, nil, exec, nopLogger{})
+	alerts := services.NewAlertService(nil, nil, nil, nil, time.Minute, nopLogger{})
+	commands := services.NewCustomCommandService(nil, nil, nil, []string{"/opt/scripts"}, nopLogger{})
+	now := time.Now()
+
+	actions := []struct {
+		name     string
+		required string
+		run      func(ctx context.Context, server *models.ServerWithDetails) error
+	}{
+		{"exec", services.RoleAdmin, func(ctx context.Context, server *models.ServerWithDetails) error {
+			_, err := exec.Exec(ctx, 7, 1001, server, "uptime")
+			return err
+		}},
+		{"rotatekey", services.RoleOwner, func(ctx context.Context, server *models.ServerWithDetails) error {
+			return keys.Rotate(ctx, 7, 1001, server)
+		}},
+		{"window add", services.RoleOwner, func(ctx context.Context, server *models.ServerWithDetails) error {
+			_, err := windows.Add(ctx, server, 1001, &scheduler.Window{Weekday: time.Saturday, Start: 120, End: 240}, "UTC")
+			return err
+		}},
+		{"window remove", services.RoleOwner, func(ctx context.Context, server *models.ServerWithDetails) error {
+			_, err := windows.Remove(ctx, server, 1)
+			return err
+		}},
+		{"maintenance", services.RoleOwner, func(ctx context.Context, server *models.ServerWithDetails) error {
+			_, err := windows.StartMaintenance(ctx, server, 1001, time.Hour, now)
+			return err
+		}},
+		{"maintenance end", services.RoleOwner, func(ctx context.Context, server *models.ServerWithDetails) error {
+			_, err := windows.EndMaintenance(ctx, server, now)
+			return err
+		}},
+		{"watch", services.RoleOwner, func(ctx context.Context, server *models.ServerWithDetails) error {
+			return watches.Watch(ctx, 1001, server, "nginx", "")
+		}},
+		{"unwatch", services.RoleOwner, func(ctx context.Context, server *models.ServerWithDetails) error {
+			_, err := watches.Unwatch(ctx, server, "nginx")
+			return err
+		}},
+		{"watch restart", services.RoleOwner, func(ctx context.Context, server *models.ServerWithDetails) error {
+			_, _, err := watches.Restart(ctx, 7, 1001, server, "nginx")
+			return err
+		}},
+		{"tag", services.RoleOwner, func(ctx context.Context, server *models.ServerWithDetails) error {
+			return alerts.TagServer(ctx, server, "db")
+		}},
+		{"untag", services.RoleOwner, func(ctx context.Context, server *models.ServerWithDetails) error {
+			_, err := alerts.UntagServer(ctx, server, "db")
+			return err
+		}},
+		{"command define", services.RoleOwner, func(ctx context.Context, server *models.ServerWithDetails) error {
+			_, err := commands.Define(ctx, 7, 1001, server, "backup", "/opt/scripts/backup.sh", services.RoleAdmin)
+			return err
+		}},
+		{"command run", services.RoleAdmin, func(ctx context.Context, server *models.ServerWithDetails) error {
+			_, err := commands.Run(ctx, 7, 1001, services.CustomCommandTarget{Command: models.CustomCommand{Name: "backup", RequiredRole: services.RoleAdmin}, Server: server}, nil)
+			return err
+		}},
+	}
+
+	roles := []string{"", services.RoleGuest, services.RoleViewer, services.RoleAdmin, services.RoleOwner}
+	for _, action := range actions {
+		for _, role := range roles {
+			if services.HasRole(role, action.required) {
+				continue
+			}
+			server := &models.ServerWithDetails{Server: models.Server{ID: "srv_1"}, Role: role}
+			err := action.run(context.Background(), server)
+			if required, ok := services.RequiredRole(err); !ok || required != action.required {
+				t.Errorf("%s as %q: error = %v, want a forbidden error requiring %q", action.name, role, err, action.required)
+			}
+		}
+	}
+}
+
+func TestUpdateServerNameRequiresAdmin(t *testing.T) {
+	store := &serverStore{
+		servers: []models.ServerWithDetails{
+			userServer("srv_own", "web", services.RoleAdmin),
+			userServer("srv_shared", "db", services.RoleViewer),
+		},
+		renamed: make(map[string]string),
+	}
+	users := services.NewUserService(store, nil, nil)
+	ctx := context.Background()
+
+	if err := users.UpdateServerName(ctx, 7, "srv_own", "frontend"); err != nil {
+		t.Fatalf("UpdateServerName as admin: %v", err)
+	}
+	if err := users.UpdateServerName(ctx, 7, "srv_shared", "mine"); !errors.IsErrorCode(err, errors.ErrCodeForbidden) {
+		t.Errorf("UpdateServerName as viewer = %v, want forbidden", err)
+	}
+	if err := users.UpdateServerName(ctx, 7, "srv_other", "mine"); err == nil {
+		t.Error("UpdateServerName of a server missing from the list succeeded")
+	}
+
+	if len(store.renamed) != 1 || store.renamed["srv_own"] != "frontend" {
+		t.Errorf("renamed %v, want only srv_own", store.renamed)
+	}
+}
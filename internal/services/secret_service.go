@@ -0,0 +1,68 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/secrets"
+)
+
+// SecretRotationService re-fetches the secrets referenced in the config file to detect
+// their rotation. The Telegram token, database URL and Redis password are used when
+// connections are opened at startup, so a rotated secret takes effect after a restart.
+type SecretRotationService struct {
+	resolver *secrets.Resolver
+	interval time.Duration
+	logger   Logger
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	refs      map[string]string // reference -> fingerprint of the secret in use
+}
+
+// NewSecretRotationService creates a new secret rotation service re-fetching the secrets
+// of refs every interval. refs maps references to the fingerprints of the secrets loaded.
+func NewSecretRotationService(resolver *secrets.Resolver, refs map[string]string, interval time.Duration, logger Logger) *SecretRotationService {
+	return &SecretRotationService{
+		resolver: resolver,
+		interval: interval,
+		logger:   logger,
+		refs:     refs,
+	}
+}
+
+// Enabled reports whether the config file references secrets to watch
+func (s *SecretRotationService) Enabled() bool {
+	return s.interval > 0 && len(s.refs) > 0
+}
+
+// Check re-fetches the secrets once the interval has passed and returns the references
+// whose secrets changed since the last check. Secrets that cannot be fetched are kept as
+// they are, since the ones in use still work until they expire.
+func (s *SecretRotationService) Check(ctx context.Context, now time.Time) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.checkedAt) < s.interval {
+		return nil
+	}
+	s.checkedAt = now
+
+	var rotated []string
+	for ref, fingerprint := range s.refs {
+		secret, err := s.resolver.Resolve(ctx, ref)
+		if err != nil {
+			s.logger.Warn("Failed to re-fetch secret", "error", err, "reference", ref)
+			continue
+		}
+		if current := secrets.Fingerprint(secret); current != fingerprint {
+			s.refs[ref] = current
+			rotated = append(rotated, ref)
+		}
+	}
+
+	sort.Strings(rotated)
+	return rotated
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/branding"
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/repository"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+// SettingsService manages the preferences of users
+type SettingsService struct {
+	repo   repository.SettingsStore
+	logger Logger
+}
+
+// NewSettingsService creates a new user settings service
+func NewSettingsService(repo repository.SettingsStore, logger Logger) *SettingsService {
+	return &SettingsService{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// Get retrieves the settings of a user
+func (s *SettingsService) Get(ctx context.Context, userID int64) (*models.UserSettings, error) {
+	return s.repo.GetUserSettings(ctx, userID)
+}
+
+// GetByTelegramID retrieves the settings of a user by Telegram ID
+func (s *SettingsService) GetByTelegramID(ctx context.Context, telegramID int64) (*models.UserSettings, error) {
+	return s.repo.GetUserSettingsByTelegramID(ctx, telegramID)
+}
+
+// DefaultServer returns the ID of the server metric commands of a user use when none
+// is given, or "" when unset
+func (s *SettingsService) DefaultServer(ctx context.Context, userID int64) (string, error) {
+	settings, err := s.repo.GetUserSettings(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	return settings.DefaultServerID, nil
+}
+
+// SetDefaultServer makes a server of the user the default target of metric commands
+func (s *SettingsService) SetDefaultServer(ctx context.Context, userID int64, server *models.ServerWithDetails) error {
+	return s.update(ctx, userID, "default_server", func(settings *models.UserSettings) error {
+		settings.DefaultServerID = server.ID
+		return nil
+	})
+}
+
+// ClearDefaultServer makes metric commands of the user ask for a server again
+func (s *SettingsService) ClearDefaultServer(ctx context.Context, userID int64) error {
+	return s.update(ctx, userID, "default_server", func(settings *models.UserSettings) error {
+		settings.DefaultServerID = ""
+		return nil
+	})
+}
+
+// SetLanguage sets the language of the bot's texts for a user, "" for the deployment default
+func (s *SettingsService) SetLanguage(ctx context.Context, userID int64, language string) error {
+	if language != "" && !branding.SupportedLocale(language) {
+		return errors.NewValidationError("unsupported language", map[string]interface{}{"language": language})
+	}
+	return s.update(ctx, userID, "language", func(settings *models.UserSettings) error {
+		settings.Language = language
+		return nil
+	})
+}
+
+// SetCompactMetrics chooses between one-line and detailed metric summaries for a user
+func (s *SettingsService) SetCompactMetrics(ctx context.Context, userID int64, compact bool) error {
+	return s.update(ctx, userID, "compact_metrics", func(settings *models.UserSettings) error {
+		settings.CompactMetrics = compact
+		return nil
+	})
+}
+
+// SetQuietHours makes alerts of a user silent from one hour to another in the user's
+// timezone. The hours may wrap around midnight, e.g. from 23 to 8.
+func (s *SettingsService) SetQuietHours(ctx context.Context, userID int64, from, to int) error {
+	if from < 0 || from > 23 || to < 0 || to > 23 || from == to {
+		return errors.NewValidationError("invalid quiet hours", map[string]interface{}{"from": from, "to": to})
+	}
+	return s.update(ctx, userID, "quiet_hours", func(settings *models.UserSettings) error {
+		settings.QuietFrom, settings.QuietTo = &from, &to
+		return nil
+	})
+}
+
+// ClearQuietHours makes alerts of a user sound at any time
+func (s *SettingsService) ClearQuietHours(ctx context.Context, userID int64) error {
+	return s.update(ctx, userID, "quiet_hours", func(settings *models.UserSettings) error {
+		settings.QuietFrom, settings.QuietTo = nil, nil
+		return nil
+	})
+}
+
+// SetNotifyAlerts chooses whether alerts of a user are published to their notification channels
+func (s *SettingsService) SetNotifyAlerts(ctx context.Context, userID int64, enabled bool) error {
+	return s.update(ctx, userID, "notify_alerts", func(settings *models.UserSettings) error {
+		settings.NotifyAlerts = enabled
+		return nil
+	})
+}
+
+// SetNotifyReports chooses whether reports of a user are published to their notification channels
+func (s *SettingsService) SetNotifyReports(ctx context.Context, userID int64, enabled bool) error {
+	return s.update(ctx, userID, "notify_reports", func(settings *models.UserSettings) error {
+		settings.NotifyReports = enabled
+		return nil
+	})
+}
+
+// update changes a setting of a user and stores the settings
+func (s *SettingsService) update(ctx context.Context, userID int64, name string, change func(*models.UserSettings) error) error {
+	settings, err := s.repo.GetUserSettings(ctx, userID)
+	if err != nil {
+		s.logger.Error("Failed to get user settings", "error", err, "user_id", userID)
+		return err
+	}
+	if err := change(settings); err != nil {
+		return err
+	}
+	if err := s.repo.UpsertUserSettings(ctx, settings); err != nil {
+		s.logger.Error("Failed to store user settings", "error", err, "user_id", userID, "setting", name)
+		return err
+	}
+
+	s.logger.Info("User setting changed", "user_id", userID, "setting", name)
+	return nil
+}
+
+// InQuietHours reports whether alerts of a user should be silent at now
+func InQuietHours(settings *models.UserSettings, now time.Time) bool {
+	if settings == nil || settings.QuietFrom == nil || settings.QuietTo == nil {
+		return false
+	}
+
+	loc, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	hour := now.In(loc).Hour()
+
+	from, to := *settings.QuietFrom, *settings.QuietTo
+	if from < to {
+		return hour >= from && hour < to
+	}
+	return hour >= from || hour < to
+}
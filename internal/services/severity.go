@@ -0,0 +1,100 @@
+package services
+
+import "github.com/servereye/servereyebot/pkg/domain"
+
+// Icons of the severity of metric values
+const (
+	severityOK       = "🟢"
+	severityWarning  = "🟡"
+	severityCritical = "🔴"
+)
+
+// defaultWarningRatio is the share of a threshold at which values are shown as a warning
+// until SetSeverity is called
+const defaultWarningRatio = 0.8
+
+// defaultSeverityThresholds color metrics without an alert threshold, in the units of
+// alertValues. Load is colored against the number of cores instead.
+var defaultSeverityThresholds = map[string]float64{
+	"cpu":         90,
+	"memory":      90,
+	"temperature": 80,
+}
+
+// severityThresholds color metric values the way alerts judge them: values at the alert
+// threshold of their metric are critical, and values at warningRatio of it a warning
+type severityThresholds struct {
+	alerts       *AlertService // nil colors by the default thresholds only
+	warningRatio float64
+}
+
+// severityScale is the set of thresholds the values of one metric message are colored by
+type severityScale struct {
+	thresholds   map[string]float64 // alert thresholds at the time of the message
+	warningRatio float64
+}
+
+// scale reads the current alert thresholds, so values are colored by those alerts are
+// checked against, including after a reload
+func (t *severityThresholds) scale() severityScale {
+	scale := severityScale{warningRatio: t.warningRatio}
+	if t.alerts != nil {
+		scale.thresholds = t.alerts.currentThresholds()
+	}
+	return scale
+}
+
+// threshold returns the critical value of a metric, 0 when the metric is not colored
+func (t severityScale) threshold(metric string, cores int) float64 {
+	if threshold, ok := t.thresholds[metric]; ok {
+		return threshold
+	}
+	if metric == "load" {
+		return float64(cores)
+	}
+	return defaultSeverityThresholds[metric]
+}
+
+// icon returns the severity icon of a metric value, empty when the metric is not colored
+// or has no reading
+func (t severityScale) icon(metric string, value float64, cores int) string {
+	threshold := t.threshold(metric, cores)
+	switch {
+	case threshold <= 0 || (metric == "temperature" && value <= 0):
+		return ""
+	case value >= threshold:
+		return severityCritical
+	case value >= threshold*t.warningRatio:
+		return severityWarning
+	default:
+		return severityOK
+	}
+}
+
+// severityIcons are the severity icons of the values of a metric message, empty for
+// values that are not colored
+type severityIcons struct {
+	CPU         string
+	Memory      string
+	Temperature string
+	Load        string
+}
+
+// SetSeverity colors metric values by the thresholds of the alert service, and sets the
+// share of them at which values are shown as a warning
+func (s *MetricsServiceImpl) SetSeverity(alerts *AlertService, warningRatio float64) {
+	s.severity.Store(&severityThresholds{alerts: alerts, warningRatio: warningRatio})
+}
+
+// severityIcons colors the values of metrics
+func (s *MetricsServiceImpl) severityIcons(metrics *domain.ServerMetrics) severityIcons {
+	t := s.severity.Load().scale()
+	values := alertValues(metrics)
+	cores := metrics.CPUUsage.Cores
+	return severityIcons{
+		CPU:         t.icon("cpu", values["cpu"], cores),
+		Memory:      t.icon("memory", values["memory"], cores),
+		Temperature: t.icon("temperature", values["temperature"], cores),
+		Load:        t.icon("load", values["load"], cores),
+	}
+}
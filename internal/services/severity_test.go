@@ -0,0 +1,35 @@
+package services_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/services"
+)
+
+func TestSeverityFollowsAlertThresholds(t *testing.T) {
+	metrics := newBenchService()
+	alerts := services.NewAlertService(nil, nil, metrics, map[string]float64{"cpu": 40}, time.Minute, nopLogger{})
+	metrics.SetSeverity(alerts, 0.8)
+
+	tests := []struct {
+		name       string
+		thresholds map[string]float64
+		want       string
+	}{
+		{name: "above the alert threshold", thresholds: map[string]float64{"cpu": 40}, want: `42\.5% 🔴`},
+		{name: "near a reloaded threshold", thresholds: map[string]float64{"cpu": 50}, want: `42\.5% 🟡`},
+		{name: "below a reloaded threshold", thresholds: map[string]float64{"cpu": 60}, want: `42\.5% 🟢`},
+		{name: "default without an alert threshold", thresholds: map[string]float64{}, want: `42\.5% 🟢`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alerts.SetDefaults(tt.thresholds, time.Minute)
+			if got := metrics.FormatCPU(sampleMetrics()); !strings.Contains(got, tt.want) {
+				t.Errorf("FormatCPU = %q, want CPU shown as %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/repository"
+	"github.com/servereye/servereyebot/pkg/docker"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// SMARTService shows the SMART health of the drives of user servers and warns about
+// drives likely to fail: a failed self-assessment, growing reallocated, pending or
+// uncorrectable sector counts, or a drive running hot
+type SMARTService struct {
+	docker      *docker.Client
+	targets     repository.UserStore
+	interval    time.Duration
+	temperature int
+	logger      Logger
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	drives    map[string]protocol.SMARTDrive // server ID + drive -> last seen health
+}
+
+// NewSMARTService creates a new SMART service checking drives every interval and
+// alerting when a drive reaches temperature degrees Celsius
+func NewSMARTService(dockerClient *docker.Client, targets repository.UserStore, interval time.Duration, temperature int, logger Logger) *SMARTService {
+	return &SMARTService{
+		docker:      dockerClient,
+		targets:     targets,
+		interval:    interval,
+		temperature: temperature,
+		logger:      logger,
+		drives:      make(map[string]protocol.SMARTDrive),
+	}
+}
+
+// Get retrieves the SMART health of the drives of a server on behalf of a user
+func (s *SMARTService) Get(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails) (*protocol.SMARTResponse, error) {
+	smart, err := s.docker.GetSMART(WithActor(ctx, userID, telegramID), server.ServerKey)
+	if err != nil {
+		s.logger.Error("Failed to get SMART health", "error", err, "server_key", server.ServerKey)
+		return nil, err
+	}
+	return smart, nil
+}
+
+// SetTemperature changes the drive temperature in Celsius alerts are sent at
+func (s *SMARTService) SetTemperature(temperature int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.temperature = temperature
+}
+
+// Check reads the drives of all servers once the check interval has passed and returns
+// warnings about drives whose health got worse since the previous check. The first
+// check of a drive warns only about a failed self-assessment or a high temperature.
+func (s *SMARTService) Check(ctx context.Context, now time.Time) ([]AlertNotification, error) {
+	s.mu.Lock()
+	due := now.Sub(s.checkedAt) >= s.interval
+	if due {
+		s.checkedAt = now
+	}
+	s.mu.Unlock()
+	if !due {
+		return nil, nil
+	}
+
+	targets, err := s.targets.ListAlertTargets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var servers []models.AlertTarget
+	recipients := make(map[string][]int64)
+	for _, target := range targets {
+		if _, ok := recipients[target.ServerID]; !ok {
+			servers = append(servers, target)
+		}
+		recipients[target.ServerID] = append(recipients[target.ServerID], target.TelegramID)
+	}
+
+	var notifications []AlertNotification
+	for _, server := range servers {
+		smart, err := s.docker.GetSMART(ctx, server.ServerKey)
+		if err != nil {
+			s.logger.Warn("Failed to get SMART health for alerts", "error", err, "server_key", server.ServerKey)
+			continue
+		}
+
+		var warnings []string
+		for _, drive := range smart.Drives {
+			if drive.Error != "" {
+				continue
+			}
+			warnings = append(warnings, s.compare(server.ServerID, drive)...)
+		}
+		if len(warnings) == 0 {
+			continue
+		}
+
+		text := fmt.Sprintf("💽 Диски %s(%s) могут скоро отказать\n\n%s\n\nПодробнее: /smart %s", server.Name, server.ServerID, strings.Join(warnings, "\n"), server.ServerID)
+		for _, telegramID := range recipients[server.ServerID] {
+			notifications = append(notifications, AlertNotification{
+				TelegramID: telegramID,
+				ServerIDs:  []string{server.ServerID},
+				Category:   "disk",
+				Text:       text,
+			})
+		}
+	}
+
+	sort.SliceStable(notifications, func(i, j int) bool { return notifications[i].TelegramID < notifications[j].TelegramID })
+	return notifications, nil
+}
+
+// compare records the health of a drive and returns the warnings about changes for the worse
+func (s *SMARTService) compare(serverID string, drive protocol.SMARTDrive) []string {
+	id := drive.Serial
+	if id == "" {
+		id = drive.Device
+	}
+
+	s.mu.Lock()
+	previous, seen := s.drives[serverID+"/"+id]
+	s.drives[serverID+"/"+id] = drive
+	threshold := s.temperature
+	s.mu.Unlock()
+
+	label := smartDriveLabel(drive)
+	var warnings []string
+	if !drive.Passed && (!seen || previous.Passed) {
+		warnings = append(warnings, fmt.Sprintf("🔴 %s: самодиагностика SMART не пройдена, замените диск", label))
+	}
+	if seen {
+		counters := []struct {
+			name            string
+			before, current int64
+		}{
+			{"переназначенных секторов", previous.ReallocatedSectors, drive.ReallocatedSectors},
+			{"ожидающих переназначения секторов", previous.PendingSectors, drive.PendingSectors},
+			{"неисправимых ошибок", previous.UncorrectableSectors, drive.UncorrectableSectors},
+		}
+		for _, counter := range counters {
+			if counter.before >= 0 && counter.current > counter.before {
+				warnings = append(warnings, fmt.Sprintf("🟠 %s: %s стало %d (было %d)", label, counter.name, counter.current, counter.before))
+			}
+		}
+	}
+	if drive.Temperature >= threshold && (!seen || previous.Temperature < threshold) {
+		warnings = append(warnings, fmt.Sprintf("🌡️ %s: температура %d°C (порог %d°C)", label, drive.Temperature, threshold))
+	}
+	return warnings
+}
+
+// FormatSMART formats the SMART health of the drives of a server
+func (s *SMARTService) FormatSMART(server *models.ServerWithDetails, smart *protocol.SMARTResponse, now time.Time) string {
+	if len(smart.Drives) == 0 {
+		return fmt.Sprintf("💽 Агент %s(%s) не нашел дисков с SMART.\n\nНа сервере нужен smartmontools 7.0 или новее.", server.Name, server.ID)
+	}
+
+	s.mu.Lock()
+	threshold := s.temperature
+	s.mu.Unlock()
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("💽 Здоровье дисков %s(%s):\n\n", server.Name, server.ID))
+
+	for _, drive := range smart.Drives {
+		if drive.Error != "" {
+			sb.WriteString(fmt.Sprintf("⚪ %s: не удалось прочитать SMART (%s)\n\n", drive.Device, truncateOutput(drive.Error, 200)))
+			continue
+		}
+
+		icon, status := "🟢", "исправен"
+		switch {
+		case !drive.Passed:
+			icon, status = "🔴", "самодиагностика не пройдена"
+		case drive.ReallocatedSectors > 0 || drive.PendingSectors > 0 || drive.UncorrectableSectors > 0:
+			icon, status = "🟠", "есть поврежденные секторы"
+		case drive.Temperature >= threshold:
+			icon, status = "🌡️", "перегрев"
+		}
+
+		sb.WriteString(fmt.Sprintf("%s %s — %s\n", icon, smartDriveLabel(drive), status))
+		if drive.Serial != "" {
+			sb.WriteString(fmt.Sprintf("   Серийный номер: %s\n", drive.Serial))
+		}
+		sb.WriteString(fmt.Sprintf("   Переназначено: %s, ожидают: %s, неисправимых: %s\n",
+			smartCounter(drive.ReallocatedSectors), smartCounter(drive.PendingSectors), smartCounter(drive.UncorrectableSectors)))
+		if drive.Temperature > 0 {
+			sb.WriteString(fmt.Sprintf("   Температура: %d°C", drive.Temperature))
+		}
+		if drive.PowerOnHours > 0 {
+			if drive.Temperature > 0 {
+				sb.WriteString(", ")
+			} else {
+				sb.WriteString("   ")
+			}
+			sb.WriteString(fmt.Sprintf("наработка: %d ч", drive.PowerOnHours))
+		}
+		if drive.Temperature > 0 || drive.PowerOnHours > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString(fmt.Sprintf("🕐 %s UTC", now.UTC().Format("15:04:05")))
+	return sb.String()
+}
+
+// smartDriveLabel returns the device of a drive with its model
+func smartDriveLabel(drive protocol.SMARTDrive) string {
+	if drive.Model == "" {
+		return drive.Device
+	}
+	return fmt.Sprintf("%s (%s)", drive.Device, drive.Model)
+}
+
+// smartCounter formats a SMART counter, a dash when the drive does not report it
+func smartCounter(value int64) string {
+	if value < 0 {
+		return "—"
+	}
+	return fmt.Sprintf("%d", value)
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/pkg/docker"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+const (
+	// maxListedPorts bounds the listening sockets shown in one message
+	maxListedPorts = 80
+
+	// maxListedRemotes bounds the remote addresses /connections shows
+	maxListedRemotes = 20
+)
+
+// SocketService shows the listening sockets and established connections of user servers
+type SocketService struct {
+	docker *docker.Client
+	logger Logger
+}
+
+// NewSocketService creates a new socket service
+func NewSocketService(dockerClient *docker.Client, logger Logger) *SocketService {
+	return &SocketService{
+		docker: dockerClient,
+		logger: logger,
+	}
+}
+
+// Ports retrieves the listening sockets of a server on behalf of a user
+func (s *SocketService) Ports(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails) (*protocol.PortListResponse, error) {
+	ports, err := s.docker.ListPorts(WithActor(ctx, userID, telegramID), server.ServerKey)
+	if err != nil {
+		s.logger.Error("Failed to list ports", "error", err, "server_key", server.ServerKey)
+		return nil, err
+	}
+	return ports, nil
+}
+
+// Connections retrieves the established connections of a server on behalf of a user
+func (s *SocketService) Connections(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails) (*protocol.ConnectionListResponse, error) {
+	connections, err := s.docker.ListConnections(WithActor(ctx, userID, telegramID), server.ServerKey)
+	if err != nil {
+		s.logger.Error("Failed to list connections", "error", err, "server_key", server.ServerKey)
+		return nil, err
+	}
+	return connections, nil
+}
+
+// FormatPorts formats the listening sockets of a server by port. Sockets reachable from
+// other hosts are marked 🌐, sockets bound to loopback 🔒.
+func (s *SocketService) FormatPorts(server *models.ServerWithDetails, ports *protocol.PortListResponse, now time.Time) string {
+	sockets := append([]protocol.ListeningSocket(nil), ports.Sockets...)
+	sort.SliceStable(sockets, func(i, j int) bool {
+		if sockets[i].Port != sockets[j].Port {
+			return sockets[i].Port < sockets[j].Port
+		}
+		return sockets[i].Protocol < sockets[j].Protocol
+	})
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("🔌 Открытые порты %s(%s):\n\n", server.Name, server.ID))
+	if len(sockets) == 0 {
+		sb.WriteString("Агент не нашел слушающих сокетов.\n")
+	}
+
+	for i, socket := range sockets {
+		if i == maxListedPorts {
+			sb.WriteString(fmt.Sprintf("… и еще %d\n", len(sockets)-maxListedPorts))
+			break
+		}
+
+		mark := "🌐"
+		if isLoopback(socket.Address) {
+			mark = "🔒"
+		}
+		process := "процесс неизвестен"
+		if socket.Process != "" {
+			process = socket.Process
+			if socket.PID > 0 {
+				process += fmt.Sprintf(" (PID %d)", socket.PID)
+			}
+		}
+		sb.WriteString(fmt.Sprintf("%s %s %s — %s\n", mark, socket.Protocol, net.JoinHostPort(socket.Address, fmt.Sprint(socket.Port)), process))
+	}
+
+	sb.WriteString(fmt.Sprintf("\n🌐 доступен извне, 🔒 только локально\n🕐 %s UTC", now.UTC().Format("15:04:05")))
+	return sb.String()
+}
+
+// FormatConnections formats the established connections of a server as counts per
+// remote address, busiest first, with the local ports they connect to
+func (s *SocketService) FormatConnections(server *models.ServerWithDetails, connections *protocol.ConnectionListResponse, now time.Time) string {
+	type remote struct {
+		address string
+		count   int
+		ports   map[int]bool
+	}
+
+	byAddress := make(map[string]*remote)
+	var remotes []*remote
+	for _, connection := range connections.Connections {
+		r := byAddress[connection.RemoteAddress]
+		if r == nil {
+			r = &remote{address: connection.RemoteAddress, ports: make(map[int]bool)}
+			byAddress[connection.RemoteAddress] = r
+			remotes = append(remotes, r)
+		}
+		r.count++
+		r.ports[connection.LocalPort] = true
+	}
+	sort.SliceStable(remotes, func(i, j int) bool {
+		if remotes[i].count != remotes[j].count {
+			return remotes[i].count > remotes[j].count
+		}
+		return remotes[i].address < remotes[j].address
+	})
+
+	total := connections.Total
+	if total < len(connections.Connections) {
+		total = len(connections.Connections)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("🔗 Соединения %s(%s): %d установленных, %d адресов", server.Name, server.ID, total, len(remotes)))
+	if connections.Truncated {
+		sb.WriteString(fmt.Sprintf(" (по первым %d)", len(connections.Connections)))
+	}
+	sb.WriteString(":\n\n")
+	if len(remotes) == 0 {
+		sb.WriteString("Установленных соединений нет.\n")
+	}
+
+	for i, r := range remotes {
+		if i == maxListedRemotes {
+			sb.WriteString(fmt.Sprintf("… и еще %d адресов\n", len(remotes)-maxListedRemotes))
+			break
+		}
+
+		ports := make([]int, 0, len(r.ports))
+		for port := range r.ports {
+			ports = append(ports, port)
+		}
+		sort.Ints(ports)
+		portList := make([]string, 0, len(ports))
+		for j, port := range ports {
+			if j == 5 {
+				portList = append(portList, "…")
+				break
+			}
+			portList = append(portList, fmt.Sprint(port))
+		}
+		sb.WriteString(fmt.Sprintf("%d. %s — %d (порты %s)\n", i+1, r.address, r.count, strings.Join(portList, ", ")))
+	}
+
+	sb.WriteString(fmt.Sprintf("\n🕐 %s UTC", now.UTC().Format("15:04:05")))
+	return sb.String()
+}
+
+// isLoopback reports whether a listening address only accepts local connections
+func isLoopback(address string) bool {
+	ip := net.ParseIP(strings.Trim(address, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
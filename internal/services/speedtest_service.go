@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/pkg/docker"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// SpeedtestService runs bandwidth tests on user servers. A test saturates the link of the
+// server, so tests of a server are at least the cooldown apart, whoever runs them.
+type SpeedtestService struct {
+	docker   *docker.Client
+	endpoint string
+	cooldown time.Duration
+	timeout  time.Duration
+	logger   Logger
+
+	mu      sync.Mutex
+	lastRun map[string]time.Time // server ID -> start of the last test
+}
+
+// NewSpeedtestService creates a new speedtest service
+func NewSpeedtestService(dockerClient *docker.Client, endpoint string, cooldown, timeout time.Duration, logger Logger) *SpeedtestService {
+	return &SpeedtestService{
+		docker:   dockerClient,
+		endpoint: endpoint,
+		cooldown: cooldown,
+		timeout:  timeout,
+		logger:   logger,
+		lastRun:  make(map[string]time.Time),
+	}
+}
+
+// Run measures the latency and bandwidth of a server. Only admins of the server may run
+// tests. While the server is cooling down no test is run and wait reports how long is
+// left; failed tests do not count towards the cooldown.
+func (s *SpeedtestService) Run(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails) (result *protocol.SpeedtestResultResponse, wait time.Duration, err error) {
+	if err := Authorize(server, PermSpeedtest); err != nil {
+		return nil, 0, err
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	previous, ran := s.lastRun[server.ID]
+	if ran && now.Sub(previous) < s.cooldown {
+		s.mu.Unlock()
+		return nil, s.cooldown - now.Sub(previous), nil
+	}
+	s.lastRun[server.ID] = now
+	s.mu.Unlock()
+
+	result, err = s.docker.RunSpeedtest(WithActor(ctx, userID, telegramID), server.ServerKey, s.endpoint, s.timeout)
+	if err != nil {
+		s.logger.Error("Failed to run speedtest", "error", err, "server_key", server.ServerKey)
+
+		s.mu.Lock()
+		if s.lastRun[server.ID].Equal(now) {
+			if ran {
+				s.lastRun[server.ID] = previous
+			} else {
+				delete(s.lastRun, server.ID)
+			}
+		}
+		s.mu.Unlock()
+		return nil, 0, err
+	}
+
+	s.logger.Info("Speedtest completed", "server_id", server.ID, "download_mbps", result.DownloadMbps, "upload_mbps", result.UploadMbps)
+	return result, 0, nil
+}
+
+// Remaining returns how long the server is cooling down from its last test
+func (s *SpeedtestService) Remaining(serverID string, now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if previous, ok := s.lastRun[serverID]; ok && now.Sub(previous) < s.cooldown {
+		return s.cooldown - now.Sub(previous)
+	}
+	return 0
+}
+
+// Timeout returns how long a test may run on the agent
+func (s *SpeedtestService) Timeout() time.Duration {
+	return s.timeout
+}
+
+// FormatSpeedtest formats the result of a bandwidth test
+func FormatSpeedtest(server *models.ServerWithDetails, result *protocol.SpeedtestResultResponse, now time.Time) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("🚀 Скорость сети %s(%s)\n\n", server.Name, server.ID))
+	sb.WriteString(fmt.Sprintf("📶 Задержка: %.1f мс\n", result.LatencyMs))
+	sb.WriteString(fmt.Sprintf("⬇️ Загрузка: %s\n", formatMbps(result.DownloadMbps)))
+	sb.WriteString(fmt.Sprintf("⬆️ Отдача: %s\n", formatMbps(result.UploadMbps)))
+
+	source := result.Tool
+	if result.Server != "" {
+		source += ", " + result.Server
+	}
+	if source != "" {
+		sb.WriteString(fmt.Sprintf("\nИзмерено: %s", source))
+	}
+	sb.WriteString(fmt.Sprintf("\n🕐 %s UTC", now.UTC().Format("15:04:05")))
+	return sb.String()
+}
+
+// formatMbps formats a bandwidth in Mbit/s, switching to Gbit/s for fast links
+func formatMbps(mbps float64) string {
+	if mbps >= 1000 {
+		return fmt.Sprintf("%.2f Гбит/с", mbps/1000)
+	}
+	return fmt.Sprintf("%.1f Мбит/с", mbps)
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/pkg/docker"
+	"github.com/servereye/servereyebot/pkg/errors"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+const (
+	// maxSSHKeyLength bounds a public key line, large enough for 16384-bit RSA keys
+	maxSSHKeyLength = 4096
+
+	// maxSSHKeyComment bounds the comment of a public key
+	maxSSHKeyComment = 100
+)
+
+// SSHPublicKey represents a validated SSH public key
+type SSHPublicKey struct {
+	Type        string
+	Comment     string
+	Fingerprint string // SHA256:... as printed by ssh-keygen -l
+	Bits        int    // modulus size of RSA keys, 0 for other types
+	Line        string // normalized authorized_keys line
+}
+
+// SSHKeyService pushes SSH public keys to the authorized_keys file of agents, giving
+// team members emergency access without a shared password. Only server owners may push
+// keys, and every attempt is recorded in the audit log.
+type SSHKeyService struct {
+	docker       *docker.Client
+	audit        *AuditService
+	allowedTypes map[string]bool
+	minRSABits   int
+	logger       Logger
+}
+
+// NewSSHKeyService creates a new SSH key service accepting keys of the given algorithms
+func NewSSHKeyService(dockerClient *docker.Client, audit *AuditService, allowedTypes []string, minRSABits int, logger Logger) *SSHKeyService {
+	types := make(map[string]bool, len(allowedTypes))
+	for _, t := range allowedTypes {
+		types[t] = true
+	}
+
+	return &SSHKeyService{
+		docker:       dockerClient,
+		audit:        audit,
+		allowedTypes: types,
+		minRSABits:   minRSABits,
+		logger:       logger,
+	}
+}
+
+// Parse validates a public key in authorized_keys format. Options such as command= or
+// from= are rejected, as are keys whose encoded algorithm differs from the declared one.
+func (s *SSHKeyService) Parse(line string) (*SSHPublicKey, error) {
+	line = strings.TrimSpace(line)
+	if len(line) > maxSSHKeyLength {
+		return nil, errors.NewValidationError("public key too long", map[string]interface{}{"length": len(line), "max": maxSSHKeyLength})
+	}
+	if strings.ContainsAny(line, "\r\n\x00") {
+		return nil, errors.NewValidationError("public key must be a single line", nil)
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return nil, errors.NewValidationError("expected '<type> <base64 key> [comment]'", nil)
+	}
+
+	keyType := fields[0]
+	if !s.allowedTypes[keyType] {
+		return nil, errors.NewValidationError("key type not allowed", map[string]interface{}{"type": keyType})
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, errors.NewValidationError("key is not valid base64", nil)
+	}
+
+	encodedType, rest, ok := readSSHString(blob)
+	if !ok || string(encodedType) != keyType {
+		return nil, errors.NewValidationError("key data does not match its type", map[string]interface{}{"type": keyType})
+	}
+
+	sum := sha256.Sum256(blob)
+	key := &SSHPublicKey{
+		Type:        keyType,
+		Comment:     strings.Join(fields[2:], " "),
+		Fingerprint: "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:]),
+	}
+
+	if keyType == "ssh-rsa" {
+		_, rest, ok = readSSHString(rest) // public exponent
+		modulus, _, okModulus := readSSHString(rest)
+		if !ok || !okModulus {
+			return nil, errors.NewValidationError("malformed RSA key", nil)
+		}
+		key.Bits = new(big.Int).SetBytes(modulus).BitLen()
+		if key.Bits < s.minRSABits {
+			return nil, errors.NewValidationError("RSA key too short", map[string]interface{}{"bits": key.Bits, "min": s.minRSABits})
+		}
+	}
+
+	if len(key.Comment) > maxSSHKeyComment || strings.IndexFunc(key.Comment, func(r rune) bool { return !unicode.IsPrint(r) }) >= 0 {
+		return nil, errors.NewValidationError("invalid key comment", nil)
+	}
+
+	key.Line = keyType + " " + fields[1]
+	if key.Comment != "" {
+		key.Line += " " + key.Comment
+	}
+	return key, nil
+}
+
+// Push authorizes a validated key on a server on behalf of its owner
+func (s *SSHKeyService) Push(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails, key *SSHPublicKey) (*protocol.SSHKeyPushedResponse, error) {
+	if err := Authorize(server, PermSSHKeys); err != nil {
+		s.logger.Warn("Rejected SSH key push", "server_id", server.ID, "telegram_id", telegramID, "fingerprint", key.Fingerprint)
+		s.audit.RecordResult(ctx, userID, telegramID, server.ServerKey, AuditCommandSSHKeyDenied, key.Fingerprint, "", time.Now(), err)
+		return nil, err
+	}
+
+	pushed, err := s.docker.PushSSHKey(WithActor(ctx, userID, telegramID), server.ServerKey, key.Line, key.Fingerprint)
+	if err != nil {
+		s.logger.Error("Failed to push SSH key", "error", err, "server_id", server.ID, "fingerprint", key.Fingerprint)
+		return nil, err
+	}
+
+	s.logger.Info("SSH key pushed", "server_id", server.ID, "telegram_id", telegramID, "fingerprint", key.Fingerprint, "added", pushed.Added)
+	return pushed, nil
+}
+
+// readSSHString reads a length-prefixed string of the SSH wire format
+func readSSHString(data []byte) (value, rest []byte, ok bool) {
+	if len(data) < 4 {
+		return nil, nil, false
+	}
+	length := binary.BigEndian.Uint32(data)
+	if uint64(length) > uint64(len(data)-4) {
+		return nil, nil, false
+	}
+	return data[4 : 4+length], data[4+length:], true
+}
+
+// FormatSSHKeyPushed formats the result of a key push
+func FormatSSHKeyPushed(server *models.ServerWithDetails, key *SSHPublicKey, pushed *protocol.SSHKeyPushedResponse) string {
+	label := key.Type
+	if key.Bits > 0 {
+		label = fmt.Sprintf("%s %d", key.Type, key.Bits)
+	}
+	if key.Comment != "" {
+		label += ", " + key.Comment
+	}
+
+	if !pushed.Added {
+		return fmt.Sprintf("ℹ️ Ключ %s (%s) уже добавлен в %s на %s(%s).", key.Fingerprint, label, pushed.File, server.Name, server.ID)
+	}
+	return fmt.Sprintf("🔑 Ключ %s (%s) добавлен в %s на %s(%s).\n\nДействие записано в /audit. Не забудьте удалить ключ, когда доступ станет не нужен.", key.Fingerprint, label, pushed.File, server.Name, server.ID)
+}
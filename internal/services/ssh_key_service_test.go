@@ -0,0 +1,95 @@
+package services_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/servereye/servereyebot/internal/services"
+)
+
+// sshKeyBlob encodes strings in the SSH wire format of a public key, base64 encoded
+func sshKeyBlob(parts ...[]byte) string {
+	var blob bytes.Buffer
+	for _, part := range parts {
+		binary.Write(&blob, binary.BigEndian, uint32(len(part)))
+		blob.Write(part)
+	}
+	return base64.StdEncoding.EncodeToString(blob.Bytes())
+}
+
+// rsaModulus returns a modulus of the given bit length
+func rsaModulus(bits int) []byte {
+	modulus := bytes.Repeat([]byte{0xff}, bits/8)
+	return append([]byte{0}, modulus...)
+}
+
+func TestSSHKeyParse(t *testing.T) {
+	svc := services.NewSSHKeyService(nil, nil, []string{"ssh-ed25519", "ssh-rsa"}, 3072, nopLogger{})
+
+	ed25519 := sshKeyBlob([]byte("ssh-ed25519"), bytes.Repeat([]byte{7}, 32))
+	rsa4096 := sshKeyBlob([]byte("ssh-rsa"), []byte{1, 0, 1}, rsaModulus(4096))
+	rsa2048 := sshKeyBlob([]byte("ssh-rsa"), []byte{1, 0, 1}, rsaModulus(2048))
+	ecdsa := sshKeyBlob([]byte("ecdsa-sha2-nistp256"), []byte("nistp256"), bytes.Repeat([]byte{4}, 65))
+
+	tests := []struct {
+		name    string
+		line    string
+		wantErr bool
+		bits    int
+		comment string
+	}{
+		{name: "ed25519 with comment", line: "ssh-ed25519 " + ed25519 + " alice@laptop", comment: "alice@laptop"},
+		{name: "ed25519 without comment", line: "  ssh-ed25519 " + ed25519 + "\t"},
+		{name: "comment with spaces", line: "ssh-ed25519 " + ed25519 + " alice  work laptop", comment: "alice work laptop"},
+		{name: "long RSA key", line: "ssh-rsa " + rsa4096 + " bob", bits: 4096, comment: "bob"},
+		{name: "short RSA key", line: "ssh-rsa " + rsa2048, wantErr: true},
+		{name: "type not allowed", line: "ecdsa-sha2-nistp256 " + ecdsa, wantErr: true},
+		{name: "options", line: `command="reboot" ssh-ed25519 ` + ed25519, wantErr: true},
+		{name: "declared type differs", line: "ssh-rsa " + ed25519, wantErr: true},
+		{name: "invalid base64", line: "ssh-ed25519 not*base64", wantErr: true},
+		{name: "truncated data", line: "ssh-ed25519 " + base64.StdEncoding.EncodeToString([]byte{0, 0, 1, 0, 's'}), wantErr: true},
+		{name: "malformed RSA key", line: "ssh-rsa " + sshKeyBlob([]byte("ssh-rsa"), []byte{1, 0, 1}), wantErr: true},
+		{name: "key only", line: "ssh-ed25519", wantErr: true},
+		{name: "several lines", line: "ssh-ed25519 " + ed25519 + "\nssh-ed25519 " + ed25519, wantErr: true},
+		{name: "control character in comment", line: "ssh-ed25519 " + ed25519 + " alice\x1b[31m", wantErr: true},
+		{name: "long comment", line: "ssh-ed25519 " + ed25519 + " " + strings.Repeat("a", 101), wantErr: true},
+		{name: "too long", line: "ssh-ed25519 " + ed25519 + " " + strings.Repeat("a", 4096), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := svc.Parse(tt.line)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Parse = %+v, want an error", key)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+
+			fields := strings.Fields(tt.line)
+			blob, _ := base64.StdEncoding.DecodeString(fields[1])
+			sum := sha256.Sum256(blob)
+			if want := "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:]); key.Fingerprint != want {
+				t.Errorf("fingerprint %q, want %q", key.Fingerprint, want)
+			}
+			if key.Type != fields[0] || key.Bits != tt.bits || key.Comment != tt.comment {
+				t.Errorf("Parse = %s, %d bits, comment %q, want %s, %d bits, comment %q", key.Type, key.Bits, key.Comment, fields[0], tt.bits, tt.comment)
+			}
+
+			wantLine := fields[0] + " " + fields[1]
+			if tt.comment != "" {
+				wantLine += " " + tt.comment
+			}
+			if key.Line != wantLine {
+				t.Errorf("line %q, want %q", key.Line, wantLine)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/pkg/docker"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// maxListedUpdates limits the packages listed in update reports
+const maxListedUpdates = 30
+
+// UpdatesService reports pending OS package updates of servers and installs security
+// updates on behalf of owners
+type UpdatesService struct {
+	docker *docker.Client
+	logger Logger
+}
+
+// NewUpdatesService creates a new updates service
+func NewUpdatesService(dockerClient *docker.Client, logger Logger) *UpdatesService {
+	return &UpdatesService{
+		docker: dockerClient,
+		logger: logger,
+	}
+}
+
+// Get retrieves the pending package updates of a server on behalf of a user
+func (s *UpdatesService) Get(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails) (*protocol.UpdatesResponse, error) {
+	updates, err := s.docker.GetUpdates(WithActor(ctx, userID, telegramID), server.ServerKey)
+	if err != nil {
+		s.logger.Error("Failed to get package updates", "error", err, "server_key", server.ServerKey)
+		return nil, err
+	}
+	return updates, nil
+}
+
+// ApplySecurity installs the pending security updates of a server. Only owners may
+// install updates.
+func (s *UpdatesService) ApplySecurity(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails) (*protocol.UpdatesAppliedResponse, error) {
+	if err := Authorize(server, PermUpdates); err != nil {
+		return nil, err
+	}
+
+	applied, err := s.docker.ApplySecurityUpdates(WithActor(ctx, userID, telegramID), server.ServerKey)
+	if err != nil {
+		s.logger.Error("Failed to apply security updates", "error", err, "server_key", server.ServerKey)
+		return nil, err
+	}
+
+	s.logger.Info("Security updates applied", "server_key", server.ServerKey, "telegram_id", telegramID, "count", len(applied.Upgraded))
+	return applied, nil
+}
+
+// SecurityUpdates counts the pending security updates
+func SecurityUpdates(updates *protocol.UpdatesResponse) int {
+	count := 0
+	for _, pkg := range updates.Packages {
+		if pkg.Security {
+			count++
+		}
+	}
+	return count
+}
+
+// FormatUpdates formats the pending updates of a server, security updates first
+func FormatUpdates(server *models.ServerWithDetails, updates *protocol.UpdatesResponse) string {
+	if len(updates.Packages) == 0 {
+		text := fmt.Sprintf("✅ На %s(%s) нет ожидающих обновлений пакетов (%s).", server.Name, server.ID, updates.Manager)
+		if updates.RebootRequired {
+			text += "\n\n🔁 После прошлых обновлений нужна перезагрузка."
+		}
+		return text
+	}
+
+	security := SecurityUpdates(updates)
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("📦 Обновления пакетов на %s(%s), %s\n\n", server.Name, server.ID, updates.Manager))
+	sb.WriteString(fmt.Sprintf("Всего: %d, из них безопасности: %d\n", len(updates.Packages), security))
+	if updates.RebootRequired {
+		sb.WriteString("🔁 Нужна перезагрузка\n")
+	}
+	sb.WriteString("\n")
+
+	listed := 0
+	for _, securityPass := range []bool{true, false} {
+		for _, pkg := range updates.Packages {
+			if pkg.Security != securityPass || listed >= maxListedUpdates {
+				continue
+			}
+			listed++
+
+			icon := "▫️"
+			if pkg.Security {
+				icon = "🛡"
+			}
+			version := pkg.NewVersion
+			if pkg.CurrentVersion != "" {
+				version = pkg.CurrentVersion + " → " + pkg.NewVersion
+			}
+			sb.WriteString(fmt.Sprintf("%s %s %s\n", icon, pkg.Name, version))
+		}
+	}
+	if hidden := len(updates.Packages) - listed; hidden > 0 {
+		sb.WriteString(fmt.Sprintf("…и еще %d\n", hidden))
+	}
+
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// FormatSecurityApplied formats the outcome of installing security updates
+func FormatSecurityApplied(server *models.ServerWithDetails, applied *protocol.UpdatesAppliedResponse) string {
+	if len(applied.Upgraded) == 0 {
+		return fmt.Sprintf("✅ На %s(%s) нет обновлений безопасности для установки.", server.Name, server.ID)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("🛡 На %s(%s) установлены обновления безопасности: %d\n\n", server.Name, server.ID, len(applied.Upgraded)))
+	for i, name := range applied.Upgraded {
+		if i >= maxListedUpdates {
+			sb.WriteString(fmt.Sprintf("…и еще %d\n", len(applied.Upgraded)-i))
+			break
+		}
+		sb.WriteString(fmt.Sprintf("- %s\n", name))
+	}
+	if applied.RebootRequired {
+		sb.WriteString("\n🔁 Для применения обновлений нужна перезагрузка сервера.")
+	}
+
+	return strings.TrimRight(sb.String(), "\n")
+}
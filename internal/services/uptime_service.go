@@ -0,0 +1,509 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/repository"
+	"github.com/servereye/servereyebot/internal/uptime"
+	"github.com/servereye/servereyebot/pkg/docker"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+const (
+	// MinUptimeInterval is the shortest interval of an uptime check, the scheduler
+	// tick runs checks no more often anyway
+	MinUptimeInterval = time.Minute
+
+	// MaxUptimeInterval is the longest interval of an uptime check
+	MaxUptimeInterval = 24 * time.Hour
+
+	// maxUptimeChecks bounds the uptime checks of a user
+	maxUptimeChecks = 20
+
+	// uptimeTimeout bounds a single probe
+	uptimeTimeout = 10 * time.Second
+
+	// uptimeRetention is how long probe results are kept
+	uptimeRetention = 7 * 24 * time.Hour
+
+	// uptimeWorkers bounds the probes run at the same time
+	uptimeWorkers = 8
+
+	// uptimeHistoryShown bounds the probes listed by /check history
+	uptimeHistoryShown = 15
+
+	// maxUptimeError bounds the stored error of a probe
+	maxUptimeError = 200
+)
+
+// UptimeService runs HTTP and TCP checks of endpoints on schedule and alerts their users
+// when an endpoint goes down or recovers. Checks of public endpoints are run by the bot,
+// checks bound to a server by its agent, which reaches endpoints of the server network.
+type UptimeService struct {
+	repo    repository.UptimeCheckStore
+	targets repository.UserStore
+	docker  *docker.Client
+	prober  *uptime.Prober
+	private bool // bot-run checks may target private addresses
+	logger  Logger
+
+	mu       sync.Mutex
+	checks   map[int64]*models.UptimeCheck
+	prunedAt time.Time
+}
+
+// NewUptimeService creates a new uptime service. Unless allowPrivate is set, checks run
+// by the bot may only target public addresses.
+func NewUptimeService(repo repository.UptimeCheckStore, targets repository.UserStore, dockerClient *docker.Client, allowPrivate bool, logger Logger) *UptimeService {
+	return &UptimeService{
+		repo:    repo,
+		targets: targets,
+		docker:  dockerClient,
+		prober:  uptime.NewProber(allowPrivate),
+		private: allowPrivate,
+		logger:  logger,
+		checks:  make(map[int64]*models.UptimeCheck),
+	}
+}
+
+// Load loads the uptime checks of all users from the database
+func (s *UptimeService) Load(ctx context.Context) error {
+	stored, err := s.repo.ListUptimeChecks(ctx)
+	if err != nil {
+		return err
+	}
+
+	checks := make(map[int64]*models.UptimeCheck, len(stored))
+	for i := range stored {
+		checks[stored[i].ID] = &stored[i]
+	}
+
+	s.mu.Lock()
+	s.checks = checks
+	s.mu.Unlock()
+
+	s.logger.Info("Uptime checks loaded", "count", len(stored))
+	return nil
+}
+
+// Add stores an uptime check of a user. The agent of server runs it, or the bot when
+// server is nil, in which case the target must resolve to public addresses unless
+// private ones are allowed.
+func (s *UptimeService) Add(ctx context.Context, telegramID int64, server *models.ServerWithDetails, target uptime.Target, interval time.Duration) (*models.UptimeCheck, error) {
+	if server != nil {
+		if err := Authorize(server, PermUptime); err != nil {
+			return nil, err
+		}
+	}
+	if interval < MinUptimeInterval || interval > MaxUptimeInterval {
+		return nil, errors.NewValidationError("check interval out of range", map[string]interface{}{"interval": interval.String()})
+	}
+
+	s.mu.Lock()
+	count := 0
+	for _, check := range s.checks {
+		if check.TelegramID == telegramID {
+			count++
+		}
+	}
+	s.mu.Unlock()
+	if count >= maxUptimeChecks {
+		return nil, errors.NewValidationError("too many uptime checks", map[string]interface{}{"telegram_id": telegramID, "max": maxUptimeChecks})
+	}
+
+	check := &models.UptimeCheck{
+		TelegramID:      telegramID,
+		Kind:            target.Kind,
+		Target:          target.Address,
+		IntervalSeconds: int(interval / time.Second),
+	}
+	if server != nil {
+		check.ServerID = server.ID
+	} else if !s.private {
+		if err := s.requirePublic(ctx, target); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.repo.AddUptimeCheck(ctx, check); err != nil {
+		s.logger.Error("Failed to save uptime check", "error", err, "telegram_id", telegramID, "target", target.String())
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.checks[check.ID] = check
+	s.mu.Unlock()
+
+	s.logger.Info("Uptime check added", "id", check.ID, "telegram_id", telegramID, "server_id", check.ServerID, "target", target.String(), "interval", interval)
+	return check, nil
+}
+
+// requirePublic rejects targets of bot-run checks that do not resolve to public addresses.
+// The prober enforces this on every connection as well, this only tells users early.
+func (s *UptimeService) requirePublic(ctx context.Context, target uptime.Target) error {
+	host := target.Address
+	if target.Kind == uptime.KindHTTP {
+		if u, err := url.Parse(target.Address); err == nil {
+			host = u.Hostname()
+		}
+	} else if h, _, err := net.SplitHostPort(target.Address); err == nil {
+		host = h
+	}
+
+	lookupCtx, cancel := context.WithTimeout(ctx, uptimeTimeout)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(lookupCtx, host)
+	if err != nil {
+		return errors.NewValidationError("target host does not resolve", map[string]interface{}{"host": host})
+	}
+	for _, addr := range addrs {
+		if !uptime.IsPublic(addr.IP) {
+			return errors.NewForbiddenError("target resolves to a private address")
+		}
+	}
+	return nil
+}
+
+// Get returns an uptime check by ID
+func (s *UptimeService) Get(id int64) (*models.UptimeCheck, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	check, ok := s.checks[id]
+	if !ok {
+		return nil, false
+	}
+	copied := *check
+	return &copied, true
+}
+
+// Remove removes an uptime check with its history, reporting whether it existed
+func (s *UptimeService) Remove(ctx context.Context, id int64) (bool, error) {
+	removed, err := s.repo.DeleteUptimeCheck(ctx, id)
+	if err != nil {
+		s.logger.Error("Failed to remove uptime check", "error", err, "id", id)
+		return false, err
+	}
+
+	s.mu.Lock()
+	delete(s.checks, id)
+	s.mu.Unlock()
+
+	return removed, nil
+}
+
+// List returns the uptime checks a user added, or those bound to one of serverIDs
+func (s *UptimeService) List(telegramID int64, serverIDs ...string) []models.UptimeCheck {
+	servers := make(map[string]bool, len(serverIDs))
+	for _, id := range serverIDs {
+		servers[id] = true
+	}
+
+	s.mu.Lock()
+	var checks []models.UptimeCheck
+	for _, check := range s.checks {
+		if check.TelegramID == telegramID || check.ServerID != "" && servers[check.ServerID] {
+			checks = append(checks, *check)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(checks, func(i, j int) bool { return checks[i].ID < checks[j].ID })
+	return checks
+}
+
+// History retrieves the probes of a check of the last day, newest first
+func (s *UptimeService) History(ctx context.Context, id int64, now time.Time) ([]models.UptimeResult, error) {
+	return s.repo.ListUptimeResults(ctx, id, now.Add(-24*time.Hour))
+}
+
+// Run probes the checks that are due and returns alerts about checks that went down or
+// recovered. The first result of a check alerts only when the endpoint is down. Checks
+// bound to a server are skipped while their user no longer has the server.
+func (s *UptimeService) Run(ctx context.Context, now time.Time) ([]AlertNotification, error) {
+	s.prune(ctx, now)
+
+	s.mu.Lock()
+	var due []models.UptimeCheck
+	for _, check := range s.checks {
+		interval := time.Duration(check.IntervalSeconds) * time.Second
+		// A second of slack keeps checks on the scheduler tick they were added on
+		if check.CheckedAt == nil || now.Sub(*check.CheckedAt) >= interval-time.Second {
+			due = append(due, *check)
+		}
+	}
+	s.mu.Unlock()
+	if len(due) == 0 {
+		return nil, nil
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].ID < due[j].ID })
+
+	servers, err := s.serverKeys(ctx, due)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		wg            sync.WaitGroup
+		resultsMu     sync.Mutex
+		notifications []AlertNotification
+		slots         = make(chan struct{}, uptimeWorkers)
+	)
+	for _, check := range due {
+		serverKey := ""
+		if check.ServerID != "" {
+			var ok bool
+			if serverKey, ok = servers[uptimeServerKey(check.TelegramID, check.ServerID)]; !ok {
+				continue
+			}
+		}
+
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(check models.UptimeCheck, serverKey string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			notification, ok := s.probe(ctx, check, serverKey, now)
+			if !ok {
+				return
+			}
+			resultsMu.Lock()
+			notifications = append(notifications, notification)
+			resultsMu.Unlock()
+		}(check, serverKey)
+	}
+	wg.Wait()
+
+	sort.SliceStable(notifications, func(i, j int) bool { return notifications[i].TelegramID < notifications[j].TelegramID })
+	return notifications, nil
+}
+
+// serverKeys returns the agent keys of the servers of agent-run checks, by user and server
+func (s *UptimeService) serverKeys(ctx context.Context, checks []models.UptimeCheck) (map[string]string, error) {
+	keys := make(map[string]string)
+	needed := false
+	for _, check := range checks {
+		needed = needed || check.ServerID != ""
+	}
+	if !needed {
+		return keys, nil
+	}
+
+	targets, err := s.targets.ListAlertTargets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, target := range targets {
+		keys[uptimeServerKey(target.TelegramID, target.ServerID)] = target.ServerKey
+	}
+	return keys, nil
+}
+
+// uptimeServerKey identifies a server of a user
+func uptimeServerKey(telegramID int64, serverID string) string {
+	return fmt.Sprintf("%d/%s", telegramID, serverID)
+}
+
+// probe runs a check once, stores the result and returns the alert due for a state change
+func (s *UptimeService) probe(ctx context.Context, check models.UptimeCheck, serverKey string, now time.Time) (AlertNotification, bool) {
+	var result uptime.Result
+	if serverKey == "" {
+		result = s.prober.Probe(ctx, uptime.Target{Kind: check.Kind, Address: check.Target}, uptimeTimeout)
+	} else {
+		response, err := s.docker.RunUptimeCheck(ctx, serverKey, check.Kind, check.Target, uptimeTimeout)
+		if err != nil {
+			// An agent that does not answer says nothing about the endpoint
+			s.logger.Warn("Failed to run uptime check on agent", "error", err, "id", check.ID, "server_id", check.ServerID)
+			return AlertNotification{}, false
+		}
+		result = uptime.Result{
+			Up:         response.Up,
+			Latency:    time.Duration(response.LatencyMs) * time.Millisecond,
+			StatusCode: response.StatusCode,
+			Error:      response.Error,
+		}
+	}
+
+	stored := &models.UptimeResult{
+		CheckID:    check.ID,
+		Up:         result.Up,
+		LatencyMs:  result.Latency.Milliseconds(),
+		StatusCode: result.StatusCode,
+		Error:      truncateOutput(result.Error, maxUptimeError),
+		CheckedAt:  now,
+	}
+
+	previous := check.Up
+	since := check.ChangedAt
+	checkedAt := now
+	up := result.Up
+	check.Up = &up
+	check.CheckedAt = &checkedAt
+	if previous == nil || *previous != up {
+		check.ChangedAt = &checkedAt
+	}
+
+	if err := s.repo.RecordUptimeResult(ctx, stored, &check); err != nil {
+		s.logger.Error("Failed to store uptime result", "error", err, "id", check.ID)
+	}
+
+	s.mu.Lock()
+	if current, ok := s.checks[check.ID]; ok {
+		current.Up, current.CheckedAt, current.ChangedAt = check.Up, check.CheckedAt, check.ChangedAt
+	}
+	s.mu.Unlock()
+
+	if previous == nil && up || previous != nil && *previous == up {
+		return AlertNotification{}, false
+	}
+
+	notification := AlertNotification{
+		TelegramID: check.TelegramID,
+		Category:   AlertCategoryUptime,
+		Text:       formatUptimeChange(check, stored, since, now),
+	}
+	if check.ServerID != "" {
+		notification.ServerIDs = []string{check.ServerID}
+	}
+	return notification, true
+}
+
+// prune removes old probe results once an hour
+func (s *UptimeService) prune(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	due := now.Sub(s.prunedAt) >= time.Hour
+	if due {
+		s.prunedAt = now
+	}
+	s.mu.Unlock()
+	if !due {
+		return
+	}
+
+	removed, err := s.repo.DeleteUptimeResultsBefore(ctx, now.Add(-uptimeRetention))
+	if err != nil {
+		s.logger.Error("Failed to prune uptime results", "error", err)
+		return
+	}
+	if removed > 0 {
+		s.logger.Info("Uptime results pruned", "count", removed)
+	}
+}
+
+// uptimeTarget returns the target of a check as users enter it
+func uptimeTarget(check models.UptimeCheck) string {
+	return uptime.Target{Kind: check.Kind, Address: check.Target}.String()
+}
+
+// uptimeRunner describes where a check runs
+func uptimeRunner(check models.UptimeCheck) string {
+	if check.ServerID == "" {
+		return "бот"
+	}
+	return "агент " + check.ServerID
+}
+
+// formatUptimeChange formats the alert about a check that went down or recovered
+func formatUptimeChange(check models.UptimeCheck, result *models.UptimeResult, since *time.Time, now time.Time) string {
+	if result.Up {
+		text := fmt.Sprintf("🟢 Снова доступен: %s (#%d, %d мс)", uptimeTarget(check), check.ID, result.LatencyMs)
+		if since != nil {
+			text += fmt.Sprintf("\nПростой: %s", now.Sub(*since).Round(time.Second))
+		}
+		return text
+	}
+
+	text := fmt.Sprintf("🔴 Недоступен: %s (#%d, проверяет %s)", uptimeTarget(check), check.ID, uptimeRunner(check))
+	if result.Error != "" {
+		text += "\nОшибка: " + result.Error
+	}
+	return text + fmt.Sprintf("\n\nИстория: /check history %d", check.ID)
+}
+
+// FormatUptimeChecks formats uptime checks with their state
+func FormatUptimeChecks(checks []models.UptimeCheck, now time.Time) string {
+	if len(checks) == 0 {
+		return "🌐 Проверок доступности нет.\n\nДобавьте: /check add https://example.com 60s"
+	}
+
+	var sb strings.Builder
+	sb.WriteString("🌐 Проверки доступности:\n\n")
+	for _, check := range checks {
+		sb.WriteString(formatUptimeCheck(check, now) + "\n")
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// formatUptimeCheck formats a single check with its state
+func formatUptimeCheck(check models.UptimeCheck, now time.Time) string {
+	icon, state := "⚪", "еще не проверялась"
+	if check.Up != nil {
+		icon, state = "🟢", "доступен"
+		if !*check.Up {
+			icon, state = "🔴", "недоступен"
+		}
+		if check.ChangedAt != nil {
+			state += " " + now.Sub(*check.ChangedAt).Round(time.Second).String()
+		}
+	}
+
+	interval := time.Duration(check.IntervalSeconds) * time.Second
+	return fmt.Sprintf("%s #%d %s — %s\n   каждые %s, проверяет %s", icon, check.ID, uptimeTarget(check), state, interval, uptimeRunner(check))
+}
+
+// FormatUptimeHistory formats the probes of a check of the last day, newest first
+func FormatUptimeHistory(check models.UptimeCheck, results []models.UptimeResult, now time.Time) string {
+	var sb strings.Builder
+	sb.WriteString(formatUptimeCheck(check, now) + "\n\n")
+
+	if len(results) == 0 {
+		sb.WriteString("За последние сутки проверок не было.")
+		return sb.String()
+	}
+
+	up := 0
+	var latency int64
+	for _, result := range results {
+		if result.Up {
+			up++
+			latency += result.LatencyMs
+		}
+	}
+	sb.WriteString(fmt.Sprintf("За сутки: доступность %.2f%% (%d из %d)", float64(up)*100/float64(len(results)), up, len(results)))
+	if up > 0 {
+		sb.WriteString(fmt.Sprintf(", среднее время ответа %d мс", latency/int64(up)))
+	}
+	sb.WriteString("\n\nПоследние проверки:\n")
+
+	for i, result := range results {
+		if i == uptimeHistoryShown {
+			sb.WriteString(fmt.Sprintf("… и еще %d\n", len(results)-i))
+			break
+		}
+
+		icon := "🟢"
+		if !result.Up {
+			icon = "🔴"
+		}
+		sb.WriteString(fmt.Sprintf("%s %s UTC — %d мс", icon, result.CheckedAt.UTC().Format("02.01 15:04"), result.LatencyMs))
+		if result.StatusCode != 0 {
+			sb.WriteString(fmt.Sprintf(", HTTP %d", result.StatusCode))
+		}
+		if result.Error != "" && result.StatusCode == 0 {
+			sb.WriteString(", " + result.Error)
+		}
+		sb.WriteString("\n")
+	}
+
+	return strings.TrimRight(sb.String(), "\n")
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+)
+
+// userCacheEntry represents a cached user with its expiration time
+type userCacheEntry struct {
+	user      models.User
+	expiresAt time.Time
+}
+
+// UserCache is an LRU cache of users keyed by Telegram ID with a per-entry TTL
+type UserCache struct {
+	size    int
+	ttl     time.Duration
+	mu      sync.Mutex
+	order   *list.List              // most recently used at the front
+	entries map[int64]*list.Element // Telegram ID -> element holding *userCacheEntry
+}
+
+// NewUserCache creates a new user cache holding up to size users for ttl.
+// A cache with non-positive size or ttl stores nothing.
+func NewUserCache(size int, ttl time.Duration) *UserCache {
+	return &UserCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[int64]*list.Element),
+	}
+}
+
+// Get returns a copy of a cached user by Telegram ID
+func (c *UserCache) Get(telegramID int64) (*models.User, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[telegramID]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*userCacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.entries, telegramID)
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+	user := entry.user
+	return &user, true
+}
+
+// Set stores a copy of a user, evicting the least recently used user when full
+func (c *UserCache) Set(user *models.User) {
+	if c.size <= 0 || c.ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &userCacheEntry{user: *user, expiresAt: time.Now().Add(c.ttl)}
+	if elem, ok := c.entries[user.TelegramID]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[user.TelegramID] = c.order.PushFront(entry)
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*userCacheEntry).user.TelegramID)
+	}
+}
+
+// Invalidate removes a user from the cache
+func (c *UserCache) Invalidate(telegramID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[telegramID]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, telegramID)
+	}
+}
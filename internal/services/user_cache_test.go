@@ -0,0 +1,137 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/repository"
+	"github.com/servereye/servereyebot/internal/services"
+)
+
+// userStore keeps users in memory and counts the queries and writes reaching it
+type userStore struct {
+	repository.UserStore
+
+	users  map[int64]models.User
+	reads  int
+	writes int
+}
+
+func (s *userStore) GetUser(telegramID int64) (*models.User, error) {
+	s.reads++
+	user := s.users[telegramID]
+	return &user, nil
+}
+
+func (s *userStore) CreateUser(user *models.User) error {
+	s.writes++
+	s.users[user.TelegramID] = *user
+	return nil
+}
+
+func TestUserCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := services.NewUserCache(2, time.Minute)
+	cache.Set(&models.User{TelegramID: 1, Username: "alice"})
+	cache.Set(&models.User{TelegramID: 2, Username: "bob"})
+
+	// Reading alice makes bob the least recently used
+	if _, ok := cache.Get(1); !ok {
+		t.Fatal("alice missing from the cache")
+	}
+	cache.Set(&models.User{TelegramID: 3, Username: "carol"})
+
+	if _, ok := cache.Get(2); ok {
+		t.Error("bob was not evicted")
+	}
+	for _, id := range []int64{1, 3} {
+		if _, ok := cache.Get(id); !ok {
+			t.Errorf("user %d evicted, want it cached", id)
+		}
+	}
+
+	// Updating a cached user replaces it without evicting another
+	cache.Set(&models.User{TelegramID: 1, Username: "alice2"})
+	if user, ok := cache.Get(1); !ok || user.Username != "alice2" {
+		t.Errorf("Get after update = %+v, %v, want alice2", user, ok)
+	}
+	if _, ok := cache.Get(3); !ok {
+		t.Error("carol evicted by an update")
+	}
+
+	cache.Invalidate(3)
+	if _, ok := cache.Get(3); ok {
+		t.Error("carol cached after Invalidate")
+	}
+}
+
+func TestUserCacheExpiry(t *testing.T) {
+	cache := services.NewUserCache(10, 10*time.Millisecond)
+	cache.Set(&models.User{TelegramID: 1, Username: "alice"})
+	if _, ok := cache.Get(1); !ok {
+		t.Fatal("alice missing from the cache")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if user, ok := cache.Get(1); ok {
+		t.Errorf("Get after the TTL = %+v, want it expired", user)
+	}
+}
+
+func TestUserCacheCopies(t *testing.T) {
+	cache := services.NewUserCache(10, time.Minute)
+	user := &models.User{TelegramID: 1, Username: "alice"}
+	cache.Set(user)
+	user.Username = "mallory"
+
+	cached, _ := cache.Get(1)
+	cached.IsAdmin = true
+	if again, _ := cache.Get(1); again.Username != "alice" || again.IsAdmin {
+		t.Errorf("cached user %+v changed through a caller's copy", again)
+	}
+}
+
+func TestUserCacheDisabled(t *testing.T) {
+	for _, cache := range []*services.UserCache{services.NewUserCache(0, time.Minute), services.NewUserCache(10, 0)} {
+		cache.Set(&models.User{TelegramID: 1})
+		if _, ok := cache.Get(1); ok {
+			t.Error("disabled cache stored a user")
+		}
+	}
+}
+
+func TestUserServiceCachesUsers(t *testing.T) {
+	store := &userStore{users: map[int64]models.User{1001: {ID: 7, TelegramID: 1001, Username: "alice", IsActive: true}}}
+	users := services.NewUserService(store, nil, services.NewUserCache(10, time.Minute))
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if user, err := users.GetUser(ctx, 1001); err != nil || user.ID != 7 {
+			t.Fatalf("GetUser = %+v, %v, want user 7", user, err)
+		}
+	}
+	if store.reads != 1 {
+		t.Errorf("%d reads for 3 lookups, want 1", store.reads)
+	}
+
+	// Registering an unchanged profile writes nothing
+	unchanged := &models.User{TelegramID: 1001, Username: "alice", IsActive: true}
+	if err := users.RegisterOrUpdateUser(ctx, unchanged); err != nil {
+		t.Fatalf("RegisterOrUpdateUser: %v", err)
+	}
+	if store.writes != 0 || unchanged.ID != 7 {
+		t.Errorf("unchanged profile: %d writes, ID %d, want no write and ID 7", store.writes, unchanged.ID)
+	}
+
+	// A changed profile is written and read again
+	if err := users.RegisterOrUpdateUser(ctx, &models.User{TelegramID: 1001, Username: "alice_new", IsActive: true}); err != nil {
+		t.Fatalf("RegisterOrUpdateUser: %v", err)
+	}
+	if user, err := users.GetUser(ctx, 1001); err != nil || user.Username != "alice_new" {
+		t.Errorf("GetUser after a profile change = %+v, %v, want alice_new", user, err)
+	}
+	if store.writes != 1 || store.reads != 2 {
+		t.Errorf("%d writes and %d reads, want 1 and 2", store.writes, store.reads)
+	}
+}
@@ -2,35 +2,92 @@ package services
 
 import (
 	"context"
+	stderrors "errors"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/servereye/servereyebot/internal/api"
+	"github.com/servereye/servereyebot/internal/mapping"
 	"github.com/servereye/servereyebot/internal/models"
 	"github.com/servereye/servereyebot/internal/repository"
+	"github.com/servereye/servereyebot/pkg/errors"
+)
+
+const (
+	// serverInfoConcurrency bounds the servers whose agent info is fetched at once
+	serverInfoConcurrency = 8
+
+	// serverInfoTimeout bounds the wait for the agent info of a server
+	serverInfoTimeout = 5 * time.Second
 )
 
 // UserService handles user and server operations
 type UserService struct {
-	repo      *repository.PostgresRepository
-	apiClient *api.Client
+	repo          repository.UserStore
+	apiClient     *api.Client
+	cache         *UserCache
+	latestVersion string // agent release servers are compared against, see UseLatestAgentVersion
+}
+
+// NewUserService creates a new user service. Users read on the update hot path are
+// served from cache, which may be nil to always hit the database.
+func NewUserService(repo repository.UserStore, apiClient *api.Client, cache *UserCache) *UserService {
+	if cache == nil {
+		cache = NewUserCache(0, 0)
+	}
+	return &UserService{repo: repo, apiClient: apiClient, cache: cache}
 }
 
-// NewUserService creates a new user service
-func NewUserService(repo *repository.PostgresRepository, apiClient *api.Client) *UserService {
-	return &UserService{repo: repo, apiClient: apiClient}
+// UseLatestAgentVersion sets the agent release servers are compared against to flag
+// outdated agents. When empty, the newest release among the servers of a user is used.
+func (s *UserService) UseLatestAgentVersion(version string) {
+	s.latestVersion = version
 }
 
-// RegisterOrUpdateUser registers a new user or updates existing one
+// RegisterOrUpdateUser registers a new user or updates existing one.
+// The write is skipped when the cached profile is unchanged.
 func (s *UserService) RegisterOrUpdateUser(ctx context.Context, user *models.User) error {
+	if cached, ok := s.cache.Get(user.TelegramID); ok && sameProfile(cached, user) {
+		user.ID = cached.ID
+		return nil
+	}
+
 	log.Printf("Registering user: %d (%s)", user.ID, user.Username)
-	return s.repo.CreateUser(user)
+	if err := s.repo.CreateUser(user); err != nil {
+		return err
+	}
+
+	// Reload on next read to pick up database defaults and timestamps
+	s.cache.Invalidate(user.TelegramID)
+	return nil
 }
 
-// GetUser retrieves user by ID
+// GetUser retrieves user by Telegram ID
 func (s *UserService) GetUser(ctx context.Context, userID int64) (*models.User, error) {
-	return s.repo.GetUser(userID)
+	if user, ok := s.cache.Get(userID); ok {
+		return user, nil
+	}
+
+	user, err := s.repo.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.Set(user)
+	return user, nil
+}
+
+// sameProfile reports whether registering user would leave the stored profile unchanged
+func sameProfile(stored, user *models.User) bool {
+	return stored.Username == user.Username &&
+		stored.FirstName == user.FirstName &&
+		stored.LastName == user.LastName &&
+		stored.IsAdmin == user.IsAdmin &&
+		stored.IsActive == user.IsActive
 }
 
 // AddServerToUser adds a server to user's server list with proper API validation
@@ -48,12 +105,14 @@ func (s *UserService) AddServerToUser(ctx context.Context, userID int64, serverK
 		sourcesResp, err := s.apiClient.GetServerSources(ctx, serverKey)
 		if err != nil {
 			log.Printf("Server validation failed for %s: %v", serverKey, err)
-			// Check if it's a "not found" error
-			if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "404") {
-				return fmt.Errorf("server '%s' not found", serverKey)
+			if stderrors.Is(err, errors.ErrServerNotFound) {
+				return fmt.Errorf("server '%s': %w", serverKey, err)
 			}
-			// For other API errors, return a more specific message
-			return fmt.Errorf("failed to validate server '%s': API error", serverKey)
+			// Any other failure means the server could not be validated right now
+			if !stderrors.Is(err, errors.ErrAPIUnavailable) {
+				err = errors.NewAPIUnavailableError("validate server", err)
+			}
+			return fmt.Errorf("failed to validate server '%s': %w", serverKey, err)
 		}
 
 		log.Printf("Server %s found with ID %s, sources: %v", serverKey, sourcesResp.ServerID, sourcesResp.Sources)
@@ -73,7 +132,7 @@ func (s *UserService) AddServerToUser(ctx context.Context, userID int64, serverK
 			_, err := s.apiClient.AddServerSourceByRequest(ctx, serverKey)
 			if err != nil {
 				log.Printf("Failed to add TGBot source to server %s: %v", serverKey, err)
-				return fmt.Errorf("failed to add TGBot source to server '%s'", serverKey)
+				return fmt.Errorf("failed to add TGBot source to server '%s': %w", serverKey, err)
 			}
 			log.Printf("TGBot source added successfully to server %s", serverKey)
 		} else {
@@ -81,13 +140,321 @@ func (s *UserService) AddServerToUser(ctx context.Context, userID int64, serverK
 		}
 
 		// Use the original serverKey for database storage (not ServerID from API)
-		return s.repo.AddServerToUser(userID, serverKey, source)
+		if err := s.repo.AddServerToUser(userID, serverKey, source); err != nil {
+			return err
+		}
+
+		// Name the server after its host unless it was named before
+		s.nameServerFromAgent(ctx, userID, serverKey)
+		return nil
 	} else {
 		log.Printf("API client not available, skipping server validation")
 		return s.repo.AddServerToUser(userID, serverKey, source)
 	}
 }
 
+// AddIssuedServer links a server whose key the bot issued to a user. Its agent registers
+// the key with the ServerEye API once it starts with it, so the key is not validated there.
+func (s *UserService) AddIssuedServer(ctx context.Context, userID int64, serverKey string) error {
+	log.Printf("Adding issued server %s to user %d", serverKey, userID)
+	return s.repo.AddServerToUser(userID, serverKey, "TGBot")
+}
+
+// ServerAgentInfo is what the agent of a server last reported to the ServerEye API
+type ServerAgentInfo struct {
+	Online       bool
+	LastSeen     time.Time // zero when unknown
+	AgentVersion string
+	OS           string
+	Outdated     bool // the agent is more than one minor release behind the latest
+}
+
+// GetUserServersWithInfo retrieves the servers of a user with what their agents last
+// reported, by server ID. Servers the API does not answer for are left out of the map.
+func (s *UserService) GetUserServersWithInfo(ctx context.Context, userID int64) ([]models.ServerWithDetails, map[string]ServerAgentInfo, error) {
+	servers, err := s.GetUserServers(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info := make(map[string]ServerAgentInfo, len(servers))
+	if s.apiClient == nil || len(servers) == 0 {
+		return servers, info, nil
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, serverInfoConcurrency)
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server models.ServerWithDetails) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			agent, ok := s.serverAgentInfo(ctx, server.ServerKey)
+			if !ok {
+				return
+			}
+			mu.Lock()
+			info[server.ID] = agent
+			mu.Unlock()
+		}(server)
+	}
+	wg.Wait()
+
+	latest := s.latestVersion
+	for _, agent := range info {
+		if compareVersions(agent.AgentVersion, latest) > 0 {
+			latest = agent.AgentVersion
+		}
+	}
+	for id, agent := range info {
+		agent.Outdated = versionBehind(agent.AgentVersion, latest)
+		info[id] = agent
+	}
+	return servers, info, nil
+}
+
+// serverAgentInfo retrieves the status and operating system of a server, reporting
+// whether the API answered for it
+func (s *UserService) serverAgentInfo(ctx context.Context, serverKey string) (ServerAgentInfo, bool) {
+	ctx, cancel := context.WithTimeout(ctx, serverInfoTimeout)
+	defer cancel()
+
+	status, err := s.apiClient.GetServerStatus(ctx, serverKey)
+	if err != nil {
+		log.Printf("Failed to get status of server %s: %v", serverKey, err)
+		return ServerAgentInfo{}, false
+	}
+
+	agent := ServerAgentInfo{Online: status.Online, AgentVersion: status.AgentVersion}
+	if lastSeen, err := time.Parse(time.RFC3339Nano, status.LastSeen); err == nil {
+		agent.LastSeen = lastSeen
+	}
+	if static, err := s.apiClient.GetServerStaticInfo(ctx, serverKey); err == nil {
+		agent.OS = strings.TrimSpace(static.ServerInfo.OS + " " + static.ServerInfo.OSVersion)
+	}
+	return agent, true
+}
+
+// parseVersion returns the numeric components of a version such as v1.4.2, nil when
+// it has none
+func parseVersion(version string) []int {
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	version, _, _ = strings.Cut(version, "-") // pre-release suffix
+	if version == "" {
+		return nil
+	}
+
+	var parts []int
+	for _, field := range strings.Split(version, ".") {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return nil
+		}
+		parts = append(parts, n)
+	}
+	return parts
+}
+
+// compareVersions returns -1, 0 or 1 as version a is older than, the same as or newer
+// than b. Versions that do not parse are older than any that do.
+func compareVersions(a, b string) int {
+	pa, pb := parseVersion(a), parseVersion(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	if pa == nil && pb != nil {
+		return -1
+	}
+	return 0
+}
+
+// versionBehind reports whether version is more than one minor release behind latest, or
+// of an older major release
+func versionBehind(version, latest string) bool {
+	v, l := parseVersion(version), parseVersion(latest)
+	if v == nil || l == nil {
+		return false
+	}
+	minor := func(parts []int) int {
+		if len(parts) > 1 {
+			return parts[1]
+		}
+		return 0
+	}
+	if v[0] != l[0] {
+		return v[0] < l[0]
+	}
+	return minor(l)-minor(v) > 1
+}
+
+// placeholderServerNames are the names servers get before anyone names them, besides their key
+var placeholderServerNames = map[string]bool{"": true, "Server": true, "New Server": true}
+
+// hasPlaceholderName reports whether a server still has the name it was created with
+func hasPlaceholderName(server models.ServerWithDetails) bool {
+	name := strings.TrimSpace(server.Name)
+	return placeholderServerNames[name] || name == server.ID || name == server.ServerKey
+}
+
+// AgentServerName returns the name a server reports through its agent: its hostname, or
+// its operating system when the agent registered without one. It is empty when the agent
+// reported neither.
+func (s *UserService) AgentServerName(ctx context.Context, serverKey string) (string, error) {
+	if s.apiClient == nil {
+		return "", nil
+	}
+
+	info, err := s.apiClient.GetServerStaticInfo(ctx, serverKey)
+	if err != nil {
+		return "", err
+	}
+	if hostname := strings.TrimSpace(info.ServerInfo.Hostname); hostname != "" {
+		return hostname, nil
+	}
+	return strings.TrimSpace(info.ServerInfo.OS + " " + info.ServerInfo.OSVersion), nil
+}
+
+// nameServerFromAgent gives a server just added to a user the name its agent reports,
+// unless the server already has a name. Failures only leave the placeholder name.
+func (s *UserService) nameServerFromAgent(ctx context.Context, userID int64, serverKey string) {
+	servers, err := s.repo.GetUserServers(userID)
+	if err != nil {
+		log.Printf("Failed to get servers of user %d to name server %s: %v", userID, serverKey, err)
+		return
+	}
+	for _, server := range servers {
+		if server.ID != serverKey {
+			continue
+		}
+		if !hasPlaceholderName(server) {
+			return
+		}
+
+		name, err := s.AgentServerName(ctx, serverKey)
+		if err != nil || name == "" {
+			log.Printf("No agent name for server %s: %v", serverKey, err)
+			return
+		}
+		name = uniqueServerName(name, server.ID, takenServerNames(servers, server.ID))
+		if err := s.repo.UpdateServerName(ctx, serverKey, name); err != nil {
+			log.Printf("Failed to name server %s after its agent: %v", serverKey, err)
+			return
+		}
+		log.Printf("Server %s named %q after its agent", serverKey, name)
+		return
+	}
+}
+
+// ServerNameSync is the outcome of naming a server after its agent
+type ServerNameSync struct {
+	ServerID string
+	OldName  string
+	NewName  string
+	Err      error // why the server kept its name, nil unless it failed
+}
+
+// SyncNamesReport summarizes the names refreshed by SyncServerNames
+type SyncNamesReport struct {
+	Renamed   []ServerNameSync
+	Unchanged int // servers already named as their agent reports
+	Custom    int // servers named by a user, left as they are
+	Shared    int // servers the user is not an admin of, left as they are
+	Failed    []ServerNameSync
+}
+
+// SyncServerNames names the servers of a user after the latest data of their agents.
+// Server names are seen by everyone the server is shared with, so only servers the user
+// is an admin of are renamed, and servers a user named only when overwrite is set. Names
+// taken by another server of the user get an ID suffix, so names keep telling servers apart.
+func (s *UserService) SyncServerNames(ctx context.Context, userID int64, overwrite bool) (*SyncNamesReport, error) {
+	servers, err := s.repo.GetUserServers(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &SyncNamesReport{}
+	for i, server := range servers {
+		if !Can(&server, PermRename) {
+			report.Shared++
+			continue
+		}
+		if !overwrite && !hasPlaceholderName(server) {
+			report.Custom++
+			continue
+		}
+
+		sync := ServerNameSync{ServerID: server.ID, OldName: server.Name}
+		name, err := s.AgentServerName(ctx, server.ID)
+		if err == nil && name != "" {
+			name = uniqueServerName(name, server.ID, takenServerNames(servers, server.ID))
+		}
+		switch {
+		case err != nil:
+			sync.Err = err
+		case name == "":
+			sync.Err = fmt.Errorf("agent of server '%s' reported no hostname", server.ID)
+		case name == server.Name:
+			report.Unchanged++
+			continue
+		default:
+			sync.NewName = name
+			sync.Err = s.repo.UpdateServerName(ctx, server.ID, name)
+		}
+
+		if sync.Err != nil {
+			log.Printf("Failed to sync name of server %s: %v", server.ID, sync.Err)
+			report.Failed = append(report.Failed, sync)
+			continue
+		}
+		servers[i].Name = name
+		report.Renamed = append(report.Renamed, sync)
+	}
+	return report, nil
+}
+
+// takenServerNames returns the names of the servers other than serverID, in lower case
+func takenServerNames(servers []models.ServerWithDetails, serverID string) map[string]bool {
+	taken := make(map[string]bool, len(servers))
+	for _, server := range servers {
+		if server.ID != serverID {
+			taken[strings.ToLower(server.Name)] = true
+		}
+	}
+	return taken
+}
+
+// uniqueServerName returns name, or name with the end of the server ID when another
+// server already has it, such as a second "ubuntu" host
+func uniqueServerName(name, serverID string, taken map[string]bool) string {
+	if !taken[strings.ToLower(name)] {
+		return name
+	}
+
+	suffix := strings.TrimPrefix(serverID, "srv_")
+	if len(suffix) > 6 {
+		suffix = suffix[len(suffix)-6:]
+	}
+	if unique := name + "-" + suffix; !taken[strings.ToLower(unique)] {
+		return unique
+	}
+	return name + "-" + serverID
+}
+
 // AddTelegramIdentifierToServer adds Telegram ID to server source identifiers
 func (s *UserService) AddTelegramIdentifierToServer(ctx context.Context, userID int64, serverKey, telegramID, username, firstName string) error {
 	log.Printf("Adding Telegram ID %s to server %s for user %d", telegramID, serverKey, userID)
@@ -153,31 +520,98 @@ func (s *UserService) RemoveServerFromUser(ctx context.Context, userID int64, se
 	return s.repo.RemoveServerFromUser(userID, serverID)
 }
 
-// UpdateServerName updates the name of a server for a user
+// ForgetUser erases a user on request: the Telegram identifier is removed from the
+// sources of their servers, then the account is deactivated together with its servers,
+// alerts and settings
+func (s *UserService) ForgetUser(ctx context.Context, userID int64) error {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+
+	servers, err := s.repo.GetUserServers(userID)
+	if err != nil {
+		return err
+	}
+	for _, server := range servers {
+		if err := s.RemoveServerFromUser(ctx, userID, server.ID); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Forgetting user %d", userID)
+	if err := s.repo.SoftDeleteUser(ctx, userID, user.TelegramID, time.Now()); err != nil {
+		return err
+	}
+
+	s.cache.Invalidate(user.TelegramID)
+	return nil
+}
+
+// UpdateServerName updates the name of a server for a user. Names are seen by everyone
+// the server is shared with, so only admins of the server may rename it.
 func (s *UserService) UpdateServerName(ctx context.Context, userID int64, serverID, newName string) error {
 	log.Printf("Updating server name for %s to '%s' for user %d", serverID, newName, userID)
 
-	// Check if user has access to this server
-	hasAccess, err := s.IsServerOwnedByUser(ctx, userID, serverID)
+	servers, err := s.repo.GetUserServers(userID)
 	if err != nil {
 		log.Printf("Error checking server access: %v", err)
 		return err
 	}
 
-	if !hasAccess {
+	server := mapping.ServerByID(servers, serverID)
+	if server == nil {
 		log.Printf("User %d does not have access to server %s", userID, serverID)
 		return fmt.Errorf("server '%s' not found in user's list", serverID)
 	}
+	if err := Authorize(server, PermRename); err != nil {
+		log.Printf("User %d may not rename server %s", userID, serverID)
+		return err
+	}
 
 	// Update server name using repository
 	return s.repo.UpdateServerName(ctx, serverID, newName)
 }
 
+// SetServerRole changes the role of a user on one of their servers
+func (s *UserService) SetServerRole(ctx context.Context, userID int64, serverID, role string) error {
+	log.Printf("Setting role %s on server %s for user %d", role, serverID, userID)
+	return s.repo.SetServerRole(ctx, userID, serverID, role)
+}
+
 // IsServerOwnedByUser checks if server is owned by user
 func (s *UserService) IsServerOwnedByUser(ctx context.Context, userID int64, serverID string) (bool, error) {
 	return s.repo.IsServerOwnedByUser(userID, serverID)
 }
 
+// formatServerAgentInfo formats the agent lines of a server in the servers list
+func formatServerAgentInfo(agent ServerAgentInfo, now time.Time) string {
+	var result string
+	if !agent.LastSeen.IsZero() {
+		if age := now.Sub(agent.LastSeen); age < time.Minute {
+			result += "\nВ сети: только что"
+		} else {
+			result += fmt.Sprintf("\nВ сети: %s назад", formatAge(age))
+		}
+	}
+
+	var details []string
+	if agent.AgentVersion != "" {
+		version := "агент " + agent.AgentVersion
+		if agent.Outdated {
+			version += " ⚠️ (устарел)"
+		}
+		details = append(details, version)
+	}
+	if agent.OS != "" {
+		details = append(details, agent.OS)
+	}
+	if len(details) > 0 {
+		result += "\n" + strings.Join(details, ", ")
+	}
+	return result
+}
+
 // FormatServersList formats servers list for display
 func (s *UserService) FormatServersList(servers []models.ServerWithDetails) string {
 	if len(servers) == 0 {
@@ -200,16 +634,33 @@ func (s *UserService) FormatServersList(servers []models.ServerWithDetails) stri
 	return result
 }
 
-// FormatServersListPlain formats servers list for display without Markdown
-func (s *UserService) FormatServersListPlain(servers []models.ServerWithDetails) string {
+// FormatServersListPlain formats servers list for display without Markdown. Servers in
+// maintenance, mapped to its end, are marked with a badge, and the agent info of servers
+// is shown when known.
+func (s *UserService) FormatServersListPlain(servers []models.ServerWithDetails, maintenance map[string]time.Time, agents map[string]ServerAgentInfo) string {
 	if len(servers) == 0 {
 		return "У вас пока нет добавленных серверов.\n\nИспользуйте команду /add <server_id> чтобы добавить сервер."
 	}
 
 	result := fmt.Sprintf("Ваши серверы (%d):\n\n", len(servers))
 
+	now := time.Now()
 	for i, server := range servers {
 		result += fmt.Sprintf("%d. %s(%s)", i+1, server.Name, server.ID)
+		agent, known := agents[server.ID]
+		if known {
+			if agent.Online {
+				result += " 🟢"
+			} else {
+				result += " 🔴"
+			}
+		}
+		if end, ok := maintenance[server.ID]; ok {
+			result += fmt.Sprintf(" 🛠\nОбслуживание до %s UTC", end.UTC().Format("02.01.2006 15:04"))
+		}
+		if known {
+			result += formatServerAgentInfo(agent, now)
+		}
 
 		result += fmt.Sprintf("\nДобавлен: %s\n", server.AddedAt.Format("02.01.2006 15:04"))
 		result += fmt.Sprintf("Роль: %s\n\n", server.Role)
@@ -2,7 +2,9 @@ package services
 
 import (
 	"context"
+	"time"
 
+	"github.com/servereye/servereyebot/internal/mapping"
 	"github.com/servereye/servereyebot/internal/models"
 	"github.com/servereye/servereyebot/pkg/domain"
 )
@@ -33,15 +35,8 @@ func (a *UserServiceAdapter) IsAuthorized(userID int64) bool {
 
 // RegisterUser registers a user
 func (a *UserServiceAdapter) RegisterUser(ctx context.Context, user *domain.User) error {
-	modelUser := &models.User{
-		ID:         0,               // Let database generate ID
-		TelegramID: user.TelegramID, // Store TelegramID separately
-		Username:   user.Username,
-		FirstName:  user.FirstName,
-		LastName:   user.LastName,
-		IsAdmin:    a.IsAdmin(user.TelegramID),
-		IsActive:   true,
-	}
+	modelUser := mapping.UserToModel(user)
+	modelUser.IsAdmin = a.IsAdmin(user.TelegramID)
 	return a.service.RegisterOrUpdateUser(ctx, modelUser)
 }
 
@@ -52,16 +47,7 @@ func (a *UserServiceAdapter) GetUser(ctx context.Context, userID int64) (*domain
 		return nil, err
 	}
 
-	return &domain.User{
-		ID:         int(modelUser.ID),    // Convert int64 to int for domain.User
-		TelegramID: modelUser.TelegramID, // Use actual TelegramID from database
-		Username:   modelUser.Username,
-		FirstName:  modelUser.FirstName,
-		LastName:   modelUser.LastName,
-		IsAdmin:    modelUser.IsAdmin,
-		CreatedAt:  modelUser.CreatedAt,
-		LastSeen:   modelUser.UpdatedAt, // Use updated_at as last_seen
-	}, nil
+	return mapping.UserFromModel(modelUser), nil
 }
 
 // GetUserServers retrieves all servers for a user
@@ -69,6 +55,11 @@ func (a *UserServiceAdapter) GetUserServers(ctx context.Context, userID int64) (
 	return a.service.GetUserServers(ctx, userID)
 }
 
+// GetUserServersWithInfo retrieves the servers of a user with what their agents last reported
+func (a *UserServiceAdapter) GetUserServersWithInfo(ctx context.Context, userID int64) ([]models.ServerWithDetails, map[string]ServerAgentInfo, error) {
+	return a.service.GetUserServersWithInfo(ctx, userID)
+}
+
 // AddServerToUser adds a server to user's server list
 func (a *UserServiceAdapter) AddServerToUser(ctx context.Context, userID int64, serverID, source string) error {
 	return a.service.AddServerToUser(ctx, userID, serverID, source)
@@ -84,17 +75,27 @@ func (a *UserServiceAdapter) RemoveServerFromUser(ctx context.Context, userID in
 	return a.service.RemoveServerFromUser(ctx, userID, serverID)
 }
 
+// ForgetUser erases a user and their settings
+func (a *UserServiceAdapter) ForgetUser(ctx context.Context, userID int64) error {
+	return a.service.ForgetUser(ctx, userID)
+}
+
 // UpdateServerName updates the name of a server
 func (a *UserServiceAdapter) UpdateServerName(ctx context.Context, userID int64, serverID, newName string) error {
 	return a.service.UpdateServerName(ctx, userID, serverID, newName)
 }
 
+// SyncServerNames names the servers of a user after their agents
+func (a *UserServiceAdapter) SyncServerNames(ctx context.Context, userID int64, overwrite bool) (*SyncNamesReport, error) {
+	return a.service.SyncServerNames(ctx, userID, overwrite)
+}
+
 // FormatServersList formats servers list for display
 func (a *UserServiceAdapter) FormatServersList(servers []models.ServerWithDetails) string {
 	return a.service.FormatServersList(servers)
 }
 
 // FormatServersListPlain formats servers list for display without Markdown
-func (a *UserServiceAdapter) FormatServersListPlain(servers []models.ServerWithDetails) string {
-	return a.service.FormatServersListPlain(servers)
+func (a *UserServiceAdapter) FormatServersListPlain(servers []models.ServerWithDetails, maintenance map[string]time.Time, agents map[string]ServerAgentInfo) string {
+	return a.service.FormatServersListPlain(servers, maintenance, agents)
 }
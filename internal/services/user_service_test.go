@@ -0,0 +1,149 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/api"
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/internal/repository"
+	"github.com/servereye/servereyebot/internal/services"
+	"github.com/servereye/servereyebot/pkg/domain"
+)
+
+// serverStore holds the servers of one user and records renames
+type serverStore struct {
+	repository.UserStore
+
+	servers []models.ServerWithDetails
+	renamed map[string]string // server ID -> new name
+}
+
+func (s *serverStore) GetUserServers(userID int64) ([]models.ServerWithDetails, error) {
+	return append([]models.ServerWithDetails(nil), s.servers...), nil
+}
+
+func (s *serverStore) UpdateServerName(ctx context.Context, serverID, newName string) error {
+	s.renamed[serverID] = newName
+	return nil
+}
+
+// newHostnameAPI starts a fake ServerEye API reporting the hostnames of servers by key
+func newHostnameAPI(t *testing.T, hostnames map[string]string) *api.Client {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/servers/by-key/"), "/static-info")
+		hostname, ok := hostnames[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(domain.StaticInfoResponse{ServerInfo: domain.ServerInfo{ServerID: key, Hostname: hostname}})
+	}))
+	t.Cleanup(server.Close)
+	return api.NewClient(server.URL, time.Second, api.RetryPolicy{}, nopLogger{})
+}
+
+// userServer returns a server of the user with a role
+func userServer(id, name, role string) models.ServerWithDetails {
+	return models.ServerWithDetails{Server: models.Server{ID: id, Name: name}, Role: role, ServerKey: id}
+}
+
+func TestSyncServerNames(t *testing.T) {
+	client := newHostnameAPI(t, map[string]string{
+		"srv_owned":       "ubuntu",
+		"srv_0000aa1234":  "ubuntu",
+		"srv_admin":       "db-1",
+		"srv_viewer":      "web",
+		"srv_guest":       "cache",
+		"srv_named":       "mail-host",
+		"srv_named_other": "ubuntu",
+	})
+
+	tests := []struct {
+		name        string
+		servers     []models.ServerWithDetails
+		overwrite   bool
+		wantRenamed map[string]string
+		wantShared  int
+		wantCustom  int
+	}{
+		{
+			name: "only servers the user administers",
+			servers: []models.ServerWithDetails{
+				userServer("srv_owned", "srv_owned", services.RoleOwner),
+				userServer("srv_admin", "srv_admin", services.RoleAdmin),
+				userServer("srv_viewer", "srv_viewer", services.RoleViewer),
+				userServer("srv_guest", "srv_guest", services.RoleGuest),
+			},
+			wantRenamed: map[string]string{"srv_owned": "ubuntu", "srv_admin": "db-1"},
+			wantShared:  2,
+		},
+		{
+			name: "duplicate hostnames get an ID suffix",
+			servers: []models.ServerWithDetails{
+				userServer("srv_owned", "srv_owned", services.RoleOwner),
+				userServer("srv_0000aa1234", "srv_0000aa1234", services.RoleOwner),
+			},
+			wantRenamed: map[string]string{"srv_owned": "ubuntu", "srv_0000aa1234": "ubuntu-aa1234"},
+		},
+		{
+			name: "hostname taken by a shared server",
+			servers: []models.ServerWithDetails{
+				userServer("srv_viewer", "Ubuntu", services.RoleViewer),
+				userServer("srv_owned", "srv_owned", services.RoleOwner),
+			},
+			wantRenamed: map[string]string{"srv_owned": "ubuntu-owned"},
+			wantShared:  1,
+		},
+		{
+			name: "custom names kept without overwrite",
+			servers: []models.ServerWithDetails{
+				userServer("srv_named", "mail", services.RoleOwner),
+			},
+			wantRenamed: map[string]string{},
+			wantCustom:  1,
+		},
+		{
+			name: "custom names replaced with overwrite",
+			servers: []models.ServerWithDetails{
+				userServer("srv_named", "mail", services.RoleOwner),
+				userServer("srv_named_other", "ubuntu", services.RoleOwner),
+			},
+			overwrite:   true,
+			wantRenamed: map[string]string{"srv_named": "mail-host"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &serverStore{servers: tt.servers, renamed: make(map[string]string)}
+			svc := services.NewUserService(store, client, nil)
+
+			report, err := svc.SyncServerNames(context.Background(), 7, tt.overwrite)
+			if err != nil {
+				t.Fatalf("SyncServerNames: %v", err)
+			}
+			if len(report.Failed) != 0 {
+				t.Fatalf("failed to rename %+v", report.Failed)
+			}
+			if len(store.renamed) != len(tt.wantRenamed) {
+				t.Errorf("renamed %v, want %v", store.renamed, tt.wantRenamed)
+			}
+			for id, want := range tt.wantRenamed {
+				if got := store.renamed[id]; got != want {
+					t.Errorf("server %s named %q, want %q", id, got, want)
+				}
+			}
+			if report.Shared != tt.wantShared || report.Custom != tt.wantCustom {
+				t.Errorf("report left %d shared and %d custom servers, want %d and %d", report.Shared, report.Custom, tt.wantShared, tt.wantCustom)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/models"
+	"github.com/servereye/servereyebot/pkg/docker"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// VMService lists and controls the virtual machines of libvirt and Proxmox hosts
+type VMService struct {
+	docker *docker.Client
+	logger Logger
+}
+
+// NewVMService creates a new virtual machine service
+func NewVMService(dockerClient *docker.Client, logger Logger) *VMService {
+	return &VMService{
+		docker: dockerClient,
+		logger: logger,
+	}
+}
+
+// List retrieves the virtual machines of a server on behalf of a user
+func (s *VMService) List(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails) (*protocol.VMListResponse, error) {
+	vms, err := s.docker.ListVMs(WithActor(ctx, userID, telegramID), server.ServerKey)
+	if err != nil {
+		s.logger.Error("Failed to list VMs", "error", err, "server_key", server.ServerKey)
+		return nil, err
+	}
+	return vms, nil
+}
+
+// RunAction starts or shuts down a virtual machine of a server. Only admins of the
+// server may control its virtual machines.
+func (s *VMService) RunAction(ctx context.Context, userID, telegramID int64, server *models.ServerWithDetails, vm string, action protocol.VMAction) (*protocol.VMActionResponse, error) {
+	if err := Authorize(server, PermVMs); err != nil {
+		return nil, err
+	}
+
+	result, err := s.docker.RunVMAction(WithActor(ctx, userID, telegramID), server.ServerKey, vm, action)
+	if err != nil {
+		s.logger.Error("Failed to run VM action", "error", err, "server_key", server.ServerKey, "vm", vm, "action", action)
+		return nil, err
+	}
+
+	s.logger.Info("VM action completed", "server_key", server.ServerKey, "vm", vm, "action", action, "state", result.State)
+	return result, nil
+}
+
+// FormatVMs formats the virtual machines of a server
+func (s *VMService) FormatVMs(server *models.ServerWithDetails, vms *protocol.VMListResponse) string {
+	if vms.Hypervisor == "" {
+		return fmt.Sprintf("🖥️ Агент %s(%s) не нашел Proxmox или libvirt.", server.Name, server.ID)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("🖥️ Виртуальные машины на %s(%s), %s:\n\n", server.Name, server.ID, vms.Hypervisor))
+	if len(vms.VMs) == 0 {
+		sb.WriteString("Виртуальные машины не найдены.")
+		return sb.String()
+	}
+
+	for _, vm := range vms.VMs {
+		writeVM(&sb, vm)
+		sb.WriteString("\n")
+	}
+
+	result := strings.TrimRight(sb.String(), "\n")
+	if runes := []rune(result); len(runes) > maxMessageLength {
+		result = string(runes[:maxMessageLength]) + "\n…"
+	}
+	return result
+}
+
+// FormatVMAction formats the result of a virtual machine operation
+func (s *VMService) FormatVMAction(server *models.ServerWithDetails, result *protocol.VMActionResponse) string {
+	return fmt.Sprintf("✅ %s выполнен для %s на %s(%s), состояние: %s", result.Action, result.VM, server.Name, server.ID, result.State)
+}
+
+// writeVM writes a virtual machine with its resource usage
+func writeVM(sb *strings.Builder, vm protocol.VM) {
+	icon := "⚪"
+	switch vm.State {
+	case "running":
+		icon = "🟢"
+	case "paused", "suspended":
+		icon = "🟡"
+	}
+
+	label := vm.Name
+	if vm.ID != "" && vm.ID != vm.Name {
+		label = fmt.Sprintf("%s (%s)", vm.Name, vm.ID)
+	}
+	sb.WriteString(fmt.Sprintf("%s %s — %s\n", icon, label, vm.State))
+
+	memory := formatBytes(uint64(max(vm.MemoryBytes, 0)))
+	if vm.MemoryUsedBytes > 0 {
+		memory = formatBytes(uint64(vm.MemoryUsedBytes)) + " / " + memory
+	}
+	sb.WriteString(fmt.Sprintf("   vCPU: %d", vm.VCPUs))
+	if vm.State == "running" {
+		sb.WriteString(fmt.Sprintf(", CPU: %.1f%%", vm.CPUPercent))
+	}
+	sb.WriteString(", RAM: " + memory)
+	if vm.UptimeSeconds > 0 {
+		sb.WriteString(", работает " + formatAge(time.Duration(vm.UptimeSeconds)*time.Second))
+	}
+	sb.WriteString("\n")
+}
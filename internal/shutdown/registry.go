@@ -0,0 +1,153 @@
+package shutdown
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Hook priorities, lower values run first
+const (
+	PriorityIngress    = 10 // stop accepting new work (updates, HTTP)
+	PriorityWorkers    = 20 // stop background workers (schedulers, consumers)
+	PriorityTransports = 30 // close outbound transports
+	PriorityStorage    = 40 // close databases and caches
+)
+
+// DefaultHookTimeout is used when a hook is registered without a timeout
+const DefaultHookTimeout = 10 * time.Second
+
+// HookFunc is a function executed on shutdown
+type HookFunc func(ctx context.Context) error
+
+// Logger interface for shutdown registry
+type Logger interface {
+	Debug(msg string, fields ...interface{})
+	Info(msg string, fields ...interface{})
+	Warn(msg string, fields ...interface{})
+	Error(msg string, fields ...interface{})
+}
+
+// hook represents a registered shutdown hook
+type hook struct {
+	name     string
+	priority int
+	timeout  time.Duration
+	fn       HookFunc
+	order    int
+}
+
+// HookError describes a failed shutdown hook
+type HookError struct {
+	Name string
+	Err  error
+}
+
+// Error implements error interface
+func (e HookError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Name, e.Err)
+}
+
+// Errors aggregates all hook failures of a shutdown run
+type Errors []HookError
+
+// Error implements error interface
+func (e Errors) Error() string {
+	parts := make([]string, len(e))
+	for i, hookErr := range e {
+		parts[i] = hookErr.Error()
+	}
+	return "shutdown hooks failed: " + strings.Join(parts, "; ")
+}
+
+// Registry keeps shutdown hooks and executes them in priority order
+type Registry struct {
+	mu     sync.Mutex
+	hooks  []hook
+	logger Logger
+	done   bool
+}
+
+// NewRegistry creates a new shutdown hooks registry
+func NewRegistry(logger Logger) *Registry {
+	return &Registry{logger: logger}
+}
+
+// RegisterOnShutdown registers a hook with the given priority and timeout
+func (r *Registry) RegisterOnShutdown(name string, priority int, timeout time.Duration, fn HookFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if timeout <= 0 {
+		timeout = DefaultHookTimeout
+	}
+
+	r.hooks = append(r.hooks, hook{
+		name:     name,
+		priority: priority,
+		timeout:  timeout,
+		fn:       fn,
+		order:    len(r.hooks),
+	})
+}
+
+// Shutdown executes all hooks once, ordered by priority and registration order
+func (r *Registry) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	if r.done {
+		r.mu.Unlock()
+		return nil
+	}
+	r.done = true
+
+	hooks := make([]hook, len(r.hooks))
+	copy(hooks, r.hooks)
+	r.mu.Unlock()
+
+	sort.SliceStable(hooks, func(i, j int) bool {
+		if hooks[i].priority != hooks[j].priority {
+			return hooks[i].priority < hooks[j].priority
+		}
+		return hooks[i].order < hooks[j].order
+	})
+
+	var failed Errors
+	for _, h := range hooks {
+		if err := r.run(ctx, h); err != nil {
+			r.logger.Error("Shutdown hook failed", "hook", h.name, "error", err)
+			failed = append(failed, HookError{Name: h.name, Err: err})
+		}
+	}
+
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+// run executes a single hook within its timeout
+func (r *Registry) run(ctx context.Context, h hook) error {
+	hookCtx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	start := time.Now()
+	r.logger.Debug("Running shutdown hook", "hook", h.name, "priority", h.priority)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- h.fn(hookCtx)
+	}()
+
+	select {
+	case err := <-errCh:
+		if err == nil {
+			r.logger.Info("Shutdown hook completed", "hook", h.name, "duration", time.Since(start).String())
+		}
+		return err
+	case <-hookCtx.Done():
+		return fmt.Errorf("timed out after %s: %w", h.timeout, hookCtx.Err())
+	}
+}
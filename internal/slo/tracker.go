@@ -0,0 +1,212 @@
+package slo
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/httpserver"
+)
+
+// Class is a group of bot commands sharing a service level objective
+type Class string
+
+const (
+	ClassMetrics    Class = "metrics"
+	ClassContainers Class = "containers"
+	ClassAdmin      Class = "admin"
+)
+
+// bucketSize is the resolution of the sliding window
+const bucketSize = time.Hour
+
+// bucket counts command outcomes within one time slot
+type bucket struct {
+	start  time.Time
+	total  int64
+	failed int64
+}
+
+// series keeps the sliding window of one command class
+type series struct {
+	target  float64
+	buckets []bucket
+}
+
+// Status represents the error budget state of a command class
+type Status struct {
+	Class           Class
+	Target          float64
+	Total           int64
+	Failed          int64
+	SuccessRate     float64
+	BudgetRemaining float64 // fraction of the error budget left, negative when overspent
+	BurnRate        float64 // observed error rate relative to the allowed one
+}
+
+// Exhausted reports whether the error budget of the class is spent
+func (s Status) Exhausted() bool {
+	return s.Total > 0 && s.BudgetRemaining <= 0
+}
+
+// Tracker tracks command success rates against SLO targets in memory
+type Tracker struct {
+	mu     sync.Mutex
+	window time.Duration
+	series map[Class]*series
+}
+
+// NewTracker creates a tracker with per-class targets over a sliding window
+func NewTracker(window time.Duration, targets map[Class]float64) *Tracker {
+	if window < bucketSize {
+		window = 7 * 24 * time.Hour
+	}
+
+	t := &Tracker{
+		window: window,
+		series: make(map[Class]*series),
+	}
+
+	size := int(window / bucketSize)
+	for class, target := range targets {
+		t.series[class] = &series{
+			target:  target,
+			buckets: make([]bucket, size),
+		}
+	}
+
+	return t
+}
+
+// Record registers the outcome of a command of the given class
+func (t *Tracker) Record(class Class, success bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.series[class]
+	if !ok {
+		return
+	}
+
+	start := time.Now().Truncate(bucketSize)
+	idx := int(start.Unix()/int64(bucketSize/time.Second)) % len(s.buckets)
+
+	b := &s.buckets[idx]
+	if !b.start.Equal(start) {
+		*b = bucket{start: start}
+	}
+
+	b.total++
+	if !success {
+		b.failed++
+	}
+}
+
+// Status returns the error budget state of a class
+func (t *Tracker) Status(class Class) Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	status := Status{Class: class, SuccessRate: 1, BudgetRemaining: 1}
+
+	s, ok := t.series[class]
+	if !ok {
+		return status
+	}
+	status.Target = s.target
+
+	since := time.Now().Add(-t.window)
+	for _, b := range s.buckets {
+		if b.start.After(since) {
+			status.Total += b.total
+			status.Failed += b.failed
+		}
+	}
+
+	if status.Total == 0 {
+		return status
+	}
+
+	errorRate := float64(status.Failed) / float64(status.Total)
+	status.SuccessRate = 1 - errorRate
+
+	allowed := 1 - s.target
+	if allowed <= 0 {
+		if status.Failed > 0 {
+			status.BudgetRemaining = -1
+		}
+		return status
+	}
+
+	status.BurnRate = errorRate / allowed
+	status.BudgetRemaining = 1 - status.BurnRate
+	return status
+}
+
+// Statuses returns the error budget states of all classes ordered by name
+func (t *Tracker) Statuses() []Status {
+	t.mu.Lock()
+	classes := make([]Class, 0, len(t.series))
+	for class := range t.series {
+		classes = append(classes, class)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(classes, func(i, j int) bool { return classes[i] < classes[j] })
+
+	statuses := make([]Status, 0, len(classes))
+	for _, class := range classes {
+		statuses = append(statuses, t.Status(class))
+	}
+	return statuses
+}
+
+// Window returns the length of the sliding window
+func (t *Tracker) Window() time.Duration {
+	return t.window
+}
+
+// WritePrometheus writes SLO metrics in Prometheus text exposition format
+func (t *Tracker) WritePrometheus(w io.Writer) error {
+	statuses := t.Statuses()
+
+	metrics := []struct {
+		name  string
+		help  string
+		value func(s Status) float64
+	}{
+		{"servereyebot_slo_requests", "Commands recorded within the SLO window.", func(s Status) float64 { return float64(s.Total) }},
+		{"servereyebot_slo_failures", "Failed commands within the SLO window.", func(s Status) float64 { return float64(s.Failed) }},
+		{"servereyebot_slo_target", "SLO success rate target.", func(s Status) float64 { return s.Target }},
+		{"servereyebot_slo_success_rate", "Observed success rate within the SLO window.", func(s Status) float64 { return s.SuccessRate }},
+		{"servereyebot_slo_error_budget_remaining", "Fraction of the error budget left.", func(s Status) float64 { return s.BudgetRemaining }},
+		{"servereyebot_slo_burn_rate", "Error budget burn rate.", func(s Status) float64 { return s.BurnRate }},
+	}
+
+	for _, m := range metrics {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", m.name, m.help, m.name); err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			if _, err := fmt.Fprintf(w, "%s{class=%q} %g\n", m.name, string(s.Class), m.value(s)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ServeHTTP exposes SLO metrics for Prometheus scraping
+func (t *Tracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpserver.MethodNotAllowed(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_ = t.WritePrometheus(w)
+}
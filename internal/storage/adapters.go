@@ -6,107 +6,107 @@ import (
 	"github.com/servereye/servereyebot/pkg/domain"
 )
 
-// UserRepositoryAdapter adapts PostgreSQL to domain.UserRepository
+// UserRepositoryAdapter adapts a Database to domain.UserRepository
 type UserRepositoryAdapter struct {
-	postgres *PostgreSQL
+	db Database
 }
 
 // NewUserRepositoryAdapter creates a new user repository adapter
-func NewUserRepositoryAdapter(postgres *PostgreSQL) *UserRepositoryAdapter {
-	return &UserRepositoryAdapter{postgres: postgres}
+func NewUserRepositoryAdapter(db Database) *UserRepositoryAdapter {
+	return &UserRepositoryAdapter{db: db}
 }
 
 // Create implements domain.UserRepository
 func (a *UserRepositoryAdapter) Create(ctx context.Context, user *domain.User) error {
-	return a.postgres.CreateUser(ctx, user)
+	return a.db.CreateUser(ctx, user)
 }
 
 // GetByTelegramID implements domain.UserRepository
 func (a *UserRepositoryAdapter) GetByTelegramID(ctx context.Context, telegramID int64) (*domain.User, error) {
-	return a.postgres.GetUserByTelegramID(ctx, telegramID)
+	return a.db.GetUserByTelegramID(ctx, telegramID)
 }
 
 // Update implements domain.UserRepository
 func (a *UserRepositoryAdapter) Update(ctx context.Context, user *domain.User) error {
-	return a.postgres.UpdateUser(ctx, user)
+	return a.db.UpdateUser(ctx, user)
 }
 
 // Delete implements domain.UserRepository
 func (a *UserRepositoryAdapter) Delete(ctx context.Context, id int) error {
-	return a.postgres.DeleteUser(ctx, id)
+	return a.db.DeleteUser(ctx, id)
 }
 
-// ServerRepositoryAdapter adapts PostgreSQL to domain.ServerRepository
+// ServerRepositoryAdapter adapts a Database to domain.ServerRepository
 type ServerRepositoryAdapter struct {
-	postgres *PostgreSQL
+	db Database
 }
 
 // NewServerRepositoryAdapter creates a new server repository adapter
-func NewServerRepositoryAdapter(postgres *PostgreSQL) *ServerRepositoryAdapter {
-	return &ServerRepositoryAdapter{postgres: postgres}
+func NewServerRepositoryAdapter(db Database) *ServerRepositoryAdapter {
+	return &ServerRepositoryAdapter{db: db}
 }
 
 // Create implements domain.ServerRepository
 func (a *ServerRepositoryAdapter) Create(ctx context.Context, server *domain.Server) error {
-	return a.postgres.CreateServer(ctx, server)
+	return a.db.CreateServer(ctx, server)
 }
 
 // GetByID implements domain.ServerRepository
 func (a *ServerRepositoryAdapter) GetByID(ctx context.Context, id int) (*domain.Server, error) {
-	return a.postgres.GetServerByID(ctx, id)
+	return a.db.GetServerByID(ctx, id)
 }
 
 // GetByServerID implements domain.ServerRepository
 func (a *ServerRepositoryAdapter) GetByServerID(ctx context.Context, serverID string) (*domain.Server, error) {
-	return a.postgres.GetServerByServerID(ctx, serverID)
+	return a.db.GetServerByServerID(ctx, serverID)
 }
 
 // Update implements domain.ServerRepository
 func (a *ServerRepositoryAdapter) Update(ctx context.Context, server *domain.Server) error {
-	return a.postgres.UpdateServer(ctx, server)
+	return a.db.UpdateServer(ctx, server)
 }
 
 // Delete implements domain.ServerRepository
 func (a *ServerRepositoryAdapter) Delete(ctx context.Context, id int) error {
-	return a.postgres.DeleteServer(ctx, id)
+	return a.db.DeleteServer(ctx, id)
 }
 
 // ListByUserID implements domain.ServerRepository
 func (a *ServerRepositoryAdapter) ListByUserID(ctx context.Context, userID int) ([]*domain.Server, error) {
-	return a.postgres.ListServersByUserID(ctx, userID)
+	return a.db.ListServersByUserID(ctx, userID)
 }
 
-// UserServerRepositoryAdapter adapts PostgreSQL to domain.UserServerRepository
+// UserServerRepositoryAdapter adapts a Database to domain.UserServerRepository
 type UserServerRepositoryAdapter struct {
-	postgres *PostgreSQL
+	db Database
 }
 
 // NewUserServerRepositoryAdapter creates a new user-server repository adapter
-func NewUserServerRepositoryAdapter(postgres *PostgreSQL) *UserServerRepositoryAdapter {
-	return &UserServerRepositoryAdapter{postgres: postgres}
+func NewUserServerRepositoryAdapter(db Database) *UserServerRepositoryAdapter {
+	return &UserServerRepositoryAdapter{db: db}
 }
 
 // Create implements domain.UserServerRepository
 func (a *UserServerRepositoryAdapter) Create(ctx context.Context, userServer *domain.UserServer) error {
-	return a.postgres.CreateUserServer(ctx, userServer)
+	return a.db.CreateUserServer(ctx, userServer)
 }
 
 // Delete implements domain.UserServerRepository
 func (a *UserServerRepositoryAdapter) Delete(ctx context.Context, userID, serverID int) error {
-	return a.postgres.DeleteUserServer(ctx, userID, serverID)
+	return a.db.DeleteUserServer(ctx, userID, serverID)
 }
 
 // GetUserRole implements domain.UserServerRepository
 func (a *UserServerRepositoryAdapter) GetUserRole(ctx context.Context, userID, serverID int) (string, error) {
-	return a.postgres.GetUserRole(ctx, userID, serverID)
+	return a.db.GetUserRole(ctx, userID, serverID)
 }
 
 // ListServersByUserID implements domain.UserServerRepository
 func (a *UserServerRepositoryAdapter) ListServersByUserID(ctx context.Context, userID int) ([]*domain.Server, error) {
-	return a.postgres.ListServersByUserID2(ctx, userID)
+	return a.db.ListServersByUserID(ctx, userID)
 }
 
 // ListUsersByServerID implements domain.UserServerRepository
 func (a *UserServerRepositoryAdapter) ListUsersByServerID(ctx context.Context, serverID int) ([]*domain.User, error) {
-	return a.postgres.ListUsersByServerID(ctx, serverID)
+	return a.db.ListUsersByServerID(ctx, serverID)
 }
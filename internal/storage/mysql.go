@@ -0,0 +1,373 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/servereye/servereyebot/pkg/domain"
+)
+
+// MySQL implements database operations using MySQL or MariaDB
+type MySQL struct {
+	db *sql.DB
+}
+
+// NewMySQL creates a new MySQL instance. databaseURL is a driver DSN,
+// e.g. "servereye:secret@tcp(localhost:3306)/servereye?parseTime=true".
+func NewMySQL(databaseURL string) (*MySQL, error) {
+	m, err := openMySQL(databaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Test connection
+	if err := m.db.Ping(); err != nil {
+		m.db.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	return m, nil
+}
+
+// openMySQL creates a MySQL instance without connecting to the database
+func openMySQL(databaseURL string) (*MySQL, error) {
+	db, err := sql.Open("mysql", databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database (is the binary built with -tags mysql?): %w", err)
+	}
+
+	// Configure connection pool
+	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(25)
+	db.SetConnMaxLifetime(5 * time.Minute)
+	db.SetConnMaxIdleTime(5 * time.Minute)
+
+	return &MySQL{db: db}, nil
+}
+
+// Close closes the database connection
+func (m *MySQL) Close() error {
+	return m.db.Close()
+}
+
+// UserRepository implementation
+
+// CreateUser creates a new user in the database
+func (m *MySQL) CreateUser(ctx context.Context, user *domain.User) error {
+	// LAST_INSERT_ID(id) makes the ID of an existing row available on update
+	query := `
+		INSERT INTO users (telegram_id, username, first_name, last_name, is_active, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			id = LAST_INSERT_ID(id),
+			username = VALUES(username),
+			first_name = VALUES(first_name),
+			last_name = VALUES(last_name),
+			updated_at = VALUES(updated_at)`
+
+	now := time.Now()
+	result, err := m.db.ExecContext(ctx, query,
+		user.TelegramID, user.Username, user.FirstName, user.LastName, true, now, now)
+	if err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+	user.ID = int(id)
+
+	return nil
+}
+
+// GetUserByTelegramID retrieves a user by their Telegram ID
+func (m *MySQL) GetUserByTelegramID(ctx context.Context, telegramID int64) (*domain.User, error) {
+	query := `
+		SELECT id, telegram_id, COALESCE(username, ''), COALESCE(first_name, ''), COALESCE(last_name, ''), is_active, created_at, updated_at
+		FROM users
+		WHERE telegram_id = ? AND is_active = true`
+
+	var user domain.User
+	var createdAt, updatedAt time.Time
+
+	err := m.db.QueryRowContext(ctx, query, telegramID).Scan(
+		&user.ID, &user.TelegramID, &user.Username, &user.FirstName, &user.LastName,
+		&user.IsAdmin, &createdAt, &updatedAt)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("user not found")
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	user.CreatedAt = createdAt
+	user.LastSeen = updatedAt
+
+	return &user, nil
+}
+
+// UpdateUser updates an existing user
+func (m *MySQL) UpdateUser(ctx context.Context, user *domain.User) error {
+	query := `
+		UPDATE users
+		SET username = ?, first_name = ?, last_name = ?, updated_at = ?
+		WHERE id = ?`
+
+	_, err := m.db.ExecContext(ctx, query,
+		user.Username, user.FirstName, user.LastName, time.Now(), user.ID)
+
+	if err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteUser soft deletes a user
+func (m *MySQL) DeleteUser(ctx context.Context, id int) error {
+	query := `UPDATE users SET is_active = false WHERE id = ?`
+
+	_, err := m.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	return nil
+}
+
+// ServerRepository implementation
+
+// CreateServer creates a new server in the database
+func (m *MySQL) CreateServer(ctx context.Context, server *domain.Server) error {
+	query := `
+		INSERT INTO servers (server_id, name, description, ip_address, port, is_active, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+
+	now := time.Now()
+	result, err := m.db.ExecContext(ctx, query,
+		server.ServerID, server.Name, server.Description, server.IPAddress,
+		server.Port, server.IsActive, now, now)
+	if err != nil {
+		return fmt.Errorf("failed to create server: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to create server: %w", err)
+	}
+
+	server.ID = int(id)
+	server.CreatedAt = now
+	server.UpdatedAt = now
+
+	return nil
+}
+
+// GetServerByID retrieves a server by its database ID
+func (m *MySQL) GetServerByID(ctx context.Context, id int) (*domain.Server, error) {
+	query := `
+		SELECT id, server_id, name, COALESCE(description, ''), COALESCE(ip_address, ''), port, is_active, created_at, updated_at
+		FROM servers
+		WHERE id = ? AND is_active = true`
+
+	return m.getServer(ctx, query, id)
+}
+
+// GetServerByServerID retrieves a server by its server_id (e.g., srv_12313)
+func (m *MySQL) GetServerByServerID(ctx context.Context, serverID string) (*domain.Server, error) {
+	query := `
+		SELECT id, server_id, name, COALESCE(description, ''), COALESCE(ip_address, ''), port, is_active, created_at, updated_at
+		FROM servers
+		WHERE server_id = ? AND is_active = true`
+
+	return m.getServer(ctx, query, serverID)
+}
+
+// getServer retrieves a single server selected by query
+func (m *MySQL) getServer(ctx context.Context, query string, arg interface{}) (*domain.Server, error) {
+	var server domain.Server
+	err := m.db.QueryRowContext(ctx, query, arg).Scan(
+		&server.ID, &server.ServerID, &server.Name, &server.Description,
+		&server.IPAddress, &server.Port, &server.IsActive,
+		&server.CreatedAt, &server.UpdatedAt)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("server not found")
+		}
+		return nil, fmt.Errorf("failed to get server: %w", err)
+	}
+
+	return &server, nil
+}
+
+// UpdateServer updates an existing server
+func (m *MySQL) UpdateServer(ctx context.Context, server *domain.Server) error {
+	query := `
+		UPDATE servers
+		SET name = ?, description = ?, ip_address = ?, port = ?, is_active = ?, updated_at = ?
+		WHERE id = ?`
+
+	server.UpdatedAt = time.Now()
+	_, err := m.db.ExecContext(ctx, query,
+		server.Name, server.Description, server.IPAddress,
+		server.Port, server.IsActive, server.UpdatedAt, server.ID)
+
+	if err != nil {
+		return fmt.Errorf("failed to update server: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteServer soft deletes a server
+func (m *MySQL) DeleteServer(ctx context.Context, id int) error {
+	query := `UPDATE servers SET is_active = false WHERE id = ?`
+
+	_, err := m.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete server: %w", err)
+	}
+
+	return nil
+}
+
+// ListServersByUserID retrieves all servers associated with a user
+func (m *MySQL) ListServersByUserID(ctx context.Context, userID int) ([]*domain.Server, error) {
+	query := `
+		SELECT s.id, s.server_id, s.name, COALESCE(s.description, ''), COALESCE(s.ip_address, ''), s.port, s.is_active, s.created_at, s.updated_at
+		FROM servers s
+		INNER JOIN user_servers us ON s.server_id = us.server_id
+		INNER JOIN users u ON us.user_id = u.id
+		WHERE u.telegram_id = ? AND s.is_active = true AND u.is_active = true
+		ORDER BY s.name`
+
+	rows, err := m.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list servers: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var servers []*domain.Server
+	for rows.Next() {
+		var server domain.Server
+		err := rows.Scan(
+			&server.ID, &server.ServerID, &server.Name, &server.Description,
+			&server.IPAddress, &server.Port, &server.IsActive,
+			&server.CreatedAt, &server.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan server: %w", err)
+		}
+		servers = append(servers, &server)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating servers: %w", err)
+	}
+
+	return servers, nil
+}
+
+// UserServerRepository implementation
+
+// CreateUserServer creates a new user-server relationship
+func (m *MySQL) CreateUserServer(ctx context.Context, userServer *domain.UserServer) error {
+	query := `
+		INSERT INTO user_servers (user_id, server_id, role, added_at)
+		VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			id = LAST_INSERT_ID(id),
+			role = VALUES(role),
+			added_at = VALUES(added_at)`
+
+	userServer.CreatedAt = time.Now()
+	result, err := m.db.ExecContext(ctx, query,
+		userServer.UserID, userServer.ServerID, userServer.Role, userServer.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create user-server relationship: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to create user-server relationship: %w", err)
+	}
+	userServer.ID = int(id)
+
+	return nil
+}
+
+// DeleteUserServer removes a user-server relationship
+func (m *MySQL) DeleteUserServer(ctx context.Context, userID, serverID int) error {
+	query := `DELETE FROM user_servers WHERE user_id = ? AND server_id = ?`
+
+	_, err := m.db.ExecContext(ctx, query, userID, serverID)
+	if err != nil {
+		return fmt.Errorf("failed to delete user-server relationship: %w", err)
+	}
+
+	return nil
+}
+
+// GetUserRole retrieves the role of a user for a specific server
+func (m *MySQL) GetUserRole(ctx context.Context, userID, serverID int) (string, error) {
+	query := `
+		SELECT role
+		FROM user_servers
+		WHERE user_id = ? AND server_id = ?`
+
+	var role string
+	err := m.db.QueryRowContext(ctx, query, userID, serverID).Scan(&role)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("user-server relationship not found")
+		}
+		return "", fmt.Errorf("failed to get user role: %w", err)
+	}
+
+	return role, nil
+}
+
+// ListUsersByServerID retrieves all users associated with a server
+func (m *MySQL) ListUsersByServerID(ctx context.Context, serverID int) ([]*domain.User, error) {
+	query := `
+		SELECT u.id, u.telegram_id, COALESCE(u.username, ''), COALESCE(u.first_name, ''), COALESCE(u.last_name, ''), u.is_active, u.created_at, u.updated_at
+		FROM users u
+		INNER JOIN user_servers us ON u.id = us.user_id
+		WHERE us.server_id = ? AND u.is_active = true
+		ORDER BY u.username`
+
+	rows, err := m.db.QueryContext(ctx, query, serverID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var users []*domain.User
+	for rows.Next() {
+		var user domain.User
+		var createdAt, updatedAt time.Time
+		err := rows.Scan(
+			&user.ID, &user.TelegramID, &user.Username, &user.FirstName, &user.LastName,
+			&user.IsAdmin, &createdAt, &updatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		user.CreatedAt = createdAt
+		user.LastSeen = updatedAt
+		users = append(users, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating users: %w", err)
+	}
+
+	return users, nil
+}
@@ -0,0 +1,7 @@
+//go:build mysql
+
+package storage
+
+// The MySQL driver is linked only into binaries built with -tags mysql, so that default
+// builds for PostgreSQL do not carry it.
+import _ "github.com/go-sql-driver/mysql"
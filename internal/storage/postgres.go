@@ -17,6 +17,22 @@ type PostgreSQL struct {
 
 // NewPostgreSQL creates a new PostgreSQL instance
 func NewPostgreSQL(databaseURL string) (*PostgreSQL, error) {
+	p, err := openPostgreSQL(databaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Test connection
+	if err := p.db.Ping(); err != nil {
+		p.db.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	return p, nil
+}
+
+// openPostgreSQL creates a PostgreSQL instance without connecting to the database
+func openPostgreSQL(databaseURL string) (*PostgreSQL, error) {
 	db, err := sql.Open("postgres", databaseURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
@@ -28,11 +44,6 @@ func NewPostgreSQL(databaseURL string) (*PostgreSQL, error) {
 	db.SetConnMaxLifetime(5 * time.Minute)
 	db.SetConnMaxIdleTime(5 * time.Minute)
 
-	// Test connection
-	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %w", err)
-	}
-
 	return &PostgreSQL{db: db}, nil
 }
 
@@ -317,11 +328,6 @@ func (p *PostgreSQL) GetUserRole(ctx context.Context, userID, serverID int) (str
 	return role, nil
 }
 
-// ListServersByUserID retrieves all servers for a user (alias for ListServersByUserID)
-func (p *PostgreSQL) ListServersByUserID2(ctx context.Context, userID int) ([]*domain.Server, error) {
-	return p.ListServersByUserID(ctx, userID)
-}
-
 // ListUsersByServerID retrieves all users associated with a server
 func (p *PostgreSQL) ListUsersByServerID(ctx context.Context, serverID int) ([]*domain.User, error) {
 	query := `
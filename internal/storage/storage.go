@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/servereye/servereyebot/pkg/domain"
+)
+
+// Database represents a storage backend behind the domain repository adapters
+type Database interface {
+	CreateUser(ctx context.Context, user *domain.User) error
+	GetUserByTelegramID(ctx context.Context, telegramID int64) (*domain.User, error)
+	UpdateUser(ctx context.Context, user *domain.User) error
+	DeleteUser(ctx context.Context, id int) error
+
+	CreateServer(ctx context.Context, server *domain.Server) error
+	GetServerByID(ctx context.Context, id int) (*domain.Server, error)
+	GetServerByServerID(ctx context.Context, serverID string) (*domain.Server, error)
+	UpdateServer(ctx context.Context, server *domain.Server) error
+	DeleteServer(ctx context.Context, id int) error
+	ListServersByUserID(ctx context.Context, userID int) ([]*domain.Server, error)
+
+	CreateUserServer(ctx context.Context, userServer *domain.UserServer) error
+	DeleteUserServer(ctx context.Context, userID, serverID int) error
+	GetUserRole(ctx context.Context, userID, serverID int) (string, error)
+	ListUsersByServerID(ctx context.Context, serverID int) ([]*domain.User, error)
+
+	Close() error
+}
+
+// Open creates a storage backend for the given database driver
+func Open(driver, databaseURL string) (Database, error) {
+	switch driver {
+	case "postgres":
+		return NewPostgreSQL(databaseURL)
+	case "mysql":
+		return NewMySQL(databaseURL)
+	default:
+		return nil, fmt.Errorf("unsupported database driver '%s'", driver)
+	}
+}
+
+// OpenUnchecked creates a storage backend for the given database driver without
+// connecting to the database, which may be unreachable until later
+func OpenUnchecked(driver, databaseURL string) (Database, error) {
+	switch driver {
+	case "postgres":
+		return openPostgreSQL(databaseURL)
+	case "mysql":
+		return openMySQL(databaseURL)
+	default:
+		return nil, fmt.Errorf("unsupported database driver '%s'", driver)
+	}
+}
@@ -0,0 +1,254 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// PollingPolicy represents long polling: its recovery after failed requests and how
+// received updates are handled
+type PollingPolicy struct {
+	RetryDelay    time.Duration // delay after the first failure, doubled on each further one
+	MaxRetryDelay time.Duration
+	AlertAfter    time.Duration // how long polling may fail before an outage is reported
+	Workers       int           // updates handled concurrently
+	QueueSize     int           // updates waiting per worker before polling pauses
+}
+
+// PollingEvent reports an outage of long polling or its end
+type PollingEvent struct {
+	Recovered bool
+	Since     time.Time     // last successful poll before the outage
+	Gap       time.Duration // time without updates so far
+	Failures  int           // failed polls in a row
+	Err       error         // last polling error, nil on recovery
+}
+
+// PollingHandler is notified about prolonged polling outages and their recovery
+type PollingHandler func(ctx context.Context, event PollingEvent)
+
+// UpdateClaim claims an update before it is handled, reporting whether it is still
+// unhandled. Replicas claim updates in a shared store so that each is handled once.
+type UpdateClaim func(ctx context.Context, updateID int) (bool, error)
+
+// pollingStats tracks polling health for metrics
+type pollingStats struct {
+	mu          sync.Mutex
+	lastSuccess time.Time
+	failures    int64 // failed polls in total
+	streak      int   // failed polls in a row
+	gaps        int64
+	gapSeconds  float64
+	longestGap  time.Duration
+	alerted     bool
+}
+
+// OnPollingOutage sets the handler notified when polling fails for longer than
+// PollingPolicy.AlertAfter and again when it recovers
+func (ts *TelegramService) OnPollingOutage(handler PollingHandler) {
+	ts.pollingHandler = handler
+}
+
+// DeduplicateUpdates sets the claim every update must pass before it is handled. When
+// claiming fails, the update is handled anyway, as handling it twice beats losing it.
+func (ts *TelegramService) DeduplicateUpdates(claim UpdateClaim) {
+	ts.claim = claim
+}
+
+// poll receives updates until ctx is done or receiving is stopped. Failed requests are
+// retried with backoff forever, so a network blip or Telegram outage never ends polling.
+func (ts *TelegramService) poll(ctx context.Context, handler interface{}) {
+	u := tgbotapi.NewUpdate(0)
+	u.Timeout = int(ts.pollTimeout.Seconds())
+
+	pool := newUpdatePool(ts.polling.Workers, ts.polling.QueueSize, &ts.workers, func(update tgbotapi.Update) {
+		ts.dispatch(ctx, handler, update)
+	})
+	defer pool.close()
+
+	delay := ts.polling.RetryDelay
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ts.stop:
+			return
+		default:
+		}
+
+		updates, err := ts.bot.GetUpdates(u)
+		if err != nil {
+			ts.pollFailed(ctx, err, delay)
+
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return
+			case <-ts.stop:
+				return
+			}
+
+			delay *= 2
+			if ts.polling.MaxRetryDelay > 0 && delay > ts.polling.MaxRetryDelay {
+				delay = ts.polling.MaxRetryDelay
+			}
+			continue
+		}
+
+		ts.pollSucceeded(ctx)
+		delay = ts.polling.RetryDelay
+
+		for _, update := range updates {
+			if update.UpdateID < u.Offset {
+				continue
+			}
+			if !pool.submit(ctx, ts.stop, update) {
+				return
+			}
+			u.Offset = update.UpdateID + 1
+		}
+	}
+}
+
+// dispatch hands an update to the handler, recovering from panics so that one
+// bad update cannot stop its worker
+func (ts *TelegramService) dispatch(ctx context.Context, handler interface{}, update tgbotapi.Update) {
+	h, ok := handler.(interface {
+		HandleUpdate(context.Context, *Update) error
+	})
+	if !ok {
+		return
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			ts.logger.Error("Panic while handling update", "update_id", update.UpdateID, "panic", fmt.Sprint(r))
+		}
+	}()
+
+	updateCtx, cancel := context.WithTimeout(ctx, ts.updateTimeout)
+	defer cancel()
+
+	if ts.claim != nil {
+		claimed, err := ts.claim(updateCtx, update.UpdateID)
+		if err != nil {
+			ts.logger.Warn("Failed to claim update, handling it anyway", "error", err, "update_id", update.UpdateID)
+		} else if !claimed {
+			ts.logger.Debug("Skipping update handled by another replica", "update_id", update.UpdateID)
+			return
+		}
+	}
+
+	if err := h.HandleUpdate(updateCtx, ConvertUpdate(update)); err != nil {
+		ts.logger.Error("Error handling update", "error", err)
+	}
+}
+
+// pollFailed records a failed poll and reports an outage once it lasts long enough
+func (ts *TelegramService) pollFailed(ctx context.Context, err error, delay time.Duration) {
+	ts.stats.mu.Lock()
+	ts.stats.failures++
+	ts.stats.streak++
+	event := PollingEvent{
+		Since:    ts.stats.lastSuccess,
+		Gap:      time.Since(ts.stats.lastSuccess),
+		Failures: ts.stats.streak,
+		Err:      err,
+	}
+	notify := !ts.stats.alerted && ts.polling.AlertAfter > 0 && event.Gap >= ts.polling.AlertAfter
+	if notify {
+		ts.stats.alerted = true
+	}
+	ts.stats.mu.Unlock()
+
+	ts.logger.Warn("Failed to get updates, retrying", "error", err, "failures", event.Failures, "delay", delay.String())
+
+	if notify {
+		ts.logger.Error("Telegram polling is down", "since", event.Since, "failures", event.Failures, "error", err)
+		if ts.pollingHandler != nil {
+			ts.pollingHandler(ctx, event)
+		}
+	}
+}
+
+// pollSucceeded records a successful poll, closing the gap left by failed ones
+func (ts *TelegramService) pollSucceeded(ctx context.Context) {
+	now := time.Now()
+
+	ts.stats.mu.Lock()
+	event := PollingEvent{
+		Recovered: true,
+		Since:     ts.stats.lastSuccess,
+		Gap:       now.Sub(ts.stats.lastSuccess),
+		Failures:  ts.stats.streak,
+	}
+	failed, alerted := ts.stats.streak > 0, ts.stats.alerted
+	if failed {
+		ts.stats.gaps++
+		ts.stats.gapSeconds += event.Gap.Seconds()
+		if event.Gap > ts.stats.longestGap {
+			ts.stats.longestGap = event.Gap
+		}
+	}
+	ts.stats.lastSuccess = now
+	ts.stats.streak = 0
+	ts.stats.alerted = false
+	ts.stats.mu.Unlock()
+
+	if !failed {
+		return
+	}
+
+	ts.logger.Info("Telegram polling recovered", "gap", event.Gap.String(), "failures", event.Failures)
+	if alerted && ts.pollingHandler != nil {
+		ts.pollingHandler(ctx, event)
+	}
+}
+
+// WritePrometheus writes polling health in Prometheus text exposition format
+func (ts *TelegramService) WritePrometheus(w io.Writer) error {
+	ts.stats.mu.Lock()
+	up := 0
+	if ts.stats.streak == 0 && !ts.stats.lastSuccess.IsZero() {
+		up = 1
+	}
+	lines := []struct {
+		name  string
+		kind  string
+		help  string
+		value string
+	}{
+		{"servereyebot_telegram_polling_up", "gauge", "Whether the last Telegram poll succeeded.", fmt.Sprint(up)},
+		{"servereyebot_telegram_polling_last_success_timestamp_seconds", "gauge", "Unix time of the last successful Telegram poll.", fmt.Sprint(unixSeconds(ts.stats.lastSuccess))},
+		{"servereyebot_telegram_polling_failures_total", "counter", "Failed Telegram polls.", fmt.Sprint(ts.stats.failures)},
+		{"servereyebot_telegram_polling_gaps_total", "counter", "Polling gaps closed by a successful poll after failures.", fmt.Sprint(ts.stats.gaps)},
+		{"servereyebot_telegram_polling_gap_seconds_total", "counter", "Time without updates during closed polling gaps.", fmt.Sprintf("%.3f", ts.stats.gapSeconds)},
+		{"servereyebot_telegram_polling_longest_gap_seconds", "gauge", "Longest closed polling gap.", fmt.Sprintf("%.3f", ts.stats.longestGap.Seconds())},
+		{"servereyebot_telegram_update_queue_depth", "gauge", "Received updates waiting for a worker.", fmt.Sprint(ts.workers.queued.Load())},
+		{"servereyebot_telegram_update_workers_busy", "gauge", "Workers handling an update.", fmt.Sprint(ts.workers.busy.Load())},
+		{"servereyebot_telegram_update_workers", "gauge", "Workers handling updates.", fmt.Sprint(max(ts.polling.Workers, 1))},
+		{"servereyebot_telegram_updates_handled_total", "counter", "Updates handled by workers.", fmt.Sprint(ts.workers.handled.Load())},
+		{"servereyebot_telegram_update_queue_stalls_total", "counter", "Times polling paused because the queue of a worker was full.", fmt.Sprint(ts.workers.stalls.Load())},
+	}
+	ts.stats.mu.Unlock()
+
+	for _, line := range lines {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %s\n", line.name, line.help, line.name, line.kind, line.name, line.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unixSeconds returns the Unix time of t, zero for the zero time
+func unixSeconds(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
@@ -0,0 +1,293 @@
+package telegram
+
+import (
+	"context"
+	stderrors "errors"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// maxPacedChats is the number of chats whose pacing is remembered before chats that may
+// be messaged again right away are forgotten
+const maxPacedChats = 1024
+
+// SendPolicy paces outgoing messages below the limits of the Bot API: about 30 messages
+// per second overall, one per second to a chat and 20 per minute to a group
+type SendPolicy struct {
+	Rate          int           // messages per second across all chats
+	Burst         int           // messages sent at once before pacing starts
+	ChatInterval  time.Duration // between messages to a private chat
+	GroupInterval time.Duration // between messages to a group chat
+	Retries       int           // resends of a message rejected with 429 Too Many Requests
+}
+
+// editKey identifies a message being edited
+type editKey struct {
+	chatID    int64
+	messageID int
+}
+
+// pendingEdit is an edit waiting for its turn. Edits of the same message arriving
+// meanwhile replace it, so that only the latest text is sent. The edit is dropped once
+// every caller waiting for it has given up.
+type pendingEdit struct {
+	c       tgbotapi.Chattable
+	waiters int // callers still waiting, guarded by sender.mu
+	cancel  context.CancelFunc
+	done    chan struct{}
+	msg     tgbotapi.Message
+	err     error
+}
+
+// sender is the central queue of outgoing messages. Every message waits for a slot in the
+// overall rate and in the rate of its chat, and messages rejected by flood control are
+// sent again after the wait Telegram asks for.
+type sender struct {
+	api    func(tgbotapi.Chattable) (tgbotapi.Message, error)
+	policy SendPolicy
+	logger Logger
+
+	mu       sync.Mutex
+	tat      time.Time // theoretical arrival time of the next message in the overall rate
+	chatNext map[int64]time.Time
+	edits    map[editKey]*pendingEdit
+}
+
+// newSender creates a sender calling api for every message
+func newSender(api func(tgbotapi.Chattable) (tgbotapi.Message, error), policy SendPolicy, logger Logger) *sender {
+	if policy.Rate <= 0 {
+		policy.Rate = 30
+	}
+	if policy.Burst <= 0 {
+		policy.Burst = 1
+	}
+	return &sender{
+		api:      api,
+		policy:   policy,
+		logger:   logger,
+		chatNext: make(map[int64]time.Time),
+		edits:    make(map[editKey]*pendingEdit),
+	}
+}
+
+// send sends a message once its chat may receive one. Edits of a message still waiting
+// are coalesced, all callers getting the result of the latest edit. Each caller waits
+// until its own ctx is done.
+func (s *sender) send(ctx context.Context, c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	chatID, key, isEdit := target(c)
+	if !isEdit {
+		return s.sendPaced(ctx, chatID, c)
+	}
+
+	s.mu.Lock()
+	pending, ok := s.edits[key]
+	if ok {
+		pending.c = c
+	} else {
+		editCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		pending = &pendingEdit{c: c, cancel: cancel, done: make(chan struct{})}
+		s.edits[key] = pending
+		go s.sendEdit(editCtx, chatID, key, pending)
+	}
+	pending.waiters++
+	s.mu.Unlock()
+
+	select {
+	case <-pending.done:
+		return pending.msg, pending.err
+	case <-ctx.Done():
+		s.mu.Lock()
+		pending.waiters--
+		if pending.waiters == 0 {
+			pending.cancel()
+		}
+		s.mu.Unlock()
+		return tgbotapi.Message{}, ctx.Err()
+	}
+}
+
+// sendEdit sends a pending edit once its chat may receive one, unless all its callers
+// gave up meanwhile
+func (s *sender) sendEdit(ctx context.Context, chatID int64, key editKey, pending *pendingEdit) {
+	defer close(pending.done)
+	defer pending.cancel()
+
+	err := s.wait(ctx, chatID)
+
+	s.mu.Lock()
+	delete(s.edits, key)
+	c := pending.c
+	s.mu.Unlock()
+
+	if err != nil {
+		pending.err = err
+		return
+	}
+	pending.msg, pending.err = s.sendNow(ctx, chatID, c)
+}
+
+// sendPaced waits for a slot and sends a message
+func (s *sender) sendPaced(ctx context.Context, chatID int64, c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	if err := s.wait(ctx, chatID); err != nil {
+		return tgbotapi.Message{}, err
+	}
+	return s.sendNow(ctx, chatID, c)
+}
+
+// sendNow sends a message whose slot has come, resending it after the wait asked for by
+// flood control
+func (s *sender) sendNow(ctx context.Context, chatID int64, c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	for attempt := 0; ; attempt++ {
+		msg, err := s.api(c)
+		retryAfter, limited := floodWait(err)
+		if !limited || attempt >= s.policy.Retries {
+			return msg, err
+		}
+
+		s.logger.Warn("Telegram flood control hit, resending later", "chat_id", chatID, "retry_after", retryAfter.String(), "attempt", attempt+1)
+		s.mu.Lock()
+		if next := time.Now().Add(retryAfter); next.After(s.chatNext[chatID]) {
+			s.chatNext[chatID] = next
+		}
+		s.mu.Unlock()
+
+		if err := s.wait(ctx, chatID); err != nil {
+			return msg, err
+		}
+	}
+}
+
+// slot is a booked turn to send a message
+type slot struct {
+	chatID   int64
+	at       time.Time
+	tat      time.Time // theoretical arrival time of the overall rate after the slot
+	prevTAT  time.Time // and before it
+	chatNext time.Time // next turn of the chat after the slot
+	prevNext time.Time // and before it
+}
+
+// wait blocks until a message to a chat may be sent. A slot given up because ctx is done
+// is released, so that abandoned messages do not delay the ones after them.
+func (s *sender) wait(ctx context.Context, chatID int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	booked := s.reserve(chatID, now)
+	delay := booked.at.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		s.release(booked)
+		return ctx.Err()
+	}
+}
+
+// reserve books the next slot of a chat within the overall rate. The overall rate is kept
+// with the generic cell rate algorithm, which lets Burst messages through at once.
+func (s *sender) reserve(chatID int64, now time.Time) slot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	at := now
+	if next := s.chatNext[chatID]; next.After(at) {
+		at = next
+	}
+
+	prevTAT := s.tat
+	interval := s.interval()
+	tolerance := time.Duration(s.policy.Burst-1) * interval
+	if earliest := s.tat.Add(-tolerance); earliest.After(at) {
+		at = earliest
+	}
+	if s.tat.After(at) {
+		s.tat = s.tat.Add(interval)
+	} else {
+		s.tat = at.Add(interval)
+	}
+
+	if len(s.chatNext) >= maxPacedChats {
+		for id, next := range s.chatNext {
+			if !next.After(now) {
+				delete(s.chatNext, id)
+			}
+		}
+	}
+	booked := slot{chatID: chatID, at: at, tat: s.tat, prevTAT: prevTAT, chatNext: at.Add(s.chatInterval(chatID)), prevNext: s.chatNext[chatID]}
+	s.chatNext[chatID] = booked.chatNext
+
+	return booked
+}
+
+// release gives back a slot that will not be used. The overall rate and the turn of the
+// chat are restored when no later message booked them; otherwise only the slot's share of
+// the overall rate is returned, and the later messages keep their turns.
+func (s *sender) release(booked slot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tat.Equal(booked.tat) {
+		s.tat = booked.prevTAT
+	} else {
+		s.tat = s.tat.Add(-s.interval())
+	}
+	if next, ok := s.chatNext[booked.chatID]; ok && next.Equal(booked.chatNext) {
+		if booked.prevNext.IsZero() {
+			delete(s.chatNext, booked.chatID)
+		} else {
+			s.chatNext[booked.chatID] = booked.prevNext
+		}
+	}
+}
+
+// interval returns the pause between messages within the overall rate
+func (s *sender) interval() time.Duration {
+	return time.Second / time.Duration(s.policy.Rate)
+}
+
+// chatInterval returns the pause between messages to a chat. Groups and channels have
+// negative IDs.
+func (s *sender) chatInterval(chatID int64) time.Duration {
+	if chatID < 0 {
+		return s.policy.GroupInterval
+	}
+	return s.policy.ChatInterval
+}
+
+// target returns the chat of a message and, for edits, the message edited
+func target(c tgbotapi.Chattable) (int64, editKey, bool) {
+	switch m := c.(type) {
+	case tgbotapi.MessageConfig:
+		return m.ChatID, editKey{}, false
+	case tgbotapi.DocumentConfig:
+		return m.ChatID, editKey{}, false
+	case tgbotapi.EditMessageTextConfig:
+		return m.ChatID, editKey{chatID: m.ChatID, messageID: m.MessageID}, m.InlineMessageID == ""
+	}
+	return 0, editKey{}, false
+}
+
+// floodWait returns the wait asked for when Telegram rejected a request with
+// 429 Too Many Requests
+func floodWait(err error) (time.Duration, bool) {
+	var apiErr *tgbotapi.Error
+	if !stderrors.As(err, &apiErr) || apiErr.Code != 429 {
+		return 0, false
+	}
+	wait := time.Duration(apiErr.RetryAfter) * time.Second
+	if wait <= 0 {
+		wait = time.Second
+	}
+	return wait, true
+}
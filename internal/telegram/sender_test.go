@@ -0,0 +1,195 @@
+package telegram
+
+import (
+	"context"
+	stderrors "errors"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// nopLogger discards log output
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, fields ...interface{}) {}
+func (nopLogger) Info(msg string, fields ...interface{})  {}
+func (nopLogger) Warn(msg string, fields ...interface{})  {}
+func (nopLogger) Error(msg string, fields ...interface{}) {}
+
+// newTestSender creates a sender whose messages are never sent
+func newTestSender(policy SendPolicy) *sender {
+	return newSender(func(tgbotapi.Chattable) (tgbotapi.Message, error) {
+		return tgbotapi.Message{}, nil
+	}, policy, nopLogger{})
+}
+
+func TestReservePacing(t *testing.T) {
+	s := newTestSender(SendPolicy{Rate: 10, Burst: 2, ChatInterval: time.Second, GroupInterval: 3 * time.Second})
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		chatID int64
+		want   time.Duration
+	}{
+		{chatID: 1, want: 0},
+		{chatID: 2, want: 0},                      // within the burst
+		{chatID: 3, want: 100 * time.Millisecond}, // burst used up, paced by the overall rate
+		{chatID: 1, want: time.Second},            // paced by the chat
+		{chatID: -100, want: time.Second},         // queued behind the chat's slot in the overall rate
+		{chatID: -100, want: 4 * time.Second},     // paced by the group
+	}
+
+	for i, step := range steps {
+		if got := s.reserve(step.chatID, now).at.Sub(now); got != step.want {
+			t.Errorf("reservation %d to chat %d waits %v, want %v", i+1, step.chatID, got, step.want)
+		}
+	}
+}
+
+func TestWaitReleasesAbandonedSlots(t *testing.T) {
+	s := newTestSender(SendPolicy{Rate: 1, Burst: 1, ChatInterval: 5 * time.Second})
+
+	if err := s.wait(context.Background(), 1); err != nil {
+		t.Fatalf("first wait: %v", err)
+	}
+
+	// A cancelled message books nothing
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.wait(cancelled, 2); !stderrors.Is(err, context.Canceled) {
+		t.Fatalf("wait with a cancelled context = %v, want context.Canceled", err)
+	}
+	if _, booked := s.chatNext[2]; booked {
+		t.Error("wait with a cancelled context booked a slot")
+	}
+
+	// A message given up while waiting returns its slot
+	expiring, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.wait(expiring, 1); !stderrors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wait past the deadline = %v, want context.DeadlineExceeded", err)
+	}
+
+	now := time.Now()
+	if delay := s.reserve(2, now).at.Sub(now); delay > time.Second {
+		t.Errorf("next message waits %v, want at most the 1s of the overall rate", delay)
+	}
+	if next := s.chatNext[1]; next.Sub(now) > 5*time.Second {
+		t.Errorf("chat 1 may be messaged again in %v, want its turn from the delivered message", next.Sub(now))
+	}
+}
+
+func TestReleaseKeepsLaterBookings(t *testing.T) {
+	s := newTestSender(SendPolicy{Rate: 10, Burst: 1, ChatInterval: time.Second})
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	first := s.reserve(1, now)
+	abandoned := s.reserve(1, now)
+	later := s.reserve(1, now)
+	s.release(abandoned)
+
+	if next := s.chatNext[1]; !next.Equal(later.chatNext) {
+		t.Errorf("chat turn = %v after releasing an earlier slot, want the later booking's %v", next, later.chatNext)
+	}
+
+	s.release(later)
+	if next := s.chatNext[1]; !next.Equal(abandoned.chatNext) {
+		t.Errorf("chat turn = %v after releasing the last slot, want %v", next, abandoned.chatNext)
+	}
+	if first.at != now {
+		t.Errorf("first slot at %v, want %v", first.at, now)
+	}
+}
+
+// editRecorder records the texts of the edits sent
+type editRecorder struct {
+	mu    sync.Mutex
+	texts []string
+}
+
+func (r *editRecorder) api(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	if edit, ok := c.(tgbotapi.EditMessageTextConfig); ok {
+		r.mu.Lock()
+		r.texts = append(r.texts, edit.Text)
+		r.mu.Unlock()
+		return tgbotapi.Message{MessageID: edit.MessageID, Text: edit.Text}, nil
+	}
+	return tgbotapi.Message{}, nil
+}
+
+func (r *editRecorder) sent() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.texts...)
+}
+
+// queueEdit sends an edit of message 7 of chat 1 in background, returning once it is pending
+func queueEdit(ctx context.Context, s *sender, text string) chan error {
+	result := make(chan error, 1)
+	go func() {
+		_, err := s.send(ctx, tgbotapi.NewEditMessageText(1, 7, text))
+		result <- err
+	}()
+	for {
+		s.mu.Lock()
+		pending := s.edits[editKey{chatID: 1, messageID: 7}]
+		queued := pending != nil && pending.c.(tgbotapi.EditMessageTextConfig).Text == text
+		s.mu.Unlock()
+		if queued {
+			return result
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSendCoalescesEdits(t *testing.T) {
+	recorder := &editRecorder{}
+	s := newSender(recorder.api, SendPolicy{Rate: 100, Burst: 1, ChatInterval: 100 * time.Millisecond}, nopLogger{})
+
+	// A message to the chat makes the edits wait for its next turn
+	if _, err := s.send(context.Background(), tgbotapi.NewMessage(1, "CPU 95%")); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	// The first caller giving up does not drop the edit of the others
+	first, cancel := context.WithCancel(context.Background())
+	firstResult := queueEdit(first, s, "CPU 96%")
+	secondResult := queueEdit(context.Background(), s, "CPU 97%")
+	cancel()
+	if err := <-firstResult; !stderrors.Is(err, context.Canceled) {
+		t.Errorf("edit of the cancelled caller = %v, want context.Canceled", err)
+	}
+	if err := <-secondResult; err != nil {
+		t.Fatalf("edit of the waiting caller: %v", err)
+	}
+	if texts := recorder.sent(); len(texts) != 1 || texts[0] != "CPU 97%" {
+		t.Errorf("sent edits %q, want only the latest text", texts)
+	}
+
+	// An edit all callers gave up on is not sent
+	var results []chan error
+	var cancels []context.CancelFunc
+	for _, text := range []string{"CPU 98%", "CPU 99%"} {
+		ctx, cancel := context.WithCancel(context.Background())
+		results = append(results, queueEdit(ctx, s, text))
+		cancels = append(cancels, cancel)
+	}
+	for i, cancel := range cancels {
+		cancel()
+		if err := <-results[i]; !stderrors.Is(err, context.Canceled) {
+			t.Errorf("edit %d = %v, want context.Canceled", i+1, err)
+		}
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if texts := recorder.sent(); len(texts) != 1 {
+		t.Errorf("sent edits %q, want the abandoned edit dropped", texts)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.edits) != 0 {
+		t.Errorf("%d edits pending, want none", len(s.edits))
+	}
+}
@@ -2,18 +2,40 @@ package telegram
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/servereye/servereyebot/internal/render"
 	"github.com/servereye/servereyebot/pkg/domain"
 	"github.com/servereye/servereyebot/pkg/errors"
 )
 
 // TelegramService implements domain.TelegramService
 type TelegramService struct {
-	bot    *tgbotapi.BotAPI
-	logger Logger
+	bot            *tgbotapi.BotAPI
+	sender         *sender
+	updateTimeout  time.Duration
+	pollTimeout    time.Duration
+	polling        PollingPolicy
+	pollingHandler PollingHandler
+	claim          UpdateClaim
+	stats          pollingStats
+	workers        workerStats
+	stop           chan struct{}
+	stopOnce       sync.Once
+	logger         Logger
 }
 
+// requestTimeoutMargin is added to the long polling timeout for the HTTP client timeout,
+// so that a hung connection fails instead of stalling polling forever
+const requestTimeoutMargin = 15 * time.Second
+
 // Logger interface for telegram service
 type Logger interface {
 	Debug(msg string, fields ...interface{})
@@ -23,8 +45,8 @@ type Logger interface {
 }
 
 // NewTelegramService creates a new telegram service
-func NewTelegramService(token string, logger Logger) (*TelegramService, error) {
-	bot, err := tgbotapi.NewBotAPI(token)
+func NewTelegramService(token string, updateTimeout, pollTimeout time.Duration, polling PollingPolicy, sending SendPolicy, logger Logger) (*TelegramService, error) {
+	bot, err := tgbotapi.NewBotAPIWithClient(token, tgbotapi.APIEndpoint, &http.Client{Timeout: pollTimeout + requestTimeoutMargin})
 	if err != nil {
 		return nil, errors.NewTelegramAPIError("failed to create bot", err)
 	}
@@ -32,50 +54,181 @@ func NewTelegramService(token string, logger Logger) (*TelegramService, error) {
 	logger.Info("Telegram bot authorized", "username", bot.Self.UserName)
 
 	return &TelegramService{
-		bot:    bot,
-		logger: logger,
+		bot:           bot,
+		sender:        newSender(bot.Send, sending, logger),
+		updateTimeout: updateTimeout,
+		pollTimeout:   pollTimeout,
+		polling:       polling,
+		stop:          make(chan struct{}),
+		logger:        logger,
 	}, nil
 }
 
 // SendMessage sends a message to the specified chat
 func (ts *TelegramService) SendMessage(ctx context.Context, chatID int64, text string) error {
-	msg := tgbotapi.NewMessage(chatID, text)
-	_, err := ts.bot.Send(msg)
-	if err != nil {
+	if err := ts.send(ctx, newMessage(chatID, text, "", nil)); err != nil {
 		return errors.NewTelegramAPIError("failed to send message", err)
 	}
 	return nil
 }
 
+// SendSilentMessage sends a message that arrives without a notification sound, with an
+// optional inline keyboard
+func (ts *TelegramService) SendSilentMessage(ctx context.Context, chatID int64, text string, keyboard interface{}) error {
+	msg := newMessage(chatID, text, "", keyboard)
+	msg.DisableNotification = true
+	if err := ts.send(ctx, msg); err != nil {
+		return errors.NewTelegramAPIError("failed to send silent message", err)
+	}
+	return nil
+}
+
 // SendMessageWithKeyboard sends a message with inline keyboard
 func (ts *TelegramService) SendMessageWithKeyboard(ctx context.Context, chatID int64, text string, keyboard interface{}) error {
+	if err := ts.send(ctx, newMessage(chatID, text, "", keyboard)); err != nil {
+		return errors.NewTelegramAPIError("failed to send message with keyboard", err)
+	}
+	return nil
+}
+
+// SendMarkdown sends a message rendered in MarkdownV2, with an optional inline keyboard.
+// Should Telegram reject the markup, the message is sent again as plain text.
+func (ts *TelegramService) SendMarkdown(ctx context.Context, chatID int64, text string, keyboard interface{}) error {
+	err := ts.send(ctx, newMessage(chatID, text, render.ParseMode, keyboard))
+	if isParseError(err) {
+		ts.logger.Warn("Telegram rejected markdown, sending plain text", "error", err, "chat_id", chatID)
+		err = ts.send(ctx, newMessage(chatID, render.Plain(text), "", keyboard))
+	}
+	if err != nil {
+		return errors.NewTelegramAPIError("failed to send markdown message", err)
+	}
+	return nil
+}
+
+// SendMarkdownMessage sends a message like SendMarkdown and returns its ID, for messages
+// edited later on
+func (ts *TelegramService) SendMarkdownMessage(ctx context.Context, chatID int64, text string, keyboard interface{}) (int, error) {
+	msg, err := ts.sender.send(ctx, newMessage(chatID, text, render.ParseMode, keyboard))
+	if isParseError(err) {
+		ts.logger.Warn("Telegram rejected markdown, sending plain text", "error", err, "chat_id", chatID)
+		msg, err = ts.sender.send(ctx, newMessage(chatID, render.Plain(text), "", keyboard))
+	}
+	if err != nil {
+		return 0, errors.NewTelegramAPIError("failed to send markdown message", err)
+	}
+	return msg.MessageID, nil
+}
+
+// newMessage builds a message with an explicit parse mode, empty for plain text
+func newMessage(chatID int64, text, parseMode string, keyboard interface{}) tgbotapi.MessageConfig {
 	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = parseMode
+	if markup := inlineKeyboard(keyboard); markup != nil {
+		msg.ReplyMarkup = markup
+	}
+	return msg
+}
+
+// inlineKeyboard converts rows of buttons with "text" and "callback_data" into an inline
+// keyboard, or returns nil for anything else. Nil buttons, made for data too long to send,
+// are skipped along with the rows they leave empty.
+func inlineKeyboard(keyboard interface{}) *tgbotapi.InlineKeyboardMarkup {
+	rows, ok := keyboard.([][]map[string]string)
+	if !ok {
+		return nil
+	}
 
-	if keyboard != nil {
-		inlineKeyboard := tgbotapi.NewInlineKeyboardMarkup()
-		if rows, ok := keyboard.([][]map[string]string); ok {
-			for _, row := range rows {
-				var buttons []tgbotapi.InlineKeyboardButton
-				for _, buttonData := range row {
-					callbackData := buttonData["callback_data"]
-					buttons = append(buttons, tgbotapi.InlineKeyboardButton{
-						Text:         buttonData["text"],
-						CallbackData: &callbackData,
-					})
-				}
-				inlineKeyboard.InlineKeyboard = append(inlineKeyboard.InlineKeyboard, buttons)
+	markup := tgbotapi.NewInlineKeyboardMarkup()
+	for _, row := range rows {
+		var buttons []tgbotapi.InlineKeyboardButton
+		for _, buttonData := range row {
+			if buttonData == nil {
+				continue
 			}
-			msg.ReplyMarkup = &inlineKeyboard
+			callbackData := buttonData["callback_data"]
+			buttons = append(buttons, tgbotapi.InlineKeyboardButton{
+				Text:         buttonData["text"],
+				CallbackData: &callbackData,
+			})
+		}
+		if len(buttons) > 0 {
+			markup.InlineKeyboard = append(markup.InlineKeyboard, buttons)
 		}
 	}
+	return &markup
+}
+
+// send sends a message through the send queue, dropping the response
+func (ts *TelegramService) send(ctx context.Context, c tgbotapi.Chattable) error {
+	_, err := ts.sender.send(ctx, c)
+	return err
+}
+
+// isParseError reports whether Telegram rejected the formatting of a message
+func isParseError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "can't parse entities")
+}
 
-	_, err := ts.bot.Send(msg)
+// SendCode sends text as a preformatted code block, which clients show in a monospace
+// font with a copy button. The text must fit in a single message.
+func (ts *TelegramService) SendCode(ctx context.Context, chatID int64, code, language string) error {
+	msg := tgbotapi.NewMessage(chatID, code)
+	msg.Entities = []tgbotapi.MessageEntity{{
+		Type:     "pre",
+		Offset:   0,
+		Length:   len(utf16.Encode([]rune(code))), // entities are measured in UTF-16 code units
+		Language: language,
+	}}
+
+	_, err := ts.sender.send(ctx, msg)
 	if err != nil {
-		return errors.NewTelegramAPIError("failed to send message with keyboard", err)
+		return errors.NewTelegramAPIError("failed to send code", err)
 	}
 	return nil
 }
 
+// SendDocument sends data as a file attachment
+func (ts *TelegramService) SendDocument(ctx context.Context, chatID int64, fileName string, data []byte, caption string) error {
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: fileName, Bytes: data})
+	doc.Caption = caption
+
+	_, err := ts.sender.send(ctx, doc)
+	if err != nil {
+		return errors.NewTelegramAPIError("failed to send document", err)
+	}
+	return nil
+}
+
+// DownloadFile downloads a file sent to the bot, failing for files larger than maxSize bytes
+func (ts *TelegramService) DownloadFile(ctx context.Context, fileID string, maxSize int64) ([]byte, error) {
+	url, err := ts.bot.GetFileDirectURL(fileID)
+	if err != nil {
+		return nil, errors.NewTelegramAPIError("failed to get file", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.NewTelegramAPIError("failed to download file", err)
+	}
+	resp, err := ts.bot.Client.Do(req)
+	if err != nil {
+		return nil, errors.NewTelegramAPIError("failed to download file", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.NewTelegramAPIError("failed to download file", fmt.Errorf("unexpected status %s", resp.Status))
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, errors.NewTelegramAPIError("failed to download file", err)
+	}
+	if int64(len(data)) > maxSize {
+		return nil, errors.NewValidationError(fmt.Sprintf("file is larger than %d bytes", maxSize), nil)
+	}
+	return data, nil
+}
+
 // AnswerCallback answers a callback query
 func (ts *TelegramService) AnswerCallback(ctx context.Context, callbackID, text string) error {
 	callback := tgbotapi.NewCallback(callbackID, text)
@@ -101,33 +254,34 @@ func (ts *TelegramService) AnswerCallbackQuery(ctx context.Context, callbackID,
 
 // EditMessage edits an existing message
 func (ts *TelegramService) EditMessage(ctx context.Context, chatID int64, messageID int, text string, keyboard interface{}) error {
-	msg := tgbotapi.NewEditMessageText(chatID, messageID, text)
-
-	if keyboard != nil {
-		inlineKeyboard := tgbotapi.NewInlineKeyboardMarkup()
-		if rows, ok := keyboard.([][]map[string]string); ok {
-			for _, row := range rows {
-				var buttons []tgbotapi.InlineKeyboardButton
-				for _, buttonData := range row {
-					callbackData := buttonData["callback_data"]
-					buttons = append(buttons, tgbotapi.InlineKeyboardButton{
-						Text:         buttonData["text"],
-						CallbackData: &callbackData,
-					})
-				}
-				inlineKeyboard.InlineKeyboard = append(inlineKeyboard.InlineKeyboard, buttons)
-			}
-			msg.ReplyMarkup = &inlineKeyboard
-		}
+	if err := ts.send(ctx, newEditMessage(chatID, messageID, text, "", keyboard)); err != nil {
+		return errors.NewTelegramAPIError("failed to edit message", err)
 	}
+	return nil
+}
 
-	_, err := ts.bot.Send(msg)
-	if err != nil {
-		return errors.NewTelegramAPIError("failed to edit message", err)
+// EditMarkdown edits an existing message with text rendered in MarkdownV2, falling back to
+// plain text like SendMarkdown. Edits leaving the message unchanged are not errors.
+func (ts *TelegramService) EditMarkdown(ctx context.Context, chatID int64, messageID int, text string, keyboard interface{}) error {
+	err := ts.send(ctx, newEditMessage(chatID, messageID, text, render.ParseMode, keyboard))
+	if isParseError(err) {
+		ts.logger.Warn("Telegram rejected markdown, editing with plain text", "error", err, "chat_id", chatID)
+		err = ts.send(ctx, newEditMessage(chatID, messageID, render.Plain(text), "", keyboard))
+	}
+	if err != nil && !strings.Contains(err.Error(), "message is not modified") {
+		return errors.NewTelegramAPIError("failed to edit markdown message", err)
 	}
 	return nil
 }
 
+// newEditMessage builds a message edit with an explicit parse mode, empty for plain text
+func newEditMessage(chatID int64, messageID int, text, parseMode string, keyboard interface{}) tgbotapi.EditMessageTextConfig {
+	msg := tgbotapi.NewEditMessageText(chatID, messageID, text)
+	msg.ParseMode = parseMode
+	msg.ReplyMarkup = inlineKeyboard(keyboard)
+	return msg
+}
+
 // SetCommands sets bot commands
 func (ts *TelegramService) SetCommands(ctx context.Context, commands []domain.BotCommand) error {
 	botCommands := make([]tgbotapi.BotCommand, len(commands))
@@ -148,6 +302,39 @@ func (ts *TelegramService) SetCommands(ctx context.Context, commands []domain.Bo
 	return nil
 }
 
+// inlineSwitchParameter is the /start parameter of the private chat opened from inline results
+const inlineSwitchParameter = "inline"
+
+// AnswerInlineQuery answers an inline query with metric cards. Results are personal,
+// since every user sees only their own servers.
+func (ts *TelegramService) AnswerInlineQuery(ctx context.Context, queryID string, answer domain.InlineAnswer) error {
+	results := make([]interface{}, 0, len(answer.Results))
+	for _, result := range answer.Results {
+		article := tgbotapi.NewInlineQueryResultArticle(result.ID, result.Title, result.Text)
+		article.Description = result.Description
+		if result.Markdown {
+			article.InputMessageContent = tgbotapi.InputTextMessageContent{Text: result.Text, ParseMode: render.ParseMode}
+		}
+		results = append(results, article)
+	}
+
+	config := tgbotapi.InlineConfig{
+		InlineQueryID: queryID,
+		Results:       results,
+		CacheTime:     int(answer.CacheTime.Seconds()),
+		IsPersonal:    true,
+	}
+	if answer.SwitchText != "" {
+		config.SwitchPMText = answer.SwitchText
+		config.SwitchPMParameter = inlineSwitchParameter
+	}
+
+	if _, err := ts.bot.Request(config); err != nil {
+		return errors.NewTelegramAPIError("failed to answer inline query", err)
+	}
+	return nil
+}
+
 // GetBot returns the underlying bot instance for advanced usage
 func (ts *TelegramService) GetBot() *tgbotapi.BotAPI {
 	return ts.bot
@@ -163,14 +350,17 @@ func (ts *TelegramService) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse,
 	return ts.bot.Request(c)
 }
 
-// Send sends a generic chattable
+// Send sends a generic chattable through the send queue
 func (ts *TelegramService) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
-	return ts.bot.Send(c)
+	return ts.sender.send(context.Background(), c)
 }
 
 // StopReceivingUpdates stops receiving updates
 func (ts *TelegramService) StopReceivingUpdates() {
-	ts.bot.StopReceivingUpdates()
+	ts.stopOnce.Do(func() {
+		close(ts.stop)
+		ts.bot.StopReceivingUpdates()
+	})
 }
 
 // CreateKeyboard creates a reply keyboard from buttons
@@ -211,11 +401,20 @@ type InlineButton struct {
 
 // Message represents a telegram message
 type Message struct {
-	MessageID int    `json:"message_id"`
-	From      User   `json:"from"`
-	Chat      Chat   `json:"chat"`
-	Text      string `json:"text"`
-	Date      int    `json:"date"`
+	MessageID int       `json:"message_id"`
+	From      User      `json:"from"`
+	Chat      Chat      `json:"chat"`
+	Text      string    `json:"text"`
+	Date      int       `json:"date"`
+	Document  *Document `json:"document,omitempty"`
+}
+
+// Document represents a file sent to the bot
+type Document struct {
+	FileID   string `json:"file_id"`
+	FileName string `json:"file_name"`
+	MimeType string `json:"mime_type,omitempty"`
+	FileSize int    `json:"file_size"`
 }
 
 // User represents a telegram user
@@ -228,7 +427,14 @@ type User struct {
 
 // Chat represents a telegram chat
 type Chat struct {
-	ID int64 `json:"id"`
+	ID    int64  `json:"id"`
+	Type  string `json:"type"` // private, group, supergroup or channel
+	Title string `json:"title,omitempty"`
+}
+
+// IsGroup reports whether the chat is a group chat
+func (c Chat) IsGroup() bool {
+	return c.Type == "group" || c.Type == "supergroup"
 }
 
 // CallbackQuery represents a telegram callback query
@@ -239,11 +445,19 @@ type CallbackQuery struct {
 	Data    string  `json:"data"`
 }
 
+// InlineQuery represents a telegram inline query, typed as @bot <query> in any chat
+type InlineQuery struct {
+	ID    string `json:"id"`
+	From  User   `json:"from"`
+	Query string `json:"query"`
+}
+
 // Update represents a telegram update
 type Update struct {
 	UpdateID      int64          `json:"update_id"`
 	Message       *Message       `json:"message,omitempty"`
 	CallbackQuery *CallbackQuery `json:"callback_query,omitempty"`
+	InlineQuery   *InlineQuery   `json:"inline_query,omitempty"`
 }
 
 // ConvertUpdate converts tgbotapi.Update to our domain Update
@@ -262,11 +476,22 @@ func ConvertUpdate(update tgbotapi.Update) *Update {
 				LastName:  update.Message.From.LastName,
 			},
 			Chat: Chat{
-				ID: update.Message.Chat.ID,
+				ID:    update.Message.Chat.ID,
+				Type:  update.Message.Chat.Type,
+				Title: update.Message.Chat.Title,
 			},
 			Text: update.Message.Text,
 			Date: update.Message.Date,
 		}
+
+		if update.Message.Document != nil {
+			result.Message.Document = &Document{
+				FileID:   update.Message.Document.FileID,
+				FileName: update.Message.Document.FileName,
+				MimeType: update.Message.Document.MimeType,
+				FileSize: update.Message.Document.FileSize,
+			}
+		}
 	}
 
 	if update.CallbackQuery != nil {
@@ -291,7 +516,9 @@ func ConvertUpdate(update tgbotapi.Update) *Update {
 					LastName:  update.CallbackQuery.Message.From.LastName,
 				},
 				Chat: Chat{
-					ID: update.CallbackQuery.Message.Chat.ID,
+					ID:    update.CallbackQuery.Message.Chat.ID,
+					Type:  update.CallbackQuery.Message.Chat.Type,
+					Title: update.CallbackQuery.Message.Chat.Title,
 				},
 				Text: update.CallbackQuery.Message.Text,
 				Date: update.CallbackQuery.Message.Date,
@@ -299,39 +526,29 @@ func ConvertUpdate(update tgbotapi.Update) *Update {
 		}
 	}
 
+	if update.InlineQuery != nil {
+		result.InlineQuery = &InlineQuery{
+			ID: update.InlineQuery.ID,
+			From: User{
+				ID:        update.InlineQuery.From.ID,
+				Username:  update.InlineQuery.From.UserName,
+				FirstName: update.InlineQuery.From.FirstName,
+				LastName:  update.InlineQuery.From.LastName,
+			},
+			Query: update.InlineQuery.Query,
+		}
+	}
+
 	return result
 }
 
 // StartReceivingUpdates starts receiving updates
 func (ts *TelegramService) StartReceivingUpdates(ctx context.Context, handler interface{}) error {
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
-
-	updates := ts.bot.GetUpdatesChan(u)
-
-	go func() {
-		for {
-			select {
-			case update, ok := <-updates:
-				if !ok {
-					return
-				}
-
-				domainUpdate := ConvertUpdate(update)
-				if h, ok := handler.(interface {
-					HandleUpdate(context.Context, *Update) error
-				}); ok {
-					if err := h.HandleUpdate(ctx, domainUpdate); err != nil {
-						ts.logger.Error("Error handling update", "error", err)
-						continue
-					}
-				}
-
-			case <-ctx.Done():
-				return
-			}
-		}
-	}()
+	ts.stats.mu.Lock()
+	ts.stats.lastSuccess = time.Now()
+	ts.stats.mu.Unlock()
+
+	go ts.poll(ctx, handler)
 
 	return nil
 }
@@ -0,0 +1,101 @@
+package telegram
+
+import (
+	"context"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// workerStats tracks the update queue for metrics
+type workerStats struct {
+	queued  atomic.Int64 // updates waiting for a worker
+	busy    atomic.Int64 // workers handling an update
+	handled atomic.Int64 // updates handled in total
+	stalls  atomic.Int64 // times polling waited for a full queue
+}
+
+// updatePool handles updates on a fixed number of workers. Updates of a chat always go to
+// the same worker, so they are handled in the order they arrived, while a slow update
+// holds up only the chats of its worker. Queues are bounded: when one is full, submit
+// blocks and polling pauses until the worker catches up.
+type updatePool struct {
+	queues []chan tgbotapi.Update
+	wg     sync.WaitGroup
+	stats  *workerStats
+}
+
+// newUpdatePool starts workers handling updates with handle
+func newUpdatePool(workers, queueSize int, stats *workerStats, handle func(tgbotapi.Update)) *updatePool {
+	if workers < 1 {
+		workers = 1
+	}
+
+	p := &updatePool{queues: make([]chan tgbotapi.Update, workers), stats: stats}
+	for i := range p.queues {
+		queue := make(chan tgbotapi.Update, queueSize)
+		p.queues[i] = queue
+
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for update := range queue {
+				stats.queued.Add(-1)
+				stats.busy.Add(1)
+				handle(update)
+				stats.busy.Add(-1)
+				stats.handled.Add(1)
+			}
+		}()
+	}
+	return p
+}
+
+// submit queues an update on the worker of its chat, waiting while the queue is full.
+// It reports false when ctx is done or stop is closed first.
+func (p *updatePool) submit(ctx context.Context, stop <-chan struct{}, update tgbotapi.Update) bool {
+	queue := p.queues[p.worker(update)]
+	p.stats.queued.Add(1)
+
+	select {
+	case queue <- update:
+		return true
+	default:
+	}
+
+	p.stats.stalls.Add(1)
+	select {
+	case queue <- update:
+		return true
+	case <-ctx.Done():
+	case <-stop:
+	}
+	p.stats.queued.Add(-1)
+	return false
+}
+
+// close stops the workers once they have handled the queued updates
+func (p *updatePool) close() {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+	p.wg.Wait()
+}
+
+// worker picks the worker of an update by its chat, or by its sender for updates without
+// a chat such as inline queries
+func (p *updatePool) worker(update tgbotapi.Update) int {
+	key := strconv.Itoa(update.UpdateID)
+	if chat := update.FromChat(); chat != nil {
+		key = strconv.FormatInt(chat.ID, 10)
+	} else if user := update.SentFrom(); user != nil {
+		key = strconv.FormatInt(user.ID, 10)
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(p.queues)))
+}
@@ -0,0 +1,99 @@
+package telegram
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// chatUpdate creates a message update of a chat
+func chatUpdate(id int, chatID int64) tgbotapi.Update {
+	return tgbotapi.Update{UpdateID: id, Message: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: chatID}}}
+}
+
+func TestUpdatePoolKeepsChatOrder(t *testing.T) {
+	var mu sync.Mutex
+	handled := make(map[int64][]int)
+	pool := newUpdatePool(4, 2, &workerStats{}, func(update tgbotapi.Update) {
+		if update.UpdateID%3 == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		chatID := update.FromChat().ID
+		handled[chatID] = append(handled[chatID], update.UpdateID)
+	})
+
+	chats := []int64{101, 202, -303, 404, 505, -606}
+	for id := 0; id < 120; id++ {
+		if !pool.submit(context.Background(), nil, chatUpdate(id, chats[id%len(chats)])) {
+			t.Fatalf("submit of update %d failed", id)
+		}
+	}
+	pool.close()
+
+	for i, chatID := range chats {
+		ids := handled[chatID]
+		if len(ids) != 20 {
+			t.Fatalf("chat %d: %d updates handled, want 20", chatID, len(ids))
+		}
+		for n, id := range ids {
+			if want := i + n*len(chats); id != want {
+				t.Fatalf("chat %d: handled %v, want its updates in order", chatID, ids)
+			}
+		}
+	}
+}
+
+func TestUpdatePoolSlowChat(t *testing.T) {
+	started, release := make(chan struct{}, 8), make(chan struct{})
+	done := make(chan int64, 8)
+	stats := &workerStats{}
+	pool := newUpdatePool(2, 1, stats, func(update tgbotapi.Update) {
+		if update.FromChat().ID == 1 {
+			started <- struct{}{}
+			<-release
+		}
+		done <- update.FromChat().ID
+	})
+
+	// Find a chat handled by another worker than chat 1
+	other := int64(2)
+	for pool.worker(chatUpdate(0, other)) == pool.worker(chatUpdate(0, 1)) {
+		other++
+	}
+
+	ctx := context.Background()
+	pool.submit(ctx, nil, chatUpdate(1, 1))
+	pool.submit(ctx, nil, chatUpdate(2, other))
+	select {
+	case chatID := <-done:
+		if chatID != other {
+			t.Fatalf("handled chat %d first, want %d", chatID, other)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a slow chat held up a chat of another worker")
+	}
+
+	// The worker of the slow chat holds one update and queues one more, then
+	// submit waits until it is stopped
+	<-started
+	pool.submit(ctx, nil, chatUpdate(3, 1))
+	stop := make(chan struct{})
+	close(stop)
+	if pool.submit(ctx, stop, chatUpdate(4, 1)) {
+		t.Error("submit to a full queue succeeded after stop")
+	}
+	if stats.stalls.Load() != 1 || stats.queued.Load() != 1 {
+		t.Errorf("%d stalls with %d updates queued, want 1 and 1", stats.stalls.Load(), stats.queued.Load())
+	}
+
+	close(release)
+	pool.close()
+	if handled := stats.handled.Load(); handled != 3 {
+		t.Errorf("%d updates handled, want 3", handled)
+	}
+}
@@ -0,0 +1,72 @@
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/servereye/servereyebot/pkg/docker"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+var _ docker.Agent = (*Agent)(nil)
+
+// AgentHandler answers a command sent to a fake agent
+type AgentHandler func(serverKey string, msg *protocol.Message) (*protocol.Message, error)
+
+// AgentCall is a command received by a fake agent
+type AgentCall struct {
+	ServerKey string
+	Message   *protocol.Message
+}
+
+// Agent is a fake docker.Agent answering commands with handlers registered per message type
+type Agent struct {
+	Faults
+
+	mu       sync.Mutex
+	handlers map[protocol.MessageType]AgentHandler
+	received []AgentCall
+}
+
+// NewAgent creates a fake agent without handlers
+func NewAgent() *Agent {
+	return &Agent{handlers: make(map[protocol.MessageType]AgentHandler)}
+}
+
+// Handle registers the handler of commands of a message type
+func (a *Agent) Handle(msgType protocol.MessageType, handler AgentHandler) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.handlers[msgType] = handler
+}
+
+// Reply registers a handler answering commands of a message type with a fixed payload
+func (a *Agent) Reply(msgType, replyType protocol.MessageType, payload interface{}) {
+	a.Handle(msgType, func(serverKey string, msg *protocol.Message) (*protocol.Message, error) {
+		return protocol.NewReply(msg, replyType, payload), nil
+	})
+}
+
+// Received returns the commands received so far
+func (a *Agent) Received() []AgentCall {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]AgentCall(nil), a.received...)
+}
+
+// SendCommand records a command and answers it with the handler of its type
+func (a *Agent) SendCommand(ctx context.Context, serverKey string, msg *protocol.Message) (*protocol.Message, error) {
+	a.mu.Lock()
+	a.received = append(a.received, AgentCall{ServerKey: serverKey, Message: msg})
+	handler, ok := a.handlers[msg.Type]
+	a.mu.Unlock()
+
+	if err := a.inject(ctx, "SendCommand"); err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("fake agent has no handler for %s", msg.Type)
+	}
+	return handler(serverKey, msg)
+}
@@ -0,0 +1,345 @@
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/storage"
+	"github.com/servereye/servereyebot/pkg/domain"
+)
+
+var _ storage.Database = (*Database)(nil)
+
+// Database is an in-memory storage.Database. It returns the same errors as the SQL
+// implementations for missing rows.
+type Database struct {
+	Faults
+
+	mu          sync.Mutex
+	users       map[int]*domain.User
+	servers     map[int]*domain.Server
+	userServers []*domain.UserServer
+	nextID      int
+	closed      bool
+}
+
+// NewDatabase creates an empty fake database
+func NewDatabase() *Database {
+	return &Database{
+		users:   make(map[int]*domain.User),
+		servers: make(map[int]*domain.Server),
+	}
+}
+
+// Closed reports whether Close was called
+func (d *Database) Closed() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.closed
+}
+
+// CreateUser stores a user and assigns its ID
+func (d *Database) CreateUser(ctx context.Context, user *domain.User) error {
+	if err := d.inject(ctx, "CreateUser"); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, existing := range d.users {
+		if existing.TelegramID == user.TelegramID {
+			return fmt.Errorf("failed to create user: duplicate telegram_id %d", user.TelegramID)
+		}
+	}
+
+	d.nextID++
+	user.ID = d.nextID
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now()
+	}
+	stored := *user
+	d.users[user.ID] = &stored
+	return nil
+}
+
+// GetUserByTelegramID returns a copy of the user with a Telegram ID
+func (d *Database) GetUserByTelegramID(ctx context.Context, telegramID int64) (*domain.User, error) {
+	if err := d.inject(ctx, "GetUserByTelegramID"); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if user := d.userByTelegramID(telegramID); user != nil {
+		found := *user
+		return &found, nil
+	}
+	return nil, fmt.Errorf("user not found")
+}
+
+// UpdateUser replaces a stored user
+func (d *Database) UpdateUser(ctx context.Context, user *domain.User) error {
+	if err := d.inject(ctx, "UpdateUser"); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.users[user.ID]; !ok {
+		return fmt.Errorf("user not found")
+	}
+	stored := *user
+	d.users[user.ID] = &stored
+	return nil
+}
+
+// DeleteUser removes a user and its server links
+func (d *Database) DeleteUser(ctx context.Context, id int) error {
+	if err := d.inject(ctx, "DeleteUser"); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.users, id)
+	d.removeUserServers(func(us *domain.UserServer) bool { return us.UserID == id })
+	return nil
+}
+
+// CreateServer stores a server and assigns its ID
+func (d *Database) CreateServer(ctx context.Context, server *domain.Server) error {
+	if err := d.inject(ctx, "CreateServer"); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, existing := range d.servers {
+		if existing.ServerID == server.ServerID {
+			return fmt.Errorf("failed to create server: duplicate server_id %s", server.ServerID)
+		}
+	}
+
+	d.nextID++
+	server.ID = d.nextID
+	now := time.Now()
+	if server.CreatedAt.IsZero() {
+		server.CreatedAt = now
+	}
+	server.UpdatedAt = now
+	stored := *server
+	d.servers[server.ID] = &stored
+	return nil
+}
+
+// GetServerByID returns a copy of the server with an ID
+func (d *Database) GetServerByID(ctx context.Context, id int) (*domain.Server, error) {
+	if err := d.inject(ctx, "GetServerByID"); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if server, ok := d.servers[id]; ok {
+		found := *server
+		return &found, nil
+	}
+	return nil, fmt.Errorf("server not found")
+}
+
+// GetServerByServerID returns a copy of the server with a server ID such as srv_12313
+func (d *Database) GetServerByServerID(ctx context.Context, serverID string) (*domain.Server, error) {
+	if err := d.inject(ctx, "GetServerByServerID"); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, server := range d.servers {
+		if server.ServerID == serverID {
+			found := *server
+			return &found, nil
+		}
+	}
+	return nil, fmt.Errorf("server not found")
+}
+
+// UpdateServer replaces a stored server
+func (d *Database) UpdateServer(ctx context.Context, server *domain.Server) error {
+	if err := d.inject(ctx, "UpdateServer"); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.servers[server.ID]; !ok {
+		return fmt.Errorf("server not found")
+	}
+	server.UpdatedAt = time.Now()
+	stored := *server
+	d.servers[server.ID] = &stored
+	return nil
+}
+
+// DeleteServer removes a server and its user links
+func (d *Database) DeleteServer(ctx context.Context, id int) error {
+	if err := d.inject(ctx, "DeleteServer"); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.servers, id)
+	d.removeUserServers(func(us *domain.UserServer) bool { return us.ServerID == strconv.Itoa(id) })
+	return nil
+}
+
+// ListServersByUserID lists active servers of a user. Like the SQL implementations,
+// it matches userID against the Telegram ID of the user.
+func (d *Database) ListServersByUserID(ctx context.Context, userID int) ([]*domain.Server, error) {
+	if err := d.inject(ctx, "ListServersByUserID"); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	user := d.userByTelegramID(int64(userID))
+	if user == nil {
+		return nil, nil
+	}
+
+	var servers []*domain.Server
+	for _, us := range d.userServers {
+		if us.UserID != user.ID {
+			continue
+		}
+		id, err := strconv.Atoi(us.ServerID)
+		if err != nil {
+			continue
+		}
+		if server, ok := d.servers[id]; ok && server.IsActive {
+			found := *server
+			servers = append(servers, &found)
+		}
+	}
+	return servers, nil
+}
+
+// CreateUserServer links a user to a server
+func (d *Database) CreateUserServer(ctx context.Context, userServer *domain.UserServer) error {
+	if err := d.inject(ctx, "CreateUserServer"); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.nextID++
+	userServer.ID = d.nextID
+	if userServer.CreatedAt.IsZero() {
+		userServer.CreatedAt = time.Now()
+	}
+	stored := *userServer
+	d.userServers = append(d.userServers, &stored)
+	return nil
+}
+
+// DeleteUserServer unlinks a user from a server
+func (d *Database) DeleteUserServer(ctx context.Context, userID, serverID int) error {
+	if err := d.inject(ctx, "DeleteUserServer"); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.removeUserServers(func(us *domain.UserServer) bool {
+		return us.UserID == userID && us.ServerID == strconv.Itoa(serverID)
+	})
+	return nil
+}
+
+// GetUserRole returns the role of a user on a server
+func (d *Database) GetUserRole(ctx context.Context, userID, serverID int) (string, error) {
+	if err := d.inject(ctx, "GetUserRole"); err != nil {
+		return "", err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, us := range d.userServers {
+		if us.UserID == userID && us.ServerID == strconv.Itoa(serverID) {
+			return us.Role, nil
+		}
+	}
+	return "", fmt.Errorf("user-server relationship not found")
+}
+
+// ListUsersByServerID lists users linked to a server
+func (d *Database) ListUsersByServerID(ctx context.Context, serverID int) ([]*domain.User, error) {
+	if err := d.inject(ctx, "ListUsersByServerID"); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var users []*domain.User
+	for _, us := range d.userServers {
+		if us.ServerID != strconv.Itoa(serverID) {
+			continue
+		}
+		if user, ok := d.users[us.UserID]; ok {
+			found := *user
+			users = append(users, &found)
+		}
+	}
+	return users, nil
+}
+
+// Close marks the database closed
+func (d *Database) Close() error {
+	if err := d.inject(context.Background(), "Close"); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closed = true
+	return nil
+}
+
+// userByTelegramID finds a stored user, the caller holds d.mu
+func (d *Database) userByTelegramID(telegramID int64) *domain.User {
+	for _, user := range d.users {
+		if user.TelegramID == telegramID {
+			return user
+		}
+	}
+	return nil
+}
+
+// removeUserServers drops the links matching remove, the caller holds d.mu
+func (d *Database) removeUserServers(remove func(us *domain.UserServer) bool) {
+	kept := d.userServers[:0]
+	for _, us := range d.userServers {
+		if !remove(us) {
+			kept = append(kept, us)
+		}
+	}
+	d.userServers = kept
+}
@@ -0,0 +1,94 @@
+// Package testutil provides in-memory fakes of the bot's dependencies for handler and
+// service tests. Every fake embeds Faults, so tests can make calls fail or slow down
+// without writing mocks.
+package testutil
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Faults injects errors and latency into the calls of a fake
+type Faults struct {
+	mu      sync.Mutex
+	err     error            // returned by every call
+	errs    map[string]error // returned by calls of a method, takes precedence over err
+	latency time.Duration
+	calls   map[string]int
+}
+
+// FailAll makes every call fail with err until it is cleared with nil
+func (f *Faults) FailAll(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+// Fail makes calls of method fail with err until it is cleared with nil
+func (f *Faults) Fail(method string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.errs == nil {
+		f.errs = make(map[string]error)
+	}
+	if err == nil {
+		delete(f.errs, method)
+		return
+	}
+	f.errs[method] = err
+}
+
+// Delay makes every call take at least latency, or until its context is done
+func (f *Faults) Delay(latency time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.latency = latency
+}
+
+// Calls returns how many times method was called
+func (f *Faults) Calls(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[method]
+}
+
+// Reset clears injected faults and call counts
+func (f *Faults) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.err = nil
+	f.errs = nil
+	f.latency = 0
+	f.calls = nil
+}
+
+// inject counts a call of method and applies the configured latency and error
+func (f *Faults) inject(ctx context.Context, method string) error {
+	f.mu.Lock()
+	if f.calls == nil {
+		f.calls = make(map[string]int)
+	}
+	f.calls[method]++
+	latency := f.latency
+	err := f.err
+	if methodErr, ok := f.errs[method]; ok {
+		err = methodErr
+	}
+	f.mu.Unlock()
+
+	if latency > 0 {
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		select {
+		case <-time.After(latency):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,71 @@
+package testutil
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/ratelimit"
+)
+
+var _ ratelimit.Store = (*RateLimitStore)(nil)
+
+// RateLimitStore is a fake of the Redis rate limit store with a controllable clock,
+// so that tests can move past windows without sleeping
+type RateLimitStore struct {
+	Faults
+
+	mu      sync.Mutex
+	now     time.Time
+	windows map[string]rateLimitWindow
+}
+
+// rateLimitWindow is the counter of one key
+type rateLimitWindow struct {
+	count   int64
+	resetAt time.Time
+}
+
+// NewRateLimitStore creates an empty store with its clock at now
+func NewRateLimitStore(now time.Time) *RateLimitStore {
+	return &RateLimitStore{
+		now:     now,
+		windows: make(map[string]rateLimitWindow),
+	}
+}
+
+// Advance moves the clock of the store forward
+func (s *RateLimitStore) Advance(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = s.now.Add(d)
+}
+
+// Increment counts an event of key in its current window
+func (s *RateLimitStore) Increment(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error) {
+	if err := s.inject(ctx, "Increment"); err != nil {
+		return 0, 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w, ok := s.windows[key]
+	if !ok || !s.now.Before(w.resetAt) {
+		w = rateLimitWindow{resetAt: s.now.Add(window)}
+	}
+	w.count++
+	s.windows[key] = w
+
+	return w.count, w.resetAt.Sub(s.now), nil
+}
+
+// Ping fails only when a fault is injected
+func (s *RateLimitStore) Ping(ctx context.Context) error {
+	return s.inject(ctx, "Ping")
+}
+
+// Close fails only when a fault is injected
+func (s *RateLimitStore) Close() error {
+	return s.inject(context.Background(), "Close")
+}
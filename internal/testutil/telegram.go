@@ -0,0 +1,198 @@
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/servereye/servereyebot/pkg/domain"
+)
+
+var _ domain.TelegramService = (*Telegram)(nil)
+
+// SentMessage is a message sent through a fake Telegram service
+type SentMessage struct {
+	ChatID    int64
+	MessageID int // set for edits
+	Text      string
+	Keyboard  interface{}
+}
+
+// Telegram is a fake domain.TelegramService recording the messages the bot sends
+type Telegram struct {
+	Faults
+
+	mu       sync.Mutex
+	sent     []SentMessage
+	nextID   int
+	files    map[string][]byte
+	commands []domain.BotCommand
+}
+
+// NewTelegram creates a fake Telegram service without sent messages
+func NewTelegram() *Telegram {
+	return &Telegram{files: make(map[string][]byte)}
+}
+
+// Sent returns the messages sent and edited so far
+func (t *Telegram) Sent() []SentMessage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]SentMessage(nil), t.sent...)
+}
+
+// SentTo returns the texts of the messages sent and edited in a chat so far
+func (t *Telegram) SentTo(chatID int64) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var texts []string
+	for _, msg := range t.sent {
+		if msg.ChatID == chatID {
+			texts = append(texts, msg.Text)
+		}
+	}
+	return texts
+}
+
+// AddFile makes a file downloadable by its ID
+func (t *Telegram) AddFile(fileID string, data []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.files[fileID] = data
+}
+
+// Commands returns the commands set last
+func (t *Telegram) Commands() []domain.BotCommand {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]domain.BotCommand(nil), t.commands...)
+}
+
+// SendMessage records a plain message
+func (t *Telegram) SendMessage(ctx context.Context, chatID int64, text string) error {
+	_, err := t.record(ctx, "SendMessage", SentMessage{ChatID: chatID, Text: text})
+	return err
+}
+
+// SendSilentMessage records a message sent without notification
+func (t *Telegram) SendSilentMessage(ctx context.Context, chatID int64, text string, keyboard interface{}) error {
+	_, err := t.record(ctx, "SendSilentMessage", SentMessage{ChatID: chatID, Text: text, Keyboard: keyboard})
+	return err
+}
+
+// SendMessageWithKeyboard records a message with a keyboard
+func (t *Telegram) SendMessageWithKeyboard(ctx context.Context, chatID int64, text string, keyboard interface{}) error {
+	_, err := t.record(ctx, "SendMessageWithKeyboard", SentMessage{ChatID: chatID, Text: text, Keyboard: keyboard})
+	return err
+}
+
+// SendMarkdown records a MarkdownV2 message
+func (t *Telegram) SendMarkdown(ctx context.Context, chatID int64, text string, keyboard interface{}) error {
+	_, err := t.record(ctx, "SendMarkdown", SentMessage{ChatID: chatID, Text: text, Keyboard: keyboard})
+	return err
+}
+
+// SendMarkdownMessage records a MarkdownV2 message and returns its ID
+func (t *Telegram) SendMarkdownMessage(ctx context.Context, chatID int64, text string, keyboard interface{}) (int, error) {
+	return t.record(ctx, "SendMarkdownMessage", SentMessage{ChatID: chatID, Text: text, Keyboard: keyboard})
+}
+
+// SendCode records a code block
+func (t *Telegram) SendCode(ctx context.Context, chatID int64, code, language string) error {
+	_, err := t.record(ctx, "SendCode", SentMessage{ChatID: chatID, Text: code})
+	return err
+}
+
+// SendDocument records a document by its caption
+func (t *Telegram) SendDocument(ctx context.Context, chatID int64, fileName string, data []byte, caption string) error {
+	_, err := t.record(ctx, "SendDocument", SentMessage{ChatID: chatID, Text: caption})
+	return err
+}
+
+// DownloadFile returns a file added with AddFile
+func (t *Telegram) DownloadFile(ctx context.Context, fileID string, maxSize int64) ([]byte, error) {
+	if err := t.inject(ctx, "DownloadFile"); err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	data, ok := t.files[fileID]
+	if !ok {
+		return nil, fmt.Errorf("file %s not found", fileID)
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("file %s is larger than %d bytes", fileID, maxSize)
+	}
+	return data, nil
+}
+
+// StartReceivingUpdates returns when ctx is done, the fake never receives updates
+func (t *Telegram) StartReceivingUpdates(ctx context.Context, handler interface{}) error {
+	if err := t.inject(ctx, "StartReceivingUpdates"); err != nil {
+		return err
+	}
+	<-ctx.Done()
+	return nil
+}
+
+// StopReceivingUpdates does nothing
+func (t *Telegram) StopReceivingUpdates() {}
+
+// AnswerCallback counts the answer of a callback query
+func (t *Telegram) AnswerCallback(ctx context.Context, callbackID, text string) error {
+	return t.inject(ctx, "AnswerCallback")
+}
+
+// AnswerCallbackQuery counts the answer of a callback query
+func (t *Telegram) AnswerCallbackQuery(ctx context.Context, callbackID, text string) error {
+	return t.inject(ctx, "AnswerCallbackQuery")
+}
+
+// EditMessage records an edit of a plain message
+func (t *Telegram) EditMessage(ctx context.Context, chatID int64, messageID int, text string, keyboard interface{}) error {
+	_, err := t.record(ctx, "EditMessage", SentMessage{ChatID: chatID, MessageID: messageID, Text: text, Keyboard: keyboard})
+	return err
+}
+
+// EditMarkdown records an edit of a MarkdownV2 message
+func (t *Telegram) EditMarkdown(ctx context.Context, chatID int64, messageID int, text string, keyboard interface{}) error {
+	_, err := t.record(ctx, "EditMarkdown", SentMessage{ChatID: chatID, MessageID: messageID, Text: text, Keyboard: keyboard})
+	return err
+}
+
+// SetCommands stores the commands
+func (t *Telegram) SetCommands(ctx context.Context, commands []domain.BotCommand) error {
+	if err := t.inject(ctx, "SetCommands"); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.commands = append([]domain.BotCommand(nil), commands...)
+	return nil
+}
+
+// AnswerInlineQuery counts the answer of an inline query
+func (t *Telegram) AnswerInlineQuery(ctx context.Context, queryID string, answer domain.InlineAnswer) error {
+	return t.inject(ctx, "AnswerInlineQuery")
+}
+
+// record stores a sent message and assigns its ID unless the call fails
+func (t *Telegram) record(ctx context.Context, method string, msg SentMessage) (int, error) {
+	if err := t.inject(ctx, method); err != nil {
+		return 0, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if msg.MessageID == 0 {
+		t.nextID++
+		msg.MessageID = t.nextID
+	}
+	t.sent = append(t.sent, msg)
+	return msg.MessageID, nil
+}
@@ -0,0 +1,79 @@
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/servereye/servereyebot/pkg/domain"
+)
+
+var _ domain.UserService = (*Users)(nil)
+
+// Users is a fake domain.UserService keeping registered users in memory
+type Users struct {
+	Faults
+
+	mu     sync.Mutex
+	users  map[int64]*domain.User
+	admins map[int64]bool
+}
+
+// NewUsers creates a fake user service with the given admins
+func NewUsers(admins ...int64) *Users {
+	u := &Users{
+		users:  make(map[int64]*domain.User),
+		admins: make(map[int64]bool),
+	}
+	for _, id := range admins {
+		u.admins[id] = true
+	}
+	return u
+}
+
+// IsAdmin reports whether the user was given as an admin
+func (u *Users) IsAdmin(userID int64) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.admins[userID]
+}
+
+// IsAuthorized reports whether the user is registered
+func (u *Users) IsAuthorized(userID int64) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	_, ok := u.users[userID]
+	return ok
+}
+
+// RegisterUser stores a copy of the user by its Telegram ID
+func (u *Users) RegisterUser(ctx context.Context, user *domain.User) error {
+	if err := u.inject(ctx, "RegisterUser"); err != nil {
+		return err
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	stored := *user
+	stored.IsAdmin = u.admins[user.TelegramID]
+	u.users[user.TelegramID] = &stored
+	return nil
+}
+
+// GetUser returns a copy of a registered user
+func (u *Users) GetUser(ctx context.Context, userID int64) (*domain.User, error) {
+	if err := u.inject(ctx, "GetUser"); err != nil {
+		return nil, err
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	user, ok := u.users[userID]
+	if !ok {
+		return nil, fmt.Errorf("user not found")
+	}
+	found := *user
+	return &found, nil
+}
@@ -0,0 +1,310 @@
+// Package tracing records spans of API requests, command dispatch and agent commands and
+// exports them to an OpenTelemetry collector over OTLP/HTTP with JSON encoding. Trace
+// context is taken from and passed on in W3C traceparent headers and command messages,
+// so that spans join the traces of the agents.
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Span kinds of the OTLP protocol
+const (
+	KindInternal = 1
+	KindServer   = 2
+	KindClient   = 3
+)
+
+// maxQueuedSpans bounds the spans waiting for export while the collector is unreachable
+const maxQueuedSpans = 2048
+
+// traceparentPattern matches a W3C traceparent header of version 00
+var traceparentPattern = regexp.MustCompile(`^00-([0-9a-f]{32})-([0-9a-f]{16})-[0-9a-f]{2}$`)
+
+// spanContextKey is the context key of the current span
+type spanContextKey struct{}
+
+// Logger interface for span export
+type Logger interface {
+	Debug(msg string, fields ...interface{})
+	Info(msg string, fields ...interface{})
+	Warn(msg string, fields ...interface{})
+	Error(msg string, fields ...interface{})
+}
+
+// Tracer creates spans and exports them in batches. A nil Tracer creates nil spans,
+// which record nothing.
+type Tracer struct {
+	endpoint string
+	service  string
+	interval time.Duration
+	client   *http.Client
+	logger   Logger
+
+	mu      sync.Mutex
+	queue   []*Span
+	dropped int
+}
+
+// NewTracer creates a tracer exporting to the OTLP/HTTP endpoint of a collector, such
+// as http://otel-collector:4318, every interval
+func NewTracer(endpoint, service string, interval, timeout time.Duration, logger Logger) *Tracer {
+	return &Tracer{
+		endpoint: strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		service:  service,
+		interval: interval,
+		client:   &http.Client{Timeout: timeout},
+		logger:   logger,
+	}
+}
+
+// Span is an operation of a trace. Its methods are safe to call on a nil Span.
+type Span struct {
+	tracer     *Tracer
+	traceID    string
+	spanID     string
+	parentID   string
+	name       string
+	kind       int
+	start      time.Time
+	end        time.Time
+	attributes map[string]interface{}
+	failed     bool
+}
+
+// Start begins a span, continuing the trace of a traceparent header when it is valid
+func (t *Tracer) Start(name string, kind int, traceparent string) *Span {
+	if t == nil {
+		return nil
+	}
+
+	span := &Span{
+		tracer:     t,
+		spanID:     randomHex(8),
+		name:       name,
+		kind:       kind,
+		start:      time.Now(),
+		attributes: make(map[string]interface{}),
+	}
+	if m := traceparentPattern.FindStringSubmatch(traceparent); m != nil && strings.Trim(m[1], "0") != "" {
+		span.traceID, span.parentID = m[1], m[2]
+	} else {
+		span.traceID = randomHex(16)
+	}
+	return span
+}
+
+// StartChild begins a span in the trace of the span of ctx and returns a context holding it
+func (t *Tracer) StartChild(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	span := t.Start(name, kind, SpanFromContext(ctx).Traceparent())
+	return ContextWithSpan(ctx, span), span
+}
+
+// ContextWithSpan returns a context holding span as the current span
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	if span == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanContextKey{}, span)
+}
+
+// SpanFromContext returns the current span of ctx, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
+
+// SetAttribute records a string, integer or boolean attribute of the span
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.attributes[key] = value
+}
+
+// SetFailed marks the span as failed
+func (s *Span) SetFailed() {
+	if s == nil {
+		return
+	}
+	s.failed = true
+}
+
+// TraceID returns the hex ID of the span's trace, or "" for a nil span
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return s.traceID
+}
+
+// Traceparent returns the W3C traceparent header passing the span on to a callee
+func (s *Span) Traceparent() string {
+	if s == nil {
+		return ""
+	}
+	return "00-" + s.traceID + "-" + s.spanID + "-01"
+}
+
+// End finishes the span and queues it for export
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.end = time.Now()
+
+	t := s.tracer
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.queue) >= maxQueuedSpans {
+		t.dropped++
+		return
+	}
+	t.queue = append(t.queue, s)
+}
+
+// Run exports queued spans every interval until ctx is done
+func (t *Tracer) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := t.Flush(ctx); err != nil {
+				t.logger.Warn("Failed to export spans", "error", err, "endpoint", t.endpoint)
+			}
+		}
+	}
+}
+
+// Flush exports the queued spans. Spans of a failed export are dropped.
+func (t *Tracer) Flush(ctx context.Context) error {
+	t.mu.Lock()
+	spans, dropped := t.queue, t.dropped
+	t.queue, t.dropped = nil, 0
+	t.mu.Unlock()
+
+	if dropped > 0 {
+		t.logger.Warn("Dropped spans over the export queue limit", "count", dropped)
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(t.encode(spans))
+	if err != nil {
+		return fmt.Errorf("failed to encode spans: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create export request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to export %d spans: %w", len(spans), err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector rejected %d spans with status %d", len(spans), resp.StatusCode)
+	}
+	t.logger.Debug("Exported spans", "count", len(spans))
+	return nil
+}
+
+// otlpAttribute is a key-value pair of the OTLP JSON encoding
+type otlpAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+// otlpSpan is a span of the OTLP JSON encoding
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            struct {
+		Code int `json:"code"` // 0 unset, 2 error
+	} `json:"status"`
+}
+
+// encode builds the ExportTraceServiceRequest of a batch of spans
+func (t *Tracer) encode(spans []*Span) map[string]interface{} {
+	encoded := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceID:           s.traceID,
+			SpanID:            s.spanID,
+			ParentSpanID:      s.parentID,
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		}
+		for key, value := range s.attributes {
+			span.Attributes = append(span.Attributes, attribute(key, value))
+		}
+		if s.failed {
+			span.Status.Code = 2
+		}
+		encoded = append(encoded, span)
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": []otlpAttribute{attribute("service.name", t.service)},
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": "servereyebot"},
+				"spans": encoded,
+			}},
+		}},
+	}
+}
+
+// attribute encodes an attribute value by its type
+func attribute(key string, value interface{}) otlpAttribute {
+	switch v := value.(type) {
+	case int:
+		return otlpAttribute{Key: key, Value: map[string]interface{}{"intValue": strconv.Itoa(v)}}
+	case int64:
+		return otlpAttribute{Key: key, Value: map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}}
+	case bool:
+		return otlpAttribute{Key: key, Value: map[string]interface{}{"boolValue": v}}
+	default:
+		return otlpAttribute{Key: key, Value: map[string]interface{}{"stringValue": fmt.Sprint(v)}}
+	}
+}
+
+// randomHex returns n random bytes in hex
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,205 @@
+// Package uptime probes HTTP and TCP endpoints for uptime checks.
+package uptime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Kinds of uptime checks
+const (
+	KindHTTP = "http" // GET of an http:// or https:// URL, up on a status below 400
+	KindTCP  = "tcp"  // connection to tcp://host:port
+)
+
+// maxTargetLength bounds the target of a check
+const maxTargetLength = 2048
+
+// ErrPrivateAddress is returned for targets resolving to loopback, private or link-local
+// addresses when probing from the bot, which must not reach its own network
+var ErrPrivateAddress = errors.New("address is not public")
+
+// Target represents a validated endpoint of an uptime check
+type Target struct {
+	Kind    string
+	Address string // URL of HTTP checks, host:port of TCP checks
+}
+
+// Result represents the outcome of a probe
+type Result struct {
+	Up         bool
+	Latency    time.Duration
+	StatusCode int    // HTTP status, 0 for TCP checks
+	Error      string // why the endpoint is down
+}
+
+// ParseTarget parses an http://, https:// or tcp:// endpoint. A bare host:port is a TCP check.
+func ParseTarget(raw string) (Target, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || len(raw) > maxTargetLength {
+		return Target{}, fmt.Errorf("target must be 1 to %d characters", maxTargetLength)
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "tcp://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return Target{}, fmt.Errorf("invalid target: %w", err)
+	}
+	if u.Hostname() == "" || u.User != nil {
+		return Target{}, fmt.Errorf("target must have a host and no credentials")
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		u.Scheme = strings.ToLower(u.Scheme)
+		u.Fragment = ""
+		return Target{Kind: KindHTTP, Address: u.String()}, nil
+	case "tcp":
+		port, err := strconv.Atoi(u.Port())
+		if err != nil || port < 1 || port > 65535 || (u.Path != "" && u.Path != "/") {
+			return Target{}, fmt.Errorf("TCP target must be tcp://host:port")
+		}
+		return Target{Kind: KindTCP, Address: net.JoinHostPort(u.Hostname(), u.Port())}, nil
+	default:
+		return Target{}, fmt.Errorf("unsupported scheme '%s', expected http, https or tcp", u.Scheme)
+	}
+}
+
+// String returns the target as users enter it
+func (t Target) String() string {
+	if t.Kind == KindTCP {
+		return "tcp://" + t.Address
+	}
+	return t.Address
+}
+
+// Prober probes endpoints from the host it runs on
+type Prober struct {
+	dialer *net.Dialer
+	client *http.Client
+}
+
+// NewProber creates a prober. Unless allowPrivate is set, connections to loopback,
+// private and link-local addresses are refused, including after redirects and DNS changes.
+func NewProber(allowPrivate bool) *Prober {
+	dialer := &net.Dialer{}
+	if !allowPrivate {
+		dialer.Control = refusePrivate
+	}
+
+	transport := &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+		DisableKeepAlives:   true,
+	}
+
+	return &Prober{
+		dialer: dialer,
+		client: &http.Client{
+			Transport: transport,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= 5 {
+					return errors.New("too many redirects")
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// Probe checks an endpoint once, bounded by timeout
+func (p *Prober) Probe(ctx context.Context, target Target, timeout time.Duration) Result {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	switch target.Kind {
+	case KindTCP:
+		conn, err := p.dialer.DialContext(ctx, "tcp", target.Address)
+		if err != nil {
+			return Result{Latency: time.Since(start), Error: describe(err)}
+		}
+		_ = conn.Close()
+		return Result{Up: true, Latency: time.Since(start)}
+
+	case KindHTTP:
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.Address, nil)
+		if err != nil {
+			return Result{Error: err.Error()}
+		}
+		req.Header.Set("User-Agent", "ServerEye-Uptime/1.0")
+
+		resp, err := p.client.Do(req)
+		if err != nil {
+			return Result{Latency: time.Since(start), Error: describe(err)}
+		}
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		_ = resp.Body.Close()
+
+		result := Result{Up: resp.StatusCode < 400, Latency: time.Since(start), StatusCode: resp.StatusCode}
+		if !result.Up {
+			result.Error = resp.Status
+		}
+		return result
+
+	default:
+		return Result{Error: fmt.Sprintf("unknown check kind '%s'", target.Kind)}
+	}
+}
+
+// describe shortens probe errors for users
+func describe(err error) string {
+	switch {
+	case errors.Is(err, ErrPrivateAddress):
+		return ErrPrivateAddress.Error()
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return "DNS: " + dnsErr.Err
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Err != nil {
+		return opErr.Err.Error()
+	}
+	return err.Error()
+}
+
+// refusePrivate is a dialer control refusing non-public addresses
+func refusePrivate(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !IsPublic(ip) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+// IsPublic reports whether an address is routable on the internet
+func IsPublic(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast() || ip.IsInterfaceLocalMulticast() ||
+		isCGNAT(ip))
+}
+
+// isCGNAT reports whether an address is in the shared address space 100.64.0.0/10
+func isCGNAT(ip net.IP) bool {
+	ip4 := ip.To4()
+	return ip4 != nil && ip4[0] == 100 && ip4[1]&0xc0 == 64
+}
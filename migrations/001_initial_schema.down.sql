@@ -0,0 +1,8 @@
+-- Migration: Initial schema (down)
+-- Created: 2026-10-16
+-- Description: Reverts 001_initial_schema
+
+DROP TABLE IF EXISTS user_servers;
+DROP TABLE IF EXISTS servers;
+DROP TABLE IF EXISTS users;
+DROP FUNCTION IF EXISTS update_updated_at_column();
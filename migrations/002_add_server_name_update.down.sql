@@ -0,0 +1,7 @@
+-- Migration: Add server name update functionality (down)
+-- Created: 2026-10-16
+-- Description: Reverts 002_add_server_name_update
+
+DROP FUNCTION IF EXISTS get_user_server(INTEGER, VARCHAR);
+DROP FUNCTION IF EXISTS update_server_name(INTEGER, VARCHAR, VARCHAR);
+ALTER TABLE user_servers DROP CONSTRAINT IF EXISTS fk_user_servers_server_id;
@@ -0,0 +1,6 @@
+-- Migration: Scheduled server summary reports (down)
+-- Created: 2026-10-16
+-- Description: Reverts 003_report_schedules
+
+DROP TABLE IF EXISTS report_schedules;
+ALTER TABLE users DROP COLUMN IF EXISTS timezone;
@@ -0,0 +1,24 @@
+-- Migration: Scheduled server summary reports
+-- Created: 2026-10-15
+-- Description: Per-user timezone and daily/weekly report schedules
+
+-- Store user timezone for schedule evaluation
+ALTER TABLE users ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) DEFAULT 'UTC';
+
+-- Report schedules table (one schedule per user)
+CREATE TABLE IF NOT EXISTS report_schedules (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER UNIQUE NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    frequency VARCHAR(16) NOT NULL, -- daily, weekly
+    weekday INTEGER DEFAULT 1, -- 0 = Sunday, used for weekly reports
+    hour INTEGER NOT NULL,
+    minute INTEGER NOT NULL,
+    last_sent_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_report_schedules_user_id ON report_schedules(user_id);
+
+CREATE TRIGGER update_report_schedules_updated_at BEFORE UPDATE ON report_schedules
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
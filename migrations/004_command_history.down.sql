@@ -0,0 +1,5 @@
+-- Migration: Command audit log (down)
+-- Created: 2026-10-16
+-- Description: Reverts 004_command_history
+
+DROP TABLE IF EXISTS command_history;
@@ -0,0 +1,20 @@
+-- Migration: Command audit log
+-- Created: 2026-10-15
+-- Description: Record every action executed against a server on behalf of a user
+
+CREATE TABLE IF NOT EXISTS command_history (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    telegram_id BIGINT NOT NULL,
+    server_id VARCHAR(255) NOT NULL,
+    command VARCHAR(64) NOT NULL,
+    payload TEXT,
+    response TEXT,
+    success BOOLEAN NOT NULL DEFAULT true,
+    error TEXT,
+    duration_ms INTEGER DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_command_history_server_id ON command_history(server_id);
+CREATE INDEX IF NOT EXISTS idx_command_history_created_at ON command_history(created_at DESC);
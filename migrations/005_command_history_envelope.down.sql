@@ -0,0 +1,5 @@
+-- Migration: Command envelopes for replay (down)
+-- Created: 2026-10-16
+-- Description: Reverts 005_command_history_envelope
+
+ALTER TABLE command_history DROP COLUMN IF EXISTS envelope;
@@ -0,0 +1,5 @@
+-- Migration: Command envelopes for replay
+-- Created: 2026-10-15
+-- Description: Keep the protocol message sent to the agent so recorded commands can be replayed
+
+ALTER TABLE command_history ADD COLUMN IF NOT EXISTS envelope TEXT;
@@ -0,0 +1,5 @@
+-- Migration: Historical server metrics (down)
+-- Created: 2026-10-16
+-- Description: Reverts 006_metrics_history
+
+DROP TABLE IF EXISTS metrics_history;
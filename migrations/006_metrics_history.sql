@@ -0,0 +1,12 @@
+-- Migration: Historical server metrics
+-- Created: 2026-10-15
+-- Description: Narrow table of metric samples ingested in batches with COPY
+
+CREATE TABLE IF NOT EXISTS metrics_history (
+    server_key VARCHAR(255) NOT NULL,
+    name VARCHAR(64) NOT NULL,
+    value DOUBLE PRECISION NOT NULL,
+    collected_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_metrics_history_server_time ON metrics_history(server_key, name, collected_at DESC);
@@ -0,0 +1,16 @@
+-- Migration: Custom user-defined commands
+-- Created: 2026-10-15
+-- Description: Named bot commands running allow-listed agent scripts per server
+
+CREATE TABLE IF NOT EXISTS custom_commands (
+    id SERIAL PRIMARY KEY,
+    server_id VARCHAR(255) NOT NULL REFERENCES servers(server_id) ON DELETE CASCADE,
+    name VARCHAR(32) NOT NULL,
+    script VARCHAR(1024) NOT NULL,
+    required_role VARCHAR(50) NOT NULL DEFAULT 'owner', -- owner, admin, viewer
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(server_id, name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_custom_commands_name ON custom_commands(name);
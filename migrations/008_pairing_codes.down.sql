@@ -0,0 +1,5 @@
+-- Migration: Agent pairing codes (down)
+-- Created: 2026-10-16
+-- Description: Reverts 008_pairing_codes
+
+DROP TABLE IF EXISTS pairing_codes;
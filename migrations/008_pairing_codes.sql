@@ -0,0 +1,16 @@
+-- Migration: Agent pairing codes
+-- Created: 2026-10-15
+-- Description: Short-lived one-time codes linking a newly started agent to a user
+
+CREATE TABLE IF NOT EXISTS pairing_codes (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(6) UNIQUE NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    telegram_id BIGINT NOT NULL,
+    server_id VARCHAR(255), -- set once the code is used
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_pairing_codes_expires_at ON pairing_codes(expires_at);
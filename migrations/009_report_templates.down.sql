@@ -0,0 +1,6 @@
+-- Migration: Report templates (down)
+-- Created: 2026-10-16
+-- Description: Reverts 009_report_templates
+
+ALTER TABLE report_schedules DROP COLUMN IF EXISTS server_order;
+ALTER TABLE report_schedules DROP COLUMN IF EXISTS sections;
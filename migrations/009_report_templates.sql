@@ -0,0 +1,6 @@
+-- Migration: Report templates
+-- Created: 2026-10-15
+-- Description: Sections and server order of scheduled reports
+
+ALTER TABLE report_schedules ADD COLUMN IF NOT EXISTS sections VARCHAR(255) NOT NULL DEFAULT ''; -- comma-separated, empty for the default
+ALTER TABLE report_schedules ADD COLUMN IF NOT EXISTS server_order TEXT; -- comma-separated server IDs listed first
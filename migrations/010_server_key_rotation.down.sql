@@ -0,0 +1,13 @@
+-- Migration: Server key rotation (down)
+-- Created: 2026-10-16
+-- Description: Reverts 010_server_key_rotation
+
+DROP INDEX IF EXISTS idx_servers_previous_key;
+DROP INDEX IF EXISTS idx_servers_pending_key;
+DROP INDEX IF EXISTS idx_servers_server_key;
+ALTER TABLE servers DROP COLUMN IF EXISTS key_rotated_by;
+ALTER TABLE servers DROP COLUMN IF EXISTS previous_key_expires_at;
+ALTER TABLE servers DROP COLUMN IF EXISTS previous_key;
+ALTER TABLE servers DROP COLUMN IF EXISTS pending_key;
+ALTER TABLE servers DROP COLUMN IF EXISTS key_version;
+ALTER TABLE servers DROP COLUMN IF EXISTS server_key;
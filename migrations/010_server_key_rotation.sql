@@ -0,0 +1,14 @@
+-- Migration: Server key rotation
+-- Created: 2026-10-15
+-- Description: Key versions of servers so a compromised srv_ key can be replaced
+
+ALTER TABLE servers ADD COLUMN IF NOT EXISTS server_key VARCHAR(255); -- current agent key, NULL while it equals server_id
+ALTER TABLE servers ADD COLUMN IF NOT EXISTS key_version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE servers ADD COLUMN IF NOT EXISTS pending_key VARCHAR(255); -- issued, not yet picked up by the agent
+ALTER TABLE servers ADD COLUMN IF NOT EXISTS previous_key VARCHAR(255); -- replaced key, valid during the grace window
+ALTER TABLE servers ADD COLUMN IF NOT EXISTS previous_key_expires_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE servers ADD COLUMN IF NOT EXISTS key_rotated_by BIGINT; -- Telegram ID of the user who requested the rotation
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_servers_server_key ON servers(server_key);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_servers_pending_key ON servers(pending_key);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_servers_previous_key ON servers(previous_key);
@@ -0,0 +1,23 @@
+-- Migration: Server tags
+-- Created: 2026-10-15
+-- Description: Tags grouping servers that share infrastructure, used to correlate alerts
+
+CREATE TABLE IF NOT EXISTS tags (
+    name VARCHAR(64) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '', -- e.g. shared database db-1
+    correlation_window_seconds INTEGER NOT NULL DEFAULT 0, -- 0 for the default window
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS server_tags (
+    server_id VARCHAR(255) NOT NULL,
+    tag VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (server_id, tag)
+);
+
+CREATE INDEX IF NOT EXISTS idx_server_tags_tag ON server_tags(tag);
+
+CREATE TRIGGER update_tags_updated_at BEFORE UPDATE ON tags
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,5 @@
+-- Migration: Notification channels (down)
+-- Created: 2026-10-16
+-- Description: Reverts 012_notification_channels
+
+DROP TABLE IF EXISTS notification_channels;
@@ -0,0 +1,14 @@
+-- Migration: Notification channels
+-- Created: 2026-10-16
+-- Description: Slack, Discord, email and webhook channels receiving alerts and reports besides Telegram
+
+CREATE TABLE IF NOT EXISTS notification_channels (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    server_id VARCHAR(255) REFERENCES servers(server_id) ON DELETE CASCADE, -- NULL for all servers of the user
+    kind VARCHAR(16) NOT NULL, -- slack, discord, email, webhook
+    target TEXT NOT NULL, -- webhook URL or email address
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_channels_user_id ON notification_channels(user_id);
@@ -0,0 +1,5 @@
+-- Migration: Chat server bindings (down)
+-- Created: 2026-10-16
+-- Description: Reverts 013_chat_servers
+
+DROP TABLE IF EXISTS chat_servers;
@@ -0,0 +1,13 @@
+-- Migration: Chat server bindings
+-- Created: 2026-10-16
+-- Description: Servers attached to group chats, whose members see their metrics and alerts
+
+CREATE TABLE IF NOT EXISTS chat_servers (
+    chat_id BIGINT NOT NULL, -- Telegram group chat ID
+    server_id VARCHAR(255) NOT NULL REFERENCES servers(server_id) ON DELETE CASCADE,
+    bound_by INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (chat_id, server_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_chat_servers_server_id ON chat_servers(server_id);
@@ -0,0 +1,13 @@
+-- Migration: Container restart policies
+-- Created: 2026-10-16
+-- Description: Limits of container restarts per hour, enforced by agents with Docker events
+
+CREATE TABLE IF NOT EXISTS restart_policies (
+    server_id VARCHAR(255) NOT NULL REFERENCES servers(server_id) ON DELETE CASCADE,
+    container VARCHAR(255) NOT NULL, -- container name
+    max_restarts INTEGER NOT NULL, -- exits per hour after which the agent stops restarting the container
+    created_by BIGINT NOT NULL, -- Telegram ID of the owner who set the policy and is alerted
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    tripped_at TIMESTAMP WITH TIME ZONE, -- when the agent last stopped restarting the container
+    PRIMARY KEY (server_id, container)
+);
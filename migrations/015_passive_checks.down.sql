@@ -0,0 +1,5 @@
+-- Migration: Passive checks (down)
+-- Created: 2026-10-16
+-- Description: Reverts 015_passive_checks
+
+DROP TABLE IF EXISTS passive_checks;
@@ -0,0 +1,14 @@
+-- Migration: Passive checks
+-- Created: 2026-10-16
+-- Description: Last results of Nagios and Zabbix checks submitted for servers, alerted on state changes
+
+CREATE TABLE IF NOT EXISTS passive_checks (
+    server_id VARCHAR(255) NOT NULL REFERENCES servers(server_id) ON DELETE CASCADE,
+    service VARCHAR(255) NOT NULL, -- check name, HOST for host checks
+    host VARCHAR(255) NOT NULL, -- host name as reported by the monitoring system
+    state SMALLINT NOT NULL, -- 0 OK, 1 WARNING, 2 CRITICAL, 3 UNKNOWN
+    output TEXT,
+    checked_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    changed_at TIMESTAMP WITH TIME ZONE NOT NULL, -- when the check entered its state
+    PRIMARY KEY (server_id, service)
+);
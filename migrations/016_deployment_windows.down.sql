@@ -0,0 +1,5 @@
+-- Migration: Deployment windows (down)
+-- Created: 2026-10-16
+-- Description: Reverts 016_deployment_windows
+
+DROP TABLE IF EXISTS deployment_windows;
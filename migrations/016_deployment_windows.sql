@@ -0,0 +1,16 @@
+-- Migration: Deployment windows
+-- Created: 2026-10-16
+-- Description: Recurring weekly windows of planned work on servers, during which alerts are held for a summary
+
+CREATE TABLE IF NOT EXISTS deployment_windows (
+    id SERIAL PRIMARY KEY,
+    server_id VARCHAR(255) NOT NULL REFERENCES servers(server_id) ON DELETE CASCADE,
+    weekday SMALLINT NOT NULL, -- 0 is Sunday
+    start_minute SMALLINT NOT NULL, -- minutes after midnight
+    end_minute SMALLINT NOT NULL, -- not after start_minute for windows past midnight
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    created_by BIGINT NOT NULL, -- Telegram ID
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_deployment_windows_server_id ON deployment_windows(server_id);
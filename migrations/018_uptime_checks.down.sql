@@ -0,0 +1,6 @@
+-- Migration: Uptime checks (down)
+-- Created: 2026-10-16
+-- Description: Reverts 018_uptime_checks
+
+DROP TABLE IF EXISTS uptime_check_results;
+DROP TABLE IF EXISTS uptime_checks;
@@ -0,0 +1,30 @@
+-- Migration: Uptime checks
+-- Created: 2026-10-16
+-- Description: HTTP and TCP endpoint checks run on schedule by the bot or a server agent, with their status history
+
+CREATE TABLE IF NOT EXISTS uptime_checks (
+    id SERIAL PRIMARY KEY,
+    telegram_id BIGINT NOT NULL, -- user who added the check and gets its alerts
+    server_id VARCHAR(255) NOT NULL DEFAULT '', -- agent running the check, empty when the bot runs it
+    kind VARCHAR(16) NOT NULL, -- http or tcp
+    target VARCHAR(2048) NOT NULL,
+    interval_seconds INTEGER NOT NULL,
+    up BOOLEAN, -- NULL until the first result
+    checked_at TIMESTAMP WITH TIME ZONE,
+    changed_at TIMESTAMP WITH TIME ZONE, -- when the check entered its state
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_uptime_checks_telegram_id ON uptime_checks(telegram_id);
+
+CREATE TABLE IF NOT EXISTS uptime_check_results (
+    id BIGSERIAL PRIMARY KEY,
+    check_id INTEGER NOT NULL REFERENCES uptime_checks(id) ON DELETE CASCADE,
+    up BOOLEAN NOT NULL,
+    latency_ms INTEGER NOT NULL,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    error VARCHAR(255) NOT NULL DEFAULT '',
+    checked_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_uptime_check_results_check_id ON uptime_check_results(check_id, checked_at);
@@ -0,0 +1,5 @@
+-- Migration: Server guests (down)
+-- Created: 2026-10-16
+-- Description: Reverts 019_server_guests
+
+DROP TABLE IF EXISTS server_guests;
@@ -0,0 +1,15 @@
+-- Migration: Server guests
+-- Created: 2026-10-16
+-- Description: Time-boxed viewer access to servers, revoked when it expires
+
+CREATE TABLE IF NOT EXISTS server_guests (
+    id SERIAL PRIMARY KEY,
+    server_id VARCHAR(255) NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    granted_by BIGINT NOT NULL, -- Telegram ID of the owner who granted access
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (server_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_server_guests_expires_at ON server_guests(expires_at);
@@ -0,0 +1,5 @@
+-- Migration: User deletion (down)
+-- Created: 2026-10-16
+-- Description: Reverts 020_user_deletion
+
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
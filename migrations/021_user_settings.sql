@@ -0,0 +1,9 @@
+-- Migration: User settings
+-- Created: 2026-10-16
+-- Description: Per-user preferences, such as the server metric commands use by default
+
+CREATE TABLE IF NOT EXISTS user_settings (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    default_server_id VARCHAR(255) REFERENCES servers(server_id) ON DELETE SET NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
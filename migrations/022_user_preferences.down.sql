@@ -0,0 +1,10 @@
+-- Migration: User preferences (down)
+-- Created: 2026-10-16
+-- Description: Reverts 022_user_preferences
+
+ALTER TABLE user_settings DROP COLUMN IF EXISTS notify_reports;
+ALTER TABLE user_settings DROP COLUMN IF EXISTS notify_alerts;
+ALTER TABLE user_settings DROP COLUMN IF EXISTS quiet_to;
+ALTER TABLE user_settings DROP COLUMN IF EXISTS quiet_from;
+ALTER TABLE user_settings DROP COLUMN IF EXISTS compact_metrics;
+ALTER TABLE user_settings DROP COLUMN IF EXISTS language;
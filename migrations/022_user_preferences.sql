@@ -0,0 +1,10 @@
+-- Migration: User preferences
+-- Created: 2026-10-16
+-- Description: Language, metric output, alert quiet hours and notification channel preferences of users
+
+ALTER TABLE user_settings ADD COLUMN IF NOT EXISTS language VARCHAR(8); -- deployment default when NULL
+ALTER TABLE user_settings ADD COLUMN IF NOT EXISTS compact_metrics BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE user_settings ADD COLUMN IF NOT EXISTS quiet_from SMALLINT; -- hour in the user's timezone, NULL when off
+ALTER TABLE user_settings ADD COLUMN IF NOT EXISTS quiet_to SMALLINT;
+ALTER TABLE user_settings ADD COLUMN IF NOT EXISTS notify_alerts BOOLEAN NOT NULL DEFAULT true;
+ALTER TABLE user_settings ADD COLUMN IF NOT EXISTS notify_reports BOOLEAN NOT NULL DEFAULT true;
@@ -0,0 +1,5 @@
+-- Migration: Maintenance windows (down)
+-- Created: 2026-10-16
+-- Description: Reverts 023_maintenance_windows
+
+DROP TABLE IF EXISTS maintenance_windows;
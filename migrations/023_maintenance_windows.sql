@@ -0,0 +1,14 @@
+-- Migration: Maintenance windows
+-- Created: 2026-10-16
+-- Description: One-off maintenance of servers, during which alerts are held for a summary
+
+CREATE TABLE IF NOT EXISTS maintenance_windows (
+    id SERIAL PRIMARY KEY,
+    server_id VARCHAR(255) NOT NULL REFERENCES servers(server_id) ON DELETE CASCADE,
+    starts_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    ends_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_by BIGINT NOT NULL, -- Telegram ID
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_maintenance_windows_server_id ON maintenance_windows(server_id);
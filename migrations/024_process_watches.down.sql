@@ -0,0 +1,5 @@
+-- Migration: Process watches (down)
+-- Created: 2026-10-16
+-- Description: Reverts 024_process_watches
+
+DROP TABLE IF EXISTS process_watches;
@@ -0,0 +1,12 @@
+-- Migration: Process watches
+-- Created: 2026-10-16
+-- Description: Processes that must be running on servers, alerted on when the agent stops reporting them
+
+CREATE TABLE IF NOT EXISTS process_watches (
+    server_id VARCHAR(255) NOT NULL REFERENCES servers(server_id) ON DELETE CASCADE,
+    name VARCHAR(64) NOT NULL, -- process name as reported by the agent
+    restart_command TEXT NOT NULL DEFAULT '', -- allow-listed command offered as a restart button, empty for none
+    created_by BIGINT NOT NULL, -- Telegram ID of the owner who added the watch
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (server_id, name)
+);
@@ -0,0 +1,14 @@
+-- Migration: Log watches
+-- Created: 2026-10-16
+-- Description: Log files agents tail for lines matching patterns, reported to the bot as alerts
+
+CREATE TABLE IF NOT EXISTS log_watches (
+    id SERIAL PRIMARY KEY,
+    server_id VARCHAR(255) NOT NULL REFERENCES servers(server_id) ON DELETE CASCADE,
+    path VARCHAR(255) NOT NULL, -- absolute path of the log file
+    pattern VARCHAR(255) NOT NULL, -- regular expression matched against new lines
+    created_by BIGINT NOT NULL, -- Telegram ID of the owner who added the watch and is alerted
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_log_watches_server_id ON log_watches(server_id);
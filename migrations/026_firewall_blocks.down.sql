@@ -0,0 +1,5 @@
+-- Migration: Firewall blocks (down)
+-- Created: 2026-10-16
+-- Description: Reverts 026_firewall_blocks
+
+DROP TABLE IF EXISTS firewall_blocks;
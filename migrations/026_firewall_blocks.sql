@@ -0,0 +1,12 @@
+-- Migration: Firewall blocks
+-- Created: 2026-10-16
+-- Description: Addresses blocked on servers from the bot, listed and reverted with /firewall
+
+CREATE TABLE IF NOT EXISTS firewall_blocks (
+    id SERIAL PRIMARY KEY,
+    server_id VARCHAR(255) NOT NULL REFERENCES servers(server_id) ON DELETE CASCADE,
+    address VARCHAR(64) NOT NULL, -- IP address or CIDR network
+    created_by BIGINT NOT NULL, -- Telegram ID of the owner who blocked the address
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(server_id, address)
+);
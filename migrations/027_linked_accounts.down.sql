@@ -0,0 +1,6 @@
+-- Migration: Linked web accounts (down)
+-- Created: 2026-10-16
+-- Description: Reverts 027_linked_accounts
+
+DROP TABLE IF EXISTS linked_accounts;
+DROP TABLE IF EXISTS account_link_codes;
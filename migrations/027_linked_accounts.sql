@@ -0,0 +1,26 @@
+-- Migration: Linked web accounts
+-- Created: 2026-10-16
+-- Description: One-time link codes and the ServerEye-Web accounts sharing a bot user's identity
+
+CREATE TABLE IF NOT EXISTS account_link_codes (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(8) UNIQUE NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    telegram_id BIGINT NOT NULL,
+    web_user_id VARCHAR(128), -- set once the code is used
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_account_link_codes_expires_at ON account_link_codes(expires_at);
+
+CREATE TABLE IF NOT EXISTS linked_accounts (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER UNIQUE NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    telegram_id BIGINT NOT NULL,
+    web_user_id VARCHAR(128) UNIQUE NOT NULL,
+    token_hash CHAR(64) UNIQUE NOT NULL, -- hex SHA-256 of the issued token
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,5 @@
+-- Migration: Alert outbox (down)
+-- Created: 2026-10-16
+-- Description: Reverts 028_alert_outbox
+
+DROP TABLE IF EXISTS alert_outbox;
@@ -0,0 +1,22 @@
+-- Migration: Alert outbox
+-- Created: 2026-10-16
+-- Description: Alerts persisted before they are sent to Telegram, kept until delivery is confirmed
+
+CREATE TABLE IF NOT EXISTS alert_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    chat_id BIGINT NOT NULL,
+    telegram_id BIGINT NOT NULL DEFAULT 0, -- user the alert is for, 0 for group chat alerts
+    text TEXT NOT NULL,
+    keyboard TEXT NOT NULL DEFAULT '', -- JSON inline keyboard, empty for none
+    quiet BOOLEAN NOT NULL DEFAULT FALSE,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    delivered_at TIMESTAMP WITH TIME ZONE,
+    failed_at TIMESTAMP WITH TIME ZONE, -- set once the retries are used up
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_outbox_pending ON alert_outbox(next_attempt_at)
+    WHERE delivered_at IS NULL AND failed_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_alert_outbox_created_at ON alert_outbox(created_at);
@@ -0,0 +1,10 @@
+-- Migration: Owner links
+-- Created: 2026-10-16
+-- Description: Servers added with their key belong to the user as owner, not viewer
+
+UPDATE user_servers SET role = 'owner'
+WHERE role = 'viewer'
+  AND NOT EXISTS (
+    SELECT 1 FROM server_guests g
+    WHERE g.server_id = user_servers.server_id AND g.user_id = user_servers.user_id
+  );
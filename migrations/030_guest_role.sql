@@ -0,0 +1,10 @@
+-- Migration: Guest role
+-- Created: 2026-10-16
+-- Description: Links of guests get their own role, so ending guest access leaves other links alone
+
+UPDATE user_servers SET role = 'guest'
+WHERE role = 'viewer'
+  AND EXISTS (
+    SELECT 1 FROM server_guests g
+    WHERE g.server_id = user_servers.server_id AND g.user_id = user_servers.user_id
+  );
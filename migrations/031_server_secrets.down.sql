@@ -0,0 +1,5 @@
+-- Migration: Server end-to-end secrets (down)
+-- Created: 2026-10-16
+-- Description: Reverts 031_server_secrets
+
+ALTER TABLE servers DROP COLUMN IF EXISTS e2e_secret;
@@ -0,0 +1,5 @@
+-- Migration: Server end-to-end secrets
+-- Created: 2026-10-16
+-- Description: Secrets agent command payloads are encrypted with, handed to the agent at pairing only
+
+ALTER TABLE servers ADD COLUMN IF NOT EXISTS e2e_secret VARCHAR(255); -- NULL for servers that were not paired
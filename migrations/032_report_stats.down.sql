@@ -0,0 +1,8 @@
+-- Migration: Report statistics and delivery retries (down)
+-- Created: 2026-10-16
+-- Description: Reverts 032_report_stats
+
+ALTER TABLE report_schedules DROP COLUMN IF EXISTS retry_at;
+ALTER TABLE report_schedules DROP COLUMN IF EXISTS failed_attempts;
+
+DROP TABLE IF EXISTS alert_log;
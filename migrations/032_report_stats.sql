@@ -0,0 +1,16 @@
+-- Migration: Report statistics and delivery retries
+-- Created: 2026-10-16
+-- Description: Alerts sent about servers, counted in reports, and the state of report deliveries that failed
+
+CREATE TABLE IF NOT EXISTS alert_log (
+    id BIGSERIAL PRIMARY KEY,
+    telegram_id BIGINT NOT NULL,
+    server_id VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_log_server ON alert_log(telegram_id, server_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_alert_log_created_at ON alert_log(created_at);
+
+ALTER TABLE report_schedules ADD COLUMN IF NOT EXISTS failed_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE report_schedules ADD COLUMN IF NOT EXISTS retry_at TIMESTAMP WITH TIME ZONE; -- NULL unless the last delivery failed
@@ -0,0 +1,25 @@
+// Package migrations embeds the SQL schema migrations of the bot. PostgreSQL migrations
+// live in this directory and MySQL ones in mysql/. A migration NNN_name.sql may have a
+// NNN_name.down.sql script reverting it.
+package migrations
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+)
+
+//go:embed *.sql mysql/*.sql
+var files embed.FS
+
+// For returns the migrations of a database driver
+func For(driver string) (fs.FS, error) {
+	switch driver {
+	case "postgres":
+		return fs.Sub(files, ".")
+	case "mysql":
+		return fs.Sub(files, "mysql")
+	default:
+		return nil, fmt.Errorf("unsupported database driver '%s'", driver)
+	}
+}
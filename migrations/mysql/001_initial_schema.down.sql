@@ -0,0 +1,9 @@
+-- Migration: Initial schema for MySQL and MariaDB (down)
+-- Created: 2026-10-16
+-- Description: Reverts 001_initial_schema
+
+DROP TABLE IF EXISTS command_history;
+DROP TABLE IF EXISTS report_schedules;
+DROP TABLE IF EXISTS user_servers;
+DROP TABLE IF EXISTS servers;
+DROP TABLE IF EXISTS users;
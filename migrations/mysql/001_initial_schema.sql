@@ -0,0 +1,76 @@
+-- Migration: Initial schema for MySQL and MariaDB
+-- Created: 2026-10-15
+-- Description: Equivalent of the PostgreSQL migrations 001-005 for self-hosted MySQL/MariaDB
+
+-- Users table
+CREATE TABLE IF NOT EXISTS users (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    telegram_id BIGINT UNIQUE NOT NULL,
+    username VARCHAR(255),
+    first_name VARCHAR(255),
+    last_name VARCHAR(255),
+    is_active BOOLEAN DEFAULT true,
+    is_admin BOOLEAN DEFAULT false,
+    timezone VARCHAR(64) DEFAULT 'UTC',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- Servers table
+CREATE TABLE IF NOT EXISTS servers (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    server_id VARCHAR(255) UNIQUE NOT NULL, -- e.g., srv_12313
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    ip_address VARCHAR(45),
+    port INTEGER DEFAULT 8080,
+    is_active BOOLEAN DEFAULT true,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- User-Servers relationship table (many-to-many)
+CREATE TABLE IF NOT EXISTS user_servers (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    server_id VARCHAR(255) NOT NULL, -- server_key
+    role VARCHAR(50) DEFAULT 'viewer', -- owner, admin, viewer
+    added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_user_servers (user_id, server_id),
+    KEY idx_user_servers_server_id (server_id),
+    CONSTRAINT fk_user_servers_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_user_servers_server_id FOREIGN KEY (server_id) REFERENCES servers(server_id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- Report schedules table (one schedule per user)
+CREATE TABLE IF NOT EXISTS report_schedules (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT UNIQUE NOT NULL,
+    frequency VARCHAR(16) NOT NULL, -- daily, weekly
+    weekday INTEGER DEFAULT 1, -- 0 = Sunday, used for weekly reports
+    hour INTEGER NOT NULL,
+    minute INTEGER NOT NULL,
+    last_sent_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    CONSTRAINT fk_report_schedules_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- Command audit log
+CREATE TABLE IF NOT EXISTS command_history (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT NULL,
+    telegram_id BIGINT NOT NULL,
+    server_id VARCHAR(255) NOT NULL,
+    command VARCHAR(64) NOT NULL,
+    payload MEDIUMTEXT,
+    envelope MEDIUMTEXT,
+    response MEDIUMTEXT,
+    success BOOLEAN NOT NULL DEFAULT true,
+    error TEXT,
+    duration_ms INTEGER DEFAULT 0,
+    created_at TIMESTAMP(3) DEFAULT CURRENT_TIMESTAMP(3),
+    KEY idx_command_history_server_id (server_id),
+    KEY idx_command_history_created_at (created_at),
+    CONSTRAINT fk_command_history_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
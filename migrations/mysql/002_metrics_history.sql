@@ -0,0 +1,11 @@
+-- Migration: Historical server metrics
+-- Created: 2026-10-15
+-- Description: Narrow table of metric samples ingested with multi-row inserts
+
+CREATE TABLE IF NOT EXISTS metrics_history (
+    server_key VARCHAR(255) NOT NULL,
+    name VARCHAR(64) NOT NULL,
+    value DOUBLE NOT NULL,
+    collected_at TIMESTAMP(3) NOT NULL,
+    KEY idx_metrics_history_server_time (server_key, name, collected_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,5 @@
+-- Migration: Custom user-defined commands (down)
+-- Created: 2026-10-16
+-- Description: Reverts 003_custom_commands
+
+DROP TABLE IF EXISTS custom_commands;
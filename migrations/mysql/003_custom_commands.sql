@@ -0,0 +1,17 @@
+-- Migration: Custom user-defined commands
+-- Created: 2026-10-15
+-- Description: Named bot commands running allow-listed agent scripts per server
+
+CREATE TABLE IF NOT EXISTS custom_commands (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    server_id VARCHAR(255) NOT NULL,
+    name VARCHAR(32) NOT NULL,
+    script VARCHAR(1024) NOT NULL,
+    required_role VARCHAR(50) NOT NULL DEFAULT 'owner', -- owner, admin, viewer
+    created_by BIGINT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_custom_commands_server_name (server_id, name),
+    KEY idx_custom_commands_name (name),
+    CONSTRAINT fk_custom_commands_server_id FOREIGN KEY (server_id) REFERENCES servers(server_id) ON DELETE CASCADE,
+    CONSTRAINT fk_custom_commands_created_by FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
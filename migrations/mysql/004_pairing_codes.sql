@@ -0,0 +1,17 @@
+-- Migration: Agent pairing codes
+-- Created: 2026-10-15
+-- Description: Short-lived one-time codes linking a newly started agent to a user
+
+CREATE TABLE IF NOT EXISTS pairing_codes (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    code VARCHAR(6) NOT NULL,
+    user_id BIGINT NOT NULL,
+    telegram_id BIGINT NOT NULL,
+    server_id VARCHAR(255) NULL, -- set once the code is used
+    expires_at TIMESTAMP(3) NOT NULL,
+    used_at TIMESTAMP(3) NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_pairing_codes_code (code),
+    KEY idx_pairing_codes_expires_at (expires_at),
+    CONSTRAINT fk_pairing_codes_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
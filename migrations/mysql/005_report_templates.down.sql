@@ -0,0 +1,7 @@
+-- Migration: Report templates (down)
+-- Created: 2026-10-16
+-- Description: Reverts 005_report_templates
+
+ALTER TABLE report_schedules
+    DROP COLUMN server_order,
+    DROP COLUMN sections;
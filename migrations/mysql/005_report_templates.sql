@@ -0,0 +1,7 @@
+-- Migration: Report templates
+-- Created: 2026-10-15
+-- Description: Sections and server order of scheduled reports
+
+ALTER TABLE report_schedules
+    ADD COLUMN sections VARCHAR(255) NOT NULL DEFAULT '', -- comma-separated, empty for the default
+    ADD COLUMN server_order TEXT NULL; -- comma-separated server IDs listed first
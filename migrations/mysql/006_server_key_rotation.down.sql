@@ -0,0 +1,14 @@
+-- Migration: Server key rotation (down)
+-- Created: 2026-10-16
+-- Description: Reverts 006_server_key_rotation
+
+ALTER TABLE servers
+    DROP INDEX uq_servers_previous_key,
+    DROP INDEX uq_servers_pending_key,
+    DROP INDEX uq_servers_server_key,
+    DROP COLUMN key_rotated_by,
+    DROP COLUMN previous_key_expires_at,
+    DROP COLUMN previous_key,
+    DROP COLUMN pending_key,
+    DROP COLUMN key_version,
+    DROP COLUMN server_key;
@@ -0,0 +1,14 @@
+-- Migration: Server key rotation
+-- Created: 2026-10-15
+-- Description: Key versions of servers so a compromised srv_ key can be replaced
+
+ALTER TABLE servers
+    ADD COLUMN server_key VARCHAR(255) NULL, -- current agent key, NULL while it equals server_id
+    ADD COLUMN key_version INTEGER NOT NULL DEFAULT 1,
+    ADD COLUMN pending_key VARCHAR(255) NULL, -- issued, not yet picked up by the agent
+    ADD COLUMN previous_key VARCHAR(255) NULL, -- replaced key, valid during the grace window
+    ADD COLUMN previous_key_expires_at TIMESTAMP(3) NULL,
+    ADD COLUMN key_rotated_by BIGINT NULL, -- Telegram ID of the user who requested the rotation
+    ADD UNIQUE KEY uq_servers_server_key (server_key),
+    ADD UNIQUE KEY uq_servers_pending_key (pending_key),
+    ADD UNIQUE KEY uq_servers_previous_key (previous_key);
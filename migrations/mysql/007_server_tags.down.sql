@@ -0,0 +1,6 @@
+-- Migration: Server tags (down)
+-- Created: 2026-10-16
+-- Description: Reverts 007_server_tags
+
+DROP TABLE IF EXISTS server_tags;
+DROP TABLE IF EXISTS tags;
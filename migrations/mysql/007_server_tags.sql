@@ -0,0 +1,19 @@
+-- Migration: Server tags
+-- Created: 2026-10-15
+-- Description: Tags grouping servers that share infrastructure, used to correlate alerts
+
+CREATE TABLE IF NOT EXISTS tags (
+    name VARCHAR(64) PRIMARY KEY,
+    description TEXT NOT NULL, -- e.g. shared database db-1
+    correlation_window_seconds INTEGER NOT NULL DEFAULT 0, -- 0 for the default window
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS server_tags (
+    server_id VARCHAR(255) NOT NULL,
+    tag VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (server_id, tag),
+    KEY idx_server_tags_tag (tag)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,15 @@
+-- Migration: Notification channels
+-- Created: 2026-10-16
+-- Description: Slack, Discord, email and webhook channels receiving alerts and reports besides Telegram
+
+CREATE TABLE IF NOT EXISTS notification_channels (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    server_id VARCHAR(255) NULL, -- NULL for all servers of the user
+    kind VARCHAR(16) NOT NULL, -- slack, discord, email, webhook
+    target TEXT NOT NULL, -- webhook URL or email address
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    KEY idx_notification_channels_user_id (user_id),
+    CONSTRAINT fk_notification_channels_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_notification_channels_server_id FOREIGN KEY (server_id) REFERENCES servers(server_id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
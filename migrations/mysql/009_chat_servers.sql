@@ -0,0 +1,14 @@
+-- Migration: Chat server bindings
+-- Created: 2026-10-16
+-- Description: Servers attached to group chats, whose members see their metrics and alerts
+
+CREATE TABLE IF NOT EXISTS chat_servers (
+    chat_id BIGINT NOT NULL, -- Telegram group chat ID
+    server_id VARCHAR(255) NOT NULL,
+    bound_by BIGINT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (chat_id, server_id),
+    KEY idx_chat_servers_server_id (server_id),
+    CONSTRAINT fk_chat_servers_server_id FOREIGN KEY (server_id) REFERENCES servers(server_id) ON DELETE CASCADE,
+    CONSTRAINT fk_chat_servers_bound_by FOREIGN KEY (bound_by) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,5 @@
+-- Migration: Container restart policies (down)
+-- Created: 2026-10-16
+-- Description: Reverts 010_restart_policies
+
+DROP TABLE IF EXISTS restart_policies;
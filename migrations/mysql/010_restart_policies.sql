@@ -0,0 +1,14 @@
+-- Migration: Container restart policies
+-- Created: 2026-10-16
+-- Description: Limits of container restarts per hour, enforced by agents with Docker events
+
+CREATE TABLE IF NOT EXISTS restart_policies (
+    server_id VARCHAR(255) NOT NULL,
+    container VARCHAR(255) NOT NULL, -- container name
+    max_restarts INT NOT NULL, -- exits per hour after which the agent stops restarting the container
+    created_by BIGINT NOT NULL, -- Telegram ID of the owner who set the policy and is alerted
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    tripped_at TIMESTAMP NULL, -- when the agent last stopped restarting the container
+    PRIMARY KEY (server_id, container),
+    CONSTRAINT fk_restart_policies_server_id FOREIGN KEY (server_id) REFERENCES servers(server_id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
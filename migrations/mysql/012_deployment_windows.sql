@@ -0,0 +1,16 @@
+-- Migration: Deployment windows
+-- Created: 2026-10-16
+-- Description: Recurring weekly windows of planned work on servers, during which alerts are held for a summary
+
+CREATE TABLE IF NOT EXISTS deployment_windows (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    server_id VARCHAR(255) NOT NULL,
+    weekday SMALLINT NOT NULL, -- 0 is Sunday
+    start_minute SMALLINT NOT NULL, -- minutes after midnight
+    end_minute SMALLINT NOT NULL, -- not after start_minute for windows past midnight
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    created_by BIGINT NOT NULL, -- Telegram ID
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    KEY idx_deployment_windows_server_id (server_id),
+    CONSTRAINT fk_deployment_windows_server_id FOREIGN KEY (server_id) REFERENCES servers(server_id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,5 @@
+-- Migration: Alert routes (down)
+-- Created: 2026-10-16
+-- Description: Reverts 013_alert_routes
+
+DROP TABLE IF EXISTS alert_routes;
@@ -0,0 +1,13 @@
+-- Migration: Alert routes
+-- Created: 2026-10-16
+-- Description: Chats that alerts of a category are sent to instead of the private chat of a user
+
+CREATE TABLE IF NOT EXISTS alert_routes (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    telegram_id BIGINT NOT NULL,
+    server_id VARCHAR(255) NOT NULL DEFAULT '', -- empty for all servers of the user
+    category VARCHAR(32) NOT NULL, -- 'all' for every category
+    chat_id BIGINT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_alert_routes (telegram_id, server_id, category)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,29 @@
+-- Migration: Uptime checks
+-- Created: 2026-10-16
+-- Description: HTTP and TCP endpoint checks run on schedule by the bot or a server agent, with their status history
+
+CREATE TABLE IF NOT EXISTS uptime_checks (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    telegram_id BIGINT NOT NULL, -- user who added the check and gets its alerts
+    server_id VARCHAR(255) NOT NULL DEFAULT '', -- agent running the check, empty when the bot runs it
+    kind VARCHAR(16) NOT NULL, -- http or tcp
+    target VARCHAR(2048) NOT NULL,
+    interval_seconds INTEGER NOT NULL,
+    up BOOLEAN NULL, -- NULL until the first result
+    checked_at TIMESTAMP NULL,
+    changed_at TIMESTAMP NULL, -- when the check entered its state
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    KEY idx_uptime_checks_telegram_id (telegram_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS uptime_check_results (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    check_id BIGINT NOT NULL,
+    up BOOLEAN NOT NULL,
+    latency_ms INTEGER NOT NULL,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    error VARCHAR(255) NOT NULL DEFAULT '',
+    checked_at TIMESTAMP NOT NULL,
+    KEY idx_uptime_check_results_check_id (check_id, checked_at),
+    CONSTRAINT fk_uptime_check_results_check_id FOREIGN KEY (check_id) REFERENCES uptime_checks(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,15 @@
+-- Migration: Server guests
+-- Created: 2026-10-16
+-- Description: Time-boxed viewer access to servers, revoked when it expires
+
+CREATE TABLE IF NOT EXISTS server_guests (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    server_id VARCHAR(255) NOT NULL,
+    user_id BIGINT NOT NULL,
+    granted_by BIGINT NOT NULL, -- Telegram ID of the owner who granted access
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_server_guests (server_id, user_id),
+    KEY idx_server_guests_expires_at (expires_at),
+    CONSTRAINT fk_server_guests_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
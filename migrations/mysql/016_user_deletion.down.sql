@@ -0,0 +1,5 @@
+-- Migration: User deletion (down)
+-- Created: 2026-10-16
+-- Description: Reverts 016_user_deletion
+
+ALTER TABLE users DROP COLUMN deleted_at;
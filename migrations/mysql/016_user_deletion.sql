@@ -0,0 +1,5 @@
+-- Migration: User deletion
+-- Created: 2026-10-16
+-- Description: When a user erased their data with /forgetme
+
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP NULL;
@@ -0,0 +1,5 @@
+-- Migration: User settings (down)
+-- Created: 2026-10-16
+-- Description: Reverts 017_user_settings
+
+DROP TABLE IF EXISTS user_settings;
@@ -0,0 +1,11 @@
+-- Migration: User settings
+-- Created: 2026-10-16
+-- Description: Per-user preferences, such as the server metric commands use by default
+
+CREATE TABLE IF NOT EXISTS user_settings (
+    user_id BIGINT NOT NULL PRIMARY KEY,
+    default_server_id VARCHAR(255) NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    CONSTRAINT fk_user_settings_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_user_settings_default_server_id FOREIGN KEY (default_server_id) REFERENCES servers(server_id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,11 @@
+-- Migration: User preferences (down)
+-- Created: 2026-10-16
+-- Description: Reverts 018_user_preferences
+
+ALTER TABLE user_settings
+    DROP COLUMN notify_reports,
+    DROP COLUMN notify_alerts,
+    DROP COLUMN quiet_to,
+    DROP COLUMN quiet_from,
+    DROP COLUMN compact_metrics,
+    DROP COLUMN language;
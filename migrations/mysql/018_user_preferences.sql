@@ -0,0 +1,11 @@
+-- Migration: User preferences
+-- Created: 2026-10-16
+-- Description: Language, metric output, alert quiet hours and notification channel preferences of users
+
+ALTER TABLE user_settings
+    ADD COLUMN language VARCHAR(8) NULL, -- deployment default when NULL
+    ADD COLUMN compact_metrics BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN quiet_from SMALLINT NULL, -- hour in the user's timezone, NULL when off
+    ADD COLUMN quiet_to SMALLINT NULL,
+    ADD COLUMN notify_alerts BOOLEAN NOT NULL DEFAULT true,
+    ADD COLUMN notify_reports BOOLEAN NOT NULL DEFAULT true;
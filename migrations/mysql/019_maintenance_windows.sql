@@ -0,0 +1,14 @@
+-- Migration: Maintenance windows
+-- Created: 2026-10-16
+-- Description: One-off maintenance of servers, during which alerts are held for a summary
+
+CREATE TABLE IF NOT EXISTS maintenance_windows (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    server_id VARCHAR(255) NOT NULL,
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP NOT NULL,
+    created_by BIGINT NOT NULL, -- Telegram ID
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    KEY idx_maintenance_windows_server_id (server_id),
+    CONSTRAINT fk_maintenance_windows_server_id FOREIGN KEY (server_id) REFERENCES servers(server_id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,13 @@
+-- Migration: Process watches
+-- Created: 2026-10-16
+-- Description: Processes that must be running on servers, alerted on when the agent stops reporting them
+
+CREATE TABLE IF NOT EXISTS process_watches (
+    server_id VARCHAR(255) NOT NULL,
+    name VARCHAR(64) NOT NULL, -- process name as reported by the agent
+    restart_command TEXT NOT NULL, -- allow-listed command offered as a restart button, empty for none
+    created_by BIGINT NOT NULL, -- Telegram ID of the owner who added the watch
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (server_id, name),
+    CONSTRAINT fk_process_watches_server_id FOREIGN KEY (server_id) REFERENCES servers(server_id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
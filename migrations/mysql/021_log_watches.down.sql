@@ -0,0 +1,5 @@
+-- Migration: Log watches (down)
+-- Created: 2026-10-16
+-- Description: Reverts 021_log_watches
+
+DROP TABLE IF EXISTS log_watches;
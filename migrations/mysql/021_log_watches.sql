@@ -0,0 +1,14 @@
+-- Migration: Log watches
+-- Created: 2026-10-16
+-- Description: Log files agents tail for lines matching patterns, reported to the bot as alerts
+
+CREATE TABLE IF NOT EXISTS log_watches (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    server_id VARCHAR(255) NOT NULL,
+    path VARCHAR(255) NOT NULL, -- absolute path of the log file
+    pattern VARCHAR(255) NOT NULL, -- regular expression matched against new lines
+    created_by BIGINT NOT NULL, -- Telegram ID of the owner who added the watch and is alerted
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    KEY idx_log_watches_server_id (server_id),
+    CONSTRAINT fk_log_watches_server_id FOREIGN KEY (server_id) REFERENCES servers(server_id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,13 @@
+-- Migration: Firewall blocks
+-- Created: 2026-10-16
+-- Description: Addresses blocked on servers from the bot, listed and reverted with /firewall
+
+CREATE TABLE IF NOT EXISTS firewall_blocks (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    server_id VARCHAR(255) NOT NULL,
+    address VARCHAR(64) NOT NULL, -- IP address or CIDR network
+    created_by BIGINT NOT NULL, -- Telegram ID of the owner who blocked the address
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_firewall_blocks_server_address (server_id, address),
+    CONSTRAINT fk_firewall_blocks_server_id FOREIGN KEY (server_id) REFERENCES servers(server_id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
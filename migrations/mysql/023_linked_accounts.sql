@@ -0,0 +1,31 @@
+-- Migration: Linked web accounts
+-- Created: 2026-10-16
+-- Description: One-time link codes and the ServerEye-Web accounts sharing a bot user's identity
+
+CREATE TABLE IF NOT EXISTS account_link_codes (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    code VARCHAR(8) NOT NULL,
+    user_id BIGINT NOT NULL,
+    telegram_id BIGINT NOT NULL,
+    web_user_id VARCHAR(128) NULL, -- set once the code is used
+    expires_at TIMESTAMP(3) NOT NULL,
+    used_at TIMESTAMP(3) NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_account_link_codes_code (code),
+    KEY idx_account_link_codes_expires_at (expires_at),
+    CONSTRAINT fk_account_link_codes_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS linked_accounts (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    telegram_id BIGINT NOT NULL,
+    web_user_id VARCHAR(128) NOT NULL,
+    token_hash CHAR(64) NOT NULL, -- hex SHA-256 of the issued token
+    last_used_at TIMESTAMP(3) NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uq_linked_accounts_user_id (user_id),
+    UNIQUE KEY uq_linked_accounts_web_user_id (web_user_id),
+    UNIQUE KEY uq_linked_accounts_token_hash (token_hash),
+    CONSTRAINT fk_linked_accounts_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
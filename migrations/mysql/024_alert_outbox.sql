@@ -0,0 +1,20 @@
+-- Migration: Alert outbox
+-- Created: 2026-10-16
+-- Description: Alerts persisted before they are sent to Telegram, kept until delivery is confirmed
+
+CREATE TABLE IF NOT EXISTS alert_outbox (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    chat_id BIGINT NOT NULL,
+    telegram_id BIGINT NOT NULL DEFAULT 0, -- user the alert is for, 0 for group chat alerts
+    text TEXT NOT NULL,
+    keyboard TEXT NOT NULL, -- JSON inline keyboard, empty for none
+    quiet BOOLEAN NOT NULL DEFAULT FALSE,
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP(3) NOT NULL,
+    last_error TEXT NOT NULL,
+    delivered_at TIMESTAMP(3) NULL,
+    failed_at TIMESTAMP(3) NULL, -- set once the retries are used up
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    KEY idx_alert_outbox_pending (delivered_at, failed_at, next_attempt_at),
+    KEY idx_alert_outbox_created_at (created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
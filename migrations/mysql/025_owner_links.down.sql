@@ -0,0 +1,6 @@
+-- Migration: Owner links (down)
+-- Created: 2026-10-16
+-- Description: Reverts 025_owner_links. Owners cannot be told apart from users that
+-- were promoted by pairing, so the roles are left as they are.
+
+SELECT 1;
@@ -0,0 +1,8 @@
+-- Migration: Owner links
+-- Created: 2026-10-16
+-- Description: Servers added with their key belong to the user as owner, not viewer
+
+UPDATE user_servers us
+LEFT JOIN server_guests g ON g.server_id = us.server_id AND g.user_id = us.user_id
+SET us.role = 'owner'
+WHERE us.role = 'viewer' AND g.id IS NULL;
@@ -0,0 +1,5 @@
+-- Migration: Guest role (down)
+-- Created: 2026-10-16
+-- Description: Reverts 026_guest_role
+
+UPDATE user_servers SET role = 'viewer' WHERE role = 'guest';
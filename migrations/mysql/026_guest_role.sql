@@ -0,0 +1,8 @@
+-- Migration: Guest role
+-- Created: 2026-10-16
+-- Description: Links of guests get their own role, so ending guest access leaves other links alone
+
+UPDATE user_servers us
+JOIN server_guests g ON g.server_id = us.server_id AND g.user_id = us.user_id
+SET us.role = 'guest'
+WHERE us.role = 'viewer';
@@ -0,0 +1,6 @@
+-- Migration: Server end-to-end secrets (down)
+-- Created: 2026-10-16
+-- Description: Reverts 027_server_secrets
+
+ALTER TABLE servers
+    DROP COLUMN e2e_secret;
@@ -0,0 +1,9 @@
+-- Migration: Report statistics and delivery retries (down)
+-- Created: 2026-10-16
+-- Description: Reverts 028_report_stats
+
+ALTER TABLE report_schedules
+    DROP COLUMN retry_at,
+    DROP COLUMN failed_attempts;
+
+DROP TABLE IF EXISTS alert_log;
@@ -0,0 +1,16 @@
+-- Migration: Report statistics and delivery retries
+-- Created: 2026-10-16
+-- Description: Alerts sent about servers, counted in reports, and the state of report deliveries that failed
+
+CREATE TABLE IF NOT EXISTS alert_log (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    telegram_id BIGINT NOT NULL,
+    server_id VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    KEY idx_alert_log_server (telegram_id, server_id, created_at),
+    KEY idx_alert_log_created_at (created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+ALTER TABLE report_schedules
+    ADD COLUMN failed_attempts INT NOT NULL DEFAULT 0,
+    ADD COLUMN retry_at TIMESTAMP NULL; -- NULL unless the last delivery failed
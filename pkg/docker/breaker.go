@@ -0,0 +1,167 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/servereye/servereyebot/pkg/errors"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// Prober checks whether the agent of a server is reachable without sending it a command
+type Prober func(ctx context.Context, serverKey string) error
+
+// CircuitBreakerAgent stops sending commands to servers whose agent keeps timing out, so
+// that users do not wait out the full timeout of every command. After threshold
+// consecutive timeouts commands fail fast for cooldown. The agent is then probed and
+// commands resume once a probe succeeds.
+type CircuitBreakerAgent struct {
+	agent     Agent
+	probe     Prober
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	circuits map[string]*circuit // by server key, only for servers with recent timeouts
+}
+
+// circuit is the state of the commands to a server
+type circuit struct {
+	timeouts  int
+	since     time.Time // first timeout in a row
+	openUntil time.Time // zero while commands are sent
+	probing   bool
+}
+
+// NewCircuitBreakerAgent wraps agent with a circuit breaker per server
+func NewCircuitBreakerAgent(agent Agent, probe Prober, threshold int, cooldown time.Duration) *CircuitBreakerAgent {
+	return &CircuitBreakerAgent{
+		agent:     agent,
+		probe:     probe,
+		threshold: threshold,
+		cooldown:  cooldown,
+		circuits:  make(map[string]*circuit),
+	}
+}
+
+// SendCommand sends a command unless the server appears offline
+func (a *CircuitBreakerAgent) SendCommand(ctx context.Context, serverKey string, msg *protocol.Message) (*protocol.Message, error) {
+	if since, offline := a.offline(ctx, serverKey, time.Now()); offline {
+		return nil, newOfflineError(since)
+	}
+
+	resp, err := a.agent.SendCommand(ctx, serverKey, msg)
+	a.record(serverKey, err, time.Now())
+	return resp, err
+}
+
+// Probe probes the agents of the servers whose cooldown has passed, closing the circuit
+// of those that respond again
+func (a *CircuitBreakerAgent) Probe(ctx context.Context) {
+	a.mu.Lock()
+	var keys []string
+	for key, c := range a.circuits {
+		if !c.openUntil.IsZero() {
+			keys = append(keys, key)
+		}
+	}
+	a.mu.Unlock()
+
+	now := time.Now()
+	for _, key := range keys {
+		a.offline(ctx, key, now)
+	}
+}
+
+// Offline returns the servers that appear offline with the time they stopped responding
+func (a *CircuitBreakerAgent) Offline() map[string]time.Time {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	offline := make(map[string]time.Time)
+	for key, c := range a.circuits {
+		if !c.openUntil.IsZero() {
+			offline[key] = c.since
+		}
+	}
+	return offline
+}
+
+// offline reports whether commands to a server must fail fast, probing the agent once
+// the cooldown has passed
+func (a *CircuitBreakerAgent) offline(ctx context.Context, serverKey string, now time.Time) (time.Time, bool) {
+	a.mu.Lock()
+	c, ok := a.circuits[serverKey]
+	if !ok || c.openUntil.IsZero() {
+		a.mu.Unlock()
+		return time.Time{}, false
+	}
+	if now.Before(c.openUntil) || c.probing {
+		a.mu.Unlock()
+		return c.since, true
+	}
+	c.probing = true
+	a.mu.Unlock()
+
+	err := a.probe(ctx, serverKey)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	c.probing = false
+	if err != nil {
+		c.openUntil = time.Now().Add(a.cooldown)
+		return c.since, true
+	}
+	delete(a.circuits, serverKey)
+	return time.Time{}, false
+}
+
+// record counts the timeouts in a row of a server, opening its circuit at the threshold
+func (a *CircuitBreakerAgent) record(serverKey string, err error, now time.Time) {
+	if errors.IsErrorCode(err, errors.ErrCodeCancelled) {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !errors.IsErrorCode(err, errors.ErrCodeTimeout) {
+		// The agent answered, or the failure does not tell whether it is online
+		delete(a.circuits, serverKey)
+		return
+	}
+
+	c, ok := a.circuits[serverKey]
+	if !ok {
+		c = &circuit{since: now}
+		a.circuits[serverKey] = c
+	}
+	c.timeouts++
+	if c.timeouts >= a.threshold && c.openUntil.IsZero() {
+		c.openUntil = now.Add(a.cooldown)
+	}
+}
+
+// newOfflineError creates the error of a command not sent to a server that appears offline
+func newOfflineError(since time.Time) *errors.AppError {
+	return &errors.AppError{
+		Code:       errors.ErrCodeUnavailable,
+		Message:    fmt.Sprintf("server appears offline since %s", since.Format(time.RFC3339)),
+		HTTPStatus: http.StatusServiceUnavailable,
+		Details:    map[string]interface{}{"offline_since": since},
+	}
+}
+
+// OfflineSince returns when a server stopped responding when err was returned without
+// sending a command because the server appears offline
+func OfflineSince(err error) (time.Time, bool) {
+	appErr, ok := err.(*errors.AppError)
+	if !ok || appErr.Code != errors.ErrCodeUnavailable {
+		return time.Time{}, false
+	}
+	since, ok := appErr.Details["offline_since"].(time.Time)
+	return since, ok
+}
@@ -0,0 +1,120 @@
+package docker_test
+
+import (
+	"context"
+	stderrors "errors"
+	"testing"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/testutil"
+	"github.com/servereye/servereyebot/pkg/docker"
+	"github.com/servereye/servereyebot/pkg/errors"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// flakyAgent is a fake agent whose servers answer or time out
+type flakyAgent struct {
+	*testutil.Agent
+	failures map[string]error // by server key, nil answers
+}
+
+func newFlakyAgent() *flakyAgent {
+	a := &flakyAgent{Agent: testutil.NewAgent(), failures: make(map[string]error)}
+	a.Handle(protocol.TypeGetAgentVersion, func(serverKey string, msg *protocol.Message) (*protocol.Message, error) {
+		if err := a.failures[serverKey]; err != nil {
+			return nil, err
+		}
+		return protocol.NewReply(msg, protocol.TypeAgentVersion, protocol.AgentVersionResponse{Version: "1.4.2"}), nil
+	})
+	return a
+}
+
+// sent counts the commands that reached a server
+func (a *flakyAgent) sent(serverKey string) int {
+	n := 0
+	for _, call := range a.Received() {
+		if call.ServerKey == serverKey {
+			n++
+		}
+	}
+	return n
+}
+
+func TestCircuitBreakerAgent(t *testing.T) {
+	const cooldown = 20 * time.Millisecond
+	ctx := context.Background()
+	agent := newFlakyAgent()
+	probeErr := stderrors.New("agent not connected")
+	probes := 0
+	breaker := docker.NewCircuitBreakerAgent(agent, func(ctx context.Context, serverKey string) error {
+		probes++
+		return probeErr
+	}, 3, cooldown)
+
+	send := func(serverKey string) error {
+		_, err := breaker.SendCommand(ctx, serverKey, protocol.NewMessage(protocol.TypeGetAgentVersion, nil))
+		return err
+	}
+
+	// Timeouts count only in a row, and cancelled commands tell nothing
+	agent.failures["srv_a"] = errors.NewTimeoutError("agent command", nil)
+	send("srv_a")
+	send("srv_a")
+	agent.failures["srv_a"] = errors.NewCancelledError("agent command")
+	send("srv_a")
+	agent.failures["srv_a"] = nil
+	if err := send("srv_a"); err != nil {
+		t.Fatalf("command after 2 timeouts: %v", err)
+	}
+	agent.failures["srv_a"] = errors.NewTimeoutError("agent command", nil)
+	send("srv_a")
+	send("srv_a")
+	if len(breaker.Offline()) != 0 {
+		t.Fatalf("offline after 2 timeouts in a row: %v", breaker.Offline())
+	}
+
+	// The third timeout in a row opens the circuit
+	started := time.Now()
+	send("srv_a")
+	reached := agent.sent("srv_a")
+	err := send("srv_a")
+	since, ok := docker.OfflineSince(err)
+	if !ok || since.After(started) {
+		t.Fatalf("command to an offline server = %v, want an offline error", err)
+	}
+	if agent.sent("srv_a") != reached {
+		t.Error("command to an offline server reached the agent")
+	}
+	if offline := breaker.Offline(); len(offline) != 1 || !offline["srv_a"].Equal(since) {
+		t.Errorf("Offline = %v, want srv_a since %v", offline, since)
+	}
+
+	// Other servers are not affected
+	if err := send("srv_b"); err != nil {
+		t.Errorf("command to another server: %v", err)
+	}
+
+	// After the cooldown a failed probe keeps the circuit open without sending the command
+	time.Sleep(cooldown)
+	if _, ok := docker.OfflineSince(send("srv_a")); !ok || probes != 1 {
+		t.Errorf("after a failed probe: offline %v, %d probes, want offline after 1 probe", ok, probes)
+	}
+	if err := send("srv_a"); probes != 1 {
+		t.Errorf("command during the next cooldown = %v after %d probes, want no new probe", err, probes)
+	}
+	if agent.sent("srv_a") != reached {
+		t.Error("command during probing reached the agent")
+	}
+
+	// A successful probe closes the circuit
+	agent.failures["srv_a"] = nil
+	probeErr = nil
+	time.Sleep(cooldown)
+	breaker.Probe(ctx)
+	if probes != 2 || len(breaker.Offline()) != 0 {
+		t.Fatalf("after a successful probe: %d probes, offline %v, want 2 probes and none offline", probes, breaker.Offline())
+	}
+	if err := send("srv_a"); err != nil || agent.sent("srv_a") != reached+1 {
+		t.Errorf("command after the circuit closed = %v, want it sent", err)
+	}
+}
@@ -0,0 +1,461 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/servereye/servereyebot/pkg/errors"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// Agent sends command messages to the agent of a server
+type Agent interface {
+	SendCommand(ctx context.Context, serverKey string, msg *protocol.Message) (*protocol.Message, error)
+}
+
+// Recorder records every command exchanged with an agent
+type Recorder interface {
+	RecordExchange(ctx context.Context, serverKey string, req, resp *protocol.Message, elapsed time.Duration, err error)
+}
+
+// Client manages Docker on remote servers through their agents
+type Client struct {
+	agent       Agent
+	recorder    Recorder
+	timeout     time.Duration
+	longTimeout time.Duration
+
+	mu         sync.Mutex
+	operations map[string]*Operation // tracked commands waiting for their agent, by operation ID
+}
+
+// NewClient creates a new remote Docker client. recorder may be nil.
+// longTimeout bounds image pulls, compose operations and scripts, which take much longer than other commands.
+func NewClient(agent Agent, recorder Recorder, timeout, longTimeout time.Duration) *Client {
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	if longTimeout <= 0 {
+		longTimeout = 10 * time.Minute
+	}
+
+	return &Client{
+		agent:       agent,
+		recorder:    recorder,
+		timeout:     timeout,
+		longTimeout: longTimeout,
+		operations:  make(map[string]*Operation),
+	}
+}
+
+// LogsOptions represents options of a container logs request
+type LogsOptions struct {
+	Tail  int    // number of last lines, 0 for all
+	Since string // RFC3339 timestamp or relative duration, e.g. "10m"
+}
+
+// GetContainerLogs retrieves the last log lines of a container
+func (c *Client) GetContainerLogs(ctx context.Context, serverKey, containerID string, opts LogsOptions) (*protocol.ContainerLogsResponse, error) {
+	if containerID == "" {
+		return nil, errors.NewRequiredFieldError("container")
+	}
+	if opts.Tail < 0 {
+		return nil, errors.NewValidationError("tail must not be negative", map[string]interface{}{"tail": opts.Tail})
+	}
+
+	msg := protocol.NewMessage(protocol.TypeGetContainerLogs, protocol.ContainerLogsPayload{
+		ContainerID: containerID,
+		Tail:        opts.Tail,
+		Since:       opts.Since,
+	})
+
+	return send[protocol.ContainerLogsResponse](ctx, c, serverKey, msg, c.timeout, protocol.TypeContainerLogs)
+}
+
+// GetContainerStats retrieves a resource usage sample of the given containers, or of all
+// running containers when none are given
+func (c *Client) GetContainerStats(ctx context.Context, serverKey string, containerIDs ...string) (*protocol.ContainerStatsResponse, error) {
+	msg := protocol.NewMessage(protocol.TypeGetContainerStats, protocol.ContainerStatsPayload{
+		ContainerIDs: containerIDs,
+	})
+
+	return send[protocol.ContainerStatsResponse](ctx, c, serverKey, msg, c.timeout, protocol.TypeContainerStats)
+}
+
+// ListImages retrieves images present on a server
+func (c *Client) ListImages(ctx context.Context, serverKey string) (*protocol.ImageListResponse, error) {
+	msg := protocol.NewMessage(protocol.TypeListImages, nil)
+
+	return send[protocol.ImageListResponse](ctx, c, serverKey, msg, c.timeout, protocol.TypeImageList)
+}
+
+// PullImage pulls the latest version of an image, reporting the status of every layer
+func (c *Client) PullImage(ctx context.Context, serverKey, image string) (*protocol.ImagePullResponse, error) {
+	if image == "" {
+		return nil, errors.NewRequiredFieldError("image")
+	}
+
+	msg := protocol.NewMessage(protocol.TypePullImage, protocol.PullImagePayload{Image: image})
+
+	return send[protocol.ImagePullResponse](ctx, c, serverKey, msg, c.longTimeout, protocol.TypeImagePulled)
+}
+
+// PruneImages removes dangling images, or all unused images when danglingOnly is false
+func (c *Client) PruneImages(ctx context.Context, serverKey string, danglingOnly bool) (*protocol.ImagesPrunedResponse, error) {
+	msg := protocol.NewMessage(protocol.TypePruneImages, protocol.PruneImagesPayload{DanglingOnly: danglingOnly})
+
+	return send[protocol.ImagesPrunedResponse](ctx, c, serverKey, msg, c.timeout, protocol.TypeImagesPruned)
+}
+
+// ListComposeProjects retrieves compose projects running on a server with their services
+func (c *Client) ListComposeProjects(ctx context.Context, serverKey string) (*protocol.ComposeListResponse, error) {
+	msg := protocol.NewMessage(protocol.TypeListCompose, nil)
+
+	return send[protocol.ComposeListResponse](ctx, c, serverKey, msg, c.timeout, protocol.TypeComposeList)
+}
+
+// RunComposeAction brings a compose project up, down or restarts it
+func (c *Client) RunComposeAction(ctx context.Context, serverKey, project string, action protocol.ComposeAction) (*protocol.ComposeActionResponse, error) {
+	if project == "" {
+		return nil, errors.NewRequiredFieldError("project")
+	}
+
+	switch action {
+	case protocol.ComposeUp, protocol.ComposeDown, protocol.ComposeRestart:
+	default:
+		return nil, errors.NewValidationError("unsupported compose action", map[string]interface{}{"action": action})
+	}
+
+	msg := protocol.NewMessage(protocol.TypeComposeAction, protocol.ComposeActionPayload{
+		Project: project,
+		Action:  action,
+	})
+
+	return send[protocol.ComposeActionResponse](ctx, c, serverKey, msg, c.longTimeout, protocol.TypeComposeResult)
+}
+
+// ExecCommand runs a shell command on a server. Commands are not filtered here,
+// callers must check them against an allow-list.
+func (c *Client) ExecCommand(ctx context.Context, serverKey, command string, args []string) (*protocol.ExecResultResponse, error) {
+	if command == "" {
+		return nil, errors.NewRequiredFieldError("command")
+	}
+
+	msg := protocol.NewMessage(protocol.TypeExecCommand, protocol.ExecCommandPayload{
+		Command: command,
+		Args:    args,
+	})
+
+	return send[protocol.ExecResultResponse](ctx, c, serverKey, msg, c.timeout, protocol.TypeExecResult)
+}
+
+// RunScript runs a script on a server. Scripts may run as long as compose operations.
+func (c *Client) RunScript(ctx context.Context, serverKey, script string, args []string) (*protocol.ExecResultResponse, error) {
+	if script == "" {
+		return nil, errors.NewRequiredFieldError("script")
+	}
+
+	msg := protocol.NewMessage(protocol.TypeRunScript, protocol.RunScriptPayload{
+		Script: script,
+		Args:   args,
+	})
+
+	return send[protocol.ExecResultResponse](ctx, c, serverKey, msg, c.longTimeout, protocol.TypeScriptResult)
+}
+
+// ListDir lists a directory on a server
+func (c *Client) ListDir(ctx context.Context, serverKey, dir string) (*protocol.DirListingResponse, error) {
+	if dir == "" {
+		return nil, errors.NewRequiredFieldError("path")
+	}
+
+	msg := protocol.NewMessage(protocol.TypeListDir, protocol.ListDirPayload{Path: dir})
+
+	return send[protocol.DirListingResponse](ctx, c, serverKey, msg, c.timeout, protocol.TypeDirListing)
+}
+
+// GetDiskUsage retrieves the largest directories under a path on a server. Walking large
+// trees takes long, so the request is bounded by the long timeout.
+func (c *Client) GetDiskUsage(ctx context.Context, serverKey, dir string, maxDepth, limit int) (*protocol.DiskUsageResponse, error) {
+	if dir == "" {
+		return nil, errors.NewRequiredFieldError("path")
+	}
+	if maxDepth <= 0 || limit <= 0 {
+		return nil, errors.NewValidationError("depth and limit must be positive", map[string]interface{}{"max_depth": maxDepth, "limit": limit})
+	}
+
+	msg := protocol.NewMessage(protocol.TypeGetDiskUsage, protocol.GetDiskUsagePayload{
+		Path:     dir,
+		MaxDepth: maxDepth,
+		Limit:    limit,
+	})
+
+	return send[protocol.DiskUsageResponse](ctx, c, serverKey, msg, c.longTimeout, protocol.TypeDiskUsage)
+}
+
+// RunUptimeCheck probes an endpoint from a server
+func (c *Client) RunUptimeCheck(ctx context.Context, serverKey, kind, target string, timeout time.Duration) (*protocol.UptimeCheckResultResponse, error) {
+	if target == "" {
+		return nil, errors.NewRequiredFieldError("target")
+	}
+
+	msg := protocol.NewMessage(protocol.TypeRunUptimeCheck, protocol.RunUptimeCheckPayload{
+		Kind:           kind,
+		Target:         target,
+		TimeoutSeconds: int(timeout / time.Second),
+	})
+
+	return send[protocol.UptimeCheckResultResponse](ctx, c, serverKey, msg, timeout+c.timeout, protocol.TypeUptimeCheckResult)
+}
+
+// GetSMART retrieves the SMART health of the drives of a server
+func (c *Client) GetSMART(ctx context.Context, serverKey string) (*protocol.SMARTResponse, error) {
+	msg := protocol.NewMessage(protocol.TypeGetSMART, nil)
+
+	return send[protocol.SMARTResponse](ctx, c, serverKey, msg, c.longTimeout, protocol.TypeSMARTStatus)
+}
+
+// GetGPU retrieves the GPU readings of a server
+func (c *Client) GetGPU(ctx context.Context, serverKey string) (*protocol.GPUResponse, error) {
+	msg := protocol.NewMessage(protocol.TypeGetGPU, nil)
+
+	return send[protocol.GPUResponse](ctx, c, serverKey, msg, c.timeout, protocol.TypeGPUStatus)
+}
+
+// ListPorts retrieves the listening sockets of a server
+func (c *Client) ListPorts(ctx context.Context, serverKey string) (*protocol.PortListResponse, error) {
+	msg := protocol.NewMessage(protocol.TypeListPorts, nil)
+
+	return send[protocol.PortListResponse](ctx, c, serverKey, msg, c.timeout, protocol.TypePortList)
+}
+
+// ListConnections retrieves the established connections of a server
+func (c *Client) ListConnections(ctx context.Context, serverKey string) (*protocol.ConnectionListResponse, error) {
+	msg := protocol.NewMessage(protocol.TypeListConnections, nil)
+
+	return send[protocol.ConnectionListResponse](ctx, c, serverKey, msg, c.timeout, protocol.TypeConnectionList)
+}
+
+// GetFirewall retrieves the firewall status and rules of a server
+func (c *Client) GetFirewall(ctx context.Context, serverKey string) (*protocol.FirewallStatusResponse, error) {
+	msg := protocol.NewMessage(protocol.TypeGetFirewall, nil)
+
+	return send[protocol.FirewallStatusResponse](ctx, c, serverKey, msg, c.timeout, protocol.TypeFirewallStatus)
+}
+
+// BlockAddress drops incoming traffic from an address in the firewall of a server
+func (c *Client) BlockAddress(ctx context.Context, serverKey, address string) (*protocol.AddressChangedResponse, error) {
+	msg := protocol.NewMessage(protocol.TypeBlockAddress, protocol.AddressPayload{Address: address})
+
+	return send[protocol.AddressChangedResponse](ctx, c, serverKey, msg, c.timeout, protocol.TypeAddressBlocked)
+}
+
+// UnblockAddress removes the block of an address from the firewall of a server
+func (c *Client) UnblockAddress(ctx context.Context, serverKey, address string) (*protocol.AddressChangedResponse, error) {
+	msg := protocol.NewMessage(protocol.TypeUnblockAddress, protocol.AddressPayload{Address: address})
+
+	return send[protocol.AddressChangedResponse](ctx, c, serverKey, msg, c.timeout, protocol.TypeAddressUnblocked)
+}
+
+// RunSpeedtest measures the latency and bandwidth of a server
+func (c *Client) RunSpeedtest(ctx context.Context, serverKey, endpoint string, timeout time.Duration) (*protocol.SpeedtestResultResponse, error) {
+	msg := protocol.NewMessage(protocol.TypeRunSpeedtest, protocol.RunSpeedtestPayload{
+		Endpoint:       endpoint,
+		TimeoutSeconds: int(timeout / time.Second),
+	})
+
+	return send[protocol.SpeedtestResultResponse](ctx, c, serverKey, msg, timeout+c.timeout, protocol.TypeSpeedtestResult)
+}
+
+// PowerAction reboots or shuts down a server after delay
+func (c *Client) PowerAction(ctx context.Context, serverKey, action string, delay time.Duration) (*protocol.PowerActionResponse, error) {
+	msg := protocol.NewMessage(protocol.TypePowerAction, protocol.PowerActionPayload{
+		Action:       action,
+		DelaySeconds: int(delay / time.Second),
+	})
+
+	return send[protocol.PowerActionResponse](ctx, c, serverKey, msg, c.timeout, protocol.TypePowerActionQueued)
+}
+
+// GetBackups retrieves the status of the backup repositories of a server. Reading
+// repositories takes long, so the request is bounded by the long timeout.
+func (c *Client) GetBackups(ctx context.Context, serverKey string) (*protocol.BackupsResponse, error) {
+	msg := protocol.NewMessage(protocol.TypeGetBackups, nil)
+
+	return send[protocol.BackupsResponse](ctx, c, serverKey, msg, c.longTimeout, protocol.TypeBackupStatus)
+}
+
+// ListPods retrieves the Kubernetes nodes and the pods of a namespace, or of all
+// namespaces when it is empty, as seen from a server
+func (c *Client) ListPods(ctx context.Context, serverKey, namespace string) (*protocol.PodListResponse, error) {
+	msg := protocol.NewMessage(protocol.TypeListPods, protocol.ListPodsPayload{Namespace: namespace})
+
+	return send[protocol.PodListResponse](ctx, c, serverKey, msg, c.timeout, protocol.TypePodList)
+}
+
+// ListVMs retrieves the virtual machines of a libvirt or Proxmox host
+func (c *Client) ListVMs(ctx context.Context, serverKey string) (*protocol.VMListResponse, error) {
+	msg := protocol.NewMessage(protocol.TypeListVMs, nil)
+
+	return send[protocol.VMListResponse](ctx, c, serverKey, msg, c.timeout, protocol.TypeVMList)
+}
+
+// RunVMAction starts or shuts down a virtual machine. Guests take a while to shut down,
+// so the request is bounded by the long timeout.
+func (c *Client) RunVMAction(ctx context.Context, serverKey, vm string, action protocol.VMAction) (*protocol.VMActionResponse, error) {
+	if vm == "" {
+		return nil, errors.NewRequiredFieldError("vm")
+	}
+
+	msg := protocol.NewMessage(protocol.TypeVMAction, protocol.VMActionPayload{VM: vm, Action: action})
+
+	return send[protocol.VMActionResponse](ctx, c, serverKey, msg, c.longTimeout, protocol.TypeVMActionResult)
+}
+
+// GetUpdates retrieves the pending OS package updates of a server
+func (c *Client) GetUpdates(ctx context.Context, serverKey string) (*protocol.UpdatesResponse, error) {
+	msg := protocol.NewMessage(protocol.TypeGetUpdates, nil)
+
+	return send[protocol.UpdatesResponse](ctx, c, serverKey, msg, c.longTimeout, protocol.TypeUpdatesStatus)
+}
+
+// ApplySecurityUpdates installs the pending security updates of a server
+func (c *Client) ApplySecurityUpdates(ctx context.Context, serverKey string) (*protocol.UpdatesAppliedResponse, error) {
+	msg := protocol.NewMessage(protocol.TypeApplyUpdates, protocol.ApplyUpdatesPayload{SecurityOnly: true})
+
+	return send[protocol.UpdatesAppliedResponse](ctx, c, serverKey, msg, c.longTimeout, protocol.TypeUpdatesApplied)
+}
+
+// UpdateAgent asks the agent of a server to update itself to the latest release of a
+// channel, or to a pinned version, rolling back unless it reconnects within rollbackAfter
+func (c *Client) UpdateAgent(ctx context.Context, serverKey, channel, version string, rollbackAfter time.Duration) (*protocol.AgentUpdatingResponse, error) {
+	msg := protocol.NewMessage(protocol.TypeUpdateAgent, protocol.UpdateAgentPayload{
+		Channel:              channel,
+		Version:              version,
+		RollbackAfterSeconds: int(rollbackAfter.Seconds()),
+	})
+
+	return send[protocol.AgentUpdatingResponse](ctx, c, serverKey, msg, c.timeout, protocol.TypeAgentUpdating)
+}
+
+// GetAgentVersion retrieves the release the agent of a server runs
+func (c *Client) GetAgentVersion(ctx context.Context, serverKey string) (*protocol.AgentVersionResponse, error) {
+	msg := protocol.NewMessage(protocol.TypeGetAgentVersion, nil)
+
+	return send[protocol.AgentVersionResponse](ctx, c, serverKey, msg, c.timeout, protocol.TypeAgentVersion)
+}
+
+// ReadFile reads up to maxBytes of a file on a server, from its end when tail is set
+func (c *Client) ReadFile(ctx context.Context, serverKey, file string, maxBytes int64, tail bool) (*protocol.FileContentResponse, error) {
+	if file == "" {
+		return nil, errors.NewRequiredFieldError("path")
+	}
+	if maxBytes <= 0 {
+		return nil, errors.NewValidationError("max bytes must be positive", map[string]interface{}{"max_bytes": maxBytes})
+	}
+
+	msg := protocol.NewMessage(protocol.TypeReadFile, protocol.ReadFilePayload{
+		Path:     file,
+		MaxBytes: maxBytes,
+		Tail:     tail,
+	})
+
+	return send[protocol.FileContentResponse](ctx, c, serverKey, msg, c.timeout, protocol.TypeFileContent)
+}
+
+// SetRestartPolicies replaces the restart policies the agent of a server enforces
+func (c *Client) SetRestartPolicies(ctx context.Context, serverKey string, policies []protocol.RestartPolicy) (*protocol.RestartPoliciesSetResponse, error) {
+	if policies == nil {
+		policies = []protocol.RestartPolicy{}
+	}
+
+	msg := protocol.NewMessage(protocol.TypeSetRestartPolicy, protocol.RestartPoliciesPayload{Policies: policies})
+
+	return send[protocol.RestartPoliciesSetResponse](ctx, c, serverKey, msg, c.timeout, protocol.TypeRestartPolicySet)
+}
+
+// SetLogWatches replaces the log files the agent of a server tails for patterns
+func (c *Client) SetLogWatches(ctx context.Context, serverKey string, watches []protocol.LogWatch) (*protocol.LogWatchesSetResponse, error) {
+	if watches == nil {
+		watches = []protocol.LogWatch{}
+	}
+
+	msg := protocol.NewMessage(protocol.TypeSetLogWatches, protocol.LogWatchesPayload{Watches: watches})
+
+	return send[protocol.LogWatchesSetResponse](ctx, c, serverKey, msg, c.timeout, protocol.TypeLogWatchesSet)
+}
+
+// GetTopProcesses retrieves the processes of a server using the most CPU or memory
+func (c *Client) GetTopProcesses(ctx context.Context, serverKey string, sortBy protocol.ProcessSort, limit int) (*protocol.TopProcessesResponse, error) {
+	if limit <= 0 {
+		return nil, errors.NewValidationError("limit must be positive", map[string]interface{}{"limit": limit})
+	}
+
+	msg := protocol.NewMessage(protocol.TypeGetTopProcesses, protocol.GetTopProcessesPayload{
+		SortBy: sortBy,
+		Limit:  limit,
+	})
+
+	return send[protocol.TopProcessesResponse](ctx, c, serverKey, msg, c.timeout, protocol.TypeTopProcesses)
+}
+
+// PushSSHKey authorizes an SSH public key on a server. The key is not validated here,
+// callers must check it first.
+func (c *Client) PushSSHKey(ctx context.Context, serverKey, key, fingerprint string) (*protocol.SSHKeyPushedResponse, error) {
+	if key == "" {
+		return nil, errors.NewRequiredFieldError("key")
+	}
+
+	msg := protocol.NewMessage(protocol.TypePushSSHKey, protocol.PushSSHKeyPayload{
+		Key:         key,
+		Fingerprint: fingerprint,
+	})
+
+	return send[protocol.SSHKeyPushedResponse](ctx, c, serverKey, msg, c.timeout, protocol.TypeSSHKeyPushed)
+}
+
+// send sends a command and decodes the response payload of the expected type
+func send[T any](ctx context.Context, c *Client, serverKey string, msg *protocol.Message, timeout time.Duration, expected protocol.MessageType) (out *T, err error) {
+	sendCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	op := c.track(ctx, serverKey, msg, cancel)
+
+	started := time.Now()
+	resp, err := c.agent.SendCommand(sendCtx, serverKey, msg)
+	if c.recorder != nil {
+		defer func() {
+			c.recorder.RecordExchange(ctx, serverKey, msg, resp, time.Since(started), err)
+		}()
+	}
+	if op != nil && c.untrack(op) {
+		// The command was cancelled or purged, a late result must not be reported
+		return nil, errors.NewCancelledError(fmt.Sprintf("agent command '%s'", msg.Type))
+	}
+	if err != nil {
+		if sendCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil && msg.Type != protocol.TypeCancelCommand {
+			// Watchdog: the bot stopped waiting, so the agent should stop working on the command
+			go func() {
+				_, _ = c.cancelCommand(context.WithoutCancel(ctx), serverKey, msg.ID, "timed out")
+			}()
+		}
+		return nil, err
+	}
+
+	if resp.Type == protocol.TypeError {
+		agentErr, err := protocol.DecodePayload[protocol.ErrorPayload](resp)
+		if err != nil {
+			return nil, errors.NewExternalError("agent", "malformed error response", err)
+		}
+		return nil, errors.NewExternalError("agent", agentErr.Message, nil)
+	}
+
+	out, err = protocol.DecodeResponse[T](resp, expected)
+	if err != nil {
+		return nil, errors.NewExternalError("agent", err.Error(), err)
+	}
+
+	return out, nil
+}
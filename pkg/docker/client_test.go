@@ -0,0 +1,101 @@
+package docker_test
+
+import (
+	"context"
+	stderrors "errors"
+	"testing"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/testutil"
+	"github.com/servereye/servereyebot/pkg/docker"
+	"github.com/servereye/servereyebot/pkg/errors"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+func TestClientDecodesReplies(t *testing.T) {
+	agent := testutil.NewAgent()
+	agent.Reply(protocol.TypeGetAgentVersion, protocol.TypeAgentVersion, protocol.AgentVersionResponse{Version: "1.4.2"})
+	client := docker.NewClient(agent, nil, time.Second, time.Second)
+
+	resp, err := client.GetAgentVersion(context.Background(), "key-1")
+	if err != nil {
+		t.Fatalf("GetAgentVersion: %v", err)
+	}
+	if resp.Version != "1.4.2" {
+		t.Errorf("Version = %q, want %q", resp.Version, "1.4.2")
+	}
+
+	received := agent.Received()
+	if len(received) != 1 || received[0].ServerKey != "key-1" || received[0].Message.Type != protocol.TypeGetAgentVersion {
+		t.Errorf("agent received %+v, want one %s command for key-1", received, protocol.TypeGetAgentVersion)
+	}
+}
+
+func TestClientAgentErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(agent *testutil.Agent)
+		check func(err error) bool
+	}{
+		{
+			name: "error reply",
+			setup: func(agent *testutil.Agent) {
+				agent.Reply(protocol.TypeGetAgentVersion, protocol.TypeError, protocol.ErrorPayload{Message: "permission denied"})
+			},
+			check: func(err error) bool { return errors.IsErrorCode(err, errors.ErrCodeExternal) },
+		},
+		{
+			name: "unexpected reply type",
+			setup: func(agent *testutil.Agent) {
+				agent.Reply(protocol.TypeGetAgentVersion, protocol.TypeImagePulled, nil)
+			},
+			check: func(err error) bool { return errors.IsErrorCode(err, errors.ErrCodeExternal) },
+		},
+		{
+			name: "agent offline",
+			setup: func(agent *testutil.Agent) {
+				agent.Reply(protocol.TypeGetAgentVersion, protocol.TypeAgentVersion, protocol.AgentVersionResponse{})
+				agent.Fail("SendCommand", errAgentOffline)
+			},
+			check: func(err error) bool { return stderrors.Is(err, errAgentOffline) },
+		},
+		{
+			name: "agent too slow",
+			setup: func(agent *testutil.Agent) {
+				agent.Reply(protocol.TypeGetAgentVersion, protocol.TypeAgentVersion, protocol.AgentVersionResponse{})
+				agent.Delay(time.Second)
+			},
+			check: func(err error) bool { return stderrors.Is(err, context.DeadlineExceeded) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agent := testutil.NewAgent()
+			tt.setup(agent)
+			client := docker.NewClient(agent, nil, 20*time.Millisecond, time.Second)
+
+			resp, err := client.GetAgentVersion(context.Background(), "key-1")
+			if err == nil {
+				t.Fatalf("GetAgentVersion = %+v, want an error", resp)
+			}
+			if !tt.check(err) {
+				t.Errorf("GetAgentVersion error = %v (%T)", err, err)
+			}
+		})
+	}
+}
+
+func TestClientValidatesBeforeSending(t *testing.T) {
+	agent := testutil.NewAgent()
+	client := docker.NewClient(agent, nil, time.Second, time.Second)
+
+	if _, err := client.GetTopProcesses(context.Background(), "key-1", protocol.ProcessSortCPU, 0); !errors.IsErrorCode(err, errors.ErrCodeValidation) {
+		t.Errorf("GetTopProcesses error = %v, want a validation error", err)
+	}
+	if calls := agent.Calls("SendCommand"); calls != 0 {
+		t.Errorf("agent called %d times, want 0", calls)
+	}
+}
+
+var errAgentOffline = stderrors.New("agent offline")
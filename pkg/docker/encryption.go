@@ -0,0 +1,62 @@
+package docker
+
+import (
+	"context"
+	"database/sql"
+	stderrors "errors"
+
+	"github.com/servereye/servereyebot/pkg/errors"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// SecretStore looks up the end-to-end secrets of servers
+type SecretStore interface {
+	// GetServerSecret retrieves the secret of the server a key belongs to,
+	// sql.ErrNoRows when the server has none
+	GetServerSecret(ctx context.Context, key string) (string, error)
+}
+
+// EncryptedAgent encrypts command payloads end-to-end with a key derived from the secret
+// the server was given when it was paired. The server key is sent along with every command
+// to address it, so it must not be what the payload key is derived from: the transport
+// between the bot and the agent only sees envelopes.
+type EncryptedAgent struct {
+	agent   Agent
+	secrets SecretStore
+}
+
+// NewEncryptedAgent wraps agent with end-to-end payload encryption
+func NewEncryptedAgent(agent Agent, secrets SecretStore) *EncryptedAgent {
+	return &EncryptedAgent{agent: agent, secrets: secrets}
+}
+
+// SendCommand seals the command payload, sends it and opens the response.
+// Plaintext responses are rejected so a compromised transport can't downgrade the exchange,
+// and servers without a secret can't be sent commands until they are paired.
+func (a *EncryptedAgent) SendCommand(ctx context.Context, serverKey string, msg *protocol.Message) (*protocol.Message, error) {
+	secret, err := a.secrets.GetServerSecret(ctx, serverKey)
+	if err != nil {
+		if stderrors.Is(err, sql.ErrNoRows) {
+			return nil, errors.NewForbiddenError("server has no end-to-end secret, pair it again with /pair")
+		}
+		return nil, errors.NewInternalError("failed to look up server secret", err)
+	}
+	key := protocol.DeriveKey(secret)
+
+	sealed, err := msg.Seal(key)
+	if err != nil {
+		return nil, errors.NewInternalError("failed to encrypt command", err)
+	}
+
+	resp, err := a.agent.SendCommand(ctx, serverKey, sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	opened, err := resp.Open(key)
+	if err != nil {
+		return nil, errors.NewExternalError("agent", "failed to decrypt response", err)
+	}
+
+	return opened, nil
+}
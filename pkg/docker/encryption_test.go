@@ -0,0 +1,73 @@
+package docker_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/servereye/servereyebot/internal/testutil"
+	"github.com/servereye/servereyebot/pkg/docker"
+	"github.com/servereye/servereyebot/pkg/errors"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// secretStore holds end-to-end secrets by server key
+type secretStore map[string]string
+
+func (s secretStore) GetServerSecret(ctx context.Context, key string) (string, error) {
+	secret, ok := s[key]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	return secret, nil
+}
+
+func TestEncryptedAgent(t *testing.T) {
+	const serverKey = "srv_0123456789abcdef"
+	key := protocol.DeriveKey("paired-secret")
+
+	agent := testutil.NewAgent()
+	agent.Handle(protocol.TypeGetAgentVersion, func(serverKey string, msg *protocol.Message) (*protocol.Message, error) {
+		if _, err := msg.Open(key); err != nil {
+			return nil, err
+		}
+		return protocol.NewReply(msg, protocol.TypeAgentVersion, protocol.AgentVersionResponse{Version: "1.4.2"}).Seal(key)
+	})
+	client := docker.NewClient(docker.NewEncryptedAgent(agent, secretStore{serverKey: "paired-secret"}), nil, time.Second, time.Second)
+
+	resp, err := client.GetAgentVersion(context.Background(), serverKey)
+	if err != nil {
+		t.Fatalf("GetAgentVersion: %v", err)
+	}
+	if resp.Version != "1.4.2" {
+		t.Errorf("Version = %q, want %q", resp.Version, "1.4.2")
+	}
+
+	// What travels with the server key can't be opened with it
+	sent := agent.Received()[0].Message
+	if !sent.Encrypted {
+		t.Fatal("command sent in plaintext")
+	}
+	if _, err := sent.Open(protocol.DeriveKey(serverKey)); err == nil {
+		t.Error("command opened with a key derived from the server key it was sent to")
+	}
+}
+
+func TestEncryptedAgentRejects(t *testing.T) {
+	agent := testutil.NewAgent()
+	agent.Reply(protocol.TypeGetAgentVersion, protocol.TypeAgentVersion, protocol.AgentVersionResponse{Version: "1.4.2"})
+	client := docker.NewClient(docker.NewEncryptedAgent(agent, secretStore{"srv_paired": "paired-secret"}), nil, time.Second, time.Second)
+
+	if _, err := client.GetAgentVersion(context.Background(), "srv_unpaired"); !errors.IsErrorCode(err, errors.ErrCodeForbidden) {
+		t.Errorf("GetAgentVersion of a server without a secret = %v, want a forbidden error", err)
+	}
+	if received := agent.Received(); len(received) != 0 {
+		t.Errorf("agent received %d commands for a server without a secret, want none", len(received))
+	}
+
+	// A plaintext reply is a downgrade
+	if _, err := client.GetAgentVersion(context.Background(), "srv_paired"); !errors.IsErrorCode(err, errors.ErrCodeExternal) {
+		t.Errorf("GetAgentVersion answered in plaintext = %v, want an external error", err)
+	}
+}
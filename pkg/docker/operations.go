@@ -0,0 +1,232 @@
+package docker
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"time"
+
+	"github.com/servereye/servereyebot/pkg/errors"
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// operationContextKey is the context key of the operation commands belong to
+type operationContextKey struct{}
+
+// operationRef represents the operation a context was tracked with
+type operationRef struct {
+	id    string
+	owner int64
+	label string
+}
+
+// requestContextKey is the context key of the user request commands are sent for
+type requestContextKey struct{}
+
+// requestRef represents the chat and user a context was attributed to with WithRequest
+type requestRef struct {
+	chatID     int64
+	telegramID int64
+}
+
+// Operation represents a command in flight. Commands sent with a context of Track are
+// operations their owner can cancel, other commands have no owner and label.
+type Operation struct {
+	ID        string
+	Owner     int64  // Telegram ID of the user who started the operation, 0 for untracked commands
+	Label     string // human readable description, e.g. "docker compose up web"
+	ServerKey string
+	MessageID string
+	Type      protocol.MessageType
+	Started   time.Time
+	ChatID    int64 // chat the command was requested in, 0 when not sent for a request
+	Requester int64 // Telegram ID of the user whose request sent the command
+
+	cancel    context.CancelFunc
+	cancelled bool
+}
+
+// Track returns a context whose commands can be cancelled with Cancel while they wait
+// for the agent, together with the ID of the operation
+func Track(ctx context.Context, owner int64, label string) (context.Context, string) {
+	id := newOperationID()
+	if id == "" {
+		return ctx, ""
+	}
+	return context.WithValue(ctx, operationContextKey{}, operationRef{id: id, owner: owner, label: label}), id
+}
+
+// WithRequest returns a context attributing the commands sent with it to the request of
+// a user in a chat, so that CancelRequests can cancel them
+func WithRequest(ctx context.Context, chatID, telegramID int64) context.Context {
+	return context.WithValue(ctx, requestContextKey{}, requestRef{chatID: chatID, telegramID: telegramID})
+}
+
+// newOperationID returns a random operation ID, empty when randomness is unavailable
+func newOperationID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// Operation returns a tracked operation that is still waiting for the agent
+func (c *Client) Operation(id string) (Operation, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	op, ok := c.operations[id]
+	if !ok {
+		return Operation{}, false
+	}
+	return *op, true
+}
+
+// Cancel cancels a tracked operation. The caller waiting for the command gets a
+// cancelled error right away, then the agent is asked to stop the command; its reply
+// carries the output produced until then.
+func (c *Client) Cancel(ctx context.Context, id string) (*protocol.CommandCancelledResponse, error) {
+	c.mu.Lock()
+	op, ok := c.operations[id]
+	if ok {
+		op.cancelled = true
+		delete(c.operations, id)
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		return nil, errors.NewNotFoundError("operation")
+	}
+
+	op.cancel()
+	return c.cancelCommand(ctx, op.ServerKey, op.MessageID, "cancelled by user")
+}
+
+// CancelRequests cancels the commands of the requests of a user in a chat that still
+// wait for the agent and returns them. Their callers get a cancelled error right away and
+// the agents are asked in the background to drop the commands.
+func (c *Client) CancelRequests(ctx context.Context, chatID, telegramID int64) []Operation {
+	c.mu.Lock()
+	var cancelled []*Operation
+	for id, op := range c.operations {
+		if op.ChatID == chatID && op.Requester == telegramID {
+			op.cancelled = true
+			delete(c.operations, id)
+			cancelled = append(cancelled, op)
+		}
+	}
+	c.mu.Unlock()
+
+	result := make([]Operation, 0, len(cancelled))
+	for _, op := range cancelled {
+		op.cancel()
+		go func(op *Operation) {
+			_, _ = c.cancelCommand(context.WithoutCancel(ctx), op.ServerKey, op.MessageID, "cancelled by user")
+		}(op)
+		result = append(result, *op)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Started.Before(result[j].Started) })
+	return result
+}
+
+// Pending returns the commands sent to the agent of a server that are still waiting
+// for its response, oldest first
+func (c *Client) Pending(serverKey string) []Operation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var pending []Operation
+	for _, op := range c.operations {
+		if op.ServerKey == serverKey {
+			pending = append(pending, *op)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Started.Before(pending[j].Started) })
+	return pending
+}
+
+// Purge stops waiting for the commands sent to the agent of a server longer than
+// olderThan ago and returns them. Their callers get a cancelled error right away and the
+// agent is asked in the background to stop working on them.
+func (c *Client) Purge(ctx context.Context, serverKey string, olderThan time.Duration, now time.Time) []Operation {
+	c.mu.Lock()
+	var purged []*Operation
+	for id, op := range c.operations {
+		if op.ServerKey == serverKey && now.Sub(op.Started) >= olderThan {
+			op.cancelled = true
+			delete(c.operations, id)
+			purged = append(purged, op)
+		}
+	}
+	c.mu.Unlock()
+
+	result := make([]Operation, 0, len(purged))
+	for _, op := range purged {
+		op.cancel()
+		go func(op *Operation) {
+			_, _ = c.cancelCommand(context.WithoutCancel(ctx), op.ServerKey, op.MessageID, "purged as stale")
+		}(op)
+		result = append(result, *op)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Started.Before(result[j].Started) })
+	return result
+}
+
+// track registers a command in flight. Commands of contexts without an operation get an
+// operation without owner, so that Pending shows every command the agent has not answered.
+func (c *Client) track(ctx context.Context, serverKey string, msg *protocol.Message, cancel context.CancelFunc) *Operation {
+	ref, ok := ctx.Value(operationContextKey{}).(operationRef)
+	if ok && ref.id == "" {
+		return nil // explicitly untracked, such as cancellations
+	}
+	if !ok {
+		if ref.id = newOperationID(); ref.id == "" {
+			return nil
+		}
+	}
+
+	op := &Operation{
+		ID:        ref.id,
+		Owner:     ref.owner,
+		Label:     ref.label,
+		ServerKey: serverKey,
+		MessageID: msg.ID,
+		Type:      msg.Type,
+		Started:   time.Now(),
+		cancel:    cancel,
+	}
+	if request, ok := ctx.Value(requestContextKey{}).(requestRef); ok {
+		op.ChatID, op.Requester = request.chatID, request.telegramID
+	}
+
+	c.mu.Lock()
+	c.operations[op.ID] = op
+	c.mu.Unlock()
+	return op
+}
+
+// untrack removes a completed command, reporting whether it was cancelled meanwhile
+func (c *Client) untrack(op *Operation) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.operations[op.ID] == op {
+		delete(c.operations, op.ID)
+	}
+	return op.cancelled
+}
+
+// cancelCommand asks the agent to stop a command it may still be running
+func (c *Client) cancelCommand(ctx context.Context, serverKey, messageID, reason string) (*protocol.CommandCancelledResponse, error) {
+	msg := protocol.NewMessage(protocol.TypeCancelCommand, protocol.CancelCommandPayload{
+		MessageID: messageID,
+		Reason:    reason,
+	})
+
+	// The cancellation itself is never tracked, even when ctx belongs to an operation
+	ctx = context.WithValue(ctx, operationContextKey{}, operationRef{})
+
+	return send[protocol.CommandCancelledResponse](ctx, c, serverKey, msg, c.timeout, protocol.TypeCommandCancelled)
+}
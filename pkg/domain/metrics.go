@@ -43,6 +43,7 @@ type NewServerMetrics struct {
 	ProcessesRunning   int                   `json:"processes_running"`
 	ProcessesSleeping  int                   `json:"processes_sleeping"`
 	ProcessesTotal     int                   `json:"processes_total"`
+	ProcessNames       []string              `json:"process_names,omitempty"` // running processes, reported by agents supporting process watches
 	TemperatureCelsius float64               `json:"temperature_celsius"`
 	Temperatures       NewTemperatureDetails `json:"temperatures"`
 	Timestamp          string                `json:"timestamp"`
@@ -235,31 +236,34 @@ type NetworkInterfaceExtended struct {
 
 // TemperatureDetails represents temperature information
 type TemperatureDetails struct {
-	CPUTemperature     float64 `json:"cpu_temperature"`
-	GPUTemperature     float64 `json:"gpu_temperature"`
-	SystemTemperature  float64 `json:"system_temperature"`
-	HighestTemperature float64 `json:"highest_temperature"`
-	TemperatureUnit    string  `json:"temperature_unit"`
+	CPUTemperature     float64              `json:"cpu_temperature"`
+	GPUTemperature     float64              `json:"gpu_temperature"`
+	SystemTemperature  float64              `json:"system_temperature"`
+	HighestTemperature float64              `json:"highest_temperature"`
+	TemperatureUnit    string               `json:"temperature_unit"`
+	Storage            []StorageTemperature `json:"storage,omitempty"`
 }
 
 // SystemDetails represents detailed system information
 type SystemDetails struct {
-	Hostname          string `json:"hostname"`
-	OS                string `json:"os"`
-	Kernel            string `json:"kernel"`
-	Architecture      string `json:"architecture"`
-	UptimeSeconds     int    `json:"uptime_seconds"`
-	UptimeHuman       string `json:"uptime_human"`
-	ProcessesTotal    int    `json:"processes_total"`
-	ProcessesRunning  int    `json:"processes_running"`
-	ProcessesSleeping int    `json:"processes_sleeping"`
+	Hostname          string   `json:"hostname"`
+	OS                string   `json:"os"`
+	Kernel            string   `json:"kernel"`
+	Architecture      string   `json:"architecture"`
+	UptimeSeconds     int      `json:"uptime_seconds"`
+	UptimeHuman       string   `json:"uptime_human"`
+	ProcessesTotal    int      `json:"processes_total"`
+	ProcessesRunning  int      `json:"processes_running"`
+	ProcessesSleeping int      `json:"processes_sleeping"`
+	ProcessNames      []string `json:"process_names,omitempty"` // nil when the agent does not report processes
 }
 
-// MetricsCache represents cached metrics with TTL
+// MetricsCache represents cached metrics. They expire by the TTL of the metric type
+// they are shown for, so only the fetch time is kept.
 type MetricsCache struct {
-	ServerKey string
-	Metrics   *LegacyMetricsResponse
-	ExpiresAt time.Time
+	ServerKey string                 `json:"server_key"`
+	Metrics   *LegacyMetricsResponse `json:"metrics"`
+	FetchedAt time.Time              `json:"fetched_at"`
 }
 
 // MetricsFormatter defines interface for formatting metrics for display
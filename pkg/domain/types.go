@@ -82,13 +82,21 @@ type MetricsService interface {
 // TelegramService defines the interface for Telegram operations
 type TelegramService interface {
 	SendMessage(ctx context.Context, chatID int64, text string) error
+	SendSilentMessage(ctx context.Context, chatID int64, text string, keyboard interface{}) error
 	SendMessageWithKeyboard(ctx context.Context, chatID int64, text string, keyboard interface{}) error
+	SendMarkdown(ctx context.Context, chatID int64, text string, keyboard interface{}) error
+	SendMarkdownMessage(ctx context.Context, chatID int64, text string, keyboard interface{}) (int, error) // returns the message ID
+	SendCode(ctx context.Context, chatID int64, code, language string) error
+	SendDocument(ctx context.Context, chatID int64, fileName string, data []byte, caption string) error
+	DownloadFile(ctx context.Context, fileID string, maxSize int64) ([]byte, error)
 	StartReceivingUpdates(ctx context.Context, handler interface{}) error
 	StopReceivingUpdates()
 	AnswerCallback(ctx context.Context, callbackID, text string) error
 	AnswerCallbackQuery(ctx context.Context, callbackID, text string) error
 	EditMessage(ctx context.Context, chatID int64, messageID int, text string, keyboard interface{}) error
+	EditMarkdown(ctx context.Context, chatID int64, messageID int, text string, keyboard interface{}) error
 	SetCommands(ctx context.Context, commands []BotCommand) error
+	AnswerInlineQuery(ctx context.Context, queryID string, answer InlineAnswer) error
 }
 
 // BotCommand represents a Telegram bot command
@@ -97,6 +105,22 @@ type BotCommand struct {
 	Description string `json:"description"`
 }
 
+// InlineResult represents a card offered in reply to an inline query
+type InlineResult struct {
+	ID          string
+	Title       string
+	Description string
+	Text        string // message sent to the chat when the card is chosen
+	Markdown    bool   // Text is in MarkdownV2
+}
+
+// InlineAnswer represents the reply to an inline query
+type InlineAnswer struct {
+	Results    []InlineResult
+	CacheTime  time.Duration
+	SwitchText string // shown above the results as a button opening a private chat with the bot
+}
+
 // UserService defines the interface for user management
 type UserService interface {
 	IsAdmin(userID int64) bool
@@ -1,6 +1,7 @@
 package errors
 
 import (
+	stderrors "errors"
 	"fmt"
 	"net/http"
 )
@@ -18,6 +19,9 @@ const (
 	ErrCodeUnauthorized ErrorCode = "UNAUTHORIZED"
 	ErrCodeForbidden    ErrorCode = "FORBIDDEN"
 
+	// HTTP API errors
+	ErrCodeMethodNotAllowed ErrorCode = "METHOD_NOT_ALLOWED"
+
 	// Business logic errors
 	ErrCodeNotFound      ErrorCode = "NOT_FOUND"
 	ErrCodeConflict      ErrorCode = "CONFLICT"
@@ -28,6 +32,7 @@ const (
 	ErrCodeExternal    ErrorCode = "EXTERNAL_ERROR"
 	ErrCodeTimeout     ErrorCode = "TIMEOUT"
 	ErrCodeUnavailable ErrorCode = "UNAVAILABLE"
+	ErrCodeCancelled   ErrorCode = "CANCELLED"
 
 	// Telegram specific errors
 	ErrCodeTelegramAPI ErrorCode = "TELEGRAM_API_ERROR"
@@ -39,6 +44,19 @@ const (
 	ErrCodePermissionDenied   ErrorCode = "PERMISSION_DENIED"
 )
 
+// Sentinel errors of the ServerEye API client and the user service. Errors wrapping them
+// match with errors.Is, so callers need not inspect their messages.
+var (
+	// ErrServerNotFound is matched by errors of servers the ServerEye API does not know
+	ErrServerNotFound = stderrors.New("server not found")
+
+	// ErrInvalidKey is matched by errors of malformed server keys
+	ErrInvalidKey = stderrors.New("invalid server key")
+
+	// ErrAPIUnavailable is matched by errors of requests the ServerEye API failed to answer
+	ErrAPIUnavailable = stderrors.New("ServerEye API unavailable")
+)
+
 // AppError represents application error with context
 type AppError struct {
 	Code       ErrorCode              `json:"code"`
@@ -109,6 +127,20 @@ func NewNotFoundError(resource string) *AppError {
 	}
 }
 
+// NewServerNotFoundError creates a not found error of a server key, matching ErrServerNotFound
+func NewServerNotFoundError(serverKey string) *AppError {
+	err := NewNotFoundError(fmt.Sprintf("server with key '%s'", serverKey))
+	err.Cause = ErrServerNotFound
+	return err
+}
+
+// NewInvalidKeyError creates a validation error of a server key, matching ErrInvalidKey
+func NewInvalidKeyError(message string, details map[string]interface{}) *AppError {
+	err := NewValidationError(message, details)
+	err.Cause = ErrInvalidKey
+	return err
+}
+
 // NewInternalError creates a new internal error
 func NewInternalError(message string, cause error) *AppError {
 	return &AppError{
@@ -130,6 +162,46 @@ func NewExternalError(service, message string, cause error) *AppError {
 	}
 }
 
+// NewAPIUnavailableError creates an external error of a failed ServerEye API request,
+// matching ErrAPIUnavailable as well as cause
+func NewAPIUnavailableError(message string, cause error) *AppError {
+	wrapped := ErrAPIUnavailable
+	if cause != nil {
+		wrapped = fmt.Errorf("%w: %w", ErrAPIUnavailable, cause)
+	}
+	return NewExternalError("ServerEye API", message, wrapped)
+}
+
+// NewTimeoutError creates a new timeout error
+func NewTimeoutError(operation string, cause error) *AppError {
+	return &AppError{
+		Code:       ErrCodeTimeout,
+		Message:    fmt.Sprintf("%s timed out", operation),
+		HTTPStatus: http.StatusGatewayTimeout,
+		Cause:      cause,
+		Details:    map[string]interface{}{"operation": operation},
+	}
+}
+
+// NewCancelledError creates a new error of an operation cancelled by the user
+func NewCancelledError(operation string) *AppError {
+	return &AppError{
+		Code:       ErrCodeCancelled,
+		Message:    fmt.Sprintf("%s cancelled", operation),
+		HTTPStatus: 499, // client closed request, as reported by nginx
+		Details:    map[string]interface{}{"operation": operation},
+	}
+}
+
+// NewRateLimitError creates a new rate limit error
+func NewRateLimitError(message string) *AppError {
+	return &AppError{
+		Code:       ErrCodeRateLimit,
+		Message:    message,
+		HTTPStatus: http.StatusTooManyRequests,
+	}
+}
+
 // NewTelegramAPIError creates a new Telegram API error
 func NewTelegramAPIError(message string, cause error) *AppError {
 	return &AppError{
@@ -151,17 +223,19 @@ func NewMetricsUnavailableError(metric string, cause error) *AppError {
 	}
 }
 
-// IsErrorCode checks if error matches specific error code
+// IsErrorCode checks if error, or an error it wraps, matches specific error code
 func IsErrorCode(err error, code ErrorCode) bool {
-	if appErr, ok := err.(*AppError); ok {
+	var appErr *AppError
+	if stderrors.As(err, &appErr) {
 		return appErr.Code == code
 	}
 	return false
 }
 
-// GetErrorCode extracts error code from error
+// GetErrorCode extracts error code from error or an error it wraps
 func GetErrorCode(err error) ErrorCode {
-	if appErr, ok := err.(*AppError); ok {
+	var appErr *AppError
+	if stderrors.As(err, &appErr) {
 		return appErr.Code
 	}
 	return ErrCodeInternal
@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// DefaultGPUTimeout bounds a single nvidia-smi run
+const DefaultGPUTimeout = 10 * time.Second
+
+// gpuQueryFields are the nvidia-smi --query-gpu fields the collector reads, in the order
+// of the columns ParseNvidiaSMI expects
+var gpuQueryFields = []string{
+	"index",
+	"name",
+	"uuid",
+	"driver_version",
+	"utilization.gpu",
+	"memory.used",
+	"memory.total",
+	"temperature.gpu",
+	"power.draw",
+	"power.limit",
+}
+
+// GPUCollector reports the utilization, memory, temperature and power draw of the NVIDIA
+// GPUs of a host by running nvidia-smi. Hosts without it report no GPUs rather than an error.
+type GPUCollector struct {
+	path    string
+	timeout time.Duration
+	run     func(ctx context.Context, name string, args ...string) ([]byte, error)
+}
+
+// NewGPUCollector creates a collector running the nvidia-smi binary at path, "nvidia-smi"
+// when empty. Each run is bounded by timeout, DefaultGPUTimeout when zero.
+func NewGPUCollector(path string, timeout time.Duration) *GPUCollector {
+	if path == "" {
+		path = "nvidia-smi"
+	}
+	if timeout <= 0 {
+		timeout = DefaultGPUTimeout
+	}
+	return &GPUCollector{
+		path:    path,
+		timeout: timeout,
+		run:     runCommand,
+	}
+}
+
+// Collect reads the GPUs of the host. A host without nvidia-smi, or whose driver has no
+// GPU to manage, is reported as unavailable.
+func (c *GPUCollector) Collect(ctx context.Context) (*protocol.GPUResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	out, err := c.run(ctx, c.path, "--query-gpu="+strings.Join(gpuQueryFields, ","), "--format=csv,noheader,nounits")
+	if errors.Is(err, exec.ErrNotFound) {
+		return &protocol.GPUResponse{}, nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		// nvidia-smi exits with 9 when the driver is not loaded and 6 when no GPU is found
+		if code := exitErr.ExitCode(); code == 6 || code == 9 {
+			return &protocol.GPUResponse{}, nil
+		}
+	}
+	if err != nil {
+		if message := strings.TrimSpace(string(out)); message != "" {
+			return nil, fmt.Errorf("nvidia-smi failed: %w: %s", err, message)
+		}
+		return nil, fmt.Errorf("nvidia-smi failed: %w", err)
+	}
+
+	return ParseNvidiaSMI(out)
+}
+
+// ParseNvidiaSMI parses the output of nvidia-smi --query-gpu with the fields of
+// gpuQueryFields in --format=csv,noheader,nounits
+func ParseNvidiaSMI(data []byte) (*protocol.GPUResponse, error) {
+	reader := csv.NewReader(strings.NewReader(string(data)))
+	reader.FieldsPerRecord = len(gpuQueryFields)
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse nvidia-smi output: %w", err)
+	}
+
+	response := &protocol.GPUResponse{GPUs: make([]protocol.GPUDevice, 0, len(records))}
+	for _, record := range records {
+		index, err := strconv.Atoi(strings.TrimSpace(record[0]))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse GPU index %q: %w", record[0], err)
+		}
+		if response.Driver == "" {
+			response.Driver = strings.TrimSpace(record[3])
+		}
+
+		response.GPUs = append(response.GPUs, protocol.GPUDevice{
+			Index:         index,
+			Name:          strings.TrimSpace(record[1]),
+			UUID:          strings.TrimSpace(record[2]),
+			Utilization:   nvidiaSMIReading(record[4]),
+			MemoryUsedMB:  nvidiaSMIReading(record[5]),
+			MemoryTotalMB: nvidiaSMIReading(record[6]),
+			Temperature:   nvidiaSMIReading(record[7]),
+			PowerDrawW:    nvidiaSMIReading(record[8]),
+			PowerLimitW:   nvidiaSMIReading(record[9]),
+		})
+	}
+
+	response.Available = len(response.GPUs) > 0
+	return response, nil
+}
+
+// nvidiaSMIReading parses a numeric nvidia-smi reading, -1 for readings the GPU does not
+// support such as "[N/A]" or "[Not Supported]"
+func nvidiaSMIReading(field string) float64 {
+	value, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+	if err != nil {
+		return -1
+	}
+	return value
+}
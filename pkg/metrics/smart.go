@@ -0,0 +1,216 @@
+// Package metrics collects host metrics on behalf of agents. Collectors return the
+// protocol types the bot expects in agent responses.
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// SMART attributes of ATA drives reported by the collector
+const (
+	smartAttrReallocated   = 5
+	smartAttrPending       = 197
+	smartAttrUncorrectable = 198
+)
+
+// smartctl exit status bits meaning its output cannot be used. Other bits report the
+// health of the drive, e.g. bit 3 for a failing self-assessment.
+const smartctlUnusable = 1<<0 | 1<<1
+
+// DefaultSMARTTimeout bounds a single smartctl run
+const DefaultSMARTTimeout = 30 * time.Second
+
+// SMARTCollector reports the SMART health of the drives of a host by running smartctl,
+// which needs smartmontools 7.0 or later for JSON output and usually root privileges
+type SMARTCollector struct {
+	path    string
+	timeout time.Duration
+	run     func(ctx context.Context, name string, args ...string) ([]byte, error)
+}
+
+// NewSMARTCollector creates a collector running the smartctl binary at path, "smartctl"
+// when empty. Each run is bounded by timeout, DefaultSMARTTimeout when zero.
+func NewSMARTCollector(path string, timeout time.Duration) *SMARTCollector {
+	if path == "" {
+		path = "smartctl"
+	}
+	if timeout <= 0 {
+		timeout = DefaultSMARTTimeout
+	}
+	return &SMARTCollector{
+		path:    path,
+		timeout: timeout,
+		run:     runCommand,
+	}
+}
+
+// Collect scans the drives of the host and reads their health. A drive that cannot be
+// read is reported with its error rather than failing the whole collection.
+func (c *SMARTCollector) Collect(ctx context.Context) (*protocol.SMARTResponse, error) {
+	out, err := c.smartctl(ctx, "--scan-open", "--json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan drives: %w", err)
+	}
+
+	var scan struct {
+		Devices []struct {
+			Name string `json:"name"`
+			Type string `json:"type"`
+		} `json:"devices"`
+	}
+	if err := json.Unmarshal(out, &scan); err != nil {
+		return nil, fmt.Errorf("failed to parse smartctl scan: %w", err)
+	}
+
+	response := &protocol.SMARTResponse{Drives: make([]protocol.SMARTDrive, 0, len(scan.Devices))}
+	for _, device := range scan.Devices {
+		args := []string{"--json", "--info", "--health", "--attributes"}
+		if device.Type != "" {
+			args = append(args, "--device", device.Type)
+		}
+
+		out, err := c.smartctl(ctx, append(args, device.Name)...)
+		if err == nil {
+			var drive protocol.SMARTDrive
+			if drive, err = ParseSmartctl(out); err == nil {
+				response.Drives = append(response.Drives, drive)
+				continue
+			}
+		}
+
+		response.Drives = append(response.Drives, protocol.SMARTDrive{
+			Device:               device.Name,
+			Type:                 device.Type,
+			ReallocatedSectors:   -1,
+			PendingSectors:       -1,
+			UncorrectableSectors: -1,
+			Error:                err.Error(),
+		})
+	}
+
+	return response, nil
+}
+
+// smartctl runs smartctl and returns its output when usable
+func (c *SMARTCollector) smartctl(ctx context.Context, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	out, err := c.run(ctx, c.path, args...)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode()&smartctlUnusable == 0 {
+		return out, nil
+	}
+	if err != nil {
+		if message := strings.TrimSpace(string(out)); message != "" && !json.Valid(out) {
+			return nil, fmt.Errorf("%w: %s", err, message)
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+// runCommand runs a command and returns its standard output
+func runCommand(ctx context.Context, name string, args ...string) ([]byte, error) {
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &stdout
+	err := cmd.Run()
+	return stdout.Bytes(), err
+}
+
+// smartctlOutput represents the fields of smartctl --json output the collector reads
+type smartctlOutput struct {
+	Device struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+	} `json:"device"`
+	ModelName    string `json:"model_name"`
+	SerialNumber string `json:"serial_number"`
+	SmartStatus  *struct {
+		Passed bool `json:"passed"`
+	} `json:"smart_status"`
+	Temperature struct {
+		Current int `json:"current"`
+	} `json:"temperature"`
+	PowerOnTime struct {
+		Hours int64 `json:"hours"`
+	} `json:"power_on_time"`
+	ATASmartAttributes *struct {
+		Table []struct {
+			ID  int `json:"id"`
+			Raw struct {
+				Value int64 `json:"value"`
+			} `json:"raw"`
+		} `json:"table"`
+	} `json:"ata_smart_attributes"`
+	NVMeHealth *struct {
+		MediaErrors int64 `json:"media_errors"`
+	} `json:"nvme_smart_health_information_log"`
+	Smartctl struct {
+		Messages []struct {
+			String   string `json:"string"`
+			Severity string `json:"severity"`
+		} `json:"messages"`
+	} `json:"smartctl"`
+}
+
+// ParseSmartctl parses the output of smartctl --json --info --health --attributes for a
+// single drive
+func ParseSmartctl(data []byte) (protocol.SMARTDrive, error) {
+	var out smartctlOutput
+	if err := json.Unmarshal(data, &out); err != nil {
+		return protocol.SMARTDrive{}, fmt.Errorf("failed to parse smartctl output: %w", err)
+	}
+
+	if out.SmartStatus == nil {
+		for _, message := range out.Smartctl.Messages {
+			if message.Severity == "error" {
+				return protocol.SMARTDrive{}, errors.New(message.String)
+			}
+		}
+		return protocol.SMARTDrive{}, errors.New("drive does not report SMART health")
+	}
+
+	drive := protocol.SMARTDrive{
+		Device:               out.Device.Name,
+		Type:                 out.Device.Type,
+		Model:                strings.TrimSpace(out.ModelName),
+		Serial:               strings.TrimSpace(out.SerialNumber),
+		Passed:               out.SmartStatus.Passed,
+		ReallocatedSectors:   -1,
+		PendingSectors:       -1,
+		UncorrectableSectors: -1,
+		Temperature:          out.Temperature.Current,
+		PowerOnHours:         out.PowerOnTime.Hours,
+	}
+
+	if out.ATASmartAttributes != nil {
+		for _, attr := range out.ATASmartAttributes.Table {
+			// Raw values of some vendors pack extra counters into the upper bytes
+			value := attr.Raw.Value & 0xffffffff
+			switch attr.ID {
+			case smartAttrReallocated:
+				drive.ReallocatedSectors = value
+			case smartAttrPending:
+				drive.PendingSectors = value
+			case smartAttrUncorrectable:
+				drive.UncorrectableSectors = value
+			}
+		}
+	}
+	if out.NVMeHealth != nil {
+		drive.UncorrectableSectors = out.NVMeHealth.MediaErrors
+	}
+
+	return drive, nil
+}
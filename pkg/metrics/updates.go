@@ -0,0 +1,298 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// Package managers supported by the updates collector
+const (
+	ManagerAPT = "apt"
+	ManagerDNF = "dnf"
+	ManagerYUM = "yum"
+)
+
+// DefaultUpdatesTimeout bounds a single package manager run
+const DefaultUpdatesTimeout = 10 * time.Minute
+
+// maxUpdatesOutput bounds the package manager output returned after installing updates
+const maxUpdatesOutput = 4000
+
+// aptRebootRequired is created by Debian and Ubuntu packages that need a reboot
+const aptRebootRequired = "/var/run/reboot-required"
+
+// ErrNoPackageManager is returned on hosts without apt, dnf or yum
+var ErrNoPackageManager = errors.New("no supported package manager found (apt, dnf or yum)")
+
+// UpdatesCollector reports pending OS package updates and installs security updates with
+// the package manager of the host. Listing works unprivileged, installing needs root.
+// Package lists are not refreshed, so results are as current as the last apt update or
+// dnf makecache run by the host, e.g. by unattended-upgrades or dnf-automatic.
+type UpdatesCollector struct {
+	timeout  time.Duration
+	lookPath func(file string) (string, error)
+	run      func(ctx context.Context, env []string, name string, args ...string) (stdout, stderr []byte, err error)
+	exists   func(path string) bool
+}
+
+// NewUpdatesCollector creates a collector whose package manager runs are bounded by
+// timeout, DefaultUpdatesTimeout when zero
+func NewUpdatesCollector(timeout time.Duration) *UpdatesCollector {
+	if timeout <= 0 {
+		timeout = DefaultUpdatesTimeout
+	}
+	return &UpdatesCollector{
+		timeout:  timeout,
+		lookPath: exec.LookPath,
+		run:      runPackageManager,
+		exists:   fileExists,
+	}
+}
+
+// Manager returns the package manager of the host
+func (c *UpdatesCollector) Manager() (string, error) {
+	for _, candidate := range []struct{ binary, manager string }{
+		{"apt-get", ManagerAPT},
+		{"dnf", ManagerDNF},
+		{"yum", ManagerYUM},
+	} {
+		if _, err := c.lookPath(candidate.binary); err == nil {
+			return candidate.manager, nil
+		}
+	}
+	return "", ErrNoPackageManager
+}
+
+// Collect lists the packages with pending updates, marking security updates
+func (c *UpdatesCollector) Collect(ctx context.Context) (*protocol.UpdatesResponse, error) {
+	manager, err := c.Manager()
+	if err != nil {
+		return nil, err
+	}
+
+	var packages []protocol.PackageUpdate
+	switch manager {
+	case ManagerAPT:
+		out, _, err := c.command(ctx, "apt", "list", "--upgradable")
+		if err != nil {
+			return nil, fmt.Errorf("failed to list upgradable packages: %w", err)
+		}
+		packages = ParseAptUpgradable(out)
+
+	default:
+		// check-update exits with 100 when updates are available
+		out, _, err := c.command(ctx, manager, "-q", "check-update")
+		var exitErr *exec.ExitError
+		if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 100) {
+			return nil, fmt.Errorf("failed to check for updates: %w", err)
+		}
+		packages = ParseCheckUpdate(out)
+
+		// Repositories without update metadata have no security advisories, which
+		// leaves every update unmarked rather than failing the collection
+		security := "--security"
+		if manager == ManagerYUM {
+			security = "security"
+		}
+		if out, _, err := c.command(ctx, manager, "-q", "updateinfo", "list", security); err == nil {
+			advised := ParseUpdateInfo(out)
+			for i := range packages {
+				packages[i].Security = advised[packages[i].Name]
+			}
+		}
+	}
+
+	return &protocol.UpdatesResponse{
+		Manager:        manager,
+		Packages:       packages,
+		RebootRequired: manager == ManagerAPT && c.exists(aptRebootRequired),
+	}, nil
+}
+
+// ApplySecurity installs the pending security updates and reports the upgraded packages
+func (c *UpdatesCollector) ApplySecurity(ctx context.Context) (*protocol.UpdatesAppliedResponse, error) {
+	updates, err := c.Collect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, pkg := range updates.Packages {
+		if pkg.Security {
+			names = append(names, pkg.Name)
+		}
+	}
+	applied := &protocol.UpdatesAppliedResponse{Manager: updates.Manager, Upgraded: []string{}, RebootRequired: updates.RebootRequired}
+	if len(names) == 0 {
+		return applied, nil
+	}
+
+	var stdout, stderr []byte
+	switch updates.Manager {
+	case ManagerAPT:
+		// Upgrading only the listed packages leaves other pending updates alone, and keeping
+		// the current configuration files never stops on a prompt
+		args := append([]string{"install", "--only-upgrade", "-y", "-o", "Dpkg::Options::=--force-confold"}, names...)
+		stdout, stderr, err = c.command(ctx, "apt-get", args...)
+	default:
+		stdout, stderr, err = c.command(ctx, updates.Manager, "-y", "upgrade", "--security")
+	}
+
+	applied.Output = tail(string(append(stdout, stderr...)), maxUpdatesOutput)
+	if err != nil {
+		return nil, fmt.Errorf("failed to install security updates: %w: %s", err, tail(string(stderr), 500))
+	}
+
+	applied.Upgraded = names
+	applied.RebootRequired = updates.Manager == ManagerAPT && c.exists(aptRebootRequired)
+	return applied, nil
+}
+
+// command runs the package manager non-interactively with untranslated output
+func (c *UpdatesCollector) command(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	env := append(os.Environ(), "LC_ALL=C", "DEBIAN_FRONTEND=noninteractive")
+	return c.run(ctx, env, name, args...)
+}
+
+// runPackageManager runs a command and returns its standard output and error
+func runPackageManager(ctx context.Context, env []string, name string, args ...string) ([]byte, []byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = env
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	return stdout.Bytes(), stderr.Bytes(), err
+}
+
+// fileExists reports whether a file exists
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// tail returns the last max bytes of s, cut at a line start
+func tail(s string, max int) string {
+	s = strings.TrimSpace(s)
+	if len(s) <= max {
+		return s
+	}
+	s = s[len(s)-max:]
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[i+1:]
+	}
+	return s
+}
+
+// ParseAptUpgradable parses the output of apt list --upgradable, e.g.
+//
+//	openssl/jammy-updates,jammy-security 3.0.2-0ubuntu1.12 amd64 [upgradable from: 3.0.2-0ubuntu1.10]
+//
+// Updates from a -security suite are security updates.
+func ParseAptUpgradable(data []byte) []protocol.PackageUpdate {
+	var packages []protocol.PackageUpdate
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		name, suites, ok := strings.Cut(fields[0], "/")
+		if !ok {
+			continue // "Listing..." header
+		}
+
+		pkg := protocol.PackageUpdate{Name: name, NewVersion: fields[1]}
+		for _, suite := range strings.Split(suites, ",") {
+			pkg.Security = pkg.Security || strings.HasSuffix(suite, "-security")
+		}
+		if i := strings.Index(scanner.Text(), "[upgradable from: "); i >= 0 {
+			pkg.CurrentVersion = strings.TrimSuffix(scanner.Text()[i+len("[upgradable from: "):], "]")
+		}
+		packages = append(packages, pkg)
+	}
+	return packages
+}
+
+// ParseCheckUpdate parses the output of dnf or yum check-update, e.g.
+//
+//	openssl-libs.x86_64    1:3.0.7-25.el9_3    baseos
+//
+// Packages listed as obsoleting others are skipped since they repeat updates.
+func ParseCheckUpdate(data []byte) []protocol.PackageUpdate {
+	var packages []protocol.PackageUpdate
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "Obsoleting Packages") {
+			break
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 || strings.HasPrefix(line, " ") {
+			continue
+		}
+		dot := strings.LastIndexByte(fields[0], '.')
+		if dot <= 0 {
+			continue
+		}
+
+		name := fields[0][:dot]
+		if seen[name] {
+			continue // one line per architecture
+		}
+		seen[name] = true
+		packages = append(packages, protocol.PackageUpdate{Name: name, NewVersion: fields[1]})
+	}
+
+	sort.Slice(packages, func(i, j int) bool { return packages[i].Name < packages[j].Name })
+	return packages
+}
+
+// ParseUpdateInfo parses the output of dnf updateinfo list --security, e.g.
+//
+//	RHSA-2024:0310 Important/Sec. openssl-libs-1:3.0.7-25.el9_3.x86_64
+//
+// and returns the names of the packages with security advisories
+func ParseUpdateInfo(data []byte) map[string]bool {
+	names := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		if name := nevraName(fields[2]); name != "" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// nevraName returns the name of a package from its name-[epoch:]version-release.arch
+func nevraName(nevra string) string {
+	if dot := strings.LastIndexByte(nevra, '.'); dot > 0 {
+		nevra = nevra[:dot]
+	}
+	for i := 0; i < 2; i++ {
+		dash := strings.LastIndexByte(nevra, '-')
+		if dash <= 0 {
+			return ""
+		}
+		nevra = nevra[:dash]
+	}
+	return nevra
+}
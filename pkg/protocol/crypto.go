@@ -0,0 +1,121 @@
+package protocol
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// keyDerivationLabel binds derived keys to their purpose, so the server secret
+// itself is never used as a cipher key
+const keyDerivationLabel = "servereye-e2e-v1"
+
+// ErrNotEncrypted is returned when opening a message that carries a plaintext payload
+var ErrNotEncrypted = errors.New("message payload is not encrypted")
+
+// secretSize is the number of random bytes of an end-to-end secret
+const secretSize = 32
+
+// NewSecret generates the end-to-end secret of a server. It is handed to the agent when
+// the server is paired and must never travel with commands, unlike the server key that
+// addresses them.
+func NewSecret() (string, error) {
+	buf := make([]byte, secretSize)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate secret: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// DeriveKey derives the AES-256 key shared by the bot and the agent from the end-to-end
+// secret of a server, see NewSecret
+func DeriveKey(secret string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(keyDerivationLabel))
+	return mac.Sum(nil)
+}
+
+// Seal returns a copy of the message with its payload encrypted with key.
+// The envelope fields stay readable so intermediaries can still route the message,
+// while the message ID and type are authenticated together with the payload.
+func (m *Message) Seal(key []byte) (*Message, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := json.Marshal(m.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := *m
+	sealed.Encrypted = true
+	sealed.Payload = base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, m.additionalData()))
+	return &sealed, nil
+}
+
+// Open returns a copy of the message with its payload decrypted with key
+func (m *Message) Open(key []byte) (*Message, error) {
+	if !m.Encrypted {
+		return nil, ErrNotEncrypted
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, ok := m.Payload.(string)
+	if !ok {
+		return nil, errors.New("encrypted payload must be a string")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode encrypted payload: %w", err)
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("encrypted payload is too short")
+	}
+
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, m.additionalData())
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt payload: %w", err)
+	}
+
+	opened := *m
+	opened.Encrypted = false
+	opened.Payload = nil
+	if err := json.Unmarshal(plaintext, &opened.Payload); err != nil {
+		return nil, fmt.Errorf("failed to decode payload: %w", err)
+	}
+	return &opened, nil
+}
+
+// additionalData returns the envelope fields authenticated along with the payload
+func (m *Message) additionalData() []byte {
+	return []byte(m.ID + "|" + string(m.Type))
+}
+
+// newAEAD creates an AES-GCM cipher for key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,92 @@
+package protocol_test
+
+import (
+	"encoding/base64"
+	stderrors "errors"
+	"reflect"
+	"testing"
+
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+func TestSealOpen(t *testing.T) {
+	key := protocol.DeriveKey("s3cret")
+	msg := protocol.NewMessage(protocol.TypeComposeAction, map[string]interface{}{"project": "web", "action": "restart"})
+
+	sealed, err := msg.Seal(key)
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if !sealed.Encrypted || sealed.ID != msg.ID || sealed.Type != msg.Type {
+		t.Errorf("Seal = %+v, want an encrypted message keeping the envelope", sealed)
+	}
+	if _, ok := sealed.Payload.(string); !ok {
+		t.Fatalf("sealed payload is %T, want a string", sealed.Payload)
+	}
+
+	opened, err := sealed.Open(key)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if opened.Encrypted || !reflect.DeepEqual(opened.Payload, msg.Payload) {
+		t.Errorf("Open = %+v, want the payload %v", opened, msg.Payload)
+	}
+
+	if _, err := msg.Open(key); !stderrors.Is(err, protocol.ErrNotEncrypted) {
+		t.Errorf("Open of a plaintext message = %v, want ErrNotEncrypted", err)
+	}
+}
+
+func TestOpenRejects(t *testing.T) {
+	key := protocol.DeriveKey("s3cret")
+	sealed, err := protocol.NewMessage(protocol.TypeComposeAction, map[string]interface{}{"action": "stop"}).Seal(key)
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+
+	flipped := func(m *protocol.Message) {
+		data, _ := base64.StdEncoding.DecodeString(m.Payload.(string))
+		data[len(data)-1] ^= 0x01
+		m.Payload = base64.StdEncoding.EncodeToString(data)
+	}
+
+	tests := []struct {
+		name   string
+		key    []byte
+		tamper func(m *protocol.Message)
+	}{
+		{name: "wrong key", key: protocol.DeriveKey("other")},
+		{name: "key of the server key", key: protocol.DeriveKey("srv_0123456789abcdef")},
+		{name: "flipped ciphertext", key: key, tamper: flipped},
+		{name: "changed message ID", key: key, tamper: func(m *protocol.Message) { m.ID = "replayed" }},
+		{name: "changed message type", key: key, tamper: func(m *protocol.Message) { m.Type = protocol.TypeContainerLogs }},
+		{name: "truncated payload", key: key, tamper: func(m *protocol.Message) { m.Payload = "AAAA" }},
+		{name: "payload not a string", key: key, tamper: func(m *protocol.Message) { m.Payload = 42 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := *sealed
+			if tt.tamper != nil {
+				tt.tamper(&msg)
+			}
+			if opened, err := msg.Open(tt.key); err == nil {
+				t.Errorf("Open = %+v, want an error", opened)
+			}
+		})
+	}
+}
+
+func TestNewSecret(t *testing.T) {
+	first, err := protocol.NewSecret()
+	if err != nil {
+		t.Fatalf("NewSecret: %v", err)
+	}
+	second, err := protocol.NewSecret()
+	if err != nil {
+		t.Fatalf("NewSecret: %v", err)
+	}
+	if len(first) != 64 || first == second {
+		t.Errorf("NewSecret = %q, %q, want two different 32-byte hex secrets", first, second)
+	}
+}
@@ -0,0 +1,749 @@
+package protocol
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// MessageType represents the type of a message exchanged with an agent
+type MessageType string
+
+const (
+	TypeGetContainerLogs  MessageType = "get_container_logs"
+	TypeContainerLogs     MessageType = "container_logs"
+	TypeGetContainerStats MessageType = "get_container_stats"
+	TypeContainerStats    MessageType = "container_stats"
+	TypeListImages        MessageType = "list_images"
+	TypeImageList         MessageType = "image_list"
+	TypePullImage         MessageType = "pull_image"
+	TypeImagePulled       MessageType = "image_pulled"
+	TypePruneImages       MessageType = "prune_images"
+	TypeImagesPruned      MessageType = "images_pruned"
+	TypeListCompose       MessageType = "list_compose"
+	TypeComposeList       MessageType = "compose_list"
+	TypeComposeAction     MessageType = "compose_action"
+	TypeComposeResult     MessageType = "compose_result"
+	TypeExecCommand       MessageType = "exec_command"
+	TypeExecResult        MessageType = "exec_result"
+	TypeRunScript         MessageType = "run_script"
+	TypeScriptResult      MessageType = "script_result"
+	TypeListDir           MessageType = "list_dir"
+	TypeDirListing        MessageType = "dir_listing"
+	TypeReadFile          MessageType = "read_file"
+	TypeFileContent       MessageType = "file_content"
+	TypeCancelCommand     MessageType = "cancel_command"
+	TypeCommandCancelled  MessageType = "command_cancelled"
+	TypeSetRestartPolicy  MessageType = "set_restart_policies"
+	TypeRestartPolicySet  MessageType = "restart_policies_set"
+	TypePushSSHKey        MessageType = "push_ssh_key"
+	TypeSSHKeyPushed      MessageType = "ssh_key_pushed"
+	TypeGetTopProcesses   MessageType = "get_top_processes"
+	TypeTopProcesses      MessageType = "top_processes"
+	TypeGetDiskUsage      MessageType = "get_disk_usage"
+	TypeDiskUsage         MessageType = "disk_usage"
+	TypeGetSMART          MessageType = "get_smart"
+	TypeSMARTStatus       MessageType = "smart_status"
+	TypeGetGPU            MessageType = "get_gpu"
+	TypeGPUStatus         MessageType = "gpu_status"
+	TypeRunUptimeCheck    MessageType = "run_uptime_check"
+	TypeUptimeCheckResult MessageType = "uptime_check_result"
+	TypeGetUpdates        MessageType = "get_updates"
+	TypeUpdatesStatus     MessageType = "updates_status"
+	TypeApplyUpdates      MessageType = "apply_updates"
+	TypeUpdatesApplied    MessageType = "updates_applied"
+	TypeUpdateAgent       MessageType = "update_agent"
+	TypeAgentUpdating     MessageType = "agent_updating"
+	TypeGetAgentVersion   MessageType = "get_agent_version"
+	TypeAgentVersion      MessageType = "agent_version"
+	TypeSetLogWatches     MessageType = "set_log_watches"
+	TypeLogWatchesSet     MessageType = "log_watches_set"
+	TypeListPorts         MessageType = "list_ports"
+	TypePortList          MessageType = "port_list"
+	TypeListConnections   MessageType = "list_connections"
+	TypeConnectionList    MessageType = "connection_list"
+	TypeGetFirewall       MessageType = "get_firewall"
+	TypeFirewallStatus    MessageType = "firewall_status"
+	TypeBlockAddress      MessageType = "block_address"
+	TypeAddressBlocked    MessageType = "address_blocked"
+	TypeUnblockAddress    MessageType = "unblock_address"
+	TypeAddressUnblocked  MessageType = "address_unblocked"
+	TypeRunSpeedtest      MessageType = "run_speedtest"
+	TypeSpeedtestResult   MessageType = "speedtest_result"
+	TypePowerAction       MessageType = "power_action"
+	TypePowerActionQueued MessageType = "power_action_queued"
+	TypeGetBackups        MessageType = "get_backups"
+	TypeBackupStatus      MessageType = "backup_status"
+	TypeListPods          MessageType = "list_pods"
+	TypePodList           MessageType = "pod_list"
+	TypeListVMs           MessageType = "list_vms"
+	TypeVMList            MessageType = "vm_list"
+	TypeVMAction          MessageType = "vm_action"
+	TypeVMActionResult    MessageType = "vm_action_result"
+	TypeError             MessageType = "error"
+)
+
+// Message represents a command envelope sent to an agent or its response
+type Message struct {
+	ID          string      `json:"id"`
+	Type        MessageType `json:"type"`
+	Timestamp   time.Time   `json:"timestamp"`
+	Debug       bool        `json:"debug,omitempty"`       // replayed command, agent must not apply side effects
+	Encrypted   bool        `json:"encrypted,omitempty"`   // payload is sealed with the server secret, see Seal
+	Traceparent string      `json:"traceparent,omitempty"` // W3C trace context of a traced command, continued by the agent
+	ReplyTo     string      `json:"reply_to,omitempty"`    // ID of the command a response answers, on multiplexed connections
+	Payload     interface{} `json:"payload,omitempty"`
+}
+
+// NewMessage creates a new message with a random ID
+func NewMessage(msgType MessageType, payload interface{}) *Message {
+	return &Message{
+		ID:        newMessageID(),
+		Type:      msgType,
+		Timestamp: time.Now().UTC(),
+		Payload:   payload,
+	}
+}
+
+// newMessageID generates a random message identifier
+func newMessageID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().UTC().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
+
+// ErrorPayload represents an error reported by an agent
+type ErrorPayload struct {
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+// ContainerLogsPayload represents a request for the logs of a container
+type ContainerLogsPayload struct {
+	ContainerID string `json:"container_id"`
+	Tail        int    `json:"tail"`            // number of last lines, 0 for all
+	Since       string `json:"since,omitempty"` // RFC3339 timestamp or relative duration, e.g. "10m"
+}
+
+// ContainerLogsResponse represents the logs of a container returned by an agent
+type ContainerLogsResponse struct {
+	ContainerID   string   `json:"container_id"`
+	ContainerName string   `json:"container_name"`
+	Lines         []string `json:"lines"`
+}
+
+// ContainerStatsPayload represents a request for resource usage of containers
+type ContainerStatsPayload struct {
+	ContainerIDs []string `json:"container_ids,omitempty"` // empty for all running containers
+}
+
+// ContainerStats represents a single resource usage sample of a container (docker stats --no-stream)
+type ContainerStats struct {
+	ContainerID   string  `json:"container_id"`
+	Name          string  `json:"name"`
+	CPUPercent    float64 `json:"cpu_percent"`
+	MemoryUsage   uint64  `json:"memory_usage"` // bytes
+	MemoryLimit   uint64  `json:"memory_limit"` // bytes
+	MemoryPercent float64 `json:"memory_percent"`
+	NetworkRx     uint64  `json:"network_rx"`        // bytes
+	NetworkTx     uint64  `json:"network_tx"`        // bytes
+	BlockRead     uint64  `json:"block_read"`        // bytes
+	BlockWrite    uint64  `json:"block_write"`       // bytes
+	Project       string  `json:"project,omitempty"` // compose project, from the com.docker.compose.project label
+}
+
+// ContainerStatsResponse represents resource usage of containers returned by an agent
+type ContainerStatsResponse struct {
+	Containers []ContainerStats `json:"containers"`
+}
+
+// ImageInfo represents a Docker image on a server
+type ImageInfo struct {
+	ID         string    `json:"id"`
+	Repository string    `json:"repository"` // "<none>" for dangling images
+	Tag        string    `json:"tag"`
+	Size       uint64    `json:"size"` // bytes
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ImageListResponse represents images returned by an agent
+type ImageListResponse struct {
+	Images []ImageInfo `json:"images"`
+}
+
+// PullImagePayload represents a request to pull an image
+type PullImagePayload struct {
+	Image string `json:"image"` // reference, e.g. "nginx:latest"
+}
+
+// ImagePullProgress represents the final status of a single layer of a pulled image
+type ImagePullProgress struct {
+	Layer  string `json:"layer"`
+	Status string `json:"status"` // e.g. "Pull complete", "Already exists"
+}
+
+// ImagePullResponse represents the result of an image pull
+type ImagePullResponse struct {
+	Image    string              `json:"image"`
+	Digest   string              `json:"digest,omitempty"`
+	Status   string              `json:"status"` // e.g. "Downloaded newer image", "Image is up to date"
+	Progress []ImagePullProgress `json:"progress,omitempty"`
+}
+
+// PruneImagesPayload represents a request to remove unused images
+type PruneImagesPayload struct {
+	DanglingOnly bool `json:"dangling_only"`
+}
+
+// ImagesPrunedResponse represents the result of an image prune
+type ImagesPrunedResponse struct {
+	Deleted        []string `json:"deleted"`
+	SpaceReclaimed uint64   `json:"space_reclaimed"` // bytes
+}
+
+// ComposeAction represents an operation on a compose project
+type ComposeAction string
+
+const (
+	ComposeUp      ComposeAction = "up"
+	ComposeDown    ComposeAction = "down"
+	ComposeRestart ComposeAction = "restart"
+)
+
+// ComposeService represents a service of a compose project
+type ComposeService struct {
+	Name        string `json:"name"`
+	ContainerID string `json:"container_id,omitempty"`
+	State       string `json:"state"`            // e.g. "running", "exited"
+	Health      string `json:"health,omitempty"` // e.g. "healthy", "unhealthy"
+}
+
+// ComposeProject represents a compose project detected on a server (docker compose ls)
+type ComposeProject struct {
+	Name        string           `json:"name"`
+	Status      string           `json:"status"` // e.g. "running(3)", "exited(1)"
+	ConfigFiles []string         `json:"config_files"`
+	Services    []ComposeService `json:"services"`
+}
+
+// ComposeListResponse represents compose projects returned by an agent
+type ComposeListResponse struct {
+	Projects []ComposeProject `json:"projects"`
+}
+
+// ComposeActionPayload represents a request to run an operation on a compose project
+type ComposeActionPayload struct {
+	Project string        `json:"project"`
+	Action  ComposeAction `json:"action"`
+}
+
+// ComposeActionResponse represents the result of a compose project operation
+type ComposeActionResponse struct {
+	Project string         `json:"project"`
+	Action  ComposeAction  `json:"action"`
+	Output  []string       `json:"output,omitempty"` // last lines of docker compose output
+	State   ComposeProject `json:"state"`            // project state after the operation
+}
+
+// ExecCommandPayload represents a request to run an allow-listed shell command.
+// The agent executes the argument vector directly, without a shell.
+type ExecCommandPayload struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+}
+
+// ExecResultResponse represents the outcome of a shell command or script
+type ExecResultResponse struct {
+	ExitCode  int    `json:"exit_code"`
+	Output    string `json:"output"`              // combined stdout and stderr
+	Truncated bool   `json:"truncated,omitempty"` // output exceeded the agent limit
+}
+
+// RunScriptPayload represents a request to run a script from an allow-listed directory.
+// The response is an ExecResultResponse of type TypeScriptResult.
+type RunScriptPayload struct {
+	Script string   `json:"script"` // absolute path on the server
+	Args   []string `json:"args,omitempty"`
+}
+
+// ListDirPayload represents a request to list a directory. Agents only serve paths
+// inside their configured allow-list and answer with an error otherwise.
+type ListDirPayload struct {
+	Path string `json:"path"`
+}
+
+// DirEntry represents a file or directory in a listing
+type DirEntry struct {
+	Name    string    `json:"name"`
+	IsDir   bool      `json:"is_dir"`
+	Size    int64     `json:"size"`
+	Mode    string    `json:"mode"` // e.g. "-rw-r--r--"
+	ModTime time.Time `json:"mod_time"`
+}
+
+// DirListingResponse represents the contents of a directory
+type DirListingResponse struct {
+	Path      string     `json:"path"`
+	Entries   []DirEntry `json:"entries"`
+	Truncated bool       `json:"truncated,omitempty"` // the agent returned only part of the entries
+}
+
+// GetDiskUsagePayload represents a request for the largest directories under a path,
+// like du -x --max-depth=N | sort -rh. Agents stay on the file system of the path and
+// apply the same allow-list as ListDirPayload.
+type GetDiskUsagePayload struct {
+	Path     string `json:"path"`
+	MaxDepth int    `json:"max_depth"`
+	Limit    int    `json:"limit"` // number of largest directories to return
+}
+
+// DiskUsageEntry represents the size of a directory including its subdirectories
+type DiskUsageEntry struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// DiskUsageResponse represents the largest directories under a path, largest first
+type DiskUsageResponse struct {
+	Path           string           `json:"path"`
+	Size           int64            `json:"size"` // total size of the path
+	Entries        []DiskUsageEntry `json:"entries"`
+	FilesystemSize int64            `json:"filesystem_size,omitempty"`
+	FilesystemUsed int64            `json:"filesystem_used,omitempty"`
+	Unreadable     int              `json:"unreadable,omitempty"` // directories skipped for lack of permissions
+}
+
+// SMARTDrive represents the SMART health of a drive as collected by smartctl. Counters
+// are -1 when the drive does not report them.
+type SMARTDrive struct {
+	Device               string `json:"device"`         // e.g. /dev/sda
+	Type                 string `json:"type,omitempty"` // smartctl device type, e.g. sat or nvme
+	Model                string `json:"model,omitempty"`
+	Serial               string `json:"serial,omitempty"`
+	Passed               bool   `json:"passed"`                // overall health self-assessment
+	ReallocatedSectors   int64  `json:"reallocated_sectors"`   // attribute 5
+	PendingSectors       int64  `json:"pending_sectors"`       // attribute 197
+	UncorrectableSectors int64  `json:"uncorrectable_sectors"` // attribute 198, media errors of NVMe drives
+	Temperature          int    `json:"temperature"`           // Celsius, 0 when unknown
+	PowerOnHours         int64  `json:"power_on_hours,omitempty"`
+	Error                string `json:"error,omitempty"` // the drive could not be read
+}
+
+// SMARTResponse represents the SMART health of the drives of a server
+type SMARTResponse struct {
+	Drives []SMARTDrive `json:"drives"`
+}
+
+// GPUDevice represents the readings of a GPU as collected by nvidia-smi. Readings are -1
+// when the GPU does not report them.
+type GPUDevice struct {
+	Index         int     `json:"index"`
+	Name          string  `json:"name"`
+	UUID          string  `json:"uuid,omitempty"`
+	Utilization   float64 `json:"utilization"`     // percent
+	MemoryUsedMB  float64 `json:"memory_used_mb"`  // MiB
+	MemoryTotalMB float64 `json:"memory_total_mb"` // MiB
+	Temperature   float64 `json:"temperature"`     // Celsius
+	PowerDrawW    float64 `json:"power_draw_w"`
+	PowerLimitW   float64 `json:"power_limit_w"`
+}
+
+// GPUResponse represents the GPUs of a server. Available is false when the server has no
+// NVIDIA driver or nvidia-smi, which is not an error.
+type GPUResponse struct {
+	Available bool        `json:"available"`
+	Driver    string      `json:"driver,omitempty"` // NVIDIA driver version
+	GPUs      []GPUDevice `json:"gpus"`
+}
+
+// RunUptimeCheckPayload represents a request to probe an endpoint from a server, for
+// uptime checks of endpoints only reachable from its network
+type RunUptimeCheckPayload struct {
+	Kind           string `json:"kind"`   // "http" or "tcp"
+	Target         string `json:"target"` // URL of HTTP checks, host:port of TCP checks
+	TimeoutSeconds int    `json:"timeout_seconds"`
+}
+
+// UptimeCheckResultResponse represents the outcome of a probe run by an agent
+type UptimeCheckResultResponse struct {
+	Up         bool   `json:"up"` // connected, and an HTTP status below 400
+	LatencyMs  int64  `json:"latency_ms"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// PackageUpdate represents an OS package with a newer version available
+type PackageUpdate struct {
+	Name           string `json:"name"`
+	CurrentVersion string `json:"current_version,omitempty"`
+	NewVersion     string `json:"new_version"`
+	Security       bool   `json:"security"` // the update fixes a security issue
+}
+
+// UpdatesResponse represents the pending OS package updates of a server
+type UpdatesResponse struct {
+	Manager        string          `json:"manager"` // apt, dnf or yum
+	Packages       []PackageUpdate `json:"packages"`
+	RebootRequired bool            `json:"reboot_required,omitempty"`
+}
+
+// ApplyUpdatesPayload represents a request to install pending updates. Agents only
+// support installing security updates.
+type ApplyUpdatesPayload struct {
+	SecurityOnly bool `json:"security_only"`
+}
+
+// UpdatesAppliedResponse represents the outcome of installing updates
+type UpdatesAppliedResponse struct {
+	Manager        string   `json:"manager"`
+	Upgraded       []string `json:"upgraded"` // names of the upgraded packages
+	Output         string   `json:"output,omitempty"`
+	RebootRequired bool     `json:"reboot_required,omitempty"`
+}
+
+// Release channels of agent updates
+const (
+	ChannelStable = "stable"
+	ChannelBeta   = "beta"
+)
+
+// UpdateAgentPayload represents a request to the agent to replace itself with another
+// release. The agent keeps its current binary and restores it when the new one cannot
+// reach the bot within RollbackAfterSeconds.
+type UpdateAgentPayload struct {
+	Channel              string `json:"channel"`           // stable or beta
+	Version              string `json:"version,omitempty"` // pinned release, empty for the latest of the channel
+	RollbackAfterSeconds int    `json:"rollback_after_seconds"`
+}
+
+// AgentUpdatingResponse represents an agent about to restart into another release
+type AgentUpdatingResponse struct {
+	CurrentVersion string `json:"current_version"`
+	TargetVersion  string `json:"target_version"` // release resolved from the channel or the pin
+}
+
+// AgentVersionResponse represents the release an agent runs
+type AgentVersionResponse struct {
+	Version    string `json:"version"`
+	Channel    string `json:"channel"`
+	RolledBack bool   `json:"rolled_back,omitempty"` // the last update failed and the previous release was restored
+}
+
+// ReadFilePayload represents a request to read a file, subject to the same allow-list as ListDirPayload
+type ReadFilePayload struct {
+	Path     string `json:"path"`
+	MaxBytes int64  `json:"max_bytes"`
+	Tail     bool   `json:"tail,omitempty"` // read the last MaxBytes instead of the first
+}
+
+// FileContentResponse represents the contents of a file
+type FileContentResponse struct {
+	Path      string `json:"path"`
+	Size      int64  `json:"size"` // full file size
+	Content   string `json:"content"`
+	Truncated bool   `json:"truncated,omitempty"` // the file is larger than MaxBytes
+	Binary    bool   `json:"binary,omitempty"`    // content omitted, the file is not text
+}
+
+// CancelCommandPayload represents a request to stop a command the agent is still running
+type CancelCommandPayload struct {
+	MessageID string `json:"message_id"` // ID of the message of the command to stop
+	Reason    string `json:"reason,omitempty"`
+}
+
+// CommandCancelledResponse represents the result of a cancellation
+type CommandCancelledResponse struct {
+	MessageID string `json:"message_id"`
+	Stopped   bool   `json:"stopped"`          // false when the command was no longer running
+	Output    string `json:"output,omitempty"` // output produced before the command was stopped
+}
+
+// RestartPolicy represents a limit of container restarts. Agents watch Docker events
+// and stop restarting a container that exits more than MaxRestarts times within
+// the window, then report it to the bot.
+type RestartPolicy struct {
+	Container     string `json:"container"` // container name
+	MaxRestarts   int    `json:"max_restarts"`
+	WindowSeconds int    `json:"window_seconds"`
+}
+
+// RestartPoliciesPayload represents the complete set of restart policies of a server,
+// replacing the policies the agent enforced before
+type RestartPoliciesPayload struct {
+	Policies []RestartPolicy `json:"policies"`
+}
+
+// RestartPoliciesSetResponse represents the acknowledgement of restart policies
+type RestartPoliciesSetResponse struct {
+	Applied int `json:"applied"` // number of policies the agent enforces
+}
+
+// ProcessSort is the column top processes are sorted by
+type ProcessSort string
+
+const (
+	ProcessSortCPU    ProcessSort = "cpu"
+	ProcessSortMemory ProcessSort = "memory"
+)
+
+// GetTopProcessesPayload represents a request for the processes using the most CPU or memory
+type GetTopProcessesPayload struct {
+	SortBy ProcessSort `json:"sort_by"`
+	Limit  int         `json:"limit"`
+}
+
+// ProcessInfo represents a running process
+type ProcessInfo struct {
+	PID           int     `json:"pid"`
+	User          string  `json:"user"`
+	Name          string  `json:"name"`
+	Command       string  `json:"command,omitempty"` // command line, possibly truncated by the agent
+	CPUPercent    float64 `json:"cpu_percent"`
+	MemoryPercent float64 `json:"memory_percent"`
+	MemoryBytes   uint64  `json:"memory_bytes"` // resident set size
+}
+
+// TopProcessesResponse represents the top processes of a server
+type TopProcessesResponse struct {
+	Processes []ProcessInfo `json:"processes"`
+	Total     int           `json:"total"` // number of running processes
+}
+
+// PushSSHKeyPayload represents a request to authorize an SSH public key on a server.
+// The agent appends the key to the authorized_keys file set in its configuration, never
+// to a file named by the bot, and leaves the file unchanged when the key is already there.
+type PushSSHKeyPayload struct {
+	Key         string `json:"key"`         // single authorized_keys line without options
+	Fingerprint string `json:"fingerprint"` // SHA256 fingerprint as printed by ssh-keygen -l
+}
+
+// SSHKeyPushedResponse represents the result of an SSH key push
+type SSHKeyPushedResponse struct {
+	File        string `json:"file"`  // authorized_keys file of the agent
+	Added       bool   `json:"added"` // false when the key was already authorized
+	Fingerprint string `json:"fingerprint"`
+}
+
+// RestartPolicyTripped represents the report of an agent that stopped restarting a container
+type RestartPolicyTripped struct {
+	Container     string    `json:"container"`
+	Restarts      int       `json:"restarts"` // exits within the window
+	WindowSeconds int       `json:"window_seconds"`
+	ExitCode      int       `json:"exit_code"` // of the last exit
+	StoppedAt     time.Time `json:"stopped_at"`
+}
+
+// LogWatch represents a log file an agent tails. New lines matching the pattern are
+// reported to the bot, see LogMatchReport.
+type LogWatch struct {
+	ID      int64  `json:"id"`
+	Path    string `json:"path"`    // absolute path of the log file
+	Pattern string `json:"pattern"` // RE2 regular expression
+}
+
+// LogWatchesPayload represents the complete set of log watches of a server, replacing
+// the watches the agent tailed before
+type LogWatchesPayload struct {
+	Watches []LogWatch `json:"watches"`
+}
+
+// LogWatchesSetResponse represents the acknowledgement of log watches
+type LogWatchesSetResponse struct {
+	Applied int `json:"applied"` // number of files the agent tails
+}
+
+// LogMatch represents a line of a watched log file that matched the pattern of its watch
+type LogMatch struct {
+	WatchID   int64     `json:"watch_id"`
+	Line      string    `json:"line"` // possibly truncated by the agent
+	MatchedAt time.Time `json:"matched_at"`
+}
+
+// LogMatchReport represents the matching lines an agent found since its previous report
+type LogMatchReport struct {
+	Matches []LogMatch `json:"matches"`
+}
+
+// ListeningSocket represents a socket a server accepts connections or datagrams on, as
+// listed by ss -tulpn
+type ListeningSocket struct {
+	Protocol string `json:"protocol"` // tcp, tcp6, udp or udp6
+	Address  string `json:"address"`  // local address, e.g. 0.0.0.0, :: or 127.0.0.1
+	Port     int    `json:"port"`
+	PID      int    `json:"pid,omitempty"`     // 0 when the agent cannot see the owning process
+	Process  string `json:"process,omitempty"` // name of the owning process
+}
+
+// PortListResponse represents the listening sockets of a server
+type PortListResponse struct {
+	Sockets []ListeningSocket `json:"sockets"`
+}
+
+// Connection represents an established TCP connection of a server
+type Connection struct {
+	LocalAddress  string `json:"local_address"`
+	LocalPort     int    `json:"local_port"`
+	RemoteAddress string `json:"remote_address"`
+	RemotePort    int    `json:"remote_port"`
+	Process       string `json:"process,omitempty"` // name of the owning process
+}
+
+// ConnectionListResponse represents the established connections of a server
+type ConnectionListResponse struct {
+	Connections []Connection `json:"connections"`
+	Truncated   bool         `json:"truncated,omitempty"` // the agent listed only part of the connections
+	Total       int          `json:"total"`               // number of established connections
+}
+
+// FirewallRule represents a rule of the firewall of a server as summarized by the agent
+type FirewallRule struct {
+	Action   string `json:"action"`             // allow, deny, reject, or the iptables target
+	Protocol string `json:"protocol,omitempty"` // empty for any protocol
+	Port     string `json:"port,omitempty"`     // port or range, empty for any port
+	Source   string `json:"source,omitempty"`   // empty for anywhere
+	Raw      string `json:"raw,omitempty"`      // rule as printed by the firewall, for rules the fields cannot express
+}
+
+// FirewallStatusResponse represents the firewall of a server. Agents read ufw first,
+// then nftables, then iptables.
+type FirewallStatusResponse struct {
+	Backend       string         `json:"backend"` // ufw, nftables or iptables, empty when none is found
+	Active        bool           `json:"active"`
+	DefaultPolicy string         `json:"default_policy,omitempty"` // of incoming traffic
+	Rules         []FirewallRule `json:"rules"`
+}
+
+// AddressPayload represents a request to block or unblock all incoming traffic from an
+// address. Agents add and remove the rule with the firewall they report in FirewallStatusResponse.
+type AddressPayload struct {
+	Address string `json:"address"` // IP address or CIDR network
+}
+
+// AddressChangedResponse represents the result of blocking or unblocking an address
+type AddressChangedResponse struct {
+	Backend string `json:"backend"`
+	Changed bool   `json:"changed"` // false when the address already was in the requested state
+}
+
+// RunSpeedtestPayload represents a request to measure the bandwidth of a server. Agents
+// download from and upload to Endpoint when it is set and run speedtest-cli otherwise.
+type RunSpeedtestPayload struct {
+	Endpoint       string `json:"endpoint,omitempty"`
+	TimeoutSeconds int    `json:"timeout_seconds"`
+}
+
+// SpeedtestResultResponse represents the measured bandwidth of a server
+type SpeedtestResultResponse struct {
+	Tool         string  `json:"tool"`             // speedtest-cli or endpoint
+	Server       string  `json:"server,omitempty"` // test server the agent measured against
+	LatencyMs    float64 `json:"latency_ms"`
+	DownloadMbps float64 `json:"download_mbps"`
+	UploadMbps   float64 `json:"upload_mbps"`
+}
+
+// PowerActionPayload represents a request to reboot or shut down a server. Agents reply
+// first and act after DelaySeconds, so that the reply reaches the bot.
+type PowerActionPayload struct {
+	Action       string `json:"action"` // reboot or shutdown
+	DelaySeconds int    `json:"delay_seconds"`
+}
+
+// PowerActionResponse represents a reboot or shutdown scheduled by an agent
+type PowerActionResponse struct {
+	Action string `json:"action"`
+}
+
+// BackupRepository represents a restic or borg repository configured on an agent, with
+// its latest snapshot. Repositories and their credentials are set in the agent configuration.
+type BackupRepository struct {
+	Name          string    `json:"name"`
+	Tool          string    `json:"tool"` // restic or borg
+	LastSnapshot  time.Time `json:"last_snapshot,omitempty"`
+	LastSuccess   time.Time `json:"last_success,omitempty"` // end of the last backup run that succeeded
+	LastRunFailed bool      `json:"last_run_failed,omitempty"`
+	Size          int64     `json:"size"` // bytes stored in the repository
+	Snapshots     int       `json:"snapshots"`
+	MaxAgeSeconds int64     `json:"max_age_seconds,omitempty"` // age of the last success to alert at, overriding the bot default
+	Error         string    `json:"error,omitempty"`           // the repository could not be read
+}
+
+// BackupsResponse represents the backup repositories of a server
+type BackupsResponse struct {
+	Repositories []BackupRepository `json:"repositories"`
+}
+
+// ListPodsPayload represents a request to list the Kubernetes pods a node can see
+type ListPodsPayload struct {
+	Namespace string `json:"namespace,omitempty"` // empty for all namespaces
+}
+
+// KubeNode represents a Kubernetes node with its conditions
+type KubeNode struct {
+	Name       string   `json:"name"`
+	Ready      bool     `json:"ready"`
+	Version    string   `json:"version,omitempty"`    // kubelet version
+	Conditions []string `json:"conditions,omitempty"` // pressure conditions that are true, e.g. MemoryPressure
+}
+
+// KubePod represents a Kubernetes pod
+type KubePod struct {
+	Namespace  string    `json:"namespace"`
+	Name       string    `json:"name"`
+	Phase      string    `json:"phase"`            // Pending, Running, Succeeded, Failed or Unknown
+	Reason     string    `json:"reason,omitempty"` // waiting or termination reason of a container, e.g. CrashLoopBackOff
+	Ready      int       `json:"ready"`            // ready containers
+	Containers int       `json:"containers"`
+	Restarts   int       `json:"restarts"`
+	Node       string    `json:"node,omitempty"`
+	StartedAt  time.Time `json:"started_at,omitempty"`
+}
+
+// PodListResponse represents the Kubernetes nodes and pods seen by an agent. Agents use
+// the in-cluster service account or kubectl; Available is false when they have neither.
+type PodListResponse struct {
+	Available bool       `json:"available"`
+	Nodes     []KubeNode `json:"nodes,omitempty"`
+	Pods      []KubePod  `json:"pods"`
+}
+
+// VM represents a virtual machine of a libvirt or Proxmox host
+type VM struct {
+	ID              string  `json:"id"` // libvirt domain name or Proxmox VMID
+	Name            string  `json:"name"`
+	State           string  `json:"state"` // e.g. running, shut off, paused
+	VCPUs           int     `json:"vcpus"`
+	CPUPercent      float64 `json:"cpu_percent"`
+	MemoryBytes     int64   `json:"memory_bytes"` // configured memory
+	MemoryUsedBytes int64   `json:"memory_used_bytes,omitempty"`
+	UptimeSeconds   int64   `json:"uptime_seconds,omitempty"`
+}
+
+// VMListResponse represents the virtual machines of a server. Agents detect Proxmox
+// first, then libvirt; Hypervisor is empty when the server hosts neither.
+type VMListResponse struct {
+	Hypervisor string `json:"hypervisor"` // proxmox or libvirt
+	VMs        []VM   `json:"vms"`
+}
+
+// VMAction represents an operation on a virtual machine
+type VMAction string
+
+const (
+	VMStart    VMAction = "start"
+	VMShutdown VMAction = "shutdown" // graceful, through ACPI or the guest agent
+)
+
+// VMActionPayload represents a request to start or shut down a virtual machine
+type VMActionPayload struct {
+	VM     string   `json:"vm"` // VM.ID
+	Action VMAction `json:"action"`
+}
+
+// VMActionResponse represents the result of a virtual machine operation
+type VMActionResponse struct {
+	VM     string   `json:"vm"`
+	Action VMAction `json:"action"`
+	State  string   `json:"state"` // state after the operation
+}
@@ -0,0 +1,146 @@
+package protocol_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/servereye/servereyebot/pkg/protocol"
+)
+
+// sampleStats returns a container stats response of a host running a compose stack
+func sampleStats() *protocol.ContainerStatsResponse {
+	resp := &protocol.ContainerStatsResponse{}
+	for i := 0; i < 20; i++ {
+		resp.Containers = append(resp.Containers, protocol.ContainerStats{
+			ContainerID:   fmt.Sprintf("%012x", i*7919),
+			Name:          fmt.Sprintf("app-worker-%d", i),
+			CPUPercent:    float64(i) * 1.7,
+			MemoryUsage:   uint64(i+1) << 26,
+			MemoryLimit:   1 << 31,
+			MemoryPercent: float64(i+1) * 3.1,
+			NetworkRx:     uint64(i+1) << 24,
+			NetworkTx:     uint64(i+1) << 22,
+			BlockRead:     uint64(i+1) << 20,
+			BlockWrite:    uint64(i+1) << 21,
+			Project:       "app",
+		})
+	}
+	return resp
+}
+
+// sampleLogs returns a container logs response of a hundred lines
+func sampleLogs() *protocol.ContainerLogsResponse {
+	resp := &protocol.ContainerLogsResponse{ContainerID: "4f2a9c1e7b3d", ContainerName: "app-worker-1"}
+	for i := 0; i < 100; i++ {
+		resp.Lines = append(resp.Lines, fmt.Sprintf("2026-10-16T09:%02d:00Z INFO request handled path=/api/v1/items/%d status=200 duration=12ms", i%60, i))
+	}
+	return resp
+}
+
+// sampleMessage wraps a response payload in a message with a fixed ID and timestamp
+func sampleMessage(msgType protocol.MessageType, payload interface{}) *protocol.Message {
+	return &protocol.Message{
+		ID:        "0123456789abcdef0123456789abcdef",
+		Type:      msgType,
+		Timestamp: time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC),
+		Payload:   payload,
+	}
+}
+
+// benchmarkEncode measures JSON encoding of a message
+func benchmarkEncode(b *testing.B, msg *protocol.Message) {
+	encoded, err := json.Marshal(msg)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(int64(len(encoded)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := json.Marshal(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchmarkDecode measures JSON decoding of a message into a typed payload
+func benchmarkDecode(b *testing.B, msg *protocol.Message, payload func() interface{}) {
+	encoded, err := json.Marshal(msg)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(int64(len(encoded)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		out := protocol.Message{Payload: payload()}
+		if err := json.Unmarshal(encoded, &out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchmarkSeal measures encryption of a message for an agent
+func benchmarkSeal(b *testing.B, msg *protocol.Message) {
+	key := protocol.DeriveKey("benchmark-secret")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := msg.Seal(key); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchmarkOpen measures decryption of a message from an agent
+func benchmarkOpen(b *testing.B, msg *protocol.Message) {
+	key := protocol.DeriveKey("benchmark-secret")
+	sealed, err := msg.Seal(key)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := sealed.Open(key); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncodeStats(b *testing.B) {
+	benchmarkEncode(b, sampleMessage(protocol.TypeContainerStats, sampleStats()))
+}
+
+func BenchmarkDecodeStats(b *testing.B) {
+	benchmarkDecode(b, sampleMessage(protocol.TypeContainerStats, sampleStats()), func() interface{} { return &protocol.ContainerStatsResponse{} })
+}
+
+func BenchmarkSealStats(b *testing.B) {
+	benchmarkSeal(b, sampleMessage(protocol.TypeContainerStats, sampleStats()))
+}
+
+func BenchmarkOpenStats(b *testing.B) {
+	benchmarkOpen(b, sampleMessage(protocol.TypeContainerStats, sampleStats()))
+}
+
+func BenchmarkEncodeLogs(b *testing.B) {
+	benchmarkEncode(b, sampleMessage(protocol.TypeContainerLogs, sampleLogs()))
+}
+
+func BenchmarkDecodeLogs(b *testing.B) {
+	benchmarkDecode(b, sampleMessage(protocol.TypeContainerLogs, sampleLogs()), func() interface{} { return &protocol.ContainerLogsResponse{} })
+}
+
+func BenchmarkSealLogs(b *testing.B) {
+	benchmarkSeal(b, sampleMessage(protocol.TypeContainerLogs, sampleLogs()))
+}
+
+func BenchmarkOpenLogs(b *testing.B) {
+	benchmarkOpen(b, sampleMessage(protocol.TypeContainerLogs, sampleLogs()))
+}
@@ -0,0 +1,78 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// PayloadError reports a message whose payload does not match its type
+type PayloadError struct {
+	Type MessageType
+	Err  error
+}
+
+// Error implements error
+func (e *PayloadError) Error() string {
+	return fmt.Sprintf("malformed '%s' payload: %v", e.Type, e.Err)
+}
+
+// Unwrap returns the decoding error
+func (e *PayloadError) Unwrap() error {
+	return e.Err
+}
+
+// UnexpectedTypeError reports a message of another type than the one expected
+type UnexpectedTypeError struct {
+	Expected MessageType
+	Got      MessageType
+}
+
+// Error implements error
+func (e *UnexpectedTypeError) Error() string {
+	return fmt.Sprintf("unexpected message type '%s', expected '%s'", e.Got, e.Expected)
+}
+
+// NewReply creates the response to a command, linked to it by ReplyTo
+func NewReply(cmd *Message, msgType MessageType, payload interface{}) *Message {
+	reply := NewMessage(msgType, payload)
+	reply.ReplyTo = cmd.ID
+	return reply
+}
+
+// DecodePayload decodes the payload of a message into T. Payloads of messages read from
+// JSON are generic maps and are converted; payloads already holding a T are returned as is.
+func DecodePayload[T any](msg *Message) (*T, error) {
+	switch payload := msg.Payload.(type) {
+	case T:
+		return &payload, nil
+	case *T:
+		if payload != nil {
+			return payload, nil
+		}
+	}
+
+	var data []byte
+	switch payload := msg.Payload.(type) {
+	case json.RawMessage:
+		data = payload
+	default:
+		var err error
+		if data, err = json.Marshal(payload); err != nil {
+			return nil, &PayloadError{Type: msg.Type, Err: err}
+		}
+	}
+
+	var out T
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, &PayloadError{Type: msg.Type, Err: err}
+	}
+	return &out, nil
+}
+
+// DecodeResponse checks that a response has the expected type and decodes its payload
+func DecodeResponse[T any](msg *Message, expected MessageType) (*T, error) {
+	if msg.Type != expected {
+		return nil, &UnexpectedTypeError{Expected: expected, Got: msg.Type}
+	}
+	return DecodePayload[T](msg)
+}